@@ -0,0 +1,39 @@
+#!/usr/bin/env python
+# coding: utf8
+"""Fill lookup of contacts' cards named by CardDAV clients."""
+
+from __future__ import unicode_literals
+
+import argparse
+import logging
+
+from caliopen_storage.config import Configuration
+from caliopen_storage.helpers.connection import connect_storage
+
+log = logging.getLogger(__name__)
+logging.basicConfig(level=logging.INFO)
+
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser()
+    parser.add_argument('-f', dest='conffile')
+    parser.add_argument('-t', dest='test', action='store_true', default=False)
+
+    args = parser.parse_args()
+    Configuration.load(args.conffile, 'global')
+    connect_storage()
+    from cassandra.cqlengine.connection import get_session
+    from caliopen_main.contact.store import Contact
+
+    session = get_session()
+    insert = session.prepare('INSERT INTO contact_carddav_lookup '
+                             '(user_id, name, contact_id) VALUES (?, ?, ?)')
+    cpt = 0
+    for contact in Contact.all():
+        name = (contact.infos or {}).get('carddav_name')
+        if name and not contact.deleted:
+            cpt += 1
+            if not args.test:
+                session.execute(insert,
+                                (contact.user_id, name, contact.contact_id))
+    log.info('{} cards named by CardDAV clients'.format(cpt))
@@ -0,0 +1,35 @@
+#!/usr/bin/env python
+# coding: utf8
+"""Fill lookup of users who subscribed to an email digest."""
+
+from __future__ import unicode_literals
+
+import argparse
+import logging
+
+from caliopen_storage.config import Configuration
+from caliopen_storage.helpers.connection import connect_storage
+
+log = logging.getLogger(__name__)
+logging.basicConfig(level=logging.INFO)
+
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser()
+    parser.add_argument('-f', dest='conffile')
+    parser.add_argument('-t', dest='test', action='store_true', default=False)
+
+    args = parser.parse_args()
+    Configuration.load(args.conffile, 'global')
+    connect_storage()
+    from caliopen_main.user.store import Settings, SettingsDigestLookup
+
+    cpt = 0
+    for settings in Settings.all():
+        if settings.notification_digest in ('daily', 'weekly'):
+            cpt += 1
+            if not args.test:
+                SettingsDigestLookup.create(
+                    notification_digest=settings.notification_digest,
+                    user_id=settings.user_id)
+    log.info('{} users subscribed to an email digest'.format(cpt))
@@ -0,0 +1,34 @@
+#!/usr/bin/env python
+# coding: utf8
+"""Fill lookup of local identities by Web Key Directory hash."""
+
+from __future__ import unicode_literals
+
+import argparse
+import logging
+
+from caliopen_storage.config import Configuration
+from caliopen_storage.helpers.connection import connect_storage
+
+log = logging.getLogger(__name__)
+logging.basicConfig(level=logging.INFO)
+
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser()
+    parser.add_argument('-f', dest='conffile')
+    parser.add_argument('-t', dest='test', action='store_true', default=False)
+
+    args = parser.parse_args()
+    Configuration.load(args.conffile, 'global')
+    connect_storage()
+    from caliopen_main.user.store import UserIdentity
+    from caliopen_main.user.core import WkdLookup
+
+    cpt = 0
+    for identity in UserIdentity.all():
+        if identity.type == 'local' and '@' in identity.identifier:
+            cpt += 1
+            if not args.test:
+                WkdLookup.create_for(identity)
+    log.info('{} local identities'.format(cpt))
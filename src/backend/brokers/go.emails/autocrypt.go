@@ -0,0 +1,308 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// autocryptEmail holds what Autocrypt needs to know about an inbound email
+type autocryptEmail struct {
+	From   string           // lower-cased address of email's single sender
+	Date   time.Time        // effective date : email's date, unless it is in the future
+	Header *AutocryptHeader // nil if email has no valid Autocrypt header for its sender
+	Setup  bool             // email is an Autocrypt Setup Message
+	// first digits of setup code, as given by setup message to help user to enter it
+	PassphraseBegin string
+}
+
+// parseAutocryptEmail extracts Autocrypt header and setup message's infos from a raw email.
+// It returns nil if email must not be taken into account to update Autocrypt state,
+// because it hasn't a single sender or it is a delivery report.
+func parseAutocryptEmail(raw []byte, now time.Time) (*autocryptEmail, error) {
+	email, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddressList(email.Header.Get("From"))
+	if err != nil || len(from) != 1 {
+		return nil, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if mediaType == "multipart/report" {
+		return nil, nil
+	}
+	ac := &autocryptEmail{From: strings.ToLower(from[0].Address), Date: now}
+	if date, err := email.Header.Date(); err == nil && date.Before(now) {
+		ac.Date = date
+	}
+
+	// header is only taken into account if it's the only one valid for sender
+	for _, value := range email.Header["Autocrypt"] {
+		header, err := ParseAutocryptHeader(value)
+		if err != nil {
+			log.WithError(err).Infof("[EmailBroker] invalid autocrypt header from %s", ac.From)
+			continue
+		}
+		if header.Addr != ac.From {
+			continue
+		}
+		if ac.Header != nil {
+			ac.Header = nil
+			break
+		}
+		ac.Header = header
+	}
+
+	if strings.TrimSpace(email.Header.Get("Autocrypt-Setup-Message")) == "v1" {
+		ac.Setup = true
+		setup, err := findPart(email.Header.Get("Content-Type"), decodePart(email.Body, email.Header.Get("Content-Transfer-Encoding")), "application/autocrypt-setup")
+		if err != nil || setup == nil {
+			return ac, errors.New("autocrypt setup message without application/autocrypt-setup part")
+		}
+		block, err := armor.Decode(bytes.NewReader(setup))
+		if err != nil {
+			return ac, err
+		}
+		ac.PassphraseBegin = block.Header["Passphrase-Begin"]
+	}
+	return ac, nil
+}
+
+// findPart walks through email's parts to return the content of the first one of mediaType
+func findPart(contentType string, body io.Reader, mediaType string) ([]byte, error) {
+	partType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		partType = "text/plain" // RFC 2045 default
+	}
+	switch {
+	case partType == mediaType:
+		return ioutil.ReadAll(body)
+	case strings.HasPrefix(partType, "multipart/"):
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			content, err := findPart(part.Header.Get("Content-Type"), decodePart(part, part.Header.Get("Content-Transfer-Encoding")), mediaType)
+			if err != nil || content != nil {
+				return content, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// processAutocrypt updates user's Autocrypt state with an email delivered to one of user's identities,
+// following Autocrypt Level 1 rules. Setup messages, which users send to themselves to transfer their secret key,
+// are flagged within privacy features of delivered message for clients to propose the import ;
+// it returns true if it flagged msg, which is left to caller to save.
+func (b *EmailBroker) processAutocrypt(userId, identityId UUID, msg *Message, ac *autocryptEmail) (flagged bool) {
+	if ac.Setup {
+		identity, err := b.Store.RetrieveUserIdentity(userId.String(), identityId.String(), false)
+		if err != nil || !strings.EqualFold(identity.Identifier, ac.From) {
+			log.Infof("[EmailBroker] ignoring autocrypt setup message from %s not sent by recipient identity", ac.From)
+			return
+		}
+		if msg.Privacy_features == nil {
+			msg.Privacy_features = &PrivacyFeatures{}
+		}
+		(*msg.Privacy_features)[FeatureAutocryptSetup] = "True"
+		(*msg.Privacy_features)[FeatureAutocryptPassphraseBegin] = ac.PassphraseBegin
+		return true
+	}
+
+	peer, err := b.Store.RetrieveAutocryptPeer(userId.String(), ac.From)
+	if err != nil {
+		if err.Code() != NotFoundCaliopenErr {
+			log.WithError(err).Warnf("[EmailBroker] processAutocrypt failed to retrieve autocrypt peer %s", ac.From)
+			return
+		}
+		if ac.Header == nil {
+			// nothing to remember about a peer that never sent an Autocrypt header
+			return
+		}
+		peer = &AutocryptPeer{Address: ac.From, UserId: userId}
+	}
+	updated, keyChanged := peer.Update(ac.Date, ac.Header)
+	if !updated {
+		return
+	}
+	if err := b.Store.SaveAutocryptPeer(peer); err != nil {
+		log.WithError(err).Warnf("[EmailBroker] processAutocrypt failed to save autocrypt peer %s", ac.From)
+		return
+	}
+	if keyChanged {
+		b.importAutocryptKey(userId.String(), ac.Header)
+	}
+	return
+}
+
+// importAutocryptKey adds peer's new key to the user's contacts matching its address,
+// in place of the key previously imported from Autocrypt headers, if any.
+// Imported keys keep autocrypt as source : anyone can send a header, they are not trusted to verify signatures.
+// User's own contact card and identities never get keys from headers, which could be forged
+// to have them published in user's Web Key Directory and in user's outgoing headers.
+func (b *EmailBroker) importAutocryptKey(userId string, header *AutocryptHeader) {
+	identities, err := b.Store.LookupIdentityByIdentifier(header.Addr)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] importAutocryptKey failed to lookup identities of %s", header.Addr)
+		return
+	}
+	for _, identity := range identities {
+		if identity[0] == userId {
+			log.Infof("[EmailBroker] ignoring autocrypt key of %s, which is an identity of user %s", header.Addr, userId)
+			return
+		}
+	}
+	userContactId := b.Store.RetrieveUserContactId(userId)
+	fingerprint := header.Fingerprint()
+	contactIds, err := b.Store.LookupContactsByIdentifier(userId, header.Addr)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] importAutocryptKey failed to lookup contacts of %s", header.Addr)
+		return
+	}
+ContactsLoop:
+	for _, contactId := range contactIds {
+		if contactId == userContactId {
+			continue
+		}
+		keys, err := b.Store.RetrieveContactPubKeys(userId, contactId)
+		if err != nil {
+			log.WithError(err).Warnf("[EmailBroker] importAutocryptKey failed to retrieve keys of contact %s", contactId)
+			continue
+		}
+		previous := []PublicKey{}
+		for _, key := range keys {
+			if key.Fingerprint == fingerprint {
+				continue ContactsLoop
+			}
+			if key.Label == AutocryptKeyLabel && containsAddress(key.Emails, header.Addr) {
+				previous = append(previous, key)
+			}
+		}
+		contact, e := b.Store.RetrieveContact(userId, contactId)
+		if e != nil {
+			log.WithError(e).Warnf("[EmailBroker] importAutocryptKey failed to retrieve contact %s", contactId)
+			continue
+		}
+		pubkey := new(PublicKey)
+		if e := pubkey.UnmarshalPGPEntity(AutocryptKeyLabel, header.Entity, contact); e != nil {
+			log.WithError(e).Infof("[EmailBroker] autocrypt key of %s does not fit contact %s", header.Addr, contactId)
+			continue
+		}
+		pubkey.Source = AutocryptKeyLabel
+		if err := b.Store.CreatePGPPubKey(pubkey); err != nil {
+			log.WithError(err).Warnf("[EmailBroker] importAutocryptKey failed to create key for contact %s", contactId)
+			continue
+		}
+		for i := range previous {
+			if err := b.Store.DeletePubKey(&previous[i]); err != nil {
+				log.WithError(err).Warnf("[EmailBroker] importAutocryptKey failed to delete previous key %s", previous[i].KeyId.String())
+			}
+		}
+	}
+}
+
+// autocryptHeader returns the `Autocrypt:` header value to add to an outgoing message,
+// or an empty string if user's contact card has no trusted key for message's sender address.
+func (b *EmailBroker) autocryptHeader(msg *Message) string {
+	from := senderAddress(msg.Participants)
+	if from == "" {
+		return ""
+	}
+	userId := msg.User_id.String()
+	contactId := b.Store.RetrieveUserContactId(userId)
+	if contactId == "" {
+		return ""
+	}
+	keys, err := b.Store.RetrieveContactPubKeys(userId, contactId)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] failed to retrieve keys of user %s for autocrypt header", userId)
+		return ""
+	}
+	for _, key := range keys {
+		if !key.Trusted() || !containsAddress(key.Emails, from) {
+			continue
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.Key))
+		if err != nil || len(entities) == 0 {
+			continue
+		}
+		keydata, err := minimalAutocryptKey(entities[0], from, time.Now())
+		if err != nil {
+			log.WithError(err).Infof("[EmailBroker] key %s of user %s can't be sent in autocrypt header", key.KeyId.String(), userId)
+			continue
+		}
+		header := AutocryptHeader{Addr: strings.ToLower(from), PreferEncrypt: AutocryptNoPreference, KeyData: keydata}
+		return header.String()
+	}
+	return ""
+}
+
+// minimalAutocryptKey serializes the minimal form of entity Autocrypt recommends for headers :
+// primary key, the user id of address and the most recent valid encryption subkey, each with its self signature only.
+// Other user ids, subkeys and third party certifications would needlessly bloat each outgoing message.
+func minimalAutocryptKey(entity *openpgp.Entity, address string, now time.Time) ([]byte, error) {
+	var identity *openpgp.Identity
+	for _, id := range entity.Identities {
+		if id.UserId != nil && id.SelfSignature != nil && strings.EqualFold(id.UserId.Email, address) {
+			identity = id
+			break
+		}
+	}
+	if identity == nil {
+		return nil, fmt.Errorf("no self signed user id for %s", address)
+	}
+	var subkey *openpgp.Subkey
+	for i, sub := range entity.Subkeys {
+		if sub.Sig == nil || sub.Revocation != nil || !sub.PublicKey.PubKeyAlgo.CanEncrypt() || sub.Sig.KeyExpired(now) ||
+			(sub.Sig.FlagsValid && !sub.Sig.FlagEncryptCommunications && !sub.Sig.FlagEncryptStorage) {
+			continue
+		}
+		if subkey == nil || sub.Sig.CreationTime.After(subkey.Sig.CreationTime) {
+			subkey = &entity.Subkeys[i]
+		}
+	}
+	if subkey == nil {
+		return nil, errors.New("no valid encryption subkey")
+	}
+
+	keydata := new(bytes.Buffer)
+	for _, p := range []interface {
+		Serialize(io.Writer) error
+	}{entity.PrimaryKey, identity.UserId, identity.SelfSignature, subkey.PublicKey, subkey.Sig} {
+		if err := p.Serialize(keydata); err != nil {
+			return nil, err
+		}
+	}
+	return keydata.Bytes(), nil
+}
+
+func containsAddress(addresses []string, address string) bool {
+	for _, addr := range addresses {
+		if strings.EqualFold(addr, address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/packet"
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+// autocryptTestStore knows alice's contact, and keeps autocrypt peers and contact's keys in memory
+type autocryptTestStore struct {
+	backendstest.LDAStoreBackend
+	contact       *Contact
+	keys          PublicKeys
+	peers         map[string]*AutocryptPeer
+	identities    [][2]string // identities found for alice's address
+	userContactId string
+}
+
+func (s *autocryptTestStore) LookupContactsByIdentifier(userId, address string) ([]string, error) {
+	if address == "alice@example.com" {
+		return []string{s.contact.ContactId.String()}, nil
+	}
+	return []string{}, nil
+}
+func (s *autocryptTestStore) LookupIdentityByIdentifier(identifier string, params ...string) ([][2]string, error) {
+	return s.identities, nil
+}
+func (s *autocryptTestStore) RetrieveUserContactId(userId string) string {
+	return s.userContactId
+}
+func (s *autocryptTestStore) RetrieveContact(userId, contactId string) (*Contact, error) {
+	return s.contact, nil
+}
+func (s *autocryptTestStore) RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError) {
+	return s.keys, nil
+}
+func (s *autocryptTestStore) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
+	s.keys = append(s.keys, *pubkey)
+	return nil
+}
+func (s *autocryptTestStore) DeletePubKey(pubkey *PublicKey) CaliopenError {
+	for i, key := range s.keys {
+		if key.KeyId == pubkey.KeyId {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+func (s *autocryptTestStore) RetrieveAutocryptPeer(userId, address string) (*AutocryptPeer, CaliopenError) {
+	if peer, ok := s.peers[address]; ok {
+		p := *peer
+		return &p, nil
+	}
+	return nil, NewCaliopenErr(NotFoundCaliopenErr, "not found")
+}
+func (s *autocryptTestStore) SaveAutocryptPeer(peer *AutocryptPeer) CaliopenError {
+	s.peers[peer.Address] = peer
+	return nil
+}
+
+func autocryptTestEmail(date string, headers ...string) []byte {
+	email := "From: Alice <alice@example.com>\n" +
+		"To: emma@caliopen.local\n" +
+		"Date: " + date + "\n"
+	for _, header := range headers {
+		email += "Autocrypt: " + header + "\n"
+	}
+	return []byte(email + "Subject: hello\n\nHello Emma\n")
+}
+
+func TestParseAutocryptHeader(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	header := AutocryptHeader{Addr: "alice@example.com", PreferEncrypt: AutocryptMutual, KeyData: backendstest.BinaryPublicKey(alice)}
+
+	parsed, err := ParseAutocryptHeader(header.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Addr != "alice@example.com" || parsed.PreferEncrypt != AutocryptMutual || !bytes.Equal(parsed.KeyData, header.KeyData) {
+		t.Errorf("unexpected parsed header %+v", parsed)
+	}
+	if parsed.Fingerprint() != fingerprintOf(alice) {
+		t.Errorf("unexpected fingerprint %s", parsed.Fingerprint())
+	}
+
+	keydata := strings.SplitN(header.String(), "keydata=", 2)[1]
+	if _, err := ParseAutocryptHeader("addr=alice@example.com; _ignored=yes; keydata=" + keydata); err != nil {
+		t.Errorf("non-critical attribute should be ignored, got %s", err)
+	}
+	for _, invalid := range []string{
+		"addr=alice@example.com",
+		"keydata=" + keydata,
+		"addr=alice@example.com; unknown=yes; keydata=" + keydata,
+		"addr=alice@example.com; keydata=bm90IGEga2V5",
+	} {
+		if _, err := ParseAutocryptHeader(invalid); err == nil {
+			t.Errorf("expected header %.60s… to be invalid", invalid)
+		}
+	}
+}
+
+func TestParseAutocryptEmail(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	header := (&AutocryptHeader{Addr: "alice@example.com", KeyData: backendstest.BinaryPublicKey(alice)}).String()
+	now := time.Date(2019, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	ac, err := parseAutocryptEmail(autocryptTestEmail("Mon, 1 Apr 2019 10:00:00 +0200", header), now)
+	if err != nil || ac.Header == nil || ac.From != "alice@example.com" || !ac.Date.Equal(time.Date(2019, 4, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected autocrypt infos %+v, %v", ac, err)
+	}
+	ac, _ = parseAutocryptEmail(autocryptTestEmail("Mon, 1 Apr 2019 10:00:00 +0200", header, header), now)
+	if ac.Header != nil {
+		t.Error("expected several headers for sender to be discarded")
+	}
+	ac, _ = parseAutocryptEmail(autocryptTestEmail("Fri, 5 Apr 2019 10:00:00 +0200", strings.Replace(header, "alice@", "bob@", 1)), now)
+	if ac.Header != nil || !ac.Date.Equal(now) {
+		t.Errorf("expected header for another address to be discarded and date in future to be now, got %+v", ac)
+	}
+}
+
+func TestEmailBroker_processAutocrypt(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	aliceNewKey := newTestEntity(t, "Alice", "alice@example.com")
+	forged := newTestEntity(t, "Alice", "alice@example.com")
+	contact := &Contact{ContactId: UUID(uuid.NewV4()), Emails: []EmailContact{{Address: "alice@example.com"}}}
+	store := &autocryptTestStore{contact: contact, peers: map[string]*AutocryptPeer{}}
+	b := &EmailBroker{Store: store}
+	userId := UUID(uuid.NewV4())
+	now := time.Date(2019, 4, 10, 0, 0, 0, 0, time.UTC)
+	deliver := func(date string, headers ...string) {
+		ac, err := parseAutocryptEmail(autocryptTestEmail(date, headers...), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.processAutocrypt(userId, UUID(uuid.NewV4()), &Message{}, ac)
+	}
+	oldHeader := (&AutocryptHeader{Addr: "alice@example.com", KeyData: backendstest.BinaryPublicKey(alice)}).String()
+	newHeader := (&AutocryptHeader{Addr: "alice@example.com", PreferEncrypt: AutocryptMutual, KeyData: backendstest.BinaryPublicKey(aliceNewKey)}).String()
+
+	deliver("Mon, 1 Apr 2019 10:00:00 +0000")
+	if len(store.peers) != 0 {
+		t.Fatal("expected no peer to be created without autocrypt header")
+	}
+
+	deliver("Tue, 2 Apr 2019 10:00:00 +0000", oldHeader)
+	peer := store.peers["alice@example.com"]
+	if peer == nil || peer.Fingerprint != fingerprintOf(alice) || peer.PreferEncrypt != AutocryptNoPreference {
+		t.Fatalf("unexpected peer %+v", peer)
+	}
+	if len(store.keys) != 1 || store.keys[0].Label != AutocryptKeyLabel || store.keys[0].Fingerprint != peer.Fingerprint {
+		t.Fatalf("expected alice's key to be imported, got %+v", store.keys)
+	}
+	if store.keys[0].Source != AutocryptKeyLabel || store.keys[0].Trusted() {
+		t.Errorf("expected imported key to be untrusted, got %+v", store.keys[0])
+	}
+
+	deliver("Thu, 4 Apr 2019 10:00:00 +0000", newHeader)
+	deliver("Wed, 3 Apr 2019 10:00:00 +0000", oldHeader) // older message, ignored
+	peer = store.peers["alice@example.com"]
+	if peer.Fingerprint != fingerprintOf(aliceNewKey) || peer.PreferEncrypt != AutocryptMutual {
+		t.Errorf("expected peer to hold alice's new key, got %+v", peer)
+	}
+	if len(store.keys) != 1 || store.keys[0].Fingerprint != peer.Fingerprint {
+		t.Errorf("expected alice's previous autocrypt key to be replaced, got %+v", store.keys)
+	}
+
+	deliver("Fri, 5 Apr 2019 10:00:00 +0000")
+	peer = store.peers["alice@example.com"]
+	if !peer.LastSeen.Equal(time.Date(2019, 4, 5, 10, 0, 0, 0, time.UTC)) ||
+		!peer.AutocryptTimestamp.Equal(time.Date(2019, 4, 4, 10, 0, 0, 0, time.UTC)) ||
+		peer.Fingerprint != fingerprintOf(aliceNewKey) {
+		t.Errorf("expected message without header to only update last_seen, got %+v", peer)
+	}
+
+	// alice's contact is user's own contact card, then alice's address is one of user's identities
+	forgedHeader := (&AutocryptHeader{Addr: "alice@example.com", KeyData: backendstest.BinaryPublicKey(forged)}).String()
+	store.userContactId = contact.ContactId.String()
+	deliver("Sat, 6 Apr 2019 10:00:00 +0000", forgedHeader)
+	store.userContactId = ""
+	store.identities = [][2]string{{userId.String(), uuid.NewV4().String()}}
+	deliver("Sun, 7 Apr 2019 10:00:00 +0000", oldHeader)
+	if len(store.keys) != 1 || store.keys[0].Fingerprint != fingerprintOf(aliceNewKey) {
+		t.Errorf("expected user's own contact and identities not to get autocrypt keys, got %+v", store.keys)
+	}
+}
+
+func fingerprintOf(entity *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+}
+
+func TestMinimalAutocryptKey(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	bob := newTestEntity(t, "Bob", "bob@example.com")
+	now := time.Now()
+	certify := func(signer *openpgp.Entity, sigType packet.SignatureType, userId *packet.UserId) *packet.Signature {
+		sig := &packet.Signature{
+			SigType:      sigType,
+			PubKeyAlgo:   signer.PrimaryKey.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: now,
+			IssuerKeyId:  &signer.PrimaryKey.KeyId,
+		}
+		if err := sig.SignUserId(userId.Id, alice.PrimaryKey, signer.PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	// bob certified alice's address, and alice has another address
+	for _, identity := range alice.Identities {
+		identity.Signatures = append(identity.Signatures, certify(bob, packet.SigTypeGenericCert, identity.UserId))
+	}
+	work := packet.NewUserId("Alice", "", "alice@work.example")
+	alice.Identities[work.Id] = &openpgp.Identity{
+		Name:          work.Id,
+		UserId:        work,
+		SelfSignature: certify(alice, packet.SigTypePositiveCert, work),
+	}
+
+	keydata, err := minimalAutocryptKey(alice, "Alice@Example.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(keydata))
+	if err != nil || len(entities) != 1 {
+		t.Fatalf("expected minimal key to be a valid key, got %d entities, %v", len(entities), err)
+	}
+	minimal := entities[0]
+	if fingerprintOf(minimal) != fingerprintOf(alice) || len(minimal.Subkeys) != 1 || len(minimal.Identities) != 1 {
+		t.Fatalf("expected primary key, one identity and one subkey, got %d identities, %d subkeys", len(minimal.Identities), len(minimal.Subkeys))
+	}
+	for name, identity := range minimal.Identities {
+		if identity.UserId.Email != "alice@example.com" || len(identity.Signatures) != 0 {
+			t.Errorf("expected alice's self signed identity only, got %s with %d certifications", name, len(identity.Signatures))
+		}
+	}
+	if len(keydata) >= len(backendstest.BinaryPublicKey(alice)) {
+		t.Error("expected minimal key to be smaller than whole key")
+	}
+
+	if _, err := minimalAutocryptKey(alice, "bob@example.com", now); err == nil {
+		t.Error("expected no minimal key for an address that is not one of key's identities")
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
+	"github.com/keybase/go-crypto/openpgp"
 	"github.com/nats-io/go-nats"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -28,6 +30,9 @@ type (
 		Notifier          Notifications.Notifiers
 		Store             backends.LDAStore
 		natsSubscriptions []*nats.Subscription
+		searchesCache     map[string]cachedSearches
+		searchesMux       sync.Mutex
+		wksKeyring        openpgp.EntityList // secret key of Web Key Service's submission address, nil if service is disabled
 	}
 
 	EmailBrokerConnectors struct {
@@ -74,6 +79,13 @@ func Initialize(conf LDAConfig) (broker *EmailBroker, connectors EmailBrokerConn
 
 	broker = &EmailBroker{}
 	broker.Config = conf
+	if conf.WKDConfig.Enable && conf.WKDConfig.SubmissionLocalPart != "" {
+		broker.wksKeyring, err = readWKSKeyring(conf.WKDConfig.SubmissionKeyFile)
+		if err != nil {
+			log.WithError(err).Warnf("[EmailBroker] failed to read Web Key Service's submission key %s", conf.WKDConfig.SubmissionKeyFile)
+			return
+		}
+	}
 	switch conf.StoreName {
 	case "cassandra":
 		c := store.CassandraConfig{
@@ -171,6 +183,7 @@ func Initialize(conf LDAConfig) (broker *EmailBroker, connectors EmailBrokerConn
 			Url:            conf.NatsURL,
 			OutSMTP_topic:  conf.OutTopic,
 			Contacts_topic: conf.ContactsTopic,
+			Notifs_topic:   conf.NotifsTopic,
 		},
 		RESTstoreConfig: RESTstoreConfig{
 			BackendName:  conf.StoreName,
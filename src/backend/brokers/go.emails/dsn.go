@@ -0,0 +1,316 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/satori/go.uuid"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// DeliveryReport is the content of a delivery status notification (RFC 3464)
+	DeliveryReport struct {
+		EnvelopeId        string // ENVID given to MTA when message has been sent, see EnvelopeId
+		OriginalMessageId string // Message-ID of the message the report is about
+		ReportingMTA      string
+		Recipients        []RecipientReport
+	}
+
+	// RecipientReport is the per-recipient part of a delivery status notification
+	RecipientReport struct {
+		Action     string // failed, delayed, delivered, relayed or expanded
+		Diagnostic string // remote MTA's response, if any
+		Recipient  string
+		Status     string // enhanced status code (RFC 3463), like 5.1.1
+	}
+)
+
+var errNotDSN = errors.New("email is not a delivery status notification")
+
+// EnvelopeId returns the token sent as ENVID (RFC 3461) along with a message,
+// that MTAs give back in delivery status notifications about it.
+// Unlike Message-ID, it is never disclosed to recipients : reports that do not carry it are not trusted.
+// Token only holds base64url chars, thus it does not need to be xtext encoded.
+func EnvelopeId(msgId UUID) string {
+	hasher := sha256.New()
+	hasher.Write([]byte("envid:"))
+	hasher.Write(msgId.Bytes())
+	return base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))[:32]
+}
+
+// ParseDSN extracts delivery report from a multipart/report email.
+// It returns errNotDSN if email is not a delivery status notification.
+func ParseDSN(raw io.Reader) (*DeliveryReport, error) {
+	email, err := mail.ReadMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, err := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "delivery-status") {
+		return nil, errNotDSN
+	}
+	report := &DeliveryReport{}
+	parts := multipart.NewReader(email.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body := decodePart(part, part.Header.Get("Content-Transfer-Encoding"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			if err = report.parseStatusFields(body); err != nil {
+				return nil, err
+			}
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			headers, _ := textproto.NewReader(bufio.NewReader(body)).ReadMIMEHeader()
+			report.OriginalMessageId = cleanMessageId(headers.Get("Message-Id"))
+		}
+	}
+	if len(report.Recipients) == 0 {
+		return nil, errNotDSN
+	}
+	if report.OriginalMessageId == "" {
+		// some MTAs only reference original message in DSN's headers,
+		// which anyone can forge : reported recipients are checked against message's ones (see applyDeliveryReport)
+		references := strings.Fields(email.Header.Get("References"))
+		if len(references) == 0 {
+			references = strings.Fields(email.Header.Get("In-Reply-To"))
+		}
+		if len(references) > 0 {
+			report.OriginalMessageId = cleanMessageId(references[len(references)-1])
+		}
+	}
+	return report, nil
+}
+
+// parseStatusFields reads the per-message fields group, followed by one fields group per recipient
+func (report *DeliveryReport) parseStatusFields(body io.Reader) error {
+	reader := textproto.NewReader(bufio.NewReader(body))
+	perMessage, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	report.EnvelopeId = decodeXtext(strings.TrimSpace(perMessage.Get("Original-Envelope-Id")))
+	report.ReportingMTA = typedValue(perMessage.Get("Reporting-Mta"))
+	for err == nil {
+		var fields textproto.MIMEHeader
+		fields, err = reader.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		recipient := typedValue(fields.Get("Final-Recipient"))
+		if recipient == "" {
+			recipient = typedValue(fields.Get("Original-Recipient"))
+		}
+		if recipient == "" {
+			continue
+		}
+		report.Recipients = append(report.Recipients, RecipientReport{
+			Action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+			Diagnostic: typedValue(fields.Get("Diagnostic-Code")),
+			Recipient:  recipient,
+			Status:     strings.TrimSpace(fields.Get("Status")),
+		})
+	}
+	return nil
+}
+
+// processDeliveryReport records DSN's per-recipient statuses into the sent message it is about
+// and notifies user about it. Report is dropped if it does not carry message's envelope id,
+// or if none of its recipients is one of the message's recipients.
+func (b *EmailBroker) processDeliveryReport(userId UUID, report *DeliveryReport) {
+	if report.OriginalMessageId == "" {
+		log.Infof("[EmailBroker] delivery report from %s does not reference any message", report.ReportingMTA)
+		return
+	}
+	msgId, err := b.Store.SeekMessageByExternalRef(userId.String(), report.OriginalMessageId, "")
+	if err != nil || msgId.String() == EmptyUUID.String() {
+		log.WithError(err).Infof("[EmailBroker] no sent message found for delivery report about <%s>", report.OriginalMessageId)
+		return
+	}
+	msg, err := b.Store.RetrieveMessage(userId.String(), msgId.String())
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] failed to retrieve message %s for delivery report", msgId.String())
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(report.EnvelopeId), []byte(EnvelopeId(msg.Message_id))) != 1 {
+		log.Infof("[EmailBroker] delivery report from %s about message %s does not carry its envelope id, dropping it", report.ReportingMTA, msgId.String())
+		return
+	}
+	user, err := b.Store.RetrieveUser(userId.String())
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] failed to retrieve user %s for delivery report", userId.String())
+		return
+	}
+
+	updated := applyDeliveryReport(msg, report, time.Now())
+	if len(updated) == 0 {
+		log.Infof("[EmailBroker] delivery report from %s does not match any recipient of message %s", report.ReportingMTA, msgId.String())
+		return
+	}
+	fields := map[string]interface{}{
+		"Delivery_status": msg.Delivery_status,
+	}
+	err = b.Store.UpdateMessage(msg, fields)
+	if err != nil {
+		log.WithError(err).Warn("[EmailBroker] processDeliveryReport Store.UpdateMessage operation failed")
+		return
+	}
+	err = b.Index.UpdateMessage(&UserInfo{User_id: userId.String(), Shard_id: user.ShardId}, msg, fields)
+	if err != nil {
+		log.WithError(err).Warn("[EmailBroker] processDeliveryReport Index.UpdateMessage operation failed")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"deliveryStatus": map[string]interface{}{
+			"message_id": msg.Message_id.String(),
+			"recipients": updated,
+		},
+	})
+	notif := Notification{
+		Emitter: "smtp",
+		Type:    EventNotif,
+		TTLcode: LongLived,
+		User: &User{
+			UserId: userId,
+		},
+		NotifId: UUID(uuid.NewV1()),
+		Body:    string(body),
+	}
+	go b.Notifier.ByNotifQueue(&notif)
+}
+
+// applyDeliveryReport updates message's delivery statuses with report's recipients and returns updated statuses.
+// Reported recipients that message has not been sent to are ignored.
+func applyDeliveryReport(msg *Message, report *DeliveryReport, date time.Time) (updated []DeliveryStatus) {
+	for _, rcpt := range report.Recipients {
+		if !isRecipientOf(msg, rcpt.Recipient) {
+			continue
+		}
+		status := DeliveryStatus{
+			Address:   rcpt.Recipient,
+			Date:      date,
+			MessageId: msg.Message_id,
+			Protocol:  EmailProtocol,
+			Status:    dsnActionStatus(rcpt.Action),
+		}
+		if status.Status != DeliveryDelivered {
+			status.Error = strings.TrimSpace(rcpt.Status + " " + rcpt.Diagnostic)
+		}
+		if len(msg.UserIdentities) > 0 {
+			status.IdentityId = msg.UserIdentities[0]
+		}
+		found := false
+		for i, known := range msg.Delivery_status {
+			if known.Protocol == EmailProtocol && strings.EqualFold(known.Address, rcpt.Recipient) {
+				// keep references set when message has been sent
+				status.Address = known.Address
+				status.IdentityId = known.IdentityId
+				status.MessageId = known.MessageId
+				msg.Delivery_status[i] = status
+				found = true
+				break
+			}
+		}
+		if !found {
+			msg.Delivery_status = append(msg.Delivery_status, status)
+		}
+		updated = append(updated, status)
+	}
+	return
+}
+
+// isRecipientOf tells if message has been addressed to address by email
+func isRecipientOf(msg *Message, address string) bool {
+	for _, status := range msg.Delivery_status {
+		if status.Protocol == EmailProtocol && strings.EqualFold(status.Address, address) {
+			return true
+		}
+	}
+	for _, participant := range msg.Participants {
+		switch participant.Type {
+		case ParticipantTo, ParticipantCC, ParticipantBcc:
+			if strings.EqualFold(participant.Address, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dsnActionStatus maps DSN's action field (RFC 3464 section 2.3.3) to a delivery status
+func dsnActionStatus(action string) string {
+	switch action {
+	case "delayed":
+		return DeliveryDelayed
+	case "delivered", "relayed", "expanded":
+		return DeliveryDelivered
+	default:
+		return DeliveryBounced
+	}
+}
+
+// typedValue strips type prefix from DSN fields like « rfc822; john@example.com »
+func typedValue(field string) string {
+	if i := strings.Index(field, ";"); i != -1 {
+		field = field[i+1:]
+	}
+	return strings.TrimSpace(field)
+}
+
+// decodeXtext decodes "+XX" hexchars of xtext encoded values (RFC 3461 section 4)
+func decodeXtext(value string) string {
+	if !strings.Contains(value, "+") {
+		return value
+	}
+	decoded := []byte{}
+	for i := 0; i < len(value); i++ {
+		if value[i] == '+' && i+2 < len(value) {
+			if b, err := strconv.ParseUint(value[i+1:i+3], 16, 8); err == nil {
+				decoded = append(decoded, byte(b))
+				i += 2
+				continue
+			}
+		}
+		decoded = append(decoded, value[i])
+	}
+	return string(decoded)
+}
+
+func cleanMessageId(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
+}
+
+func decodePart(part io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part)
+	case "quoted-printable":
+		return quotedprintable.NewReader(part)
+	default:
+		return part
+	}
+}
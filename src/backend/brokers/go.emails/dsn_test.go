@@ -0,0 +1,139 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bounce = "From: MAILER-DAEMON@mx.example.com\r\n" +
+	"To: emma@caliopen.local\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your message could not be delivered to one or more recipients.\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Original-Envelope-Id: Qm9vdW5jZQ+2Bd\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Mon, 1 Apr 2019 10:00:00 +0200\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; unknown@example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 user unknown\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; john@example.com\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.2.2\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: emma@caliopen.local\r\n" +
+	"Message-ID: <d2a3f1@caliopen.local>\r\n" +
+	"Subject: hello\r\n" +
+	"\r\n" +
+	"--BOUNDARY--\r\n"
+
+func TestParseDSN(t *testing.T) {
+	report, err := ParseDSN(strings.NewReader(bounce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OriginalMessageId != "d2a3f1@caliopen.local" {
+		t.Errorf("expected original message id d2a3f1@caliopen.local, got %s", report.OriginalMessageId)
+	}
+	if report.EnvelopeId != "Qm9vdW5jZQ+d" {
+		t.Errorf("expected xtext decoded envelope id Qm9vdW5jZQ+d, got %s", report.EnvelopeId)
+	}
+	if report.ReportingMTA != "mx.example.com" {
+		t.Errorf("expected reporting MTA mx.example.com, got %s", report.ReportingMTA)
+	}
+	if len(report.Recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %+v", report.Recipients)
+	}
+	unknown := report.Recipients[0]
+	if unknown.Recipient != "unknown@example.com" || unknown.Action != "failed" ||
+		unknown.Status != "5.1.1" || unknown.Diagnostic != "550 5.1.1 user unknown" {
+		t.Errorf("unexpected report for first recipient : %+v", unknown)
+	}
+	if report.Recipients[1].Recipient != "john@example.com" || report.Recipients[1].Action != "delayed" {
+		t.Errorf("unexpected report for second recipient : %+v", report.Recipients[1])
+	}
+
+	_, err = ParseDSN(strings.NewReader("From: john@example.com\r\nContent-Type: text/plain\r\n\r\nhello\r\n"))
+	if err != errNotDSN {
+		t.Errorf("expected plain email not to be a DSN, got %v", err)
+	}
+}
+
+func TestApplyDeliveryReport(t *testing.T) {
+	msg := &Message{
+		Delivery_status: []DeliveryStatus{
+			{Address: "Unknown@example.com", Protocol: EmailProtocol, Status: DeliverySent},
+			{Address: "@john", Protocol: TwitterProtocol, Status: DeliverySent},
+		},
+		Participants: []Participant{
+			{Address: "emma@caliopen.local", Protocol: EmailProtocol, Type: ParticipantFrom},
+			{Address: "john@example.com", Protocol: EmailProtocol, Type: ParticipantCC},
+		},
+	}
+	report := &DeliveryReport{
+		Recipients: []RecipientReport{
+			{Action: "failed", Diagnostic: "550 5.1.1 user unknown", Recipient: "unknown@example.com", Status: "5.1.1"},
+			{Action: "delivered", Recipient: "john@example.com", Status: "2.0.0"},
+			{Action: "failed", Recipient: "emma@caliopen.local", Status: "5.1.1"},
+			{Action: "failed", Recipient: "stranger@example.com", Status: "5.1.1"},
+		},
+	}
+	updated := applyDeliveryReport(msg, report, time.Now())
+	if len(updated) != 2 || len(msg.Delivery_status) != 3 {
+		t.Fatalf("expected bounced recipient to be updated and delivered one to be added, got %+v", msg.Delivery_status)
+	}
+	bounced := msg.Delivery_status[0]
+	if bounced.Status != DeliveryBounced || bounced.Error != "5.1.1 550 5.1.1 user unknown" || bounced.Address != "Unknown@example.com" {
+		t.Errorf("unexpected status for bounced recipient : %+v", bounced)
+	}
+	if msg.Delivery_status[1].Status != DeliverySent {
+		t.Errorf("twitter recipient's status should not have changed, got %+v", msg.Delivery_status[1])
+	}
+	delivered := msg.Delivery_status[2]
+	if delivered.Status != DeliveryDelivered || delivered.Error != "" {
+		t.Errorf("unexpected status for delivered recipient : %+v", delivered)
+	}
+
+	// a forged report about someone else's message must not add anything
+	other := &Message{Participants: []Participant{{Address: "paul@example.com", Protocol: EmailProtocol, Type: ParticipantTo}}}
+	if updated = applyDeliveryReport(other, report, time.Now()); len(updated) != 0 || len(other.Delivery_status) != 0 {
+		t.Errorf("expected report about other recipients to be ignored, got %+v", other.Delivery_status)
+	}
+}
+
+func TestEnvelopeId(t *testing.T) {
+	msgId := UUID(uuid.FromStringOrNil("d2a3f1c8-6a7e-4bc1-9a37-1d5f8cbd4e2a"))
+	envid := EnvelopeId(msgId)
+	if envid != EnvelopeId(msgId) {
+		t.Error("expected envelope id to be the same for a given message")
+	}
+	if envid == EnvelopeId(UUID(uuid.NewV4())) {
+		t.Error("expected envelope ids to differ between messages")
+	}
+	if strings.ContainsAny(envid, "+= \r\n") || len(envid) != 32 {
+		t.Errorf("expected envelope id to be 32 xtext safe chars, got %s", envid)
+	}
+	if strings.Contains((&EmailBroker{}).NewMessageId(msgId.Bytes()), envid) {
+		t.Error("envelope id must not be derivable from Message-ID")
+	}
+}
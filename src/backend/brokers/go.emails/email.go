@@ -69,6 +69,7 @@ func (b *EmailBroker) MarshalEmail(msg *Message) (em *EmailMessage, err error) {
 	// Assign computed values
 	em.Message.Date_sort = em.Message.Date
 	em.Message.External_references.Message_id = messageId
+	em.Email.EnvelopeId = EnvelopeId(msg.Message_id)
 
 	m := gomail.NewMessage()
 	addr_fields := newAddressesFields()
@@ -116,6 +117,9 @@ func (b *EmailBroker) MarshalEmail(msg *Message) (em *EmailMessage, err error) {
 	m.SetHeader("Date", em.Message.Date.Format(time.RFC1123Z))
 	m.SetHeader("Message-ID", "<"+messageId+">")
 	m.SetHeader("X-Mailer", "Caliopen-"+b.Config.AppVersion)
+	if autocrypt := b.autocryptHeader(msg); autocrypt != "" {
+		m.SetHeader("Autocrypt", autocrypt)
+	}
 
 	if msg.External_references.Parent_id != "" {
 		m.SetHeader("In-Reply-To", "<"+msg.External_references.Parent_id+">")
@@ -259,6 +263,17 @@ func (b *EmailBroker) SaveIndexSentEmail(ack *EmailDeliveryAck) error {
 		log.WithError(err).Warn("[Email Broker] Index.UpdateMessage operation failed")
 	}
 
+	// sent message must be found back when a delivery status notification is received
+	if ack.EmailMessage.Message.External_references.Message_id != "" && len(ack.EmailMessage.Message.UserIdentities) > 0 {
+		err = b.Store.CreateMessageExternalRefLookup(ack.EmailMessage.Message.User_id,
+			ack.EmailMessage.Message.UserIdentities[0],
+			ack.EmailMessage.Message.Message_id,
+			ack.EmailMessage.Message.External_references.Message_id)
+		if err != nil {
+			log.WithError(err).Warn("[Email Broker] Store.CreateMessageExternalRefLookup operation failed")
+		}
+	}
+
 	// if needed :
 	// insert new entry into discussion_lookup table
 	// with message's external reference
@@ -277,6 +292,7 @@ func (b *EmailBroker) SaveIndexSentEmail(ack *EmailDeliveryAck) error {
 // belonging to an user
 func (b *EmailBroker) UnmarshalEmail(em *EmailMessage, user_id UUID) (msg *Message, err error) {
 
+	raw := em.Email.Raw.Bytes()
 	parsed_mail, err := mail.ReadMessage(&em.Email.Raw)
 	if err != nil {
 		log.WithError(err).Warn("[Email Broker] unable to parse email with raw_id : %s", em.Message.Raw_msg_id)
@@ -317,6 +333,15 @@ func (b *EmailBroker) UnmarshalEmail(em *EmailMessage, user_id UUID) (msg *Messa
 		}
 	}
 
+	// signature is verified against the keys of user's contacts matching sender
+	signed, e := extractSignedContent(raw)
+	if e != nil {
+		log.WithError(e).Info("[Email Broker] failed to extract signed content of email")
+	}
+	if signed != nil {
+		b.verifySignature(signed, user_id.String(), senderAddress(msg.Participants)).AddTo(msg.Privacy_features)
+	}
+
 	return
 }
 
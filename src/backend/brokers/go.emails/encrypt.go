@@ -44,6 +44,10 @@ func (b *EmailBroker) MarshalPGPEmail(msg *Message, em *EmailMessage, addresses
 	mainHeader.Set("Date", time.Now().Format(time.RFC1123Z))
 	mainHeader.SetContentType("multipart/encrypted", params)
 	mainHeader.Set("X-Mailer", "Caliopen-"+b.Config.AppVersion)
+	if autocrypt := b.autocryptHeader(msg); autocrypt != "" {
+		// fold header on keydata's chunks
+		mainHeader.Set("Autocrypt", strings.Replace(autocrypt, " ", "\r\n ", -1))
+	}
 
 	for field, addrs := range addresses {
 		if len(addrs) > 0 {
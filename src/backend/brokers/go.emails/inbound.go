@@ -15,6 +15,7 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/pi"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gocql/gocql"
 	"github.com/hashicorp/go-multierror"
@@ -25,8 +26,26 @@ import (
 )
 
 const (
-	natsMessageTmpl = "{\"order\":\"%s\",\"user_id\":\"%s\",\"identity_id\":\"%s\",\"message_id\": \"%s\"}"
-	natsOrderRaw    = "process_raw"
+	natsMessageTmpl   = "{\"order\":\"%s\",\"user_id\":\"%s\",\"identity_id\":\"%s\",\"message_id\": \"%s\"}"
+	natsOrderRaw      = "process_raw"
+	searchesCacheTTL  = time.Minute // delay for changes of user's saved searches to be taken into account by inbound process
+	searchesCacheSize = 10000       // users' auto tagging searches kept in memory, cache is emptied when it is full
+)
+
+type (
+	cachedSearches struct {
+		searches []SavedSearch
+		until    time.Time
+	}
+
+	// deliveredEmail holds what broker extracted from an inbound email
+	// to complete the messages inbound process creates from it
+	deliveredEmail struct {
+		autocrypt *autocryptEmail
+		features  PrivacyFeatures // computed by ingress at receive time
+		signed    *signedContent
+		tags      []string // embedded by ingress
+	}
 )
 
 func (b *EmailBroker) startIncomingSmtpAgents() error {
@@ -107,6 +126,30 @@ func (b *EmailBroker) processInboundSMTP(in *SmtpEmail, raw_only bool) {
 		log.Infof("inbound: processing envelope From: %s -> To: %v", in.EmailMessage.Email.SmtpMailFrom, in.EmailMessage.Email.SmtpRcpTo)
 	}
 
+	// submission addresses of Web Key Service are not identities, their emails are processed apart
+	recipients := []string{}
+	for _, rcpt := range in.EmailMessage.Email.SmtpRcpTo {
+		if !b.isWKSSubmissionAddress(rcpt) {
+			recipients = append(recipients, rcpt)
+		}
+	}
+	if len(recipients) < len(in.EmailMessage.Email.SmtpRcpTo) {
+		if err := b.processWKS(in.EmailMessage.Email.Raw.Bytes()); err != nil {
+			log.WithError(err).Infof("inbound: web key service message from %v rejected", in.EmailMessage.Email.SmtpMailFrom)
+			if len(recipients) == 0 {
+				resp.Response = "web key service : " + err.Error()
+				resp.Err = true
+				in.Response <- resp
+				return
+			}
+		}
+		if len(recipients) == 0 {
+			in.Response <- resp
+			return
+		}
+		in.EmailMessage.Email.SmtpRcpTo = recipients
+	}
+
 	rcptsIds, err := b.Store.GetUsersForLocalMailRecipients(in.EmailMessage.Email.SmtpRcpTo)
 
 	if err != nil {
@@ -178,6 +221,35 @@ func (b *EmailBroker) processInbound(rcptsIds [][]UUID, in *SmtpEmail, raw_only
 		return
 	}
 
+	// delivery status notifications are delivered as any other email,
+	// they also update delivery status of the message they are about
+	report, err := ParseDSN(strings.NewReader(m.Raw_data))
+	if err != nil && err != errNotDSN {
+		log.WithError(err).Info("inbound: failed to parse delivery status notification")
+	}
+
+	// signature of signed emails is verified against keys of each recipient's contacts
+	signed, err := extractSignedContent([]byte(m.Raw_data))
+	if err != nil {
+		log.WithError(err).Info("inbound: failed to extract signed content of email")
+	}
+
+	// Autocrypt headers update recipients' knowledge of sender's key
+	autocrypt, err := parseAutocryptEmail([]byte(m.Raw_data), time.Now())
+	if err != nil {
+		log.WithError(err).Info("inbound: failed to parse autocrypt infos of email")
+	}
+
+	// sender authentication results computed by ingress at receive time (SPF, DKIM, DMARC),
+	// and tags that ingress embedded within message (from IMAP mailbox for example)
+	delivered := &deliveredEmail{autocrypt: autocrypt, signed: signed}
+	if in.EmailMessage.Message != nil {
+		delivered.tags = in.EmailMessage.Message.Tags
+		if in.EmailMessage.Message.Privacy_features != nil {
+			delivered.features = *in.EmailMessage.Message.Privacy_features
+		}
+	}
+
 	// send process order to nats for each rcpt
 	errs := multierror.Error{
 		Errors:      []error{},
@@ -225,6 +297,14 @@ func (b *EmailBroker) processInbound(rcptsIds [][]UUID, in *SmtpEmail, raw_only
 					log.Infof("EmailBroker : NATS inbound request successfully handled for user %s : %s", rcptId[0].String(), (*nats_ack)["message"])
 				}
 
+				messageId := (*nats_ack)["message_id"].(string)
+				if report != nil {
+					b.processDeliveryReport(rcptId[0], report)
+				}
+
+				b.completeDeliveredMessage(rcptId[0], rcptId[1], messageId, delivered)
+
+				// message is notified once complete, for clients not to show it without its tags and features
 				notif := Notification{
 					Emitter: "smtp",
 					Type:    EventNotif,
@@ -233,7 +313,7 @@ func (b *EmailBroker) processInbound(rcptsIds [][]UUID, in *SmtpEmail, raw_only
 						UserId: rcptId[0],
 					},
 					NotifId: UUID(uuid.NewV1()),
-					Body:    `{"emailReceived": "` + (*nats_ack)["message_id"].(string) + `"}`,
+					Body:    `{"emailReceived": "` + messageId + `"}`,
 				}
 
 				go b.Notifier.ByNotifQueue(&notif)
@@ -255,6 +335,145 @@ func (b *EmailBroker) processInbound(rcptsIds [][]UUID, in *SmtpEmail, raw_only
 
 }
 
+// completeDeliveredMessage adds to a message freshly created by inbound process what broker knows
+// of its email and message parser doesn't : signature's verification, Autocrypt setup flag,
+// ingress' privacy features and tags, and the auto tags of user's saved searches that message matches.
+// Message is read and written once, in store and index.
+func (b *EmailBroker) completeDeliveredMessage(userId, identityId UUID, messageId string, delivered *deliveredEmail) {
+	msg, err := b.Store.RetrieveMessage(userId.String(), messageId)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] completeDeliveredMessage failed to retrieve message %s", messageId)
+		return
+	}
+	if msg.Privacy_features == nil {
+		msg.Privacy_features = &PrivacyFeatures{}
+	}
+	fields := map[string]interface{}{}
+	featured := false
+
+	// signature is verified before Autocrypt header of the same email updates sender's keys
+	if delivered.signed != nil {
+		b.verifySignature(delivered.signed, userId.String(), senderAddress(msg.Participants)).AddTo(msg.Privacy_features)
+		featured = true
+	}
+	if delivered.autocrypt != nil && b.processAutocrypt(userId, identityId, msg, delivered.autocrypt) {
+		featured = true
+	}
+	// ingress' features override the ones computed by message parser
+	for feature, value := range delivered.features {
+		(*msg.Privacy_features)[feature] = value
+		featured = true
+	}
+
+	autoTagging, err := b.autoTaggingSearches(userId.String(), time.Now())
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] completeDeliveredMessage failed to retrieve saved searches of user %s", userId.String())
+	}
+	// tags belong to inbound message, they must not be appended to in place
+	if addTags(msg, append(append([]string(nil), delivered.tags...), savedSearchesTags(autoTagging, msg)...)) {
+		fields["Tags"] = msg.Tags
+	}
+
+	if featured {
+		// message parser computed PI before broker added its own features
+		msg.PI = pi.ComputePIMessage(msg)
+		fields["Privacy_features"] = *msg.Privacy_features
+		fields["PI"] = msg.PI
+	}
+	if len(fields) == 0 {
+		return
+	}
+	b.updateDeliveredMessage(userId.String(), msg, fields)
+}
+
+// addTags appends to message's tags the ones it doesn't have yet.
+// It returns false if message already had all tags.
+func addTags(msg *Message, tags []string) (added bool) {
+	knownTags := make(map[string]bool)
+	for _, tag := range msg.Tags {
+		knownTags[tag] = true
+	}
+	for _, tag := range tags {
+		if !knownTags[tag] {
+			knownTags[tag] = true
+			msg.Tags = append(msg.Tags, tag)
+			added = true
+		}
+	}
+	return
+}
+
+// updateDeliveredMessage saves fields of a message freshly created by inbound process, in store and index.
+// PI is not a column of messages' table, it is only indexed.
+func (b *EmailBroker) updateDeliveredMessage(userId string, msg *Message, fields map[string]interface{}) {
+	user, err := b.Store.RetrieveUser(userId)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] updateDeliveredMessage failed to retrieve user %s", userId)
+		return
+	}
+	storeFields := fields
+	if _, ok := fields["PI"]; ok {
+		storeFields = map[string]interface{}{}
+		for field, value := range fields {
+			if field != "PI" {
+				storeFields[field] = value
+			}
+		}
+	}
+	err = b.Store.UpdateMessage(msg, storeFields)
+	if err != nil {
+		log.WithError(err).Warn("[EmailBroker] updateDeliveredMessage Store.UpdateMessage operation failed")
+		return
+	}
+	err = b.Index.UpdateMessage(&UserInfo{User_id: userId, Shard_id: user.ShardId}, msg, fields)
+	if err != nil {
+		log.WithError(err).Warn("[EmailBroker] updateDeliveredMessage Index.UpdateMessage operation failed")
+	}
+}
+
+// autoTaggingSearches returns user's saved searches that have an auto tag,
+// kept in memory for searchesCacheTTL to spare a store read per delivered message
+func (b *EmailBroker) autoTaggingSearches(userId string, at time.Time) ([]SavedSearch, error) {
+	b.searchesMux.Lock()
+	cached, ok := b.searchesCache[userId]
+	b.searchesMux.Unlock()
+	if ok && cached.until.After(at) {
+		return cached.searches, nil
+	}
+	searches, err := b.Store.RetrieveSavedSearches(userId)
+	if err != nil {
+		return nil, err
+	}
+	autoTagging := []SavedSearch{}
+	for _, search := range searches {
+		if search.AutoTag != "" {
+			autoTagging = append(autoTagging, search)
+		}
+	}
+	b.searchesMux.Lock()
+	if b.searchesCache == nil || len(b.searchesCache) >= searchesCacheSize {
+		b.searchesCache = make(map[string]cachedSearches)
+	}
+	b.searchesCache[userId] = cachedSearches{searches: autoTagging, until: at.Add(searchesCacheTTL)}
+	b.searchesMux.Unlock()
+	return autoTagging, nil
+}
+
+// savedSearchesTags returns auto tags of saved searches matched by message
+func savedSearchesTags(searches []SavedSearch, msg *Message) (tags []string) {
+	for _, search := range searches {
+		clauses, err := search.Clauses()
+		if err != nil {
+			log.WithError(err).Warnf("[EmailBroker] invalid saved search %s", search.SearchId.String())
+			continue
+		}
+		if clauses.MatchMessage(msg) {
+			tags = append(tags, search.AutoTag)
+		}
+	}
+	return
+}
+
 // deliverMsgToUser marshal an incoming email to the Caliopen message format
 // TODO
 func (b *EmailBroker) deliverMsgToUser() {}
@@ -0,0 +1,98 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+)
+
+func TestSavedSearchesTags(t *testing.T) {
+	msg := &Message{
+		Subject:    "Weekly report of the team",
+		Body_plain: "Please find attached the figures",
+		Is_unread:  true,
+		Participants: []Participant{
+			{Type: ParticipantFrom, Address: "boss@example.com", Label: "The Boss"},
+			{Type: ParticipantTo, Address: "emma@caliopen.local"},
+		},
+		Tags: []string{"inbox"},
+	}
+	searches := []SavedSearch{
+		{Name: "boss", Query: "from:boss", AutoTag: "work"},
+		{Name: "reports", Query: `subject:"weekly report" is:unread`, AutoTag: "reports"},
+		{Name: "not spam", Query: "figures -tag:spam", AutoTag: "figures"},
+		{Name: "sent to boss", Query: "to:boss", AutoTag: "sent"},
+		{Name: "phrase", Query: `"report weekly"`, AutoTag: "phrase"},
+		{Name: "filtered", Filters: SearchQuery{{Field: "Tag", Value: "inbox", Negated: true}}, AutoTag: "filtered"},
+		{Name: "invalid", Query: "is:starred", AutoTag: "invalid"},
+	}
+
+	tags := savedSearchesTags(searches, msg)
+	expected := []string{"work", "reports", "figures"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+}
+
+func TestEmailBroker_completeDeliveredMessage(t *testing.T) {
+	msg := &Message{
+		Message_id: UUID(uuid.NewV4()),
+		Participants: []Participant{
+			{Type: ParticipantFrom, Address: "boss@example.com"},
+			{Type: ParticipantTo, Address: "emma@caliopen.local"},
+		},
+		Privacy_features: &PrivacyFeatures{"nb_external_hops": "5"},
+		Subject:          "Weekly report",
+		Tags:             []string{"inbox"},
+	}
+	store := &signatureTestStore{
+		messages: map[string]*Message{msg.Message_id.String(): msg},
+		searches: []SavedSearch{
+			{Name: "reports", Query: "subject:report", AutoTag: "reports"},
+			{Name: "not tagging", Query: "subject:report"},
+		},
+		updated: map[string]map[string]interface{}{},
+	}
+	index := &signatureTestIndex{updated: map[string]map[string]interface{}{}}
+	b := &EmailBroker{Store: store, Index: index}
+	// tags of inbound message, with room to be appended to
+	ingressTags := make([]string, 1, 4)
+	ingressTags[0] = "imported"
+	delivered := &deliveredEmail{
+		features: PrivacyFeatures{FeatureTransportDMARC: AuthPass},
+		tags:     ingressTags,
+	}
+
+	b.completeDeliveredMessage(UUID(uuid.NewV4()), UUID(uuid.NewV4()), msg.Message_id.String(), delivered)
+	if store.writes != 1 {
+		t.Errorf("expected message to be written once, got %d writes", store.writes)
+	}
+	stored, indexed := store.updated[msg.Message_id.String()], index.updated[msg.Message_id.String()]
+	features, ok := stored["Privacy_features"].(PrivacyFeatures)
+	if !ok || features[FeatureTransportDMARC] != AuthPass || features["nb_external_hops"] != "5" {
+		t.Errorf("expected broker's features to be merged into parser's ones, got %+v", stored["Privacy_features"])
+	}
+	if _, found := stored["PI"]; found {
+		t.Error("PI must not be stored")
+	}
+	if pi, ok := indexed["PI"].(*PIMessage); !ok || pi.Transport != 10 {
+		t.Errorf("expected PI recomputed with DMARC bonus, got %+v", indexed["PI"])
+	}
+	expected := []string{"inbox", "imported", "reports"}
+	if !reflect.DeepEqual(stored["Tags"], expected) {
+		t.Errorf("expected tags %v, got %v", expected, stored["Tags"])
+	}
+
+	b.completeDeliveredMessage(UUID(uuid.NewV4()), UUID(uuid.NewV4()), msg.Message_id.String(), delivered)
+	if store.searchReads != 1 {
+		t.Errorf("expected saved searches to be read once, got %d reads", store.searchReads)
+	}
+	if ingressTags[:2][1] != "" {
+		t.Errorf("expected inbound message's tags to be left untouched, got %v", ingressTags[:2])
+	}
+}
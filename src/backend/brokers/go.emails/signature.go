@@ -0,0 +1,260 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/keybase/go-crypto/openpgp/clearsign"
+	pgpErrors "github.com/keybase/go-crypto/openpgp/errors"
+	"github.com/keybase/go-crypto/openpgp/packet"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+)
+
+type (
+	// SignatureVerification is the result of the verification of an email's PGP signature
+	// against the keys of its sender's contact.
+	SignatureVerification struct {
+		Type        string // SignatureTypePGPMIME or SignatureTypeInlinePGP
+		Status      string // SignatureVerified, SignatureUnknownKey or SignatureBad
+		SignerKeyId string // key id of signature's issuer, as found in signature
+		Fingerprint string // fingerprint of signer's primary key, if signature has been verified
+	}
+
+	// signedContent is the signed part of an email with its detached, binary, signature
+	signedContent struct {
+		Type      string
+		Content   []byte
+		Signature []byte
+		Partial   bool // unsigned text surrounds inline signed text
+	}
+)
+
+const inlineSignatureHeader = "-----BEGIN PGP SIGNED MESSAGE-----"
+
+// extractSignedContent finds the content signed by a multipart/signed (RFC 3156) PGP/MIME email,
+// or by an inline PGP clear signature within its text/plain body.
+// It returns nil if email is not signed.
+func extractSignedContent(raw []byte) (*signedContent, error) {
+	email, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, _ := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if mediaType == "multipart/signed" && strings.EqualFold(params["protocol"], "application/pgp-signature") {
+		body, err := ioutil.ReadAll(email.Body)
+		if err != nil {
+			return nil, err
+		}
+		return pgpMIMESignedContent(body, params["boundary"])
+	}
+	text, err := inlineSignedText(email.Header.Get("Content-Type"), decodePart(email.Body, email.Header.Get("Content-Transfer-Encoding")))
+	if err != nil || text == nil {
+		return nil, err
+	}
+	block, rest := clearsign.Decode(text)
+	if block == nil {
+		return nil, errors.New("malformed inline PGP signature")
+	}
+	signature, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, err
+	}
+	// a signed quote, or text added after signing, must not be taken for a fully signed email
+	before := text[:bytes.Index(text, []byte(inlineSignatureHeader))]
+	return &signedContent{
+		Type:      SignatureTypeInlinePGP,
+		Content:   block.Bytes,
+		Signature: signature,
+		Partial:   len(bytes.TrimSpace(before)) > 0 || len(bytes.TrimSpace(rest)) > 0,
+	}, nil
+}
+
+// pgpMIMESignedContent returns the first part of a multipart/signed body, headers included and with CRLF line endings,
+// as it has been signed, along with the signature held by the second part.
+func pgpMIMESignedContent(body []byte, boundary string) (*signedContent, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart/signed email without boundary")
+	}
+	canonical := append([]byte("\r\n"), canonicalLineEndings(body)...)
+	delimiter := []byte("\r\n--" + boundary)
+	first := bytes.Index(canonical, delimiter)
+	if first < 0 {
+		return nil, errors.New("multipart/signed email without signed part")
+	}
+	start := first + len(delimiter)
+	lineEnd := bytes.Index(canonical[start:], []byte("\r\n"))
+	if lineEnd < 0 {
+		return nil, errors.New("multipart/signed email without signed part")
+	}
+	start += lineEnd + 2
+	end := bytes.Index(canonical[start:], delimiter)
+	if end < 0 {
+		return nil, errors.New("multipart/signed email without signature part")
+	}
+	signed := &signedContent{Type: SignatureTypePGPMIME, Content: canonical[start : start+end]}
+
+	parts := multipart.NewReader(bytes.NewReader(body), boundary)
+	for i := 0; i < 2; i++ {
+		part, err := parts.NextPart()
+		if err != nil {
+			return nil, fmt.Errorf("multipart/signed email without signature part : %s", err)
+		}
+		if i == 0 {
+			continue
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if partType != "application/pgp-signature" {
+			return nil, errors.New("multipart/signed email without application/pgp-signature part")
+		}
+		block, err := armor.Decode(decodePart(part, part.Header.Get("Content-Transfer-Encoding")))
+		if err != nil {
+			return nil, err
+		}
+		if signed.Signature, err = ioutil.ReadAll(block.Body); err != nil {
+			return nil, err
+		}
+	}
+	return signed, nil
+}
+
+// inlineSignedText walks through email's parts to find a text/plain part holding a PGP clear signature
+func inlineSignedText(contentType string, body io.Reader) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain" // RFC 2045 default
+	}
+	switch {
+	case mediaType == "text/plain":
+		text, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(text, []byte(inlineSignatureHeader)) {
+			return text, nil
+		}
+	case strings.HasPrefix(mediaType, "multipart/") && mediaType != "multipart/encrypted":
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+				continue
+			}
+			text, err := inlineSignedText(part.Header.Get("Content-Type"), decodePart(part, part.Header.Get("Content-Transfer-Encoding")))
+			if err != nil || text != nil {
+				return text, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func canonicalLineEndings(b []byte) []byte {
+	return bytes.Replace(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// verifySignedContent checks signature of content with the keys of keyring
+func verifySignedContent(signed *signedContent, keyring openpgp.KeyRing) *SignatureVerification {
+	verification := &SignatureVerification{
+		Type:        signed.Type,
+		SignerKeyId: signatureIssuer(signed.Signature),
+	}
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(signed.Content), bytes.NewReader(signed.Signature))
+	switch {
+	case err == nil && signer != nil && signer.PrimaryKey != nil:
+		verification.Status = SignatureVerified
+		if signed.Partial {
+			verification.Status = SignaturePartial
+		}
+		verification.Fingerprint = strings.ToUpper(hex.EncodeToString(signer.PrimaryKey.Fingerprint[:]))
+	case err == pgpErrors.ErrUnknownIssuer:
+		verification.Status = SignatureUnknownKey
+	default:
+		verification.Status = SignatureBad
+	}
+	return verification
+}
+
+// signatureIssuer returns the key id of signature's issuer, if signature packet holds it
+func signatureIssuer(signature []byte) string {
+	p, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return ""
+	}
+	if sig, ok := p.(*packet.Signature); ok && sig.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	}
+	return ""
+}
+
+// AddTo records verification's result into message's privacy features,
+// overriding whatever could have been guessed about message's signature before.
+func (sv *SignatureVerification) AddTo(features *PrivacyFeatures) {
+	signed := "False"
+	if sv.Status == SignatureVerified {
+		signed = "True"
+	}
+	(*features)[FeatureMessageSigned] = signed
+	(*features)[FeatureMessageSignatureType] = sv.Type
+	(*features)[FeatureMessageSignatureStatus] = sv.Status
+	(*features)[FeatureMessageSigner] = sv.SignerKeyId
+	(*features)[FeatureMessageSignerPrint] = sv.Fingerprint
+}
+
+// verifySignature verifies signed content against the trusted PGP keys of the user's contacts matching sender's address.
+// Keys that anyone could have provided, as Autocrypt ones, can't prove who signed.
+func (b *EmailBroker) verifySignature(signed *signedContent, userId, sender string) *SignatureVerification {
+	keyring := openpgp.EntityList{}
+	contactIds, err := b.Store.LookupContactsByIdentifier(userId, sender)
+	if err != nil {
+		log.WithError(err).Warnf("[EmailBroker] failed to lookup contacts of sender %s", sender)
+	}
+	for _, contactId := range contactIds {
+		keys, err := b.Store.RetrieveContactPubKeys(userId, contactId)
+		if err != nil {
+			log.WithError(err).Warnf("[EmailBroker] failed to retrieve keys of contact %s", contactId)
+			continue
+		}
+		for _, key := range keys {
+			if !key.Trusted() {
+				continue
+			}
+			entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.Key))
+			if err != nil {
+				log.WithError(err).Warnf("[EmailBroker] invalid PGP key %s of contact %s", key.KeyId.String(), contactId)
+				continue
+			}
+			keyring = append(keyring, entities...)
+		}
+	}
+	return verifySignedContent(signed, keyring)
+}
+
+// senderAddress returns the address of message's From participant
+func senderAddress(participants []Participant) string {
+	for _, participant := range participants {
+		if participant.Type == ParticipantFrom {
+			return participant.Address
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/clearsign"
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+)
+
+// signatureTestStore knows alice's contact and its public keys, emma's saved searches,
+// and records updates of messages delivered to emma
+type signatureTestStore struct {
+	backendstest.LDAStoreBackend
+	keys        PublicKeys
+	messages    map[string]*Message
+	searches    []SavedSearch
+	searchReads int
+	updated     map[string]map[string]interface{}
+	writes      int
+}
+
+func (s *signatureTestStore) LookupContactsByIdentifier(userId, address string) ([]string, error) {
+	if address == "alice@example.com" {
+		return []string{"alice-contact"}, nil
+	}
+	return []string{}, nil
+}
+func (s *signatureTestStore) RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError) {
+	return s.keys, nil
+}
+func (s *signatureTestStore) RetrieveMessage(userId, messageId string) (*Message, error) {
+	return s.messages[messageId], nil
+}
+func (s *signatureTestStore) RetrieveUser(userId string) (*User, error) {
+	return &User{ShardId: "shard"}, nil
+}
+func (s *signatureTestStore) RetrieveSavedSearches(userId string) ([]SavedSearch, error) {
+	s.searchReads++
+	return s.searches, nil
+}
+func (s *signatureTestStore) UpdateMessage(msg *Message, fields map[string]interface{}) error {
+	s.updated[msg.Message_id.String()] = fields
+	s.writes++
+	return nil
+}
+
+// signatureTestIndex records indexed fields of updated messages
+type signatureTestIndex struct {
+	backends.LDAIndex
+	updated map[string]map[string]interface{}
+}
+
+func (i *signatureTestIndex) UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error {
+	i.updated[msg.Message_id.String()] = fields
+	return nil
+}
+
+func newTestEntity(t *testing.T, name, email string) *openpgp.Entity {
+	entity, err := backendstest.NewPGPEntity(name, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+// pgpMIMEEmail returns a multipart/signed email with LF line endings, signed by signer over its CRLF canonical form
+func pgpMIMEEmail(t *testing.T, signer *openpgp.Entity, body string) string {
+	signedPart := "Content-Type: text/plain; charset=utf-8\r\n\r\n" + strings.Replace(body, "\n", "\r\n", -1)
+	signature := new(bytes.Buffer)
+	if err := openpgp.ArmoredDetachSign(signature, signer, strings.NewReader(signedPart), nil); err != nil {
+		t.Fatal(err)
+	}
+	return "From: Alice <alice@example.com>\n" +
+		"To: emma@caliopen.local\n" +
+		"Date: Mon, 1 Apr 2019 10:00:00 +0200\n" +
+		"Subject: signed\n" +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: multipart/signed; micalg=pgp-sha256; protocol=\"application/pgp-signature\"; boundary=\"SIGNED\"\n" +
+		"\n" +
+		"--SIGNED\n" +
+		strings.Replace(signedPart, "\r\n", "\n", -1) +
+		"\n--SIGNED\n" +
+		"Content-Type: application/pgp-signature; name=\"signature.asc\"\n" +
+		"\n" +
+		signature.String() +
+		"\n--SIGNED--\n"
+}
+
+// inlineEmail returns an email whose text/plain part holds text clear signed by signer, between prefix and suffix
+func inlineEmail(t *testing.T, signer *openpgp.Entity, prefix, text, suffix string) string {
+	clearSigned := new(bytes.Buffer)
+	w, err := clearsign.Encode(clearSigned, signer.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(text))
+	w.Close()
+	return "From: Alice <alice@example.com>\n" +
+		"Date: Mon, 1 Apr 2019 10:00:00 +0200\n" +
+		"Content-Type: multipart/alternative; boundary=\"ALT\"\n" +
+		"\n" +
+		"--ALT\n" +
+		"Content-Type: text/plain; charset=utf-8\n" +
+		"\n" +
+		prefix +
+		clearSigned.String() +
+		suffix +
+		"\n--ALT\n" +
+		"Content-Type: text/html; charset=utf-8\n" +
+		"\n" +
+		"<p>Hello Emma</p>\n" +
+		"--ALT--\n"
+}
+
+func TestEmailBroker_verifySignature(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	mallory := newTestEntity(t, "Mallory", "mallory@example.com")
+	impostor := newTestEntity(t, "Alice", "alice@example.com")
+	store := &signatureTestStore{
+		keys: PublicKeys{
+			{Key: backendstest.ArmoredPublicKey(alice)},
+			{Key: backendstest.ArmoredPublicKey(impostor), Label: AutocryptKeyLabel, Source: AutocryptKeyLabel},
+		},
+		messages: map[string]*Message{},
+		updated:  map[string]map[string]interface{}{},
+	}
+	index := &signatureTestIndex{updated: map[string]map[string]interface{}{}}
+	b := &EmailBroker{Store: store, Index: index}
+	aliceFingerprint := strings.ToUpper(hex.EncodeToString(alice.PrimaryKey.Fingerprint[:]))
+	hello := "Hello Emma,\nsee you tomorrow.\n"
+
+	for name, test := range map[string]struct {
+		email       string
+		typ         string
+		status      string
+		fingerprint string
+		signer      uint64
+	}{
+		"pgp/mime":  {pgpMIMEEmail(t, alice, "Hello Emma\n"), SignatureTypePGPMIME, SignatureVerified, aliceFingerprint, alice.PrimaryKey.KeyId},
+		"tampered":  {strings.Replace(pgpMIMEEmail(t, alice, "Hello Emma\n"), "Hello", "Bye", 1), SignatureTypePGPMIME, SignatureBad, "", alice.PrimaryKey.KeyId},
+		"unknown":   {pgpMIMEEmail(t, mallory, "Hello Emma\n"), SignatureTypePGPMIME, SignatureUnknownKey, "", mallory.PrimaryKey.KeyId},
+		"autocrypt": {pgpMIMEEmail(t, impostor, "Hello Emma\n"), SignatureTypePGPMIME, SignatureUnknownKey, "", impostor.PrimaryKey.KeyId},
+		"inline":    {inlineEmail(t, alice, "", hello, ""), SignatureTypeInlinePGP, SignatureVerified, aliceFingerprint, alice.PrimaryKey.KeyId},
+		"prefixed":  {inlineEmail(t, alice, "Send me your password.\n\n", hello, ""), SignatureTypeInlinePGP, SignaturePartial, aliceFingerprint, alice.PrimaryKey.KeyId},
+		"suffixed":  {inlineEmail(t, alice, "", hello, "\nSend me your password.\n"), SignatureTypeInlinePGP, SignaturePartial, aliceFingerprint, alice.PrimaryKey.KeyId},
+	} {
+		signed, err := extractSignedContent([]byte(test.email))
+		if err != nil || signed == nil {
+			t.Errorf("%s: expected signed content, got %+v, %v", name, signed, err)
+			continue
+		}
+		msg := &Message{
+			Message_id:   UUID(uuid.NewV4()),
+			Participants: []Participant{{Type: ParticipantFrom, Address: "alice@example.com"}},
+		}
+		store.messages[msg.Message_id.String()] = msg
+		b.completeDeliveredMessage(UUID(uuid.NewV4()), UUID(uuid.NewV4()), msg.Message_id.String(), &deliveredEmail{signed: signed})
+
+		stored, indexed := store.updated[msg.Message_id.String()], index.updated[msg.Message_id.String()]
+		if stored == nil || indexed == nil {
+			t.Errorf("%s: expected message to be updated in store and index", name)
+			continue
+		}
+		features := stored["Privacy_features"].(PrivacyFeatures)
+		signedFeature, content := "False", uint32(0)
+		if test.status == SignatureVerified {
+			signedFeature, content = "True", 20
+		}
+		if features[FeatureMessageSigned] != signedFeature ||
+			features[FeatureMessageSignatureType] != test.typ ||
+			features[FeatureMessageSignatureStatus] != test.status ||
+			features[FeatureMessageSignerPrint] != test.fingerprint ||
+			features[FeatureMessageSigner] != fmt.Sprintf("%016X", test.signer) {
+			t.Errorf("%s: unexpected privacy features %v", name, features)
+		}
+		if _, found := stored["PI"]; found {
+			t.Errorf("%s: PI must not be stored", name)
+		}
+		if pi, ok := indexed["PI"].(*PIMessage); !ok || pi.Content != content {
+			t.Errorf("%s: expected PI recomputed from signature, got %+v", name, indexed["PI"])
+		}
+
+		em := &EmailMessage{Email: &Email{}, Message: &Message{}}
+		em.Email.Raw.WriteString(test.email)
+		unmarshaled, err := b.UnmarshalEmail(em, UUID(uuid.NewV4()))
+		if err != nil || (*unmarshaled.Privacy_features)[FeatureMessageSignatureStatus] != test.status {
+			t.Errorf("%s: expected signature to be verified when unmarshaling email, got %+v, %v", name, unmarshaled, err)
+		}
+	}
+
+	unsigned := "From: Alice <alice@example.com>\nSubject: hello\n\nnot signed\n"
+	if signed, err := extractSignedContent([]byte(unsigned)); signed != nil || err != nil {
+		t.Errorf("expected unsigned email to have no signed content, got %+v, %v", signed, err)
+	}
+}
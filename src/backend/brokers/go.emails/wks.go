@@ -0,0 +1,339 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/emersion/go-message"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// OpenPGP Web Key Service, see https://tools.ietf.org/html/draft-koch-openpgp-webkey-service
+// Users submit their key by mail to the submission address of their domain, a confirmation request is sent
+// to the key's address, encrypted to the submitted key. The key is published within Web Key Directory,
+// from user's own contact, once user has sent back the request's nonce in an encrypted confirmation response.
+
+const wksConfirmationText = `A key has been submitted to the Web Key Directory of your address %s,
+its fingerprint is %s.
+
+If you submitted it, your mail client should propose you to confirm its publication.
+Otherwise just ignore this message, the key won't be published.
+`
+
+// readWKSKeyring reads the armored secret key of submission address from file
+func readWKSKeyring(file string) (openpgp.EntityList, error) {
+	armored, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer armored.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(armored)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyring) == 0 || keyring[0].PrivateKey == nil || keyring[0].PrivateKey.Encrypted {
+		return nil, errors.New("submission key file holds no unprotected secret key")
+	}
+	return keyring, nil
+}
+
+// isWKSSubmissionAddress tells if recipient is the submission address of one of the domains
+func (b *EmailBroker) isWKSSubmissionAddress(recipient string) bool {
+	at := strings.LastIndex(recipient, "@")
+	return b.wksKeyring != nil && at > 0 && strings.EqualFold(recipient[:at], b.Config.WKDConfig.SubmissionLocalPart)
+}
+
+// processWKS handles an email sent to a submission address, either a key submission
+// (an application/pgp-keys part, optionally within a PGP/MIME encrypted email) or an encrypted confirmation response.
+func (b *EmailBroker) processWKS(raw []byte) error {
+	email, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(email.Header.Get("From"))
+	if err != nil {
+		return fmt.Errorf("invalid sender : %s", err)
+	}
+	contentType := email.Header.Get("Content-Type")
+	content, err := ioutil.ReadAll(decodePart(email.Body, email.Header.Get("Content-Transfer-Encoding")))
+	if err != nil {
+		return err
+	}
+	encrypted := false
+	if mediaType, params, _ := mime.ParseMediaType(contentType); mediaType == "multipart/encrypted" {
+		if contentType, content, err = b.decryptWKSEmail(content, params["boundary"]); err != nil {
+			return err
+		}
+		encrypted = true
+	}
+
+	response, err := findPart(contentType, bytes.NewReader(content), WKSMediaType)
+	if err != nil {
+		return err
+	}
+	if response != nil {
+		if !encrypted {
+			return errors.New("confirmation response is not encrypted")
+		}
+		return b.confirmWKSRequest(strings.ToLower(from.Address), response)
+	}
+	key, err := findPart(contentType, bytes.NewReader(content), "application/pgp-keys")
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("email is neither a key submission nor a confirmation response")
+	}
+	return b.submitWKSKey(key)
+}
+
+// decryptWKSEmail decrypts the body of a PGP/MIME encrypted email with submission address' key,
+// it returns the content type and the decoded body of the encrypted MIME entity.
+func (b *EmailBroker) decryptWKSEmail(body []byte, boundary string) (contentType string, content []byte, err error) {
+	parts := multipart.NewReader(bytes.NewReader(body), boundary)
+	var encrypted []byte
+	for {
+		part, e := parts.NextPart()
+		if e != nil {
+			break
+		}
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType == "application/octet-stream" {
+			encrypted, err = ioutil.ReadAll(part)
+			if err != nil {
+				return
+			}
+			break
+		}
+	}
+	if encrypted == nil {
+		return "", nil, errors.New("encrypted email without application/octet-stream part")
+	}
+	block, err := armor.Decode(bytes.NewReader(encrypted))
+	if err != nil {
+		return
+	}
+	md, err := openpgp.ReadMessage(block.Body, b.wksKeyring, nil, nil)
+	if err != nil {
+		return
+	}
+	if !md.IsEncrypted {
+		return "", nil, errors.New("PGP/MIME part is not encrypted")
+	}
+	entity, err := mail.ReadMessage(md.UnverifiedBody)
+	if err != nil {
+		return
+	}
+	content, err = ioutil.ReadAll(decodePart(entity.Body, entity.Header.Get("Content-Transfer-Encoding")))
+	return entity.Header.Get("Content-Type"), content, err
+}
+
+// submitWKSKey saves a request for each address of the submitted key which is a local identity,
+// and sends its confirmation request to the address.
+func (b *EmailBroker) submitWKSKey(key []byte) error {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return err
+	}
+	if len(entities) != 1 {
+		return fmt.Errorf("submission holds %d keys instead of one", len(entities))
+	}
+	entity := entities[0]
+	armored := new(bytes.Buffer)
+	w, err := armor.Encode(armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	if err = entity.Serialize(w); err != nil {
+		return err
+	}
+	w.Close()
+
+	submitted := false
+	for _, identity := range entity.Identities {
+		address := strings.ToLower(identity.UserId.Email)
+		at := strings.LastIndex(address, "@")
+		if at <= 0 {
+			continue
+		}
+		lookup, err := b.Store.LookupWKDIdentity(address[at+1:], WKDHash(address[:at]))
+		if err != nil || lookup.Address != address {
+			log.Infof("[EmailBroker] ignoring submitted key's address %s, which is not a local identity", address)
+			continue
+		}
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		request := &WKSRequest{
+			Address:     address,
+			DateInsert:  time.Now(),
+			Fingerprint: strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])),
+			IdentityId:  lookup.IdentityId,
+			Key:         armored.String(),
+			Nonce:       hex.EncodeToString(nonce),
+			UserId:      lookup.UserId,
+		}
+		if err := b.Store.CreateWKSRequest(request); err != nil {
+			return err
+		}
+		if err := b.sendWKSConfirmationRequest(entity, request); err != nil {
+			return err
+		}
+		submitted = true
+	}
+	if !submitted {
+		return errors.New("submitted key has no address of a local identity")
+	}
+	return nil
+}
+
+// sendWKSConfirmationRequest sends the nonce of request to its address, within an email encrypted to the submitted key
+// and signed by submission address, and waits for the MTA to accept it.
+func (b *EmailBroker) sendWKSConfirmationRequest(entity *openpgp.Entity, request *WKSRequest) error {
+	sender := strings.ToLower(b.Config.WKDConfig.SubmissionLocalPart + "@" + request.Address[strings.LastIndex(request.Address, "@")+1:])
+	wks := WKSMessage{
+		Type:        WKSConfirmationRequestType,
+		Sender:      sender,
+		Address:     request.Address,
+		Fingerprint: request.Fingerprint,
+		Nonce:       request.Nonce,
+	}
+
+	// encrypted MIME entity : an explanation for users whose mail client doesn't support WKS, and the request itself
+	textHeader := make(message.Header)
+	textHeader.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	wksHeader := make(message.Header)
+	wksHeader.SetContentType(WKSMediaType, nil)
+	innerHeader := make(message.Header)
+	innerHeader.SetContentType("multipart/mixed", map[string]string{"boundary": b.NewBoundary()})
+	inner, err := message.NewMultipart(innerHeader, []*message.Entity{
+		{Header: textHeader, Body: strings.NewReader(fmt.Sprintf(wksConfirmationText, request.Address, request.Fingerprint))},
+		{Header: wksHeader, Body: strings.NewReader(wks.String())},
+	})
+	if err != nil {
+		return err
+	}
+	encrypted := new(bytes.Buffer)
+	w, err := armor.Encode(encrypted, "PGP MESSAGE", nil)
+	if err != nil {
+		return err
+	}
+	plaintext, err := openpgp.Encrypt(w, []*openpgp.Entity{entity}, b.wksKeyring[0], nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = inner.WriteTo(plaintext); err != nil {
+		return err
+	}
+	plaintext.Close()
+	w.Close()
+
+	header := make(message.Header)
+	header.SetContentType("multipart/encrypted", map[string]string{"boundary": b.NewBoundary(), "protocol": "application/pgp-encrypted"})
+	header.Set("From", sender)
+	header.Set("To", request.Address)
+	header.Set("Subject", "Confirm your key publication")
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", "<"+request.Nonce+"@"+sender[strings.LastIndex(sender, "@")+1:]+">")
+	header.Set("X-Mailer", "Caliopen-"+b.Config.AppVersion)
+	body, err := formatBody(&Message{Body_plain: encrypted.String()}, header)
+	if err != nil {
+		return err
+	}
+
+	out := &SmtpEmail{
+		EmailMessage: &EmailMessage{Email: &Email{
+			SmtpMailFrom: []string{sender},
+			SmtpRcpTo:    []string{request.Address},
+			Raw:          body,
+		}},
+		Response: make(chan *EmailDeliveryAck),
+	}
+	b.Connectors.Egress <- out
+	select {
+	case ack, ok := <-out.Response:
+		if !ok || ack == nil || ack.Err {
+			return errors.New("delivery error from MTA")
+		}
+		return nil
+	case <-time.After(time.Second * 30):
+		return errors.New("SMTP server response timeout")
+	}
+}
+
+// confirmWKSRequest publishes the submitted key within user's own contact
+// once its address has sent back the nonce of a pending request.
+func (b *EmailBroker) confirmWKSRequest(from string, content []byte) error {
+	response, err := ParseWKSMessage(content)
+	if err != nil {
+		return err
+	}
+	if response.Type != WKSConfirmationResponseType {
+		return fmt.Errorf("unexpected wks message of type %s", response.Type)
+	}
+	request, e := b.Store.RetrieveWKSRequest(response.Nonce)
+	if e != nil {
+		return fmt.Errorf("no pending request for nonce %s : %s", response.Nonce, e)
+	}
+	if response.Address != request.Address || from != request.Address || !b.isWKSSubmissionAddress(response.Sender) {
+		return fmt.Errorf("confirmation response from %s does not match request for %s", from, request.Address)
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(request.Key))
+	if err != nil || len(entities) != 1 {
+		return fmt.Errorf("invalid submitted key %s", request.Fingerprint)
+	}
+
+	userId := request.UserId.String()
+	contactId := b.Store.RetrieveUserContactId(userId)
+	if contactId == "" {
+		return fmt.Errorf("no contact for user %s", userId)
+	}
+	keys, e := b.Store.RetrieveContactPubKeys(userId, contactId)
+	if e != nil {
+		return e
+	}
+	published := false
+	for _, key := range keys {
+		if key.Fingerprint == request.Fingerprint {
+			published = true
+			break
+		}
+	}
+	if !published {
+		contact, err := b.Store.RetrieveContact(userId, contactId)
+		if err != nil {
+			return err
+		}
+		pubkey := new(PublicKey)
+		if err := pubkey.UnmarshalPGPEntity(WKSKeyLabel, entities[0], contact); err != nil {
+			return err
+		}
+		if err := b.Store.CreatePGPPubKey(pubkey); err != nil {
+			return err
+		}
+	}
+	if err := b.Store.DeleteWKSRequest(request.Nonce); err != nil {
+		log.WithError(err).Warnf("[EmailBroker] failed to delete confirmed wks request for %s", request.Address)
+	}
+	log.Infof("[EmailBroker] key %s published for %s", request.Fingerprint, request.Address)
+	return nil
+}
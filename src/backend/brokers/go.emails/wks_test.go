@@ -0,0 +1,193 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package email_broker
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/satori/go.uuid"
+	"mime"
+	"net/mail"
+	"testing"
+)
+
+// wksTestStore knows emma's local identity and own contact, and keeps requests and contact's keys in memory
+type wksTestStore struct {
+	backendstest.LDAStoreBackend
+	contact  *Contact
+	keys     PublicKeys
+	requests map[string]*WKSRequest
+}
+
+func (s *wksTestStore) LookupWKDIdentity(domain, hash string) (*WKDLookup, error) {
+	if domain != "caliopen.local" || hash != WKDHash("emma") {
+		return nil, errors.New("not found")
+	}
+	return &WKDLookup{Address: "emma@caliopen.local", Domain: domain, Hash: hash, UserId: s.contact.UserId}, nil
+}
+func (s *wksTestStore) CreateWKSRequest(request *WKSRequest) CaliopenError {
+	s.requests[request.Nonce] = request
+	return nil
+}
+func (s *wksTestStore) RetrieveWKSRequest(nonce string) (*WKSRequest, CaliopenError) {
+	if request, ok := s.requests[nonce]; ok {
+		return request, nil
+	}
+	return nil, NewCaliopenErr(NotFoundCaliopenErr, "not found")
+}
+func (s *wksTestStore) DeleteWKSRequest(nonce string) CaliopenError {
+	delete(s.requests, nonce)
+	return nil
+}
+func (s *wksTestStore) RetrieveUserContactId(userId string) string {
+	return s.contact.ContactId.String()
+}
+func (s *wksTestStore) RetrieveContact(userId, contactId string) (*Contact, error) {
+	return s.contact, nil
+}
+func (s *wksTestStore) RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError) {
+	return s.keys, nil
+}
+func (s *wksTestStore) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
+	s.keys = append(s.keys, *pubkey)
+	return nil
+}
+
+// wksTestEmail returns a PGP/MIME email whose encrypted MIME entity is inner, or a plain email if to is nil
+func wksTestEmail(t *testing.T, to *openpgp.Entity, inner string) []byte {
+	email := "From: Emma <emma@caliopen.local>\nTo: key-submission@caliopen.local\nSubject: Key publishing\n"
+	if to == nil {
+		return []byte(email + inner)
+	}
+	encrypted := new(bytes.Buffer)
+	w, _ := armor.Encode(encrypted, "PGP MESSAGE", nil)
+	plaintext, err := openpgp.Encrypt(w, []*openpgp.Entity{to}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext.Write([]byte(inner))
+	plaintext.Close()
+	w.Close()
+	return []byte(email + "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=\"enc\"\n\n" +
+		"--enc\nContent-Type: application/pgp-encrypted\n\nVersion: 1\n\n" +
+		"--enc\nContent-Type: application/octet-stream\n\n" + encrypted.String() + "\n--enc--\n")
+}
+
+func TestEmailBroker_processWKS(t *testing.T) {
+	submission, err := backendstest.NewPGPEntity("Key submission", "key-submission@caliopen.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact := &Contact{
+		ContactId: UUID(uuid.NewV4()),
+		UserId:    UUID(uuid.NewV4()),
+		Emails:    []EmailContact{{Address: "emma@caliopen.local"}},
+	}
+	_, emma, err := backendstest.NewPublicKey(contact, "Emma", "emma@caliopen.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, alice, err := backendstest.NewPublicKey(&Contact{Emails: []EmailContact{{Address: "alice@example.com"}}}, "Alice", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &wksTestStore{contact: contact, requests: map[string]*WKSRequest{}}
+	b := &EmailBroker{
+		Config:     LDAConfig{WKDConfig: WKDConfig{Enable: true, SubmissionLocalPart: "key-submission"}},
+		Connectors: EmailBrokerConnectors{Egress: make(chan *SmtpEmail)},
+		Store:      store,
+		wksKeyring: openpgp.EntityList{submission},
+	}
+	sent := make(chan *SmtpEmail, 1)
+	go func() {
+		for out := range b.Connectors.Egress {
+			sent <- out
+			out.Response <- &EmailDeliveryAck{EmailMessage: out.EmailMessage}
+		}
+	}()
+	defer close(b.Connectors.Egress)
+
+	if !b.isWKSSubmissionAddress("Key-Submission@caliopen.local") || b.isWKSSubmissionAddress("emma@caliopen.local") {
+		t.Error("expected only submission local-part to be routed to Web Key Service")
+	}
+
+	// keys of addresses that are not local identities are not accepted
+	keys := "Content-Type: application/pgp-keys\n\n" + backendstest.ArmoredPublicKey(alice)
+	if err := b.processWKS(wksTestEmail(t, nil, keys)); err == nil || len(store.requests) != 0 {
+		t.Errorf("expected submission of alice's key to be rejected, got %v", err)
+	}
+
+	// a submission, encrypted to submission address, is confirmed by mail to emma
+	keys = "Content-Type: application/pgp-keys\n\n" + backendstest.ArmoredPublicKey(emma)
+	if err := b.processWKS(wksTestEmail(t, submission, keys)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.requests) != 1 {
+		t.Fatalf("expected a pending request, got %d", len(store.requests))
+	}
+	out := <-sent
+	if len(out.EmailMessage.Email.SmtpRcpTo) != 1 || out.EmailMessage.Email.SmtpRcpTo[0] != "emma@caliopen.local" ||
+		out.EmailMessage.Email.SmtpMailFrom[0] != "key-submission@caliopen.local" {
+		t.Errorf("expected confirmation request to be sent by submission address to emma, got %v", out.EmailMessage.Email)
+	}
+	email, err := mail.ReadMessage(bytes.NewReader(out.EmailMessage.Email.Raw.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, _ := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	body := new(bytes.Buffer)
+	body.ReadFrom(email.Body)
+	// only emma can read it
+	emmaBroker := &EmailBroker{wksKeyring: openpgp.EntityList{emma}}
+	contentType, content, err := emmaBroker.decryptWKSEmail(body.Bytes(), params["boundary"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := findPart(contentType, bytes.NewReader(content), WKSMediaType)
+	if err != nil || part == nil {
+		t.Fatalf("expected a %s part within confirmation request, got %v", WKSMediaType, err)
+	}
+	request, err := ParseWKSMessage(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := store.requests[request.Nonce]
+	if request.Type != WKSConfirmationRequestType || pending == nil || request.Address != "emma@caliopen.local" ||
+		request.Fingerprint != pending.Fingerprint {
+		t.Fatalf("expected confirmation request of pending request, got %+v", request)
+	}
+
+	response := WKSMessage{
+		Type:    WKSConfirmationResponseType,
+		Sender:  request.Sender,
+		Address: request.Address,
+		Nonce:   request.Nonce,
+	}
+	inner := "Content-Type: " + WKSMediaType + "\n\n" + response.String()
+	// confirmation responses must be encrypted
+	if err := b.processWKS(wksTestEmail(t, nil, inner)); err == nil || len(store.keys) != 0 {
+		t.Errorf("expected plain confirmation response to be rejected, got %v", err)
+	}
+	wrongNonce := response
+	wrongNonce.Nonce = "0123456789abcdef"
+	if err := b.processWKS(wksTestEmail(t, submission, "Content-Type: "+WKSMediaType+"\n\n"+wrongNonce.String())); err == nil || len(store.keys) != 0 {
+		t.Errorf("expected confirmation response with an unknown nonce to be rejected, got %v", err)
+	}
+
+	if err := b.processWKS(wksTestEmail(t, submission, inner)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.keys) != 1 || store.keys[0].Label != WKSKeyLabel || !store.keys[0].UploadedByUser() ||
+		store.keys[0].Fingerprint != pending.Fingerprint || store.keys[0].ResourceId != contact.ContactId {
+		t.Errorf("expected emma's key to be published from her contact, got %+v", store.keys)
+	}
+	if len(store.requests) != 0 {
+		t.Error("expected confirmed request to be removed")
+	}
+}
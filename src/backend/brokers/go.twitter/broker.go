@@ -34,6 +34,7 @@ type (
 		NatsTopicPoller      string      `mapstructure:"nats_topic_poller"`
 		NatsTopicPollerCache string      `mapstructure:"nats_topic_poller_cache"`
 		NatsTopicDMs         string      `mapstructure:"nats_topic_direct_message"`
+		NatsTopicStatus      string      `mapstructure:"nats_topic_status"`
 		StoreConfig          StoreConfig `mapstructure:"store_settings"`
 		StoreName            string      `mapstructure:"store_name"`
 		LDAConfig            LDAConfig   `mapstructure:"LDAConfig"`
@@ -79,6 +79,7 @@ class DiscoveryResult(object):
     def __init__(self, keys, extra_identities=None):
         self.keys = keys
         self.identities = extra_identities if extra_identities else []
+        self.source = None      # name of discoverer that found keys
 
     @property
     def emails(self):
@@ -18,15 +18,16 @@ class ContactDiscoveryResult(object):
         self.keys = []
         self.emails = []
         self.identities = []
+        self.sources = {}       # discoverer of each key, by fingerprint
 
 
 class ContactPublicKeyManager(object):
     """Manage contact public keys."""
 
-    def __init__(self):
-        """Instanciate a `ContactPublicKeyManager`."""
+    def __init__(self, methods=None):
+        """Instanciate a `ContactPublicKeyManager`, with some methods only."""
         conf = Configuration('global').configuration
-        self.discoverer = PublicKeyDiscoverer(conf)
+        self.discoverer = PublicKeyDiscoverer(conf, methods)
 
     def _find_keys(self, user, contact, new_identifier, type_):
         """Find keys related to a new identifier for a contact."""
@@ -66,6 +67,7 @@ class ContactPublicKeyManager(object):
         for disco in discovers:
             for key in disco.keys:
                 result.keys.append(key)
+                result.sources[key.fingerprint] = disco.source
                 found_emails.extend(self._filter_new_emails(contact, key))
             if disco.identities:
                 ids = self._filter_new_identities(contact, disco.identities)
@@ -16,21 +16,19 @@ log.setLevel(logging.DEBUG)
 class PublicKeyDiscoverer(object):
     """Discover of public keys for a contact information."""
 
-    discoverers = {}
-
-    def __init__(self, conf):
-        params = conf.get('key_discovery', {}).get('dns', {})
-        if params.get('enable'):
-            disco = DNSDiscovery(params)
-            self.discoverers['dns'] = disco
-        params = conf.get('key_discovery', {}).get('keybase', {})
-        if params.get('enable'):
-            disco = KeybaseDiscovery(params)
-            self.discoverers['keybase'] = disco
-        params = conf.get('key_discovery', {}).get('hkp', {})
-        if params.get('enable'):
-            disco = HKPDiscovery(params)
-            self.discoverers['hkp'] = disco
+    _classes = {'dns': DNSDiscovery,
+                'keybase': KeybaseDiscovery,
+                'hkp': HKPDiscovery}
+
+    def __init__(self, conf, methods=None):
+        """Enable configured discoverers, only among methods if given."""
+        self.discoverers = {}
+        for name, kls in self._classes.items():
+            if methods is not None and name not in methods:
+                continue
+            params = conf.get('key_discovery', {}).get(name, {})
+            if params.get('enable'):
+                self.discoverers[name] = kls(params)
 
     def lookup_identity(self, identity, type_):
         """Search for public key for an identifier and a protocol type."""
@@ -40,6 +38,7 @@ class PublicKeyDiscoverer(object):
                 discoverer = self.discoverers[disco]
                 try:
                     result = discoverer.lookup_identity(identity, type_)
+                    result.source = disco
                     if result.keys:
                         results.append(result)
                 except Exception as exc:
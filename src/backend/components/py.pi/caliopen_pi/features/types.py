@@ -10,11 +10,19 @@ MESSAGE = {'mail_emitter_mx_reputation': {'type': 'string'},
            'mail_emitter_certificate': {'type': 'string'},
            'mail_agent': {'type': 'string'},
            'transport_signed': {'type': 'bool'},
+           'transport_spf': {'type': 'string'},
+           'transport_dkim': {'type': 'string'},
+           'transport_dmarc': {'type': 'string'},
            'message_signed': {'type': 'bool'},
            'message_signature_type': {'type': 'string'},
+           'message_signature_status': {'type': 'string'},
+           'message_signer': {'type': 'string'},
+           'message_signer_fingerprint': {'type': 'string'},
            'message_encrypted': {'type': 'bool'},
            'message_encryption_method': {'type': 'string'},
            'message_encryption_infos': {'type': 'string'},
+           'autocrypt_setup_message': {'type': 'bool'},
+           'autocrypt_setup_passphrase_begin': {'type': 'string'},
            'is_spam': {'type': 'bool'},
            'spam_score': {'max': 100, 'min': 0, 'type': 'int'},
            'spam_method': {'type': 'string'},
@@ -0,0 +1,42 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"crypto/sha256"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+// AppPassword is a password generated for a single client application that can't go through login process,
+// like a CardDAV address book. Password is only given to user at creation, store only keeps its hash.
+type AppPassword struct {
+	AppPasswordId UUID      `cql:"app_password_id"   json:"app_password_id"   formatter:"rfc4122"`
+	DateInsert    time.Time `cql:"date_insert"       json:"date_insert"`
+	Hash          []byte    `cql:"password_hash"     json:"-"`
+	Label         string    `cql:"label"             json:"label"` // application's name, chosen by user
+	UserId        UUID      `cql:"user_id"           json:"user_id"           formatter:"rfc4122"`
+}
+
+// HashAppPassword returns hash of a generated password.
+// Generated passwords are random enough to not need a slow hash, which would be computed on each client's request.
+func HashAppPassword(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return sum[:]
+}
+
+// unmarshal a map[string]interface{} that must owns all AppPassword's fields
+// typical usage is for unmarshaling response from Cassandra backend
+func (ap *AppPassword) UnmarshalCQLMap(input map[string]interface{}) {
+	if id, ok := input["app_password_id"].(gocql.UUID); ok {
+		ap.AppPasswordId.UnmarshalBinary(id.Bytes())
+	}
+	ap.DateInsert, _ = input["date_insert"].(time.Time)
+	ap.Hash, _ = input["password_hash"].([]byte)
+	ap.Label, _ = input["label"].(string)
+	if id, ok := input["user_id"].(gocql.UUID); ok {
+		ap.UserId.UnmarshalBinary(id.Bytes())
+	}
+}
@@ -0,0 +1,151 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gocql/gocql"
+	"github.com/keybase/go-crypto/openpgp"
+	"strings"
+	"time"
+)
+
+// Autocrypt Level 1, see https://autocrypt.org/level1.html
+const (
+	AutocryptMutual       = "mutual"
+	AutocryptNoPreference = "nopreference"
+
+	AutocryptKeyLabel = "autocrypt" // label of contacts' keys imported from Autocrypt headers
+
+	// privacy features of Autocrypt Setup Messages, which embed the encrypted secret key of one of user's identities
+	FeatureAutocryptSetup           = "autocrypt_setup_message"
+	FeatureAutocryptPassphraseBegin = "autocrypt_setup_passphrase_begin"
+)
+
+type (
+	// AutocryptHeader is a parsed `Autocrypt:` email header
+	AutocryptHeader struct {
+		Addr          string
+		PreferEncrypt string // AutocryptMutual or AutocryptNoPreference
+		KeyData       []byte // binary OpenPGP transferable public key
+		Entity        *openpgp.Entity
+	}
+
+	// AutocryptPeer is the state kept for a correspondent's address, as seen by an user's Autocrypt-capable mailbox
+	AutocryptPeer struct {
+		Address            string    `cql:"address"             json:"address"`
+		AutocryptTimestamp time.Time `cql:"autocrypt_timestamp" json:"autocrypt_timestamp"` // date of most recent message with an Autocrypt header
+		Fingerprint        string    `cql:"fingerprint"         json:"fingerprint"`
+		KeyData            string    `cql:"keydata"             json:"keydata"` // base64 encoded, as found in header
+		LastSeen           time.Time `cql:"last_seen"           json:"last_seen"`
+		PreferEncrypt      string    `cql:"prefer_encrypt"      json:"prefer_encrypt"`
+		UserId             UUID      `cql:"user_id"             json:"user_id"             formatter:"rfc4122"`
+	}
+)
+
+// ParseAutocryptHeader parses the value of an `Autocrypt:` header.
+// Header is invalid if `addr` or `keydata` are missing, if keydata is not an OpenPGP public key,
+// or if it holds an unknown critical attribute (one that doesn't start with an underscore).
+func ParseAutocryptHeader(value string) (*AutocryptHeader, error) {
+	header := &AutocryptHeader{PreferEncrypt: AutocryptNoPreference}
+	var keydata string
+	for _, attribute := range strings.Split(value, ";") {
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			continue
+		}
+		kv := strings.SplitN(attribute, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed autocrypt attribute %s", attribute)
+		}
+		name := strings.ToLower(strings.TrimSpace(kv[0]))
+		switch {
+		case name == "addr":
+			header.Addr = strings.ToLower(strings.TrimSpace(kv[1]))
+		case name == "prefer-encrypt":
+			if strings.TrimSpace(kv[1]) == AutocryptMutual {
+				header.PreferEncrypt = AutocryptMutual
+			}
+		case name == "keydata":
+			keydata = strings.Join(strings.Fields(kv[1]), "")
+		case strings.HasPrefix(name, "_"):
+			// non-critical attribute, ignored
+		default:
+			return nil, fmt.Errorf("unknown critical autocrypt attribute %s", name)
+		}
+	}
+	if header.Addr == "" || keydata == "" {
+		return nil, errors.New("autocrypt header without addr or keydata")
+	}
+	var err error
+	if header.KeyData, err = base64.StdEncoding.DecodeString(keydata); err != nil {
+		return nil, fmt.Errorf("invalid autocrypt keydata : %s", err)
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(header.KeyData))
+	if err != nil || len(entities) != 1 {
+		return nil, errors.New("autocrypt keydata is not a single OpenPGP public key")
+	}
+	header.Entity = entities[0]
+	return header, nil
+}
+
+// Fingerprint returns the fingerprint of header's key primary key, in upper hexadecimal
+func (ah *AutocryptHeader) Fingerprint() string {
+	return strings.ToUpper(hex.EncodeToString(ah.Entity.PrimaryKey.Fingerprint[:]))
+}
+
+// Update applies Autocrypt's peer state update rules for a message sent at effective date,
+// with its Autocrypt header if any. Messages older than the last one seen are ignored.
+// It returns whether peer has been updated, and whether its key has changed.
+func (ap *AutocryptPeer) Update(date time.Time, header *AutocryptHeader) (updated, keyChanged bool) {
+	if date.Before(ap.LastSeen) {
+		return false, false
+	}
+	ap.LastSeen = date
+	if header != nil && date.After(ap.AutocryptTimestamp) {
+		ap.AutocryptTimestamp = date
+		ap.PreferEncrypt = header.PreferEncrypt
+		fingerprint := header.Fingerprint()
+		keyChanged = fingerprint != ap.Fingerprint
+		ap.Fingerprint = fingerprint
+		ap.KeyData = base64.StdEncoding.EncodeToString(header.KeyData)
+	}
+	return true, keyChanged
+}
+
+// unmarshal a map[string]interface{} that must owns all AutocryptPeer's fields
+// typical usage is for unmarshaling response from Cassandra backend
+func (ap *AutocryptPeer) UnmarshalCQLMap(input map[string]interface{}) {
+	ap.Address, _ = input["address"].(string)
+	ap.AutocryptTimestamp, _ = input["autocrypt_timestamp"].(time.Time)
+	ap.Fingerprint, _ = input["fingerprint"].(string)
+	ap.KeyData, _ = input["keydata"].(string)
+	ap.LastSeen, _ = input["last_seen"].(time.Time)
+	ap.PreferEncrypt, _ = input["prefer_encrypt"].(string)
+	if id, ok := input["user_id"].(gocql.UUID); ok {
+		ap.UserId.UnmarshalBinary(id.Bytes())
+	}
+}
+
+// String formats header as an `Autocrypt:` header value, with keydata split in chunks separated by spaces
+// to let it be folded on several lines.
+func (ah *AutocryptHeader) String() string {
+	value := "addr=" + ah.Addr + "; "
+	if ah.PreferEncrypt == AutocryptMutual {
+		value += "prefer-encrypt=mutual; "
+	}
+	keydata := base64.StdEncoding.EncodeToString(ah.KeyData)
+	chunks := []string{}
+	for len(keydata) > 76 {
+		chunks = append(chunks, keydata[:76])
+		keydata = keydata[76:]
+	}
+	chunks = append(chunks, keydata)
+	return value + "keydata=" + strings.Join(chunks, " ")
+}
@@ -7,12 +7,15 @@ package objects
 type (
 	CaliopenConfig struct {
 		CacheConfig     CacheConfig
+		Export          ExportConfig
 		Hostname        string
 		NatsConfig      NatsConfig
 		NotifierConfig  NotifierConfig
 		Providers       []Provider `mapstructure:"Providers"`
 		RESTindexConfig RESTIndexConfig
 		RESTstoreConfig RESTstoreConfig
+		ScheduledSend   ScheduledSendConfig
+		WKD             WKDConfig
 	}
 
 	// REST API
@@ -40,6 +43,24 @@ type (
 		Db       int    `mapstructure:"db"`
 	}
 
+	// drafts' scheduled sending
+	ScheduledSendConfig struct {
+		ScanInterval int `mapstructure:"scan_interval"` // how often (in seconds) the scheduler looks for due drafts
+		UndoDelay    int `mapstructure:"undo_delay"`    // how long (in seconds) a draft is held before being sent, 0 to send immediately
+	}
+
+	// users' data export
+	ExportConfig struct {
+		LinkTTL int `mapstructure:"link_ttl"` // how long (in hours) the download link of an export remains valid
+	}
+
+	// OpenPGP Web Key Directory publishing users' keys, and Web Key Service accepting their submissions
+	WKDConfig struct {
+		Enable              bool   `mapstructure:"enable"`
+		SubmissionLocalPart string `mapstructure:"submission_local_part"` // local-part of submission address within each domain, Web Key Service is disabled if empty
+		SubmissionKeyFile   string `mapstructure:"submission_key_file"`   // armored key of submission address, API only publishes its public part
+	}
+
 	// NATS
 	NatsConfig struct {
 		Url              string `mapstructure:"url"`
@@ -50,6 +71,8 @@ type (
 		Keys_topic       string `mapstructure:"keys_topic"`
 		Users_topic      string `mapstructure:"users_topic"`
 		IdPoller_topic   string `mapstructure:"idpoller_topic"`
+		Notifs_topic     string `mapstructure:"notifs_topic"`  // prefix of subjects on which notifications are published for each user
+		Imports_topic    string `mapstructure:"imports_topic"` // subject on which IMAP workers report progress of mailbox imports
 	}
 	// Cassandra
 	StoreConfig struct {
@@ -79,9 +102,26 @@ type (
 
 	// Notifications facility
 	NotifierConfig struct {
-		AdminUsername string `mapstructure:"admin_username"`
-		BaseUrl       string `mapstructure:"base_url"`       // url upon which to build custom links sent to users. No trailing slash please.
-		TemplatesPath string `mapstructure:"templates_path"` // path to templates Notifiers may need to access to
+		AdminUsername string       `mapstructure:"admin_username"`
+		BaseUrl       string       `mapstructure:"base_url"`       // url upon which to build custom links sent to users. No trailing slash please.
+		TemplatesPath string       `mapstructure:"templates_path"` // path to templates Notifiers may need to access to
+		Push          PushConfig   `mapstructure:"push"`
+		Digest        DigestConfig `mapstructure:"digest"`
+	}
+
+	// email digests of unread messages
+	DigestConfig struct {
+		Hour         int `mapstructure:"hour"`          // local hour (in user's timezone) at which digests are sent
+		MaxMessages  int `mapstructure:"max_messages"`  // max number of unread messages summarised within a digest
+		ScanInterval int `mapstructure:"scan_interval"` // how often (in minutes) digests scheduler looks for due digests
+	}
+
+	// Web Push notifier
+	PushConfig struct {
+		Notifications   []string `mapstructure:"notifications"`     // kinds of notifications pushed to devices, ie the key of notification's body (emailReceived, dmReceived…)
+		TTL             int      `mapstructure:"ttl"`               // how long (in seconds) push services should retain undelivered notifications
+		VapidPrivateKey string   `mapstructure:"vapid_private_key"` // base64url encoded P-256 private key to sign requests to push services. Push is disabled if empty.
+		VapidSubject    string   `mapstructure:"vapid_subject"`     // contact URI (mailto: or https:) given to push services
 	}
 
 	// Hashicorp Vault
@@ -107,6 +147,7 @@ type (
 		NatsListeners    int            `mapstructure:"nats_listeners"`
 		NatsQueue        string         `mapstructure:"nats_queue"`
 		NatsURL          string         `mapstructure:"nats_url"`
+		NotifsTopic      string         `mapstructure:"notifs_topic"`
 		OutTopic         string         `mapstructure:"out_topic"`
 		PrimaryMailHost  string         `mapstructure:"primary_mail_host"`
 		StoreName        string         `mapstructure:"store_name"`
@@ -114,5 +155,6 @@ type (
 		NotifierConfig   NotifierConfig `mapstructure:"NotifierConfig"`
 		Providers        []Provider     `mapstructure:"Providers"`
 		StoreConfig      StoreConfig    `mapstructure:"store_settings"`
+		WKDConfig        WKDConfig      `mapstructure:"WKDConfig"`
 	}
 )
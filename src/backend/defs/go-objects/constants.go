@@ -41,6 +41,9 @@ const (
 	Nats_outTwitter_topicKey = "outTWITTER_topic"
 	Nats_Keys_topicKey       = "keys_topic"
 	Nats_IdPoller_topicKey   = "idpoller_topic"
+	Nats_Notifs_topicKey     = "notifs_topic"
+	Nats_Users_topicKey      = "users_topic"
+	Nats_Imports_topicKey    = "imports_topic"
 
 	//participant types
 	ParticipantBcc     = "Bcc"
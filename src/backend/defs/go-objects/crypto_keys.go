@@ -38,6 +38,8 @@ type PublicKey struct {
 	ResourceId   UUID      `cql:"resource_id"      json:"resource_id"                                               patch:"system"`
 	ResourceType string    `cql:"resource_type"    json:"resource_type,omitempty"                                   patch:"system"`
 	Size         int       `cql:"size"             json:"size"                                                      patch:"system"`
+	Source       string    `cql:"source"           json:"source,omitempty"                                          patch:"system"` // how key has been found : wkd, hkp, autocrypt… empty if uploaded by user
+	SourceURL    string    `cql:"source_url"       json:"source_url,omitempty"                                      patch:"system"`
 	Use          string    `cql:"\"use\""          json:"use,omitempty"                                             patch:"system"`
 	UserId       UUID      `cql:"user_id"          json:"user_id,omitempty"                                         patch:"system"`
 	X            big.Int   `cql:"x"                json:"x,omitempty"                                               patch:"system"`
@@ -61,6 +63,39 @@ type PublishKeyMessage struct {
 	KeyId      string `json:"key_id"`
 }
 
+// HKPKeySource is the source of contacts' keys found on HKP keyservers
+const HKPKeySource = "hkp"
+
+// Trusted tells if key's provenance vouches for its owner : keys uploaded or imported by user,
+// and keys published by owner's mail domain in a Web Key Directory.
+// Keys taken from Autocrypt headers or from keyservers could have been provided by anyone.
+// Label is also checked, because source is lost when keys are copied from a contact to another one.
+func (pk *PublicKey) Trusted() bool {
+	for _, origin := range []string{pk.Source, pk.Label} {
+		if origin == AutocryptKeyLabel || origin == HKPKeySource {
+			return false
+		}
+	}
+	switch pk.Source {
+	case "", WKDAdvancedMethod, WKDDirectMethod:
+		return true
+	}
+	return false
+}
+
+// UploadedByUser tells if key has been uploaded or imported by user, rather than found in Autocrypt headers,
+// on keyservers or in Web Key Directories. As for Trusted, label is checked too.
+func (pk *PublicKey) UploadedByUser() bool {
+	if pk.Source != "" {
+		return false
+	}
+	switch pk.Label {
+	case AutocryptKeyLabel, HKPKeySource, WKDAdvancedMethod, WKDDirectMethod:
+		return false
+	}
+	return true
+}
+
 // unmarshal a map[string]interface{} that must owns all PublicKey's fields
 // typical usage is for unmarshaling response from Cassandra backend
 func (pk *PublicKey) UnmarshalCQLMap(input map[string]interface{}) {
@@ -109,6 +144,12 @@ func (pk *PublicKey) UnmarshalCQLMap(input map[string]interface{}) {
 	if size, ok := input["size"].(*big.Int); ok {
 		pk.Size = int(size.Int64())
 	}
+	if source, ok := input["source"].(string); ok {
+		pk.Source = source
+	}
+	if sourceURL, ok := input["source_url"].(string); ok {
+		pk.SourceURL = sourceURL
+	}
 	if use, ok := input["use"].(string); ok {
 		pk.Use = use
 	}
@@ -173,6 +214,12 @@ func (pk *PublicKey) UnmarshalMap(input map[string]interface{}) error {
 	if size, ok := input["size"].(*big.Int); ok {
 		pk.Size = int(size.Int64())
 	}
+	if source, ok := input["source"].(string); ok {
+		pk.Source = source
+	}
+	if sourceURL, ok := input["source_url"].(string); ok {
+		pk.SourceURL = sourceURL
+	}
 	if use, ok := input["use"].(string); ok {
 		pk.Use = use
 	}
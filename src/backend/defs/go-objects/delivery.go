@@ -0,0 +1,69 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"github.com/gocql/gocql"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// DeliveryStatus is the delivery status of a sent message for one of its recipients
+type DeliveryStatus struct {
+	Address    string    `cql:"address"           json:"address"`
+	Date       time.Time `cql:"date"              json:"date,omitempty"                 formatter:"RFC3339Milli"`
+	Error      string    `cql:"error"             json:"error,omitempty"`
+	IdentityId UUID      `cql:"identity_id"       json:"identity_id,omitempty"          formatter:"rfc4122"` // user's identity used to send to recipient
+	MessageId  UUID      `cql:"message_id"        json:"message_id,omitempty"           formatter:"rfc4122"` // outgoing message that has been sent to recipient
+	Protocol   string    `cql:"protocol"          json:"protocol"`
+	Status     string    `cql:"status"            json:"status"`
+}
+
+// recipients' delivery statuses
+const (
+	DeliveryFailed = "failed" // outbound worker failed to send message
+	DeliverySent   = "sent"   // message has been handed over to recipient's server
+	// statuses reported by delivery status notifications
+	DeliveryBounced   = "bounced"
+	DeliveryDelayed   = "delayed"
+	DeliveryDelivered = "delivered"
+)
+
+func (ds *DeliveryStatus) UnmarshalMap(input map[string]interface{}) error {
+	ds.Address, _ = input["address"].(string)
+	if date, ok := input["date"].(string); ok {
+		ds.Date, _ = time.Parse(time.RFC3339Nano, date)
+	}
+	ds.Error, _ = input["error"].(string)
+	if identity_id, ok := input["identity_id"].(string); ok {
+		if id, err := uuid.FromString(identity_id); err == nil {
+			ds.IdentityId.UnmarshalBinary(id.Bytes())
+		}
+	}
+	if message_id, ok := input["message_id"].(string); ok {
+		if id, err := uuid.FromString(message_id); err == nil {
+			ds.MessageId.UnmarshalBinary(id.Bytes())
+		}
+	}
+	ds.Protocol, _ = input["protocol"].(string)
+	ds.Status, _ = input["status"].(string)
+	return nil
+}
+
+// UnmarshalCQLMap hydrates a DeliveryStatus with data from a cassandra user defined type
+func (ds *DeliveryStatus) UnmarshalCQLMap(input map[string]interface{}) error {
+	ds.Address, _ = input["address"].(string)
+	ds.Date, _ = input["date"].(time.Time)
+	ds.Error, _ = input["error"].(string)
+	if identity_id, ok := input["identity_id"].(gocql.UUID); ok {
+		ds.IdentityId.UnmarshalBinary(identity_id.Bytes())
+	}
+	if message_id, ok := input["message_id"].(gocql.UUID); ok {
+		ds.MessageId.UnmarshalBinary(message_id.Bytes())
+	}
+	ds.Protocol, _ = input["protocol"].(string)
+	ds.Status, _ = input["status"].(string)
+	return nil
+}
@@ -9,6 +9,7 @@ package objects
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/gocql/gocql"
 	"github.com/satori/go.uuid"
 	"sort"
@@ -19,20 +20,29 @@ import (
 
 type Device struct {
 	// PRIMARY KEYS (user_id, device_id)
-	Locker          *sync.Mutex      `cql:"-"                json:"-"`
-	DateInsert      time.Time        `cql:"date_insert"      json:"date_insert,omitempty"      patch:"system"        formatter:"RFC3339Milli"`
-	DateRevoked     time.Time        `cql:"date_revoked"     json:"date_revoked,omitempty"     patch:"system"        formatter:"RFC3339Milli"`
-	DeviceId        UUID             `cql:"device_id"        json:"device_id"                  patch:"system"`
-	IpCreation      string           `cql:"ip_creation"      json:"ip_creation"                patch:"user"`
-	Locations       DeviceLocations  `cql:"-"                json:"locations,omitempty"        patch:"user"`
-	Name            string           `cql:"name"             json:"name"                       patch:"user"`
-	PrivacyFeatures *PrivacyFeatures `cql:"privacy_features" json:"privacy_features,omitempty" patch:"user"`
-	PrivacyIndex    *PrivacyIndex    `cql:"pi"               json:"pi,omitempty"               patch:"system"`
-	PublicKeys      PublicKeys       `cql:"-"                json:"public_keys,omitempty"      patch:"user"`
-	Status          string           `cql:"status"           json:"status,omitempty"           patch:"system"`
-	Type            string           `cql:"type"             json:"type,omitempty"             patch:"user"`
-	UserAgent       string           `cql:"user_agent"       json:"user_agent"                 patch:"system"`
-	UserId          UUID             `cql:"user_id"          json:"user_id"                    patch:"system"`
+	Locker          *sync.Mutex       `cql:"-"                json:"-"`
+	DateInsert      time.Time         `cql:"date_insert"      json:"date_insert,omitempty"      patch:"system"        formatter:"RFC3339Milli"`
+	DateRevoked     time.Time         `cql:"date_revoked"     json:"date_revoked,omitempty"     patch:"system"        formatter:"RFC3339Milli"`
+	DeviceId        UUID              `cql:"device_id"        json:"device_id"                  patch:"system"`
+	IpCreation      string            `cql:"ip_creation"      json:"ip_creation"                patch:"user"`
+	Locations       DeviceLocations   `cql:"-"                json:"locations,omitempty"        patch:"user"`
+	Name            string            `cql:"name"             json:"name"                       patch:"user"`
+	PrivacyFeatures *PrivacyFeatures  `cql:"privacy_features" json:"privacy_features,omitempty" patch:"user"`
+	PrivacyIndex    *PrivacyIndex     `cql:"pi"               json:"pi,omitempty"               patch:"system"`
+	PublicKeys      PublicKeys        `cql:"-"                json:"public_keys,omitempty"      patch:"user"`
+	Push            *PushSubscription `cql:"push_subscription" json:"push_subscription,omitempty" patch:"system"`
+	Status          string            `cql:"status"           json:"status,omitempty"           patch:"system"`
+	Type            string            `cql:"type"             json:"type,omitempty"             patch:"user"`
+	UserAgent       string            `cql:"user_agent"       json:"user_agent"                 patch:"system"`
+	UserId          UUID              `cql:"user_id"          json:"user_id"                    patch:"system"`
+}
+
+// PushSubscription is the Web Push (RFC 8030) subscription of a device's user agent
+type PushSubscription struct {
+	Auth       string    `cql:"auth"        json:"auth"         frontend:"omit"` // base64url encoded authentication secret
+	DateInsert time.Time `cql:"date_insert" json:"date_insert"                    formatter:"RFC3339Milli"`
+	Endpoint   string    `cql:"endpoint"    json:"endpoint"`
+	P256dh     string    `cql:"p256dh"      json:"p256dh"` // base64url encoded user agent's public key
 }
 
 // payload for triggering a device validation process for an end-user
@@ -81,6 +91,19 @@ func (d *Device) UnmarshalCQLMap(input map[string]interface{}) {
 
 	// publicKeys are stored in another table
 
+	if i_push, ok := input["push_subscription"].(map[string]interface{}); ok && i_push != nil {
+		push := PushSubscription{}
+		push.Auth, _ = i_push["auth"].(string)
+		push.DateInsert, _ = i_push["date_insert"].(time.Time)
+		push.Endpoint, _ = i_push["endpoint"].(string)
+		push.P256dh, _ = i_push["p256dh"].(string)
+		if push.Endpoint != "" {
+			d.Push = &push
+		}
+	} else {
+		d.Push = nil
+	}
+
 	if revokedAt, ok := input["revoked_at"].(time.Time); ok {
 		d.DateRevoked = revokedAt
 	}
@@ -145,6 +168,12 @@ func (d *Device) UnmarshalMap(input map[string]interface{}) error {
 			}
 		}
 	}
+	if i_push, ok := input["push_subscription"].(map[string]interface{}); ok && i_push != nil {
+		push := new(PushSubscription)
+		if err := push.UnmarshalMap(i_push); err == nil {
+			d.Push = push
+		}
+	}
 	if revokedAt, ok := input["revoked_at"]; ok {
 		d.DateRevoked, _ = time.Parse(time.RFC3339Nano, revokedAt.(string))
 	}
@@ -166,6 +195,25 @@ func (d *Device) UnmarshalMap(input map[string]interface{}) error {
 	return nil
 }
 
+// UnmarshalMap hydrates a PushSubscription with data from a map[string]interface{}
+// it accepts the JSON format of browsers' PushSubscription, where keys are nested within a `keys` object
+func (ps *PushSubscription) UnmarshalMap(input map[string]interface{}) error {
+	keys := input
+	if nested, ok := input["keys"].(map[string]interface{}); ok {
+		keys = nested
+	}
+	ps.Auth, _ = keys["auth"].(string)
+	ps.P256dh, _ = keys["p256dh"].(string)
+	ps.Endpoint, _ = input["endpoint"].(string)
+	if dateInsert, ok := input["date_insert"].(string); ok {
+		ps.DateInsert, _ = time.Parse(time.RFC3339Nano, dateInsert)
+	}
+	if ps.Endpoint == "" || ps.Auth == "" || ps.P256dh == "" {
+		return errors.New("[PushSubscription] endpoint, auth and p256dh are mandatory")
+	}
+	return nil
+}
+
 func (d *Device) UnmarshalJSON(b []byte) error {
 	input := map[string]interface{}{}
 	if err := json.Unmarshal(b, &input); err != nil {
@@ -19,6 +19,7 @@ type (
 	Email struct {
 		SmtpMailFrom []string     // from or for the smtp agent
 		SmtpRcpTo    []string     // from or for the smtp agent
+		EnvelopeId   string       // ENVID sent to the smtp agent, given back by delivery status notifications
 		Raw          bytes.Buffer // raw email (without the Bcc header)
 		ImapUid      uint32       // optional uid fetched from remote imap account
 		//TODO: add more infos from mta
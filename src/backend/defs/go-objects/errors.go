@@ -84,6 +84,8 @@ const (
 	ForbiddenCaliopenErr
 	NotImplementedCaliopenErr
 	WrongCredentialsErr
+	TooManyRequestsCaliopenErr
+	PreconditionFailedCaliopenErr
 
 	DuplicateMessage = "message already imported for this user" // error message sent by delivery.py via nats
 )
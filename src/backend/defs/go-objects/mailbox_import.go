@@ -0,0 +1,40 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import "time"
+
+// MailboxImport is the import of an uploaded mailbox file into user's messages, for one of user's identities.
+// Messages are delivered by an IMAP worker, which reports progress back to api.
+type MailboxImport struct {
+	DateInsert time.Time `json:"date_insert"`
+	DateUpdate time.Time `json:"date_update"`
+	Duplicates int       `json:"duplicates"` // messages already imported for identity
+	Errors     []string  `json:"errors,omitempty"`
+	Failed     int       `json:"failed"`
+	Format     string    `json:"format"`
+	IdentityId string    `json:"identity_id"`
+	ImportId   string    `json:"import_id"`
+	Imported   int       `json:"imported"`
+	Status     string    `json:"status"`
+	Uri        string    `json:"uri"` // where uploaded file is stored in object store until import is over
+	UserId     string    `json:"user_id"`
+}
+
+const (
+	MailboxFormatMbox = "mbox" // messages concatenated in a single file (mboxo or mboxrd)
+	MailboxFormatZip  = "zip"  // zipped Maildir or set of .eml files
+	MailboxFormatEml  = "eml"  // a single message
+
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// Finished returns true if worker will not update import anymore
+func (mi *MailboxImport) Finished() bool {
+	return mi.Status == ImportDone || mi.Status == ImportFailed
+}
@@ -29,6 +29,7 @@ type Message struct {
 	Date_delete         time.Time          `cql:"date_delete"              json:"date_delete,omitempty"                                     formatter:"RFC3339Milli"`
 	Date_insert         time.Time          `cql:"date_insert"              json:"date_insert"                                               formatter:"RFC3339Milli"`
 	Date_sort           time.Time          `cql:"date_sort"                json:"date_sort"                                                 formatter:"RFC3339Milli"`
+	Delivery_status     []DeliveryStatus   `cql:"delivery_status"          json:"delivery_status,omitempty"`
 	Discussion_id       UUID               `cql:"discussion_id"            json:"discussion_id,omitempty"                                   formatter:"rfc4122"`
 	External_references ExternalReferences `cql:"external_references"      json:"external_references,omitempty"`
 	UserIdentities      []UUID             `cql:"user_identities"          json:"user_identities,omitempty"       `
@@ -44,6 +45,7 @@ type Message struct {
 	Privacy_features    *PrivacyFeatures   `cql:"privacy_features"         json:"privacy_features,omitempty" `
 	PrivacyIndex        *PrivacyIndex      `cql:"pi"                       json:"pi,omitempty"`
 	Raw_msg_id          UUID               `cql:"raw_msg_id"               json:"raw_msg_id,omitempty"                                      formatter:"rfc4122"`
+	Send_at             time.Time          `cql:"send_at"                  json:"send_at,omitempty"                                         formatter:"RFC3339Milli"`
 	Subject             string             `cql:"subject"                  json:"subject"          `
 	Tags                []string           `cql:"tagnames"                 json:"tags,omitempty"                     patch:"system" `
 	Protocol            string             `cql:"protocol"                 json:"protocol,omitempty"             `
@@ -181,6 +183,15 @@ func (msg *Message) UnmarshalMap(input map[string]interface{}) error {
 	if date, ok := input["date_sort"]; ok && date != nil {
 		msg.Date_sort, _ = time.Parse(time.RFC3339Nano, date.(string))
 	}
+	if delivery, ok := input["delivery_status"]; ok && delivery != nil {
+		msg.Delivery_status = []DeliveryStatus{}
+		for _, status := range delivery.([]interface{}) {
+			ds := DeliveryStatus{}
+			if err := ds.UnmarshalMap(status.(map[string]interface{})); err == nil {
+				msg.Delivery_status = append(msg.Delivery_status, ds)
+			}
+		}
+	}
 	if discussion_id, ok := input["discussion_id"].(string); ok {
 		if id, err := uuid.FromString(discussion_id); err == nil {
 			msg.Discussion_id.UnmarshalBinary(id.Bytes())
@@ -256,6 +267,9 @@ func (msg *Message) UnmarshalMap(input map[string]interface{}) error {
 			msg.Raw_msg_id.UnmarshalBinary(id.Bytes())
 		}
 	}
+	if date, ok := input["send_at"]; ok && date != nil {
+		msg.Send_at, _ = time.Parse(time.RFC3339Nano, date.(string))
+	}
 	if subject, ok := input["subject"].(string); ok {
 		msg.Subject = subject
 	}
@@ -313,6 +327,15 @@ func (msg *Message) UnmarshalCQLMap(input map[string]interface{}) error {
 	if date_sort, ok := input["date_sort"].(time.Time); ok {
 		msg.Date_sort = date_sort
 	}
+	if delivery, ok := input["delivery_status"]; ok && delivery != nil {
+		msg.Delivery_status = []DeliveryStatus{}
+		for _, status := range delivery.([]map[string]interface{}) {
+			ds := DeliveryStatus{}
+			if err := ds.UnmarshalCQLMap(status); err == nil {
+				msg.Delivery_status = append(msg.Delivery_status, ds)
+			}
+		}
+	}
 	if discussion_id, ok := input["discussion_id"].(gocql.UUID); ok {
 		msg.Discussion_id.UnmarshalBinary(discussion_id.Bytes())
 	}
@@ -400,6 +423,9 @@ func (msg *Message) UnmarshalCQLMap(input map[string]interface{}) error {
 	if raw_msg_id, ok := input["raw_msg_id"].(gocql.UUID); ok {
 		msg.Raw_msg_id.UnmarshalBinary(raw_msg_id.Bytes())
 	}
+	if send_at, ok := input["send_at"].(time.Time); ok {
+		msg.Send_at = send_at
+	}
 	if subject, ok := input["subject"].(string); ok {
 		msg.Subject = subject
 	}
@@ -23,6 +23,7 @@ type Ack struct {
 type WorkerRequest struct {
 	Worker string      `json:"worker"`
 	Order  BrokerOrder `json:"order"`
+	Error  string      `json:"error,omitempty"` // optional reason sent along with a "job_failed" order
 }
 
 // model to send messages to idpoller
@@ -32,6 +33,8 @@ type RemoteIDNatsMessage struct {
 	OrderParam string `json:"order_param"`
 	Protocol   string `json:"protocol"`
 	UserId     string `json:"user_id"`
+	// optional sync schedule infos (pollinterval, pollcron, pollwindows, polltimezone) for "add" and "update_schedule" orders
+	Infos map[string]string `json:"infos,omitempty"`
 }
 
 // model for orders sent to workers
@@ -40,6 +43,7 @@ type BrokerOrder struct {
 	Order      string `json:"order"`
 	IdentityId string `json:"identity_id"`
 	UserId     string `json:"user_id"`
+	JobId      string `json:"job_id,omitempty"` // set by idpoller on dispatched jobs, workers must ack it when job is done
 }
 
 // IMAPorder is a BrokerOrder variant for imap
@@ -47,9 +51,15 @@ type IMAPorder struct {
 	Order      string `json:"order"`
 	IdentityId string `json:"identity_id"`
 	UserId     string `json:"user_id"`
+	// optional field sent by api to push a message's flags to remote
+	MessageId string `json:"message_id,omitempty"`
+	// optional field set by idpoller on dispatched jobs
+	JobId string `json:"job_id,omitempty"`
 	// optional fields sent by imapctl
 	Login    string `json:"login"`
 	Mailbox  string `json:"mailbox"`
 	Password string `json:"password"`
 	Server   string `json:"server"`
+	// optional field sent by api to import an uploaded mailbox
+	Import *MailboxImport `json:"import,omitempty"`
 }
@@ -11,3 +11,37 @@ func (pf *PrivacyFeatures) UnmarshalMap(input map[string]interface{}) {
 		(*pf)[k] = v.(string)
 	}
 }
+
+// privacy features of messages' PGP signature, as verified by email broker
+const (
+	FeatureMessageSigned          = "message_signed" // "True" only if signature has been verified
+	FeatureMessageSignatureType   = "message_signature_type"
+	FeatureMessageSignatureStatus = "message_signature_status"
+	FeatureMessageSigner          = "message_signer"             // key id of signature's issuer
+	FeatureMessageSignerPrint     = "message_signer_fingerprint" // fingerprint of verified signer's primary key
+
+	SignatureTypePGPMIME   = "PGP/MIME"
+	SignatureTypeInlinePGP = "inline-PGP"
+
+	SignatureVerified   = "verified"      // signed with one of sender contact's trusted keys
+	SignatureUnknownKey = "unknown_key"   // no trusted key of sender contact issued the signature
+	SignatureBad        = "bad_signature" // signature doesn't match content, or is malformed
+	SignaturePartial    = "partial"       // verified signature of a text surrounded by unsigned text
+)
+
+// privacy features of sender authentication, as checked by smtp server at receive time
+const (
+	FeatureTransportSigned = "transport_signed" // "True" only if a DKIM signature has been verified
+	FeatureTransportSPF    = "transport_spf"
+	FeatureTransportDKIM   = "transport_dkim"
+	FeatureTransportDMARC  = "transport_dmarc"
+
+	// results of SPF, DKIM and DMARC checks, see https://tools.ietf.org/html/rfc8601
+	AuthNone      = "none"
+	AuthPass      = "pass"
+	AuthFail      = "fail"
+	AuthSoftFail  = "softfail"
+	AuthNeutral   = "neutral"
+	AuthTempError = "temperror"
+	AuthPermError = "permerror"
+)
@@ -0,0 +1,111 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+// UserPurge tracks the progress of the purge of a deleted user's data.
+// Purge goes through PurgeSteps in order, and could be resumed from the last completed step.
+type UserPurge struct {
+	Counts     map[string]int `cql:"counts"          json:"counts"`   // resources removed by each step
+	DateEnd    time.Time      `cql:"date_end"        json:"date_end"` // zero until purge is completed
+	DateStart  time.Time      `cql:"date_start"      json:"date_start"`
+	DateUpdate time.Time      `cql:"date_update"     json:"date_update"`
+	LastError  string         `cql:"last_error"      json:"last_error"`  // error that interrupted purge, if any
+	LeaseUntil time.Time      `cql:"lease_until"     json:"lease_until"` // purge is being processed by a worker until this date
+	Step       string         `cql:"step"            json:"step"`        // next step to process
+	UserId     UUID           `cql:"user_id"         json:"user_id"`
+}
+
+const (
+	PurgeStepSessions    = "sessions"    // cached sessions and tokens
+	PurgeStepIdentities  = "identities"  // local and remote identities, with their credentials and pollers' jobs
+	PurgeStepIndex       = "index"       // indexed messages and contacts
+	PurgeStepMessages    = "messages"    // messages, raw messages and objects
+	PurgeStepContacts    = "contacts"    // contacts, their public keys and Autocrypt peers
+	PurgeStepDiscussions = "discussions" // discussions and their lookups
+	PurgeStepDevices     = "devices"     // devices, locations and connection logs
+	PurgeStepAccount     = "account"     // settings, tags, saved searches, notifications, and user's personal data
+	PurgeStepDone        = "done"
+)
+
+// PurgeSteps lists purge steps in the order they must be processed.
+// Identities go first to stop receiving messages for user.
+var PurgeSteps = []string{
+	PurgeStepSessions,
+	PurgeStepIdentities,
+	PurgeStepIndex,
+	PurgeStepMessages,
+	PurgeStepContacts,
+	PurgeStepDiscussions,
+	PurgeStepDevices,
+	PurgeStepAccount,
+}
+
+// NewUserPurge returns a purge that starts at first step
+func NewUserPurge(userId UUID, now time.Time) *UserPurge {
+	return &UserPurge{
+		Counts:     map[string]int{},
+		DateStart:  now,
+		DateUpdate: now,
+		Step:       PurgeSteps[0],
+		UserId:     userId,
+	}
+}
+
+// Completed returns true if all steps have been processed
+func (up *UserPurge) Completed() bool {
+	return up.Step == PurgeStepDone
+}
+
+// RemainingSteps returns steps left to process, current one included
+func (up *UserPurge) RemainingSteps() []string {
+	for i, step := range PurgeSteps {
+		if step == up.Step {
+			return PurgeSteps[i:]
+		}
+	}
+	return []string{}
+}
+
+// StepDone records count of resources removed by step and moves purge forward to next step
+func (up *UserPurge) StepDone(step string, count int, now time.Time) {
+	if up.Counts == nil {
+		up.Counts = map[string]int{}
+	}
+	up.Counts[step] += count
+	up.DateUpdate = now
+	up.LastError = ""
+	up.Step = PurgeStepDone
+	for i, s := range PurgeSteps {
+		if s == step && i+1 < len(PurgeSteps) {
+			up.Step = PurgeSteps[i+1]
+		}
+	}
+	if up.Step == PurgeStepDone {
+		up.DateEnd = now
+	}
+}
+
+// unmarshal a map[string]interface{} that must owns all UserPurge's fields
+// typical usage is for unmarshaling response from Cassandra backend
+func (up *UserPurge) UnmarshalCQLMap(input map[string]interface{}) {
+	up.Counts = map[string]int{}
+	if counts, ok := input["counts"].(map[string]int); ok {
+		up.Counts = counts
+	}
+	up.DateEnd, _ = input["date_end"].(time.Time)
+	up.DateStart, _ = input["date_start"].(time.Time)
+	up.DateUpdate, _ = input["date_update"].(time.Time)
+	up.LastError, _ = input["last_error"].(string)
+	up.LeaseUntil, _ = input["lease_until"].(time.Time)
+	up.Step, _ = input["step"].(string)
+	if userId, ok := input["user_id"].(gocql.UUID); ok {
+		up.UserId.UnmarshalBinary(userId.Bytes())
+	}
+}
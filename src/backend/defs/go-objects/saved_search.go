@@ -0,0 +1,178 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gocql/gocql"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// SavedSearch is a named advanced search over user's messages, used as a smart folder.
+// Inbound messages matching a saved search are tagged with its AutoTag, if any.
+type SavedSearch struct {
+	AutoTag    string      `cql:"auto_tag"      json:"auto_tag"      patch:"user"` // name of a user's tag
+	DateInsert time.Time   `cql:"date_insert"   json:"date_insert"`
+	DateUpdate time.Time   `cql:"date_update"   json:"date_update"`
+	Filters    SearchQuery `cql:"filters"       json:"filters"       patch:"user"` // stored as JSON
+	Name       string      `cql:"name"          json:"name"          patch:"user"`
+	Query      string      `cql:"query"         json:"query"         patch:"user"` // see ParseSearchQuery
+	SearchId   UUID        `cql:"search_id"     json:"search_id"     formatter:"rfc4122"`
+	UserId     UUID        `cql:"user_id"       json:"user_id"       formatter:"rfc4122"`
+}
+
+// Clauses returns the clauses of search's query followed by its filters
+func (ss *SavedSearch) Clauses() (SearchQuery, error) {
+	clauses, err := ParseSearchQuery(ss.Query)
+	if err != nil {
+		return nil, err
+	}
+	filters := ss.Filters.Normalized()
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	return append(clauses, filters...), nil
+}
+
+// Validate checks that search is named and has valid clauses
+func (ss *SavedSearch) Validate() error {
+	if ss.Name == "" {
+		return errors.New("saved search's name is empty")
+	}
+	clauses, err := ss.Clauses()
+	if err != nil {
+		return err
+	}
+	if len(clauses) == 0 {
+		return errors.New("saved search has neither query nor filters")
+	}
+	return nil
+}
+
+// IndexSearch returns the search of messages matching saved search for user
+func (ss *SavedSearch) IndexSearch(user *UserInfo) (search IndexSearch, err error) {
+	search = IndexSearch{
+		DocType: MessageIndexType,
+		ILrange: [2]int8{-10, 10},
+	}
+	search.Query, err = ss.Clauses()
+	if err != nil {
+		return
+	}
+	if id, e := uuid.FromString(user.User_id); e == nil {
+		search.User_id.UnmarshalBinary(id.Bytes())
+	}
+	search.Shard_id = user.Shard_id
+	return
+}
+
+func (ss *SavedSearch) MarshalFrontEnd() ([]byte, error) {
+	return json.Marshal(ss)
+}
+
+// UnmarshalMap is used when unmarshalling a JSON to a SavedSearch
+// it lazily ignores missing fields, or unknown fields found in input map.
+func (ss *SavedSearch) UnmarshalMap(input map[string]interface{}) error {
+	if tag, ok := input["auto_tag"].(string); ok {
+		ss.AutoTag = tag
+	}
+	if date, ok := input["date_insert"].(string); ok {
+		ss.DateInsert, _ = time.Parse(time.RFC3339Nano, date)
+	}
+	if date, ok := input["date_update"].(string); ok {
+		ss.DateUpdate, _ = time.Parse(time.RFC3339Nano, date)
+	}
+	if filters, ok := input["filters"]; ok {
+		// round trip through JSON to type clauses
+		j, err := json.Marshal(filters)
+		if err != nil {
+			return err
+		}
+		ss.Filters = SearchQuery{}
+		if err := json.Unmarshal(j, &ss.Filters); err != nil {
+			return err
+		}
+	}
+	if name, ok := input["name"].(string); ok {
+		ss.Name = name
+	}
+	if query, ok := input["query"].(string); ok {
+		ss.Query = query
+	}
+	if id, ok := input["search_id"].(string); ok {
+		if id, err := uuid.FromString(id); err == nil {
+			ss.SearchId.UnmarshalBinary(id.Bytes())
+		}
+	}
+	if id, ok := input["user_id"].(string); ok {
+		if id, err := uuid.FromString(id); err == nil {
+			ss.UserId.UnmarshalBinary(id.Bytes())
+		}
+	}
+	return nil
+}
+
+// unmarshal a map[string]interface{} that must owns all SavedSearch's fields
+// typical usage is for unmarshaling response from Cassandra backend
+func (ss *SavedSearch) UnmarshalCQLMap(input map[string]interface{}) {
+	ss.AutoTag, _ = input["auto_tag"].(string)
+	ss.DateInsert, _ = input["date_insert"].(time.Time)
+	ss.DateUpdate, _ = input["date_update"].(time.Time)
+	ss.Filters = SearchQuery{}
+	if filters, ok := input["filters"].(string); ok && filters != "" {
+		json.Unmarshal([]byte(filters), &ss.Filters)
+	}
+	ss.Name, _ = input["name"].(string)
+	ss.Query, _ = input["query"].(string)
+	if id, ok := input["search_id"].(gocql.UUID); ok {
+		ss.SearchId.UnmarshalBinary(id.Bytes())
+	}
+	if id, ok := input["user_id"].(gocql.UUID); ok {
+		ss.UserId.UnmarshalBinary(id.Bytes())
+	}
+}
+
+func (ss *SavedSearch) UnmarshalJSON(b []byte) error {
+	input := map[string]interface{}{}
+	if err := json.Unmarshal(b, &input); err != nil {
+		return err
+	}
+	return ss.UnmarshalMap(input)
+}
+
+// implementation of the CaliopenObject interface
+func (ss *SavedSearch) NewEmpty() interface{} {
+	return new(SavedSearch)
+}
+
+// an UUID should be provided to fill UserId with
+func (ss *SavedSearch) MarshallNew(args ...interface{}) {
+	if len(args) == 1 {
+		if userId, ok := args[0].(UUID); ok && ss.UserId == EmptyUUID {
+			ss.UserId = userId
+		}
+	}
+	if ss.SearchId == EmptyUUID {
+		ss.SearchId.UnmarshalBinary(uuid.NewV4().Bytes())
+	}
+	if ss.Filters == nil {
+		ss.Filters = SearchQuery{}
+	}
+	if ss.DateInsert.IsZero() {
+		ss.DateInsert = time.Now()
+	}
+	ss.DateUpdate = time.Now()
+}
+
+// part of ObjectPatchable interface
+func (ss *SavedSearch) JsonTags() map[string]string {
+	return jsonTags(ss)
+}
+
+func (ss *SavedSearch) SortSlices() {
+	// filters' order is meaningful
+}
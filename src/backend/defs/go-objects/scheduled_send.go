@@ -0,0 +1,15 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import "time"
+
+// ScheduledSend references a draft waiting to be sent at a given time
+type ScheduledSend struct {
+	Attempts  int // failed attempts to send draft
+	MessageId string
+	SendAt    time.Time
+	UserId    string
+}
@@ -17,6 +17,7 @@ type IndexSearch struct {
 	User_id  UUID                `json:"user_id"`
 	DocType  string              `json:"doc_type"`
 	ILrange  [2]int8             `json:"il_range"`
+	Query    SearchQuery         `json:"query,omitempty"` // advanced search clauses, see ParseSearchQuery
 }
 
 type IndexResult struct {
@@ -60,14 +61,21 @@ func (is *IndexSearch) FilterQuery(service *elastic.SearchService, withIL bool)
 	return service
 }
 
-func (is *IndexSearch) MatchQuery(service *elastic.SearchService) *elastic.SearchService {
-
-	if len(is.Terms) == 0 {
-		return service
+// MatchQuery composes a full text query from search's Terms,
+// making use of "common terms query" (see https://www.elastic.co/guide/en/elasticsearch/reference/5.4/query-dsl-common-terms-query.html),
+// and adds advanced search's clauses to it.
+func (is *IndexSearch) MatchQuery() *elastic.BoolQuery {
+	q := elastic.NewBoolQuery()
+	// Strictly filter on user_id
+	q = q.Filter(elastic.NewTermQuery("user_id", is.User_id))
+	for field, value := range is.Terms {
+		q = q.Should(elastic.NewCommonTermsQuery(field, value).CutoffFrequency(0.01)) //words that have a document frequency greater than 1% will be treated as common terms.
+		// always add the common fields below to improve results
+		for _, common := range FullTextSearchFields {
+			q = q.Should(elastic.NewCommonTermsQuery(common, value).CutoffFrequency(0.01))
+		}
 	}
-	//TODO
-
-	return service
+	return is.Query.AddTo(q)
 }
 
 func (ir *IndexResult) MarshalFrontEnd() ([]byte, error) {
@@ -0,0 +1,417 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"fmt"
+	"gopkg.in/olivere/elastic.v5"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// fields of the advanced search query language, as in `from:alice is:unread -tag:spam pi>50 "exact phrase"`
+const (
+	SearchFieldText     = "" // full text clause, without field
+	SearchFieldFrom     = "from"
+	SearchFieldTo       = "to"
+	SearchFieldSubject  = "subject"
+	SearchFieldHas      = "has"
+	SearchFieldTag      = "tag"
+	SearchFieldIs       = "is"
+	SearchFieldBefore   = "before"
+	SearchFieldAfter    = "after"
+	SearchFieldProtocol = "protocol"
+	SearchFieldPI       = "pi"
+
+	searchDateLayout = "2006-01-02"
+)
+
+// searchFields are the fields recognized within a query string
+var searchFields = map[string]bool{
+	SearchFieldFrom:     true,
+	SearchFieldTo:       true,
+	SearchFieldSubject:  true,
+	SearchFieldHas:      true,
+	SearchFieldTag:      true,
+	SearchFieldIs:       true,
+	SearchFieldBefore:   true,
+	SearchFieldAfter:    true,
+	SearchFieldProtocol: true,
+	SearchFieldPI:       true,
+}
+
+// FullTextSearchFields are the documents' fields searched by full text clauses
+var FullTextSearchFields = []string{
+	"body_plain", "body_plain.normalized",
+	"body_html", "body_html.normalized",
+	"subject", "subject.normalized",
+	"given_name", "given_name.normalized",
+	"family_name", "family_name.normalized",
+}
+
+// boolean fields of messages matched by `is:` clauses, with the value they must have
+var searchIsValues = map[string]struct {
+	field string
+	value bool
+}{
+	"unread":   {"is_unread", true},
+	"read":     {"is_unread", false},
+	"draft":    {"is_draft", true},
+	"answered": {"is_answered", true},
+	"received": {"is_received", true},
+}
+
+type (
+	// SearchClause is one criterion of an advanced search.
+	// Operator is ":" for every field but pi, which is compared with ">", ">=", "<", "<=" or "=".
+	SearchClause struct {
+		Field    string `json:"field,omitempty"`
+		Operator string `json:"operator,omitempty"`
+		Value    string `json:"value"`
+		Phrase   bool   `json:"phrase,omitempty"` // value is matched as a whole, not word by word
+		Negated  bool   `json:"negated,omitempty"`
+	}
+
+	// SearchQuery is a list of clauses that documents must all match
+	SearchQuery []SearchClause
+
+	// SearchQueryError tells why a query or a clause is invalid, and where in the query if it has been parsed
+	SearchQueryError struct {
+		Offset int
+		Reason string
+	}
+)
+
+func (e *SearchQueryError) Error() string {
+	if e.Offset < 0 {
+		return "invalid search clause : " + e.Reason
+	}
+	return fmt.Sprintf("invalid search query at offset %d : %s", e.Offset, e.Reason)
+}
+
+// ParseSearchQuery parses an advanced search query made of space separated clauses :
+// words or "quoted phrases" to search as full text, field:value or field:"quoted value" filters,
+// pi comparisons like pi>50, each of them negated if prefixed by '-'.
+// Words prefixed by an unknown field name, like `re:meeting`, are searched as full text.
+func ParseSearchQuery(query string) (SearchQuery, error) {
+	clauses := SearchQuery{}
+	runes := []rune(query)
+	i := 0
+	for {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return clauses, nil
+		}
+		start := i
+		clause := SearchClause{}
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			clause.Negated = true
+			i++
+		}
+		// field name, if any : unknown names are part of a full text term, as in `re:meeting` or `http://…`
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || runes[j] == '_') {
+			j++
+		}
+		if j > i && j < len(runes) && searchFields[strings.ToLower(string(runes[i:j]))] {
+			for _, op := range []string{":", ">=", "<=", ">", "<", "="} {
+				if strings.HasPrefix(string(runes[j:]), op) {
+					clause.Field = strings.ToLower(string(runes[i:j]))
+					clause.Operator = op
+					i = j + len([]rune(op))
+					break
+				}
+			}
+		}
+		// value
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &SearchQueryError{i, "unterminated quoted phrase"}
+			}
+			clause.Value = strings.TrimSpace(string(runes[i+1 : end]))
+			clause.Phrase = true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			clause.Value = string(runes[i:end])
+			i = end
+		}
+		if err := clause.Validate(); err != nil {
+			return nil, &SearchQueryError{start, err.(*SearchQueryError).Reason}
+		}
+		clauses = append(clauses, clause)
+	}
+}
+
+// Validate checks that clause's field, operator and value are consistent
+func (c SearchClause) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return &SearchQueryError{-1, fmt.Sprintf(format, args...)}
+	}
+	if c.Value == "" {
+		if c.Field == SearchFieldText {
+			return invalid("empty search term")
+		}
+		return invalid("missing value for %s", c.Field)
+	}
+	if c.Field == SearchFieldPI {
+		switch c.Operator {
+		case ">", ">=", "<", "<=", "=":
+		default:
+			return invalid("pi must be compared with >, >=, <, <= or =")
+		}
+		if n, err := strconv.Atoi(c.Value); err != nil || n < 0 || n > 100 {
+			return invalid("pi must be compared to an integer between 0 and 100")
+		}
+		return nil
+	}
+	if c.Field == SearchFieldText {
+		if c.Operator != "" {
+			return invalid("unexpected operator %s without field", c.Operator)
+		}
+		return nil
+	}
+	if c.Operator != ":" {
+		return invalid("%s must be followed by ':'", c.Field)
+	}
+	switch c.Field {
+	case SearchFieldFrom, SearchFieldTo, SearchFieldSubject, SearchFieldTag:
+	case SearchFieldProtocol:
+		if c.Phrase {
+			return invalid("protocol can't be a phrase")
+		}
+	case SearchFieldHas:
+		if c.Value != "attachment" && c.Value != "attachments" {
+			return invalid("unknown has:%s, only has:attachment is supported", c.Value)
+		}
+	case SearchFieldIs:
+		if _, known := searchIsValues[c.Value]; !known {
+			return invalid("unknown is:%s, expected one of unread, read, draft, answered or received", c.Value)
+		}
+	case SearchFieldBefore, SearchFieldAfter:
+		if _, err := parseSearchDate(c.Value); err != nil {
+			return invalid("%s expects a YYYY-MM-DD or RFC3339 date", c.Field)
+		}
+	default:
+		return invalid("unknown field %s", c.Field)
+	}
+	return nil
+}
+
+// Normalized returns a copy of structured clauses with lower case fields, and ':' operator when omitted
+func (sq SearchQuery) Normalized() SearchQuery {
+	normalized := make(SearchQuery, len(sq))
+	for i, clause := range sq {
+		clause.Field = strings.ToLower(clause.Field)
+		if clause.Operator == "" && clause.Field != SearchFieldText && clause.Field != SearchFieldPI {
+			clause.Operator = ":"
+		}
+		normalized[i] = clause
+	}
+	return normalized
+}
+
+// Validate checks every clause of query
+func (sq SearchQuery) Validate() error {
+	for _, clause := range sq {
+		if err := clause.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTo adds query's clauses to a bool query : filters on documents' properties and full text matches.
+// Clauses must have been validated.
+func (sq SearchQuery) AddTo(q *elastic.BoolQuery) *elastic.BoolQuery {
+	for _, clause := range sq {
+		query, isFilter := clause.esQuery()
+		switch {
+		case clause.Negated:
+			q = q.MustNot(query)
+		case isFilter:
+			q = q.Filter(query)
+		default:
+			q = q.Must(query)
+		}
+	}
+	return q
+}
+
+// esQuery returns the ES query matching clause, and whether it should be used as a filter (without scoring)
+func (c SearchClause) esQuery() (elastic.Query, bool) {
+	switch c.Field {
+	case SearchFieldFrom:
+		return participantsQuery(c, ParticipantFrom), false
+	case SearchFieldTo:
+		return participantsQuery(c, ParticipantTo, ParticipantCC, ParticipantBcc), false
+	case SearchFieldSubject:
+		if c.Phrase {
+			return elastic.NewMatchPhraseQuery("subject", c.Value), false
+		}
+		return elastic.NewMatchQuery("subject", c.Value).Operator("and"), false
+	case SearchFieldHas:
+		return elastic.NewNestedQuery("attachments", elastic.NewExistsQuery("attachments.content_type")), true
+	case SearchFieldTag:
+		return elastic.NewTermQuery("tags", c.Value), true
+	case SearchFieldIs:
+		is := searchIsValues[c.Value]
+		return elastic.NewTermQuery(is.field, is.value), true
+	case SearchFieldBefore:
+		date, _ := parseSearchDate(c.Value)
+		return elastic.NewRangeQuery("date_sort").Lt(date.Format(time.RFC3339)), true
+	case SearchFieldAfter:
+		date, _ := parseSearchDate(c.Value)
+		return elastic.NewRangeQuery("date_sort").Gte(date.Format(time.RFC3339)), true
+	case SearchFieldProtocol:
+		return elastic.NewTermQuery("protocol", strings.ToLower(c.Value)), true
+	case SearchFieldPI:
+		// pi is the mean of its technic, comportment and context components, as displayed to user
+		limit, _ := strconv.Atoi(c.Value)
+		op := c.Operator
+		if op == "=" {
+			op = "=="
+		}
+		script := elastic.NewScript("doc['pi.technic'].value + doc['pi.comportment'].value + doc['pi.context'].value "+op+" params.limit * 3").
+			Lang("painless").
+			Param("limit", limit)
+		return elastic.NewScriptQuery(script), true
+	}
+	query := elastic.NewMultiMatchQuery(c.Value, FullTextSearchFields...)
+	if c.Phrase {
+		return query.Type("phrase"), false
+	}
+	return query.Operator("and"), false
+}
+
+// participantsQuery matches documents having a participant of one of types whose address or label matches clause
+func participantsQuery(c SearchClause, types ...string) elastic.Query {
+	values := make([]interface{}, len(types))
+	for i, t := range types {
+		values[i] = t
+	}
+	match := elastic.NewMultiMatchQuery(c.Value, "participants.address", "participants.address.parts", "participants.label")
+	if c.Phrase {
+		match = match.Type("phrase")
+	} else {
+		match = match.Operator("and")
+	}
+	return elastic.NewNestedQuery("participants", elastic.NewBoolQuery().
+		Filter(elastic.NewTermsQuery("participants.type", values...)).
+		Must(match))
+}
+
+// MatchMessage evaluates query's clauses against a message, without index.
+// Full text clauses are matched word by word on message's subject and bodies, ignoring case.
+// Clauses must have been validated.
+func (sq SearchQuery) MatchMessage(msg *Message) bool {
+	for _, clause := range sq {
+		if clause.matchMessage(msg) == clause.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (c SearchClause) matchMessage(msg *Message) bool {
+	switch c.Field {
+	case SearchFieldFrom, SearchFieldTo:
+		types := map[string]bool{ParticipantFrom: true}
+		if c.Field == SearchFieldTo {
+			types = map[string]bool{ParticipantTo: true, ParticipantCC: true, ParticipantBcc: true}
+		}
+		for _, participant := range msg.Participants {
+			if types[participant.Type] && c.matchText(participant.Address, participant.Label) {
+				return true
+			}
+		}
+		return false
+	case SearchFieldSubject:
+		return c.matchText(msg.Subject)
+	case SearchFieldHas:
+		return len(msg.Attachments) > 0
+	case SearchFieldTag:
+		for _, tag := range msg.Tags {
+			if tag == c.Value {
+				return true
+			}
+		}
+		return false
+	case SearchFieldIs:
+		is := searchIsValues[c.Value]
+		value := map[string]bool{
+			"is_unread":   msg.Is_unread,
+			"is_draft":    msg.Is_draft,
+			"is_answered": msg.Is_answered,
+			"is_received": msg.Is_received,
+		}[is.field]
+		return value == is.value
+	case SearchFieldBefore:
+		date, _ := parseSearchDate(c.Value)
+		return msg.Date_sort.Before(date)
+	case SearchFieldAfter:
+		date, _ := parseSearchDate(c.Value)
+		return !msg.Date_sort.Before(date)
+	case SearchFieldProtocol:
+		return strings.EqualFold(msg.Protocol, c.Value)
+	case SearchFieldPI:
+		limit, _ := strconv.Atoi(c.Value)
+		sum := 0
+		if msg.PrivacyIndex != nil {
+			sum = msg.PrivacyIndex.Technic + msg.PrivacyIndex.Comportment + msg.PrivacyIndex.Context
+		}
+		switch c.Operator {
+		case ">":
+			return sum > limit*3
+		case ">=":
+			return sum >= limit*3
+		case "<":
+			return sum < limit*3
+		case "<=":
+			return sum <= limit*3
+		}
+		return sum == limit*3
+	}
+	return c.matchText(msg.Subject, msg.Body_plain, msg.Body_html)
+}
+
+// matchText returns true if one of texts holds clause's phrase, or all of its words
+func (c SearchClause) matchText(texts ...string) bool {
+	for _, text := range texts {
+		text = strings.ToLower(text)
+		if c.Phrase {
+			if strings.Contains(strings.Join(strings.Fields(text), " "), strings.Join(strings.Fields(strings.ToLower(c.Value)), " ")) {
+				return true
+			}
+			continue
+		}
+		all := true
+		for _, word := range strings.Fields(strings.ToLower(c.Value)) {
+			all = all && strings.Contains(text, word)
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSearchDate(value string) (time.Time, error) {
+	if date, err := time.Parse(searchDateLayout, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,54 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := ParseSearchQuery(` hello  -"spam offer" To:"Bob Smith" -is:read pi<20 re:meeting -https://example.com `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SearchQuery{
+		{Value: "hello"},
+		{Value: "spam offer", Phrase: true, Negated: true},
+		{Field: SearchFieldTo, Operator: ":", Value: "Bob Smith", Phrase: true},
+		{Field: SearchFieldIs, Operator: ":", Value: "read", Negated: true},
+		{Field: SearchFieldPI, Operator: "<", Value: "20"},
+		{Value: "re:meeting"},
+		{Value: "https://example.com", Negated: true},
+	}
+	if len(query) != len(expected) {
+		t.Fatalf("expected %d clauses, got %+v", len(expected), query)
+	}
+	for i, clause := range query {
+		if clause != expected[i] {
+			t.Errorf("expected clause %d to be %+v, got %+v", i, expected[i], clause)
+		}
+	}
+
+	for _, invalid := range []struct {
+		query  string
+		offset int
+	}{
+		{`hello "unterminated`, 6},
+		{`from:`, 0},
+		{`hello is:starred`, 6},
+		{`has:photo`, 0},
+		{`before:yesterday`, 0},
+		{`pi>high`, 0},
+		{`pi:50`, 0},
+		{`pi>=101`, 0},
+		{`from>alice`, 0},
+		{`hello -tag:""`, 6},
+	} {
+		_, err := ParseSearchQuery(invalid.query)
+		if e, ok := err.(*SearchQueryError); !ok || e.Offset != invalid.offset {
+			t.Errorf("expected query %s to be invalid at offset %d, got %v", invalid.query, invalid.offset, err)
+		}
+	}
+}
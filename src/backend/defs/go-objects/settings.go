@@ -8,21 +8,39 @@ import (
 	"encoding/json"
 	"github.com/gocql/gocql"
 	"github.com/satori/go.uuid"
+	"time"
 )
 
 // user settings
 type Settings struct {
-	ContactDisplayFormat       string `cql:"contact_display_format"	json:"contact_display_format"`
-	ContactDisplayOrder        string `cql:"contact_display_order"	json:"contact_display_order"`
-	DefaultLocale              string `cql:"default_locale"      json:"default_locale"`
-	MessageDisplayFormat       string `cql:"message_display_format"	json:"message_display_format"`
-	NotificationDelayDisappear int    `cql:"notification_delay_disappear"	json:"notification_delay_disappear"`
-	NotificationEnabled        bool   `cql:"notification_enabled"	json:"notification_enabled"`
-	NotificationMessagePreview string `cql:"notification_message_preview"	json:"notification_message_preview"`
-	NotificationSoundEnabled   bool   `cql:"notification_sound_enabled"	json:"notification_sound_enabled"`
-	UserId                     UUID   `cql:"user_id"            json:"user_id"`
+	ContactDisplayFormat       string              `cql:"contact_display_format"	json:"contact_display_format"`
+	ContactDisplayOrder        string              `cql:"contact_display_order"	json:"contact_display_order"`
+	DefaultLocale              string              `cql:"default_locale"      json:"default_locale"`
+	MessageDisplayFormat       string              `cql:"message_display_format"	json:"message_display_format"`
+	NotificationChannels       map[string][]string `cql:"notification_channels"	json:"notification_channels"` // channels chosen by user for each kind of notification
+	NotificationDelayDisappear int                 `cql:"notification_delay_disappear"	json:"notification_delay_disappear"`
+	NotificationDigest         string              `cql:"notification_digest"	json:"notification_digest"`
+	NotificationEnabled        bool                `cql:"notification_enabled"	json:"notification_enabled"`
+	NotificationMessagePreview string              `cql:"notification_message_preview"	json:"notification_message_preview"`
+	NotificationQuietEnd       string              `cql:"notification_quiet_end"	json:"notification_quiet_end"`     // HH:MM in user's timezone
+	NotificationQuietStart     string              `cql:"notification_quiet_start"	json:"notification_quiet_start"` // HH:MM in user's timezone
+	NotificationSoundEnabled   bool                `cql:"notification_sound_enabled"	json:"notification_sound_enabled"`
+	NotificationTimezone       string              `cql:"notification_timezone"	json:"notification_timezone"` // IANA time zone name, UTC if empty
+	UserId                     UUID                `cql:"user_id"            json:"user_id"`
 }
 
+const (
+	// channels through which notifications can be issued
+	NotifChannelEmail = "email"
+	NotifChannelPush  = "push"
+	NotifChannelQueue = "queue"
+
+	// values for Settings.NotificationDigest
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
 // unmarshal a map[string]interface{} that must owns all Settings's fields
 // typical usage is for unmarshaling response from Cassandra backend
 func (s *Settings) UnmarshalCQLMap(input map[string]interface{}) {
@@ -34,6 +52,13 @@ func (s *Settings) UnmarshalCQLMap(input map[string]interface{}) {
 	s.NotificationEnabled = input["notification_enabled"].(bool)
 	s.NotificationSoundEnabled = input["notification_sound_enabled"].(bool)
 	s.NotificationMessagePreview = input["notification_message_preview"].(string)
+	if channels, ok := input["notification_channels"].(map[string][]string); ok {
+		s.NotificationChannels = channels
+	}
+	s.NotificationDigest, _ = input["notification_digest"].(string)
+	s.NotificationQuietEnd, _ = input["notification_quiet_end"].(string)
+	s.NotificationQuietStart, _ = input["notification_quiet_start"].(string)
+	s.NotificationTimezone, _ = input["notification_timezone"].(string)
 	userid, _ := input["user_id"].(gocql.UUID)
 	s.UserId.UnmarshalBinary(userid.Bytes())
 }
@@ -63,6 +88,31 @@ func (s *Settings) UnmarshalMap(input map[string]interface{}) error {
 	if notificationMessagePreview, ok := input["notification_message_preview"].(string); ok {
 		s.NotificationMessagePreview = notificationMessagePreview
 	}
+	if channels, ok := input["notification_channels"].(map[string]interface{}); ok {
+		s.NotificationChannels = map[string][]string{}
+		for kind, list := range channels {
+			if items, ok := list.([]interface{}); ok {
+				s.NotificationChannels[kind] = []string{}
+				for _, item := range items {
+					if channel, ok := item.(string); ok {
+						s.NotificationChannels[kind] = append(s.NotificationChannels[kind], channel)
+					}
+				}
+			}
+		}
+	}
+	if digest, ok := input["notification_digest"].(string); ok {
+		s.NotificationDigest = digest
+	}
+	if quietEnd, ok := input["notification_quiet_end"].(string); ok {
+		s.NotificationQuietEnd = quietEnd
+	}
+	if quietStart, ok := input["notification_quiet_start"].(string); ok {
+		s.NotificationQuietStart = quietStart
+	}
+	if timezone, ok := input["notification_timezone"].(string); ok {
+		s.NotificationTimezone = timezone
+	}
 	if userID, ok := input["user_id"].(string); ok {
 		if id, err := uuid.FromString(userID); err == nil {
 			s.UserId.UnmarshalBinary(id.Bytes())
@@ -87,3 +137,47 @@ func (*Settings) NewEmpty() interface{} {
 func (s *Settings) JsonTags() map[string]string {
 	return jsonTags(s)
 }
+
+// ChannelsFor returns channels chosen by user for this kind of notification,
+// or defaultChannels if user did not set any preference for it.
+func (s *Settings) ChannelsFor(kind string, defaultChannels []string) []string {
+	if channels, ok := s.NotificationChannels[kind]; ok {
+		return channels
+	}
+	return defaultChannels
+}
+
+// Location returns user's time zone, UTC if it is not set or unknown
+func (s *Settings) Location() *time.Location {
+	if s.NotificationTimezone != "" {
+		if loc, err := time.LoadLocation(s.NotificationTimezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// InQuietHours returns true if t is within user's quiet hours,
+// which may span midnight (ie 22:00 to 07:00)
+func (s *Settings) InQuietHours(t time.Time) bool {
+	start, okStart := minutesOfDay(s.NotificationQuietStart)
+	end, okEnd := minutesOfDay(s.NotificationQuietEnd)
+	if !okStart || !okEnd || start == end {
+		return false
+	}
+	local := t.In(s.Location())
+	now := local.Hour()*60 + local.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// minutesOfDay parses a HH:MM clock time
+func minutesOfDay(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
@@ -0,0 +1,208 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/robfig/cron.v2"
+	"strings"
+	"time"
+)
+
+// keys in UserIdentity.Infos to customize when a remote identity is synced.
+// If none of PollCronKey or PollWindowsKey is set, identity is synced every "pollinterval" minutes.
+const (
+	PollCronKey     = "pollcron"     // standard crontab spec (minute hour day-of-month month day-of-week) or descriptor like @hourly
+	PollWindowsKey  = "pollwindows"  // json list of SyncWindow. Identity is not synced outside windows.
+	PollTimezoneKey = "polltimezone" // IANA timezone (like Europe/Paris) for cron spec and windows. Default is UTC.
+
+	maxPollInterval = 3 * 24 * 60 // 3 days, in minutes
+)
+
+// actions users can request on a remote identity, see POST /identities/remotes/:remote_id/actions
+const (
+	SyncNowAction        = "sync"             // sync identity as soon as possible
+	FullFetchAction      = "full_fetch"       // fetch all messages from remote, regardless of sync state
+	ResetSyncStateAction = "reset_sync_state" // forget sync state, then sync identity from scratch
+)
+
+type (
+	// SyncWindow is a daily time range during which a remote identity is synced every Interval minutes
+	SyncWindow struct {
+		Days     []string `json:"days,omitempty"` // mon, tue, wed, thu, fri, sat, sun. Empty means everyday.
+		End      string   `json:"end"`            // HH:MM. If end is before start, window spans over midnight.
+		Interval int      `json:"interval"`       // in minutes
+		Start    string   `json:"start"`          // HH:MM
+	}
+
+	// SyncSchedule implements cron.Schedule interface for a remote identity,
+	// either from a cron spec or from a list of sync windows.
+	SyncSchedule struct {
+		cron     cron.Schedule
+		location *time.Location
+		windows  []syncWindow
+	}
+
+	syncWindow struct {
+		days     map[time.Weekday]bool // nil means everyday
+		end      time.Duration         // since midnight
+		interval time.Duration
+		start    time.Duration // since midnight
+	}
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// SyncScheduleInfos extracts from infos the keys related to sync scheduling
+func SyncScheduleInfos(infos map[string]string) map[string]string {
+	scheduleInfos := make(map[string]string)
+	for _, key := range []string{"pollinterval", PollCronKey, PollWindowsKey, PollTimezoneKey} {
+		if value, ok := infos[key]; ok {
+			scheduleInfos[key] = value
+		}
+	}
+	return scheduleInfos
+}
+
+// ParseSyncSchedule builds a SyncSchedule from remote identity's infos.
+// It returns a nil schedule if infos do not carry a cron spec nor sync windows,
+// and an error if cron spec, windows or timezone are invalid.
+func ParseSyncSchedule(infos map[string]string) (*SyncSchedule, error) {
+	cronSpec := strings.TrimSpace(infos[PollCronKey])
+	jsonWindows := strings.TrimSpace(infos[PollWindowsKey])
+	if cronSpec == "" && jsonWindows == "" {
+		return nil, nil
+	}
+	if cronSpec != "" && jsonWindows != "" {
+		return nil, fmt.Errorf("%s and %s are mutually exclusive", PollCronKey, PollWindowsKey)
+	}
+	schedule := &SyncSchedule{location: time.UTC}
+	if tz := infos[PollTimezoneKey]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s : %s", PollTimezoneKey, err)
+		}
+		schedule.location = loc
+	}
+
+	if cronSpec != "" {
+		if !strings.HasPrefix(cronSpec, "@") {
+			if len(strings.Fields(cronSpec)) != 5 {
+				return nil, fmt.Errorf("invalid %s : expected 5 fields (minute hour day-of-month month day-of-week)", PollCronKey)
+			}
+			// cron pkg expects seconds as first field
+			cronSpec = "TZ=" + schedule.location.String() + " 0 " + cronSpec
+		}
+		sched, err := cron.Parse(cronSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s : %s", PollCronKey, err)
+		}
+		schedule.cron = sched
+		return schedule, nil
+	}
+
+	windows := []SyncWindow{}
+	err := json.Unmarshal([]byte(jsonWindows), &windows)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s : %s", PollWindowsKey, err)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("invalid %s : at least one window is required", PollWindowsKey)
+	}
+	for i, window := range windows {
+		w, err := window.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s : window #%d : %s", PollWindowsKey, i, err)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+	return schedule, nil
+}
+
+func (window SyncWindow) parse() (w syncWindow, err error) {
+	if w.start, err = parseClock(window.Start); err != nil {
+		return
+	}
+	if w.end, err = parseClock(window.End); err != nil {
+		return
+	}
+	if window.Interval < 1 || window.Interval > maxPollInterval {
+		err = fmt.Errorf("interval must be between 1 and %d minutes", maxPollInterval)
+		return
+	}
+	w.interval = time.Duration(window.Interval) * time.Minute
+	if len(window.Days) > 0 {
+		w.days = make(map[time.Weekday]bool)
+		for _, day := range window.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				err = fmt.Errorf("unknown day '%s'", day)
+				return
+			}
+			w.days[weekday] = true
+		}
+	}
+	return
+}
+
+// parseClock parses a HH:MM string into a duration since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errors.New("time must be formatted as HH:MM")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Next implements cron.Schedule interface.
+// It returns zero time if no activation could be found within a week.
+func (s *SyncSchedule) Next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t)
+	}
+	var next time.Time
+	local := t.In(s.location)
+	// start from yesterday because a window could span over midnight
+	for d := -1; d <= 7; d++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, s.location)
+		for _, w := range s.windows {
+			if w.days != nil && !w.days[day.Weekday()] {
+				continue
+			}
+			start := day.Add(w.start)
+			end := day.Add(w.end)
+			if w.end <= w.start {
+				end = end.Add(24 * time.Hour)
+			}
+			if !end.After(t) {
+				continue
+			}
+			tick := start
+			if !start.After(t) {
+				tick = start.Add((t.Sub(start)/w.interval + 1) * w.interval)
+			}
+			if tick.Before(end) && (next.IsZero() || tick.Before(next)) {
+				next = tick
+			}
+		}
+		if !next.IsZero() && next.Before(day) {
+			break
+		}
+	}
+	if next.IsZero() {
+		return next
+	}
+	return next.In(t.Location())
+}
@@ -0,0 +1,28 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import "time"
+
+// UserExport is an archive of all user's data, built in background and downloadable through a time-limited link.
+// Archive is a zip file holding messages (mbox), contacts (vCard) and account's data (JSON).
+type UserExport struct {
+	DateInsert time.Time `json:"date_insert"`
+	ExpiresAt  time.Time `json:"expires_at"` // export is removed from cache and object store at this date
+	ExportId   string    `json:"export_id"`
+	Size       int64     `json:"size"`
+	Status     string    `json:"status"`
+	Token      string    `json:"token"` // download token, set once archive is ready
+	Uri        string    `json:"uri"`   // where archive is stored in object store
+	UserId     string    `json:"user_id"`
+}
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+
+	ExportDownloadPath = "/api/v2/exports/" // route of archives' download, followed by export's token
+)
@@ -133,11 +133,10 @@ func (ui *UserIdentity) SetDefaults() {
 	switch ui.Protocol {
 	case EmailProtocol:
 		defaults = map[string]string{
-			"lastseenuid":  "",
 			"lastsync":     "",   // RFC3339 date string
 			"inserver":     "",   // server hostname[|port]
+			"mailboxes":    "",   // json list of remote mailboxes with their sync state (uidvalidity, lastseenuid, tag…)
 			"outserver":    "",   // server hostname[|port]
-			"uidvalidity":  "",   // uidvalidity to invalidate data if needed (see RFC4549#section-4.1)
 			"pollinterval": "15", // how often remote account should be polled, in minutes.
 		}
 	case TwitterProtocol:
@@ -0,0 +1,152 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OpenPGP Web Key Directory, see https://tools.ietf.org/html/draft-koch-openpgp-webkey-service
+const (
+	WKDAdvancedMethod = "wkd-advanced"
+	WKDDirectMethod   = "wkd-direct"
+	WKDPath           = "/.well-known/openpgpkey/"
+)
+
+// OpenPGP Web Key Service messages, exchanged with the submission address of a domain
+const (
+	WKSMediaType                = "application/vnd.gnupg.wks"
+	WKSConfirmationRequestType  = "confirmation-request"
+	WKSConfirmationResponseType = "confirmation-response"
+	WKSKeyLabel                 = "wks" // label of users' keys published once their submission has been confirmed
+	WKSProtocolVersion          = 5     // draft-koch-openpgp-webkey-service protocol version, as advertised within policy
+	WKSRequestTTL               = 7 * 24 * time.Hour
+)
+
+const zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// WKDLookup binds the hashed local-part of a local identity within its domain to the identity,
+// hashes of Web Key Directory requests could not be resolved otherwise.
+// Lookups are written along with local identities.
+type WKDLookup struct {
+	Address    string // lowercased address of identity
+	Domain     string
+	Hash       string // WKDHash of address' local-part
+	IdentityId UUID
+	UserId     UUID
+}
+
+// WKSRequest is a key submitted for a local identity, pending its owner's confirmation.
+// Nonce is sent encrypted to the submitted key, only the owner of both the key and the mailbox can give it back.
+type WKSRequest struct {
+	Address     string    `cql:"address"`
+	DateInsert  time.Time `cql:"date_insert"`
+	Fingerprint string    `cql:"fingerprint"`
+	IdentityId  UUID      `cql:"identity_id"`
+	Key         string    `cql:"key"` // armored submitted key
+	Nonce       string    `cql:"nonce"`
+	UserId      UUID      `cql:"user_id"`
+}
+
+// WKSMessage is the content of an application/vnd.gnupg.wks part : a confirmation request or response
+type WKSMessage struct {
+	Type        string
+	Sender      string // submission address
+	Address     string // address of submitted key
+	Fingerprint string // only within requests
+	Nonce       string
+}
+
+// ParseWKSMessage parses the `name: value` lines of an application/vnd.gnupg.wks part.
+// Unknown names are ignored, type, sender, address and nonce are mandatory.
+func ParseWKSMessage(content []byte) (*WKSMessage, error) {
+	msg := new(WKSMessage)
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed wks line %s", line)
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "type":
+			msg.Type = value
+		case "sender":
+			msg.Sender = strings.ToLower(value)
+		case "address":
+			msg.Address = strings.ToLower(value)
+		case "fingerprint":
+			msg.Fingerprint = strings.ToUpper(value)
+		case "nonce":
+			msg.Nonce = value
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if msg.Type == "" || msg.Sender == "" || msg.Address == "" || msg.Nonce == "" {
+		return nil, errors.New("wks message without type, sender, address or nonce")
+	}
+	return msg, nil
+}
+
+// String formats message as the content of an application/vnd.gnupg.wks part
+func (wm *WKSMessage) String() string {
+	content := "type: " + wm.Type + "\n" + "sender: " + wm.Sender + "\n" + "address: " + wm.Address + "\n"
+	if wm.Fingerprint != "" {
+		content += "fingerprint: " + wm.Fingerprint + "\n"
+	}
+	return content + "nonce: " + wm.Nonce + "\n"
+}
+
+// WKDHash returns the z-base-32 encoded SHA-1 of the lowercased local-part of an address,
+// which is the name of the key file within a Web Key Directory.
+func WKDHash(localPart string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(localPart)))
+	encoded := make([]byte, 0, 32)
+	var buffer, bits uint
+	for _, b := range sum {
+		buffer = buffer<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			encoded = append(encoded, zBase32Alphabet[(buffer>>(bits-5))&31])
+			bits -= 5
+		}
+	}
+	if bits > 0 {
+		encoded = append(encoded, zBase32Alphabet[(buffer<<(5-bits))&31])
+	}
+	return string(encoded)
+}
+
+// WKDURL returns the URL where the key of address is published with the given method,
+// either WKDAdvancedMethod (on openpgpkey subdomain) or WKDDirectMethod.
+func WKDURL(address, method string) (string, error) {
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", fmt.Errorf("invalid email address %s", address)
+	}
+	localPart, domain := address[:at], strings.ToLower(address[at+1:])
+	query := "?l=" + url.QueryEscape(localPart)
+	switch method {
+	case WKDAdvancedMethod:
+		return "https://openpgpkey." + domain + WKDPath + domain + "/hu/" + WKDHash(localPart) + query, nil
+	case WKDDirectMethod:
+		return "https://" + domain + WKDPath + "hu/" + WKDHash(localPart) + query, nil
+	default:
+		return "", fmt.Errorf("unknown WKD method %s", method)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package objects
+
+import "time"
+
+// status types published by workers
+const (
+	HeartbeatStatus = "heartbeat"
+	JobStatusType   = "job"
+)
+
+// jobs' states
+const (
+	JobStarted  = "started"
+	JobProgress = "progress"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobLost     = "lost" // worker stopped sending heartbeats while job was running
+)
+
+type (
+	// WorkerStatus is published by protocol workers on idpoller's status topic,
+	// either periodically to notify they are alive, or when a job they are running makes progress.
+	WorkerStatus struct {
+		Job      *JobStatus `json:"job,omitempty"`
+		Protocol string     `json:"protocol"`
+		Time     time.Time  `json:"time"`
+		Type     string     `json:"type"` // heartbeat or job
+		Worker   string     `json:"worker"`
+	}
+
+	// JobStatus is a snapshot of a job run by a worker for a remote identity
+	JobStatus struct {
+		Duration   int64     `json:"duration"` // in milliseconds
+		Errors     []string  `json:"errors,omitempty"`
+		Fetched    int       `json:"fetched"` // count of messages fetched so far
+		IdentityId string    `json:"identity_id"`
+		JobId      string    `json:"job_id,omitempty"`
+		Order      string    `json:"order"`
+		Started    time.Time `json:"started"`
+		State      string    `json:"state"` // started, progress, done, failed or lost
+		Updated    time.Time `json:"updated"`
+		UserId     string    `json:"user_id"`
+		Worker     string    `json:"worker"`
+	}
+
+	// RemoteIdentityStatus is the aggregated sync status of a remote identity, as seen by idpoller
+	RemoteIdentityStatus struct {
+		Errors      []JobStatus `json:"errors"` // last failed jobs, most recent first
+		IdentityId  string      `json:"identity_id"`
+		LastSync    *JobStatus  `json:"last_sync,omitempty"`
+		RunningSync *JobStatus  `json:"running_sync,omitempty"`
+	}
+)
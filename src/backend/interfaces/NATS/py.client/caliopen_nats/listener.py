@@ -80,6 +80,8 @@ def key_handler(config):
     yield client.connect(**opts)
 
     # create and register subscriber(s)
+    # go keys worker subscribes within its own queue group,
+    # each order is handled by both of them
     key_subscriber = subscribers.KeyAction(client)
     future = client.subscribe("keyAction",
                               "keyQueue",
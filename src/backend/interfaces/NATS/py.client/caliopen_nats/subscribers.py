@@ -133,9 +133,17 @@ class ContactAction(BaseHandler):
 
 
 class KeyAction(BaseHandler):
-    """Handler for public key discovery message."""
+    """Handler for public key discovery message.
 
-    def _process_key(self, user, contact, key):
+    Go keys worker handles the same orders, looking up emails in Web Key
+    Directories and on HKP keyservers, this handler only does the other
+    lookups : DNS OPENPGPKEY records of emails and keybase proofs of
+    social identities. Keys found this way are not trusted.
+    """
+
+    methods = ['dns', 'keybase']
+
+    def _process_key(self, user, contact, key, source):
         if not key.is_expired:
             if key.userids:
                 label = key.userids[0].name
@@ -145,7 +153,8 @@ class KeyAction(BaseHandler):
                                    fingerprint=key.fingerprint,
                                    key=key.armored_key,
                                    expire_date=key.expire_date,
-                                   label=label)
+                                   label=label,
+                                   source=source)
             log.info('Created public key {0}'.format(pub.key_id))
 
     def _process_results(self, user, contact, results):
@@ -154,7 +163,8 @@ class KeyAction(BaseHandler):
             for key in result.keys:
                 log.debug('Processing key %r' % key)
                 if key.fingerprint not in fingerprints:
-                    self._process_key(user, contact, key)
+                    self._process_key(user, contact, key,
+                                      result.sources.get(key.fingerprint))
                     fingerprints.append(key.fingerprint)
 
     def process_key_discovery(self, msg, payload):
@@ -165,20 +175,28 @@ class KeyAction(BaseHandler):
         contact = Contact(user.user_id, contact_id=payload['contact_id'])
         contact.get_db()
         contact.unmarshall_db()
-        manager = ContactPublicKeyManager()
+        manager = ContactPublicKeyManager(self.methods)
+        # as go keys worker does, all contact's identifiers are looked up
+        # if order embeds none of them
+        emails = payload.get('emails')
+        identities = payload.get('identities')
+        if not emails and not identities:
+            emails = [{'address': x.address} for x in contact.emails]
+            identities = [{'type': x.type, 'name': x.name}
+                          for x in contact.identities]
         founds = []
-        for ident in payload.get('emails', []):
+        for ident in emails or []:
             log.info('Process email identity {0}'.format(ident['address']))
             discovery = manager.process_identity(user, contact,
                                                  ident['address'], 'email')
-            if discovery:
+            if discovery.keys:
                 founds.append(discovery)
-        for ident in payload.get('identities', []):
+        for ident in identities or []:
             log.info('Process identity {0}:{1}'.
                      format(ident['type'], ident['name']))
             discovery = manager.process_identity(user, contact,
                                                  ident['name'], ident['type'])
-            if discovery:
+            if discovery.keys:
                 founds.append(discovery)
         if founds:
             log.info('Found %d results' % len(founds))
@@ -8,6 +8,7 @@ import (
 	obj "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/carddav"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/contacts"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/devices"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/identities"
@@ -15,8 +16,10 @@ import (
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/notifications"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/participants"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/providers"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/searches"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/tags"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/users"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations/wkd"
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
@@ -45,7 +48,10 @@ type (
 		CacheSettings  `mapstructure:"RedisConfig"`
 		NatsConfig     `mapstructure:"NatsConfig"`
 		NotifierConfig `mapstructure:"NotifierConfig"`
-		Providers      []obj.Provider `mapstructure:"Providers"`
+		Providers      []obj.Provider      `mapstructure:"Providers"`
+		ScheduledSend  ScheduledSendConfig `mapstructure:"ScheduledSendConfig"`
+		Export         ExportConfig        `mapstructure:"ExportConfig"`
+		WKD            WKDConfig           `mapstructure:"WKDConfig"`
 	}
 
 	BackendConfig struct {
@@ -88,12 +94,44 @@ type (
 		Keys_topic       string `mapstructure:"keys_topic"`
 		Users_topic      string `mapstructure:"users_topic"`
 		IdPoller_topic   string `mapstructure:"idpoller_topic"`
+		Notifs_topic     string `mapstructure:"notifs_topic"`
+		Imports_topic    string `mapstructure:"imports_topic"`
 	}
 
 	NotifierConfig struct {
-		AdminUsername string `mapstructure:"admin_username"`
-		BaseUrl       string `mapstructure:"base_url"`
-		TemplatesPath string `mapstructure:"templates_path"`
+		AdminUsername string       `mapstructure:"admin_username"`
+		BaseUrl       string       `mapstructure:"base_url"`
+		TemplatesPath string       `mapstructure:"templates_path"`
+		Push          PushConfig   `mapstructure:"push"`
+		Digest        DigestConfig `mapstructure:"digest"`
+	}
+
+	DigestConfig struct {
+		Hour         int `mapstructure:"hour"`
+		MaxMessages  int `mapstructure:"max_messages"`
+		ScanInterval int `mapstructure:"scan_interval"`
+	}
+
+	PushConfig struct {
+		Notifications   []string `mapstructure:"notifications"`
+		TTL             int      `mapstructure:"ttl"`
+		VapidPrivateKey string   `mapstructure:"vapid_private_key"`
+		VapidSubject    string   `mapstructure:"vapid_subject"`
+	}
+
+	ScheduledSendConfig struct {
+		ScanInterval int `mapstructure:"scan_interval"`
+		UndoDelay    int `mapstructure:"undo_delay"`
+	}
+
+	ExportConfig struct {
+		LinkTTL int `mapstructure:"link_ttl"`
+	}
+
+	WKDConfig struct {
+		Enable              bool   `mapstructure:"enable"`
+		SubmissionLocalPart string `mapstructure:"submission_local_part"`
+		SubmissionKeyFile   string `mapstructure:"submission_key_file"`
 	}
 )
 
@@ -136,14 +174,39 @@ func (server *REST_API) initialize(config APIConfig) error {
 			Keys_topic:       config.NatsConfig.Keys_topic,
 			Users_topic:      config.NatsConfig.Users_topic,
 			IdPoller_topic:   config.NatsConfig.IdPoller_topic,
+			Notifs_topic:     config.NatsConfig.Notifs_topic,
+			Imports_topic:    config.NatsConfig.Imports_topic,
 		},
 		NotifierConfig: obj.NotifierConfig{
 			AdminUsername: config.NotifierConfig.AdminUsername,
 			BaseUrl:       config.NotifierConfig.BaseUrl,
 			TemplatesPath: config.NotifierConfig.TemplatesPath,
+			Push: obj.PushConfig{
+				Notifications:   config.NotifierConfig.Push.Notifications,
+				TTL:             config.NotifierConfig.Push.TTL,
+				VapidPrivateKey: config.NotifierConfig.Push.VapidPrivateKey,
+				VapidSubject:    config.NotifierConfig.Push.VapidSubject,
+			},
+			Digest: obj.DigestConfig{
+				Hour:         config.NotifierConfig.Digest.Hour,
+				MaxMessages:  config.NotifierConfig.Digest.MaxMessages,
+				ScanInterval: config.NotifierConfig.Digest.ScanInterval,
+			},
 		},
 		Providers: config.Providers,
 		Hostname:  config.Hostname + ":" + config.Port,
+		ScheduledSend: obj.ScheduledSendConfig{
+			ScanInterval: config.ScheduledSend.ScanInterval,
+			UndoDelay:    config.ScheduledSend.UndoDelay,
+		},
+		Export: obj.ExportConfig{
+			LinkTTL: config.Export.LinkTTL,
+		},
+		WKD: obj.WKDConfig{
+			Enable:              config.WKD.Enable,
+			SubmissionLocalPart: config.WKD.SubmissionLocalPart,
+			SubmissionKeyFile:   config.WKD.SubmissionKeyFile,
+		},
 	}
 
 	err := caliopen.Initialize(caliopenConfig)
@@ -165,6 +228,13 @@ func StartServer() error {
 	return server.start()
 }
 
+// ShutdownServer stops Caliopen facilities' background jobs
+func ShutdownServer() {
+	if caliopen.Facilities != nil {
+		caliopen.Facilities.Shutdown()
+	}
+}
+
 func (server *REST_API) start() error {
 	// Creates a gin router with default middleware:
 	// logger and recovery (crash-free) middleware
@@ -182,6 +252,11 @@ func (server *REST_API) start() error {
 	// adds our routes and handlers
 	api := router.Group(http_middleware.RoutePrefix)
 	server.AddHandlers(api)
+	// public OpenPGP Web Key Directory, which must be at host's root
+	if caliopen.Facilities.RESTfacility.WKDEnabled() {
+		router.GET(obj.WKDPath+"*path", wkd.WebKeyDirectory)
+		router.HEAD(obj.WKDPath+"*path", wkd.WebKeyDirectory)
+	}
 
 	// listens
 	addr := server.config.Interface + ":" + server.config.ListenPort
@@ -198,6 +273,13 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	usrs := api.Group("/users", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
 	usrs.PATCH("/:user_id", users.PatchUser)
 	usrs.POST("/:user_id/actions", users.Delete)
+	usrs.POST("/:user_id/export", users.RequestExport)
+	usrs.GET("/:user_id/export", users.GetExport)
+	usrs.GET("/:user_id/app_passwords", users.GetAppPasswords)
+	usrs.POST("/:user_id/app_passwords", users.NewAppPassword)
+	usrs.DELETE("/:user_id/app_passwords/:app_password_id", users.DeleteAppPassword)
+	// download links are authenticated by their token
+	api.GET("/exports/:export_token", users.DownloadExport)
 
 	/** identities **/
 	ids := api.Group(http_middleware.IdentitiesRoute, http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
@@ -206,6 +288,8 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	ids.GET("/remotes", identities.GetRemoteIdentities)
 	ids.POST("/remotes", identities.NewRemoteIdentity)
 	ids.GET("/remotes/:remote_id", identities.GetRemoteIdentity)
+	ids.GET("/remotes/:remote_id/status", identities.GetRemoteIdentityStatus)
+	ids.POST("/remotes/:remote_id/actions", identities.RemoteIdentityActions)
 	ids.PATCH("/remotes/:remote_id", identities.PatchRemoteIdentity)
 	ids.DELETE("/remotes/:remote_id", identities.DeleteRemoteIdentity)
 
@@ -231,6 +315,11 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	//tags
 	msg.PATCH("/:message_id/tags", tags.PatchResourceWithTags)
 
+	/** imports API **/
+	imp := api.Group("/imports", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
+	imp.POST("/mailbox", messages.ImportMailbox)
+	imp.GET("/mailbox", messages.GetMailboxImport)
+
 	/** participants API **/
 	parts := api.Group("/participants", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
 	parts.GET("/suggest", participants.Suggest)
@@ -239,10 +328,11 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	cts := api.Group(http_middleware.ContactsRoute, http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
 	cts.GET("", contacts.GetContactsList)
 	cts.POST("", contacts.NewContact)
-	cts.GET("/:contactID", contacts.GetContact)
+	cts.GET("/:contactID", contacts.GetContact) // also serves GET /contacts/duplicates
 	cts.PATCH("/:contactID", contacts.PatchContact)
 	cts.DELETE("/:contactID", contacts.DeleteContact)
 	cts.GET("/:contactID/identities", contacts.GetIdentities)
+	cts.POST("/:contactID/actions", contacts.Actions)
 	//publickeys
 	cts.POST("/:contactID/publickeys", contacts.NewPublicKey)
 	cts.GET("/:contactID/publickeys", contacts.GetPubKeys)
@@ -251,6 +341,28 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	cts.DELETE("/:contactID/publickeys/:pubkeyID", contacts.DeletePubKey)
 	//tags
 	cts.PATCH("/:contactID/tags", tags.PatchResourceWithTags)
+	//vcards
+	cts.GET("/:contactID/vcard", contacts.GetVCard)
+	vcf := api.Group("/vcards", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
+	vcf.GET("", contacts.ExportVCards)
+	vcf.POST("", contacts.ImportVCards)
+
+	/** CardDAV address book, authenticated by username and an application password **/
+	dav := api.Group(http_middleware.CardDAVRoute, http_middleware.BasicAuthFromCredentials(caliopen.Facilities.RESTfacility.AuthenticateAppPassword, caliopen.Facilities.Cache, "caliopen"))
+	for _, path := range []string{"", "/"} {
+		dav.Handle("OPTIONS", path, carddav.Options)
+		dav.Handle("PROPFIND", path, carddav.PropfindPrincipal)
+	}
+	for _, path := range []string{"/contacts", "/contacts/"} {
+		dav.Handle("OPTIONS", path, carddav.Options)
+		dav.Handle("PROPFIND", path, carddav.PropfindAddressBook)
+		dav.Handle("REPORT", path, carddav.Report)
+	}
+	dav.Handle("OPTIONS", "/contacts/:card", carddav.Options)
+	dav.Handle("PROPFIND", "/contacts/:card", carddav.PropfindCard)
+	dav.GET("/contacts/:card", carddav.GetCard)
+	dav.PUT("/contacts/:card", carddav.PutCard)
+	dav.DELETE("/contacts/:card", carddav.DeleteCard)
 
 	/** devices API **/
 	api.GET("/validate-device/:token", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"), devices.ValidateDevice)
@@ -275,10 +387,21 @@ func (server *REST_API) AddHandlers(api *gin.RouterGroup) {
 	search.GET("", operations.SimpleSearch)
 	search.POST("", operations.AdvancedSearch)
 
+	/** saved searches API **/
+	saved := api.Group(http_middleware.SearchesRoute, http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
+	saved.GET("", searches.RetrieveSavedSearches)
+	saved.POST("", searches.CreateSavedSearch)
+	saved.GET("/:search_id", searches.RetrieveSavedSearch)
+	saved.PATCH("/:search_id", searches.PatchSavedSearch)
+	saved.DELETE("/:search_id", searches.DeleteSavedSearch)
+	saved.GET("/:search_id/results", searches.RetrieveSavedSearchResults)
+
 	/** notifications API **/
 	notif := api.Group("/notifications", http_middleware.BasicAuthFromCache(caliopen.Facilities.Cache, "caliopen"))
 	notif.GET("", notifications.GetPendingNotif)
 	notif.DELETE("", notifications.DeleteNotifications)
+	notif.GET("/stream", notifications.StreamNotifications)
+	notif.GET("/push_key", notifications.GetPushKey)
 
 	/** providers **/
 	prov := api.Group("/providers")
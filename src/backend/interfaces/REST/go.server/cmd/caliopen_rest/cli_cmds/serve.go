@@ -73,7 +73,7 @@ func sigHandler() {
 
 			}
 
-			//app.Shutdown()
+			rest_api.ShutdownServer()
 			log.Infof("Shutdown completed, exiting.")
 			os.Exit(0)
 		} else {
@@ -11,6 +11,7 @@ import (
 	"encoding/asn1"
 	"encoding/base64"
 	"errors"
+	obj "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
@@ -114,6 +115,48 @@ func BasicAuthFromCache(cache backends.APICache, realm string) gin.HandlerFunc {
 	}
 }
 
+const (
+	credentialsMaxFailures   = 10               // failed authentications allowed per username from a client within window
+	credentialsFailureWindow = 15 * time.Minute // how long failed authentications are remembered
+)
+
+// BasicAuthFromCredentials authenticates requests with username and an application password,
+// for clients that can't go through login process, like CardDAV address books.
+// Once too many authentications failed for an username from a client, its requests are rejected without being checked.
+// Failures are counted per username and client address, for nobody to lock an user out from elsewhere.
+func BasicAuthFromCredentials(authenticate func(username, password string) (*obj.UserInfo, obj.CaliopenError), cache backends.APICache, realm string) gin.HandlerFunc {
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	realm = "Basic realm=" + strconv.Quote(realm)
+
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", realm)
+			kickUnauthorizedRequest(c, realm)
+			return
+		}
+		key := "credentials::" + username + "::" + c.ClientIP()
+		if failures, err := cache.AuthFailures(key); err != nil || failures >= credentialsMaxFailures {
+			c.Header("Retry-After", strconv.Itoa(int(credentialsFailureWindow.Seconds())))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		user, err := authenticate(username, password)
+		if err != nil {
+			if err.Code() == obj.WrongCredentialsErr {
+				cache.AddAuthFailure(key, credentialsFailureWindow)
+			}
+			c.Header("WWW-Authenticate", realm)
+			kickUnauthorizedRequest(c, realm)
+			return
+		}
+		c.Set("user_id", user.User_id)
+		c.Set("shard_id", user.Shard_id)
+	}
+}
+
 func kickUnauthorizedRequest(c *gin.Context, realm string) {
 	c.AbortWithStatus(401)
 }
@@ -6,4 +6,6 @@ const (
 	TagsRoute       = "/tags"
 	ContactsRoute   = "/contacts"
 	DevicesRoute    = "/devices"
+	CardDAVRoute    = "/carddav"
+	SearchesRoute   = "/searches"
 )
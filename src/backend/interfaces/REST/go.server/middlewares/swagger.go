@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	obj "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 	"github.com/go-openapi/analysis"
@@ -90,6 +91,16 @@ func InitSwaggerMiddleware(swaggerFile string) (err error) {
 // requests before next handlers
 func SwaggerValidator() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		// CardDAV's WebDAV methods and XML bodies are out of swagger specs' scope
+		if strings.HasPrefix(ctx.Request.URL.Path, RoutePrefix+CardDAVRoute) {
+			ctx.Next()
+			return
+		}
+		// Web Key Directory is served outside of API
+		if strings.HasPrefix(ctx.Request.URL.Path, obj.WKDPath) {
+			ctx.Next()
+			return
+		}
 		SwaggerInboundValidation(ctx)
 		ctx.Next()
 		//SwaggerOutboundValidation(ctx)
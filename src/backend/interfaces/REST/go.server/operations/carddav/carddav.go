@@ -0,0 +1,395 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+// Package carddav serves user's contacts as a CardDAV address book (RFC 6352),
+// for phones and desktop clients to sync them both ways.
+// Server exposes a single principal, which is also the address book home,
+// holding a single address book of all user's contacts.
+package carddav
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/REST"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	addressBookName = "contacts"
+
+	vCardContentType       = "text/vcard; charset=utf-8"
+	addressBookDisplayName = "Caliopen"
+)
+
+type resourceKind int
+
+const (
+	principalResource resourceKind = iota
+	addressBookResource
+	cardResource
+)
+
+// resource is one of the principal, the address book or a card
+type resource struct {
+	card *REST.AddressBookCard // card resource only
+	ctag string                // address book only
+	href string
+	kind resourceKind
+}
+
+// properties returned to allprop and propname requests
+var allProps = map[resourceKind][]xml.Name{
+	principalResource: {
+		{Space: davNS, Local: "resourcetype"},
+		{Space: davNS, Local: "current-user-principal"},
+		{Space: davNS, Local: "principal-URL"},
+		{Space: cardDAVNS, Local: "addressbook-home-set"},
+	},
+	addressBookResource: {
+		{Space: davNS, Local: "resourcetype"},
+		{Space: davNS, Local: "displayname"},
+		{Space: davNS, Local: "current-user-principal"},
+		{Space: davNS, Local: "owner"},
+		{Space: davNS, Local: "current-user-privilege-set"},
+		{Space: davNS, Local: "supported-report-set"},
+		{Space: calServerNS, Local: "getctag"},
+		{Space: cardDAVNS, Local: "supported-address-data"},
+		{Space: cardDAVNS, Local: "max-resource-size"},
+	},
+	cardResource: {
+		{Space: davNS, Local: "resourcetype"},
+		{Space: davNS, Local: "getetag"},
+		{Space: davNS, Local: "getcontenttype"},
+	},
+}
+
+func principalHref() string {
+	return http_middleware.RoutePrefix + http_middleware.CardDAVRoute + "/"
+}
+
+func addressBookHref() string {
+	return principalHref() + addressBookName + "/"
+}
+
+func cardHref(name string) string {
+	return addressBookHref() + url.PathEscape(name)
+}
+
+// cardName returns name of card targeted by href, or an empty string if href is not an address book's card
+func cardName(href string) string {
+	path := hrefPath(href)
+	if !strings.HasPrefix(path, addressBookHref()) {
+		return ""
+	}
+	name := strings.TrimPrefix(path, addressBookHref())
+	if strings.Contains(name, "/") {
+		return ""
+	}
+	return name
+}
+
+func newCardResource(card *REST.AddressBookCard) resource {
+	return resource{card: card, href: cardHref(card.Name), kind: cardResource}
+}
+
+// prop returns inner XML of resource's property p, if resource has it
+func (r resource) prop(p davProp) (string, bool) {
+	name := p.XMLName.Space + p.XMLName.Local
+	switch name {
+	case davNS + "current-user-principal":
+		return hrefElement(principalHref()), true
+	case davNS + "resourcetype":
+		switch r.kind {
+		case principalResource:
+			return "<D:collection/><D:principal/>", true
+		case addressBookResource:
+			return "<D:collection/><C:addressbook/>", true
+		}
+		return "", true
+	}
+	switch r.kind {
+	case principalResource:
+		switch name {
+		case davNS + "principal-URL", cardDAVNS + "addressbook-home-set":
+			return hrefElement(principalHref()), true
+		}
+	case addressBookResource:
+		switch name {
+		case davNS + "displayname":
+			return addressBookDisplayName, true
+		case davNS + "owner":
+			return hrefElement(principalHref()), true
+		case davNS + "current-user-privilege-set":
+			return "<D:privilege><D:read/></D:privilege><D:privilege><D:write/></D:privilege>" +
+				"<D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>", true
+		case davNS + "supported-report-set":
+			return "<D:supported-report><D:report><C:addressbook-multiget/></D:report></D:supported-report>" +
+				"<D:supported-report><D:report><C:addressbook-query/></D:report></D:supported-report>", true
+		case calServerNS + "getctag":
+			return escape(r.ctag), true
+		case cardDAVNS + "supported-address-data":
+			return `<C:address-data-type content-type="text/vcard" version="3.0"/>` +
+				`<C:address-data-type content-type="text/vcard" version="4.0"/>`, true
+		case cardDAVNS + "max-resource-size":
+			return strconv.Itoa(maxBodySize), true
+		}
+	case cardResource:
+		switch name {
+		case davNS + "getetag":
+			return escape(r.card.ETag), true
+		case davNS + "getcontenttype":
+			return vCardContentType, true
+		case cardDAVNS + "address-data":
+			version := helpers.VCardVersion3
+			if p.attr("version") == helpers.VCardVersion4 {
+				version = helpers.VCardVersion4
+			}
+			return escape(string(helpers.MarshalVCardVersion(r.card.Contact, version))), true
+		}
+	}
+	return "", false
+}
+
+// response returns resource's requested properties, or all of them if props is nil
+func (r resource) response(props *davPropList, namesOnly bool) davResponse {
+	requested := []davProp{}
+	if props != nil && !namesOnly {
+		requested = props.Props
+	} else {
+		for _, name := range allProps[r.kind] {
+			requested = append(requested, davProp{XMLName: name})
+		}
+	}
+	found, missing := []string{}, []string{}
+	for _, p := range requested {
+		value, ok := r.prop(p)
+		switch {
+		case !ok:
+			missing = append(missing, element(p.XMLName, ""))
+		case namesOnly:
+			found = append(found, element(p.XMLName, ""))
+		default:
+			found = append(found, element(p.XMLName, value))
+		}
+	}
+	return propResponse(r.href, found, missing)
+}
+
+// OPTIONS …/carddav/*
+func Options(ctx *gin.Context) {
+	ctx.Header("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	ctx.Header("DAV", "1, 3, addressbook")
+	ctx.Status(http.StatusOK)
+}
+
+// PROPFIND …/carddav/
+func PropfindPrincipal(ctx *gin.Context) {
+	req, ok := parsePropfind(ctx)
+	if !ok {
+		return
+	}
+	responses := []davResponse{resource{href: principalHref(), kind: principalResource}.response(req.Prop, req.PropName != nil)}
+	if ctx.Request.Header.Get("Depth") != "0" {
+		cards, err := caliopen.Facilities.RESTfacility.RetrieveAddressBook(ctx.MustGet("user_id").(string))
+		if err != nil {
+			serveError(ctx, err)
+			return
+		}
+		book := resource{ctag: REST.AddressBookCTag(cards), href: addressBookHref(), kind: addressBookResource}
+		responses = append(responses, book.response(req.Prop, req.PropName != nil))
+	}
+	serveMultistatus(ctx, responses)
+}
+
+// PROPFIND …/carddav/contacts/
+// with a Depth other than 0, address book's cards are listed too.
+func PropfindAddressBook(ctx *gin.Context) {
+	req, ok := parsePropfind(ctx)
+	if !ok {
+		return
+	}
+	cards, err := caliopen.Facilities.RESTfacility.RetrieveAddressBook(ctx.MustGet("user_id").(string))
+	if err != nil {
+		serveError(ctx, err)
+		return
+	}
+	book := resource{ctag: REST.AddressBookCTag(cards), href: addressBookHref(), kind: addressBookResource}
+	responses := []davResponse{book.response(req.Prop, req.PropName != nil)}
+	if ctx.Request.Header.Get("Depth") != "0" {
+		for _, card := range cards {
+			responses = append(responses, newCardResource(card).response(req.Prop, req.PropName != nil))
+		}
+	}
+	serveMultistatus(ctx, responses)
+}
+
+// PROPFIND …/carddav/contacts/:card
+func PropfindCard(ctx *gin.Context) {
+	req, ok := parsePropfind(ctx)
+	if !ok {
+		return
+	}
+	card, err := caliopen.Facilities.RESTfacility.RetrieveAddressBookCard(ctx.MustGet("user_id").(string), ctx.Param("card"))
+	if err != nil {
+		serveError(ctx, err)
+		return
+	}
+	serveMultistatus(ctx, []davResponse{newCardResource(card).response(req.Prop, req.PropName != nil)})
+}
+
+// REPORT …/carddav/contacts/
+// handles addressbook-multiget and addressbook-query reports
+func Report(ctx *gin.Context) {
+	body, err := readBody(ctx.Request)
+	req := new(reportRequest)
+	if err == nil {
+		err = xml.Unmarshal(body, req)
+	}
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if req.XMLName.Space != cardDAVNS || (req.XMLName.Local != "addressbook-multiget" && req.XMLName.Local != "addressbook-query") {
+		ctx.Data(http.StatusForbidden, xmlContentType, []byte(xml.Header+`<D:error xmlns:D="DAV:"><D:supported-report/></D:error>`))
+		ctx.Abort()
+		return
+	}
+	cards, er := caliopen.Facilities.RESTfacility.RetrieveAddressBook(ctx.MustGet("user_id").(string))
+	if er != nil {
+		serveError(ctx, er)
+		return
+	}
+
+	responses := []davResponse{}
+	if req.XMLName.Local == "addressbook-multiget" {
+		byName := map[string]*REST.AddressBookCard{}
+		for _, card := range cards {
+			byName[card.Name] = card
+		}
+		for _, href := range req.Hrefs {
+			if card, ok := byName[cardName(href)]; ok {
+				responses = append(responses, newCardResource(card).response(req.Prop, false))
+			} else {
+				responses = append(responses, statusResponse(href, http.StatusNotFound))
+			}
+		}
+		serveMultistatus(ctx, responses)
+		return
+	}
+
+	for _, card := range cards {
+		if !req.Filter.match(helpers.MarshalVCardVersion(card.Contact, helpers.VCardVersion4)) {
+			continue
+		}
+		if req.Limit != nil && req.Limit.NResults > 0 && len(responses) >= req.Limit.NResults {
+			// RFC 6352 §8.6.1 : results are truncated, collection is reported as insufficient storage
+			responses = append(responses, statusResponse(addressBookHref(), http.StatusInsufficientStorage))
+			break
+		}
+		responses = append(responses, newCardResource(card).response(req.Prop, false))
+	}
+	serveMultistatus(ctx, responses)
+}
+
+// GET …/carddav/contacts/:card
+// vCard 3.0 is served unless client accepts 4.0
+func GetCard(ctx *gin.Context) {
+	card, err := caliopen.Facilities.RESTfacility.RetrieveAddressBookCard(ctx.MustGet("user_id").(string), ctx.Param("card"))
+	if err != nil {
+		serveError(ctx, err)
+		return
+	}
+	ctx.Header("ETag", card.ETag)
+	if noneMatch := ctx.Request.Header.Get("If-None-Match"); noneMatch != "" && REST.MatchETag(noneMatch, card.ETag) {
+		ctx.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	version := helpers.VCardVersion3
+	if strings.Contains(ctx.Request.Header.Get("Accept"), "version=4.0") {
+		version = helpers.VCardVersion4
+	}
+	ctx.Data(http.StatusOK, vCardContentType, helpers.MarshalVCardVersion(card.Contact, version))
+}
+
+// PUT …/carddav/contacts/:card
+// creates or replaces a card, honoring If-Match and If-None-Match preconditions
+func PutCard(ctx *gin.Context) {
+	userInfo := &UserInfo{User_id: ctx.MustGet("user_id").(string), Shard_id: ctx.MustGet("shard_id").(string)}
+	body, err := readBody(ctx.Request)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	card, created, er := caliopen.Facilities.RESTfacility.PutAddressBookCard(userInfo, ctx.Param("card"), body,
+		ctx.Request.Header.Get("If-Match"), ctx.Request.Header.Get("If-None-Match"))
+	if er != nil {
+		serveError(ctx, er)
+		return
+	}
+	// vCard has been mapped onto a contact, thus stored card is not the one sent by client :
+	// no ETag is returned for client to fetch card back (RFC 6352 §6.3.2.3)
+	if created {
+		ctx.Header("Location", cardHref(card.Name))
+		ctx.Status(http.StatusCreated)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DELETE …/carddav/contacts/:card
+func DeleteCard(ctx *gin.Context) {
+	err := caliopen.Facilities.RESTfacility.DeleteAddressBookCard(ctx.MustGet("user_id").(string), ctx.Param("card"), ctx.Request.Header.Get("If-Match"))
+	if err != nil {
+		serveError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// parsePropfind reads PROPFIND's body, an empty body being an allprop request
+func parsePropfind(ctx *gin.Context) (*propfindRequest, bool) {
+	req := new(propfindRequest)
+	body, err := readBody(ctx.Request)
+	if err == nil && len(strings.TrimSpace(string(body))) > 0 {
+		err = xml.Unmarshal(body, req)
+	}
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return nil, false
+	}
+	return req, true
+}
+
+func serveMultistatus(ctx *gin.Context, responses []davResponse) {
+	body, err := marshalMultistatus(responses)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	ctx.Data(http.StatusMultiStatus, xmlContentType, body)
+}
+
+// serveError answers with the WebDAV status matching facility's error
+func serveError(ctx *gin.Context, err CaliopenError) {
+	status := http.StatusFailedDependency
+	switch err.Code() {
+	case NotFoundCaliopenErr:
+		status = http.StatusNotFound
+	case ForbiddenCaliopenErr:
+		status = http.StatusForbidden
+	case PreconditionFailedCaliopenErr:
+		status = http.StatusPreconditionFailed
+	case UnprocessableCaliopenErr:
+		status = http.StatusUnprocessableEntity
+	}
+	ctx.AbortWithStatus(status)
+}
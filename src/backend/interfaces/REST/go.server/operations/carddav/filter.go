@@ -0,0 +1,79 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package carddav
+
+import (
+	"strings"
+
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+)
+
+// match tells if vcard passes addressbook-query's filter (RFC 6352 §10.5).
+// A missing filter matches all cards.
+func (f *cardFilter) match(vcard []byte) bool {
+	if f == nil || len(f.PropFilters) == 0 {
+		return true
+	}
+	allOf := f.Test == "allof"
+	for _, filter := range f.PropFilters {
+		matched := filter.match(vcard)
+		if matched && !allOf {
+			return true
+		}
+		if !matched && allOf {
+			return false
+		}
+	}
+	return allOf
+}
+
+func (f propFilter) match(vcard []byte) bool {
+	values := helpers.VCardPropertyValues(vcard, f.Name)
+	if f.IsNotDefined != nil {
+		return len(values) == 0
+	}
+	if len(f.TextMatches) == 0 {
+		return len(values) > 0
+	}
+	allOf := f.Test == "allof"
+	for _, text := range f.TextMatches {
+		matched := text.match(values)
+		if matched && !allOf {
+			return true
+		}
+		if !matched && allOf {
+			return false
+		}
+	}
+	return allOf
+}
+
+// match tells if one of values matches, "i;unicode-casemap" collation being the default one
+func (t textMatch) match(values []string) bool {
+	needle := t.Text
+	if t.Collation != "i;octet" {
+		needle = strings.ToLower(needle)
+	}
+	matched := false
+	for _, value := range values {
+		if t.Collation != "i;octet" {
+			value = strings.ToLower(value)
+		}
+		switch t.MatchType {
+		case "equals":
+			matched = value == needle
+		case "starts-with":
+			matched = strings.HasPrefix(value, needle)
+		case "ends-with":
+			matched = strings.HasSuffix(value, needle)
+		default:
+			matched = strings.Contains(value, needle)
+		}
+		if matched {
+			break
+		}
+	}
+	return matched != (t.NegateCondition == "yes")
+}
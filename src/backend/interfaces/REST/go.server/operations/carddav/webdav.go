@@ -0,0 +1,195 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WebDAV (RFC 4918) plumbing : requests' and multistatus responses' XML bodies
+
+const (
+	davNS       = "DAV:"
+	cardDAVNS   = "urn:ietf:params:xml:ns:carddav"
+	calServerNS = "http://calendarserver.org/ns/" // getctag's namespace
+
+	xmlContentType = "application/xml; charset=utf-8"
+	maxBodySize    = 1 << 20
+)
+
+// prefixes used in responses for known namespaces
+var davPrefixes = map[string]string{
+	davNS:       "D",
+	cardDAVNS:   "C",
+	calServerNS: "CS",
+}
+
+// davProp is a property name requested by client, with its attributes if any
+type davProp struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+}
+
+func (p davProp) attr(name string) string {
+	for _, attr := range p.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+type davPropList struct {
+	Props []davProp `xml:",any"`
+}
+
+type propfindRequest struct {
+	XMLName  xml.Name     `xml:"DAV: propfind"`
+	AllProp  *struct{}    `xml:"DAV: allprop"`
+	PropName *struct{}    `xml:"DAV: propname"`
+	Prop     *davPropList `xml:"DAV: prop"`
+}
+
+// reportRequest holds addressbook-multiget and addressbook-query reports (RFC 6352 §8.6 and §8.7)
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *davPropList `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+	Filter  *cardFilter  `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+}
+
+type cardFilter struct {
+	Test        string       `xml:"test,attr"`
+	PropFilters []propFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+type propFilter struct {
+	Name         string      `xml:"name,attr"`
+	Test         string      `xml:"test,attr"`
+	IsNotDefined *struct{}   `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []textMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+}
+
+type textMatch struct {
+	Collation       string `xml:"collation,attr"`
+	MatchType       string `xml:"match-type,attr"`
+	NegateCondition string `xml:"negate-condition,attr"`
+	Text            string `xml:",chardata"`
+}
+
+type multistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	DAV       string        `xml:"xmlns:D,attr"`
+	CardDAV   string        `xml:"xmlns:C,attr"`
+	CalServer string        `xml:"xmlns:CS,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"D:href"`
+	Propstats []davPropstat `xml:"D:propstat,omitempty"`
+	Status    string        `xml:"D:status,omitempty"`
+}
+
+type davPropstat struct {
+	Prop   davInnerXML `xml:"D:prop"`
+	Status string      `xml:"D:status"`
+}
+
+type davInnerXML struct {
+	Inner string `xml:",innerxml"`
+}
+
+// propResponse builds a resource's response, splitting found and missing properties into their own propstat
+func propResponse(href string, found, missing []string) davResponse {
+	response := davResponse{Href: href}
+	if len(found) > 0 {
+		response.Propstats = append(response.Propstats, davPropstat{
+			Prop:   davInnerXML{strings.Join(found, "")},
+			Status: statusLine(http.StatusOK),
+		})
+	}
+	if len(missing) > 0 {
+		response.Propstats = append(response.Propstats, davPropstat{
+			Prop:   davInnerXML{strings.Join(missing, "")},
+			Status: statusLine(http.StatusNotFound),
+		})
+	}
+	return response
+}
+
+func statusResponse(href string, status int) davResponse {
+	return davResponse{Href: href, Status: statusLine(status)}
+}
+
+func statusLine(status int) string {
+	return "HTTP/1.1 " + strconv.Itoa(status) + " " + http.StatusText(status)
+}
+
+// element renders a property element, with inner XML content
+func element(name xml.Name, inner string) string {
+	open, tag := "", name.Local
+	if prefix, known := davPrefixes[name.Space]; known {
+		tag = prefix + ":" + name.Local
+		open = tag
+	} else {
+		open = tag + ` xmlns="` + escape(name.Space) + `"`
+	}
+	if inner == "" {
+		return "<" + open + "/>"
+	}
+	return "<" + open + ">" + inner + "</" + tag + ">"
+}
+
+func escape(s string) string {
+	escaped := new(bytes.Buffer)
+	xml.EscapeText(escaped, []byte(s))
+	return escaped.String()
+}
+
+func hrefElement(href string) string {
+	return "<D:href>" + escape(href) + "</D:href>"
+}
+
+// marshalMultistatus outputs a 207 Multi-Status response's body
+func marshalMultistatus(responses []davResponse) ([]byte, error) {
+	body, err := xml.Marshal(multistatus{
+		DAV:       davNS,
+		CardDAV:   cardDAVNS,
+		CalServer: calServerNS,
+		Responses: responses,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// readBody reads request's body, up to maxBodySize
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	return ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+}
+
+// hrefPath returns path of an href, that could be an absolute URL
+func hrefPath(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return u.Path
+}
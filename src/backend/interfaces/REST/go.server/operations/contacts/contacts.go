@@ -111,6 +111,10 @@ func NewContact(ctx *gin.Context) {
 
 // GetContact handles GET /contacts/:contactID
 func GetContact(ctx *gin.Context) {
+	if ctx.Param("contactID") == duplicatesSegment {
+		GetDuplicates(ctx)
+		return
+	}
 	userID := ctx.MustGet("user_id").(string)
 	contactID, err := operations.NormalizeUUIDstring(ctx.Param("contactID"))
 	if err != nil {
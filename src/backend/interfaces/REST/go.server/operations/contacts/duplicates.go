@@ -0,0 +1,137 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package contacts
+
+import (
+	"errors"
+	"net/http"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+)
+
+// path segment of duplicates' route, which httprouter can't register beside /:contactID
+const duplicatesSegment = "duplicates"
+
+type (
+	duplicateContact struct {
+		ContactId string `json:"contact_id"`
+		Title     string `json:"title"`
+	}
+	contactPoint struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	duplicateContacts struct {
+		Contacts       []duplicateContact `json:"contacts"`
+		ContactPoints  []contactPoint     `json:"contact_points"`
+		NameSimilarity float64            `json:"name_similarity,omitempty"`
+	}
+)
+
+// GET …/contacts/duplicates
+// pairs of contacts that are likely to be the same person, the first contact of each pair being the one to keep
+func GetDuplicates(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	duplicates, err := caliopen.Facilities.RESTfacility.RetrieveDuplicateContacts(userId)
+	if err != nil {
+		e := swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to find duplicate contacts"), err, err.Cause())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	list := []duplicateContacts{}
+	for _, duplicate := range duplicates {
+		item := duplicateContacts{
+			Contacts:       []duplicateContact{},
+			ContactPoints:  []contactPoint{},
+			NameSimilarity: duplicate.NameSimilarity,
+		}
+		for _, contact := range duplicate.Contacts {
+			item.Contacts = append(item.Contacts, duplicateContact{contact.ContactId.String(), contact.Title})
+		}
+		for _, point := range duplicate.ContactPoints {
+			item.ContactPoints = append(item.ContactPoints, contactPoint{point.Type, point.Value})
+		}
+		list = append(list, item)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"total": len(list), "duplicates": list})
+}
+
+// POST …/contacts/:contactID/actions
+// only action is "merge", with params {"contact_id": "…"} of the contact to merge into contactID
+func Actions(ctx *gin.Context) {
+	userInfo := &UserInfo{User_id: ctx.MustGet("user_id").(string), Shard_id: ctx.MustGet("shard_id").(string)}
+	contactId, err := operations.NormalizeUUIDstring(ctx.Param("contactID"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	var actions ActionsPayload
+	if err = ctx.BindJSON(&actions); err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	if len(actions.Actions) != 1 || actions.Actions[0] != "merge" {
+		e := swgErr.New(http.StatusNotImplemented, "only merge action is implemented")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	otherId, err := mergedContactParam(actions.Params)
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+
+	contact, apiErr := caliopen.Facilities.RESTfacility.MergeContacts(userInfo, contactId, otherId)
+	if apiErr != nil {
+		var e error
+		switch apiErr.Code() {
+		case UnprocessableCaliopenErr:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "contacts can't be merged"), apiErr)
+		case NotFoundCaliopenErr:
+			e = swgErr.New(http.StatusNotFound, "contact not found")
+		case ForbiddenCaliopenErr:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusForbidden, "forbidden action"), apiErr)
+		default:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to merge contacts"), apiErr, apiErr.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	contactJson, err := contact.MarshalFrontEnd()
+	if err != nil {
+		e := swgErr.New(http.StatusFailedDependency, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", contactJson)
+}
+
+// mergedContactParam returns the normalized `contact_id` param of the merge action
+func mergedContactParam(params interface{}) (string, error) {
+	p, ok := params.(map[string]interface{})
+	if !ok {
+		return "", errors.New("params must be an object")
+	}
+	contactId, ok := p["contact_id"].(string)
+	if !ok {
+		return "", errors.New("params must hold the contact_id of the contact to merge")
+	}
+	return operations.NormalizeUUIDstring(contactId)
+}
@@ -0,0 +1,135 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package contacts
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+)
+
+const (
+	vCardContentType = "text/vcard; charset=utf-8"
+	vCardsMaxMemory  = 8 << 20 // uploaded files above this size are buffered on disk
+)
+
+// POST …/vcards
+// multipart form with one or more "file", each holding one or more vCards
+func ImportVCards(ctx *gin.Context) {
+	userInfo := &UserInfo{User_id: ctx.MustGet("user_id").(string), Shard_id: ctx.MustGet("shard_id").(string)}
+	err := ctx.Request.ParseMultipartForm(vCardsMaxMemory)
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	defer ctx.Request.MultipartForm.RemoveAll()
+	vcards := new(bytes.Buffer)
+	for _, header := range ctx.Request.MultipartForm.File["file"] {
+		file, err := header.Open()
+		if err == nil {
+			_, err = io.Copy(vcards, file)
+			file.Close()
+		}
+		if err != nil {
+			e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+			http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+			ctx.Abort()
+			return
+		}
+		// vCards of successive files must not be glued together
+		vcards.WriteString("\r\n")
+	}
+
+	contacts, er := caliopen.Facilities.RESTfacility.ImportVCards(userInfo, vcards.Bytes())
+	if er != nil && len(contacts) == 0 {
+		var e error
+		if er.Code() == UnprocessableCaliopenErr {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "no valid vCard found"), er)
+		} else {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to import vCards"), er, er.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	imported := []map[string]string{}
+	for _, contact := range contacts {
+		imported = append(imported, map[string]string{
+			"contact_id": contact.ContactId.String(),
+			"title":      contact.Title,
+		})
+	}
+	response := gin.H{"total": len(imported), "contacts": imported}
+	if er != nil {
+		// import stopped midway, contacts created so far are kept
+		response["error"] = er.Error()
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GET …/vcards?contact_id=…&version=…
+// exports all user's contacts, or the ones listed by contact_id params, as vCards
+func ExportVCards(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	contactIds := []string{}
+	for _, id := range ctx.Request.URL.Query()["contact_id"] {
+		contactId, err := operations.NormalizeUUIDstring(id)
+		if err != nil {
+			e := swgErr.New(http.StatusUnprocessableEntity, "invalid contact_id : "+err.Error())
+			http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+			ctx.Abort()
+			return
+		}
+		contactIds = append(contactIds, contactId)
+	}
+	serveVCards(ctx, userId, contactIds, "contacts.vcf")
+}
+
+// GET …/contacts/:contactID/vcard?version=…
+func GetVCard(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	contactId, err := operations.NormalizeUUIDstring(ctx.Param("contactID"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	serveVCards(ctx, userId, []string{contactId}, contactId+".vcf")
+}
+
+func serveVCards(ctx *gin.Context, userId string, contactIds []string, filename string) {
+	version := ctx.DefaultQuery("version", helpers.VCardVersion4)
+	if version != helpers.VCardVersion3 && version != helpers.VCardVersion4 {
+		e := swgErr.New(http.StatusUnprocessableEntity, "version must be 3.0 or 4.0")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	vcards, err := caliopen.Facilities.RESTfacility.ExportVCards(userId, contactIds, version)
+	if err != nil {
+		var e error
+		if err.Code() == NotFoundCaliopenErr {
+			e = swgErr.New(http.StatusNotFound, "contact not found")
+		} else {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to export vCards"), err, err.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Data(http.StatusOK, vCardContentType, vcards)
+}
@@ -293,6 +293,29 @@ func Actions(ctx *gin.Context) {
 			} else {
 				ctx.Status(http.StatusNoContent)
 			}
+		case "push-subscribe":
+			// params is the JSON serialization of the PushSubscription got by device's user agent
+			subscription := new(PushSubscription)
+			params, ok := actions.Params.(map[string]interface{})
+			if !ok || subscription.UnmarshalMap(params) != nil {
+				e := swgErr.New(http.StatusUnprocessableEntity, "params is missing or malformed")
+				http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+				ctx.Abort()
+				return
+			}
+			err := caliopen.Facilities.RESTfacility.SubscribeDevicePush(userId, deviceId, subscription)
+			if err != nil {
+				serveActionError(ctx, err)
+			} else {
+				ctx.Status(http.StatusNoContent)
+			}
+		case "push-unsubscribe":
+			err := caliopen.Facilities.RESTfacility.UnsubscribeDevicePush(userId, deviceId)
+			if err != nil {
+				serveActionError(ctx, err)
+			} else {
+				ctx.Status(http.StatusNoContent)
+			}
 		default:
 			e := swgErr.New(http.StatusNotImplemented, "unknown action "+actions.Actions[0])
 			http_middleware.ServeError(ctx.Writer, ctx.Request, e)
@@ -306,6 +329,20 @@ func Actions(ctx *gin.Context) {
 	}
 }
 
+func serveActionError(ctx *gin.Context, err CaliopenError) {
+	var returnedErr *swgErr.CompositeError
+	switch err.Code() {
+	case NotFoundCaliopenErr:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusNotFound, "device not found"), err, err.Cause())
+	case UnprocessableCaliopenErr:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, err.Error()), err, err.Cause())
+	default:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, err.Error()), err, err.Cause())
+	}
+	http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+	ctx.Abort()
+}
+
 // ValidateDevice handles GET /validate-device/:token
 func ValidateDevice(ctx *gin.Context) {
 
@@ -327,7 +364,7 @@ func ValidateDevice(ctx *gin.Context) {
 		return
 	}
 
-	err = caliopen.Facilities.RESTfacility.ConfirmDeviceValidation(userId, token)
+	err = caliopen.Facilities.RESTfacility.ConfirmDeviceValidation(userId, token, caliopen.Facilities.Notifiers)
 
 	if err != nil {
 		e := swgErr.New(http.StatusNotFound, err.Error())
@@ -16,6 +16,7 @@ import (
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	log "github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 	swgErr "github.com/go-openapi/errors"
 	"github.com/satori/go.uuid"
@@ -268,6 +269,94 @@ func PatchRemoteIdentity(ctx *gin.Context) {
 	}
 }
 
+// GetRemoteIdentityStatus handles GET …/identities/remotes/:remote_id/status
+func GetRemoteIdentityStatus(ctx *gin.Context) {
+	userId, err := operations.NormalizeUUIDstring(ctx.GetString("user_id"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	remoteId, err := operations.NormalizeUUIDstring(ctx.Param("remote_id"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	status, apiErr := caliopen.Facilities.RESTfacility.RetrieveRemoteIdentityStatus(userId, remoteId)
+	if apiErr != nil {
+		returnedErr := new(swgErr.CompositeError)
+		switch apiErr.Code() {
+		case NotFoundCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusNotFound, "remote identity not found"), apiErr, apiErr.Cause())
+		case DbCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to call store"), apiErr, apiErr.Cause())
+		case FailDependencyCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to get status from idpoller"), apiErr, apiErr.Cause())
+		default:
+			returnedErr = swgErr.CompositeValidationError(apiErr, apiErr.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
+
+// RemoteIdentityActions handles POST …/identities/remotes/:remote_id/actions
+func RemoteIdentityActions(ctx *gin.Context) {
+	userId, err := operations.NormalizeUUIDstring(ctx.MustGet("user_id").(string))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	remoteId, err := operations.NormalizeUUIDstring(ctx.Param("remote_id"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	var actions ActionsPayload
+	if err := ctx.BindJSON(&actions); err != nil {
+		log.WithError(err).Errorf("failed to bind json payload to ActionsPayload struct")
+		e := swgErr.New(http.StatusBadRequest, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	if len(actions.Actions) != 1 {
+		e := swgErr.New(http.StatusUnprocessableEntity, "exactly one action is expected")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	apiErr := caliopen.Facilities.RESTfacility.RemoteIdentityAction(userId, remoteId, actions.Actions[0])
+	if apiErr != nil {
+		returnedErr := new(swgErr.CompositeError)
+		switch apiErr.Code() {
+		case UnprocessableCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "api returned unprocessable error"), apiErr, apiErr.Cause())
+		case NotFoundCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusNotFound, "remote identity not found"), apiErr, apiErr.Cause())
+		case TooManyRequestsCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusTooManyRequests, "too many actions requested"), apiErr, apiErr.Cause())
+		case DbCaliopenErr, FailDependencyCaliopenErr:
+			returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to process action"), apiErr, apiErr.Cause())
+		default:
+			returnedErr = swgErr.CompositeValidationError(apiErr, apiErr.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+		ctx.Abort()
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
 // DeleteRemoteIdentity handles DELETE …/identities/remotes/:remote_id
 func DeleteRemoteIdentity(ctx *gin.Context) {
 	var err error
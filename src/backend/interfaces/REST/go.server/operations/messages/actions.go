@@ -5,6 +5,7 @@
 package messages
 
 import (
+	"errors"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
 	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
@@ -13,6 +14,7 @@ import (
 	"github.com/gin-gonic/gin"
 	swgErr "github.com/go-openapi/errors"
 	"net/http"
+	"time"
 )
 
 // POST …/:message_id/actions
@@ -31,21 +33,25 @@ func Actions(ctx *gin.Context) {
 	if err := ctx.BindJSON(&actions); err == nil {
 		switch actions.Actions[0] {
 		case "send":
-			updated_msg, err := caliopen.Facilities.RESTfacility.SendDraft(user_info, msg_id)
+			sendAt, err := sendAtParam(actions.Params)
 			if err != nil {
 				e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
 				http_middleware.ServeError(ctx.Writer, ctx.Request, e)
 				ctx.Abort()
+				return
+			}
+			updated_msg, apiErr := caliopen.Facilities.RESTfacility.ScheduleDraft(user_info, msg_id, sendAt)
+			if apiErr != nil {
+				serveDraftActionError(ctx, apiErr)
+			} else {
+				serveDraft(ctx, updated_msg)
+			}
+		case "cancel_send":
+			updated_msg, apiErr := caliopen.Facilities.RESTfacility.CancelScheduledSend(user_info, msg_id)
+			if apiErr != nil {
+				serveDraftActionError(ctx, apiErr)
 			} else {
-				// TODO : find the correct body_type to use
-				msg_json, err := updated_msg.MarshalFrontEnd("plain_text")
-				if err != nil {
-					e := swgErr.New(http.StatusFailedDependency, err.Error())
-					http_middleware.ServeError(ctx.Writer, ctx.Request, e)
-					ctx.Abort()
-				} else {
-					ctx.Data(http.StatusOK, "application/json; charset=utf-8", msg_json)
-				}
+				serveDraft(ctx, updated_msg)
 			}
 		case "set_read":
 			err := caliopen.Facilities.RESTfacility.SetMessageUnread(user_info, msg_id, false)
@@ -77,3 +83,55 @@ func Actions(ctx *gin.Context) {
 		ctx.Abort()
 	}
 }
+
+// sendAtParam returns the optional `send_at` param of the send action, as a RFC3339 date
+func sendAtParam(params interface{}) (sendAt time.Time, err error) {
+	if params == nil {
+		return
+	}
+	p, ok := params.(map[string]interface{})
+	if !ok {
+		return sendAt, errors.New("params must be an object")
+	}
+	value, ok := p["send_at"]
+	if !ok || value == nil {
+		return
+	}
+	date, ok := value.(string)
+	if !ok {
+		return sendAt, errors.New("send_at must be a RFC3339 date")
+	}
+	sendAt, err = time.Parse(time.RFC3339, date)
+	if err != nil {
+		return sendAt, errors.New("send_at must be a RFC3339 date")
+	}
+	return
+}
+
+func serveDraft(ctx *gin.Context, draft *Message) {
+	// TODO : find the correct body_type to use
+	msg_json, err := draft.MarshalFrontEnd("plain_text")
+	if err != nil {
+		e := swgErr.New(http.StatusFailedDependency, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+	} else {
+		ctx.Data(http.StatusOK, "application/json; charset=utf-8", msg_json)
+	}
+}
+
+func serveDraftActionError(ctx *gin.Context, apiErr CaliopenError) {
+	returnedErr := new(swgErr.CompositeError)
+	switch apiErr.Code() {
+	case UnprocessableCaliopenErr:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "api returned unprocessable error"), apiErr, apiErr.Cause())
+	case NotFoundCaliopenErr:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusNotFound, "draft not found"), apiErr, apiErr.Cause())
+	case ForbiddenCaliopenErr:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusForbidden, "forbidden action"), apiErr, apiErr.Cause())
+	default:
+		returnedErr = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to process action"), apiErr, apiErr.Cause())
+	}
+	http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+	ctx.Abort()
+}
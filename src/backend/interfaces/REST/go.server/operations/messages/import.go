@@ -0,0 +1,126 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package messages
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/REST"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+)
+
+const (
+	importMaxMemory = 32 << 20 // uploaded files above this size are buffered on disk
+	importMaxSize   = 2 << 30  // requests above this size are rejected
+)
+
+// importResponse is the public view of an import, without uploaded file's location
+type importResponse struct {
+	DateInsert time.Time `json:"date_insert"`
+	DateUpdate time.Time `json:"date_update"`
+	Duplicates int       `json:"duplicates"`
+	Errors     []string  `json:"errors,omitempty"`
+	Failed     int       `json:"failed"`
+	Format     string    `json:"format"`
+	IdentityId string    `json:"identity_id"`
+	ImportId   string    `json:"import_id"`
+	Imported   int       `json:"imported"`
+	Status     string    `json:"status"`
+}
+
+func newImportResponse(mbImport *MailboxImport) importResponse {
+	return importResponse{
+		DateInsert: mbImport.DateInsert,
+		DateUpdate: mbImport.DateUpdate,
+		Duplicates: mbImport.Duplicates,
+		Errors:     mbImport.Errors,
+		Failed:     mbImport.Failed,
+		Format:     mbImport.Format,
+		IdentityId: mbImport.IdentityId,
+		ImportId:   mbImport.ImportId,
+		Imported:   mbImport.Imported,
+		Status:     mbImport.Status,
+	}
+}
+
+// POST …/imports/mailbox
+// multipart form with one or more "file" and the "identity_id" messages are imported for
+func ImportMailbox(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, importMaxSize)
+	err := ctx.Request.ParseMultipartForm(importMaxMemory)
+	if err != nil {
+		var status int32 = http.StatusUnprocessableEntity
+		if strings.Contains(err.Error(), "request body too large") {
+			status = http.StatusRequestEntityTooLarge
+		}
+		e := swgErr.New(status, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	defer ctx.Request.MultipartForm.RemoveAll()
+	identityId, err := operations.NormalizeUUIDstring(ctx.Request.FormValue("identity_id"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, "invalid identity_id : "+err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	headers := ctx.Request.MultipartForm.File["file"]
+	files := make([]REST.MailboxFile, 0, len(headers))
+	for _, header := range headers {
+		var file multipart.File
+		file, err = header.Open()
+		if err != nil {
+			e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+			http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+			ctx.Abort()
+			return
+		}
+		defer file.Close()
+		files = append(files, REST.MailboxFile{Name: header.Filename, Content: file})
+	}
+
+	mbImport, er := caliopen.Facilities.RESTfacility.ImportMailbox(userId, identityId, files)
+	if er != nil {
+		var e error
+		switch er.Code() {
+		case ForbiddenCaliopenErr:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusConflict, "an import is already in progress"), er)
+		case NotFoundCaliopenErr:
+			e = swgErr.New(http.StatusNotFound, "identity not found")
+		case UnprocessableCaliopenErr:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "mailbox can't be imported"), er)
+		default:
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to import mailbox"), er, er.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusAccepted, newImportResponse(mbImport))
+}
+
+// GET …/imports/mailbox
+func GetMailboxImport(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	mbImport, err := caliopen.Facilities.RESTfacility.RetrieveMailboxImport(userId)
+	if err != nil {
+		e := swgErr.New(http.StatusNotFound, "no import found")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusOK, newImportResponse(mbImport))
+}
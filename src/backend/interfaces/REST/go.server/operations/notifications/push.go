@@ -0,0 +1,26 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package notifications
+
+import (
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+	"net/http"
+)
+
+// GetPushKey handles GET /notifications/push_key
+// it returns the application server's VAPID public key that devices need to subscribe to Web Push.
+func GetPushKey(ctx *gin.Context) {
+	key, err := caliopen.Facilities.Notifiers.PushPublicKey()
+	if err != nil {
+		returnedErr := swgErr.CompositeValidationError(swgErr.New(http.StatusNotFound, "web push is not available"), err, err.Cause())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"vapid_public_key": key})
+}
@@ -0,0 +1,105 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package notifications
+
+import (
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+const keepAliveInterval = 30 * time.Second
+
+// StreamNotifications handles GET /notifications/stream
+// notifications are pushed as server-sent events as soon as they are issued for user.
+// Client resumes an interrupted stream by giving the id of the last notification it received,
+// either within `Last-Event-ID` header or `last_notif_id` query param : notifications issued in between are sent first.
+func StreamNotifications(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	lastId := ctx.GetHeader("Last-Event-ID")
+	if lastId == "" {
+		lastId = ctx.Query("last_notif_id")
+	}
+
+	// subscribe before retrieving missed notifications to not lose the ones issued in between
+	stream, err := caliopen.Facilities.Notifiers.SubscribeNotifications(userId)
+	if err != nil {
+		serveStreamError(ctx, err)
+		return
+	}
+	defer stream.Close()
+
+	missed := []Notification{}
+	if lastId != "" {
+		missed, err = caliopen.Facilities.Notifiers.RetrieveNotificationsSince(userId, lastId)
+		if err != nil {
+			serveStreamError(ctx, err)
+			return
+		}
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no") // prevent reverse proxies from buffering stream
+	ctx.Status(http.StatusOK)
+
+	sent := make(map[string]bool)
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	ctx.Stream(func(w io.Writer) bool {
+		if len(missed) > 0 {
+			for i := range missed {
+				sent[missed[i].NotifId.String()] = true
+				if writeEvent(w, &missed[i]) != nil {
+					return false
+				}
+			}
+			missed = nil
+			return true
+		}
+		select {
+		case notif := <-stream.Notifications:
+			if sent[notif.NotifId.String()] {
+				return true
+			}
+			return writeEvent(w, notif) == nil
+		case <-keepAlive.C:
+			_, e := io.WriteString(w, ": keep-alive\n\n")
+			return e == nil
+		}
+	})
+}
+
+// writeEvent writes notification as a server-sent event, with notification id as event id to allow resuming
+func writeEvent(w io.Writer, notif *Notification) error {
+	json_notif, err := notif.MarshalFrontEnd()
+	if err != nil {
+		return nil // skip notification
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", notif.NotifId.String(), json_notif)
+	return err
+}
+
+func serveStreamError(ctx *gin.Context, err CaliopenError) {
+	var e error
+	switch err.Code() {
+	case UnprocessableCaliopenErr:
+		e = swgErr.New(http.StatusUnprocessableEntity, err.Error())
+	case FailDependencyCaliopenErr:
+		e = swgErr.New(http.StatusFailedDependency, err.Error())
+	default:
+		e = swgErr.New(http.StatusInternalServerError, err.Error())
+	}
+	returnedErr := swgErr.CompositeValidationError(e, err, err.Cause())
+	http_middleware.ServeError(ctx.Writer, ctx.Request, returnedErr)
+	ctx.Abort()
+}
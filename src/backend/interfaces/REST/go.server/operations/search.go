@@ -26,6 +26,7 @@ func SimpleSearch(ctx *gin.Context) {
 	shard_id := ctx.MustGet("shard_id").(string)
 	var user_UUID UUID
 	var limit, offset int
+	var err error
 	user_UUID.UnmarshalBinary(user_uuid.Bytes())
 	query := ctx.Request.URL.Query()
 
@@ -37,9 +38,10 @@ func SimpleSearch(ctx *gin.Context) {
 		reasons = append(reasons, errors.New("invalid query length"))
 	}
 	term, term_ok := query["term"]
-	if !term_ok {
+	q, q_ok := query["q"]
+	if !term_ok && !q_ok {
 		invalid = true
-		reasons = append(reasons, errors.New("'term' param is missing"))
+		reasons = append(reasons, errors.New("'term' or 'q' param is missing"))
 	}
 	for _, t := range term {
 		if len(t) < 3 {
@@ -47,6 +49,21 @@ func SimpleSearch(ctx *gin.Context) {
 			reasons = append(reasons, errors.New("'term' param must length 3 chars at least"))
 		}
 	}
+	var clauses SearchQuery
+	if q_ok {
+		if len(q) > 1 {
+			invalid = true
+			reasons = append(reasons, errors.New("at most one 'q' param allowed"))
+		} else if parsed, err := ParseSearchQuery(q[0]); err != nil {
+			invalid = true
+			reasons = append(reasons, err)
+		} else if len(parsed) == 0 {
+			invalid = true
+			reasons = append(reasons, errors.New("'q' param is empty"))
+		} else {
+			clauses = parsed
+		}
+	}
 	doc_type, has_doc_type := query["doctype"]
 
 	if l, ok := query["limit"]; ok {
@@ -73,16 +90,20 @@ func SimpleSearch(ctx *gin.Context) {
 		Limit:    limit,
 		Offset:   offset,
 		ILrange:  GetImportanceLevel(ctx),
+		Query:    clauses,
 	}
 
 	if field, ok := query["field"]; ok {
 		if len(field) > 1 {
 			invalid = true
 			reasons = append(reasons, errors.New("at most one 'field' param allowed"))
+		} else if !term_ok {
+			invalid = true
+			reasons = append(reasons, errors.New("'field' param only allowed if 'term' param also provided"))
 		} else {
 			search.Terms = map[string][]string{field[0]: query["term"]} // take only first field provided for now
 		}
-	} else {
+	} else if term_ok {
 		search.Terms = map[string][]string{"_all": query["term"]}
 	}
 
@@ -90,16 +111,9 @@ func SimpleSearch(ctx *gin.Context) {
 		if len(doc_type) > 1 {
 			invalid = true
 			reasons = append(reasons, errors.New("at most one 'doctype' param allowed"))
-		} else {
-			switch doc_type[0] { // take only first doctype provided for now
-			case "message":
-				search.DocType = MessageIndexType
-			case "contact":
-				search.DocType = ContactIndexType
-			default:
-				invalid = true
-				reasons = append(reasons, errors.New("'doctype' unknown"))
-			}
+		} else if search.DocType, err = searchDocType(doc_type[0]); err != nil { // take only first doctype provided for now
+			invalid = true
+			reasons = append(reasons, err)
 		}
 	}
 
@@ -110,6 +124,91 @@ func SimpleSearch(ctx *gin.Context) {
 		return
 	}
 
+	serveSearch(ctx, search)
+}
+
+// POST …/search
+// body holds an advanced search `query` string and/or structured `filters`, see ParseSearchQuery
+func AdvancedSearch(ctx *gin.Context) {
+	var payload advancedSearch
+	if err := ctx.BindJSON(&payload); err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+
+	user_uuid, _ := uuid.FromString(ctx.MustGet("user_id").(string))
+	var user_UUID UUID
+	user_UUID.UnmarshalBinary(user_uuid.Bytes())
+	search := IndexSearch{
+		User_id:  user_UUID,
+		Shard_id: ctx.MustGet("shard_id").(string),
+		ILrange:  GetImportanceLevel(ctx),
+	}
+
+	reasons := []error{}
+	if payload.Query != "" {
+		clauses, err := ParseSearchQuery(payload.Query)
+		if err != nil {
+			reasons = append(reasons, err)
+		}
+		search.Query = append(search.Query, clauses...)
+	}
+	for _, filter := range payload.Filters.Normalized() {
+		if err := filter.Validate(); err != nil {
+			reasons = append(reasons, err)
+		}
+		search.Query = append(search.Query, filter)
+	}
+	if len(reasons) == 0 && len(search.Query) == 0 {
+		reasons = append(reasons, errors.New("'query' or 'filters' must be provided"))
+	}
+	var err error
+	if search.DocType, err = searchDocType(payload.Doctype); err != nil {
+		reasons = append(reasons, err)
+	}
+	if search.DocType == "" && (payload.Limit != 0 || payload.Offset != 0) {
+		reasons = append(reasons, errors.New("'limit' and 'offset' only allowed if 'doctype' also provided"))
+	}
+	if payload.Limit < 0 || payload.Offset < 0 {
+		reasons = append(reasons, errors.New("'limit' and 'offset' must be positive"))
+	}
+	search.Limit, search.Offset = payload.Limit, payload.Offset
+
+	if len(reasons) > 0 {
+		e := swgErr.CompositeValidationError(reasons...)
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+
+	serveSearch(ctx, search)
+}
+
+type advancedSearch struct {
+	Query   string      `json:"query"`
+	Filters SearchQuery `json:"filters"`
+	Doctype string      `json:"doctype"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+}
+
+// searchDocType returns the index type of a `doctype` search param
+func searchDocType(doctype string) (string, error) {
+	switch doctype {
+	case "message":
+		return MessageIndexType, nil
+	case "contact":
+		return ContactIndexType, nil
+	case "":
+		return "", nil
+	}
+	return "", errors.New("'doctype' unknown")
+}
+
+// serveSearch triggers a validated search and writes its result to response
+func serveSearch(ctx *gin.Context, search IndexSearch) {
 	// trigger the search
 	result, err := caliopen.Facilities.RESTfacility.Search(search)
 
@@ -129,7 +228,3 @@ func SimpleSearch(ctx *gin.Context) {
 
 	}
 }
-
-func AdvancedSearch(ctx *gin.Context) {
-	ctx.AbortWithStatus(http.StatusNotImplemented)
-}
@@ -0,0 +1,46 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package operations
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// searchTestRouter serves search handlers for an authenticated user
+func searchTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("user_id", uuid.NewV4().String())
+		ctx.Set("shard_id", "shard")
+	})
+	router.GET("/search", SimpleSearch)
+	router.POST("/search", AdvancedSearch)
+	return router
+}
+
+func TestSearch_InvalidQuery(t *testing.T) {
+	router := searchTestRouter()
+	for _, request := range []*http.Request{
+		httptest.NewRequest("GET", "/search?q="+url.QueryEscape(`from:alice "unterminated`), nil),
+		httptest.NewRequest("GET", "/search?q="+url.QueryEscape(`is:starred`), nil),
+		httptest.NewRequest("POST", "/search", strings.NewReader(`{"query": "pi>high"}`)),
+		httptest.NewRequest("POST", "/search", strings.NewReader(`{"filters": [{"field": "unknown", "value": "value"}]}`)),
+	} {
+		request.Header.Set("X-Caliopen-IL", "-10;10")
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected %s %s to be rejected with 422, got %d %s", request.Method, request.URL, recorder.Code, recorder.Body.String())
+		}
+	}
+}
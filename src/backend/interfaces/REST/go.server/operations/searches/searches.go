@@ -0,0 +1,192 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package searches
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+	"github.com/satori/go.uuid"
+)
+
+// GET …/searches
+func RetrieveSavedSearches(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	searches, err := caliopen.Facilities.RESTfacility.RetrieveSavedSearches(userId)
+	if err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	var respBuf bytes.Buffer
+	respBuf.WriteString("{\"total\": " + strconv.Itoa(len(searches)) + ",")
+	respBuf.WriteString("\"searches\":[")
+	first := true
+	for _, search := range searches {
+		searchJson, err := search.MarshalFrontEnd()
+		if err == nil {
+			if first {
+				first = false
+			} else {
+				respBuf.WriteByte(',')
+			}
+			respBuf.Write(searchJson)
+		}
+	}
+	respBuf.WriteString("]}")
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", respBuf.Bytes())
+}
+
+// POST …/searches
+func CreateSavedSearch(ctx *gin.Context) {
+	var search SavedSearch
+	if err := ctx.BindJSON(&search); err != nil {
+		e := swgErr.New(http.StatusBadRequest, "unable to json marshal the provided payload : "+err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	userUuid, _ := uuid.FromString(ctx.MustGet("user_id").(string))
+	search.UserId.UnmarshalBinary(userUuid.Bytes())
+	if err := caliopen.Facilities.RESTfacility.CreateSavedSearch(&search); err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, struct{ Location string }{
+		http_middleware.RoutePrefix + http_middleware.SearchesRoute + "/" + search.SearchId.String(),
+	})
+}
+
+// GET …/searches/:search_id
+func RetrieveSavedSearch(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	searchId, ok := searchIdParam(ctx)
+	if !ok {
+		return
+	}
+	search, err := caliopen.Facilities.RESTfacility.RetrieveSavedSearch(userId, searchId)
+	if err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	searchJson, e := search.MarshalFrontEnd()
+	if e != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusFailedDependency, e.Error()))
+		ctx.Abort()
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", searchJson)
+}
+
+// PATCH …/searches/:search_id
+func PatchSavedSearch(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	searchId, ok := searchIdParam(ctx)
+	if !ok {
+		return
+	}
+	patch, e := ioutil.ReadAll(ctx.Request.Body)
+	if e != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusUnprocessableEntity, e.Error()))
+		ctx.Abort()
+		return
+	}
+	if _, err := caliopen.Facilities.RESTfacility.PatchSavedSearch(patch, userId, searchId); err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DELETE …/searches/:search_id
+func DeleteSavedSearch(ctx *gin.Context) {
+	userId := ctx.MustGet("user_id").(string)
+	searchId, ok := searchIdParam(ctx)
+	if !ok {
+		return
+	}
+	if err := caliopen.Facilities.RESTfacility.DeleteSavedSearch(userId, searchId); err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GET …/searches/:search_id/results
+// messages currently matching saved search, within importance level range of X-Caliopen-IL header if any,
+// along with the count of unread ones.
+func RetrieveSavedSearchResults(ctx *gin.Context) {
+	user := &UserInfo{User_id: ctx.MustGet("user_id").(string), Shard_id: ctx.MustGet("shard_id").(string)}
+	searchId, ok := searchIdParam(ctx)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+	offset, _ := strconv.Atoi(ctx.Query("offset"))
+	if limit < 0 || offset < 0 {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusUnprocessableEntity, "'limit' and 'offset' must be positive"))
+		ctx.Abort()
+		return
+	}
+	results, err := caliopen.Facilities.RESTfacility.RetrieveSavedSearchResults(user, searchId, limit, offset, operations.GetImportanceLevel(ctx))
+	if err != nil {
+		serveSearchError(ctx, err)
+		return
+	}
+	searchJson, e := results.Search.MarshalFrontEnd()
+	if e != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusFailedDependency, e.Error()))
+		ctx.Abort()
+		return
+	}
+	resultJson, e := results.Result.MarshalFrontEnd()
+	if e != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusFailedDependency, e.Error()))
+		ctx.Abort()
+		return
+	}
+	var respBuf bytes.Buffer
+	respBuf.WriteString("{\"search\":")
+	respBuf.Write(searchJson)
+	respBuf.WriteString(",\"unread\":" + strconv.FormatInt(results.Unread, 10))
+	respBuf.WriteString(",\"result\":")
+	respBuf.Write(resultJson)
+	respBuf.WriteByte('}')
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", respBuf.Bytes())
+}
+
+// searchIdParam returns the normalized search_id param of route, or serves an error
+func searchIdParam(ctx *gin.Context) (string, bool) {
+	searchId, err := operations.NormalizeUUIDstring(ctx.Param("search_id"))
+	if err != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusUnprocessableEntity, "search_id is invalid"))
+		ctx.Abort()
+		return "", false
+	}
+	return searchId, true
+}
+
+func serveSearchError(ctx *gin.Context, apiErr CaliopenError) {
+	var e error
+	switch apiErr.Code() {
+	case NotFoundCaliopenErr:
+		e = swgErr.New(http.StatusNotFound, "saved search not found")
+	case UnprocessableCaliopenErr:
+		e = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "invalid saved search"), apiErr, apiErr.Cause())
+	case ForbiddenCaliopenErr:
+		e = swgErr.CompositeValidationError(swgErr.New(http.StatusForbidden, "forbidden"), apiErr)
+	default:
+		e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to process saved search"), apiErr, apiErr.Cause())
+	}
+	http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+	ctx.Abort()
+}
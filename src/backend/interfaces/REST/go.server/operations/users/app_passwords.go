@@ -0,0 +1,113 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package users
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+)
+
+// appPasswordResponse is the public view of an application password, which is only given in clear at creation
+type appPasswordResponse struct {
+	AppPasswordId string    `json:"app_password_id"`
+	DateInsert    time.Time `json:"date_insert"`
+	Label         string    `json:"label"`
+	Password      string    `json:"password,omitempty"`
+}
+
+func newAppPasswordResponse(password *AppPassword) appPasswordResponse {
+	return appPasswordResponse{
+		AppPasswordId: password.AppPasswordId.String(),
+		DateInsert:    password.DateInsert,
+		Label:         password.Label,
+	}
+}
+
+// GET …/users/{user_id}/app_passwords
+func GetAppPasswords(ctx *gin.Context) {
+	userId, ok := routeUser(ctx)
+	if !ok {
+		return
+	}
+	passwords, err := caliopen.Facilities.RESTfacility.RetrieveAppPasswords(userId)
+	if err != nil {
+		serveAppPasswordError(ctx, err)
+		return
+	}
+	resp := struct {
+		Total     int                   `json:"total"`
+		Passwords []appPasswordResponse `json:"app_passwords"`
+	}{Passwords: []appPasswordResponse{}}
+	for i := range passwords {
+		resp.Passwords = append(resp.Passwords, newAppPasswordResponse(&passwords[i]))
+	}
+	resp.Total = len(resp.Passwords)
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// POST …/users/{user_id}/app_passwords
+func NewAppPassword(ctx *gin.Context) {
+	userId, ok := routeUser(ctx)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Label string `json:"label"`
+	}
+	if err := ctx.BindJSON(&payload); err != nil {
+		e := swgErr.New(http.StatusBadRequest, "unable to json marshal the provided payload : "+err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	password, clear, err := caliopen.Facilities.RESTfacility.CreateAppPassword(userId, payload.Label)
+	if err != nil {
+		serveAppPasswordError(ctx, err)
+		return
+	}
+	resp := newAppPasswordResponse(password)
+	resp.Password = clear
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// DELETE …/users/{user_id}/app_passwords/{app_password_id}
+func DeleteAppPassword(ctx *gin.Context) {
+	userId, ok := routeUser(ctx)
+	if !ok {
+		return
+	}
+	passwordId, e := operations.NormalizeUUIDstring(ctx.Param("app_password_id"))
+	if e != nil {
+		http_middleware.ServeError(ctx.Writer, ctx.Request, swgErr.New(http.StatusUnprocessableEntity, e.Error()))
+		ctx.Abort()
+		return
+	}
+	if err := caliopen.Facilities.RESTfacility.DeleteAppPassword(userId, passwordId); err != nil {
+		serveAppPasswordError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func serveAppPasswordError(ctx *gin.Context, err CaliopenError) {
+	var e error
+	switch err.Code() {
+	case NotFoundCaliopenErr:
+		e = swgErr.New(http.StatusNotFound, "application password not found")
+	case UnprocessableCaliopenErr:
+		e = swgErr.CompositeValidationError(swgErr.New(http.StatusUnprocessableEntity, "invalid application password"), err)
+	default:
+		e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to process application passwords"), err, err.Cause())
+	}
+	http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+	ctx.Abort()
+}
@@ -0,0 +1,126 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package users
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/middlewares"
+	"github.com/CaliOpen/Caliopen/src/backend/interfaces/REST/go.server/operations"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	swgErr "github.com/go-openapi/errors"
+)
+
+// exportResponse is the public view of an export : archive's location and token are only given as a download url
+type exportResponse struct {
+	DateInsert time.Time `json:"date_insert"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ExportId   string    `json:"export_id"`
+	Size       int64     `json:"size,omitempty"`
+	Status     string    `json:"status"`
+	Url        string    `json:"url,omitempty"`
+}
+
+func newExportResponse(export *UserExport) exportResponse {
+	resp := exportResponse{
+		DateInsert: export.DateInsert,
+		ExpiresAt:  export.ExpiresAt,
+		ExportId:   export.ExportId,
+		Size:       export.Size,
+		Status:     export.Status,
+	}
+	if export.Status == ExportReady {
+		resp.Url = ExportDownloadPath + export.Token
+	}
+	return resp
+}
+
+// POST …/users/{user_id}/export
+func RequestExport(ctx *gin.Context) {
+	userId, ok := routeUser(ctx)
+	if !ok {
+		return
+	}
+	export, err := caliopen.Facilities.RESTfacility.RequestUserExport(userId, caliopen.Facilities.Notifiers)
+	if err != nil {
+		var e error
+		if err.Code() == ForbiddenCaliopenErr {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusConflict, "an export is already in progress"), err)
+		} else {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to request export"), err, err.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusAccepted, newExportResponse(export))
+}
+
+// GET …/users/{user_id}/export
+func GetExport(ctx *gin.Context) {
+	userId, ok := routeUser(ctx)
+	if !ok {
+		return
+	}
+	export, err := caliopen.Facilities.RESTfacility.RetrieveUserExport(userId)
+	if err != nil {
+		e := swgErr.New(http.StatusNotFound, "no export found")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	ctx.JSON(http.StatusOK, newExportResponse(export))
+}
+
+// GET …/exports/{export_token}
+// download link is not authenticated : token is the secret, and expires with export
+func DownloadExport(ctx *gin.Context) {
+	export, archive, err := caliopen.Facilities.RESTfacility.OpenUserExport(ctx.Param("export_token"))
+	if err != nil {
+		var e error
+		if err.Code() == NotFoundCaliopenErr {
+			e = swgErr.New(http.StatusNotFound, "export not found or expired")
+		} else {
+			e = swgErr.CompositeValidationError(swgErr.New(http.StatusFailedDependency, "api failed to open export"), err, err.Cause())
+		}
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return
+	}
+	if closer, ok := archive.(io.Closer); ok {
+		defer closer.Close()
+	}
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", `attachment; filename="caliopen-export-`+export.DateInsert.Format("20060102")+`.zip"`)
+	if export.Size > 0 {
+		ctx.Header("Content-Length", strconv.FormatInt(export.Size, 10))
+	}
+	ctx.Status(http.StatusOK)
+	io.Copy(ctx.Writer, archive)
+}
+
+// routeUser checks that authenticated user is the one targeted by route
+func routeUser(ctx *gin.Context) (userId string, ok bool) {
+	authUser := ctx.MustGet("user_id").(string)
+	userId, err := operations.NormalizeUUIDstring(ctx.Param("user_id"))
+	if err != nil {
+		e := swgErr.New(http.StatusUnprocessableEntity, err.Error())
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return "", false
+	}
+	if authUser != userId {
+		e := swgErr.New(http.StatusUnauthorized, "user can only access his own data")
+		http_middleware.ServeError(ctx.Writer, ctx.Request, e)
+		ctx.Abort()
+		return "", false
+	}
+	return userId, true
+}
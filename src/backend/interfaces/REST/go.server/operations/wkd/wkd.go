@@ -0,0 +1,108 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+// Package wkd publishes users' own keys as an OpenPGP Web Key Directory,
+// see https://tools.ietf.org/html/draft-koch-openpgp-webkey-service
+// Web Key Service's submission address is advertised when it is enabled, submissions are handled by lmtpd.
+// Both advanced (/.well-known/openpgpkey/<domain>/…) and direct (/.well-known/openpgpkey/…) layouts are served,
+// domain being taken from request's host for the latter.
+package wkd
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main"
+	"github.com/gin-gonic/gin"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+)
+
+const (
+	binaryKeyContentType  = "application/octet-stream"
+	armoredKeyContentType = "application/pgp-keys" // RFC 3156, ASCII armored keys
+	textContentType       = "text/plain; charset=utf-8"
+)
+
+// GET …/.well-known/openpgpkey/*path
+// serves keys (hu/<hashed local-part>), policy and submission-address files.
+// Keys are binary as required by WKD, unless client only accepts application/pgp-keys
+func WebKeyDirectory(ctx *gin.Context) {
+	// WKD may be queried by web clients
+	ctx.Header("Access-Control-Allow-Origin", "*")
+
+	parts := strings.Split(strings.Trim(ctx.Param("path"), "/"), "/")
+	domain := requestDomain(ctx.Request)
+	if len(parts) == 3 || (len(parts) == 2 && parts[0] != "hu") {
+		// advanced method's layout
+		domain, parts = strings.ToLower(parts[0]), parts[1:]
+	}
+	if domain == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	rest := caliopen.Facilities.RESTfacility
+	switch {
+	case len(parts) == 2 && parts[0] == "hu":
+		keys, err := rest.RetrieveWKDKeys(domain, parts[1], ctx.Query("l"))
+		if err != nil {
+			if err.Code() == NotFoundCaliopenErr {
+				ctx.AbortWithStatus(http.StatusNotFound)
+			} else {
+				ctx.AbortWithStatus(http.StatusFailedDependency)
+			}
+			return
+		}
+		if strings.Contains(ctx.Request.Header.Get("Accept"), armoredKeyContentType) {
+			armored, e := armorKeys(keys)
+			if e != nil {
+				ctx.AbortWithStatus(http.StatusFailedDependency)
+				return
+			}
+			ctx.Data(http.StatusOK, armoredKeyContentType, armored)
+			return
+		}
+		ctx.Data(http.StatusOK, binaryKeyContentType, keys)
+	case len(parts) == 1 && parts[0] == "policy":
+		ctx.Data(http.StatusOK, textContentType, rest.WKDPolicy(domain))
+	case len(parts) == 1 && parts[0] == "submission-address":
+		address, err := rest.WKDSubmissionAddress(domain)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		ctx.Data(http.StatusOK, textContentType, address)
+	default:
+		ctx.AbortWithStatus(http.StatusNotFound)
+	}
+}
+
+// requestDomain returns the lowercased host of request, without port
+func requestDomain(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// armorKeys returns binary keyring in ASCII armor
+func armorKeys(keys []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(keys); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
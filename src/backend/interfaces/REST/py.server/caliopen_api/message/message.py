@@ -3,11 +3,14 @@ from __future__ import absolute_import, print_function, unicode_literals
 
 import logging
 
+import datetime
+import pytz
+
 from cornice.resource import resource, view
 from pyramid.response import Response
 
 from caliopen_main.message.objects.message import Message as ObjectMessage
-from caliopen_main.message.core import RawMessage
+from caliopen_main.message.core import RawMessage, MessageDeletedLookup
 from caliopen_storage.exception import NotFound
 
 from ..base import Api
@@ -91,6 +94,18 @@ class Message(Api):
         except NotFound:
             raise ResourceNotFound
 
+        # record deletion, for it to be reflected onto remote mailboxes
+        # the message has been fetched from
+        message.unmarshall_db()
+        if message.external_msg_id:
+            for identity_id in message.user_identities or []:
+                MessageDeletedLookup.create(
+                    self.user,
+                    identity_id=identity_id,
+                    external_msg_id=message.external_msg_id,
+                    message_id=message.message_id,
+                    date_delete=datetime.datetime.now(tz=pytz.utc))
+
         try:
             message.delete_db()
             message.delete_index()
@@ -0,0 +1,15 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+type AppPasswordStorage interface {
+	RetrieveAppPasswords(userId string) (passwords []AppPassword, err error)
+	CreateAppPassword(password *AppPassword) error
+	DeleteAppPassword(userId, appPasswordId string) error
+}
@@ -27,11 +27,45 @@ type APICache interface {
 	GetTokenValidationSession(userId, token string) (*TokenSession, error)
 	SetDeviceValidationSession(userId, deviceId, token string) (*TokenSession, error)
 	DeleteDeviceValidationSession(userId, deviceId string) error
+	// authentication failures' throttling
+	AuthFailures(key string) (count int, err error)
+	AddAuthFailure(key string, window time.Duration) (count int, err error)
+	// remote identities' actions rate-limiting
+	ThrottleRemoteAction(userId, identityId string, window time.Duration) (throttled bool, until time.Time, err error)
+	// drafts' scheduled sending
+	ScheduleSend(send ScheduledSend) error
+	UnscheduleSend(userId, messageId string) (unscheduled bool, err error)
+	ClaimScheduledSend(userId, messageId string, lease time.Duration) (claimed bool, err error)
+	CompleteScheduledSend(userId, messageId string) error
+	ReleaseScheduledSend(userId, messageId string) error
+	DueScheduledSends(until time.Time, max int64) (sends []ScheduledSend, err error)
+	// users' data exports
+	SetUserExport(export *UserExport) error
+	GetUserExport(userId string) (*UserExport, error)
+	GetUserExportByToken(token string) (*UserExport, error)
+	ExpiredUserExports(until time.Time, max int64) (uris []string, err error)
+	RemoveStoredExport(uri string) (removed bool, err error)
+	// mailbox imports
+	SetMailboxImport(mbImport *MailboxImport) error
+	GetMailboxImport(userId string) (*MailboxImport, error)
+	ClaimMailboxImport(userId, importId string, ttl time.Duration) (claimed bool, err error)
+	ReleaseMailboxImport(userId, importId string) error
+	// deleted users' purge
+	PurgeUserSessions(userId string, deviceIds []string) (count int, err error)
+	CountUserSessions(userId string) (count int, err error)
 }
 
 type CacheBackend interface {
 	// CRD interface to the underlying backend
 	Set(key string, value []byte, ttl time.Duration) error
+	SetNX(key string, value []byte, ttl time.Duration) (set bool, err error) // sets key only if it does not exist
 	Get(key string) (value []byte, err error)
 	Del(key string) error
+	Incr(key string, ttl time.Duration) (count int64, err error) // ttl is set when key is created
+	Keys(pattern string) (keys []string, err error)              // glob-style pattern, see redis' SCAN
+	// sorted sets
+	ZAdd(key string, score float64, member string) error
+	ZRangeByScore(key string, max float64, count int64) (members []string, scores []float64, err error)
+	ZRem(key, member string) (removed bool, err error)
+	ZScore(key, member string) (score float64, found bool, err error)
 }
@@ -17,6 +17,11 @@ type ContactStorage interface {
 	UpdateContact(contact, oldContact *Contact, fields map[string]interface{}) error
 	DeleteContact(contact *Contact) error
 	ContactExists(userId, contactId string) bool
+	RetrieveContactLookups(userId string) (lookups []ContactByContactPoints, err error)
+	// cards named by CardDAV clients
+	RetrieveCardDAVContactId(userId, name string) (contactId string, err error)
+	SetCardDAVName(userId, name, contactId string) error
+	DeleteCardDAVName(userId, name string) error
 }
 
 type ContactIndex interface {
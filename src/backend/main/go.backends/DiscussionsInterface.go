@@ -13,4 +13,5 @@ import (
 type DiscussionStorage interface {
 	GetDiscussion(user_id, discussion_id UUID) (*Discussion, error)
 	GetOrCreateDiscussion(user_id UUID, participants []Participant) (*Discussion, error)
+	MoveDiscussionLookup(user_id UUID, before, after []Participant) error
 }
@@ -0,0 +1,20 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"io"
+)
+
+// ExportStorage is the store side of users' data exports.
+// Returned chans must be drained by callers.
+type ExportStorage interface {
+	RetrieveUserMessages(userId string) (<-chan *Message, error)
+	RetrieveUserContacts(userId string) (<-chan *Contact, error)
+	PutUserExport(name string, archive io.Reader) (uri string, size int64, err error)
+	GetUserExport(uri string) (archive io.Reader, err error)
+	RemoveUserExport(uri string) error
+}
@@ -17,6 +17,7 @@ type (
 		RetrieveUserIdentity(userId, RemoteId string, withCredentials bool) (*UserIdentity, error)
 		LookupIdentityByIdentifier(string, ...string) ([][2]string, error)
 		LookupIdentityByType(string, ...string) ([][2]string, error)
+		LookupWKDIdentity(domain, hash string) (*WKDLookup, error)
 		IdentityStorageUpdater
 		DeleteUserIdentity(userIdentity *UserIdentity) error
 		RetrieveRemoteIdentities(userId string, withCredentials bool) ([]*UserIdentity, error)
@@ -0,0 +1,16 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	"io"
+)
+
+// ImportStorage keeps uploaded mailboxes until workers have imported them
+type ImportStorage interface {
+	PutMailboxImport(name string, mailbox io.Reader) (uri string, size int64, err error)
+	GetMailboxImport(uri string) (mailbox io.Reader, err error)
+	RemoveMailboxImport(uri string) error
+}
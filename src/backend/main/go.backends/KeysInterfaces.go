@@ -17,3 +17,9 @@ type KeysStorage interface {
 	DeletePubKey(pubkey *PublicKey) CaliopenError
 	UpdatePubKey(newPubKey, oldPubKey *PublicKey, modifiedFields map[string]interface{}) CaliopenError
 }
+
+// KeyDiscoveryStore is needed by key discovery worker to attach keys found for contacts' addresses
+type KeyDiscoveryStore interface {
+	ContactStorage
+	KeysStorage
+}
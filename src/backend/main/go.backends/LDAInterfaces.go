@@ -22,25 +22,49 @@ type LDAStore interface {
 	GetRawMessage(raw_message_id string) (raw_message RawMessage, err error)
 	SetDeliveredStatus(raw_msg_id string, delivered bool) error
 	UpdateMessage(msg *Message, fields map[string]interface{}) error // 'fields' are the struct fields names that have been modified
+	DeleteMessage(msg *Message) error
 	CreateThreadLookup(user_id, discussion_id UUID, external_msg_id string) error
 	SeekMessageByExternalRef(userID, externalMessageID, identityID string) (UUID, error)
+	CreateMessageExternalRefLookup(userID, identityID, messageID UUID, externalMessageID string) error
+	IsMessageDeleted(userID, identityID, externalMessageID string) (bool, error)
+	RemoveMessageDeletedLookup(userID, identityID, externalMessageID string) error
 
 	LookupContactsByIdentifier(user_id, address string) (contact_ids []string, err error)
+	RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError)
+	RetrieveContact(userID, contactID string) (*Contact, error)
+	RetrieveUserContactId(userID string) string
+	CreatePGPPubKey(pubkey *PublicKey) CaliopenError
+	DeletePubKey(pubkey *PublicKey) CaliopenError
+	RetrieveAutocryptPeer(userId, address string) (*AutocryptPeer, CaliopenError)
+	SaveAutocryptPeer(peer *AutocryptPeer) CaliopenError
+	CreateWKSRequest(request *WKSRequest) CaliopenError
+	RetrieveWKSRequest(nonce string) (*WKSRequest, CaliopenError)
+	DeleteWKSRequest(nonce string) CaliopenError
 
 	GetAttachment(uri string) (file io.Reader, err error)
 	DeleteAttachment(uri string) error
 	AttachmentExists(uri string) bool
 
 	RetrieveUserIdentity(userId, identityId string, withCredentials bool) (*UserIdentity, error)
+	LookupIdentityByIdentifier(identifier string, params ...string) ([][2]string, error)
+	LookupWKDIdentity(domain, hash string) (*WKDLookup, error)
 	UpdateUserIdentity(userIdentity *UserIdentity, fields map[string]interface{}) error
 	RetrieveUser(user_id string) (user *User, err error)
 	UpdateRemoteInfosMap(userId, remoteId string, infos map[string]string) error
 	RetrieveRemoteInfosMap(userId, remoteId string) (infos map[string]string, err error)
 	TimestampRemoteLastCheck(userId, remoteId string, time ...time.Time) error
+
+	RetrieveUserTags(user_id string) (tags []Tag, err error)
+	CreateTag(tag *Tag) error
+	RetrieveSavedSearches(userId string) (searches []SavedSearch, err error)
+
+	GetMailboxImport(uri string) (mailbox io.Reader, err error)
+	RemoveMailboxImport(uri string) error
 }
 
 type LDAIndex interface {
 	Close()
 	CreateMessage(user *UserInfo, msg *Message) error
 	UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error
+	DeleteMessage(user *UserInfo, msg *Message) error
 }
@@ -9,6 +9,7 @@ type MessageStorage interface {
 	RetrieveMessage(user_id, msg_id string) (msg *Message, err error)
 	UpdateMessage(msg *Message, fields map[string]interface{}) error // 'fields' are the struct fields names that have been modified
 	DeleteMessage(msg *Message) error
+	CreateMessageExternalRefLookup(userID, identityID, messageID UUID, externalMessageID string) error
 	SetMessageUnread(user_id, message_id string, status bool) error
 	GetRawMessage(raw_message_id string) (raw_message RawMessage, err error)
 }
@@ -17,6 +18,8 @@ type MessageIndex interface {
 	SetMessageUnread(user *UserInfo, message_id string, status bool) error
 	CreateMessage(user *UserInfo, msg *Message) error
 	UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error
+	DeleteMessage(user *UserInfo, msg *Message) error
 	FilterMessages(search IndexSearch) (messages []*Message, totalFound int64, err error)
 	GetMessagesRange(search IndexSearch) (messages []*Message, totalFound int64, err error)
+	FindMessagesByContact(user *UserInfo, contactId string) (messageIds []string, err error) // messages with contact among participants
 }
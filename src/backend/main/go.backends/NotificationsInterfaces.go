@@ -16,8 +16,19 @@ type NotificationsStore interface {
 	PutNotificationInQueue(*Notification) error
 	RetrieveNotifications(userId string, from, to time.Time) ([]Notification, error)
 	DeleteNotifications(userId string, until time.Time) error
+	GetSettings(userId string) (settings *Settings, err error)                   // to honour user's notification settings when pushing
+	RetrieveDevices(userId string) (devices []Device, err error)                 // to push notifications to user's devices
+	UpdateDevice(device, oldDevice *Device, fields map[string]interface{}) error // to drop expired push subscriptions
+	RetrieveMessage(userId, msgId string) (msg *Message, err error)              // to build pushed message excerpts
+	RetrieveUser(userId string) (user *User, err error)
+	RetrieveSettingsWithDigest() (settings []Settings, err error)
+	RetrieveDigestState(userId string) (sent, leaseUntil time.Time, err error)
+	ClaimDigest(userId string, previousLease, until time.Time) (claimed bool, err error)
+	SetDigestDate(userId string, date time.Time) error
+	ReleaseDigest(userId string, lease time.Time) error
 }
 
 type NotificationsIndex interface {
 	CreateMessage(user *UserInfo, msg *Message) error
+	FilterMessages(search IndexSearch) (messages []*Message, totalFound int64, err error) // to build digests of unread messages
 }
@@ -0,0 +1,30 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"time"
+)
+
+// PurgeStorage is the store side of deleted users' purge
+type PurgeStorage interface {
+	RetrieveUserPurge(userId string) (purge *UserPurge, err error)
+	RetrieveUnfinishedPurges() (purges []UserPurge, err error)
+	SaveUserPurge(purge *UserPurge) error
+	ClaimUserPurge(userId string, previous, until time.Time) (claimed bool, err error) // lease purge to a single worker
+	PurgeUserMessages(userId string) (count int, err error)                            // messages, raw messages and objects
+	PurgeUserTables(userId, step string) (count int, err error)                        // rows of user's partitions related to step
+	PurgeUserObjects(userId string) (count int, err error)                             // exports and imports in object store
+	AnonymizeUser(user *User) error
+	CountUserRows(userId string) (counts map[string]int, err error)    // rows left in user's partitions, by table
+	CountUserObjects(userId string) (counts map[string]int, err error) // credentials and objects left, by backend
+}
+
+// PurgeIndex is the index side of deleted users' purge
+type PurgeIndex interface {
+	DeleteUserDocuments(userId, shardId string) (count int64, err error)
+	CountUserDocuments(userId, shardId string) (count int64, err error)
+}
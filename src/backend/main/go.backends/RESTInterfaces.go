@@ -9,14 +9,20 @@ import (
 )
 
 type APIStorage interface {
+	AppPasswordStorage
 	AttachmentStorage
 	CredentialsStorage
 	ContactStorage
 	DevicesStorage
 	DiscussionStorage
+	ExportStorage
 	IdentityStorage
+	ImportStorage
 	KeysStorage
 	MessageStorage
+	PurgeStorage
+	SavedSearchStorage
+	ScheduledSendStorage
 	TagsStorage
 	UserNameStorage
 	UserStorage
@@ -25,6 +31,8 @@ type APIStorage interface {
 type APIIndex interface {
 	MessageIndex
 	ContactIndex
+	PurgeIndex
 	RecipientsSuggest(user *UserInfo, query_string string) (suggests []RecipientSuggestion, err error)
 	Search(search IndexSearch) (result *IndexResult, err error)
+	Count(search IndexSearch) (count int64, err error)
 }
@@ -0,0 +1,17 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+type SavedSearchStorage interface {
+	RetrieveSavedSearches(userId string) (searches []SavedSearch, err error)
+	RetrieveSavedSearch(userId, searchId string) (search *SavedSearch, err error)
+	CreateSavedSearch(search *SavedSearch) error
+	UpdateSavedSearch(search *SavedSearch) error
+	DeleteSavedSearch(userId, searchId string) error
+}
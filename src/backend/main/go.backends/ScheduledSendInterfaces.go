@@ -0,0 +1,18 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backends
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+// ScheduledSendStorage keeps drafts waiting to be sent,
+// for scheduler's cache to be rebuilt from store if it has been lost
+type ScheduledSendStorage interface {
+	SaveScheduledSend(send *ScheduledSend) error
+	RetrieveScheduledSend(userId, messageId string) (send *ScheduledSend, err error)
+	RetrieveScheduledSends() (sends []ScheduledSend, err error)
+	DeleteScheduledSend(userId, messageId string) error
+}
@@ -5,14 +5,20 @@
 package backendstest
 
 type APIStore struct {
+	AppPasswordStore
 	AttachmentStore
 	CredentialStore
 	ContactsBackend
 	DevicesStore
 	DiscussionsStore
+	ExportStore
 	IdentitiesBackend
+	ImportStore
 	KeysStore
 	MessagesBackend
+	PurgeStore
+	SavedSearchStore
+	ScheduledSendStore
 	TagsStore
 	UserNamesStore
 	UsersBackend
@@ -0,0 +1,22 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+type AppPasswordStore struct{}
+
+func (as AppPasswordStore) RetrieveAppPasswords(userId string) ([]AppPassword, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (as AppPasswordStore) CreateAppPassword(password *AppPassword) error {
+	return errors.New("test interface not implemented")
+}
+func (as AppPasswordStore) DeleteAppPassword(userId, appPasswordId string) error {
+	return errors.New("test interface not implemented")
+}
@@ -8,12 +8,16 @@ import (
 	"errors"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"gopkg.in/redis.v5"
+	"path"
+	"sort"
+	"strconv"
 	"time"
 )
 
 type MockRedis struct {
 	Store map[string][]byte
 	Ttl   map[string]time.Duration
+	ZSets map[string]map[string]float64
 }
 
 func (mr *MockRedis) GetAuthToken(token string) (value *Auth_cache, err error) {
@@ -55,6 +59,66 @@ func (mr *MockRedis) SetDeviceValidationSession(userId, deviceId, token string)
 func (mr *MockRedis) DeleteDeviceValidationSession(userId, deviceId string) error {
 	return errors.New("test interface not implemented")
 }
+func (mr *MockRedis) AuthFailures(key string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) AddAuthFailure(key string, window time.Duration) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ThrottleRemoteAction(userId, identityId string, window time.Duration) (bool, time.Time, error) {
+	return false, time.Time{}, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ScheduleSend(send ScheduledSend) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) UnscheduleSend(userId, messageId string) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ClaimScheduledSend(userId, messageId string, lease time.Duration) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) CompleteScheduledSend(userId, messageId string) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ReleaseScheduledSend(userId, messageId string) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) DueScheduledSends(until time.Time, max int64) ([]ScheduledSend, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) SetMailboxImport(mbImport *MailboxImport) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) GetMailboxImport(userId string) (*MailboxImport, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ClaimMailboxImport(userId, importId string, ttl time.Duration) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ReleaseMailboxImport(userId, importId string) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) SetUserExport(export *UserExport) error {
+	return errors.New("test interface not implemented")
+}
+func (mr *MockRedis) GetUserExport(userId string) (*UserExport, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) GetUserExportByToken(token string) (*UserExport, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) ExpiredUserExports(until time.Time, max int64) ([]string, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) RemoveStoredExport(uri string) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) PurgeUserSessions(userId string, deviceIds []string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (mr *MockRedis) CountUserSessions(userId string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
 
 // Set mocks Set func from gopkg.in/redis.v5/internal
 // expiration is not handled
@@ -64,6 +128,14 @@ func (mr *MockRedis) Set(key string, value []byte, expiration time.Duration) err
 	return nil
 }
 
+// SetNX mocks SetNX func from gopkg.in/redis.v5/internal, keys never expire
+func (mr *MockRedis) SetNX(key string, value []byte, expiration time.Duration) (bool, error) {
+	if _, ok := mr.Store[key]; ok {
+		return false, nil
+	}
+	return true, mr.Set(key, value, expiration)
+}
+
 // Get mocks Get func from gopkg.in/redis.v5/internal
 func (mr *MockRedis) Get(key string) (value []byte, err error) {
 	if v, ok := mr.Store[key]; ok {
@@ -79,6 +151,75 @@ func (mr *MockRedis) Del(key string) error {
 	return nil
 }
 
+// Incr mocks Incr func from gopkg.in/redis.v5/internal, with ttl set on key's creation
+func (mr *MockRedis) Incr(key string, ttl time.Duration) (int64, error) {
+	count, _ := strconv.ParseInt(string(mr.Store[key]), 10, 64)
+	count++
+	if count == 1 {
+		mr.Ttl[key] = ttl
+	}
+	mr.Store[key] = []byte(strconv.FormatInt(count, 10))
+	return count, nil
+}
+
+// Keys mocks Scan func from gopkg.in/redis.v5/internal, with keys matched by path.Match
+func (mr *MockRedis) Keys(pattern string) (keys []string, err error) {
+	for key := range mr.Store {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// ZAdd mocks ZAdd func from gopkg.in/redis.v5/internal
+func (mr *MockRedis) ZAdd(key string, score float64, member string) error {
+	if mr.ZSets == nil {
+		mr.ZSets = map[string]map[string]float64{}
+	}
+	if _, ok := mr.ZSets[key]; !ok {
+		mr.ZSets[key] = map[string]float64{}
+	}
+	mr.ZSets[key][member] = score
+	return nil
+}
+
+// ZRangeByScore mocks ZRangeByScoreWithScores func from gopkg.in/redis.v5/internal
+// members are ordered by score, then lexicographically
+func (mr *MockRedis) ZRangeByScore(key string, max float64, count int64) (members []string, scores []float64, err error) {
+	for member, score := range mr.ZSets[key] {
+		if score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		si, sj := mr.ZSets[key][members[i]], mr.ZSets[key][members[j]]
+		return si < sj || (si == sj && members[i] < members[j])
+	})
+	if count > 0 && int64(len(members)) > count {
+		members = members[:count]
+	}
+	for _, member := range members {
+		scores = append(scores, mr.ZSets[key][member])
+	}
+	return
+}
+
+// ZRem mocks ZRem func from gopkg.in/redis.v5/internal
+func (mr *MockRedis) ZRem(key, member string) (removed bool, err error) {
+	if _, ok := mr.ZSets[key][member]; ok {
+		delete(mr.ZSets[key], member)
+		return true, nil
+	}
+	return false, nil
+}
+
+// ZScore mocks ZScore func from gopkg.in/redis.v5/internal
+func (mr *MockRedis) ZScore(key, member string) (score float64, found bool, err error) {
+	score, found = mr.ZSets[key][member]
+	return
+}
+
 // GetTTL returns the Ttl that has been set along with a key when Set has been previously called
 // for testing purpose
 func (mr *MockRedis) GetTTL(key string) (Ttl time.Duration, err error) {
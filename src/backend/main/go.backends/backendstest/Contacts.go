@@ -32,6 +32,18 @@ func (cb ContactsBackend) DeleteContact(contact *Contact) error {
 func (cb ContactsBackend) ContactExists(userId, contactId string) bool {
 	return false
 }
+func (cb ContactsBackend) RetrieveContactLookups(userId string) (lookups []ContactByContactPoints, err error) {
+	return nil, errors.New("RetrieveContactLookups test interface not implemented")
+}
+func (cb ContactsBackend) RetrieveCardDAVContactId(userId, name string) (string, error) {
+	return "", errors.New("RetrieveCardDAVContactId test interface not implemented")
+}
+func (cb ContactsBackend) SetCardDAVName(userId, name, contactId string) error {
+	return errors.New("SetCardDAVName test interface not implemented")
+}
+func (cb ContactsBackend) DeleteCardDAVName(userId, name string) error {
+	return errors.New("DeleteCardDAVName test interface not implemented")
+}
 
 // ContactIndex interface
 type ContactsIndex struct {
@@ -17,3 +17,6 @@ func (ds DiscussionsStore) GetDiscussion(user_id, discussion_id UUID) (*Discussi
 func (ds DiscussionsStore) GetOrCreateDiscussion(user_id UUID, participants []Participant) (*Discussion, error) {
 	return nil, errors.New("test interface not implemented")
 }
+func (ds DiscussionsStore) MoveDiscussionLookup(user_id UUID, before, after []Participant) error {
+	return errors.New("test interface not implemented")
+}
@@ -0,0 +1,29 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"io"
+)
+
+type ExportStore struct{}
+
+func (es ExportStore) RetrieveUserMessages(userId string) (<-chan *Message, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (es ExportStore) RetrieveUserContacts(userId string) (<-chan *Contact, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (es ExportStore) PutUserExport(name string, archive io.Reader) (string, int64, error) {
+	return "", 0, errors.New("test interface not implemented")
+}
+func (es ExportStore) GetUserExport(uri string) (io.Reader, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (es ExportStore) RemoveUserExport(uri string) error {
+	return errors.New("test interface not implemented")
+}
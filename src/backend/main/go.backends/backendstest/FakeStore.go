@@ -0,0 +1,661 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeCall is a call made to a FakeStore, with its arguments
+type FakeCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// FakeStore is an in-memory APIStore to be shared by tests.
+// Tests fill the data they need, calls are recorded in Calls,
+// and Fail makes calls fail when it returns an error for them.
+// Methods not served in memory are the ones of the embedded APIStore.
+type FakeStore struct {
+	APIStore
+	AppPasswords  []AppPassword
+	Contacts      []*Contact
+	Devices       []Device
+	Identities    []*UserIdentity // local and remote identities
+	Keys          []PublicKey     // keys of contacts, bound to their ResourceId
+	Messages      []*Message
+	Objects       map[string][]byte // exports and mailbox imports put in object store, by uri
+	Purges        map[string]*UserPurge
+	RawMessages   map[string]string // raw data by raw message id
+	SavedSearches []*SavedSearch
+	Settings      map[string]*Settings
+	Tags          []Tag
+	UserContacts  map[string]string // user's own contact id, by user id
+	Users         []*User
+
+	Calls []FakeCall
+	Fail  func(call FakeCall) error
+
+	mux sync.Mutex
+}
+
+// NewFakeStore returns an empty FakeStore
+func NewFakeStore() *FakeStore {
+	return &FakeStore{
+		Objects:      map[string][]byte{},
+		Purges:       map[string]*UserPurge{},
+		RawMessages:  map[string]string{},
+		Settings:     map[string]*Settings{},
+		UserContacts: map[string]string{},
+	}
+}
+
+// CallsTo returns calls made to method, in order
+func (fs *FakeStore) CallsTo(method string) (calls []FakeCall) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	for _, call := range fs.Calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return
+}
+
+// call records a call and returns the error Fail has for it, if any.
+// Caller must hold the lock.
+func (fs *FakeStore) call(method string, args ...interface{}) error {
+	call := FakeCall{method, args}
+	fs.Calls = append(fs.Calls, call)
+	if fs.Fail != nil {
+		return fs.Fail(call)
+	}
+	return nil
+}
+
+// UsersStorage
+
+func (fs *FakeStore) RetrieveUser(userId string) (*User, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveUser", userId); err != nil {
+		return nil, err
+	}
+	for _, user := range fs.Users {
+		if user.UserId.String() == userId {
+			return user, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) UserByUsername(username string) (*User, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("UserByUsername", username); err != nil {
+		return nil, err
+	}
+	for _, user := range fs.Users {
+		if user.Name == username {
+			return user, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) GetSettings(userId string) (*Settings, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("GetSettings", userId); err != nil {
+		return nil, err
+	}
+	if settings, ok := fs.Settings[userId]; ok {
+		copied := *settings
+		return &copied, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// AppPasswordStorage
+
+func (fs *FakeStore) RetrieveAppPasswords(userId string) (passwords []AppPassword, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveAppPasswords", userId); err != nil {
+		return
+	}
+	for _, password := range fs.AppPasswords {
+		if password.UserId.String() == userId {
+			passwords = append(passwords, password)
+		}
+	}
+	return
+}
+func (fs *FakeStore) CreateAppPassword(password *AppPassword) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("CreateAppPassword", password); err != nil {
+		return err
+	}
+	fs.AppPasswords = append(fs.AppPasswords, *password)
+	return nil
+}
+func (fs *FakeStore) DeleteAppPassword(userId, appPasswordId string) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("DeleteAppPassword", userId, appPasswordId); err != nil {
+		return err
+	}
+	kept := []AppPassword{}
+	for _, password := range fs.AppPasswords {
+		if password.UserId.String() != userId || password.AppPasswordId.String() != appPasswordId {
+			kept = append(kept, password)
+		}
+	}
+	fs.AppPasswords = kept
+	return nil
+}
+
+// DevicesStorage
+
+func (fs *FakeStore) RetrieveDevices(userId string) (devices []Device, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveDevices", userId); err != nil {
+		return
+	}
+	for _, device := range fs.Devices {
+		if device.UserId.String() == userId {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		err = errors.New("devices not found")
+	}
+	return
+}
+
+// IdentityStorage
+
+func (fs *FakeStore) identities(userId, identityType string) (identities []*UserIdentity) {
+	for _, identity := range fs.Identities {
+		if identity.UserId.String() == userId && identity.Type == identityType {
+			copied := *identity
+			identities = append(identities, &copied)
+		}
+	}
+	return
+}
+func (fs *FakeStore) RetrieveLocalsIdentities(userId string) (locals []UserIdentity, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveLocalsIdentities", userId); err != nil {
+		return
+	}
+	for _, identity := range fs.identities(userId, LocalIdentity) {
+		locals = append(locals, *identity)
+	}
+	if len(locals) == 0 {
+		err = errors.New("not found")
+	}
+	return
+}
+func (fs *FakeStore) RetrieveRemoteIdentities(userId string, withCredentials bool) (remotes []*UserIdentity, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveRemoteIdentities", userId, withCredentials); err != nil {
+		return
+	}
+	remotes = fs.identities(userId, RemoteIdentity)
+	if !withCredentials {
+		for _, remote := range remotes {
+			remote.Credentials = nil
+		}
+	}
+	if len(remotes) == 0 {
+		err = errors.New("not found")
+	}
+	return
+}
+func (fs *FakeStore) RetrieveUserIdentity(userId, identityId string, withCredentials bool) (*UserIdentity, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveUserIdentity", userId, identityId, withCredentials); err != nil {
+		return nil, err
+	}
+	for _, identity := range fs.Identities {
+		if identity.UserId.String() == userId && identity.Id.String() == identityId {
+			copied := *identity
+			if !withCredentials {
+				copied.Credentials = nil
+			}
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) UpdateUserIdentity(userIdentity *UserIdentity, fields map[string]interface{}) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("UpdateUserIdentity", userIdentity, fields); err != nil {
+		return err
+	}
+	for i, identity := range fs.Identities {
+		if identity.UserId == userIdentity.UserId && identity.Id == userIdentity.Id {
+			fs.Identities[i] = userIdentity
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+func (fs *FakeStore) LookupIdentityByIdentifier(identifier string, params ...string) (identities [][2]string, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("LookupIdentityByIdentifier", identifier, params); err != nil {
+		return
+	}
+	for _, identity := range fs.Identities {
+		if identity.Identifier != identifier ||
+			len(params) > 0 && identity.Protocol != params[0] ||
+			len(params) > 1 && identity.UserId.String() != params[1] {
+			continue
+		}
+		identities = append(identities, [2]string{identity.UserId.String(), identity.Id.String()})
+	}
+	return
+}
+func (fs *FakeStore) LookupIdentityByType(identityType string, userId ...string) (identities [][2]string, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("LookupIdentityByType", identityType, userId); err != nil {
+		return
+	}
+	for _, identity := range fs.Identities {
+		if identity.Type != identityType || len(userId) > 0 && identity.UserId.String() != userId[0] {
+			continue
+		}
+		identities = append(identities, [2]string{identity.UserId.String(), identity.Id.String()})
+	}
+	return
+}
+
+// LookupWKDIdentity resolves hash against local identities, as lookups are written along with them
+func (fs *FakeStore) LookupWKDIdentity(domain, hash string) (*WKDLookup, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("LookupWKDIdentity", domain, hash); err != nil {
+		return nil, err
+	}
+	for _, identity := range fs.Identities {
+		at := strings.LastIndex(identity.Identifier, "@")
+		if identity.Type != LocalIdentity || at <= 0 || !strings.EqualFold(identity.Identifier[at+1:], domain) ||
+			WKDHash(identity.Identifier[:at]) != hash {
+			continue
+		}
+		return &WKDLookup{
+			Address:    strings.ToLower(identity.Identifier),
+			Domain:     strings.ToLower(domain),
+			Hash:       hash,
+			IdentityId: identity.Id,
+			UserId:     identity.UserId,
+		}, nil
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) isIdentity(userId, identityId, identityType string) bool {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	for _, identity := range fs.Identities {
+		if identity.UserId.String() == userId && identity.Id.String() == identityId {
+			return identity.Type == identityType
+		}
+	}
+	return false
+}
+func (fs *FakeStore) IsLocalIdentity(userId, identityId string) bool {
+	return fs.isIdentity(userId, identityId, LocalIdentity)
+}
+func (fs *FakeStore) IsRemoteIdentity(userId, identityId string) bool {
+	return fs.isIdentity(userId, identityId, RemoteIdentity)
+}
+
+// ContactStorage
+
+func (fs *FakeStore) RetrieveContact(userId, contactId string) (*Contact, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveContact", userId, contactId); err != nil {
+		return nil, err
+	}
+	for _, contact := range fs.Contacts {
+		if contact.UserId.String() == userId && contact.ContactId.String() == contactId {
+			copied := *contact
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) RetrieveUserContactId(userId string) string {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	fs.call("RetrieveUserContactId", userId)
+	return fs.UserContacts[userId]
+}
+func (fs *FakeStore) ContactExists(userId, contactId string) bool {
+	_, err := fs.RetrieveContact(userId, contactId)
+	return err == nil
+}
+func (fs *FakeStore) RetrieveCardDAVContactId(userId, name string) (string, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveCardDAVContactId", userId, name); err != nil {
+		return "", err
+	}
+	for _, contact := range fs.Contacts {
+		if contact.UserId.String() == userId && contact.Infos[CardDAVNameInfo] == name {
+			return contact.ContactId.String(), nil
+		}
+	}
+	return "", errors.New("not found")
+}
+func (fs *FakeStore) RetrieveContactPubKeys(userId, contactId string) (keys PublicKeys, err CaliopenError) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if e := fs.call("RetrieveContactPubKeys", userId, contactId); e != nil {
+		return nil, WrapCaliopenErr(e, DbCaliopenErr, "[FakeStore]RetrieveContactPubKeys failed")
+	}
+	for _, key := range fs.Keys {
+		if key.UserId.String() == userId && key.ResourceId.String() == contactId {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// MessageStorage and DiscussionStorage
+
+func (fs *FakeStore) RetrieveMessage(userId, messageId string) (*Message, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveMessage", userId, messageId); err != nil {
+		return nil, err
+	}
+	for _, msg := range fs.Messages {
+		if msg.User_id.String() == userId && msg.Message_id.String() == messageId {
+			copied := *msg
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) UpdateMessage(msg *Message, fields map[string]interface{}) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("UpdateMessage", msg, fields); err != nil {
+		return err
+	}
+	for i, stored := range fs.Messages {
+		if stored.User_id == msg.User_id && stored.Message_id == msg.Message_id {
+			fs.Messages[i] = msg
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+func (fs *FakeStore) GetRawMessage(rawId string) (RawMessage, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("GetRawMessage", rawId); err != nil {
+		return RawMessage{}, err
+	}
+	if raw, ok := fs.RawMessages[rawId]; ok {
+		return RawMessage{Raw_data: raw}, nil
+	}
+	return RawMessage{}, errors.New("not found")
+}
+func (fs *FakeStore) MoveDiscussionLookup(userId UUID, before, after []Participant) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	return fs.call("MoveDiscussionLookup", userId, before, after)
+}
+
+// TagsStorage and SavedSearchStorage
+
+func (fs *FakeStore) RetrieveUserTags(userId string) (tags []Tag, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveUserTags", userId); err != nil {
+		return
+	}
+	for _, tag := range fs.Tags {
+		if tag.User_id.String() == userId {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		err = errors.New("tags not found")
+	}
+	return
+}
+func (fs *FakeStore) RetrieveTag(userId, name string) (Tag, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveTag", userId, name); err != nil {
+		return Tag{}, err
+	}
+	for _, tag := range fs.Tags {
+		if tag.User_id.String() == userId && tag.Name == name {
+			return tag, nil
+		}
+	}
+	return Tag{}, errors.New("tag not found")
+}
+func (fs *FakeStore) RetrieveSavedSearches(userId string) (searches []SavedSearch, err error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err = fs.call("RetrieveSavedSearches", userId); err != nil {
+		return
+	}
+	for _, search := range fs.SavedSearches {
+		if search.UserId.String() == userId {
+			searches = append(searches, *search)
+		}
+	}
+	return
+}
+func (fs *FakeStore) RetrieveSavedSearch(userId, searchId string) (*SavedSearch, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveSavedSearch", userId, searchId); err != nil {
+		return nil, err
+	}
+	for _, search := range fs.SavedSearches {
+		if search.UserId.String() == userId && search.SearchId.String() == searchId {
+			copied := *search
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) CreateSavedSearch(search *SavedSearch) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("CreateSavedSearch", search); err != nil {
+		return err
+	}
+	copied := *search
+	fs.SavedSearches = append(fs.SavedSearches, &copied)
+	return nil
+}
+func (fs *FakeStore) UpdateSavedSearch(search *SavedSearch) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("UpdateSavedSearch", search); err != nil {
+		return err
+	}
+	for i, stored := range fs.SavedSearches {
+		if stored.UserId == search.UserId && stored.SearchId == search.SearchId {
+			copied := *search
+			fs.SavedSearches[i] = &copied
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+func (fs *FakeStore) DeleteSavedSearch(userId, searchId string) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("DeleteSavedSearch", userId, searchId); err != nil {
+		return err
+	}
+	kept := []*SavedSearch{}
+	for _, search := range fs.SavedSearches {
+		if search.UserId.String() != userId || search.SearchId.String() != searchId {
+			kept = append(kept, search)
+		}
+	}
+	fs.SavedSearches = kept
+	return nil
+}
+
+// ExportStorage and ImportStorage
+
+func (fs *FakeStore) RetrieveUserMessages(userId string) (<-chan *Message, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveUserMessages", userId); err != nil {
+		return nil, err
+	}
+	ch := make(chan *Message, len(fs.Messages))
+	for _, msg := range fs.Messages {
+		if msg.User_id.String() == userId {
+			copied := *msg
+			ch <- &copied
+		}
+	}
+	close(ch)
+	return ch, nil
+}
+func (fs *FakeStore) RetrieveUserContacts(userId string) (<-chan *Contact, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveUserContacts", userId); err != nil {
+		return nil, err
+	}
+	ch := make(chan *Contact, len(fs.Contacts))
+	for _, contact := range fs.Contacts {
+		if contact.UserId.String() == userId {
+			copied := *contact
+			ch <- &copied
+		}
+	}
+	close(ch)
+	return ch, nil
+}
+func (fs *FakeStore) putObject(method, uri string, object io.Reader) (string, int64, error) {
+	// object may be written by a caller of other store's methods
+	data, err := ioutil.ReadAll(object)
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if e := fs.call(method, uri); e != nil {
+		return "", 0, e
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	fs.Objects[uri] = data
+	return uri, int64(len(data)), nil
+}
+func (fs *FakeStore) getObject(method, uri string) (io.Reader, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call(method, uri); err != nil {
+		return nil, err
+	}
+	if data, ok := fs.Objects[uri]; ok {
+		return bytes.NewReader(data), nil
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) removeObject(method, uri string) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call(method, uri); err != nil {
+		return err
+	}
+	delete(fs.Objects, uri)
+	return nil
+}
+func (fs *FakeStore) PutUserExport(name string, archive io.Reader) (string, int64, error) {
+	return fs.putObject("PutUserExport", "s3://caliopen-exports/"+name, archive)
+}
+func (fs *FakeStore) GetUserExport(uri string) (io.Reader, error) {
+	return fs.getObject("GetUserExport", uri)
+}
+func (fs *FakeStore) RemoveUserExport(uri string) error {
+	return fs.removeObject("RemoveUserExport", uri)
+}
+func (fs *FakeStore) PutMailboxImport(name string, mailbox io.Reader) (string, int64, error) {
+	return fs.putObject("PutMailboxImport", "s3://caliopen-imports/"+name, mailbox)
+}
+func (fs *FakeStore) GetMailboxImport(uri string) (io.Reader, error) {
+	return fs.getObject("GetMailboxImport", uri)
+}
+func (fs *FakeStore) RemoveMailboxImport(uri string) error {
+	return fs.removeObject("RemoveMailboxImport", uri)
+}
+
+// PurgeStorage, as far as purges' state is concerned
+
+func (fs *FakeStore) RetrieveUserPurge(userId string) (*UserPurge, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("RetrieveUserPurge", userId); err != nil {
+		return nil, err
+	}
+	if purge, ok := fs.Purges[userId]; ok {
+		copied := *purge
+		return &copied, nil
+	}
+	return nil, errors.New("not found")
+}
+func (fs *FakeStore) SaveUserPurge(purge *UserPurge) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("SaveUserPurge", purge); err != nil {
+		return err
+	}
+	// lease is only set when claiming purge
+	saved := *purge
+	saved.LeaseUntil = time.Time{}
+	if previous, ok := fs.Purges[purge.UserId.String()]; ok {
+		saved.LeaseUntil = previous.LeaseUntil
+	}
+	fs.Purges[purge.UserId.String()] = &saved
+	return nil
+}
+func (fs *FakeStore) ClaimUserPurge(userId string, previous, until time.Time) (bool, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if err := fs.call("ClaimUserPurge", userId, previous, until); err != nil {
+		return false, err
+	}
+	purge, ok := fs.Purges[userId]
+	if !ok || !purge.LeaseUntil.Equal(previous) {
+		return false, nil
+	}
+	purge.LeaseUntil = until
+	return true, nil
+}
+func (fs *FakeStore) AnonymizeUser(user *User) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	return fs.call("AnonymizeUser", user)
+}
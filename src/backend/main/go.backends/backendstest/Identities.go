@@ -53,6 +53,9 @@ func (ib IdentitiesBackend) LookupIdentityByIdentifier(string, ...string) ([][2]
 func (ib IdentitiesBackend) LookupIdentityByType(string, ...string) ([][2]string, error) {
 	return [][2]string{}, errors.New("test interface not implemented")
 }
+func (ib IdentitiesBackend) LookupWKDIdentity(domain, hash string) (*WKDLookup, error) {
+	return nil, errors.New("test interface not implemented")
+}
 func (ib IdentitiesBackend) UpdateUserIdentity(userIdentity *UserIdentity, fields map[string]interface{}) error {
 	return errors.New("test interface not implemented")
 }
@@ -0,0 +1,22 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	"io"
+)
+
+type ImportStore struct{}
+
+func (is ImportStore) PutMailboxImport(name string, mailbox io.Reader) (string, int64, error) {
+	return "", 0, errors.New("test interface not implemented")
+}
+func (is ImportStore) GetMailboxImport(uri string) (io.Reader, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (is ImportStore) RemoveMailboxImport(uri string) error {
+	return errors.New("test interface not implemented")
+}
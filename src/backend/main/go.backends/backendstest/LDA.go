@@ -66,16 +66,58 @@ func (ldaStore *LDAStoreBackend) SetDeliveredStatus(raw_msg_id string, delivered
 func (ldaStore *LDAStoreBackend) UpdateMessage(msg *Message, fields map[string]interface{}) error {
 	return errors.New("test interface not implemented")
 }
+func (ldaStore *LDAStoreBackend) DeleteMessage(msg *Message) error {
+	return errors.New("test interface not implemented")
+}
 func (ldaStore *LDAStoreBackend) CreateThreadLookup(user_id, discussion_id UUID, external_msg_id string) error {
 	return errors.New("test interface not implemented")
 }
 func (ldaStore *LDAStoreBackend) SeekMessageByExternalRef(userID, externalMessageID, identityID string) (UUID, error) {
 	return EmptyUUID, errors.New("test interface not implemented")
 }
+func (ldaStore *LDAStoreBackend) CreateMessageExternalRefLookup(userID, identityID, messageID UUID, externalMessageID string) error {
+	return errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) IsMessageDeleted(userID, identityID, externalMessageID string) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RemoveMessageDeletedLookup(userID, identityID, externalMessageID string) error {
+	return errors.New("test interface not implemented")
+}
 
 func (ldaStore *LDAStoreBackend) LookupContactsByIdentifier(user_id, address string) (contact_ids []string, err error) {
 	return nil, errors.New("test interface not implemented")
 }
+func (ldaStore *LDAStoreBackend) RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError) {
+	return nil, NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RetrieveContact(userID, contactID string) (*Contact, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RetrieveUserContactId(userID string) string {
+	return ""
+}
+func (ldaStore *LDAStoreBackend) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
+	return NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) DeletePubKey(pubkey *PublicKey) CaliopenError {
+	return NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RetrieveAutocryptPeer(userId, address string) (*AutocryptPeer, CaliopenError) {
+	return nil, NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) SaveAutocryptPeer(peer *AutocryptPeer) CaliopenError {
+	return NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) CreateWKSRequest(request *WKSRequest) CaliopenError {
+	return NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RetrieveWKSRequest(nonce string) (*WKSRequest, CaliopenError) {
+	return nil, NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) DeleteWKSRequest(nonce string) CaliopenError {
+	return NewCaliopenErr(NotImplementedCaliopenErr, "test interface not implemented")
+}
 
 func (ldaStore *LDAStoreBackend) GetAttachment(uri string) (file io.Reader, err error) {
 	return nil, errors.New("test interface not implemented")
@@ -91,6 +133,14 @@ func (ldaStore *LDAStoreBackend) RetrieveUserIdentity(userId, identityId string,
 	ib := GetIdentitiesBackend([]*UserIdentity{}, []*UserIdentity{})
 	return ib.RetrieveUserIdentity(userId, identityId, withCredentials)
 }
+func (ldaStore *LDAStoreBackend) LookupIdentityByIdentifier(identifier string, params ...string) ([][2]string, error) {
+	ib := GetIdentitiesBackend([]*UserIdentity{}, []*UserIdentity{})
+	return ib.LookupIdentityByIdentifier(identifier, params...)
+}
+func (ldaStore *LDAStoreBackend) LookupWKDIdentity(domain, hash string) (*WKDLookup, error) {
+	ib := GetIdentitiesBackend([]*UserIdentity{}, []*UserIdentity{})
+	return ib.LookupWKDIdentity(domain, hash)
+}
 func (ldaStore *LDAStoreBackend) UpdateUserIdentity(userIdentity *UserIdentity, fields map[string]interface{}) error {
 	return errors.New("test interface not implemented")
 }
@@ -107,6 +157,23 @@ func (ldaStore *LDAStoreBackend) TimestampRemoteLastCheck(userId, remoteId strin
 	return errors.New("test interface not implemented")
 }
 
+func (ldaStore *LDAStoreBackend) RetrieveUserTags(user_id string) (tags []Tag, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) CreateTag(tag *Tag) error {
+	return errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RetrieveSavedSearches(userId string) ([]SavedSearch, error) {
+	return nil, errors.New("test interface not implemented")
+}
+
+func (ldaStore *LDAStoreBackend) GetMailboxImport(uri string) (io.Reader, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ldaStore *LDAStoreBackend) RemoveMailboxImport(uri string) error {
+	return errors.New("test interface not implemented")
+}
+
 func (ldIndex *LDAIndexBackend) Close() {}
 func (ldIndex *LDAIndexBackend) CreateMessage(user *UserInfo, msg *Message) error {
 	return errors.New("test interface not implemented")
@@ -114,3 +181,6 @@ func (ldIndex *LDAIndexBackend) CreateMessage(user *UserInfo, msg *Message) erro
 func (ldIndex *LDAIndexBackend) UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error {
 	return errors.New("test interface not implemented")
 }
+func (ldIndex *LDAIndexBackend) DeleteMessage(user *UserInfo, msg *Message) error {
+	return errors.New("test interface not implemented")
+}
@@ -41,6 +41,10 @@ func (mb MessagesBackend) DeleteMessage(msg *Message) error {
 	return errors.New("test interface not implemented")
 }
 
+func (mb MessagesBackend) CreateMessageExternalRefLookup(userID, identityID, messageID UUID, externalMessageID string) error {
+	return errors.New("test interface not implemented")
+}
+
 func (mb MessagesBackend) SetMessageUnread(user_id, message_id string, status bool) error {
 	return errors.New("test interface not implemented")
 }
@@ -35,7 +35,40 @@ func (ns NotificationsStore) RetrieveNotifications(userId string, from, to time.
 func (ns NotificationsStore) DeleteNotifications(userId string, until time.Time) error {
 	return errors.New("test interface not implemented")
 }
+func (ns NotificationsStore) GetSettings(userId string) (settings *Settings, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) RetrieveDevices(userId string) (devices []Device, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) UpdateDevice(device, oldDevice *Device, fields map[string]interface{}) error {
+	return errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) RetrieveMessage(userId, msgId string) (msg *Message, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) RetrieveUser(userId string) (user *User, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) RetrieveSettingsWithDigest() (settings []Settings, err error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) RetrieveDigestState(userId string) (sent, leaseUntil time.Time, err error) {
+	return time.Time{}, time.Time{}, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) ClaimDigest(userId string, previousLease, until time.Time) (claimed bool, err error) {
+	return false, errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) SetDigestDate(userId string, date time.Time) error {
+	return errors.New("test interface not implemented")
+}
+func (ns NotificationsStore) ReleaseDigest(userId string, lease time.Time) error {
+	return errors.New("test interface not implemented")
+}
 
 func (ni NotificationsIndex) CreateMessage(user *UserInfo, msg *Message) error {
 	return errors.New("test interface not implemented")
 }
+func (ni NotificationsIndex) FilterMessages(search IndexSearch) (messages []*Message, totalFound int64, err error) {
+	return nil, 0, errors.New("test interface not implemented")
+}
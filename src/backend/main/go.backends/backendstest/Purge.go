@@ -0,0 +1,44 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"time"
+)
+
+type PurgeStore struct{}
+
+func (ps PurgeStore) RetrieveUserPurge(userId string) (*UserPurge, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) RetrieveUnfinishedPurges() ([]UserPurge, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) SaveUserPurge(purge *UserPurge) error {
+	return errors.New("test interface not implemented")
+}
+func (ps PurgeStore) ClaimUserPurge(userId string, previous, until time.Time) (bool, error) {
+	return false, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) PurgeUserMessages(userId string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) PurgeUserTables(userId, step string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) PurgeUserObjects(userId string) (int, error) {
+	return 0, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) AnonymizeUser(user *User) error {
+	return errors.New("test interface not implemented")
+}
+func (ps PurgeStore) CountUserRows(userId string) (map[string]int, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ps PurgeStore) CountUserObjects(userId string) (map[string]int, error) {
+	return nil, errors.New("test interface not implemented")
+}
@@ -0,0 +1,28 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+type SavedSearchStore struct{}
+
+func (ss SavedSearchStore) RetrieveSavedSearches(userId string) ([]SavedSearch, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ss SavedSearchStore) RetrieveSavedSearch(userId, searchId string) (*SavedSearch, error) {
+	return nil, errors.New("test interface not implemented")
+}
+func (ss SavedSearchStore) CreateSavedSearch(search *SavedSearch) error {
+	return errors.New("test interface not implemented")
+}
+func (ss SavedSearchStore) UpdateSavedSearch(search *SavedSearch) error {
+	return errors.New("test interface not implemented")
+}
+func (ss SavedSearchStore) DeleteSavedSearch(userId, searchId string) error {
+	return errors.New("test interface not implemented")
+}
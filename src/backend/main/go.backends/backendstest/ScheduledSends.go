@@ -0,0 +1,51 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+// ScheduledSendStore keeps scheduled sends in memory, keyed by user_id::message_id.
+// A nil store is not implemented.
+type ScheduledSendStore map[string]ScheduledSend
+
+func GetScheduledSendStore() ScheduledSendStore {
+	return ScheduledSendStore{}
+}
+
+func (ss ScheduledSendStore) SaveScheduledSend(send *ScheduledSend) error {
+	if ss == nil {
+		return errors.New("test interface not implemented")
+	}
+	ss[send.UserId+"::"+send.MessageId] = *send
+	return nil
+}
+func (ss ScheduledSendStore) RetrieveScheduledSend(userId, messageId string) (*ScheduledSend, error) {
+	if ss == nil {
+		return nil, errors.New("test interface not implemented")
+	}
+	if send, ok := ss[userId+"::"+messageId]; ok {
+		return &send, nil
+	}
+	return nil, errors.New("not found")
+}
+func (ss ScheduledSendStore) RetrieveScheduledSends() (sends []ScheduledSend, err error) {
+	if ss == nil {
+		return nil, errors.New("test interface not implemented")
+	}
+	for _, send := range ss {
+		sends = append(sends, send)
+	}
+	return
+}
+func (ss ScheduledSendStore) DeleteScheduledSend(userId, messageId string) error {
+	if ss == nil {
+		return errors.New("test interface not implemented")
+	}
+	delete(ss, userId+"::"+messageId)
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package backendstest
+
+import (
+	"bytes"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"io/ioutil"
+)
+
+// NewPGPEntity generates a PGP key pair for a single identity, ready to be exported or to sign
+func NewPGPEntity(name, email string) (*openpgp.Entity, error) {
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		return nil, err
+	}
+	// identities of a new entity are only self-signed when serialized with its private key
+	if err = entity.SerializePrivate(ioutil.Discard, nil); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// NewPublicKey generates a PGP key pair for a single identity and returns it as a key of contact,
+// along with its entity to sign or decrypt. email must be one of contact's addresses.
+func NewPublicKey(contact *Contact, name, email string) (PublicKey, *openpgp.Entity, error) {
+	key := PublicKey{}
+	entity, err := NewPGPEntity(name, email)
+	if err != nil {
+		return key, nil, err
+	}
+	err = key.UnmarshalPGPEntity("", entity, contact)
+	return key, entity, err
+}
+
+// BinaryPublicKey returns the public keys of entities, concatenated in binary format
+func BinaryPublicKey(entities ...*openpgp.Entity) []byte {
+	buf := new(bytes.Buffer)
+	for _, entity := range entities {
+		entity.Serialize(buf)
+	}
+	return buf.Bytes()
+}
+
+// ArmoredPublicKey returns the public keys of entities within an armored block
+func ArmoredPublicKey(entities ...*openpgp.Entity) string {
+	buf := new(bytes.Buffer)
+	w, _ := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	w.Write(BinaryPublicKey(entities...))
+	w.Close()
+	return buf.String()
+}
@@ -0,0 +1,38 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/redis.v5"
+	"strconv"
+	"time"
+)
+
+const authFailurePrefix = "authfailures::"
+
+// AuthFailures returns the count of authentication failures recorded for key (an username, a client's address…)
+func (c *Cache) AuthFailures(key string) (int, error) {
+	value, err := c.Backend.Get(authFailurePrefix + key)
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		log.WithError(err).Errorf("[AuthFailures] failed to get failures of %s", key)
+		return 0, err
+	}
+	count, _ := strconv.Atoi(string(value))
+	return count, nil
+}
+
+// AddAuthFailure records an authentication failure for key and returns the count of failures.
+// Failures are forgotten once window has elapsed since the first one.
+func (c *Cache) AddAuthFailure(key string, window time.Duration) (int, error) {
+	count, err := c.Backend.Incr(authFailurePrefix+key, window)
+	if err != nil {
+		log.WithError(err).Errorf("[AddAuthFailure] failed to record failure of %s", key)
+	}
+	return int(count), err
+}
@@ -0,0 +1,37 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_AddAuthFailure(t *testing.T) {
+	mockCache, mockRedis, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if count, err := mockCache.AuthFailures("emma"); count != 0 || err != nil {
+		t.Errorf("expected no failure, got %d (%v)", count, err)
+	}
+	for i := 1; i <= 3; i++ {
+		count, err := mockCache.AddAuthFailure("emma", time.Minute)
+		if count != i || err != nil {
+			t.Errorf("expected %d failures, got %d (%v)", i, count, err)
+		}
+	}
+	if count, _ := mockCache.AuthFailures("emma"); count != 3 {
+		t.Errorf("expected 3 failures, got %d", count)
+	}
+	if ttl := mockRedis.Ttl[authFailurePrefix+"emma"]; ttl != time.Minute {
+		t.Errorf("expected failures to be forgotten after 1 minute, got %s", ttl)
+	}
+	if count, _ := mockCache.AuthFailures("john"); count != 0 {
+		t.Errorf("expected failures to be counted per key, got %d", count)
+	}
+}
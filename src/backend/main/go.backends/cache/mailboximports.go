@@ -0,0 +1,70 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	mailboxImportPrefix      = "mailboximport::"
+	mailboxImportClaimPrefix = "mailboximport::claim::"
+	mailboxImportTTL         = 7 * 24 * time.Hour // how long last import's report is kept after its last update
+)
+
+// SetMailboxImport stores state of user's last mailbox import
+func (c *Cache) SetMailboxImport(mbImport *MailboxImport) error {
+	if mbImport.UserId == "" {
+		return errors.New("[SetMailboxImport] user_id is required")
+	}
+	value, err := json.Marshal(mbImport)
+	if err != nil {
+		log.WithError(err).Errorf("[SetMailboxImport] failed to marshal import %+v", *mbImport)
+		return err
+	}
+	err = c.Backend.Set(mailboxImportPrefix+mbImport.UserId, value, mailboxImportTTL)
+	if err != nil {
+		log.WithError(err).Errorf("[SetMailboxImport] failed to set import of user %s", mbImport.UserId)
+	}
+	return err
+}
+
+// GetMailboxImport returns state of user's last mailbox import
+func (c *Cache) GetMailboxImport(userId string) (*MailboxImport, error) {
+	value, err := c.Backend.Get(mailboxImportPrefix + userId)
+	if err != nil {
+		return nil, err
+	}
+	mbImport := new(MailboxImport)
+	err = json.Unmarshal(value, mbImport)
+	if err != nil {
+		log.WithError(err).Errorf("[GetMailboxImport] failed to unmarshal import of user %s", userId)
+		return nil, err
+	}
+	return mbImport, nil
+}
+
+// ClaimMailboxImport reserves import slot of user for importId until ttl expires or until slot is released.
+// It returns false if slot is held by another import.
+func (c *Cache) ClaimMailboxImport(userId, importId string, ttl time.Duration) (bool, error) {
+	claimed, err := c.Backend.SetNX(mailboxImportClaimPrefix+userId, []byte(importId), ttl)
+	if err != nil {
+		log.WithError(err).Errorf("[ClaimMailboxImport] failed to claim import slot of user %s", userId)
+	}
+	return claimed, err
+}
+
+// ReleaseMailboxImport frees import slot of user, if it is still held by importId
+func (c *Cache) ReleaseMailboxImport(userId, importId string) error {
+	holder, err := c.Backend.Get(mailboxImportClaimPrefix + userId)
+	if err != nil || string(holder) != importId {
+		return nil
+	}
+	return c.Backend.Del(mailboxImportClaimPrefix + userId)
+}
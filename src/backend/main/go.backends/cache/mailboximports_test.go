@@ -0,0 +1,47 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+)
+
+func TestCache_MailboxImport(t *testing.T) {
+	mockCache, mock, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = mockCache.GetMailboxImport("user_id"); err == nil {
+		t.Error("expected no import for user")
+	}
+	mbImport := &MailboxImport{
+		Format:   MailboxFormatMbox,
+		ImportId: "import_id",
+		Imported: 12,
+		Status:   ImportRunning,
+		UserId:   "user_id",
+	}
+	if err = mockCache.SetMailboxImport(mbImport); err != nil {
+		t.Error(err)
+		return
+	}
+	if mock.Ttl["mailboximport::user_id"] != mailboxImportTTL {
+		t.Errorf("expected import to be kept %s, got %s", mailboxImportTTL, mock.Ttl["mailboximport::user_id"])
+	}
+	got, err := mockCache.GetMailboxImport("user_id")
+	if err != nil || got.ImportId != "import_id" || got.Imported != 12 || got.Status != ImportRunning {
+		t.Errorf("unexpected import %+v, err %v", got, err)
+	}
+
+	mockCache.PurgeUserSessions("user_id", nil)
+	if _, ok := mock.Store["mailboximport::user_id"]; ok {
+		t.Error("expected import to be purged")
+	}
+	if err = mockCache.SetMailboxImport(&MailboxImport{}); err == nil {
+		t.Error("expected import without user to be rejected")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/redis.v5"
+	"math"
+	"strings"
+)
+
+const authTokenPrefix = "tokens::"
+
+// PurgeUserSessions deletes all keys related to a deleted user :
+// devices' auth tokens and validation sessions, password reset session, data export, mailbox import and drafts' scheduled sends.
+// Objects of exports are removed along with user's other objects, see PurgeStorage.
+// It returns the count of deleted entries.
+func (c *Cache) PurgeUserSessions(userId string, deviceIds []string) (count int, err error) {
+	keys := []string{}
+	for _, deviceId := range deviceIds {
+		keys = append(keys, authTokenPrefix+userId+"-"+deviceId)
+		keys = append(keys, validationPrefix+userId+"::"+deviceId)
+	}
+	keys = append(keys, sessionPrefix+userId, userExportPrefix+userId, mailboxImportPrefix+userId, mailboxImportClaimPrefix+userId)
+
+	for _, key := range keys {
+		value, err := c.Backend.Get(key)
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Errorf("[PurgeUserSessions] failed to get key %s", key)
+			return count, err
+		}
+		// sessions are also referenced by their token
+		session := TokenSession{}
+		if !strings.HasPrefix(key, authTokenPrefix) && json.Unmarshal(value, &session) == nil && session.Token != "" {
+			tokenKey := resetTokenPrefix + session.Token
+			if strings.HasPrefix(key, validationPrefix) {
+				tokenKey = validationPrefix + userId + "::" + session.Token
+			}
+			if strings.HasPrefix(key, userExportPrefix) {
+				tokenKey = exportTokenPrefix + session.Token
+			}
+			if err = c.Backend.Del(tokenKey); err != nil && err != redis.Nil {
+				log.WithError(err).Errorf("[PurgeUserSessions] failed to delete key %s", tokenKey)
+				return count, err
+			}
+		}
+		if err = c.Backend.Del(key); err != nil && err != redis.Nil {
+			log.WithError(err).Errorf("[PurgeUserSessions] failed to delete key %s", key)
+			return count, err
+		}
+		count++
+	}
+
+	members, _, err := c.Backend.ZRangeByScore(scheduledSendsKey, math.Inf(1), 0)
+	if err != nil {
+		log.WithError(err).Error("[PurgeUserSessions] failed to range over scheduled sends")
+		return count, err
+	}
+	for _, member := range members {
+		if strings.HasPrefix(member, userId+"::") {
+			removed, err := c.Backend.ZRem(scheduledSendsKey, member)
+			if err != nil {
+				log.WithError(err).Errorf("[PurgeUserSessions] failed to unschedule %s", member)
+				return count, err
+			}
+			if removed {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// CountUserSessions returns the count of keys and scheduled sends left for a deleted user,
+// whatever the devices they relate to.
+func (c *Cache) CountUserSessions(userId string) (count int, err error) {
+	for _, pattern := range []string{
+		authTokenPrefix + userId + "-*",
+		validationPrefix + userId + "::*",
+		sessionPrefix + userId,
+		userExportPrefix + userId,
+		mailboxImportPrefix + userId,
+		mailboxImportClaimPrefix + userId,
+		scheduledSendLeasePrefix + userId + "::*",
+	} {
+		keys, err := c.Backend.Keys(pattern)
+		if err != nil {
+			log.WithError(err).Errorf("[CountUserSessions] failed to scan keys %s", pattern)
+			return count, err
+		}
+		count += len(keys)
+	}
+
+	members, _, err := c.Backend.ZRangeByScore(scheduledSendsKey, math.Inf(1), 0)
+	if err != nil {
+		log.WithError(err).Error("[CountUserSessions] failed to range over scheduled sends")
+		return count, err
+	}
+	for _, member := range members {
+		if strings.HasPrefix(member, userId+"::") {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,84 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+	"time"
+)
+
+func TestCache_PurgeUserSessions(t *testing.T) {
+	mockCache, mock, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mock.Set("tokens::user_id-device_1", []byte(`{"access_token":"token"}`), time.Hour)
+	mock.Set("tokens::other_user-device_3", []byte(`{"access_token":"token"}`), time.Hour)
+	mockCache.SetDeviceValidationSession("user_id", "device_2", "validation_token")
+	mockCache.SetResetPasswordSession("user_id", "reset_token")
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "draft", SendAt: time.Now(), UserId: "user_id"})
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "draft", SendAt: time.Now(), UserId: "other_user"})
+
+	count, err := mockCache.PurgeUserSessions("user_id", []string{"device_1", "device_2"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if count != 4 {
+		t.Errorf("expected 4 purged entries, got %d", count)
+	}
+	for _, key := range []string{
+		"tokens::user_id-device_1",
+		"validationsession::user_id::device_2",
+		"validationsession::user_id::validation_token",
+		"resetsession::user_id",
+		"resettoken::reset_token",
+	} {
+		if _, ok := mock.Store[key]; ok {
+			t.Errorf("expected key %s to be purged", key)
+		}
+	}
+	if _, ok := mock.Store["tokens::other_user-device_3"]; !ok {
+		t.Error("expected other user's token to be kept")
+	}
+	if _, ok := mock.ZSets[scheduledSendsKey]["other_user::draft"]; !ok || len(mock.ZSets[scheduledSendsKey]) != 1 {
+		t.Errorf("expected only other user's scheduled send to be kept, got %v", mock.ZSets[scheduledSendsKey])
+	}
+
+	// purge is idempotent
+	if count, err = mockCache.PurgeUserSessions("user_id", []string{"device_1", "device_2"}); count != 0 || err != nil {
+		t.Errorf("expected nothing left to purge, got %d entries, err %v", count, err)
+	}
+}
+
+func TestCache_CountUserSessions(t *testing.T) {
+	mockCache, mock, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mock.Set("tokens::user_id-device_1", []byte(`{"access_token":"token"}`), time.Hour)
+	mock.Set("tokens::user_id-unknown_device", []byte(`{"access_token":"token"}`), time.Hour)
+	mock.Set("tokens::other_user-device_3", []byte(`{"access_token":"token"}`), time.Hour)
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "draft", SendAt: time.Now(), UserId: "user_id"})
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "draft", SendAt: time.Now(), UserId: "other_user"})
+
+	count, err := mockCache.CountUserSessions("user_id")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if count != 3 {
+		t.Errorf("expected 3 entries left, got %d", count)
+	}
+
+	// tokens of devices unknown to purge are reported
+	mockCache.PurgeUserSessions("user_id", []string{"device_1"})
+	if count, err = mockCache.CountUserSessions("user_id"); count != 1 || err != nil {
+		t.Errorf("expected 1 entry left, got %d, err %v", count, err)
+	}
+}
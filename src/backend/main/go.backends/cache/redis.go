@@ -9,6 +9,7 @@ import (
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
 	log "github.com/Sirupsen/logrus"
 	"gopkg.in/redis.v5"
+	"strconv"
 	"time"
 )
 
@@ -42,6 +43,10 @@ func (rb *redisBackend) Set(key string, value []byte, ttl time.Duration) error {
 	return rb.client.Set(key, value, ttl).Err()
 }
 
+func (rb *redisBackend) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return rb.client.SetNX(key, value, ttl).Result()
+}
+
 func (rb *redisBackend) Get(key string) (value []byte, err error) {
 	return rb.client.Get(key).Bytes()
 }
@@ -50,6 +55,64 @@ func (rb *redisBackend) Del(key string) error {
 	return rb.client.Del(key).Err()
 }
 
+func (rb *redisBackend) Incr(key string, ttl time.Duration) (int64, error) {
+	count, err := rb.client.Incr(key).Result()
+	if err == nil && count == 1 {
+		err = rb.client.Expire(key, ttl).Err()
+	}
+	return count, err
+}
+
+// Keys iterates over keyspace with SCAN, to not block redis as KEYS would do
+func (rb *redisBackend) Keys(pattern string) (keys []string, err error) {
+	var cursor uint64
+	for {
+		var page []string
+		page, cursor, err = rb.client.Scan(cursor, pattern, 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+func (rb *redisBackend) ZAdd(key string, score float64, member string) error {
+	return rb.client.ZAdd(key, redis.Z{Score: score, Member: member}).Err()
+}
+
+func (rb *redisBackend) ZRangeByScore(key string, max float64, count int64) (members []string, scores []float64, err error) {
+	zs, err := rb.client.ZRangeByScoreWithScores(key, redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatFloat(max, 'f', -1, 64),
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, z := range zs {
+		member, _ := z.Member.(string)
+		members = append(members, member)
+		scores = append(scores, z.Score)
+	}
+	return
+}
+
+func (rb *redisBackend) ZRem(key, member string) (removed bool, err error) {
+	count, err := rb.client.ZRem(key, member).Result()
+	return count > 0, err
+}
+
+func (rb *redisBackend) ZScore(key, member string) (score float64, found bool, err error) {
+	score, err = rb.client.ZScore(key, member).Result()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	return score, err == nil, err
+}
+
 func InitializeTestCache() (c *Cache, mock *backendstest.MockRedis, err error) {
 	c = new(Cache)
 	mock = &backendstest.MockRedis{
@@ -0,0 +1,39 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/redis.v5"
+	"time"
+)
+
+const remoteActionPrefix = "remoteaction::"
+
+// ThrottleRemoteAction records that an action has been requested for a remote identity.
+// If an action was already requested within the `window` duration, it returns throttled = true
+// and the time from which a new action will be accepted.
+func (c *Cache) ThrottleRemoteAction(userId, identityId string, window time.Duration) (throttled bool, until time.Time, err error) {
+	key := remoteActionPrefix + userId + "::" + identityId
+	until = time.Now().Add(window)
+	// key is only set if no action is running, so that concurrent requests can't both pass
+	set, err := c.Backend.SetNX(key, []byte(until.Format(time.RFC3339)), window)
+	if err != nil {
+		log.WithError(err).Errorf("[ThrottleRemoteAction] failed to set key %s", key)
+		return false, until, err
+	}
+	if set {
+		return false, until, nil
+	}
+	value, err := c.Backend.Get(key)
+	if err != nil && err != redis.Nil {
+		log.WithError(err).Errorf("[ThrottleRemoteAction] failed to get key %s", key)
+		return true, until, nil
+	}
+	if previous, e := time.Parse(time.RFC3339, string(value)); e == nil {
+		until = previous
+	}
+	return true, until, nil
+}
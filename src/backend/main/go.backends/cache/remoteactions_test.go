@@ -0,0 +1,45 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_ThrottleRemoteAction(t *testing.T) {
+	mockCache, mockRedis, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	throttled, until, err := mockCache.ThrottleRemoteAction("user_id", "identity_id", time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	if throttled {
+		t.Error("expected first action not to be throttled")
+	}
+	if ttl := mockRedis.Ttl[remoteActionPrefix+"user_id::identity_id"]; ttl != time.Minute {
+		t.Errorf("expected key with 1 minute TTL, got %s", ttl)
+	}
+
+	throttled, again, err := mockCache.ThrottleRemoteAction("user_id", "identity_id", time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	if !throttled {
+		t.Error("expected second action within window to be throttled")
+	}
+	if !again.Equal(until.Truncate(time.Second)) {
+		t.Errorf("expected throttle until %s, got %s", until, again)
+	}
+
+	throttled, _, _ = mockCache.ThrottleRemoteAction("user_id", "other_identity", time.Minute)
+	if throttled {
+		t.Error("expected actions to be throttled per identity")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	// scheduledSendsKey is a sorted set of user_id::message_id members, scored with send time (unix seconds)
+	scheduledSendsKey = "scheduledsends"
+	// scheduledSendLeasePrefix keys are held by whoever is handling a scheduled draft (sender or user), see ClaimScheduledSend
+	scheduledSendLeasePrefix = "scheduledsend::lease::"
+	// unscheduleLease is the time given to UnscheduleSend to take a draft out of the set
+	unscheduleLease = 30 * time.Second
+)
+
+// ScheduleSend adds (or reschedules) a draft to the set of drafts waiting to be sent
+func (c *Cache) ScheduleSend(send ScheduledSend) error {
+	if send.UserId == "" || send.MessageId == "" {
+		return errors.New("[ScheduleSend] user_id and message_id are required")
+	}
+	err := c.Backend.ZAdd(scheduledSendsKey, float64(send.SendAt.Unix()), send.UserId+"::"+send.MessageId)
+	if err != nil {
+		log.WithError(err).Errorf("[ScheduleSend] failed to schedule message %s", send.MessageId)
+	}
+	return err
+}
+
+// UnscheduleSend removes a draft from the set of drafts waiting to be sent.
+// unscheduled is false if draft was not (or no more) scheduled, or if it is currently being sent.
+func (c *Cache) UnscheduleSend(userId, messageId string) (unscheduled bool, err error) {
+	leased, err := c.Backend.SetNX(scheduledSendLeasePrefix+userId+"::"+messageId, []byte("unschedule"), unscheduleLease)
+	if err != nil {
+		log.WithError(err).Errorf("[UnscheduleSend] failed to lease message %s", messageId)
+		return false, err
+	}
+	if !leased {
+		// draft has been handed over to a sender
+		return false, nil
+	}
+	defer c.releaseScheduledSend(userId, messageId)
+	unscheduled, err = c.Backend.ZRem(scheduledSendsKey, userId+"::"+messageId)
+	if err != nil {
+		log.WithError(err).Errorf("[UnscheduleSend] failed to unschedule message %s", messageId)
+	}
+	return
+}
+
+// ClaimScheduledSend takes a lease on a scheduled draft before sending it.
+// Draft is left in the set until sender calls CompleteScheduledSend,
+// thus it is sent again by scheduler when lease expires if sender fails to complete it.
+// claimed is false if draft is not scheduled anymore or if someone else holds the lease.
+func (c *Cache) ClaimScheduledSend(userId, messageId string, lease time.Duration) (claimed bool, err error) {
+	leased, err := c.Backend.SetNX(scheduledSendLeasePrefix+userId+"::"+messageId, []byte("send"), lease)
+	if err != nil {
+		log.WithError(err).Errorf("[ClaimScheduledSend] failed to lease message %s", messageId)
+		return false, err
+	}
+	if !leased {
+		return false, nil
+	}
+	_, scheduled, err := c.Backend.ZScore(scheduledSendsKey, userId+"::"+messageId)
+	if err != nil || !scheduled {
+		// draft has been unscheduled between scan and claim
+		if err != nil {
+			log.WithError(err).Errorf("[ClaimScheduledSend] failed to check schedule of message %s", messageId)
+		}
+		c.releaseScheduledSend(userId, messageId)
+		return false, err
+	}
+	return true, nil
+}
+
+// CompleteScheduledSend removes a claimed draft from the set once it has been sent (or dropped), and releases its lease.
+func (c *Cache) CompleteScheduledSend(userId, messageId string) error {
+	_, err := c.Backend.ZRem(scheduledSendsKey, userId+"::"+messageId)
+	if err != nil {
+		log.WithError(err).Errorf("[CompleteScheduledSend] failed to unschedule message %s", messageId)
+		return err
+	}
+	return c.releaseScheduledSend(userId, messageId)
+}
+
+// ReleaseScheduledSend gives a claimed draft back to scheduler, for instance after it has been rescheduled.
+func (c *Cache) ReleaseScheduledSend(userId, messageId string) error {
+	return c.releaseScheduledSend(userId, messageId)
+}
+
+func (c *Cache) releaseScheduledSend(userId, messageId string) error {
+	err := c.Backend.Del(scheduledSendLeasePrefix + userId + "::" + messageId)
+	if err != nil {
+		log.WithError(err).Errorf("[ScheduledSend] failed to release lease of message %s", messageId)
+	}
+	return err
+}
+
+// DueScheduledSends returns at most `max` drafts scheduled to be sent before `until`, earliest first.
+// Drafts are left in the set : callers must ClaimScheduledSend a draft before sending it.
+func (c *Cache) DueScheduledSends(until time.Time, max int64) (sends []ScheduledSend, err error) {
+	members, scores, err := c.Backend.ZRangeByScore(scheduledSendsKey, float64(until.Unix()), max)
+	if err != nil {
+		log.WithError(err).Error("[DueScheduledSends] failed to range over scheduled sends")
+		return nil, err
+	}
+	for i, member := range members {
+		split := strings.Split(member, "::")
+		if len(split) != 2 {
+			log.Warnf("[DueScheduledSends] invalid member %s in scheduled sends set", member)
+			continue
+		}
+		sends = append(sends, ScheduledSend{
+			MessageId: split[1],
+			SendAt:    time.Unix(int64(scores[i]), 0),
+			UserId:    split[0],
+		})
+	}
+	return
+}
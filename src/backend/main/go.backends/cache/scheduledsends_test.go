@@ -0,0 +1,104 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+	"time"
+)
+
+func TestCache_ScheduledSends(t *testing.T) {
+	mockCache, _, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, msgId := range []string{"first", "second", "later"} {
+		err = mockCache.ScheduleSend(ScheduledSend{
+			MessageId: msgId,
+			SendAt:    now.Add(time.Duration(i-1) * time.Minute),
+			UserId:    "user_id",
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// rescheduling a draft must not duplicate it
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "later", SendAt: now.Add(time.Hour), UserId: "user_id"})
+
+	due, err := mockCache.DueScheduledSends(now, 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(due) != 2 || due[0].MessageId != "first" || due[1].MessageId != "second" {
+		t.Errorf("expected first and second drafts to be due, got %+v", due)
+	}
+	if due[0].UserId != "user_id" || !due[0].SendAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("expected scheduled send with user_id and send time, got %+v", due[0])
+	}
+	if due, _ = mockCache.DueScheduledSends(now, 1); len(due) != 1 {
+		t.Errorf("expected at most 1 due draft, got %d", len(due))
+	}
+
+	unscheduled, err := mockCache.UnscheduleSend("user_id", "first")
+	if err != nil || !unscheduled {
+		t.Errorf("expected draft to be unscheduled, got %v (err: %v)", unscheduled, err)
+	}
+	if unscheduled, _ = mockCache.UnscheduleSend("user_id", "first"); unscheduled {
+		t.Error("expected second unschedule of the same draft to fail")
+	}
+	if due, _ = mockCache.DueScheduledSends(now.Add(2*time.Hour), 10); len(due) != 2 {
+		t.Errorf("expected 2 remaining scheduled drafts, got %+v", due)
+	}
+}
+
+func TestCache_ClaimScheduledSend(t *testing.T) {
+	mockCache, _, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	mockCache.ScheduleSend(ScheduledSend{MessageId: "draft", SendAt: now, UserId: "user_id"})
+
+	if claimed, _ := mockCache.ClaimScheduledSend("user_id", "unknown", time.Minute); claimed {
+		t.Error("expected claim of an unscheduled draft to fail")
+	}
+	claimed, err := mockCache.ClaimScheduledSend("user_id", "draft", time.Minute)
+	if err != nil || !claimed {
+		t.Errorf("expected draft to be claimed, got %v (err: %v)", claimed, err)
+	}
+	if claimed, _ = mockCache.ClaimScheduledSend("user_id", "draft", time.Minute); claimed {
+		t.Error("expected second claim of the same draft to fail")
+	}
+	if unscheduled, _ := mockCache.UnscheduleSend("user_id", "draft"); unscheduled {
+		t.Error("expected unschedule of a claimed draft to fail")
+	}
+	// a claimed draft stays scheduled until sender completes it
+	if due, _ := mockCache.DueScheduledSends(now, 10); len(due) != 1 {
+		t.Errorf("expected claimed draft to remain scheduled, got %+v", due)
+	}
+
+	if err = mockCache.ReleaseScheduledSend("user_id", "draft"); err != nil {
+		t.Error(err)
+	}
+	if claimed, _ = mockCache.ClaimScheduledSend("user_id", "draft", time.Minute); !claimed {
+		t.Error("expected released draft to be claimed again")
+	}
+	if err = mockCache.CompleteScheduledSend("user_id", "draft"); err != nil {
+		t.Error(err)
+	}
+	if due, _ := mockCache.DueScheduledSends(now, 10); len(due) != 0 {
+		t.Errorf("expected completed draft to leave scheduler, got %+v", due)
+	}
+	if claimed, _ = mockCache.ClaimScheduledSend("user_id", "draft", time.Minute); claimed {
+		t.Error("expected claim of a completed draft to fail")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	userExportPrefix  = "userexport::"
+	exportTokenPrefix = "exporttoken::"
+	// storedExportsKey is a sorted set of exports' objects uri, scored with their expiration time (unix seconds)
+	storedExportsKey = "userexports"
+)
+
+// SetUserExport stores user's last export until it expires.
+// Once archive is ready, export could also be retrieved by its download token,
+// and its object is added to the set of stored exports to be removed at expiration.
+func (c *Cache) SetUserExport(export *UserExport) error {
+	if export.UserId == "" {
+		return errors.New("[SetUserExport] user_id is required")
+	}
+	ttl := export.ExpiresAt.Sub(time.Now())
+	if ttl <= 0 {
+		return errors.New("[SetUserExport] export has expired")
+	}
+	value, err := json.Marshal(export)
+	if err != nil {
+		log.WithError(err).Errorf("[SetUserExport] failed to marshal export %+v", *export)
+		return err
+	}
+	err = c.Backend.Set(userExportPrefix+export.UserId, value, ttl)
+	if err != nil {
+		log.WithError(err).Errorf("[SetUserExport] failed to set export of user %s", export.UserId)
+		return err
+	}
+	if export.Token != "" {
+		err = c.Backend.Set(exportTokenPrefix+export.Token, value, ttl)
+		if err != nil {
+			log.WithError(err).Errorf("[SetUserExport] failed to set export token of user %s", export.UserId)
+			return err
+		}
+	}
+	if export.Uri != "" {
+		err = c.Backend.ZAdd(storedExportsKey, float64(export.ExpiresAt.Unix()), export.Uri)
+		if err != nil {
+			log.WithError(err).Errorf("[SetUserExport] failed to add export of user %s to stored exports", export.UserId)
+		}
+	}
+	return err
+}
+
+// GetUserExport returns user's last export, if it has not expired
+func (c *Cache) GetUserExport(userId string) (*UserExport, error) {
+	return c.getUserExport(userExportPrefix + userId)
+}
+
+// GetUserExportByToken returns the export referenced by a download token, if it has not expired
+func (c *Cache) GetUserExportByToken(token string) (*UserExport, error) {
+	return c.getUserExport(exportTokenPrefix + token)
+}
+
+func (c *Cache) getUserExport(key string) (*UserExport, error) {
+	value, err := c.Backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	export := new(UserExport)
+	err = json.Unmarshal(value, export)
+	if err != nil {
+		log.WithError(err).Errorf("[GetUserExport] failed to unmarshal value %s for key %s", value, key)
+		return nil, err
+	}
+	return export, nil
+}
+
+// ExpiredUserExports returns at most `max` objects' uri of exports that expired before `until`.
+// Objects are left in the set : callers must RemoveStoredExport an uri before removing its object.
+func (c *Cache) ExpiredUserExports(until time.Time, max int64) (uris []string, err error) {
+	uris, _, err = c.Backend.ZRangeByScore(storedExportsKey, float64(until.Unix()), max)
+	if err != nil {
+		log.WithError(err).Error("[ExpiredUserExports] failed to range over stored exports")
+	}
+	return
+}
+
+// RemoveStoredExport removes an export's object from the set of stored exports.
+// removed is false if object has already been taken by someone else.
+func (c *Cache) RemoveStoredExport(uri string) (removed bool, err error) {
+	removed, err = c.Backend.ZRem(storedExportsKey, uri)
+	if err != nil {
+		log.WithError(err).Errorf("[RemoveStoredExport] failed to remove %s from stored exports", uri)
+	}
+	return
+}
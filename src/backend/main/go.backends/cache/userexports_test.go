@@ -0,0 +1,75 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package cache
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+	"time"
+)
+
+func TestCache_UserExport(t *testing.T) {
+	mockCache, mock, err := InitializeTestCache()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	export := &UserExport{
+		ExpiresAt: time.Now().Add(time.Hour),
+		ExportId:  "export_id",
+		Status:    ExportPending,
+		UserId:    "user_id",
+	}
+	if err = mockCache.SetUserExport(export); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = mockCache.GetUserExportByToken(""); err == nil {
+		t.Error("expected pending export not to be retrievable by token")
+	}
+
+	export.Status = ExportReady
+	export.Token = "download_token"
+	export.Uri = "s3://caliopen-exports/user_id/export_id.zip"
+	if err = mockCache.SetUserExport(export); err != nil {
+		t.Error(err)
+		return
+	}
+	byUser, err := mockCache.GetUserExport("user_id")
+	if err != nil || byUser.Status != ExportReady || byUser.Uri != export.Uri {
+		t.Errorf("expected ready export for user, got %+v, err %v", byUser, err)
+	}
+	byToken, err := mockCache.GetUserExportByToken("download_token")
+	if err != nil || byToken.ExportId != "export_id" {
+		t.Errorf("expected export for token, got %+v, err %v", byToken, err)
+	}
+
+	if uris, _ := mockCache.ExpiredUserExports(time.Now(), 10); len(uris) != 0 {
+		t.Errorf("expected no expired export, got %v", uris)
+	}
+	uris, err := mockCache.ExpiredUserExports(time.Now().Add(2*time.Hour), 10)
+	if err != nil || len(uris) != 1 || uris[0] != export.Uri {
+		t.Errorf("expected export to expire, got %v, err %v", uris, err)
+	}
+	if removed, _ := mockCache.RemoveStoredExport(export.Uri); !removed {
+		t.Error("expected stored export to be removed")
+	}
+	if removed, _ := mockCache.RemoveStoredExport(export.Uri); removed {
+		t.Error("expected stored export to be removed only once")
+	}
+
+	// deleted user's export is not downloadable anymore
+	mockCache.PurgeUserSessions("user_id", nil)
+	for _, key := range []string{"userexport::user_id", "exporttoken::download_token"} {
+		if _, ok := mock.Store[key]; ok {
+			t.Errorf("expected key %s to be purged", key)
+		}
+	}
+
+	export.ExpiresAt = time.Now().Add(-time.Second)
+	if err = mockCache.SetUserExport(export); err == nil {
+		t.Error("expected expired export to be rejected")
+	}
+}
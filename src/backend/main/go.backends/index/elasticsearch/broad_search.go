@@ -9,8 +9,8 @@ import (
 	"gopkg.in/olivere/elastic.v5"
 )
 
-// Composes a full text ES query from IndexSearch object,
-// making use of "common terms query" (see https://www.elastic.co/guide/en/elasticsearch/reference/5.4/query-dsl-common-terms-query.html).
+// Composes a full text ES query from IndexSearch object (see IndexSearch.MatchQuery),
+// filtered by advanced search's clauses if any.
 // The func returns a compound response from ES to return 5 relevant docs filed by type if no doctype is provided,
 // otherwise, all docs found within type are returned.
 // See search API readme file into doc folder to see how the search func could be used by frontend.
@@ -19,25 +19,7 @@ func (es *ElasticSearchBackend) Search(search IndexSearch) (result *IndexResult,
 		sub_agg_key = "top_score_hits"
 		agg_key     = "by_type"
 	)
-	q := elastic.NewBoolQuery()
-
-	// Strictly filter on user_id
-	q = q.Filter(elastic.NewTermQuery("user_id", search.User_id))
-
-	for field, value := range search.Terms {
-		q = q.Should(elastic.NewCommonTermsQuery(field, value).CutoffFrequency(0.01)) //words that have a document frequency greater than 1% will be treated as common terms.
-		// always add the common fields below to improve results
-		q = q.Should(elastic.NewCommonTermsQuery("body_plain", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("body_plain.normalized", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("body_html", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("body_html.normalized", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("subject", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("subject.normalized", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("given_name", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("given_name.normalized", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("family_name", value).CutoffFrequency(0.01))
-		q = q.Should(elastic.NewCommonTermsQuery("family_name.normalized", value).CutoffFrequency(0.01))
-	}
+	q := search.MatchQuery()
 
 	// make aggregation to file docs by type:
 	// get only the 5 most relevant doc for each type if search.DocType is empty
@@ -199,3 +181,16 @@ func (es *ElasticSearchBackend) Search(search IndexSearch) (result *IndexResult,
 
 	return
 }
+
+// Count returns how many documents match search, within search's importance level range for messages
+func (es *ElasticSearchBackend) Count(search IndexSearch) (count int64, err error) {
+	q := search.MatchQuery()
+	if search.DocType == MessageIndexType {
+		q = q.Filter(elastic.NewRangeQuery("importance_level").Gte(search.ILrange[0]).Lte(search.ILrange[1]))
+	}
+	s := es.Client.Count(search.Shard_id).Query(q)
+	if search.DocType != "" {
+		s = s.Type(search.DocType)
+	}
+	return s.Do(context.TODO())
+}
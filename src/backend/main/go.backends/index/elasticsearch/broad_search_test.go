@@ -0,0 +1,139 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"gopkg.in/olivere/elastic.v5"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mockedES answers every search with response and records the bodies of search requests it received
+type mockedES struct {
+	*httptest.Server
+	response string
+	bodies   []map[string]interface{}
+}
+
+func newMockedES(t *testing.T, response string) (*mockedES, *ElasticSearchBackend) {
+	mock := &mockedES{response: response}
+	mock.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_search") {
+			body := map[string]interface{}{}
+			raw, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Errorf("invalid search body %s", raw)
+			}
+			mock.bodies = append(mock.bodies, body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mock.response))
+	}))
+	client, err := elastic.NewClient(elastic.SetURL(mock.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, &ElasticSearchBackend{ElasticSearchConfig{Urls: []string{mock.URL}}, client}
+}
+
+// boolClauses returns the JSON of each clause of kind (must, must_not, filter…) of a search body's bool query
+func boolClauses(body map[string]interface{}, kind string) (clauses []string) {
+	query, _ := body["query"].(map[string]interface{})
+	boolQuery, _ := query["bool"].(map[string]interface{})
+	list, ok := boolQuery[kind].([]interface{})
+	if !ok && boolQuery[kind] != nil {
+		list = []interface{}{boolQuery[kind]}
+	}
+	for _, clause := range list {
+		var j bytes.Buffer
+		enc := json.NewEncoder(&j)
+		enc.SetEscapeHTML(false) // keep scripts' comparison operators readable
+		enc.Encode(clause)
+		clauses = append(clauses, strings.TrimSpace(j.String()))
+	}
+	return
+}
+
+func TestElasticSearchBackend_Search(t *testing.T) {
+	mock, es := newMockedES(t, `{"took":1,"hits":{"total":1,"max_score":1.2,"hits":[
+		{"_index":"shard","_type":"indexed_message","_id":"4e6f0fc2-fb0f-4a6d-a1a0-1c6c1d6f4a0b","_score":1.2,"_source":{"subject":"meeting"}}
+	]}}`)
+	defer mock.Close()
+
+	query, err := ParseSearchQuery(`from:alice "project meeting" -tag:spam is:unread has:attachment after:2019-01-01 before:2019-02-01T12:00:00Z protocol:email pi>=50 subject:report`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := es.Search(IndexSearch{Shard_id: "shard", DocType: MessageIndexType, ILrange: [2]int8{-10, 10}, Query: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MessagesHits.Total != 1 || len(result.MessagesHits.Messages) != 1 {
+		t.Fatalf("expected mocked message to be returned, got %+v", result.MessagesHits)
+	}
+	if len(mock.bodies) != 1 {
+		t.Fatalf("expected 1 search request, got %d", len(mock.bodies))
+	}
+
+	body := mock.bodies[0]
+	must, mustNot, filters := boolClauses(body, "must"), boolClauses(body, "must_not"), boolClauses(body, "filter")
+	if len(must) != 3 || len(mustNot) != 1 || len(filters) != 7 {
+		t.Fatalf("unexpected bool query %v", body["query"])
+	}
+	for _, expected := range []struct {
+		clauses []string
+		parts   []string
+	}{
+		{must, []string{`"nested"`, `"path":"participants"`, `"participants.type":["From"]`, `"query":"alice"`}},
+		{must, []string{`"multi_match"`, `"query":"project meeting"`, `"type":"phrase"`, `"body_plain"`}},
+		{must, []string{`"match":{"subject"`, `"query":"report"`}},
+		{mustNot, []string{`{"term":{"tags":"spam"}}`}},
+		{filters, []string{`"term":{"user_id"`}},
+		{filters, []string{`{"term":{"is_unread":true}}`}},
+		{filters, []string{`"path":"attachments"`, `"exists":{"field":"attachments.content_type"}`}},
+		{filters, []string{`"date_sort"`, `"from":"2019-01-01T00:00:00Z"`, `"include_lower":true`}},
+		{filters, []string{`"date_sort"`, `"to":"2019-02-01T12:00:00Z"`, `"include_upper":false`}},
+		{filters, []string{`{"term":{"protocol":"email"}}`}},
+		{filters, []string{`"script"`, `>= params.limit * 3`, `"limit":50`}},
+	} {
+		found := false
+		for _, clause := range expected.clauses {
+			matches := true
+			for _, part := range expected.parts {
+				matches = matches && strings.Contains(clause, part)
+			}
+			found = found || matches
+		}
+		if !found {
+			t.Errorf("expected a clause with %v within %v", expected.parts, expected.clauses)
+		}
+	}
+	if body["post_filter"] == nil {
+		t.Error("expected importance level to be post filtered")
+	}
+}
+
+func TestElasticSearchBackend_SearchTerms(t *testing.T) {
+	mock, es := newMockedES(t, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	defer mock.Close()
+
+	search := IndexSearch{Shard_id: "shard", DocType: ContactIndexType, Terms: map[string][]string{"_all": {"alice"}}}
+	if _, err := es.Search(search); err != nil {
+		t.Fatal(err)
+	}
+	// simple search keeps on scoring documents with common terms queries
+	if should := boolClauses(mock.bodies[0], "should"); len(should) != 1+len(FullTextSearchFields) {
+		t.Errorf("expected common terms queries on %d fields, got %v", 1+len(FullTextSearchFields), should)
+	}
+	if must := boolClauses(mock.bodies[0], "must"); len(must) != 0 {
+		t.Errorf("expected no advanced clause, got %v", must)
+	}
+}
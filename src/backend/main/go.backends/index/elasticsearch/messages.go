@@ -14,6 +14,7 @@ import (
 	"github.com/satori/go.uuid"
 	"gopkg.in/oleiade/reflections.v1"
 	"gopkg.in/olivere/elastic.v5"
+	"io"
 	"sort"
 	"strings"
 )
@@ -64,6 +65,17 @@ func (es *ElasticSearchBackend) UpdateMessage(user *objects.UserInfo, msg *objec
 	return nil
 }
 
+func (es *ElasticSearchBackend) DeleteMessage(user *objects.UserInfo, msg *objects.Message) error {
+	_, err := es.Client.Delete().Index(user.Shard_id).Type(objects.MessageIndexType).Id(msg.Message_id.String()).
+		Refresh("wait_for").
+		Do(context.TODO())
+	if err != nil {
+		log.WithError(err).Warn("backend Index: deleteMessage operation failed")
+		return err
+	}
+	return nil
+}
+
 func (es *ElasticSearchBackend) SetMessageUnread(user *objects.UserInfo, message_id string, status bool) (err error) {
 	payload := struct {
 		Is_unread bool `json:"is_unread"`
@@ -176,6 +188,29 @@ func (es *ElasticSearchBackend) GetMessagesRange(filter objects.IndexSearch) (me
 	return messages, totalFound, nil
 }
 
+// FindMessagesByContact returns ids of user's messages which have contactId within their participants' contact_ids
+func (es *ElasticSearchBackend) FindMessagesByContact(user *objects.UserInfo, contactId string) (messageIds []string, err error) {
+	q := elastic.NewBoolQuery().
+		Filter(elastic.NewTermQuery("user_id", user.User_id)).
+		Filter(elastic.NewNestedQuery("participants", elastic.NewTermQuery("participants.contact_ids", contactId)))
+	scroll := es.Client.Scroll(user.Shard_id).Type(objects.MessageIndexType).Query(q).FetchSource(false).Size(500)
+	defer scroll.Clear(context.TODO())
+	messageIds = []string{}
+	for {
+		result, err := scroll.Do(context.TODO())
+		if err == io.EOF {
+			return messageIds, nil
+		}
+		if err != nil {
+			log.WithError(err).Warnf("[ElasticSearchBackend] FindMessagesByContact failed for contact %s", contactId)
+			return nil, err
+		}
+		for _, hit := range result.Hits.Hits {
+			messageIds = append(messageIds, hit.Id)
+		}
+	}
+}
+
 func executeMessagesQuery(search *elastic.SearchService) (messages []*objects.Message, totalFound int64, err error) {
 	result, err := search.Do(context.TODO())
 
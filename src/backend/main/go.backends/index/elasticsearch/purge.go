@@ -0,0 +1,48 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package index
+
+import (
+	"context"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/olivere/elastic.v5"
+)
+
+// userIndices returns indices where user's documents may live :
+// messages are indexed within user's shard, whereas some contacts have been indexed within an index named after user_id
+func userIndices(userId, shardId string) []string {
+	if shardId == "" || shardId == userId {
+		return []string{userId}
+	}
+	return []string{shardId, userId}
+}
+
+// DeleteUserDocuments deletes all messages and contacts indexed for user
+func (es *ElasticSearchBackend) DeleteUserDocuments(userId, shardId string) (count int64, err error) {
+	resp, err := es.Client.DeleteByQuery(userIndices(userId, shardId)...).
+		Type(MessageIndexType, ContactIndexType).
+		Query(elastic.NewTermQuery("user_id", userId)).
+		IgnoreUnavailable(true).
+		AllowNoIndices(true).
+		ProceedOnVersionConflict().
+		Refresh("true").
+		Do(context.TODO())
+	if err != nil {
+		log.WithError(err).Warnf("[ElasticSearchBackend] DeleteUserDocuments failed for user %s", userId)
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
+
+// CountUserDocuments returns the count of messages and contacts indexed for user
+func (es *ElasticSearchBackend) CountUserDocuments(userId, shardId string) (count int64, err error) {
+	return es.Client.Count(userIndices(userId, shardId)...).
+		Type(MessageIndexType, ContactIndexType).
+		Query(elastic.NewTermQuery("user_id", userId)).
+		IgnoreUnavailable(true).
+		AllowNoIndices(true).
+		Do(context.TODO())
+}
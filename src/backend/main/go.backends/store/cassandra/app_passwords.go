@@ -0,0 +1,40 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// AppPasswordStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+)
+
+// RetrieveAppPasswords returns all application passwords of user, an empty list if user has none
+func (cb *CassandraBackend) RetrieveAppPasswords(userId string) (passwords []AppPassword, err error) {
+	iter := cb.SessionQuery(`SELECT * FROM app_password WHERE user_id = ?`, userId).Iter()
+	passwords = []AppPassword{}
+	for {
+		m := map[string]interface{}{}
+		if !iter.MapScan(m) {
+			break
+		}
+		password := AppPassword{}
+		password.UnmarshalCQLMap(m)
+		passwords = append(passwords, password)
+	}
+	return passwords, iter.Close()
+}
+
+func (cb *CassandraBackend) CreateAppPassword(password *AppPassword) error {
+	return cb.SessionQuery(`INSERT INTO app_password (user_id, app_password_id, date_insert, label, password_hash) VALUES (?,?,?,?,?)`,
+		password.UserId,
+		password.AppPasswordId,
+		password.DateInsert,
+		password.Label,
+		password.Hash).Exec()
+}
+
+func (cb *CassandraBackend) DeleteAppPassword(userId, appPasswordId string) error {
+	return cb.SessionQuery(`DELETE FROM app_password WHERE user_id = ? AND app_password_id = ?`, userId, appPasswordId).Exec()
+}
@@ -0,0 +1,43 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package store
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/gocql/gocql"
+	"strings"
+)
+
+// RetrieveAutocryptPeer returns Autocrypt state of user's correspondent address,
+// or a NotFoundCaliopenErr if user never received a message from this address.
+func (cb *CassandraBackend) RetrieveAutocryptPeer(userId, address string) (peer *AutocryptPeer, err CaliopenError) {
+	m := map[string]interface{}{}
+	e := cb.SessionQuery(`SELECT * FROM autocrypt_peer WHERE user_id = ? AND address = ?`, userId, strings.ToLower(address)).MapScan(m)
+	if e == gocql.ErrNotFound {
+		return nil, NewCaliopenErr(NotFoundCaliopenErr, "[CassandraBackend]RetrieveAutocryptPeer not found in db")
+	}
+	if e != nil {
+		return nil, WrapCaliopenErrf(e, DbCaliopenErr, "[CassandraBackend]RetrieveAutocryptPeer failed")
+	}
+	peer = new(AutocryptPeer)
+	peer.UnmarshalCQLMap(m)
+	return peer, nil
+}
+
+// SaveAutocryptPeer creates or replaces Autocrypt state of an address
+func (cb *CassandraBackend) SaveAutocryptPeer(peer *AutocryptPeer) CaliopenError {
+	e := cb.SessionQuery(`INSERT INTO autocrypt_peer (user_id, address, autocrypt_timestamp, fingerprint, keydata, last_seen, prefer_encrypt) VALUES (?,?,?,?,?,?,?)`,
+		peer.UserId,
+		strings.ToLower(peer.Address),
+		peer.AutocryptTimestamp,
+		peer.Fingerprint,
+		peer.KeyData,
+		peer.LastSeen,
+		peer.PreferEncrypt).Exec()
+	if e != nil {
+		return WrapCaliopenErrf(e, DbCaliopenErr, "[CassandraBackend]SaveAutocryptPeer failed")
+	}
+	return nil
+}
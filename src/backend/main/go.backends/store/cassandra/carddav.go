@@ -0,0 +1,32 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package store
+
+import (
+	"errors"
+	"github.com/gocql/gocql"
+)
+
+// RetrieveCardDAVContactId returns id of the contact behind the card a CardDAV client named name,
+// or a `not found` error if no client named a card that way.
+func (cb *CassandraBackend) RetrieveCardDAVContactId(userId, name string) (string, error) {
+	var contactId gocql.UUID
+	err := cb.SessionQuery(`SELECT contact_id FROM contact_carddav_lookup WHERE user_id = ? AND name = ?`, userId, name).Scan(&contactId)
+	if err == gocql.ErrNotFound {
+		return "", errors.New("not found")
+	}
+	if err != nil {
+		return "", err
+	}
+	return contactId.String(), nil
+}
+
+func (cb *CassandraBackend) SetCardDAVName(userId, name, contactId string) error {
+	return cb.SessionQuery(`INSERT INTO contact_carddav_lookup (user_id, name, contact_id) VALUES (?,?,?)`, userId, name, contactId).Exec()
+}
+
+func (cb *CassandraBackend) DeleteCardDAVName(userId, name string) error {
+	return cb.SessionQuery(`DELETE FROM contact_carddav_lookup WHERE user_id = ? AND name = ?`, userId, name).Exec()
+}
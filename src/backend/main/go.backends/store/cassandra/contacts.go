@@ -156,6 +156,21 @@ func (cb *CassandraBackend) LookupContactsByIdentifier(user_id, address string)
 	return
 }
 
+// RetrieveContactLookups returns all contact points of user's contacts, with ids of contacts sharing each of them
+func (cb *CassandraBackend) RetrieveContactLookups(userId string) (lookups []ContactByContactPoints, err error) {
+	iter := cb.SessionQuery(`SELECT type, value, contact_ids FROM contact_lookup WHERE user_id = ?`, userId).Iter()
+	lookup := ContactByContactPoints{UserID: userId}
+	for iter.Scan(&lookup.Type, &lookup.Value, &lookup.ContactIDs) {
+		lookups = append(lookups, lookup)
+		lookup = ContactByContactPoints{UserID: userId}
+	}
+	err = iter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("[CassandraBackend] RetrieveContactLookups: %s", err)
+	}
+	return
+}
+
 // ContactExist exposes a simple API to check if a contact with these uuids exits in db
 func (cb *CassandraBackend) ContactExists(userId, contactId string) bool {
 	var count int
@@ -68,6 +68,30 @@ func (cb *CassandraBackend) GetDiscussionGlobalLookup(user_id UUID, hash string)
 	return
 }
 
+// MoveDiscussionLookup makes participants' global lookup follow a change of their contacts :
+// discussion found with participants before the change is found with participants after it.
+// Lookup of participants after the change is left untouched if it already leads to a discussion.
+func (cb *CassandraBackend) MoveDiscussionLookup(user_id UUID, before, after []Participant) error {
+	oldHash, _ := cb.GetDiscussionHashByParticipants(user_id, before)
+	newHash, _ := cb.GetDiscussionHashByParticipants(user_id, after)
+	if oldHash == newHash {
+		return nil
+	}
+	lookup, err := cb.GetDiscussionGlobalLookup(user_id, oldHash)
+	if err == gocql.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = cb.SessionQuery(`INSERT INTO discussion_global_lookup (user_id, hashed, discussion_id) VALUES (?,?,?) IF NOT EXISTS`,
+		user_id.String(), newHash, lookup.DiscussionId.String()).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	return cb.SessionQuery(`DELETE FROM discussion_global_lookup WHERE user_id = ? AND hashed = ?`, user_id.String(), oldHash).Exec()
+}
+
 // GetDiscussionByParticipants retrieve the hash value related to a list of participants used for discussion lookup
 // golang version of python NewMessage.hash_participants function
 func (cb *CassandraBackend) GetDiscussionHashByParticipants(user_id UUID, participants []Participant) (string, error) {
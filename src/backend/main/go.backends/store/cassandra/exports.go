@@ -0,0 +1,87 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// ExportStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"io"
+)
+
+// RetrieveUserMessages returns a chan to range over all messages of user, drafts included.
+// Chan is closed once all messages have been sent, caller must drain it.
+func (cb *CassandraBackend) RetrieveUserMessages(userId string) (<-chan *Message, error) {
+	ch := make(chan *Message)
+	go func() {
+		iter := cb.SessionQuery(`SELECT * FROM message WHERE user_id = ?`, userId).Iter()
+		for {
+			m := map[string]interface{}{}
+			if !iter.MapScan(m) {
+				break
+			}
+			msg := new(Message).NewEmpty().(*Message)
+			msg.UnmarshalCQLMap(m)
+			ch <- msg
+		}
+		if err := iter.Close(); err != nil {
+			log.WithError(err).Warnf("[CassandraBackend] RetrieveUserMessages failed to iterate over messages of user %s", userId)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// RetrieveUserContacts returns a chan to range over all contacts of user, with their related objects.
+// Chan is closed once all contacts have been sent, caller must drain it.
+func (cb *CassandraBackend) RetrieveUserContacts(userId string) (<-chan *Contact, error) {
+	ch := make(chan *Contact)
+	go func() {
+		iter := cb.SessionQuery(`SELECT * FROM contact WHERE user_id = ?`, userId).Iter()
+		for {
+			m := map[string]interface{}{}
+			if !iter.MapScan(m) {
+				break
+			}
+			contact := new(Contact).NewEmpty().(*Contact)
+			contact.UnmarshalCQLMap(m)
+			if err := cb.RetrieveRelated(contact); err != nil {
+				log.WithError(err).Warnf("[CassandraBackend] RetrieveUserContacts failed to retrieve related of contact %s", contact.ContactId.String())
+			}
+			ch <- contact
+		}
+		if err := iter.Close(); err != nil {
+			log.WithError(err).Warnf("[CassandraBackend] RetrieveUserContacts failed to iterate over contacts of user %s", userId)
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// PutUserExport stores an export's archive into object store
+func (cb *CassandraBackend) PutUserExport(name string, archive io.Reader) (uri string, size int64, err error) {
+	if cb.ObjectsStore == nil {
+		return "", 0, errors.New("[CassandraBackend] no object store to put export into")
+	}
+	return cb.ObjectsStore.PutExport(name, archive)
+}
+
+// GetUserExport returns a reader on an export's archive
+func (cb *CassandraBackend) GetUserExport(uri string) (archive io.Reader, err error) {
+	if cb.ObjectsStore == nil {
+		return nil, errors.New("[CassandraBackend] no object store to get export from")
+	}
+	return cb.ObjectsStore.GetObject(uri)
+}
+
+// RemoveUserExport removes an export's archive from object store
+func (cb *CassandraBackend) RemoveUserExport(uri string) error {
+	if cb.ObjectsStore == nil {
+		return errors.New("[CassandraBackend] no object store to remove export from")
+	}
+	return cb.ObjectsStore.RemoveObject(uri)
+}
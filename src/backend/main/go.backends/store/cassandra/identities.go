@@ -14,6 +14,7 @@ import (
 	"github.com/gocassa/gocassa"
 	"github.com/gocql/gocql"
 	"gopkg.in/oleiade/reflections.v1"
+	"strings"
 	"time"
 )
 
@@ -267,17 +268,21 @@ func (cb *CassandraBackend) RetrieveAllRemotes(withCredentials bool) (<-chan *Us
 	return ch, nil
 }
 
+// DeleteUserIdentity deletes identity with its credentials and lookups.
+// Identity's row is deleted last, for deletion to be run again if it fails.
 func (cb *CassandraBackend) DeleteUserIdentity(userIdentity *UserIdentity) error {
 	if cb.UseVault {
 		err := cb.Vault.DeleteCredentials(userIdentity.UserId.String(), userIdentity.Id.String())
 		if err != nil {
 			log.WithError(err).Warn("[CassandraBackend] DeleteUserIdentity failed to delete credentials in vault")
+			return err
 		}
 	}
 	// delete related rows in relevant lookup tables
 	err := cb.DeleteLookups(userIdentity)
 	if err != nil {
 		log.WithError(err).Error("[CassandraBackend] DeleteUserIdentity: failed to delete lookups")
+		return err
 	}
 	return cb.SessionQuery(`DELETE FROM user_identity WHERE user_id = ? AND identity_id = ?`, userIdentity.UserId, userIdentity.Id).Exec()
 }
@@ -357,6 +362,28 @@ func (cb *CassandraBackend) LookupIdentityByType(identityType string, user_id ..
 	return
 }
 
+// LookupWKDIdentity returns the local identity of domain whose hashed local-part is hash,
+// or a `not found` error if there is none
+func (cb *CassandraBackend) LookupWKDIdentity(domain, hash string) (*WKDLookup, error) {
+	var address string
+	var userId, identityId gocql.UUID
+	err := cb.SessionQuery(`SELECT address, user_id, identity_id FROM wkd_lookup WHERE domain = ? AND hash = ?`,
+		strings.ToLower(domain), hash).Scan(&address, &userId, &identityId)
+	if err == gocql.ErrNotFound {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &WKDLookup{
+		Address:    address,
+		Domain:     strings.ToLower(domain),
+		Hash:       hash,
+		IdentityId: UUID(identityId),
+		UserId:     UUID(userId),
+	}, nil
+}
+
 // IsLocalIdentity is helper to make a lookup query in cassandra and check if a UserIdentity is "local"
 // return true only if identity has been found and is local
 func (cb *CassandraBackend) IsLocalIdentity(userId, identityId string) bool {
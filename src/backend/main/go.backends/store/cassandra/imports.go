@@ -0,0 +1,36 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// ImportStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	"errors"
+	"io"
+)
+
+// PutMailboxImport stores an uploaded mailbox into object store
+func (cb *CassandraBackend) PutMailboxImport(name string, mailbox io.Reader) (uri string, size int64, err error) {
+	if cb.ObjectsStore == nil {
+		return "", 0, errors.New("[CassandraBackend] no object store to put mailbox into")
+	}
+	return cb.ObjectsStore.PutImport(name, mailbox)
+}
+
+// GetMailboxImport returns a reader on an uploaded mailbox
+func (cb *CassandraBackend) GetMailboxImport(uri string) (mailbox io.Reader, err error) {
+	if cb.ObjectsStore == nil {
+		return nil, errors.New("[CassandraBackend] no object store to get mailbox from")
+	}
+	return cb.ObjectsStore.GetObject(uri)
+}
+
+// RemoveMailboxImport removes an uploaded mailbox from object store
+func (cb *CassandraBackend) RemoveMailboxImport(uri string) error {
+	if cb.ObjectsStore == nil {
+		return errors.New("[CassandraBackend] no object store to remove mailbox from")
+	}
+	return cb.ObjectsStore.RemoveObject(uri)
+}
@@ -27,6 +27,8 @@ func (cb *CassandraBackend) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
 	label = ?,
 	resource_type = ?,
 	size = ?,
+	source = ?,
+	source_url = ?,
 	"use" = ?,
 	x = ?,
 	y = ?
@@ -43,6 +45,8 @@ func (cb *CassandraBackend) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
 		pubkey.Label,
 		pubkey.ResourceType,
 		pubkey.Size,
+		pubkey.Source,
+		pubkey.SourceURL,
 		pubkey.Use,
 		pubkey.X,
 		pubkey.Y,
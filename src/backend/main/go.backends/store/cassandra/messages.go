@@ -5,7 +5,6 @@
 package store
 
 import (
-	"errors"
 	"fmt"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/gocassa/gocassa"
@@ -59,8 +58,11 @@ func (cb *CassandraBackend) UpdateMessage(msg *Message, fields map[string]interf
 	return err
 }
 
+// DeleteMessage (hard) deletes message from db, as python's API does when user deletes a message :
+// Caliopen has no soft delete (yet). It is used when a message has been deleted from remote IMAP mailbox,
+// and to remove a draft once it has been split per sender identity.
 func (cb *CassandraBackend) DeleteMessage(msg *Message) error {
-	return errors.New("[CassandraBackend] DeleteMessage not yet implemented")
+	return cb.SessionQuery(`DELETE FROM message WHERE user_id = ? AND message_id = ?`, msg.User_id.String(), msg.Message_id.String()).Exec()
 }
 
 func (cb *CassandraBackend) SetMessageUnread(user_id, message_id string, status bool) (err error) {
@@ -68,17 +70,49 @@ func (cb *CassandraBackend) SetMessageUnread(user_id, message_id string, status
 	return q.Exec()
 }
 
+// CreateMessageExternalRefLookup inserts an entry into message_external_ref_lookup table,
+// to be able to find back message from its external message-id
+func (cb *CassandraBackend) CreateMessageExternalRefLookup(userID, identityID, messageID UUID, externalMessageID string) error {
+	return cb.SessionQuery(`INSERT INTO message_external_ref_lookup (user_id, external_msg_id, identity_id, message_id) VALUES (?,?,?,?)`,
+		userID.String(),
+		externalMessageID,
+		identityID.String(),
+		messageID.String()).Exec()
+}
+
+// IsMessageDeleted tells if user explicitly deleted the message of identity with this external message-id,
+// as recorded into message_deleted_lookup table by python's API.
+func (cb *CassandraBackend) IsMessageDeleted(userID, identityID, externalMessageID string) (bool, error) {
+	var count int
+	err := cb.SessionQuery(`SELECT count(*) FROM message_deleted_lookup WHERE user_id = ? AND identity_id = ? AND external_msg_id = ?`,
+		userID, identityID, externalMessageID).Scan(&count)
+	return count > 0, err
+}
+
+// RemoveMessageDeletedLookup removes the deletion record, once it has been reflected onto remote account
+func (cb *CassandraBackend) RemoveMessageDeletedLookup(userID, identityID, externalMessageID string) error {
+	return cb.SessionQuery(`DELETE FROM message_deleted_lookup WHERE user_id = ? AND identity_id = ? AND external_msg_id = ?`,
+		userID, identityID, externalMessageID).Exec()
+}
+
 // SeekMessageByExternalRef return first message found in cassandra's message_external_ref_lookup table, if any.
 // if identityID param is an empty string, `identity_id` key will be ignored in cql request
 func (cb *CassandraBackend) SeekMessageByExternalRef(userID, externalMessageID, identityID string) (messageID UUID, err error) {
 	result := map[string]interface{}{}
-	if identityID == "" {
-		err = cb.SessionQuery(`SELECT message_id FROM message_external_ref_lookup WHERE user_id = ? AND external_msg_id = ? LIMIT 1"`, userID, externalMessageID).MapScan(result)
-	} else {
-		err = cb.SessionQuery(`SELECT message_id FROM message_external_ref_lookup WHERE user_id = ? AND external_msg_id = ? AND identity_id = ?`, userID, externalMessageID, identityID).MapScan(result)
-	}
+	query, values := seekExternalRefQuery(userID, externalMessageID, identityID)
+	err = cb.SessionQuery(query, values...).MapScan(result)
 	if err != nil || result["message_id"] == nil {
 		return EmptyUUID, err
 	}
 	return UUID(result["message_id"].(gocql.UUID)), err
 }
+
+// seekExternalRefQuery builds SeekMessageByExternalRef's cql request and its values
+func seekExternalRefQuery(userID, externalMessageID, identityID string) (query string, values []interface{}) {
+	if identityID == "" {
+		return `SELECT message_id FROM message_external_ref_lookup WHERE user_id = ? AND external_msg_id = ? LIMIT 1`,
+			[]interface{}{userID, externalMessageID}
+	}
+	return `SELECT message_id FROM message_external_ref_lookup WHERE user_id = ? AND external_msg_id = ? AND identity_id = ?`,
+		[]interface{}{userID, externalMessageID, identityID}
+}
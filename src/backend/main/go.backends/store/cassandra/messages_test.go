@@ -0,0 +1,28 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSeekExternalRefQuery(t *testing.T) {
+	for _, identityID := range []string{"", "identity_id"} {
+		query, values := seekExternalRefQuery("user_id", "msg@example.com", identityID)
+		if strings.ContainsAny(query, `"'`) {
+			t.Errorf("unexpected quote in cql request : %s", query)
+		}
+		if strings.Count(query, "?") != len(values) {
+			t.Errorf("expected one value per bind marker in %s, got %v", query, values)
+		}
+		if values[0] != "user_id" || values[1] != "msg@example.com" {
+			t.Errorf("expected user_id and external message-id to be bound first, got %v", values)
+		}
+		if strings.Contains(query, "identity_id") != (identityID != "") {
+			t.Errorf("expected identity_id to be in cql request only when given, got %s", query)
+		}
+	}
+}
@@ -119,3 +119,48 @@ func (cb *CassandraBackend) DeleteNotifications(userId string, until time.Time)
 	}
 	return nil
 }
+
+// RetrieveDigestState returns when last email digest has been sent to user and until when
+// a digest being sent is leased to a scheduler, zero times if none
+func (cb *CassandraBackend) RetrieveDigestState(userId string) (sent, leaseUntil time.Time, err error) {
+	err = cb.SessionQuery(`SELECT date_sent, lease_until FROM notification_digest WHERE user_id = ?`, userId).Scan(&sent, &leaseUntil)
+	if err == gocql.ErrNotFound {
+		return time.Time{}, time.Time{}, nil
+	}
+	return
+}
+
+// ClaimDigest leases user's digest until the given date,
+// only if digest's lease is still the given previous one (zero if digest is not leased).
+// It returns false if another process has already taken this digest.
+func (cb *CassandraBackend) ClaimDigest(userId string, previousLease, until time.Time) (claimed bool, err error) {
+	existing := map[string]interface{}{}
+	if previousLease.IsZero() {
+		claimed, err = cb.SessionQuery(`UPDATE notification_digest SET lease_until = ? WHERE user_id = ? IF lease_until = null`,
+			until, userId).MapScanCAS(existing)
+		if err != nil || claimed || len(existing) > 0 {
+			return
+		}
+		// no digest has ever been sent to user
+		existing = map[string]interface{}{}
+		return cb.SessionQuery(`INSERT INTO notification_digest (user_id, lease_until) VALUES (?, ?) IF NOT EXISTS`,
+			userId, until).MapScanCAS(existing)
+	}
+	return cb.SessionQuery(`UPDATE notification_digest SET lease_until = ? WHERE user_id = ? IF lease_until = ?`,
+		until, userId, previousLease).MapScanCAS(existing)
+}
+
+// SetDigestDate records that a digest has been sent to user at date, and releases digest's lease.
+func (cb *CassandraBackend) SetDigestDate(userId string, date time.Time) error {
+	return cb.SessionQuery(`UPDATE notification_digest SET date_sent = ?, lease_until = null WHERE user_id = ?`,
+		date, userId).Exec()
+}
+
+// ReleaseDigest gives up user's digest lease, as long as it is still the given one,
+// for digest to be sent again at next scan.
+func (cb *CassandraBackend) ReleaseDigest(userId string, lease time.Time) error {
+	existing := map[string]interface{}{}
+	_, err := cb.SessionQuery(`UPDATE notification_digest SET lease_until = null WHERE user_id = ? IF lease_until = ?`,
+		userId, lease).MapScanCAS(existing)
+	return err
+}
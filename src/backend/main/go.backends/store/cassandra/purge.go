@@ -0,0 +1,265 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// PurgeStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+// tables partitioned by user_id, emptied at each purge step
+var purgedTables = map[string][]string{
+	PurgeStepIdentities:  {"user_identity"},
+	PurgeStepMessages:    {"message", "message_external_ref_lookup", "user_raw_lookup", "scheduled_send"},
+	PurgeStepContacts:    {"contact", "contact_lookup", "contact_carddav_lookup", "public_key", "autocrypt_peer"},
+	PurgeStepDiscussions: {"discussion", "discussion_list_lookup", "discussion_thread_lookup", "discussion_global_lookup"},
+	PurgeStepDevices:     {"device", "device_location", "device_connection_log"},
+	PurgeStepAccount:     {"user_tag", "filter_rule", "saved_search", "settings", "notification", "notification_digest", "app_password"},
+}
+
+// RetrieveUserPurge returns purge state of user, or a `not found` error if purge has not started yet
+func (cb *CassandraBackend) RetrieveUserPurge(userId string) (purge *UserPurge, err error) {
+	m := map[string]interface{}{}
+	err = cb.SessionQuery(`SELECT * FROM user_purge WHERE user_id = ?`, userId).MapScan(m)
+	if err == gocql.ErrNotFound {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	purge = new(UserPurge)
+	purge.UnmarshalCQLMap(m)
+	return purge, nil
+}
+
+// RetrieveUnfinishedPurges returns purges that have been interrupted before their last step
+func (cb *CassandraBackend) RetrieveUnfinishedPurges() (purges []UserPurge, err error) {
+	iter := cb.SessionQuery(`SELECT * FROM user_purge`).Iter()
+	for {
+		m := map[string]interface{}{}
+		if !iter.MapScan(m) {
+			break
+		}
+		purge := UserPurge{}
+		purge.UnmarshalCQLMap(m)
+		if !purge.Completed() {
+			purges = append(purges, purge)
+		}
+	}
+	err = iter.Close()
+	return
+}
+
+// SaveUserPurge saves purge progress. Lease is left untouched, see ClaimUserPurge.
+func (cb *CassandraBackend) SaveUserPurge(purge *UserPurge) error {
+	var dateEnd interface{}
+	if !purge.DateEnd.IsZero() {
+		dateEnd = purge.DateEnd
+	}
+	return cb.SessionQuery(`UPDATE user_purge SET counts = ?, date_end = ?, date_start = ?, date_update = ?, last_error = ?, step = ? WHERE user_id = ?`,
+		purge.Counts, dateEnd, purge.DateStart, purge.DateUpdate, purge.LastError, purge.Step, purge.UserId).Exec()
+}
+
+// ClaimUserPurge leases purge of user until the given date,
+// as long as lease has not been modified by someone else since it has been read.
+// previous is zero to claim a purge that has never been leased.
+// Purge must have been saved before being claimed.
+func (cb *CassandraBackend) ClaimUserPurge(userId string, previous, until time.Time) (claimed bool, err error) {
+	existing := map[string]interface{}{}
+	if previous.IsZero() {
+		return cb.SessionQuery(`UPDATE user_purge SET lease_until = ? WHERE user_id = ? IF lease_until = null`,
+			until, userId).MapScanCAS(existing)
+	}
+	return cb.SessionQuery(`UPDATE user_purge SET lease_until = ? WHERE user_id = ? IF lease_until = ?`,
+		until, userId, previous).MapScanCAS(existing)
+}
+
+// PurgeUserMessages deletes user's messages and their lookups,
+// along with raw messages that are not shared with other users and objects stored for them.
+// Objects are removed before the rows referencing them, for purge to be resumed without leaving orphans.
+// It returns the count of removed messages, raw messages and objects.
+func (cb *CassandraBackend) PurgeUserMessages(userId string) (count int, err error) {
+	rawIds := map[string]bool{}
+	iter := cb.SessionQuery(`SELECT * FROM message WHERE user_id = ?`, userId).Iter()
+	for {
+		m := map[string]interface{}{}
+		if !iter.MapScan(m) {
+			break
+		}
+		msg := new(Message).NewEmpty().(*Message)
+		msg.UnmarshalCQLMap(m)
+		if (msg.Raw_msg_id != UUID{}) {
+			rawIds[msg.Raw_msg_id.String()] = true
+		}
+		// temporary attachments of drafts
+		for _, attachment := range msg.Attachments {
+			if attachment.URL != "" && cb.ObjectsStore != nil {
+				if e := cb.ObjectsStore.RemoveObject(attachment.URL); e != nil {
+					log.WithError(e).Warnf("[CassandraBackend] PurgeUserMessages failed to remove attachment %s", attachment.URL)
+					continue
+				}
+				count++
+			}
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return
+	}
+	iter = cb.SessionQuery(`SELECT raw_msg_id FROM user_raw_lookup WHERE user_id = ?`, userId).Iter()
+	var rawId gocql.UUID
+	for iter.Scan(&rawId) {
+		rawIds[rawId.String()] = true
+	}
+	if err = iter.Close(); err != nil {
+		return
+	}
+
+	for rawId := range rawIds {
+		shared, e := cb.rawMessageIsShared(userId, rawId)
+		if e != nil {
+			return count, e
+		}
+		if shared {
+			continue
+		}
+		var uri string
+		e = cb.SessionQuery(`SELECT uri FROM raw_message WHERE raw_msg_id = ?`, rawId).Scan(&uri)
+		if e == gocql.ErrNotFound {
+			continue
+		}
+		if e != nil {
+			return count, e
+		}
+		if uri != "" && cb.ObjectsStore != nil {
+			if e = cb.ObjectsStore.RemoveObject(uri); e != nil {
+				return count, e
+			}
+			count++
+		}
+		if e = cb.SessionQuery(`DELETE FROM raw_message WHERE raw_msg_id = ?`, rawId).Exec(); e != nil {
+			return count, e
+		}
+		count++
+	}
+
+	rows, err := cb.PurgeUserTables(userId, PurgeStepMessages)
+	return count + rows, err
+}
+
+// rawMessageIsShared returns true if raw message has also been delivered to another user
+func (cb *CassandraBackend) rawMessageIsShared(userId, rawId string) (bool, error) {
+	iter := cb.SessionQuery(`SELECT user_id FROM user_raw_lookup WHERE raw_msg_id = ?`, rawId).Iter()
+	var owner gocql.UUID
+	shared := false
+	for iter.Scan(&owner) {
+		shared = shared || owner.String() != userId
+	}
+	return shared, iter.Close()
+}
+
+// PurgeUserTables deletes user's partitions in tables related to a purge step
+// and returns the count of deleted rows
+func (cb *CassandraBackend) PurgeUserTables(userId, step string) (count int, err error) {
+	for _, table := range purgedTables[step] {
+		var rows int
+		err = cb.SessionQuery(`SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, userId).Scan(&rows)
+		if err != nil {
+			return
+		}
+		if rows == 0 {
+			continue
+		}
+		err = cb.SessionQuery(`DELETE FROM `+table+` WHERE user_id = ?`, userId).Exec()
+		if err != nil {
+			return
+		}
+		count += rows
+	}
+	return
+}
+
+// AnonymizeUser erases personal data from user's entry.
+// User's entry is kept, with its name, to prevent a new account from taking over the same username and addresses.
+func (cb *CassandraBackend) AnonymizeUser(user *User) error {
+	if user.RecoveryEmail != "" {
+		err := cb.SessionQuery(`DELETE FROM user_recovery_email WHERE recovery_email = ?`, user.RecoveryEmail).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	err := cb.SessionQuery(`DELETE FROM settings_digest_lookup WHERE notification_digest IN ? AND user_id = ?`,
+		[]string{DigestDaily, DigestWeekly}, user.UserId).Exec()
+	if err != nil {
+		return err
+	}
+	return cb.SessionQuery(`UPDATE user SET contact_id = null, family_name = null, given_name = null, params = null, password = null, pi = null, privacy_features = null, recovery_email = null WHERE user_id = ?`,
+		user.UserId).Exec()
+}
+
+// PurgeUserObjects removes user's exports and imports from object store and returns the count of removed objects
+func (cb *CassandraBackend) PurgeUserObjects(userId string) (count int, err error) {
+	if cb.ObjectsStore == nil {
+		return
+	}
+	uris, err := cb.ObjectsStore.ListUserObjects(userId)
+	if err != nil {
+		return
+	}
+	for _, uri := range uris {
+		if err = cb.ObjectsStore.RemoveObject(uri); err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
+
+// CountUserObjects returns the count of user's credentials left in vault and of user's objects left in object store,
+// keyed by backend, for backends that are not empty
+func (cb *CassandraBackend) CountUserObjects(userId string) (counts map[string]int, err error) {
+	counts = map[string]int{}
+	if cb.UseVault {
+		remoteIds, e := cb.Vault.ListCredentials(userId)
+		if e != nil {
+			return nil, e
+		}
+		if len(remoteIds) > 0 {
+			counts["vault"] = len(remoteIds)
+		}
+	}
+	if cb.ObjectsStore != nil {
+		uris, e := cb.ObjectsStore.ListUserObjects(userId)
+		if e != nil {
+			return nil, e
+		}
+		if len(uris) > 0 {
+			counts["object_store"] = len(uris)
+		}
+	}
+	return
+}
+
+// CountUserRows returns the count of rows left in user's partitions, for tables that are not empty
+func (cb *CassandraBackend) CountUserRows(userId string) (counts map[string]int, err error) {
+	counts = map[string]int{}
+	for _, step := range PurgeSteps {
+		for _, table := range purgedTables[step] {
+			var rows int
+			err = cb.SessionQuery(`SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, userId).Scan(&rows)
+			if err != nil {
+				return
+			}
+			if rows > 0 {
+				counts[table] = rows
+			}
+		}
+	}
+	return
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gocassa/gocassa"
 	"github.com/gocql/gocql"
 	"io"
+	"io/ioutil"
 )
 
 func (cb *CassandraBackend) StoreRawMessage(msg obj.RawMessage) (err error) {
@@ -61,13 +62,15 @@ func (cb *CassandraBackend) GetRawMessage(raw_message_id string) (message obj.Ra
 		if e != nil {
 			return obj.RawMessage{}, e
 		}
-		raw_data := make([]byte, message.Raw_Size)
-		s, e := reader.Read(raw_data)
-		if s == 0 || e != io.EOF {
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		raw_data, e := ioutil.ReadAll(reader)
+		if e != nil {
 			return obj.RawMessage{}, e
 		}
-		if uint64(s) != message.Raw_Size {
-			log.Warnf("[cassandra.GetRawMessage] : Read %d bytes from Object Store, expected %d.", s, message.Raw_Size)
+		if uint64(len(raw_data)) != message.Raw_Size {
+			log.Warnf("[cassandra.GetRawMessage] : Read %d bytes from Object Store, expected %d.", len(raw_data), message.Raw_Size)
 		}
 		message.Raw_data = string(raw_data)
 	}
@@ -0,0 +1,60 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// ScheduledSendStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/gocql/gocql"
+	"time"
+)
+
+// SaveScheduledSend saves (or reschedules) a draft waiting to be sent
+func (cb *CassandraBackend) SaveScheduledSend(send *ScheduledSend) error {
+	return cb.SessionQuery(`INSERT INTO scheduled_send (user_id, message_id, attempts, send_at) VALUES (?, ?, ?, ?)`,
+		send.UserId, send.MessageId, send.Attempts, send.SendAt).Exec()
+}
+
+// RetrieveScheduledSend returns a draft waiting to be sent, or a `not found` error if draft is not scheduled
+func (cb *CassandraBackend) RetrieveScheduledSend(userId, messageId string) (send *ScheduledSend, err error) {
+	send = &ScheduledSend{
+		MessageId: messageId,
+		UserId:    userId,
+	}
+	err = cb.SessionQuery(`SELECT attempts, send_at FROM scheduled_send WHERE user_id = ? AND message_id = ?`,
+		userId, messageId).Scan(&send.Attempts, &send.SendAt)
+	if err == gocql.ErrNotFound {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return send, nil
+}
+
+// RetrieveScheduledSends returns all drafts waiting to be sent, whatever their owner
+func (cb *CassandraBackend) RetrieveScheduledSends() (sends []ScheduledSend, err error) {
+	iter := cb.SessionQuery(`SELECT user_id, message_id, attempts, send_at FROM scheduled_send`).Iter()
+	var userId, messageId gocql.UUID
+	var attempts int
+	var sendAt time.Time
+	for iter.Scan(&userId, &messageId, &attempts, &sendAt) {
+		sends = append(sends, ScheduledSend{
+			Attempts:  attempts,
+			MessageId: messageId.String(),
+			SendAt:    sendAt,
+			UserId:    userId.String(),
+		})
+	}
+	err = iter.Close()
+	return
+}
+
+// DeleteScheduledSend removes a draft from drafts waiting to be sent
+func (cb *CassandraBackend) DeleteScheduledSend(userId, messageId string) error {
+	return cb.SessionQuery(`DELETE FROM scheduled_send WHERE user_id = ? AND message_id = ?`, userId, messageId).Exec()
+}
@@ -0,0 +1,74 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+//
+// SavedSearchStorage interface implementation for cassandra backend
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/gocql/gocql"
+)
+
+// RetrieveSavedSearches returns all saved searches of user, an empty list if user has none
+func (cb *CassandraBackend) RetrieveSavedSearches(userId string) (searches []SavedSearch, err error) {
+	iter := cb.SessionQuery(`SELECT * FROM saved_search WHERE user_id = ?`, userId).Iter()
+	searches = []SavedSearch{}
+	for {
+		m := map[string]interface{}{}
+		if !iter.MapScan(m) {
+			break
+		}
+		search := SavedSearch{}
+		search.UnmarshalCQLMap(m)
+		searches = append(searches, search)
+	}
+	return searches, iter.Close()
+}
+
+func (cb *CassandraBackend) RetrieveSavedSearch(userId, searchId string) (search *SavedSearch, err error) {
+	m := map[string]interface{}{}
+	err = cb.SessionQuery(`SELECT * FROM saved_search WHERE user_id = ? AND search_id = ?`, userId, searchId).MapScan(m)
+	if err == gocql.ErrNotFound {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	search = new(SavedSearch)
+	search.UnmarshalCQLMap(m)
+	return search, nil
+}
+
+// CreateSavedSearch inserts search, which must have been marshalled as new
+func (cb *CassandraBackend) CreateSavedSearch(search *SavedSearch) error {
+	return cb.saveSavedSearch(search)
+}
+
+// UpdateSavedSearch replaces all properties of search
+func (cb *CassandraBackend) UpdateSavedSearch(search *SavedSearch) error {
+	return cb.saveSavedSearch(search)
+}
+
+func (cb *CassandraBackend) saveSavedSearch(search *SavedSearch) error {
+	filters, err := json.Marshal(search.Filters)
+	if err != nil {
+		return err
+	}
+	return cb.SessionQuery(`INSERT INTO saved_search (user_id, search_id, auto_tag, date_insert, date_update, filters, name, query) VALUES (?,?,?,?,?,?,?,?)`,
+		search.UserId,
+		search.SearchId,
+		search.AutoTag,
+		search.DateInsert,
+		search.DateUpdate,
+		string(filters),
+		search.Name,
+		search.Query).Exec()
+}
+
+func (cb *CassandraBackend) DeleteSavedSearch(userId, searchId string) error {
+	return cb.SessionQuery(`DELETE FROM saved_search WHERE user_id = ? AND search_id = ?`, userId, searchId).Exec()
+}
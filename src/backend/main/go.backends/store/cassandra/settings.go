@@ -6,6 +6,7 @@ package store
 
 import (
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/gocql/gocql"
 )
 
 func (cb *CassandraBackend) GetSettings(user_id string) (settings *Settings, err error) {
@@ -20,3 +21,24 @@ func (cb *CassandraBackend) GetSettings(user_id string) (settings *Settings, err
 	settings.UnmarshalCQLMap(m)
 	return settings, err
 }
+
+// RetrieveSettingsWithDigest returns settings of all users that subscribed to an email digest,
+// as listed by settings_digest_lookup table
+func (cb *CassandraBackend) RetrieveSettingsWithDigest() (settings []Settings, err error) {
+	for _, digest := range []string{DigestDaily, DigestWeekly} {
+		iter := cb.SessionQuery(`SELECT user_id FROM settings_digest_lookup WHERE notification_digest = ?`, digest).Iter()
+		var userId gocql.UUID
+		for iter.Scan(&userId) {
+			s, e := cb.GetSettings(userId.String())
+			if e != nil || s.NotificationDigest != digest {
+				// stale lookup entry
+				continue
+			}
+			settings = append(settings, *s)
+		}
+		if err = iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package store
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/gocql/gocql"
+)
+
+// CreateWKSRequest saves a key submission pending its confirmation,
+// it expires after WKSRequestTTL.
+func (cb *CassandraBackend) CreateWKSRequest(request *WKSRequest) CaliopenError {
+	e := cb.SessionQuery(`INSERT INTO wks_request (nonce, address, date_insert, fingerprint, identity_id, key, user_id) VALUES (?,?,?,?,?,?,?) USING TTL ?`,
+		request.Nonce,
+		request.Address,
+		request.DateInsert,
+		request.Fingerprint,
+		request.IdentityId,
+		request.Key,
+		request.UserId,
+		int(WKSRequestTTL.Seconds())).Exec()
+	if e != nil {
+		return WrapCaliopenErrf(e, DbCaliopenErr, "[CassandraBackend]CreateWKSRequest failed")
+	}
+	return nil
+}
+
+// RetrieveWKSRequest returns the key submission pending for nonce,
+// or a NotFoundCaliopenErr if there is none or if it has expired.
+func (cb *CassandraBackend) RetrieveWKSRequest(nonce string) (*WKSRequest, CaliopenError) {
+	request := &WKSRequest{Nonce: nonce}
+	var userId, identityId gocql.UUID
+	e := cb.SessionQuery(`SELECT address, date_insert, fingerprint, identity_id, key, user_id FROM wks_request WHERE nonce = ?`, nonce).Scan(
+		&request.Address,
+		&request.DateInsert,
+		&request.Fingerprint,
+		&identityId,
+		&request.Key,
+		&userId)
+	if e == gocql.ErrNotFound {
+		return nil, NewCaliopenErr(NotFoundCaliopenErr, "[CassandraBackend]RetrieveWKSRequest not found in db")
+	}
+	if e != nil {
+		return nil, WrapCaliopenErrf(e, DbCaliopenErr, "[CassandraBackend]RetrieveWKSRequest failed")
+	}
+	request.IdentityId = UUID(identityId)
+	request.UserId = UUID(userId)
+	return request, nil
+}
+
+// DeleteWKSRequest removes a key submission once it has been confirmed
+func (cb *CassandraBackend) DeleteWKSRequest(nonce string) CaliopenError {
+	e := cb.SessionQuery(`DELETE FROM wks_request WHERE nonce = ?`, nonce).Exec()
+	if e != nil {
+		return WrapCaliopenErrf(e, DbCaliopenErr, "[CassandraBackend]DeleteWKSRequest failed")
+	}
+	return nil
+}
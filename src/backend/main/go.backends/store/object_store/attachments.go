@@ -5,9 +5,24 @@
 package object_store
 
 import (
+	"errors"
 	"io"
 )
 
 func (mb *MinioBackend) PutAttachment(attchId string, attch io.Reader) (uri string, size int64, err error) {
 	return mb.PutObject(attchId, mb.AttachmentBucket, attch)
 }
+
+func (mb *MinioBackend) PutExport(name string, archive io.Reader) (uri string, size int64, err error) {
+	if mb.ExportBucket == "" {
+		return "", 0, errors.New("[ObjectStore] no bucket configured for exports")
+	}
+	return mb.PutObject(name, mb.ExportBucket, archive)
+}
+
+func (mb *MinioBackend) PutImport(name string, mailbox io.Reader) (uri string, size int64, err error) {
+	if mb.ImportBucket == "" {
+		return "", 0, errors.New("[ObjectStore] no bucket configured for imports")
+	}
+	return mb.PutObject(name, mb.ImportBucket, mailbox)
+}
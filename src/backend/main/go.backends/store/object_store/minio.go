@@ -24,14 +24,19 @@ type (
 		Location         string
 		RawMsgBucket     string
 		AttachmentBucket string
+		ExportBucket     string
+		ImportBucket     string
 	}
 
 	ObjectsStore interface {
 		PutRawMessage(message_uuid obj.UUID, raw_message string) (uri string, err error)
 		PutAttachment(attchId string, attch io.Reader) (uri string, size int64, err error)
+		PutExport(name string, archive io.Reader) (uri string, size int64, err error)
+		PutImport(name string, mailbox io.Reader) (uri string, size int64, err error)
 		RemoveObject(uri string) error
 		GetObject(uri string) (file io.Reader, err error)
 		StatObject(uri string) (info minio.ObjectInfo, err error)
+		ListUserObjects(userId string) (uris []string, err error)
 	}
 )
 
@@ -71,5 +76,29 @@ func InitializeObjectsStore(config OSSConfig) (oss ObjectsStore, err error) {
 		}
 	}
 
+	// exports and imports buckets are optional, to keep configurations of other services unchanged
+	if config.ExportBucket != "" {
+		exists, err = mb.Client.BucketExists(config.ExportBucket)
+		if err != nil || !exists {
+			err = mb.Client.MakeBucket(config.ExportBucket, config.Location)
+			if err != nil {
+				logrus.WithError(err).Warnf("[ObjectStore] failed to create new bucket for users' exports")
+				mb.Client = nil
+				return
+			}
+		}
+	}
+	if config.ImportBucket != "" {
+		exists, err = mb.Client.BucketExists(config.ImportBucket)
+		if err != nil || !exists {
+			err = mb.Client.MakeBucket(config.ImportBucket, config.Location)
+			if err != nil {
+				logrus.WithError(err).Warnf("[ObjectStore] failed to create new bucket for uploaded mailboxes")
+				mb.Client = nil
+				return
+			}
+		}
+	}
+
 	return mb, err
 }
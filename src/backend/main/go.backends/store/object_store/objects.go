@@ -45,3 +45,21 @@ func (mb *MinioBackend) StatObject(objURI string) (info minio.ObjectInfo, err er
 	}
 	return mb.Client.StatObject(uri.Host, uri.Path[1:], minio.StatObjectOptions{})
 }
+
+// ListUserObjects returns uris of user's exports and imports, which are stored under a user_id/ prefix
+func (mb *MinioBackend) ListUserObjects(userId string) (uris []string, err error) {
+	const uriTemplate = "s3://%s/%s"
+
+	for _, bucket := range []string{mb.ExportBucket, mb.ImportBucket} {
+		done := make(chan struct{})
+		for object := range mb.Client.ListObjectsV2(bucket, userId+"/", true, done) {
+			if object.Err != nil {
+				close(done)
+				return nil, object.Err
+			}
+			uris = append(uris, fmt.Sprintf(uriTemplate, bucket, object.Key))
+		}
+		close(done)
+	}
+	return
+}
@@ -17,6 +17,7 @@ type VaultCredentials interface {
 	RetrieveCredentials(userId, remoteId string) (Credentials, error)
 	UpdateCredentials(userId, remoteId string, cred Credentials, upsertMode bool) error
 	DeleteCredentials(userId, remoteId string) error
+	ListCredentials(userId string) (remoteIds []string, err error)
 }
 
 func (vault *HVaultClient) CreateCredentials(userIdentity *UserIdentity, cred Credentials) error {
@@ -71,8 +72,24 @@ func (vault *HVaultClient) UpdateCredentials(userId, remoteId string, cred Crede
 	return err
 }
 
+// DeleteCredentials permanently deletes credentials with all their versions
 func (vault *HVaultClient) DeleteCredentials(userId, remoteId string) error {
-	path := fmt.Sprintf(credentialsPath, userId, remoteId)
+	path := fmt.Sprintf(metadataPath, userId+"/"+remoteId)
 	_, err := vault.hclient.Logical().Delete(path)
 	return err
 }
+
+// ListCredentials returns ids of remote identities that user has credentials for
+func (vault *HVaultClient) ListCredentials(userId string) (remoteIds []string, err error) {
+	secret, err := vault.hclient.Logical().List(fmt.Sprintf(metadataPath, userId))
+	if err != nil || secret == nil || secret.Data == nil {
+		return
+	}
+	keys, _ := secret.Data["keys"].([]interface{})
+	for _, key := range keys {
+		if remoteId, ok := key.(string); ok {
+			remoteIds = append(remoteIds, remoteId)
+		}
+	}
+	return
+}
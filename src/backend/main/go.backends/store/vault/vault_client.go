@@ -25,6 +25,7 @@ type HVaultConfig struct {
 }
 
 const credentialsPath = "secret/data/remoteid/credentials/%s/%s" // path to store credentials => secret/data/remoteid/credentials/user_id/remote_id
+const metadataPath = "secret/metadata/remoteid/credentials/%s"   // path to credentials' versions => secret/metadata/remoteid/credentials/user_id[/remote_id]
 const loginPath = "auth/userpass/login/%s"
 
 // InitializeVaultBackend checks if a Vault server is available and returns an authenticated VaultClient
@@ -35,6 +35,8 @@ type (
 		Notifiers Notifications.Notifiers
 		// Admin user on whose behalf actions could be done
 		Admin *User
+
+		stopSendScheduler func()
 	}
 )
 
@@ -61,10 +63,25 @@ func (facilities *CaliopenFacilities) initialize(config CaliopenConfig) (err err
 	// copy cache facility from REST facility
 	facilities.Cache = rest.Cache
 
+	// purge deleted users' data
+	rest.StartPurgeWorker()
+
+	// remove expired users' exports
+	rest.StartExportsCleaner()
+
 	// Notifications facility initialization
 	notifier := Notifications.NewNotificationsFacility(config, facilities.nats)
 	facilities.Notifiers = notifier
 
+	// send email digests when they are due
+	notifier.StartDigestScheduler()
+
+	// send drafts when they are due
+	facilities.stopSendScheduler = rest.StartSendScheduler(notifier)
+
+	// keep track of mailboxes' imports reported by IMAP workers
+	rest.StartImportsListener(notifier)
+
 	// Messaging facility initialization
 	facilities.MessagingFacility, err = Messaging.NewCaliopenMessaging(config, notifier)
 	if err != nil {
@@ -74,3 +91,10 @@ func (facilities *CaliopenFacilities) initialize(config CaliopenConfig) (err err
 
 	return
 }
+
+// Shutdown stops facilities' background jobs, waiting for the ones in progress to complete
+func (facilities *CaliopenFacilities) Shutdown() {
+	if facilities.stopSendScheduler != nil {
+		facilities.stopSendScheduler()
+	}
+}
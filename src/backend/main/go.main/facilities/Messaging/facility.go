@@ -81,6 +81,8 @@ func (cm *CaliopenMessaging) HandleUserAction(msg *nats.Msg) {
 		if cErr != nil {
 			log.WithError(cErr).Warnf("[HandleUserAction] ByEmail notification failed (code : %d, cause : %s)", cErr.Code(), cErr.Cause())
 		}
+	case "deleted":
+		// user's data are purged by REST facility's purge workers
 	default:
 		log.Errorf("[HandleUserAction] unhandled message : %s", payload.Message)
 	}
@@ -0,0 +1,210 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	digestTemplate            = "email-digest.yaml"
+	defaultDigestHour         = 8
+	defaultDigestMaxMessages  = 200
+	defaultDigestScanInterval = 15 // minutes
+	digestMaxSenders          = 3  // senders' labels listed for each discussion
+	digestExcerptLength       = 80
+	digestLease               = 30 * time.Minute // time given to a scheduler to send a digest before another one could take it over
+)
+
+var errNoDigestRecipient = errors.New("[Notifier] user has no recovery email to send digest to")
+
+// DigestDiscussion summarises unread messages of a discussion within a digest
+type DigestDiscussion struct {
+	Count   int
+	Date    time.Time
+	From    []string
+	Subject string
+}
+
+// StartDigestScheduler periodically sends email digests of unread messages
+// to users who chose to receive them daily or weekly.
+// Several instances may run concurrently : each digest is leased in store while it is being sent,
+// and is recorded as sent only once it has been sent, or released to be sent again at next scan if sending failed.
+func (N *Notifier) StartDigestScheduler() {
+	interval := defaultDigestScanInterval
+	if N.config != nil && N.config.Digest.ScanInterval > 0 {
+		interval = N.config.Digest.ScanInterval
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			N.sendDueDigests(now)
+		}
+	}()
+}
+
+// sendDueDigests sends digests that are due at date now
+func (N *Notifier) sendDueDigests(now time.Time) {
+	if N.admin == nil || N.adminLocalID == nil {
+		return
+	}
+	settings, err := N.Store.RetrieveSettingsWithDigest()
+	if err != nil {
+		log.WithError(err).Warn("[Notifier] digests scheduler failed to retrieve users' settings")
+		return
+	}
+	hour := defaultDigestHour
+	if N.config.Digest.Hour > 0 {
+		hour = N.config.Digest.Hour
+	}
+	for i := range settings {
+		userId := settings[i].UserId.String()
+		last, lease, err := N.Store.RetrieveDigestState(userId)
+		if err != nil {
+			log.WithError(err).Warnf("[Notifier] failed to retrieve last digest date for user %s", userId)
+			continue
+		}
+		if !digestDue(&settings[i], last, now, hour) || lease.After(now) {
+			continue
+		}
+		until := now.Add(digestLease)
+		claimed, err := N.Store.ClaimDigest(userId, lease, until)
+		if err != nil || !claimed {
+			// another instance is sending this digest
+			continue
+		}
+		err = N.sendDigest(userId, settings[i].NotificationDigest)
+		if err != nil && err != errNoDigestRecipient {
+			log.WithError(err).Warnf("[Notifier] failed to send digest to user %s", userId)
+			if e := N.Store.ReleaseDigest(userId, until); e != nil {
+				// digest will be sent again once lease expires
+				log.WithError(e).Warnf("[Notifier] failed to release digest of user %s", userId)
+			}
+			continue
+		}
+		if err = N.Store.SetDigestDate(userId, now); err != nil {
+			log.WithError(err).Warnf("[Notifier] failed to record digest sent to user %s", userId)
+		}
+	}
+}
+
+// digestDue returns true if user's digest has not been sent since the last slot before now.
+// Slots are at the given hour in user's timezone, every day or every monday depending on user's choice.
+// Digests are held back during user's quiet hours.
+func digestDue(settings *Settings, last, now time.Time, hour int) bool {
+	local := now.In(settings.Location())
+	slot := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, local.Location())
+	switch settings.NotificationDigest {
+	case DigestDaily:
+		if slot.After(local) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+	case DigestWeekly:
+		slot = slot.AddDate(0, 0, -((int(slot.Weekday()) + 6) % 7)) // back to monday
+		if slot.After(local) {
+			slot = slot.AddDate(0, 0, -7)
+		}
+	default:
+		return false
+	}
+	if settings.InQuietHours(now) {
+		return false
+	}
+	return last.Before(slot)
+}
+
+// sendDigest emails user a summary of its unread messages, grouped by discussion
+func (N *Notifier) sendDigest(userId, period string) error {
+	user, err := N.Store.RetrieveUser(userId)
+	if err != nil {
+		return err
+	}
+	if user.RecoveryEmail == "" {
+		return errNoDigestRecipient
+	}
+	limit := defaultDigestMaxMessages
+	if N.config.Digest.MaxMessages > 0 {
+		limit = N.config.Digest.MaxMessages
+	}
+	messages, total, err := N.index.FilterMessages(IndexSearch{
+		Limit:    limit,
+		Shard_id: user.ShardId,
+		Terms: map[string][]string{
+			"is_draft":  {"false"},
+			"is_unread": {"true"},
+		},
+		User_id: user.UserId,
+		ILrange: [2]int8{-10, 10},
+	})
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	context := map[string]interface{}{
+		"given_name":  user.GivenName,
+		"family_name": user.FamilyName,
+		"period":      period,
+		"count":       total,
+		"discussions": digestDiscussions(messages),
+		"url":         N.config.BaseUrl,
+	}
+	email, err := RenderEmail(N.config.TemplatesPath+digestTemplate, context)
+	if err != nil {
+		return err
+	}
+	return N.SendEmailAdminToUser(user, N.adminToUserParticipants(user), email)
+}
+
+// digestDiscussions groups messages by discussion, keeping messages' order (most recent first)
+func digestDiscussions(messages []*Message) []DigestDiscussion {
+	discussions := []DigestDiscussion{}
+	positions := map[string]int{}
+	for _, msg := range messages {
+		id := msg.Discussion_id.String()
+		i, ok := positions[id]
+		if !ok {
+			subject := msg.Subject
+			if subject == "" {
+				subject = excerpt(msg.Body_plain, digestExcerptLength)
+			}
+			discussions = append(discussions, DigestDiscussion{Date: msg.Date_sort, Subject: subject})
+			i = len(discussions) - 1
+			positions[id] = i
+		}
+		discussions[i].Count++
+		for _, participant := range msg.Participants {
+			if participant.Type != ParticipantFrom || len(discussions[i].From) >= digestMaxSenders {
+				continue
+			}
+			label := participant.Label
+			if label == "" {
+				label = participant.Address
+			}
+			known := false
+			for _, from := range discussions[i].From {
+				known = known || from == label
+			}
+			if !known {
+				discussions[i].From = append(discussions[i].From, label)
+			}
+		}
+	}
+	return discussions
+}
+
+// excerpt returns the first length runes of text
+func excerpt(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length]) + "…"
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/gocql/gocql"
 	"github.com/nats-io/go-nats"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -20,8 +21,12 @@ type (
 	Notifiers interface {
 		ByEmail(*Notification) CaliopenError
 		ByNotifQueue(*Notification) CaliopenError
+		ByPush(*Notification) CaliopenError
 		RetrieveNotifications(userId string, from, to time.Time) ([]Notification, CaliopenError)
 		DeleteNotifications(userId string, until time.Time) CaliopenError
+		RetrieveNotificationsSince(userId, notifId string) ([]Notification, CaliopenError)
+		SubscribeNotifications(userId string) (*NotificationsStream, CaliopenError)
+		PushPublicKey() (string, CaliopenError)
 	}
 
 	Notifier struct {
@@ -33,6 +38,9 @@ type (
 		natsTopics   map[string]string
 		Store        backends.NotificationsStore
 		log          *log.Logger
+		// users' settings read by notifiers, see userSettings
+		settingsCache map[string]cachedSettings
+		settingsMux   sync.Mutex
 	}
 )
 
@@ -54,6 +62,7 @@ func NewNotificationsFacility(config CaliopenConfig, queue *nats.Conn) (notifier
 	notifier.natsTopics = make(map[string]string)
 	notifier.natsTopics[Nats_outSMTP_topicKey] = config.NatsConfig.OutSMTP_topic
 	notifier.natsTopics[Nats_Contacts_topicKey] = config.NatsConfig.Contacts_topic
+	notifier.natsTopics[Nats_Notifs_topicKey] = config.NatsConfig.Notifs_topic
 	notifier.NatsQueue = queue
 	switch config.RESTstoreConfig.BackendName {
 	case "cassandra":
@@ -111,6 +120,21 @@ func NewNotificationsFacility(config CaliopenConfig, queue *nats.Conn) (notifier
 	return notifier
 }
 
+// NewQueueNotifier returns a notifier limited to the notifications queue and streams,
+// for components that don't need to send emails to users
+func NewQueueNotifier(store backends.NotificationsStore, queue *nats.Conn, notifsTopic string) (notifier *Notifier) {
+	notifier = new(Notifier)
+	notifier.log = log.New()
+	notifier.log.Out = os.Stdout
+	notifier.config = &NotifierConfig{}
+	notifier.natsTopics = map[string]string{
+		Nats_Notifs_topicKey: notifsTopic,
+	}
+	notifier.NatsQueue = queue
+	notifier.Store = store
+	return notifier
+}
+
 func (N *Notifier) LogNotification(method string, notif *Notification) {
 	if notif != nil {
 		var userId string
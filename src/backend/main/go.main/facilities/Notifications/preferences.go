@@ -0,0 +1,127 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	notificationEmailTemplate = "email-notification.yaml"
+	settingsCacheTTL          = time.Minute // delay for changes of user's settings to be taken into account by notifiers
+	settingsCacheSize         = 10000       // users' settings kept in memory, cache is emptied when it is full
+)
+
+type cachedSettings struct {
+	settings *Settings
+	until    time.Time
+}
+
+// userChannels returns the channels through which notification should be issued at date,
+// according to user's preferences for this kind of notification.
+// Notifications are always queued. Without preferences, they are also pushed for kinds listed in push configuration.
+func (N *Notifier) userChannels(notif *Notification, at time.Time) map[string]bool {
+	defaults := []string{NotifChannelQueue}
+	if N.pushable(notif) {
+		defaults = append(defaults, NotifChannelPush)
+	}
+	if notif.User == nil {
+		return notificationChannels(nil, "", defaults, at)
+	}
+	settings, err := N.userSettings(notif.User.UserId.String(), at)
+	if err != nil {
+		log.WithError(err).Warnf("[Notifier] failed to retrieve settings of user %s, using default channels", notif.User.UserId.String())
+		settings = nil
+	}
+	channels := notificationChannels(settings, notificationKind(notif), defaults, at)
+	if N.config == nil || N.config.Push.VapidPrivateKey == "" {
+		delete(channels, NotifChannelPush)
+	}
+	return channels
+}
+
+// userSettings returns user's settings, kept in memory for settingsCacheTTL to spare a store read per notification
+func (N *Notifier) userSettings(userId string, at time.Time) (*Settings, error) {
+	N.settingsMux.Lock()
+	cached, ok := N.settingsCache[userId]
+	N.settingsMux.Unlock()
+	if ok && cached.until.After(at) {
+		return cached.settings, nil
+	}
+	settings, err := N.Store.GetSettings(userId)
+	if err != nil {
+		return nil, err
+	}
+	N.settingsMux.Lock()
+	if N.settingsCache == nil || len(N.settingsCache) >= settingsCacheSize {
+		N.settingsCache = make(map[string]cachedSettings)
+	}
+	N.settingsCache[userId] = cachedSettings{settings: settings, until: at.Add(settingsCacheTTL)}
+	N.settingsMux.Unlock()
+	return settings, nil
+}
+
+// notificationChannels applies user's settings to select channels for a kind of notification.
+// Queue, which feeds user's notifications list and streams, can't be opted out.
+// Push and email are never used when user disabled notifications, nor during its quiet hours.
+func notificationChannels(settings *Settings, kind string, defaults []string, at time.Time) map[string]bool {
+	chosen := defaults
+	if settings != nil {
+		chosen = settings.ChannelsFor(kind, defaults)
+	}
+	channels := map[string]bool{NotifChannelQueue: true}
+	for _, channel := range chosen {
+		channels[channel] = true
+	}
+	if settings != nil && (!settings.NotificationEnabled || settings.InQuietHours(at)) {
+		delete(channels, NotifChannelPush)
+		delete(channels, NotifChannelEmail)
+	}
+	return channels
+}
+
+// sendNotificationEmail emails user about a notification it chose to receive by email
+func (N *Notifier) sendNotificationEmail(notif *Notification) error {
+	if N.admin == nil || N.adminLocalID == nil {
+		return errors.New("[Notifier] can't send notification email, no admin user has been set")
+	}
+	user, err := N.Store.RetrieveUser(notif.User.UserId.String())
+	if err != nil {
+		return err
+	}
+	context := map[string]interface{}{
+		"given_name":  user.GivenName,
+		"family_name": user.FamilyName,
+		"kind":        notificationKind(notif),
+		"url":         N.config.BaseUrl,
+	}
+	email, err := RenderEmail(N.config.TemplatesPath+notificationEmailTemplate, context)
+	if err != nil {
+		return err
+	}
+	return N.SendEmailAdminToUser(user, N.adminToUserParticipants(user), email)
+}
+
+// adminToUserParticipants returns participants of an email sent by admin to user's recovery email
+func (N *Notifier) adminToUserParticipants(user *User) []Participant {
+	return []Participant{
+		{ // sender
+			Address:  N.adminLocalID.Identifier,
+			Label:    N.adminLocalID.DisplayName,
+			Protocol: EmailProtocol,
+			Type:     ParticipantFrom,
+		},
+		{ // recipient
+			Address:     user.RecoveryEmail,
+			Contact_ids: []UUID{user.ContactId},
+			Label:       user.Name,
+			Protocol:    EmailProtocol,
+			Type:        ParticipantTo,
+		},
+	}
+}
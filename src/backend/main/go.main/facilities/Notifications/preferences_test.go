@@ -0,0 +1,235 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationChannels(t *testing.T) {
+	defaults := []string{NotifChannelQueue, NotifChannelPush}
+	noon := time.Date(2019, 3, 4, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2019, 3, 4, 23, 30, 0, 0, time.UTC)
+	settings := &Settings{
+		NotificationChannels: map[string][]string{
+			"emailReceived": {NotifChannelQueue, NotifChannelEmail},
+			"syncError":     {},
+		},
+		NotificationEnabled:    true,
+		NotificationQuietStart: "22:00",
+		NotificationQuietEnd:   "07:00",
+	}
+	for _, test := range []struct {
+		settings *Settings
+		kind     string
+		at       time.Time
+		expected map[string]bool
+	}{
+		{nil, "emailReceived", noon, map[string]bool{NotifChannelQueue: true, NotifChannelPush: true}},
+		{settings, "emailReceived", noon, map[string]bool{NotifChannelQueue: true, NotifChannelEmail: true}},
+		{settings, "dmReceived", noon, map[string]bool{NotifChannelQueue: true, NotifChannelPush: true}},
+		{settings, "syncError", noon, map[string]bool{NotifChannelQueue: true}},
+		{settings, "emailReceived", night, map[string]bool{NotifChannelQueue: true}},
+		{&Settings{NotificationEnabled: false}, "dmReceived", noon, map[string]bool{NotifChannelQueue: true}},
+	} {
+		got := notificationChannels(test.settings, test.kind, defaults, test.at)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("expected channels %v for %s at %s, got %v", test.expected, test.kind, test.at.Format("15:04"), got)
+		}
+	}
+}
+
+func TestSettings_InQuietHours(t *testing.T) {
+	settings := &Settings{
+		NotificationQuietStart: "22:00",
+		NotificationQuietEnd:   "07:00",
+		NotificationTimezone:   "Europe/Paris",
+	}
+	for hour, expected := range map[int]bool{ // UTC hours, Paris is UTC+1 in winter
+		20: false,
+		21: true,
+		3:  true,
+		5:  true,
+		6:  false,
+	} {
+		at := time.Date(2019, 1, 15, hour, 0, 0, 0, time.UTC)
+		if got := settings.InQuietHours(at); got != expected {
+			t.Errorf("expected InQuietHours to be %v at %02d:00 UTC, got %v", expected, hour, got)
+		}
+	}
+	if (&Settings{NotificationQuietStart: "22:00"}).InQuietHours(time.Date(2019, 1, 15, 23, 0, 0, 0, time.UTC)) {
+		t.Error("expected no quiet hours when end is not set")
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	daily := &Settings{NotificationDigest: DigestDaily}
+	weekly := &Settings{NotificationDigest: DigestWeekly}
+	tuesday9 := time.Date(2019, 3, 5, 9, 0, 0, 0, time.UTC)
+	tuesday7 := time.Date(2019, 3, 5, 7, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		settings *Settings
+		last     time.Time
+		now      time.Time
+		expected bool
+	}{
+		{daily, time.Time{}, tuesday9, true},
+		{daily, time.Date(2019, 3, 5, 8, 5, 0, 0, time.UTC), tuesday9, false},
+		{daily, time.Date(2019, 3, 4, 8, 5, 0, 0, time.UTC), tuesday9, true},
+		{daily, time.Date(2019, 3, 4, 8, 5, 0, 0, time.UTC), tuesday7, false},
+		{daily, time.Date(2019, 3, 3, 8, 5, 0, 0, time.UTC), tuesday7, true},
+		{weekly, time.Date(2019, 3, 4, 8, 5, 0, 0, time.UTC), tuesday9, false},
+		{weekly, time.Date(2019, 3, 3, 8, 5, 0, 0, time.UTC), tuesday9, true},
+		{weekly, time.Date(2019, 3, 3, 8, 5, 0, 0, time.UTC), time.Date(2019, 3, 4, 7, 0, 0, 0, time.UTC), false},
+		{&Settings{NotificationDigest: DigestOff}, time.Time{}, tuesday9, false},
+		{&Settings{NotificationDigest: DigestDaily, NotificationQuietStart: "08:30", NotificationQuietEnd: "10:00"}, time.Time{}, tuesday9, false},
+	} {
+		if got := digestDue(test.settings, test.last, test.now, 8); got != test.expected {
+			t.Errorf("expected %s digest last sent %s to be due=%v at %s, got %v",
+				test.settings.NotificationDigest, test.last, test.expected, test.now, got)
+		}
+	}
+}
+
+func TestDigestDiscussions(t *testing.T) {
+	var discussion1, discussion2 UUID
+	discussion1.UnmarshalBinary(uuid.NewV4().Bytes())
+	discussion2.UnmarshalBinary(uuid.NewV4().Bytes())
+	from := func(labels ...string) []Participant {
+		participants := []Participant{{Address: "me@caliopen.local", Type: ParticipantTo}}
+		for _, label := range labels {
+			participants = append(participants, Participant{Address: label + "@example.com", Label: label, Type: ParticipantFrom})
+		}
+		return participants
+	}
+	now := time.Now()
+	messages := []*Message{
+		{Discussion_id: discussion1, Subject: "Lunch", Date_sort: now, Participants: from("alice")},
+		{Discussion_id: discussion2, Body_plain: "no subject here", Date_sort: now.Add(-time.Hour), Participants: from("bob")},
+		{Discussion_id: discussion1, Subject: "Re: Lunch", Date_sort: now.Add(-2 * time.Hour), Participants: from("carol", "alice")},
+		{Discussion_id: discussion1, Date_sort: now.Add(-3 * time.Hour), Participants: from("dave", "eve")},
+	}
+	discussions := digestDiscussions(messages)
+	if len(discussions) != 2 {
+		t.Fatalf("expected 2 discussions, got %d", len(discussions))
+	}
+	if d := discussions[0]; d.Subject != "Lunch" || d.Count != 3 || !d.Date.Equal(now) ||
+		!reflect.DeepEqual(d.From, []string{"alice", "carol", "dave"}) {
+		t.Errorf("unexpected first discussion %+v", d)
+	}
+	if d := discussions[1]; d.Subject != "no subject here" || d.Count != 1 || !reflect.DeepEqual(d.From, []string{"bob"}) {
+		t.Errorf("unexpected second discussion %+v", d)
+	}
+}
+
+// digestTestStore serves users subscribed to a daily digest and records digests' states
+type digestTestStore struct {
+	backendstest.NotificationsStore
+	users    map[string]*User
+	leases   map[string]time.Time
+	claimed  *[]string
+	released *[]string
+	sent     *[]string
+}
+
+func (ds digestTestStore) RetrieveSettingsWithDigest() (settings []Settings, err error) {
+	for _, user := range ds.users {
+		settings = append(settings, Settings{UserId: user.UserId, NotificationDigest: DigestDaily})
+	}
+	return
+}
+func (ds digestTestStore) RetrieveDigestState(userId string) (sent, leaseUntil time.Time, err error) {
+	return time.Time{}, ds.leases[userId], nil
+}
+func (ds digestTestStore) ClaimDigest(userId string, previousLease, until time.Time) (bool, error) {
+	*ds.claimed = append(*ds.claimed, userId)
+	return true, nil
+}
+func (ds digestTestStore) SetDigestDate(userId string, date time.Time) error {
+	*ds.sent = append(*ds.sent, userId)
+	return nil
+}
+func (ds digestTestStore) ReleaseDigest(userId string, lease time.Time) error {
+	*ds.released = append(*ds.released, userId)
+	return nil
+}
+func (ds digestTestStore) RetrieveUser(userId string) (*User, error) {
+	if user, ok := ds.users[userId]; ok && user.Name != "unavailable" {
+		return user, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestNotifier_sendDueDigests(t *testing.T) {
+	now := time.Date(2019, 3, 5, 9, 0, 0, 0, time.UTC)
+	unavailable := &User{UserId: UUID(uuid.NewV4()), Name: "unavailable"}
+	noRecovery := &User{UserId: UUID(uuid.NewV4()), Name: "no_recovery"}
+	leased := &User{UserId: UUID(uuid.NewV4()), Name: "leased"}
+	store := digestTestStore{
+		users: map[string]*User{
+			unavailable.UserId.String(): unavailable,
+			noRecovery.UserId.String():  noRecovery,
+			leased.UserId.String():      leased,
+		},
+		leases:   map[string]time.Time{leased.UserId.String(): now.Add(time.Minute)},
+		claimed:  &[]string{},
+		released: &[]string{},
+		sent:     &[]string{},
+	}
+	N := &Notifier{admin: &User{}, adminLocalID: &UserIdentity{}, config: &NotifierConfig{}, Store: store}
+	N.sendDueDigests(now)
+
+	if len(*store.claimed) != 2 {
+		t.Errorf("expected digests that are not leased to be claimed, got %v", *store.claimed)
+	}
+	for _, userId := range *store.claimed {
+		if userId == leased.UserId.String() {
+			t.Error("expected digest leased by another scheduler not to be claimed")
+		}
+	}
+	// digest that failed to be sent is not recorded as sent, its lease is released to send it again at next scan
+	if len(*store.sent) != 1 || (*store.sent)[0] != noRecovery.UserId.String() {
+		t.Errorf("expected only digest without recipient to be recorded as done, got %v", *store.sent)
+	}
+	if len(*store.released) != 1 || (*store.released)[0] != unavailable.UserId.String() {
+		t.Errorf("expected digest that failed to be sent to be released, got %v", *store.released)
+	}
+}
+
+// settingsTestStore counts reads of users' settings
+type settingsTestStore struct {
+	backendstest.NotificationsStore
+	reads *int
+}
+
+func (ss settingsTestStore) GetSettings(userId string) (*Settings, error) {
+	*ss.reads++
+	return &Settings{UserId: UUID(uuid.FromStringOrNil(userId)), NotificationEnabled: true}, nil
+}
+
+func TestNotifier_userSettings(t *testing.T) {
+	reads := 0
+	N := &Notifier{Store: settingsTestStore{reads: &reads}}
+	userId := uuid.NewV4().String()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if settings, err := N.userSettings(userId, now); err != nil || settings.UserId.String() != userId {
+			t.Fatalf("unexpected settings %+v, error %v", settings, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("expected settings to be read once from store, got %d reads", reads)
+	}
+	N.userSettings(userId, now.Add(settingsCacheTTL))
+	if reads != 2 {
+		t.Errorf("expected expired settings to be read again from store, got %d reads", reads)
+	}
+}
@@ -0,0 +1,377 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
+	log "github.com/Sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPushTTL = 86400          // seconds
+	pushRecordSize = 4096           // size of the single aes128gcm record sent to push services
+	vapidTokenTTL  = 12 * time.Hour // RFC 8292 forbids tokens valid for more than 24 hours
+	previewAlways  = "always"       // Settings.NotificationMessagePreview value to include messages' excerpts
+)
+
+// pushClient only reaches public addresses : push endpoints are given by users' devices
+var pushClient = helpers.PublicHTTPClient(10 * time.Second)
+
+// pushPayload is the content of a pushed notification, once decrypted by device's service worker
+type pushPayload struct {
+	Body    string `json:"body"`
+	Emitter string `json:"emitter"`
+	Excerpt string `json:"excerpt,omitempty"`
+	From    string `json:"from,omitempty"`
+	Kind    string `json:"kind"`
+	NotifId string `json:"notif_id"`
+	Subject string `json:"subject,omitempty"`
+	Type    string `json:"type"`
+}
+
+// ByPush notifies an user by pushing notification to all its verified devices that have a push subscription,
+// as long as user has enabled notifications in its settings and is not within its quiet hours.
+// Messages' excerpts are embedded only if user chose to always preview messages within notifications.
+func (N *Notifier) ByPush(notif *Notification) CaliopenError {
+	if notif == nil || notif.User == nil {
+		return NewCaliopenErr(UnprocessableCaliopenErr, "[Notifier]ByPush notification has no user")
+	}
+	key, err := N.vapidKey()
+	if err != nil {
+		return WrapCaliopenErr(err, FailDependencyCaliopenErr, "[Notifier]ByPush web push is not configured")
+	}
+	N.LogNotification("ByPush", notif)
+	userId := notif.User.UserId.String()
+
+	settings, err := N.Store.GetSettings(userId)
+	if err != nil {
+		return WrapCaliopenErr(err, DbCaliopenErr, "[Notifier]ByPush failed to retrieve user's settings")
+	}
+	if !settings.NotificationEnabled || settings.InQuietHours(time.Now()) {
+		return nil
+	}
+	devices, err := N.Store.RetrieveDevices(userId)
+	if err != nil {
+		if err.Error() == "devices not found" {
+			return nil
+		}
+		return WrapCaliopenErr(err, DbCaliopenErr, "[Notifier]ByPush failed to retrieve user's devices")
+	}
+
+	payload, err := json.Marshal(N.pushPayload(notif, settings.NotificationMessagePreview == previewAlways))
+	if err != nil {
+		return WrapCaliopenErr(err, UnknownCaliopenErr, "[Notifier]ByPush failed to marshal payload")
+	}
+	ttl := N.config.Push.TTL
+	if ttl <= 0 {
+		ttl = defaultPushTTL
+	}
+	failures := []string{}
+	for i := range devices {
+		device := &devices[i]
+		if device.Status != DeviceVerifiedStatus || device.Push == nil {
+			continue
+		}
+		gone, err := sendPush(device.Push, payload, key, N.config.Push.VapidSubject, ttl)
+		if gone {
+			// push service will never deliver to this subscription again
+			log.Infof("[Notifier]ByPush push subscription of device %s has expired, removing it", device.DeviceId.String())
+			device.Push = nil
+			err = N.Store.UpdateDevice(device, device, map[string]interface{}{"Push": nil})
+		}
+		if err != nil {
+			log.WithError(err).Warnf("[Notifier]ByPush failed to push notification %s to device %s", notif.NotifId.String(), device.DeviceId.String())
+			failures = append(failures, device.DeviceId.String())
+		}
+	}
+	if len(failures) > 0 {
+		return NewCaliopenErrf(FailDependencyCaliopenErr, "[Notifier]ByPush failed to push notification to devices %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// PushPublicKey returns the base64url encoded VAPID public key
+// that devices' user agents need to subscribe to push services.
+func (N *Notifier) PushPublicKey() (string, CaliopenError) {
+	key, err := N.vapidKey()
+	if err != nil {
+		return "", WrapCaliopenErr(err, NotFoundCaliopenErr, "[Notifier] web push is not configured")
+	}
+	return base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)), nil
+}
+
+// pushable returns true if notification's kind is one of the kinds to push to devices
+func (N *Notifier) pushable(notif *Notification) bool {
+	if N.config == nil || N.config.Push.VapidPrivateKey == "" || notif.User == nil {
+		return false
+	}
+	kind := notificationKind(notif)
+	for _, k := range N.config.Push.Notifications {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (N *Notifier) pushPayload(notif *Notification, withPreview bool) pushPayload {
+	payload := pushPayload{
+		Body:    notif.Body,
+		Emitter: notif.Emitter,
+		Kind:    notificationKind(notif),
+		NotifId: notif.NotifId.String(),
+		Type:    notif.Type,
+	}
+	if !withPreview {
+		return payload
+	}
+	// notifications about a received message only have message's id as body's value
+	var body map[string]interface{}
+	if json.Unmarshal([]byte(notif.Body), &body) != nil {
+		return payload
+	}
+	msgId, ok := body[payload.Kind].(string)
+	if !ok {
+		return payload
+	}
+	msg, err := N.Store.RetrieveMessage(notif.User.UserId.String(), msgId)
+	if err != nil || msg == nil {
+		return payload
+	}
+	payload.Subject = msg.Subject
+	payload.Excerpt = messages.ExcerptMessage(*msg, 200, true, true)
+	for _, participant := range msg.Participants {
+		if participant.Type == ParticipantFrom {
+			payload.From = participant.Label
+			if payload.From == "" {
+				payload.From = participant.Address
+			}
+			break
+		}
+	}
+	return payload
+}
+
+func (N *Notifier) vapidKey() (*ecdsa.PrivateKey, error) {
+	if N.config == nil || N.config.Push.VapidPrivateKey == "" {
+		return nil, errors.New("no VAPID private key")
+	}
+	d, err := decodeBase64URL(N.config.Push.VapidPrivateKey)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("invalid VAPID private key")
+	}
+	key := new(ecdsa.PrivateKey)
+	key.Curve = elliptic.P256()
+	key.D = new(big.Int).SetBytes(d)
+	key.X, key.Y = key.Curve.ScalarBaseMult(d)
+	return key, nil
+}
+
+// notificationKind returns the key of notification's JSON body, like emailReceived, if any
+func notificationKind(notif *Notification) string {
+	var body map[string]json.RawMessage
+	if json.Unmarshal([]byte(notif.Body), &body) != nil || len(body) != 1 {
+		return ""
+	}
+	for kind := range body {
+		return kind
+	}
+	return ""
+}
+
+// ValidatePushSubscription checks that subscription's endpoint is a public https url
+// and that subscription's keys are usable to encrypt pushed notifications
+func ValidatePushSubscription(sub *PushSubscription) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("push endpoint must be an https url")
+	}
+	if err = helpers.CheckPublicHost(endpoint.Hostname()); err != nil {
+		return errors.New("push endpoint must be a public url")
+	}
+	_, _, err = subscriptionKeys(sub)
+	return err
+}
+
+// subscriptionKeys decodes user agent's public key and authentication secret
+func subscriptionKeys(sub *PushSubscription) (uaPublic, authSecret []byte, err error) {
+	uaPublic, err = decodeBase64URL(sub.P256dh)
+	if err != nil {
+		return nil, nil, errors.New("p256dh is not base64url encoded")
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), uaPublic); x == nil {
+		return nil, nil, errors.New("p256dh is not a P-256 public key")
+	}
+	authSecret, err = decodeBase64URL(sub.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, nil, errors.New("auth must be a base64url encoded 16 bytes secret")
+	}
+	return
+}
+
+// sendPush posts encrypted payload to subscription's push service (RFC 8030).
+// gone is true if push service reports that subscription has expired.
+func sendPush(sub *PushSubscription, payload []byte, key *ecdsa.PrivateKey, subject string, ttl int) (gone bool, err error) {
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return false, err
+	}
+	authorization, err := vapidAuthorization(sub.Endpoint, subject, key, time.Now())
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(ttl))
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode >= 300:
+		reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("push service responded %s : %s", resp.Status, reason)
+	}
+	return false, nil
+}
+
+// encryptPushPayload encrypts payload for subscription's user agent
+// with the aes128gcm content coding, as specified by RFC 8291
+func encryptPushPayload(sub *PushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, authSecret, err := subscriptionKeys(sub)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	uaX, uaY := elliptic.Unmarshal(curve, uaPublic)
+
+	// ephemeral application server's key pair
+	asPrivate, asX, asY, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := elliptic.Marshal(curve, asX, asY)
+	sharedX, _ := curve.ScalarMult(uaX, uaY, asPrivate)
+	ecdhSecret := leftPad(sharedX.Bytes(), 32)
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(payload), len(payload)+1)
+	copy(plaintext, payload)
+	plaintext = append(plaintext, 0x02) // padding delimiter of the last record
+	if len(plaintext)+gcm.Overhead() > pushRecordSize {
+		return nil, errors.New("push payload is too large")
+	}
+
+	// header : salt | record size | key id length | key id (application server's public key)
+	header := make([]byte, 21, 21+len(asPublic))
+	copy(header, salt)
+	binary.BigEndian.PutUint32(header[16:20], pushRecordSize)
+	header[20] = byte(len(asPublic))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// vapidAuthorization builds the Authorization header expected by push services (RFC 8292)
+func vapidAuthorization(endpoint, subject string, key *ecdsa.PrivateKey, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errors.New("invalid push endpoint")
+	}
+	claims := map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidTokenTTL).Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	jsonClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(jsonClaims)
+	digest := sha256.Sum256([]byte(token))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := append(leftPad(r.Bytes(), 32), leftPad(s.Bytes(), 32)...)
+	publicKey := elliptic.Marshal(key.Curve, key.X, key.Y)
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", token,
+		base64.RawURLEncoding.EncodeToString(signature),
+		base64.RawURLEncoding.EncodeToString(publicKey)), nil
+}
+
+// hkdf derives up to 32 bytes from input keying material with HMAC-SHA256 (RFC 5869)
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// decodeBase64URL accepts base64url strings with or without padding, as user agents may send both
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,235 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// userAgent plays the role of a browser that subscribed to a push service
+type userAgent struct {
+	private []byte
+	public  []byte
+	auth    []byte
+}
+
+func newUserAgent(t *testing.T) *userAgent {
+	private, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua := &userAgent{private: private, public: elliptic.Marshal(elliptic.P256(), x, y), auth: make([]byte, 16)}
+	rand.Read(ua.auth)
+	return ua
+}
+
+func (ua *userAgent) subscription(endpoint string) *PushSubscription {
+	return &PushSubscription{
+		Auth:     base64.RawURLEncoding.EncodeToString(ua.auth),
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(ua.public),
+	}
+}
+
+// decrypt reverses encryptPushPayload, as specified by RFC 8291
+func (ua *userAgent) decrypt(t *testing.T, body []byte) []byte {
+	if len(body) < 21 {
+		t.Fatalf("encrypted content is too short : %d bytes", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != pushRecordSize {
+		t.Errorf("expected record size %d, got %d", pushRecordSize, rs)
+	}
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	curve := elliptic.P256()
+	asX, asY := elliptic.Unmarshal(curve, asPublic)
+	if asX == nil {
+		t.Fatal("key id is not application server's public key")
+	}
+	sharedX, _ := curve.ScalarMult(asX, asY, ua.private)
+	keyInfo := append([]byte("WebPush: info\x00"), ua.public...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(ua.auth, leftPad(sharedX.Bytes(), 32), keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt content : %s", err)
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatal("last record's padding delimiter is missing")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestEncryptPushPayload(t *testing.T) {
+	ua := newUserAgent(t)
+	payload := []byte(`{"kind":"emailReceived"}`)
+	body, err := encryptPushPayload(ua.subscription("https://push.example.com/abc"), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted := ua.decrypt(t, body); string(decrypted) != string(payload) {
+		t.Errorf("expected decrypted payload %s, got %s", payload, decrypted)
+	}
+
+	_, err = encryptPushPayload(ua.subscription("https://push.example.com/abc"), make([]byte, pushRecordSize))
+	if err == nil {
+		t.Error("expected payload larger than a record to be rejected")
+	}
+}
+
+func TestVapidAuthorization(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	header, err := vapidAuthorization("https://push.example.com:8443/send/abc", "mailto:admin@caliopen.local", key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyVapid(t, header, key)
+	if claims["aud"] != "https://push.example.com:8443" || claims["sub"] != "mailto:admin@caliopen.local" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if int64(claims["exp"].(float64)) != now.Add(vapidTokenTTL).Unix() {
+		t.Errorf("unexpected expiration %v", claims["exp"])
+	}
+}
+
+// verifyVapid checks that Authorization header is signed with key and returns its JWT claims
+func verifyVapid(t *testing.T, header string, key *ecdsa.PrivateKey) map[string]interface{} {
+	var token, k string
+	for _, param := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		switch {
+		case strings.HasPrefix(param, "t="):
+			token = param[2:]
+		case strings.HasPrefix(param, "k="):
+			k = param[2:]
+		}
+	}
+	if k != base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y)) {
+		t.Errorf("unexpected public key in %s", header)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed JWT %s", token)
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if len(signature) != 64 {
+		t.Fatalf("expected a 64 bytes JWT signature, got %d bytes", len(signature))
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Fatal("invalid JWT signature")
+	}
+	claims := map[string]interface{}{}
+	jsonClaims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(jsonClaims, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestSendPush(t *testing.T) {
+	ua := newUserAgent(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	payload := []byte(`{"kind":"dmReceived"}`)
+	status := http.StatusCreated
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") != "60" {
+			t.Errorf("unexpected headers %+v", r.Header)
+		}
+		verifyVapid(t, r.Header.Get("Authorization"), key)
+		body, _ := ioutil.ReadAll(r.Body)
+		if decrypted := ua.decrypt(t, body); string(decrypted) != string(payload) {
+			t.Errorf("expected pushed payload %s, got %s", payload, decrypted)
+		}
+		w.WriteHeader(status)
+	}))
+	defer pushService.Close()
+	// test push service listens on loopback, which is refused by pushClient
+	defer func(client *http.Client) { pushClient = client }(pushClient)
+	pushClient = pushService.Client()
+
+	gone, err := sendPush(ua.subscription(pushService.URL+"/abc"), payload, key, "", 60)
+	if gone || err != nil {
+		t.Errorf("expected push to succeed, got gone=%v, err=%v", gone, err)
+	}
+	status = http.StatusGone
+	gone, err = sendPush(ua.subscription(pushService.URL+"/abc"), payload, key, "", 60)
+	if !gone || err != nil {
+		t.Errorf("expected subscription to be reported as gone, got gone=%v, err=%v", gone, err)
+	}
+	status = http.StatusTooManyRequests
+	gone, err = sendPush(ua.subscription(pushService.URL+"/abc"), payload, key, "", 60)
+	if gone || err == nil {
+		t.Errorf("expected push to fail, got gone=%v, err=%v", gone, err)
+	}
+}
+
+func TestValidatePushSubscription(t *testing.T) {
+	ua := newUserAgent(t)
+	if err := ValidatePushSubscription(ua.subscription("https://push.example.com/abc")); err != nil {
+		t.Errorf("expected subscription to be valid, got %s", err)
+	}
+	if ValidatePushSubscription(ua.subscription("http://push.example.com/abc")) == nil {
+		t.Error("expected plain http endpoint to be rejected")
+	}
+	for _, endpoint := range []string{"https://localhost/abc", "https://127.0.0.1:8443/abc", "https://169.254.169.254/abc", "https://[fe80::1]/abc", "https://10.0.0.2/abc"} {
+		if ValidatePushSubscription(ua.subscription(endpoint)) == nil {
+			t.Errorf("expected non-public endpoint %s to be rejected", endpoint)
+		}
+	}
+	sub := ua.subscription("https://push.example.com/abc")
+	sub.Auth = "c2hvcnQ"
+	if ValidatePushSubscription(sub) == nil {
+		t.Error("expected short auth secret to be rejected")
+	}
+	sub = ua.subscription("https://push.example.com/abc")
+	sub.P256dh = base64.RawURLEncoding.EncodeToString(make([]byte, 65))
+	if ValidatePushSubscription(sub) == nil {
+		t.Error("expected invalid public key to be rejected")
+	}
+}
+
+func TestNotifier_pushable(t *testing.T) {
+	N := &Notifier{config: &NotifierConfig{Push: PushConfig{
+		Notifications:   []string{"emailReceived"},
+		VapidPrivateKey: "key",
+	}}}
+	user := &User{}
+	for body, expected := range map[string]bool{
+		`{"emailReceived": "0f3b6a52-3b1e-4a3e-9c4e-2b1c8a0e5c11"}`: true,
+		`{"dmReceived": "0f3b6a52-3b1e-4a3e-9c4e-2b1c8a0e5c11"}`:    false,
+		`emailReceived`: false,
+	} {
+		if got := N.pushable(&Notification{Body: body, User: user}); got != expected {
+			t.Errorf("expected pushable to be %v for body %s, got %v", expected, body, got)
+		}
+	}
+	N.config.Push.VapidPrivateKey = ""
+	if N.pushable(&Notification{Body: `{"emailReceived": "id"}`, User: user}) {
+		t.Error("expected nothing to be pushable when push is not configured")
+	}
+}
@@ -9,17 +9,32 @@ package Notifications
 import (
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/Sirupsen/logrus"
+	"time"
 )
 
-// ByNotifQueue notifies an user by the mean of the notification queue
+// ByNotifQueue notifies an user by the mean of the notification queue and streams,
+// and by the other channels user chose for this kind of notification (push, email).
 func (N *Notifier) ByNotifQueue(notif *Notification) CaliopenError {
 	N.LogNotification("ByNotificationQueue", notif)
 
-	err := N.Store.PutNotificationInQueue(notif)
-
-	if err != nil {
-		logrus.WithError(err).Errorf("[Notifier]ByNotifQueue failed to put notification in queue")
-		return WrapCaliopenErr(err, DbCaliopenErr, "[Notifier]ByNotifQueue failed to put notification in queue")
+	channels := N.userChannels(notif, time.Now())
+	if channels[NotifChannelQueue] {
+		err := N.Store.PutNotificationInQueue(notif)
+		if err != nil {
+			logrus.WithError(err).Errorf("[Notifier]ByNotifQueue failed to put notification in queue")
+			return WrapCaliopenErr(err, DbCaliopenErr, "[Notifier]ByNotifQueue failed to put notification in queue")
+		}
+		N.publishNotification(notif)
+	}
+	if channels[NotifChannelPush] {
+		go N.ByPush(notif)
+	}
+	if channels[NotifChannelEmail] {
+		go func() {
+			if err := N.sendNotificationEmail(notif); err != nil {
+				logrus.WithError(err).Warnf("[Notifier]ByNotifQueue failed to email notification %s", notif.NotifId.String())
+			}
+		}()
 	}
 	return nil
 }
@@ -0,0 +1,130 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package Notifications
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"github.com/nats-io/go-nats"
+	"time"
+)
+
+const (
+	defaultNotificationsTopic = "notifications"
+	streamBufferSize          = 50 // notifications waiting to be sent to a slow client, before dropping next ones
+)
+
+// NotificationsStream receives notifications issued for an user as long as it is not closed
+type NotificationsStream struct {
+	Notifications chan *Notification
+	subscription  *nats.Subscription
+}
+
+// NotificationsSubject returns NATS subject on which user's notifications are published
+func NotificationsSubject(topic, userId string) string {
+	if topic == "" {
+		topic = defaultNotificationsTopic
+	}
+	return topic + "." + userId
+}
+
+// publishNotification broadcasts a notification that has been put in queue to user's streams, if any
+func (N *Notifier) publishNotification(notif *Notification) {
+	if N.NatsQueue == nil || notif.User == nil {
+		return
+	}
+	json_notif, err := notif.MarshalFrontEnd()
+	if err != nil {
+		log.WithError(err).Warnf("[Notifier] failed to marshal notification %s for streaming", notif.NotifId.String())
+		return
+	}
+	err = N.NatsQueue.Publish(NotificationsSubject(N.natsTopics[Nats_Notifs_topicKey], notif.User.UserId.String()), json_notif)
+	if err != nil {
+		log.WithError(err).Warnf("[Notifier] failed to publish notification %s", notif.NotifId.String())
+	}
+}
+
+// SubscribeNotifications opens a stream of notifications issued for user from now on.
+// Caller must close stream when done.
+func (N *Notifier) SubscribeNotifications(userId string) (*NotificationsStream, CaliopenError) {
+	if N.NatsQueue == nil {
+		return nil, NewCaliopenErr(FailDependencyCaliopenErr, "[Notifier] notifications queue is not available")
+	}
+	stream := &NotificationsStream{
+		Notifications: make(chan *Notification, streamBufferSize),
+	}
+	var user User
+	if id, err := gocql.ParseUUID(userId); err == nil {
+		user.UserId.UnmarshalBinary(id.Bytes())
+	}
+	sub, err := N.NatsQueue.Subscribe(NotificationsSubject(N.natsTopics[Nats_Notifs_topicKey], userId), func(msg *nats.Msg) {
+		notif, err := unmarshalStreamedNotification(msg.Data)
+		if err != nil {
+			log.WithError(err).Warn("[Notifier] received invalid notification on stream")
+			return
+		}
+		notif.User = &user
+		select {
+		case stream.Notifications <- notif:
+		default:
+			log.Warnf("[Notifier] notifications stream for user %s is full, notification %s dropped", userId, notif.NotifId.String())
+		}
+	})
+	if err != nil {
+		return nil, WrapCaliopenErr(err, FailDependencyCaliopenErr, "[Notifier] failed to subscribe to notifications")
+	}
+	stream.subscription = sub
+	return stream, nil
+}
+
+// Close stops receiving notifications
+func (stream *NotificationsStream) Close() error {
+	return stream.subscription.Unsubscribe()
+}
+
+// RetrieveNotificationsSince returns notifications queued for user after the given one, oldest first.
+func (N *Notifier) RetrieveNotificationsSince(userId, notifId string) ([]Notification, CaliopenError) {
+	lastId, err := gocql.ParseUUID(notifId)
+	if err != nil || lastId.Version() != 1 {
+		return []Notification{}, NewCaliopenErrf(UnprocessableCaliopenErr, "[Notifier] invalid notification id <%s>", notifId)
+	}
+	notifs, err := N.Store.RetrieveNotifications(userId, lastId.Time(), time.Time{})
+	if err != nil {
+		if err.Error() == "notifications not found" {
+			return []Notification{}, nil
+		}
+		return []Notification{}, WrapCaliopenErr(err, DbCaliopenErr, "[RetrieveNotificationsSince] failed")
+	}
+	since := []Notification{}
+	for _, notif := range notifs {
+		// time range includes last notification itself
+		if notif.NotifId.String() != lastId.String() {
+			since = append(since, notif)
+		}
+	}
+	return since, nil
+}
+
+func unmarshalStreamedNotification(data []byte) (*Notification, error) {
+	var model NotificationModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+	id, err := gocql.ParseUUID(model.NotifId)
+	if err != nil {
+		return nil, errors.New("invalid notif_id " + model.NotifId)
+	}
+	notif := &Notification{
+		Body:      model.Body,
+		Emitter:   model.Emitter,
+		Reference: model.Reference,
+		Type:      model.Type,
+	}
+	notif.NotifId.UnmarshalBinary(id.Bytes())
+	return notif, nil
+}
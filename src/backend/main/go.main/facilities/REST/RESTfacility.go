@@ -17,6 +17,7 @@ import (
 	"github.com/gocql/gocql"
 	"github.com/nats-io/go-nats"
 	"github.com/tidwall/gjson"
+	"time"
 )
 
 type (
@@ -33,6 +34,15 @@ type (
 		PatchContact(user *UserInfo, patch []byte, contactID string) error
 		DeleteContact(userID, contactID string) error
 		ContactExists(userID, contactID string) bool
+		ImportVCards(user *UserInfo, data []byte) ([]*Contact, CaliopenError)
+		ExportVCards(userId string, contactIds []string, version string) ([]byte, CaliopenError)
+		RetrieveDuplicateContacts(userId string) ([]*DuplicateContacts, CaliopenError)
+		MergeContacts(user *UserInfo, contactId, otherId string) (*Contact, CaliopenError)
+		//carddav
+		RetrieveAddressBook(userId string) ([]*AddressBookCard, CaliopenError)
+		RetrieveAddressBookCard(userId, name string) (*AddressBookCard, CaliopenError)
+		PutAddressBookCard(user *UserInfo, name string, vcard []byte, ifMatch, ifNoneMatch string) (*AddressBookCard, bool, CaliopenError)
+		DeleteAddressBookCard(userId, name, ifMatch string) CaliopenError
 		//identities
 		RetrieveContactIdentities(user_id, contact_id string) (identities []ContactIdentity, err error)
 		RetrieveLocalIdentities(user_id string) (identities []UserIdentity, err error)
@@ -43,6 +53,8 @@ type (
 		PatchUserIdentity(patch []byte, userId, RemoteId string) CaliopenError
 		DeleteUserIdentity(userId, remoteId string) CaliopenError
 		IsRemoteIdentity(userId, remoteId string) bool
+		RetrieveRemoteIdentityStatus(userId, identityId string) (*RemoteIdentityStatus, CaliopenError)
+		RemoteIdentityAction(userId, identityId, action string) CaliopenError
 		//providers
 		RetrieveProvidersList() (providers []Provider, err error)
 		GetProviderOauthFor(userID, provider string) (Provider, CaliopenError)
@@ -53,6 +65,8 @@ type (
 		GetMessagesRange(filter IndexSearch) (messages []*Message, totalFound int64, err error)
 		GetMessage(user *UserInfo, message_id string) (message *Message, err error)
 		SendDraft(user *UserInfo, msg_id string) (msg *Message, err error)
+		ScheduleDraft(user *UserInfo, msg_id string, sendAt time.Time) (*Message, CaliopenError)
+		CancelScheduledSend(user *UserInfo, msg_id string) (*Message, CaliopenError)
 		SetMessageUnread(user *UserInfo, message_id string, status bool) error
 		GetRawMessage(raw_message_id string) (message []byte, err error)
 		//attachments
@@ -69,12 +83,31 @@ type (
 		UpdateResourceTags(user *UserInfo, resourceID, resourceType string, patch []byte) CaliopenError
 		//search
 		Search(IndexSearch) (result *IndexResult, err error)
+		RetrieveSavedSearches(userId string) ([]SavedSearch, CaliopenError)
+		RetrieveSavedSearch(userId, searchId string) (*SavedSearch, CaliopenError)
+		CreateSavedSearch(search *SavedSearch) CaliopenError
+		PatchSavedSearch(patch []byte, userId, searchId string) (*SavedSearch, CaliopenError)
+		DeleteSavedSearch(userId, searchId string) CaliopenError
+		RetrieveSavedSearchResults(user *UserInfo, searchId string, limit, offset int, ilRange [2]int8) (*SavedSearchResults, CaliopenError)
 		//users
 		PatchUser(user_id string, patch *gjson.Result, notifier Notifications.Notifiers) error
 		RequestPasswordReset(payload PasswordResetRequest, notifier Notifications.Notifiers) error
 		ValidatePasswordResetToken(token string) (session *TokenSession, err error)
 		ResetUserPassword(token, new_password string, notifier Notifications.Notifiers) error
 		DeleteUser(payload ActionsPayload) CaliopenError
+		AuthenticateAppPassword(username, password string) (*UserInfo, CaliopenError)
+		RetrieveAppPasswords(userId string) ([]AppPassword, CaliopenError)
+		CreateAppPassword(userId, label string) (password *AppPassword, clear string, err CaliopenError)
+		DeleteAppPassword(userId, appPasswordId string) CaliopenError
+		PurgeUser(userId string) (*UserPurge, CaliopenError)
+		RetrieveUserPurge(userId string) (*UserPurge, CaliopenError)
+		VerifyUserPurge(userId string) (map[string]int, CaliopenError)
+		RequestUserExport(userId string, notifier Notifications.Notifiers) (*UserExport, CaliopenError)
+		RetrieveUserExport(userId string) (*UserExport, CaliopenError)
+		OpenUserExport(token string) (*UserExport, io.Reader, CaliopenError)
+		//imports
+		ImportMailbox(userId, identityId string, files []MailboxFile) (*MailboxImport, CaliopenError)
+		RetrieveMailboxImport(userId string) (*MailboxImport, CaliopenError)
 		//devices
 		CreateDevice(device *Device) CaliopenError
 		RetrieveDevices(userId string) ([]Device, CaliopenError)
@@ -83,22 +116,33 @@ type (
 		PatchDevice(patch []byte, userId, deviceId string) CaliopenError
 		DeleteDevice(userId, deviceId string) CaliopenError
 		RequestDeviceValidation(userId, deviceId, channel string, notifier Notifications.Notifiers) CaliopenError
-		ConfirmDeviceValidation(userId, token string) CaliopenError
+		ConfirmDeviceValidation(userId, token string, notifier Notifications.Notifiers) CaliopenError
+		SubscribeDevicePush(userId, deviceId string, subscription *PushSubscription) CaliopenError
+		UnsubscribeDevicePush(userId, deviceId string) CaliopenError
 		//keys
 		CreatePGPPubKey(label string, pubkey []byte, contact *Contact) (*PublicKey, CaliopenError)
 		RetrieveContactPubKeys(userId, contactId string) (pubkeys PublicKeys, err CaliopenError)
 		RetrievePubKey(userId, resourceId, keyId string) (pubkey *PublicKey, err CaliopenError)
 		DeletePubKey(pubkey *PublicKey) CaliopenError
 		PatchPubKey(patch []byte, userId, resourceId, keyId string) CaliopenError
+		//web key directory
+		WKDEnabled() bool
+		RetrieveWKDKeys(domain, hash, localPart string) ([]byte, CaliopenError)
+		WKDPolicy(domain string) []byte
+		WKDSubmissionAddress(domain string) ([]byte, CaliopenError)
 	}
 	RESTfacility struct {
-		Cache      backends.APICache
-		index      backends.APIIndex
-		natsTopics map[string]string
-		nats_conn  *nats.Conn
-		providers  map[string]Provider
-		store      backends.APIStorage
-		Hostname   string
+		Cache         backends.APICache
+		export        ExportConfig
+		index         backends.APIIndex
+		natsTopics    map[string]string
+		nats_conn     *nats.Conn
+		providers     map[string]Provider
+		scheduledSend ScheduledSendConfig
+		store         backends.APIStorage
+		wkd           WKDConfig
+		wksKey        []byte // public key of Web Key Service's submission address, nil if service is disabled
+		Hostname      string
 	}
 )
 
@@ -112,6 +156,8 @@ func NewRESTfacility(config CaliopenConfig, nats_conn *nats.Conn) (rest_facility
 		Nats_outTwitter_topicKey: config.NatsConfig.OutTWITTER_topic,
 		Nats_Keys_topicKey:       config.NatsConfig.Keys_topic,
 		Nats_IdPoller_topicKey:   config.NatsConfig.IdPoller_topic,
+		Nats_Users_topicKey:      config.NatsConfig.Users_topic,
+		Nats_Imports_topicKey:    config.NatsConfig.Imports_topic,
 	}
 	switch config.RESTstoreConfig.BackendName {
 	case "cassandra":
@@ -129,6 +175,8 @@ func NewRESTfacility(config CaliopenConfig, nats_conn *nats.Conn) (rest_facility
 			cassaConfig.OSSConfig.Location = config.RESTstoreConfig.OSSConfig.Location
 			cassaConfig.OSSConfig.RawMsgBucket = config.RESTstoreConfig.OSSConfig.Buckets["raw_messages"]
 			cassaConfig.OSSConfig.AttachmentBucket = config.RESTstoreConfig.OSSConfig.Buckets["temporary_attachments"]
+			cassaConfig.OSSConfig.ExportBucket = config.RESTstoreConfig.OSSConfig.Buckets["exports"]
+			cassaConfig.OSSConfig.ImportBucket = config.RESTstoreConfig.OSSConfig.Buckets["imports"]
 		}
 		if config.RESTstoreConfig.UseVault {
 			cassaConfig.HVaultConfig.Url = config.RESTstoreConfig.VaultConfig.Url
@@ -172,6 +220,15 @@ func NewRESTfacility(config CaliopenConfig, nats_conn *nats.Conn) (rest_facility
 		}
 	}
 
+	rest_facility.scheduledSend = config.ScheduledSend
+	rest_facility.export = config.Export
+	rest_facility.wkd = config.WKD
+	if config.WKD.Enable && config.WKD.SubmissionLocalPart != "" {
+		rest_facility.wksKey, err = wksPublicKey(config.WKD.SubmissionKeyFile)
+		if err != nil {
+			log.WithError(err).Fatalf("failed to read Web Key Service's submission key %s", config.WKD.SubmissionKeyFile)
+		}
+	}
 	rest_facility.Hostname = config.Hostname
 	return rest_facility
 }
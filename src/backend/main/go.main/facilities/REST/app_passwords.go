@@ -0,0 +1,89 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+const appPasswordSize = 24 // random bytes of generated passwords
+
+// AuthenticateAppPassword checks an application password of username, for clients that can't go through
+// Caliopen's login process, like CardDAV address books. User's main password is never accepted.
+func (rest *RESTfacility) AuthenticateAppPassword(username, password string) (*UserInfo, CaliopenError) {
+	user, err := rest.store.UserByUsername(username)
+	if err != nil || user == nil {
+		return nil, WrapCaliopenErr(err, WrongCredentialsErr, "[RESTfacility] AuthenticateAppPassword user not found")
+	}
+	if !user.DateDelete.IsZero() {
+		return nil, NewCaliopenErr(WrongCredentialsErr, "[RESTfacility] AuthenticateAppPassword user is deleted")
+	}
+	passwords, err := rest.store.RetrieveAppPasswords(user.UserId.String())
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] AuthenticateAppPassword failed to retrieve passwords")
+	}
+	hash := HashAppPassword(password)
+	for _, appPassword := range passwords {
+		if subtle.ConstantTimeCompare(appPassword.Hash, hash) == 1 {
+			return &UserInfo{User_id: user.UserId.String(), Shard_id: user.ShardId}, nil
+		}
+	}
+	return nil, NewCaliopenErr(WrongCredentialsErr, "[RESTfacility] AuthenticateAppPassword wrong password")
+}
+
+// RetrieveAppPasswords returns user's application passwords, without their hash
+func (rest *RESTfacility) RetrieveAppPasswords(userId string) ([]AppPassword, CaliopenError) {
+	passwords, err := rest.store.RetrieveAppPasswords(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] RetrieveAppPasswords failed")
+	}
+	return passwords, nil
+}
+
+// CreateAppPassword generates a new application password for user.
+// Password is returned in clear, it could not be retrieved afterwards.
+func (rest *RESTfacility) CreateAppPassword(userId, label string) (password *AppPassword, clear string, err CaliopenError) {
+	if label == "" {
+		return nil, "", NewCaliopenErr(UnprocessableCaliopenErr, "[RESTfacility] application password's label is empty")
+	}
+	secret := make([]byte, appPasswordSize)
+	if _, e := rand.Read(secret); e != nil {
+		return nil, "", WrapCaliopenErr(e, UnknownCaliopenErr, "[RESTfacility] CreateAppPassword failed to generate password")
+	}
+	clear = base64.RawURLEncoding.EncodeToString(secret)
+	password = &AppPassword{
+		DateInsert: time.Now(),
+		Hash:       HashAppPassword(clear),
+		Label:      label,
+	}
+	password.AppPasswordId.UnmarshalBinary(uuid.NewV4().Bytes())
+	password.UserId.UnmarshalBinary(uuid.FromStringOrNil(userId).Bytes())
+	if e := rest.store.CreateAppPassword(password); e != nil {
+		return nil, "", WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] CreateAppPassword failed to store password")
+	}
+	return password, clear, nil
+}
+
+// DeleteAppPassword revokes an application password of user
+func (rest *RESTfacility) DeleteAppPassword(userId, appPasswordId string) CaliopenError {
+	passwords, err := rest.RetrieveAppPasswords(userId)
+	if err != nil {
+		return err
+	}
+	for _, password := range passwords {
+		if password.AppPasswordId.String() == appPasswordId {
+			if e := rest.store.DeleteAppPassword(userId, appPasswordId); e != nil {
+				return WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] DeleteAppPassword failed")
+			}
+			return nil
+		}
+	}
+	return NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] application password %s not found", appPasswordId)
+}
@@ -0,0 +1,58 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestRESTfacility_AuthenticateAppPassword(t *testing.T) {
+	mainPassword, _ := bcrypt.GenerateFromPassword([]byte("main password"), bcrypt.MinCost)
+	user := &User{Name: "emma", Password: mainPassword, ShardId: "shard", UserId: UUID(uuid.NewV4())}
+	rest := new(RESTfacility)
+	store := backendstest.NewFakeStore()
+	store.Users = []*User{user}
+	rest.store = store
+	userId := user.UserId.String()
+
+	if _, _, err := rest.CreateAppPassword(userId, ""); err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected password without label to be unprocessable, got %v", err)
+	}
+	password, clear, err := rest.CreateAppPassword(userId, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clear) < appPasswordSize || string(password.Hash) == clear {
+		t.Errorf("expected a random password stored as hash, got %s and %x", clear, password.Hash)
+	}
+
+	info, err := rest.AuthenticateAppPassword("emma", clear)
+	if err != nil || info.User_id != userId || info.Shard_id != "shard" {
+		t.Errorf("expected application password to authenticate user, got %+v (%v)", info, err)
+	}
+	for _, c := range []struct{ username, password string }{
+		{"emma", "main password"},
+		{"emma", clear + "x"},
+		{"john", clear},
+	} {
+		if _, err = rest.AuthenticateAppPassword(c.username, c.password); err == nil || err.Code() != WrongCredentialsErr {
+			t.Errorf("expected %s/%s to be rejected, got %v", c.username, c.password, err)
+		}
+	}
+
+	if err = rest.DeleteAppPassword(userId, uuid.NewV4().String()); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected unknown password to be not found, got %v", err)
+	}
+	if err = rest.DeleteAppPassword(userId, password.AppPasswordId.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rest.AuthenticateAppPassword("emma", clear); err == nil {
+		t.Error("expected revoked password to be rejected")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/satori/go.uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CardDAVNameInfo   = "carddav_name" // contact's Infos key keeping resource name chosen by a CardDAV client
+	cardDAVNameSuffix = ".vcf"
+)
+
+// AddressBookCard is a contact as seen by CardDAV clients, under a resource name
+type AddressBookCard struct {
+	Contact *Contact
+	ETag    string
+	Name    string
+}
+
+func newAddressBookCard(contact *Contact) *AddressBookCard {
+	name := contact.Infos[CardDAVNameInfo]
+	if name == "" {
+		name = contact.ContactId.String() + cardDAVNameSuffix
+	}
+	return &AddressBookCard{
+		Contact: contact,
+		ETag:    helpers.VCardETag(contact),
+		Name:    name,
+	}
+}
+
+// AddressBookCTag returns a tag that changes whenever a card is added to, modified or removed from address book
+func AddressBookCTag(cards []*AddressBookCard) string {
+	tags := make([]string, 0, len(cards))
+	for _, card := range cards {
+		tags = append(tags, card.Name+card.ETag)
+	}
+	sort.Strings(tags)
+	sum := sha1.Sum([]byte(strings.Join(tags, "\n")))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// MatchETag tells if etag is one of the entity tags listed in an If-Match or If-None-Match header
+func MatchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// RetrieveAddressBook returns all user's contacts as address book's cards
+func (rest *RESTfacility) RetrieveAddressBook(userId string) ([]*AddressBookCard, CaliopenError) {
+	contacts, err := rest.retrieveAddressBookContacts(userId)
+	if err != nil {
+		return nil, err
+	}
+	cards := make([]*AddressBookCard, 0, len(contacts))
+	for _, contact := range contacts {
+		cards = append(cards, newAddressBookCard(contact))
+	}
+	return cards, nil
+}
+
+// RetrieveAddressBookCard returns the card named name in user's address book
+func (rest *RESTfacility) RetrieveAddressBookCard(userId, name string) (*AddressBookCard, CaliopenError) {
+	// cards created by Caliopen are named after their contact, others are looked up by the name their client gave
+	contactId := ""
+	if id, err := uuid.FromString(strings.TrimSuffix(name, cardDAVNameSuffix)); err == nil {
+		contactId = id.String()
+	}
+	if id, err := rest.store.RetrieveCardDAVContactId(userId, name); err == nil {
+		contactId = id
+	} else if err.Error() != "not found" {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] failed to look up card in address book")
+	}
+	if contactId != "" {
+		contact, err := rest.RetrieveContact(userId, contactId)
+		if err == nil && contact.Deleted.IsZero() {
+			rest.loadContactKeys(contact)
+			if card := newAddressBookCard(contact); card.Name == name {
+				return card, nil
+			}
+		}
+	}
+	return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] card %s not found in address book", name)
+}
+
+// PutAddressBookCard creates or replaces the card named name with the given vCard.
+// ifMatch and ifNoneMatch are the request's preconditions, if any.
+// On replacement, properties that vCards can't carry (tags, social identities…) are kept,
+// and PGP keys are only added : keys missing from vCard are not removed from contact.
+func (rest *RESTfacility) PutAddressBookCard(user *UserInfo, name string, vcard []byte, ifMatch, ifNoneMatch string) (card *AddressBookCard, created bool, err CaliopenError) {
+	cards, e := helpers.UnmarshalVCards(vcard)
+	if e != nil || len(cards) != 1 {
+		return nil, false, WrapCaliopenErr(e, UnprocessableCaliopenErr, "[RESTfacility] PutAddressBookCard expects exactly one vCard")
+	}
+	update := cards[0]
+	existing, err := rest.RetrieveAddressBookCard(user.User_id, name)
+	if err != nil && err.Code() != NotFoundCaliopenErr {
+		return nil, false, err
+	}
+	switch {
+	case existing != nil && ifNoneMatch != "" && MatchETag(ifNoneMatch, existing.ETag):
+		return nil, false, NewCaliopenErrf(PreconditionFailedCaliopenErr, "[RESTfacility] card %s already exists", name)
+	case ifMatch != "" && (existing == nil || !MatchETag(ifMatch, existing.ETag)):
+		return nil, false, NewCaliopenErrf(PreconditionFailedCaliopenErr, "[RESTfacility] card %s has been modified", name)
+	}
+
+	keys := update.PublicKeys
+	update.PublicKeys = nil
+	if existing == nil {
+		update.UserId.UnmarshalBinary(uuid.FromStringOrNil(user.User_id).Bytes())
+		update.Infos[CardDAVNameInfo] = name
+		if e = rest.CreateContact(update); e != nil {
+			return nil, false, WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] PutAddressBookCard failed to create contact")
+		}
+		if e = rest.store.SetCardDAVName(user.User_id, name, update.ContactId.String()); e != nil {
+			return nil, false, WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] PutAddressBookCard failed to name card")
+		}
+		rest.addContactKeys(update, keys, vCardKeyLabel)
+		return newAddressBookCard(update), true, nil
+	}
+
+	oldContact := existing.Contact
+	contact, modifiedFields := applyVCard(oldContact, update)
+	if e = rest.UpdateContact(user, contact, oldContact, modifiedFields); e != nil {
+		return nil, false, WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] PutAddressBookCard failed to update contact")
+	}
+	rest.addContactKeys(contact, keys, vCardKeyLabel)
+	return newAddressBookCard(contact), false, nil
+}
+
+// DeleteAddressBookCard deletes the contact behind card named name, if it is not user's own contact card.
+func (rest *RESTfacility) DeleteAddressBookCard(userId, name, ifMatch string) CaliopenError {
+	card, err := rest.RetrieveAddressBookCard(userId, name)
+	if err != nil {
+		return err
+	}
+	if ifMatch != "" && !MatchETag(ifMatch, card.ETag) {
+		return NewCaliopenErrf(PreconditionFailedCaliopenErr, "[RESTfacility] card %s has been modified", name)
+	}
+	if rest.store.RetrieveUserContactId(userId) == card.Contact.ContactId.String() {
+		return NewCaliopenErr(ForbiddenCaliopenErr, "[RESTfacility] can't delete contact card related to user")
+	}
+	if e := rest.DeleteContact(userId, card.Contact.ContactId.String()); e != nil {
+		return WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] DeleteAddressBookCard failed to delete contact")
+	}
+	if _, named := card.Contact.Infos[CardDAVNameInfo]; named {
+		if e := rest.store.DeleteCardDAVName(userId, name); e != nil {
+			return WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] DeleteAddressBookCard failed to delete card's name")
+		}
+	}
+	return nil
+}
+
+// retrieveAddressBookContacts returns user's contacts that are not deleted, with their PGP keys
+func (rest *RESTfacility) retrieveAddressBookContacts(userId string) ([]*Contact, CaliopenError) {
+	all, err := rest.store.RetrieveUserContacts(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] failed to retrieve user's contacts")
+	}
+	contacts := []*Contact{}
+	for contact := range all {
+		if !contact.Deleted.IsZero() {
+			continue
+		}
+		rest.loadContactKeys(contact)
+		contacts = append(contacts, contact)
+	}
+	return contacts, nil
+}
+
+// applyVCard returns a copy of contact with properties replaced by the ones of parsed vCard,
+// and the modified fields to be saved.
+func applyVCard(contact, vcard *Contact) (*Contact, map[string]interface{}) {
+	updated := *contact
+	updated.Title = vcard.Title
+	updated.FamilyName = vcard.FamilyName
+	updated.GivenName = vcard.GivenName
+	updated.AdditionalName = vcard.AdditionalName
+	updated.NamePrefix = vcard.NamePrefix
+	updated.NameSuffix = vcard.NameSuffix
+	updated.Emails = vcard.Emails
+	updated.Phones = vcard.Phones
+	updated.Addresses = vcard.Addresses
+	updated.Organizations = vcard.Organizations
+	updated.Ims = vcard.Ims
+	// system tags are exported among vCard's categories, they must not become user's groups
+	updated.Groups = []string{}
+	for _, group := range vcard.Groups {
+		isTag := false
+		for _, tag := range contact.Tags {
+			if tag == group {
+				isTag = true
+				break
+			}
+		}
+		if !isTag {
+			updated.Groups = append(updated.Groups, group)
+		}
+	}
+	updated.Infos = map[string]string{}
+	for k, v := range contact.Infos {
+		updated.Infos[k] = v
+	}
+	delete(updated.Infos, helpers.VCardUidInfo)
+	if uid := vcard.Infos[helpers.VCardUidInfo]; uid != "" && uid != "urn:uuid:"+contact.ContactId.String() {
+		updated.Infos[helpers.VCardUidInfo] = uid
+	}
+	updated.DateUpdate = time.Now()
+	if updated.Title == "" {
+		helpers.ComputeTitle(&updated)
+	}
+	helpers.NormalizePhoneNumbers(&updated)
+	MarshalNested(&updated)
+
+	modifiedFields := map[string]interface{}{
+		"AdditionalName": updated.AdditionalName,
+		"Addresses":      updated.Addresses,
+		"DateUpdate":     updated.DateUpdate,
+		"Emails":         updated.Emails,
+		"FamilyName":     updated.FamilyName,
+		"GivenName":      updated.GivenName,
+		"Groups":         updated.Groups,
+		"Ims":            updated.Ims,
+		"Infos":          updated.Infos,
+		"NamePrefix":     updated.NamePrefix,
+		"NameSuffix":     updated.NameSuffix,
+		"Organizations":  updated.Organizations,
+		"Phones":         updated.Phones,
+		"Title":          updated.Title,
+	}
+	return &updated, modifiedFields
+}
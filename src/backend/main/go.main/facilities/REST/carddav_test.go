@@ -0,0 +1,149 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+// newAddressBookTestStore serves user's own card, a card named by a CardDAV client and a deleted contact
+func newAddressBookTestStore(userId string) *backendstest.FakeStore {
+	user := UUID(uuid.FromStringOrNil(userId))
+	store := backendstest.NewFakeStore()
+	store.Contacts = []*Contact{
+		{Title: "Emma", Emails: []EmailContact{{Address: "emma@caliopen.local"}}},
+		{Title: "Jean Dupont", Infos: map[string]string{CardDAVNameInfo: "jean dupont.vcf"}, Tags: []string{"prospect"}},
+		{Title: "deleted", Deleted: time.Now()},
+	}
+	for _, contact := range store.Contacts {
+		contact.ContactId = UUID(uuid.NewV4())
+		contact.UserId = user
+	}
+	store.UserContacts[userId] = store.Contacts[0].ContactId.String()
+	return store
+}
+
+func TestRESTfacility_RetrieveAddressBook(t *testing.T) {
+	userId := uuid.NewV4().String()
+	store := newAddressBookTestStore(userId)
+	rest := new(RESTfacility)
+	rest.store = store
+
+	cards, err := rest.RetrieveAddressBook(userId)
+	if err != nil || len(cards) != 2 {
+		t.Fatalf("expected 2 cards, got %d (%v)", len(cards), err)
+	}
+	ownName := store.Contacts[0].ContactId.String() + ".vcf"
+	if cards[0].Name != ownName || cards[1].Name != "jean dupont.vcf" || cards[0].ETag == cards[1].ETag {
+		t.Errorf("unexpected cards names or etags : %+v %+v", cards[0], cards[1])
+	}
+	listings := len(store.CallsTo("RetrieveUserContacts"))
+	for _, name := range []string{ownName, "jean dupont.vcf"} {
+		if card, err := rest.RetrieveAddressBookCard(userId, name); err != nil || card.Name != name {
+			t.Errorf("expected to retrieve card %s, got %+v (%v)", name, card, err)
+		}
+	}
+	if len(store.CallsTo("RetrieveUserContacts")) != listings {
+		t.Error("expected cards to be retrieved without loading whole address book")
+	}
+	// a card named by a client is not reachable by its contact id
+	name := store.Contacts[1].ContactId.String() + ".vcf"
+	if _, err := rest.RetrieveAddressBookCard(userId, name); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected card %s not to be found, got %v", name, err)
+	}
+
+	ctag := AddressBookCTag(cards)
+	if AddressBookCTag([]*AddressBookCard{cards[1], cards[0]}) != ctag {
+		t.Error("expected ctag not to depend on cards order")
+	}
+	if AddressBookCTag(cards[:1]) == ctag {
+		t.Error("expected ctag to change when a card is removed")
+	}
+}
+
+func TestRESTfacility_AddressBookPreconditions(t *testing.T) {
+	user := &UserInfo{User_id: uuid.NewV4().String()}
+	store := newAddressBookTestStore(user.User_id)
+	rest := new(RESTfacility)
+	rest.store = store
+	card, _ := rest.RetrieveAddressBookCard(user.User_id, "jean dupont.vcf")
+	vcard := []byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Jean Dupont\r\nEND:VCARD\r\n")
+
+	if _, _, err := rest.PutAddressBookCard(user, "jean dupont.vcf", vcard, "", "*"); err == nil || err.Code() != PreconditionFailedCaliopenErr {
+		t.Errorf("expected If-None-Match to prevent card overwrite, got %v", err)
+	}
+	if _, _, err := rest.PutAddressBookCard(user, "jean dupont.vcf", vcard, `"outdated"`, ""); err == nil || err.Code() != PreconditionFailedCaliopenErr {
+		t.Errorf("expected If-Match to prevent outdated card overwrite, got %v", err)
+	}
+	if _, _, err := rest.PutAddressBookCard(user, "unknown.vcf", vcard, card.ETag, ""); err == nil || err.Code() != PreconditionFailedCaliopenErr {
+		t.Errorf("expected If-Match to prevent card creation, got %v", err)
+	}
+	if _, _, err := rest.PutAddressBookCard(user, "new.vcf", []byte("not a vcard"), "", "*"); err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected invalid vCard to be rejected, got %v", err)
+	}
+	if err := rest.DeleteAddressBookCard(user.User_id, "jean dupont.vcf", `W/"outdated", "other"`); err == nil || err.Code() != PreconditionFailedCaliopenErr {
+		t.Errorf("expected If-Match to prevent outdated card deletion, got %v", err)
+	}
+	ownName := store.Contacts[0].ContactId.String() + ".vcf"
+	if err := rest.DeleteAddressBookCard(user.User_id, ownName, ""); err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected user's own card deletion to be forbidden, got %v", err)
+	}
+}
+
+func TestApplyVCard(t *testing.T) {
+	contact := &Contact{
+		ContactId:  UUID(uuid.NewV4()),
+		Identities: []SocialIdentity{{Name: "jdupont", Type: TwitterProtocol}},
+		Infos:      map[string]string{CardDAVNameInfo: "jean.vcf", "vcard_uid": "old-uid"},
+		Tags:       []string{"prospect"},
+		Title:      "Jean",
+	}
+	vcard := &Contact{
+		GivenName: "Jean",
+		Groups:    []string{"friends", "prospect"},
+		Infos:     map[string]string{"vcard_uid": "urn:uuid:" + contact.ContactId.String()},
+		Emails:    []EmailContact{{Address: "jean@example.com"}},
+	}
+	updated, fields := applyVCard(contact, vcard)
+
+	if len(updated.Identities) != 1 || len(updated.Tags) != 1 || updated.Infos[CardDAVNameInfo] != "jean.vcf" {
+		t.Errorf("expected properties out of vCard's scope to be kept, got %+v", updated)
+	}
+	if len(updated.Groups) != 1 || updated.Groups[0] != "friends" {
+		t.Errorf("expected tags not to become groups, got %v", updated.Groups)
+	}
+	if _, hasUid := updated.Infos["vcard_uid"]; hasUid {
+		t.Error("expected contact's own UID not to be kept")
+	}
+	if updated.Title == "" || updated.Emails[0].EmailId == (UUID{}) {
+		t.Errorf("expected title to be computed and nested objects to get ids, got %+v", updated)
+	}
+	if _, ok := fields["Emails"]; !ok || fields["Title"] != updated.Title {
+		t.Errorf("unexpected modified fields %v", fields)
+	}
+	if contact.Title != "Jean" || contact.Infos["vcard_uid"] != "old-uid" {
+		t.Error("expected original contact to be left untouched")
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	etag := `"abc"`
+	for header, expected := range map[string]bool{
+		`"abc"`:        true,
+		`*`:            true,
+		`"x", W/"abc"`: true,
+		`"abcd"`:       false,
+		`"x", "y"`:     false,
+		`abc`:          false,
+	} {
+		if MatchETag(header, etag) != expected {
+			t.Errorf("expected MatchETag(%s) to be %v", header, expected)
+		}
+	}
+}
@@ -24,6 +24,9 @@ var (
 	notifyByEmail = func(notifier Notifications.Notifiers, notif *Notification) CaliopenError {
 		return notifier.ByEmail(notif)
 	}
+	notifyByQueue = func(notifier Notifications.Notifiers, notif *Notification) CaliopenError {
+		return notifier.ByNotifQueue(notif)
+	}
 )
 
 func (rest *RESTfacility) RetrieveDevices(userId string) (devices []Device, err CaliopenError) {
@@ -188,7 +191,7 @@ func (rest *RESTfacility) RequestDeviceValidation(userId, deviceId, channel stri
 	return nil
 }
 
-func (rest *RESTfacility) ConfirmDeviceValidation(userId, token string) CaliopenError {
+func (rest *RESTfacility) ConfirmDeviceValidation(userId, token string, notifier Notifications.Notifiers) CaliopenError {
 
 	session, err := rest.Cache.GetTokenValidationSession(userId, token)
 	if err != nil && err != redis.Nil {
@@ -220,5 +223,47 @@ func (rest *RESTfacility) ConfirmDeviceValidation(userId, token string) Caliopen
 		return WrapCaliopenErrf(err, FailDependencyCaliopenErr, "failed to delete session for user %s, device %s", userId, session.ResourceId)
 	}
 
+	// let user's open clients know that device is verified
+	notif := &Notification{
+		Body:    `{"deviceValidated": "` + session.ResourceId + `"}`,
+		Emitter: "api",
+		NotifId: UUID(uuid.NewV1()),
+		TTLcode: ShortLived,
+		Type:    EventNotif,
+		User:    &User{UserId: currentDevice.UserId},
+	}
+	go notifyByQueue(notifier, notif)
+
 	return nil
 }
+
+// SubscribeDevicePush registers the Web Push subscription of device's user agent.
+// Notifications are pushed to subscribed devices once they have been verified.
+func (rest *RESTfacility) SubscribeDevicePush(userId, deviceId string, subscription *PushSubscription) CaliopenError {
+	err := Notifications.ValidatePushSubscription(subscription)
+	if err != nil {
+		return WrapCaliopenErr(err, UnprocessableCaliopenErr, "[RESTfacility] SubscribeDevicePush invalid push subscription")
+	}
+	device, err := rest.store.RetrieveDevice(userId, deviceId)
+	if err != nil || device == nil {
+		return WrapCaliopenErr(err, NotFoundCaliopenErr, "device not found")
+	}
+	subscription.DateInsert = time.Now()
+	updated := *device
+	updated.Push = subscription
+	return rest.UpdateDevice(&updated, device, map[string]interface{}{"Push": subscription})
+}
+
+// UnsubscribeDevicePush removes device's Web Push subscription, if any
+func (rest *RESTfacility) UnsubscribeDevicePush(userId, deviceId string) CaliopenError {
+	device, err := rest.store.RetrieveDevice(userId, deviceId)
+	if err != nil || device == nil {
+		return WrapCaliopenErr(err, NotFoundCaliopenErr, "device not found")
+	}
+	if device.Push == nil {
+		return nil
+	}
+	updated := *device
+	updated.Push = nil
+	return rest.UpdateDevice(&updated, device, map[string]interface{}{"Push": nil})
+}
@@ -60,9 +60,16 @@ func TestRESTfacility_RequestDeviceValidation(t *testing.T) {
 func TestRESTfacility_ConfirmDeviceValidation(t *testing.T) {
 	// create a validation session before testing confirmation process
 	rest, session := boostrapValidationSession(backendstest.EmmaTommeUserId, "b8c11acd-a90d-467f-90f7-21b6b615149d")
+	notifier := &Notifications.Notifier{}
+	notifCalled := make(chan struct{})
+	defer func(restore func(Notifications.Notifiers, *Notification) CaliopenError) { notifyByQueue = restore }(notifyByQueue)
+	notifyByQueue = func(notifier Notifications.Notifiers, notif *Notification) CaliopenError {
+		close(notifCalled)
+		return nil
+	}
 
 	// test calling with invalid token
-	err := rest.ConfirmDeviceValidation(backendstest.EmmaTommeUserId, "invalid_token")
+	err := rest.ConfirmDeviceValidation(backendstest.EmmaTommeUserId, "invalid_token", notifier)
 	if err == nil {
 		t.Error("expected calling deviceValidation with invalid token to return DbCaliopenErr, got nil")
 	} else if err.Code() == DbCaliopenErr {
@@ -70,10 +77,15 @@ func TestRESTfacility_ConfirmDeviceValidation(t *testing.T) {
 	}
 
 	// test if device's status has been updated
-	err = rest.ConfirmDeviceValidation(backendstest.EmmaTommeUserId, session.Token)
+	err = rest.ConfirmDeviceValidation(backendstest.EmmaTommeUserId, session.Token, notifier)
 	if err != nil {
 		t.Error(err)
 	}
+	select {
+	case <-notifCalled:
+	case <-time.After(1 * time.Second):
+		t.Error("timeout waiting for notifyByQueue to be called")
+	}
 	updatedDevice, err := rest.RetrieveDevice(backendstest.EmmaTommeUserId, "b8c11acd-a90d-467f-90f7-21b6b615149d")
 	if err != nil {
 		t.Error(err)
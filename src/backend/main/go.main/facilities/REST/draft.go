@@ -11,22 +11,48 @@ import (
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
 	log "github.com/Sirupsen/logrus"
+	"github.com/satori/go.uuid"
 	"time"
 )
 
+// outgoing is a message to send through one of user's identities, to a subset of draft's recipients
+type outgoing struct {
+	identity   *UserIdentity
+	message    *Message // nil until outgoing message is built from draft
+	protocol   string
+	recipients []Participant
+}
+
 func (rest *RESTfacility) SendDraft(user_info *UserInfo, msg_id string) (msg *Message, err error) {
-	const nats_order = "deliver"
-	var order BrokerOrder
 	draft, draftErr := rest.store.RetrieveMessage(user_info.User_id, msg_id)
 	if draftErr != nil {
 		log.WithError(draftErr).Info("[SendDraft] failed to retrieve draft from store")
 		return nil, errors.New("draft not found")
 	}
-	// resolve sender's address protocol for selecting natsTopics accordingly
-	protocol, resolvErr := rest.ResolveSenderProtocol(draft)
-	if resolvErr != nil {
-		log.WithError(resolvErr).Info("[SendDraft] failed to resolve sender's protocol")
-		return nil, errors.New("unknown protocol for sender")
+	if !draft.Send_at.IsZero() {
+		// draft is scheduled : take it back from scheduler before sending it right now
+		unscheduled, err := rest.Cache.UnscheduleSend(user_info.User_id, msg_id)
+		if err != nil {
+			return nil, err
+		}
+		if !unscheduled {
+			return nil, errors.New("draft is already being sent")
+		}
+	}
+	return rest.sendDraft(user_info, draft)
+}
+
+// sendDraft splits draft into one outgoing message per protocol (and per recipient for protocols
+// that only handle one recipient), hands them over to outbound workers and waits for their acks.
+// Delivery status of each recipient is saved back into draft.
+func (rest *RESTfacility) sendDraft(user_info *UserInfo, draft *Message) (msg *Message, err error) {
+	msg_id := draft.Message_id.String()
+	outgoings, statuses := rest.splitDraft(user_info, draft)
+	if len(outgoings) == 0 {
+		if len(statuses) > 0 {
+			return nil, errors.New(statuses[0].Error)
+		}
+		return nil, errors.New("[SendDraft] draft has no recipient to send to")
 	}
 	// Associate to an existing discussion or create a new one
 	discussion, err := rest.store.GetOrCreateDiscussion(draft.User_id, draft.Participants)
@@ -38,6 +64,9 @@ func (rest *RESTfacility) SendDraft(user_info *UserInfo, msg_id string) (msg *Me
 	// Update message with the computed discussion
 	fields := make(map[string]interface{})
 	fields["Discussion_id"] = discussion.Discussion_id
+	if !draft.Send_at.IsZero() {
+		fields["Send_at"] = nil
+	}
 
 	err = rest.store.UpdateMessage(draft, fields)
 	if err != nil {
@@ -50,75 +79,308 @@ func (rest *RESTfacility) SendDraft(user_info *UserInfo, msg_id string) (msg *Me
 		log.WithError(err).Warn("[SendDraft] Index.UpdateMessage operation failed")
 		return nil, err
 	}
+	draft.Discussion_id = discussion.Discussion_id
+
+	// draft is sent as is if it goes to all its recipients through its own identity
+	asIs := len(outgoings) == 1 && len(statuses) == 0 &&
+		len(draft.UserIdentities) > 0 && outgoings[0].identity.Id == draft.UserIdentities[0] &&
+		len(outgoings[0].recipients) == len(recipientsOf(draft))
+	var sendErr error
+	var emailSent *Message
+	for _, out := range outgoings {
+		if asIs {
+			out.message = draft
+		} else if e := rest.buildOutgoingMessage(user_info, draft, out); e != nil {
+			statuses = append(statuses, out.deliveryStatuses(e)...)
+			sendErr = e
+			continue
+		}
+		e := rest.deliver(user_info, out)
+		statuses = append(statuses, out.deliveryStatuses(e)...)
+		if e != nil {
+			sendErr = e
+		} else if out.protocol == EmailProtocol {
+			emailSent = out.message
+		}
+		if !asIs {
+			rest.dropOutgoingMessage(user_info, out, e == nil)
+		}
+	}
+
+	sent := 0
+	for _, status := range statuses {
+		if status.Status == DeliverySent {
+			sent++
+		}
+	}
+	// save consolidated delivery statuses back into draft
+	if !asIs {
+		statuses = append(alreadySent(draft), statuses...)
+	}
+	fields = map[string]interface{}{
+		"Delivery_status": statuses,
+	}
+	if !asIs && sent > 0 {
+		now := time.Now()
+		fields["Is_draft"] = false
+		fields["Date"] = now
+		fields["Date_sort"] = now
+		if emailSent != nil {
+			// attachments' temporary files have been consumed by email sending
+			if m, e := rest.store.RetrieveMessage(user_info.User_id, emailSent.Message_id.String()); e == nil {
+				fields["Attachments"] = m.Attachments
+				fields["External_references"] = m.External_references
+				fields["Raw_msg_id"] = m.Raw_msg_id
+				// delivery status notifications must update draft rather than outgoing message
+				if m.External_references.Message_id != "" {
+					e = rest.store.CreateMessageExternalRefLookup(draft.User_id, m.UserIdentities[0], draft.Message_id, m.External_references.Message_id)
+					if e != nil {
+						log.WithError(e).Warn("[SendDraft] failed to create external ref lookup")
+					}
+				}
+			}
+		}
+	}
+	if e := rest.store.UpdateMessage(draft, fields); e != nil {
+		log.WithError(e).Warn("[SendDraft] Store.UpdateMessage failed to save delivery statuses")
+	} else if e := rest.index.UpdateMessage(user_info, draft, fields); e != nil {
+		log.WithError(e).Warn("[SendDraft] Index.UpdateMessage failed to save delivery statuses")
+	}
+	if sent == 0 {
+		return nil, sendErr
+	}
 
+	msg, err = rest.store.RetrieveMessage(user_info.User_id, msg_id)
+	if err != nil {
+		return nil, err
+	}
+	messages.SanitizeMessageBodies(msg)
+	(*msg).Body_excerpt = messages.ExcerptMessage(*msg, 200, true, true)
+	return msg, err
+}
+
+// splitDraft groups draft's recipients by protocol and finds which user's identity to use for each protocol.
+// Recipients already reached by a previous sending are skipped.
+// Returned statuses are failures for recipients that can't be sent to.
+func (rest *RESTfacility) splitDraft(user_info *UserInfo, draft *Message) (outgoings []*outgoing, statuses []DeliveryStatus) {
+	sent := map[string]bool{}
+	for _, status := range alreadySent(draft) {
+		sent[status.Protocol+status.Address] = true
+	}
+	byProtocol := map[string][]Participant{}
+	protocols := []string{}
+	for _, rcpt := range recipientsOf(draft) {
+		protocol := protocolFamily(rcpt.Protocol)
+		if sent[protocol+rcpt.Address] {
+			continue
+		}
+		if _, ok := byProtocol[protocol]; !ok {
+			protocols = append(protocols, protocol)
+		}
+		byProtocol[protocol] = append(byProtocol[protocol], rcpt)
+	}
+	for _, protocol := range protocols {
+		identity, err := rest.senderIdentity(user_info.User_id, draft, protocol)
+		if err != nil {
+			out := outgoing{protocol: protocol, recipients: byProtocol[protocol]}
+			statuses = append(statuses, out.deliveryStatuses(err)...)
+			continue
+		}
+		switch protocol {
+		case TwitterProtocol:
+			// direct messages have only one recipient
+			for _, rcpt := range byProtocol[protocol] {
+				outgoings = append(outgoings, &outgoing{
+					identity:   identity,
+					protocol:   protocol,
+					recipients: []Participant{rcpt},
+				})
+			}
+		default:
+			outgoings = append(outgoings, &outgoing{
+				identity:   identity,
+				protocol:   protocol,
+				recipients: byProtocol[protocol],
+			})
+		}
+	}
+	return
+}
+
+// senderIdentity returns user's identity to use for sending to recipients with the given protocol :
+// the first draft's identity able to handle the protocol,
+// or, as a fallback, the first user's active identity able to handle it.
+func (rest *RESTfacility) senderIdentity(userId string, draft *Message, protocol string) (*UserIdentity, error) {
+	for _, id := range draft.UserIdentities {
+		identity, err := rest.RetrieveUserIdentity(userId, id.String(), false)
+		if err == nil && protocolFamily(identity.Protocol) == protocol {
+			return identity, nil
+		}
+	}
+	candidates := []*UserIdentity{}
+	if locals, err := rest.RetrieveLocalIdentities(userId); err == nil {
+		for i := range locals {
+			candidates = append(candidates, &locals[i])
+		}
+	}
+	if remotes, err := rest.RetrieveRemoteIdentities(userId, false); err == nil {
+		candidates = append(candidates, remotes...)
+	}
+	for _, identity := range candidates {
+		if identity.Status == "active" && protocolFamily(identity.Protocol) == protocol {
+			return identity, nil
+		}
+	}
+	return nil, fmt.Errorf("no identity available to send %s messages", protocol)
+}
+
+// buildOutgoingMessage saves a new draft, copied from original draft, with only outgoing recipients and identity
+func (rest *RESTfacility) buildOutgoingMessage(user_info *UserInfo, draft *Message, out *outgoing) error {
+	msg := *draft
+	msg.Message_id.UnmarshalBinary(uuid.NewV4().Bytes())
+	msg.Date_insert = time.Now()
+	msg.Delivery_status = nil
+	msg.Is_draft = true
+	msg.Send_at = time.Time{}
+	msg.UserIdentities = []UUID{out.identity.Id}
+	// recipients come first because some brokers pick recipient at first place
+	msg.Participants = append([]Participant{}, out.recipients...)
+	msg.Participants = append(msg.Participants, Participant{
+		Address:  out.identity.Identifier,
+		Label:    out.identity.DisplayName,
+		Protocol: out.protocol,
+		Type:     ParticipantFrom,
+	})
+	if out.protocol != EmailProtocol {
+		msg.Attachments = nil
+	}
+	if err := rest.store.CreateMessage(&msg); err != nil {
+		log.WithError(err).Warn("[SendDraft] failed to store outgoing message")
+		return err
+	}
+	if err := rest.index.CreateMessage(user_info, &msg); err != nil {
+		log.WithError(err).Warn("[SendDraft] failed to index outgoing message")
+		rest.store.DeleteMessage(&msg)
+		return err
+	}
+	out.message = &msg
+	return nil
+}
+
+// dropOutgoingMessage removes outgoing message from index once it has been processed, because draft stands for it.
+// Outgoing message is kept in store if it has been sent, as a reference of what has been sent to its recipients.
+func (rest *RESTfacility) dropOutgoingMessage(user_info *UserInfo, out *outgoing, sent bool) {
+	if out.message == nil {
+		return
+	}
+	if err := rest.index.DeleteMessage(user_info, out.message); err != nil {
+		log.WithError(err).Warnf("[SendDraft] failed to unindex outgoing message %s", out.message.Message_id.String())
+	}
+	if !sent {
+		if err := rest.store.DeleteMessage(out.message); err != nil {
+			log.WithError(err).Warnf("[SendDraft] failed to delete outgoing message %s", out.message.Message_id.String())
+		}
+	}
+}
+
+// deliver hands over outgoing message to the outbound worker of its identity's protocol and waits for delivery ack
+func (rest *RESTfacility) deliver(user_info *UserInfo, out *outgoing) error {
 	var natsTopic string
-	switch protocol {
+	switch out.identity.Protocol {
 	case EmailProtocol, ImapProtocol:
 		natsTopic = Nats_outIMAP_topicKey
-		order = BrokerOrder{
-			Order:      nats_order,
-			MessageId:  msg_id,
-			UserId:     user_info.User_id,
-			IdentityId: draft.UserIdentities[0].String(), // handle one identity only for now
-		}
 	case SmtpProtocol:
 		natsTopic = Nats_outSMTP_topicKey
-		order = BrokerOrder{
-			Order:      nats_order,
-			MessageId:  msg_id,
-			UserId:     user_info.User_id,
-			IdentityId: draft.UserIdentities[0].String(), // handle one identity only for now
-		}
 	case TwitterProtocol:
 		natsTopic = Nats_outTwitter_topicKey
-		order = BrokerOrder{
-			Order:      nats_order,
-			MessageId:  msg_id,
-			UserId:     user_info.User_id,
-			IdentityId: draft.UserIdentities[0].String(), // handle one identity for now
-		}
 	default:
-		return nil, fmt.Errorf("[SendDraft] no handler for <%s> protocol", protocol)
+		return fmt.Errorf("[SendDraft] no handler for <%s> protocol", out.identity.Protocol)
+	}
+	order := BrokerOrder{
+		Order:      "deliver",
+		MessageId:  out.message.Message_id.String(),
+		UserId:     user_info.User_id,
+		IdentityId: out.identity.Id.String(),
 	}
 	natsMessage, e := json.Marshal(order)
 	if e != nil {
 		log.WithError(e).Info("[SendDraft] failed to build nats message")
-		return nil, errors.New("[SendDraft] failed to build nats message")
+		return errors.New("[SendDraft] failed to build nats message")
 	}
 	rep, err := rest.nats_conn.Request(rest.natsTopics[natsTopic], natsMessage, 30*time.Second)
 	if err != nil {
 		log.WithError(err).Warn("[RESTfacility]: SendDraft error (1)")
 		if rest.nats_conn.LastError() != nil {
 			log.WithError(rest.nats_conn.LastError()).Warn("[RESTfacility]: SendDraft error")
-			return nil, err
 		}
-		return nil, err
+		return err
 	}
 
 	var reply DeliveryAck
 	err = json.Unmarshal(rep.Data, &reply)
 	if err != nil {
 		log.WithError(err).Warn("[RESTfacility]: SendDraft error (2)")
-		return nil, err
+		return err
 	}
 	if reply.Err {
 		log.Warn("[RESTfacility]: SendDraft error (3)")
-		return nil, errors.New(reply.Response)
+		return errors.New(reply.Response)
 	}
-	msg, err = rest.store.RetrieveMessage(user_info.User_id, msg_id)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// deliveryStatuses returns the status of each outgoing's recipient, regarding sending error
+func (out *outgoing) deliveryStatuses(sendErr error) (statuses []DeliveryStatus) {
+	now := time.Now()
+	for _, rcpt := range out.recipients {
+		status := DeliveryStatus{
+			Address:  rcpt.Address,
+			Date:     now,
+			Protocol: out.protocol,
+			Status:   DeliverySent,
+		}
+		if out.identity != nil {
+			status.IdentityId = out.identity.Id
+		}
+		if out.message != nil {
+			status.MessageId = out.message.Message_id
+		}
+		if sendErr != nil {
+			status.Status = DeliveryFailed
+			status.Error = sendErr.Error()
+		}
+		statuses = append(statuses, status)
 	}
-	messages.SanitizeMessageBodies(msg)
-	(*msg).Body_excerpt = messages.ExcerptMessage(*msg, 200, true, true)
-	return msg, err
+	return
 }
 
-// ResolveSenderProtocol returns outbound protocol to use for sending draft by resolving draft's sender identity
-func (rest *RESTfacility) ResolveSenderProtocol(draft *Message) (string, error) {
-	firstIdentity, err := rest.RetrieveUserIdentity(draft.User_id.String(), draft.UserIdentities[0].String(), false) // handle one identity only for now
-	if err != nil {
-		return "", err
+// recipientsOf returns draft's participants that message is sent to
+func recipientsOf(draft *Message) (recipients []Participant) {
+	for _, participant := range draft.Participants {
+		switch participant.Type {
+		case ParticipantTo, ParticipantCC, ParticipantBcc:
+			recipients = append(recipients, participant)
+		}
+	}
+	return
+}
+
+// alreadySent returns statuses of recipients reached by a previous sending of draft
+func alreadySent(draft *Message) (statuses []DeliveryStatus) {
+	for _, status := range draft.Delivery_status {
+		if status.Status == DeliverySent {
+			statuses = append(statuses, status)
+		}
+	}
+	return
+}
+
+// protocolFamily merges protocols that deliver to the same kind of recipients
+func protocolFamily(protocol string) string {
+	switch protocol {
+	case "", EmailProtocol, ImapProtocol, SmtpProtocol:
+		return EmailProtocol
+	default:
+		return protocol
 	}
-	return firstIdentity.Protocol, nil
 }
@@ -0,0 +1,240 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+func TestRecipientsOf(t *testing.T) {
+	draft := &Message{
+		Participants: []Participant{
+			{Address: "me@caliopen.local", Protocol: EmailProtocol, Type: ParticipantFrom},
+			{Address: "to@example.com", Protocol: EmailProtocol, Type: ParticipantTo},
+			{Address: "@cc", Protocol: TwitterProtocol, Type: ParticipantCC},
+			{Address: "bcc@example.com", Type: ParticipantBcc},
+			{Address: "me@caliopen.local", Protocol: EmailProtocol, Type: ParticipantReplyTo},
+		},
+	}
+	recipients := recipientsOf(draft)
+	if len(recipients) != 3 {
+		t.Fatalf("expected 3 recipients, got %+v", recipients)
+	}
+	for _, rcpt := range recipients {
+		if rcpt.Type == ParticipantFrom || rcpt.Type == ParticipantReplyTo {
+			t.Errorf("sender %s returned as recipient", rcpt.Address)
+		}
+	}
+}
+
+func TestProtocolFamily(t *testing.T) {
+	for protocol, family := range map[string]string{
+		"":              EmailProtocol,
+		EmailProtocol:   EmailProtocol,
+		ImapProtocol:    EmailProtocol,
+		SmtpProtocol:    EmailProtocol,
+		TwitterProtocol: TwitterProtocol,
+	} {
+		if got := protocolFamily(protocol); got != family {
+			t.Errorf("expected protocol <%s> to belong to <%s>, got <%s>", protocol, family, got)
+		}
+	}
+}
+
+func TestAlreadySent(t *testing.T) {
+	draft := &Message{
+		Delivery_status: []DeliveryStatus{
+			{Address: "to@example.com", Protocol: EmailProtocol, Status: DeliverySent},
+			{Address: "@dm", Protocol: TwitterProtocol, Status: DeliveryFailed, Error: "rate limited"},
+		},
+	}
+	sent := alreadySent(draft)
+	if len(sent) != 1 || sent[0].Address != "to@example.com" {
+		t.Errorf("expected only to@example.com to be already sent, got %+v", sent)
+	}
+}
+
+func TestOutgoing_deliveryStatuses(t *testing.T) {
+	out := outgoing{
+		protocol: TwitterProtocol,
+		recipients: []Participant{
+			{Address: "@first", Protocol: TwitterProtocol, Type: ParticipantTo},
+			{Address: "@second", Protocol: TwitterProtocol, Type: ParticipantTo},
+		},
+	}
+	statuses := out.deliveryStatuses(errors.New("no identity available"))
+	if len(statuses) != 2 {
+		t.Fatalf("expected one status per recipient, got %+v", statuses)
+	}
+	for _, status := range statuses {
+		if status.Status != DeliveryFailed || status.Error != "no identity available" {
+			t.Errorf("expected failed status with error, got %+v", status)
+		}
+	}
+	for _, status := range out.deliveryStatuses(nil) {
+		if status.Status != DeliverySent || status.Error != "" {
+			t.Errorf("expected sent status without error, got %+v", status)
+		}
+	}
+}
+
+// sendTestStore serves user's identities and records messages written by draft sending
+type sendTestStore struct {
+	backendstest.APIStore
+	locals  []UserIdentity
+	remotes []*UserIdentity
+	created *[]*Message
+	deleted *[]*Message
+	updates *[]map[string]interface{}
+}
+
+func (ss sendTestStore) RetrieveLocalsIdentities(userId string) ([]UserIdentity, error) {
+	return ss.locals, nil
+}
+func (ss sendTestStore) RetrieveRemoteIdentities(userId string, withCredentials bool) ([]*UserIdentity, error) {
+	return ss.remotes, nil
+}
+func (ss sendTestStore) RetrieveUserIdentity(userId, identityId string, withCredentials bool) (*UserIdentity, error) {
+	for i := range ss.locals {
+		if ss.locals[i].Id.String() == identityId {
+			return &ss.locals[i], nil
+		}
+	}
+	for _, remote := range ss.remotes {
+		if remote.Id.String() == identityId {
+			return remote, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (ss sendTestStore) GetOrCreateDiscussion(userId UUID, participants []Participant) (*Discussion, error) {
+	return &Discussion{Discussion_id: UUID(uuid.NewV4())}, nil
+}
+func (ss sendTestStore) CreateMessage(msg *Message) error {
+	*ss.created = append(*ss.created, msg)
+	return nil
+}
+func (ss sendTestStore) UpdateMessage(msg *Message, fields map[string]interface{}) error {
+	*ss.updates = append(*ss.updates, fields)
+	return nil
+}
+func (ss sendTestStore) DeleteMessage(msg *Message) error {
+	*ss.deleted = append(*ss.deleted, msg)
+	return nil
+}
+
+type sendTestIndex struct {
+	backends.APIIndex
+}
+
+func (si sendTestIndex) CreateMessage(user *UserInfo, msg *Message) error {
+	return nil
+}
+func (si sendTestIndex) UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error {
+	return nil
+}
+func (si sendTestIndex) DeleteMessage(user *UserInfo, msg *Message) error {
+	return nil
+}
+
+func newSendTestRest(locals []UserIdentity, remotes []*UserIdentity) (*RESTfacility, sendTestStore) {
+	store := sendTestStore{
+		locals:  locals,
+		remotes: remotes,
+		created: &[]*Message{},
+		deleted: &[]*Message{},
+		updates: &[]map[string]interface{}{},
+	}
+	rest := new(RESTfacility)
+	rest.store = store
+	rest.index = sendTestIndex{}
+	return rest, store
+}
+
+func TestRESTfacility_splitDraft(t *testing.T) {
+	local := UserIdentity{Id: UUID(uuid.NewV4()), Identifier: "me@caliopen.local", Protocol: EmailProtocol, Status: "active"}
+	twitter := &UserIdentity{Id: UUID(uuid.NewV4()), Identifier: "@me", Protocol: TwitterProtocol, Status: "active"}
+	inactive := &UserIdentity{Id: UUID(uuid.NewV4()), Identifier: "me@mastodon.example", Protocol: "mastodon", Status: "inactive"}
+	rest, _ := newSendTestRest([]UserIdentity{local}, []*UserIdentity{twitter, inactive})
+	user := &UserInfo{User_id: uuid.NewV4().String()}
+
+	draft := &Message{
+		UserIdentities: []UUID{local.Id},
+		Participants: []Participant{
+			{Address: "me@caliopen.local", Protocol: EmailProtocol, Type: ParticipantFrom},
+			{Address: "to@example.com", Protocol: EmailProtocol, Type: ParticipantTo},
+			{Address: "cc@example.com", Protocol: SmtpProtocol, Type: ParticipantCC},
+			{Address: "sent@example.com", Protocol: EmailProtocol, Type: ParticipantTo},
+			{Address: "@first", Protocol: TwitterProtocol, Type: ParticipantTo},
+			{Address: "@second", Protocol: TwitterProtocol, Type: ParticipantTo},
+			{Address: "friend@mastodon.example", Protocol: "mastodon", Type: ParticipantTo},
+		},
+		Delivery_status: []DeliveryStatus{
+			{Address: "sent@example.com", Protocol: EmailProtocol, Status: DeliverySent},
+		},
+	}
+	outgoings, statuses := rest.splitDraft(user, draft)
+	if len(outgoings) != 3 {
+		t.Fatalf("expected one email and two direct messages, got %d outgoings", len(outgoings))
+	}
+	email := outgoings[0]
+	if email.protocol != EmailProtocol || email.identity.Id != local.Id || len(email.recipients) != 2 {
+		t.Errorf("expected email to the 2 recipients not sent yet through draft's identity, got %+v", email)
+	}
+	for _, dm := range outgoings[1:] {
+		if dm.protocol != TwitterProtocol || dm.identity.Id != twitter.Id || len(dm.recipients) != 1 {
+			t.Errorf("expected one direct message per twitter recipient through user's twitter identity, got %+v", dm)
+		}
+	}
+	if len(statuses) != 1 || statuses[0].Address != "friend@mastodon.example" || statuses[0].Status != DeliveryFailed {
+		t.Errorf("expected recipient without active identity for its protocol to fail, got %+v", statuses)
+	}
+}
+
+func TestRESTfacility_sendDraft(t *testing.T) {
+	mastodon := &UserIdentity{Id: UUID(uuid.NewV4()), Identifier: "me@mastodon.example", Protocol: "mastodon", Status: "active"}
+	user := &UserInfo{User_id: uuid.NewV4().String()}
+	draft := &Message{
+		Message_id: UUID(uuid.NewV4()),
+		Is_draft:   true,
+		Participants: []Participant{
+			{Address: "friend@mastodon.example", Protocol: "mastodon", Type: ParticipantTo},
+		},
+	}
+
+	rest, store := newSendTestRest(nil, nil)
+	if _, err := rest.sendDraft(user, draft); err == nil {
+		t.Error("expected draft without identity to send it to fail")
+	}
+	if len(*store.updates) != 0 || len(*store.created) != 0 {
+		t.Error("expected draft that can't be sent to be left untouched")
+	}
+
+	// outbound worker can't be found for protocol : outgoing message is built, then dropped
+	rest, store = newSendTestRest(nil, []*UserIdentity{mastodon})
+	if _, err := rest.sendDraft(user, draft); err == nil {
+		t.Error("expected draft sending to fail")
+	}
+	if len(*store.created) != 1 || len(*store.deleted) != 1 || (*store.created)[0] != (*store.deleted)[0] {
+		t.Fatal("expected outgoing message to be created then deleted")
+	}
+	out := (*store.created)[0]
+	if out.Message_id == draft.Message_id || len(out.UserIdentities) != 1 || out.UserIdentities[0] != mastodon.Id {
+		t.Errorf("expected outgoing message to be a copy of draft sent through user's identity, got %+v", out)
+	}
+	last := (*store.updates)[len(*store.updates)-1]
+	statuses, _ := last["Delivery_status"].([]DeliveryStatus)
+	if len(statuses) != 1 || statuses[0].Status != DeliveryFailed || statuses[0].Address != "friend@mastodon.example" {
+		t.Errorf("expected failed delivery status to be saved into draft, got %+v", last)
+	}
+	if _, ok := last["Is_draft"]; ok {
+		t.Error("expected draft to remain a draft when nothing has been sent")
+	}
+}
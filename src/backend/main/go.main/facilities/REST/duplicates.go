@@ -0,0 +1,434 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	log "github.com/Sirupsen/logrus"
+	"github.com/satori/go.uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// label given to keys moved from a merged contact, if they had none
+const mergeKeyLabel = "merge"
+
+// DuplicateContacts is a pair of contacts that are likely to be the same person.
+// Contacts[0] is the one suggested to be kept when merging them : user's own contact card or the oldest one.
+type DuplicateContacts struct {
+	Contacts       [2]*Contact
+	ContactPoints  []ContactByContactPoints // emails, phones, ims and social identities shared by contacts
+	NameSimilarity float64                  // set only if names are similar enough
+}
+
+// RetrieveDuplicateContacts returns pairs of user's contacts that share contact points or have similar names,
+// the most likely duplicates first.
+func (rest *RESTfacility) RetrieveDuplicateContacts(userId string) ([]*DuplicateContacts, CaliopenError) {
+	all, err := rest.store.RetrieveUserContacts(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] failed to retrieve user's contacts")
+	}
+	contacts := []*Contact{}
+	for contact := range all {
+		if contact.Deleted.IsZero() {
+			contacts = append(contacts, contact)
+		}
+	}
+	lookups, err := rest.store.RetrieveContactLookups(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] failed to retrieve user's contact points")
+	}
+	return findDuplicates(contacts, lookups, rest.store.RetrieveUserContactId(userId)), nil
+}
+
+// MergeContacts merges contact otherId into contact contactId, then deletes contact otherId.
+// Participants of messages that referenced otherId reference contactId afterwards,
+// once they have been rewritten in background.
+// User's own contact card can't be merged into another contact, whereas other contacts can be merged into it.
+func (rest *RESTfacility) MergeContacts(user *UserInfo, contactId, otherId string) (*Contact, CaliopenError) {
+	if contactId == otherId {
+		return nil, NewCaliopenErr(UnprocessableCaliopenErr, "[RESTfacility] can't merge a contact with itself")
+	}
+	if rest.store.RetrieveUserContactId(user.User_id) == otherId {
+		return nil, NewCaliopenErr(ForbiddenCaliopenErr, "[RESTfacility] contact card related to user can't be merged into another contact")
+	}
+	contact, err := rest.retrieveMergeableContact(user.User_id, contactId)
+	if err != nil {
+		return nil, err
+	}
+	other, err := rest.retrieveMergeableContact(user.User_id, otherId)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, modifiedFields := mergeContact(contact, other)
+	if len(modifiedFields) > 0 {
+		if e := rest.UpdateContact(user, merged, contact, modifiedFields); e != nil {
+			return nil, WrapCaliopenErr(e, FailDependencyCaliopenErr, "[RESTfacility] MergeContacts failed to update contact")
+		}
+	}
+	rest.addContactKeys(merged, other.PublicKeys, mergeKeyLabel)
+
+	// messages are rewritten out of request, other contact is kept until they are
+	go rest.completeContactsMerge(user, other, merged.ContactId)
+	return merged, nil
+}
+
+// completeContactsMerge moves messages' participants from contact other to contact to, then deletes contact other.
+// Other contact is kept as long as messages may reference it, thus merge can be retried if it fails midway.
+func (rest *RESTfacility) completeContactsMerge(user *UserInfo, other *Contact, to UUID) {
+	otherId := other.ContactId.String()
+	if err := rest.moveParticipantsContact(user, other.ContactId, to); err != nil {
+		log.WithError(err).Errorf("[RESTfacility] merge of contact %s into %s failed to move participants", otherId, to.String())
+		return
+	}
+	if e := rest.DeleteContact(user.User_id, otherId); e != nil {
+		log.WithError(e).Errorf("[RESTfacility] merge of contact %s into %s failed to delete merged contact", otherId, to.String())
+		return
+	}
+	for i := range other.PublicKeys {
+		if e := rest.store.DeletePubKey(&other.PublicKeys[i]); e != nil {
+			log.WithError(e).Warnf("[RESTfacility] merge failed to delete key %s of merged contact %s", other.PublicKeys[i].KeyId.String(), otherId)
+		}
+	}
+}
+
+// retrieveMergeableContact returns a contact that is not deleted, with its PGP keys
+func (rest *RESTfacility) retrieveMergeableContact(userId, contactId string) (*Contact, CaliopenError) {
+	contact, err := rest.store.RetrieveContact(userId, contactId)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] contact %s not found", contactId)
+		}
+		return nil, WrapCaliopenErrf(err, DbCaliopenErr, "[RESTfacility] failed to retrieve contact %s", contactId)
+	}
+	if !contact.Deleted.IsZero() {
+		return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] contact %s not found", contactId)
+	}
+	rest.loadContactKeys(contact)
+	return contact, nil
+}
+
+// moveParticipantsContact rewrites participants of user's messages that reference contact from,
+// for them to reference contact to instead.
+// Discussions' lookups are moved along, as they are computed from participants' first contact.
+func (rest *RESTfacility) moveParticipantsContact(user *UserInfo, from, to UUID) CaliopenError {
+	messageIds, err := rest.index.FindMessagesByContact(user, from.String())
+	if err != nil {
+		return WrapCaliopenErr(err, IndexCaliopenErr, "[RESTfacility] failed to find messages of merged contact")
+	}
+	userId := UUID(uuid.FromStringOrNil(user.User_id))
+	failed := 0
+	for _, messageId := range messageIds {
+		msg, err := rest.store.RetrieveMessage(user.User_id, messageId)
+		if err != nil {
+			log.WithError(err).Warnf("[RESTfacility] failed to retrieve message %s to update its participants", messageId)
+			failed++
+			continue
+		}
+		before := append([]Participant{}, msg.Participants...)
+		if !replaceParticipantsContact(msg, from, to) {
+			continue
+		}
+		// lookup is moved first : it can't be found anymore from message's participants once they are updated
+		if err = rest.store.MoveDiscussionLookup(userId, before, msg.Participants); err != nil {
+			log.WithError(err).Warnf("[RESTfacility] failed to move discussion lookup of message %s", messageId)
+			failed++
+			continue
+		}
+		fields := map[string]interface{}{"Participants": msg.Participants}
+		if err = rest.store.UpdateMessage(msg, fields); err == nil {
+			err = rest.index.UpdateMessage(user, msg, fields)
+		}
+		if err != nil {
+			log.WithError(err).Warnf("[RESTfacility] failed to update participants of message %s", messageId)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return NewCaliopenErrf(FailDependencyCaliopenErr, "[RESTfacility] failed to update participants of %d messages", failed)
+	}
+	return nil
+}
+
+// replaceParticipantsContact replaces contact from by contact to within message's participants.
+// It returns false if no participant referenced contact from.
+func replaceParticipantsContact(msg *Message, from, to UUID) bool {
+	replaced := false
+	for i, participant := range msg.Participants {
+		contactIds := []UUID{}
+		found := false
+		for _, id := range participant.Contact_ids {
+			if id == from {
+				found, id = true, to
+			}
+			duplicate := false
+			for _, kept := range contactIds {
+				if kept == id {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				contactIds = append(contactIds, id)
+			}
+		}
+		if found {
+			msg.Participants[i].Contact_ids = contactIds
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+// findDuplicates pairs contacts sharing a contact point or having similar names
+func findDuplicates(contacts []*Contact, lookups []ContactByContactPoints, userContactId string) []*DuplicateContacts {
+	byId := map[string]*Contact{}
+	for _, contact := range contacts {
+		byId[contact.ContactId.String()] = contact
+	}
+	pairs := map[[2]string]*DuplicateContacts{}
+	pair := func(a, b *Contact) *DuplicateContacts {
+		if keepSecond(a, b, userContactId) {
+			a, b = b, a
+		}
+		key := [2]string{a.ContactId.String(), b.ContactId.String()}
+		if _, found := pairs[key]; !found {
+			pairs[key] = &DuplicateContacts{Contacts: [2]*Contact{a, b}, ContactPoints: []ContactByContactPoints{}}
+		}
+		return pairs[key]
+	}
+
+	for _, lookup := range lookups {
+		// lookups may still reference contacts that have been deleted
+		sharing := []*Contact{}
+		seen := map[string]bool{}
+		for _, id := range lookup.ContactIDs {
+			if contact, found := byId[id]; found && !seen[id] {
+				sharing = append(sharing, contact)
+				seen[id] = true
+			}
+		}
+		for i := range sharing {
+			for j := i + 1; j < len(sharing); j++ {
+				duplicate := pair(sharing[i], sharing[j])
+				duplicate.ContactPoints = append(duplicate.ContactPoints, ContactByContactPoints{Type: lookup.Type, Value: lookup.Value})
+			}
+		}
+	}
+
+	// only compare names of contacts that have at least one name word in common
+	words := make([][]string, len(contacts))
+	byWord := map[string][]int{}
+	for i, contact := range contacts {
+		words[i] = helpers.ContactNameWords(contact)
+		for _, word := range words[i] {
+			byWord[word] = append(byWord[word], i)
+		}
+	}
+	for i := range contacts {
+		compared := map[int]bool{}
+		for _, word := range words[i] {
+			for _, j := range byWord[word] {
+				if j <= i || compared[j] {
+					continue
+				}
+				compared[j] = true
+				if similarity := helpers.NameSimilarity(words[i], words[j]); similarity >= helpers.DuplicateNameThreshold {
+					pair(contacts[i], contacts[j]).NameSimilarity = similarity
+				}
+			}
+		}
+	}
+
+	duplicates := []*DuplicateContacts{}
+	for _, duplicate := range pairs {
+		duplicates = append(duplicates, duplicate)
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		a, b := duplicates[i], duplicates[j]
+		if len(a.ContactPoints) != len(b.ContactPoints) {
+			return len(a.ContactPoints) > len(b.ContactPoints)
+		}
+		if a.NameSimilarity != b.NameSimilarity {
+			return a.NameSimilarity > b.NameSimilarity
+		}
+		return a.Contacts[0].ContactId.String()+a.Contacts[1].ContactId.String() < b.Contacts[0].ContactId.String()+b.Contacts[1].ContactId.String()
+	})
+	return duplicates
+}
+
+// keepSecond tells if contact b, rather than a, should be kept when merging them
+func keepSecond(a, b *Contact, userContactId string) bool {
+	switch {
+	case a.ContactId.String() == userContactId:
+		return false
+	case b.ContactId.String() == userContactId:
+		return true
+	case !a.DateInsert.Equal(b.DateInsert):
+		return b.DateInsert.Before(a.DateInsert)
+	}
+	return b.ContactId.String() < a.ContactId.String()
+}
+
+// mergeContact returns a copy of contact completed with other's properties, and the modified fields to be saved.
+// Contact's names are kept, unless it has none.
+func mergeContact(contact, other *Contact) (*Contact, map[string]interface{}) {
+	merged := *contact
+	modifiedFields := map[string]interface{}{}
+
+	if len(helpers.ContactNameWords(contact)) == 0 && len(helpers.ContactNameWords(other)) > 0 {
+		merged.NamePrefix = other.NamePrefix
+		merged.GivenName = other.GivenName
+		merged.AdditionalName = other.AdditionalName
+		merged.FamilyName = other.FamilyName
+		merged.NameSuffix = other.NameSuffix
+		helpers.ComputeTitle(&merged)
+		modifiedFields["NamePrefix"] = merged.NamePrefix
+		modifiedFields["GivenName"] = merged.GivenName
+		modifiedFields["AdditionalName"] = merged.AdditionalName
+		modifiedFields["FamilyName"] = merged.FamilyName
+		modifiedFields["NameSuffix"] = merged.NameSuffix
+		modifiedFields["Title"] = merged.Title
+	}
+	if merged.Avatar == "" && other.Avatar != "" {
+		merged.Avatar = other.Avatar
+		modifiedFields["Avatar"] = merged.Avatar
+	}
+
+	emails := map[string]bool{}
+	for _, email := range contact.Emails {
+		emails[strings.ToLower(email.Address)] = true
+	}
+	for _, email := range other.Emails {
+		if !emails[strings.ToLower(email.Address)] {
+			emails[strings.ToLower(email.Address)] = true
+			email.IsPrimary = false
+			merged.Emails = append(append([]EmailContact{}, merged.Emails...), email)
+			modifiedFields["Emails"] = merged.Emails
+		}
+	}
+	phones := map[string]bool{}
+	for _, phone := range contact.Phones {
+		phones[phoneKey(phone)] = true
+	}
+	for _, phone := range other.Phones {
+		if !phones[phoneKey(phone)] {
+			phones[phoneKey(phone)] = true
+			phone.IsPrimary = false
+			merged.Phones = append(append([]Phone{}, merged.Phones...), phone)
+			modifiedFields["Phones"] = merged.Phones
+		}
+	}
+	identities := map[string]bool{}
+	for _, identity := range contact.Identities {
+		identities[identity.Type+":"+strings.ToLower(identity.Name)] = true
+	}
+	for _, identity := range other.Identities {
+		if key := identity.Type + ":" + strings.ToLower(identity.Name); !identities[key] {
+			identities[key] = true
+			merged.Identities = append(append([]SocialIdentity{}, merged.Identities...), identity)
+			modifiedFields["Identities"] = merged.Identities
+		}
+	}
+	ims := map[string]bool{}
+	for _, im := range contact.Ims {
+		ims[im.Protocol+":"+strings.ToLower(im.Address)] = true
+	}
+	for _, im := range other.Ims {
+		if key := im.Protocol + ":" + strings.ToLower(im.Address); !ims[key] {
+			ims[key] = true
+			im.IsPrimary = false
+			merged.Ims = append(append([]IM{}, merged.Ims...), im)
+			modifiedFields["Ims"] = merged.Ims
+		}
+	}
+	addresses := map[string]bool{}
+	for _, address := range contact.Addresses {
+		addresses[addressKey(address)] = true
+	}
+	for _, address := range other.Addresses {
+		if !addresses[addressKey(address)] {
+			addresses[addressKey(address)] = true
+			address.IsPrimary = false
+			merged.Addresses = append(append([]PostalAddress{}, merged.Addresses...), address)
+			modifiedFields["Addresses"] = merged.Addresses
+		}
+	}
+	organizations := map[string]bool{}
+	for _, organization := range contact.Organizations {
+		organizations[strings.ToLower(organization.Name+"\n"+organization.Department)] = true
+	}
+	for _, organization := range other.Organizations {
+		if key := strings.ToLower(organization.Name + "\n" + organization.Department); !organizations[key] {
+			organizations[key] = true
+			organization.IsPrimary = false
+			merged.Organizations = append(append([]Organization{}, merged.Organizations...), organization)
+			modifiedFields["Organizations"] = merged.Organizations
+		}
+	}
+	if groups, added := unionStrings(contact.Groups, other.Groups); added {
+		merged.Groups = groups
+		modifiedFields["Groups"] = merged.Groups
+	}
+	if tags, added := unionStrings(contact.Tags, other.Tags); added {
+		merged.Tags = tags
+		modifiedFields["Tags"] = merged.Tags
+	}
+	for key, value := range other.Infos {
+		// cards' identifiers belong to the contact they have been given to
+		if key == CardDAVNameInfo || key == helpers.VCardUidInfo {
+			continue
+		}
+		if _, found := contact.Infos[key]; !found {
+			if _, copied := modifiedFields["Infos"]; !copied {
+				merged.Infos = map[string]string{}
+				for k, v := range contact.Infos {
+					merged.Infos[k] = v
+				}
+				modifiedFields["Infos"] = merged.Infos
+			}
+			merged.Infos[key] = value
+		}
+	}
+
+	if len(modifiedFields) > 0 {
+		merged.DateUpdate = time.Now()
+		modifiedFields["DateUpdate"] = merged.DateUpdate
+	}
+	return &merged, modifiedFields
+}
+
+func phoneKey(phone Phone) string {
+	if phone.NormalizedNumber != "" {
+		return phone.NormalizedNumber
+	}
+	return phone.Number
+}
+
+func addressKey(address PostalAddress) string {
+	return strings.ToLower(strings.Join([]string{address.Street, address.PostalCode, address.City, address.Region, address.Country}, "\n"))
+}
+
+// unionStrings returns values of a followed by values of b that are not in a,
+// and whether values have been added to a
+func unionStrings(a, b []string) ([]string, bool) {
+	union := append([]string{}, a...)
+	for _, value := range b {
+		found := false
+		for _, existing := range union {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			union = append(union, value)
+		}
+	}
+	return union, len(union) > len(a)
+}
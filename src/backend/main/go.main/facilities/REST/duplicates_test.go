@@ -0,0 +1,170 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+func newTestContact(title string, inserted time.Time) *Contact {
+	return &Contact{ContactId: UUID(uuid.NewV4()), DateInsert: inserted, Title: title}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	now := time.Now()
+	jean := newTestContact("Jean Dupont", now)
+	jean.GivenName, jean.FamilyName = "Jean", "Dupont"
+	jeanFromMail := newTestContact("jean@example.com", now.Add(-time.Hour))
+	dupond := newTestContact("Jean Dupond", now.Add(time.Hour))
+	dupond.GivenName, dupond.FamilyName = "Jean", "Dupond"
+	paul := newTestContact("Paul", now)
+	paul.GivenName = "Paul"
+	deletedId := uuid.NewV4().String()
+
+	lookups := []ContactByContactPoints{
+		{Type: "email", Value: "jean@example.com", ContactIDs: []string{jean.ContactId.String(), jeanFromMail.ContactId.String(), deletedId}},
+		{Type: "phone", Value: "+33 6 12 34 56 78", ContactIDs: []string{jeanFromMail.ContactId.String(), jean.ContactId.String()}},
+		{Type: "email", Value: "paul@example.com", ContactIDs: []string{paul.ContactId.String(), deletedId}},
+	}
+	duplicates := findDuplicates([]*Contact{jean, jeanFromMail, dupond, paul}, lookups, paul.ContactId.String())
+
+	if len(duplicates) != 2 {
+		t.Fatalf("expected 2 duplicates, got %d", len(duplicates))
+	}
+	if duplicates[0].Contacts != [2]*Contact{jeanFromMail, jean} || len(duplicates[0].ContactPoints) != 2 || duplicates[0].NameSimilarity != 0 {
+		t.Errorf("expected contacts sharing points to come first, oldest one to be kept, got %+v", duplicates[0])
+	}
+	if duplicates[1].Contacts != [2]*Contact{jean, dupond} || len(duplicates[1].ContactPoints) != 0 || duplicates[1].NameSimilarity < 0.85 {
+		t.Errorf("expected contacts with similar names to be paired, got %+v", duplicates[1])
+	}
+
+	// user's own contact card is always the one to keep
+	duplicates = findDuplicates([]*Contact{jean, jeanFromMail}, lookups, jean.ContactId.String())
+	if len(duplicates) != 1 || duplicates[0].Contacts[0] != jean {
+		t.Errorf("expected user's contact to be kept, got %+v", duplicates)
+	}
+}
+
+func TestMergeContact(t *testing.T) {
+	contact := &Contact{
+		ContactId:  UUID(uuid.NewV4()),
+		Emails:     []EmailContact{{Address: "jean@example.com", IsPrimary: true}},
+		Identities: []SocialIdentity{{Name: "jdupont", Type: TwitterProtocol}},
+		Infos:      map[string]string{CardDAVNameInfo: "jean.vcf"},
+		Tags:       []string{"friends"},
+		Title:      "jean@example.com",
+	}
+	other := &Contact{
+		ContactId:  UUID(uuid.NewV4()),
+		Emails:     []EmailContact{{Address: "Jean@Example.com"}, {Address: "jdupont@work.example", IsPrimary: true}},
+		FamilyName: "Dupont",
+		GivenName:  "Jean",
+		Identities: []SocialIdentity{{Name: "JDupont", Type: TwitterProtocol}, {Name: "jdupont", Type: "mastodon"}},
+		Infos:      map[string]string{CardDAVNameInfo: "other.vcf", "birthday": "1970-01-01"},
+		Phones:     []Phone{{Number: "06 12 34 56 78", NormalizedNumber: "+33 6 12 34 56 78"}},
+		Tags:       []string{"work", "friends"},
+	}
+	merged, fields := mergeContact(contact, other)
+
+	if len(merged.Emails) != 2 || merged.Emails[1].Address != "jdupont@work.example" || merged.Emails[1].IsPrimary {
+		t.Errorf("expected new emails to be added as secondary ones, got %+v", merged.Emails)
+	}
+	if len(merged.Identities) != 2 || len(merged.Phones) != 1 {
+		t.Errorf("expected identities and phones to be unioned, got %+v %+v", merged.Identities, merged.Phones)
+	}
+	if len(merged.Tags) != 2 || merged.Tags[1] != "work" {
+		t.Errorf("expected tags to be unioned, got %v", merged.Tags)
+	}
+	if merged.Infos[CardDAVNameInfo] != "jean.vcf" || merged.Infos["birthday"] != "1970-01-01" {
+		t.Errorf("unexpected infos %v", merged.Infos)
+	}
+	if merged.Title != "Jean Dupont" || fields["GivenName"] != "Jean" {
+		t.Errorf("expected names to be taken from other contact, got %s", merged.Title)
+	}
+	for _, field := range []string{"Emails", "Identities", "Phones", "Tags", "Infos", "Title", "DateUpdate"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("expected %s to be in modified fields", field)
+		}
+	}
+	if len(contact.Emails) != 1 || len(contact.Tags) != 1 || len(contact.Infos) != 1 {
+		t.Error("expected original contact to be left untouched")
+	}
+
+	if _, fields = mergeContact(other, contact); len(fields) != 0 {
+		t.Errorf("expected nothing to be merged, got %v", fields)
+	}
+}
+
+type mergeTestIndex struct {
+	backends.APIIndex
+	messageIds []string
+}
+
+func (mi mergeTestIndex) FindMessagesByContact(user *UserInfo, contactId string) ([]string, error) {
+	return mi.messageIds, nil
+}
+func (mi mergeTestIndex) UpdateMessage(user *UserInfo, msg *Message, fields map[string]interface{}) error {
+	return nil
+}
+
+func TestRESTfacility_MergeContacts(t *testing.T) {
+	userId := UUID(uuid.NewV4())
+	user := &UserInfo{User_id: userId.String(), Shard_id: "shard"}
+	store := backendstest.NewFakeStore()
+	store.UserContacts[user.User_id] = uuid.NewV4().String()
+	rest := new(RESTfacility)
+	rest.store = store
+
+	contactId := uuid.NewV4().String()
+	if _, err := rest.MergeContacts(user, contactId, contactId); err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected contact not to be merged with itself, got %v", err)
+	}
+	if _, err := rest.MergeContacts(user, contactId, store.UserContacts[user.User_id]); err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected user's contact card merge to be forbidden, got %v", err)
+	}
+	if _, err := rest.MergeContacts(user, store.UserContacts[user.User_id], contactId); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected unknown contact not to be merged, got %v", err)
+	}
+
+	from, to, other := UUID(uuid.NewV4()), UUID(uuid.NewV4()), UUID(uuid.NewV4())
+	referencing := &Message{Message_id: UUID(uuid.NewV4()), User_id: userId, Participants: []Participant{
+		{Address: "jean@example.com", Contact_ids: []UUID{from}},
+		{Address: "paul@example.com", Contact_ids: []UUID{other}},
+		{Address: "jean@work.example", Contact_ids: []UUID{to, from}},
+	}}
+	unrelated := &Message{Message_id: UUID(uuid.NewV4()), User_id: userId, Participants: []Participant{{Contact_ids: []UUID{other}}}}
+	store.Messages = []*Message{referencing, unrelated}
+	rest.index = mergeTestIndex{messageIds: []string{referencing.Message_id.String(), unrelated.Message_id.String()}}
+
+	if err := rest.moveParticipantsContact(user, from, to); err != nil {
+		t.Fatalf("expected participants to be moved, got %v", err)
+	}
+	updated := store.CallsTo("UpdateMessage")
+	if len(updated) != 1 || updated[0].Args[0].(*Message).Message_id != referencing.Message_id {
+		t.Fatalf("expected only referencing message to be updated, got %d updates", len(updated))
+	}
+	participants := store.Messages[0].Participants
+	if participants[0].Contact_ids[0] != to || participants[1].Contact_ids[0] != other || len(participants[2].Contact_ids) != 1 {
+		t.Errorf("unexpected participants %+v", participants)
+	}
+	moves := store.CallsTo("MoveDiscussionLookup")
+	if len(moves) != 1 {
+		t.Fatalf("expected discussion lookup of referencing message to be moved, got %d moves", len(moves))
+	}
+	before, after := moves[0].Args[1].([]Participant), moves[0].Args[2].([]Participant)
+	if before[0].Contact_ids[0] != from || after[0].Contact_ids[0] != to {
+		t.Errorf("expected lookup to be moved from participants before replacement to participants after it, got %+v and %+v", before, after)
+	}
+
+	rest.index = mergeTestIndex{messageIds: []string{uuid.NewV4().String()}}
+	if err := rest.moveParticipantsContact(user, from, to); err == nil || err.Code() != FailDependencyCaliopenErr {
+		t.Errorf("expected missing message to fail participants move, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
+	log "github.com/Sirupsen/logrus"
+	"github.com/renstrom/shortuuid"
+	"github.com/satori/go.uuid"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	exportBuildTimeout    = time.Hour        // pending export is given up after this delay
+	exportDefaultLinkTTL  = 48               // hours
+	exportsCleanInterval  = 10 * time.Minute // delay between scans for expired exports
+	exportsCleanBatchSize = 100
+)
+
+// RequestUserExport starts building an archive of all user's data in background.
+// User is notified with a download link once archive is ready.
+// Only one export could be pending at a time.
+func (rest *RESTfacility) RequestUserExport(userId string, notifier Notifications.Notifiers) (*UserExport, CaliopenError) {
+	if previous, err := rest.Cache.GetUserExport(userId); err == nil && previous.Status == ExportPending {
+		return nil, NewCaliopenErrf(ForbiddenCaliopenErr, "[RESTfacility] export %s is already in progress", previous.ExportId)
+	}
+	now := time.Now()
+	export := &UserExport{
+		DateInsert: now,
+		ExpiresAt:  now.Add(exportBuildTimeout),
+		ExportId:   uuid.NewV4().String(),
+		Status:     ExportPending,
+		UserId:     userId,
+	}
+	err := rest.Cache.SetUserExport(export)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, FailDependencyCaliopenErr, "[RESTfacility] RequestUserExport failed to cache export")
+	}
+	go rest.buildUserExport(export, notifier)
+	return export, nil
+}
+
+// RetrieveUserExport returns user's last export, if it has not expired yet
+func (rest *RESTfacility) RetrieveUserExport(userId string) (*UserExport, CaliopenError) {
+	export, err := rest.Cache.GetUserExport(userId)
+	if err != nil || export == nil {
+		return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] no export found for user %s", userId)
+	}
+	return export, nil
+}
+
+// OpenUserExport returns the export referenced by a download token, with a reader on its archive
+func (rest *RESTfacility) OpenUserExport(token string) (*UserExport, io.Reader, CaliopenError) {
+	export, err := rest.Cache.GetUserExportByToken(token)
+	if err != nil || export == nil || export.Status != ExportReady {
+		return nil, nil, NewCaliopenErr(NotFoundCaliopenErr, "[RESTfacility] export not found or expired")
+	}
+	archive, err := rest.store.GetUserExport(export.Uri)
+	if err != nil {
+		return nil, nil, WrapCaliopenErrf(err, DbCaliopenErr, "[RESTfacility] OpenUserExport failed to get archive of export %s", export.ExportId)
+	}
+	return export, archive, nil
+}
+
+// StartExportsCleaner periodically removes expired archives from object store.
+func (rest *RESTfacility) StartExportsCleaner() {
+	go func() {
+		ticker := time.NewTicker(exportsCleanInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rest.removeExpiredExports(time.Now())
+		}
+	}()
+}
+
+func (rest *RESTfacility) removeExpiredExports(until time.Time) {
+	uris, err := rest.Cache.ExpiredUserExports(until, exportsCleanBatchSize)
+	if err != nil {
+		return
+	}
+	for _, uri := range uris {
+		// several API instances may run a cleaner, only the one that took uri out of the set removes archive
+		removed, err := rest.Cache.RemoveStoredExport(uri)
+		if err != nil || !removed {
+			continue
+		}
+		if err = rest.store.RemoveUserExport(uri); err != nil {
+			log.WithError(err).Warnf("[ExportsCleaner] failed to remove archive %s", uri)
+		}
+	}
+}
+
+// buildUserExport streams user's archive into object store, then notifies user
+func (rest *RESTfacility) buildUserExport(export *UserExport, notifier Notifications.Notifiers) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(rest.writeUserExport(export.UserId, writer))
+	}()
+	uri, size, err := rest.store.PutUserExport(fmt.Sprintf("%s/%s.zip", export.UserId, export.ExportId), reader)
+	// unblock archive's writer if store gave up reading
+	reader.CloseWithError(err)
+	if err != nil {
+		log.WithError(err).Errorf("[RESTfacility] failed to build export %s of user %s", export.ExportId, export.UserId)
+		export.Status = ExportFailed
+		if e := rest.Cache.SetUserExport(export); e != nil {
+			log.WithError(e).Warnf("[RESTfacility] failed to cache failure of export %s", export.ExportId)
+		}
+		rest.notifyUserExport(export, "exportFailed", map[string]interface{}{"export_id": export.ExportId}, notifier)
+		return
+	}
+
+	linkTTL := rest.export.LinkTTL
+	if linkTTL <= 0 {
+		linkTTL = exportDefaultLinkTTL
+	}
+	export.ExpiresAt = time.Now().Add(time.Duration(linkTTL) * time.Hour)
+	export.Size = size
+	export.Status = ExportReady
+	export.Token = shortuuid.New()
+	export.Uri = uri
+	if err = rest.Cache.SetUserExport(export); err != nil {
+		log.WithError(err).Errorf("[RESTfacility] failed to cache ready export %s, removing archive", export.ExportId)
+		rest.store.RemoveUserExport(uri)
+		return
+	}
+	rest.notifyUserExport(export, "exportReady", map[string]interface{}{
+		"export_id":  export.ExportId,
+		"expires_at": export.ExpiresAt.UTC().Format(time.RFC3339),
+		"size":       export.Size,
+		"url":        rest.Hostname + ExportDownloadPath + export.Token,
+	}, notifier)
+}
+
+func (rest *RESTfacility) notifyUserExport(export *UserExport, kind string, content map[string]interface{}, notifier Notifications.Notifiers) {
+	if notifier == nil {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{kind: content})
+	if err != nil {
+		log.WithError(err).Warnf("[RESTfacility] failed to marshal %s notification", kind)
+		return
+	}
+	userId, err := uuid.FromString(export.UserId)
+	if err != nil {
+		log.WithError(err).Warnf("[RESTfacility] invalid user_id %s for export %s", export.UserId, export.ExportId)
+		return
+	}
+	notif := &Notification{
+		Body:    string(body),
+		Emitter: "api",
+		NotifId: UUID(uuid.NewV1()),
+		TTLcode: LongLived,
+		Type:    EventNotif,
+		User:    &User{UserId: UUID(userId)},
+	}
+	notifyByQueue(notifier, notif)
+}
+
+// writeUserExport writes user's data into a zip archive :
+// messages as mbox, contacts as vCard, other data as JSON files
+func (rest *RESTfacility) writeUserExport(userId string, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	var drafts []*Message
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"messages.mbox", func(f io.Writer) (err error) {
+			drafts, err = rest.exportMessages(userId, f)
+			return
+		}},
+		{"drafts.json", func(f io.Writer) error { return exportJSON(f, drafts) }},
+		{"contacts.vcf", func(f io.Writer) error { return rest.exportContacts(userId, f) }},
+		{"tags.json", func(f io.Writer) error {
+			tags, err := rest.store.RetrieveUserTags(userId)
+			if err != nil {
+				return err
+			}
+			return exportJSON(f, tags)
+		}},
+		{"identities.json", func(f io.Writer) error { return rest.exportIdentities(userId, f) }},
+		{"devices.json", func(f io.Writer) error {
+			devices, err := rest.store.RetrieveDevices(userId)
+			if err != nil && !strings.Contains(err.Error(), "not found") {
+				return err
+			}
+			for i := range devices {
+				// push subscription holds user agent's secrets
+				devices[i].Push = nil
+			}
+			return exportJSON(f, devices)
+		}},
+		{"settings.json", func(f io.Writer) error {
+			settings, err := rest.store.GetSettings(userId)
+			if err != nil {
+				return err
+			}
+			return exportJSON(f, settings)
+		}},
+	}
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err = file.write(f); err != nil {
+			return fmt.Errorf("failed to export %s : %s", file.name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// exportMessages writes raw messages into mbox, returning messages without raw (ie drafts)
+func (rest *RESTfacility) exportMessages(userId string, w io.Writer) (drafts []*Message, err error) {
+	msgs, err := rest.store.RetrieveUserMessages(userId)
+	if err != nil {
+		return nil, err
+	}
+	// drain chan whatever happens to release store's goroutine
+	defer func() {
+		for range msgs {
+		}
+	}()
+	drafts = []*Message{}
+	mbox := messages.NewMboxWriter(w)
+	for msg := range msgs {
+		if (msg.Raw_msg_id == UUID{}) {
+			drafts = append(drafts, msg)
+			continue
+		}
+		raw, e := rest.store.GetRawMessage(msg.Raw_msg_id.String())
+		if e != nil {
+			log.WithError(e).Warnf("[RESTfacility] export of user %s : failed to get raw message %s", userId, msg.Raw_msg_id.String())
+			continue
+		}
+		var sender string
+		for _, participant := range msg.Participants {
+			if participant.Type == ParticipantFrom {
+				sender = participant.Address
+				break
+			}
+		}
+		if err = mbox.WriteMessage(sender, msg.Date, []byte(raw.Raw_data)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (rest *RESTfacility) exportContacts(userId string, w io.Writer) error {
+	contacts, err := rest.store.RetrieveUserContacts(userId)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for range contacts {
+		}
+	}()
+	for contact := range contacts {
+		if !contact.Deleted.IsZero() {
+			continue
+		}
+		rest.loadContactKeys(contact)
+		if _, err = w.Write(helpers.MarshalVCard(contact)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportIdentities exports user's local and remote identities, without credentials
+func (rest *RESTfacility) exportIdentities(userId string, w io.Writer) error {
+	identities := []*UserIdentity{}
+	locals, err := rest.store.RetrieveLocalsIdentities(userId)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+	for i := range locals {
+		identities = append(identities, &locals[i])
+	}
+	remotes, err := rest.store.RetrieveRemoteIdentities(userId, false)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+	identities = append(identities, remotes...)
+	for _, identity := range identities {
+		identity.Credentials = nil
+	}
+	return exportJSON(w, identities)
+}
+
+func exportJSON(w io.Writer, data interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,140 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/cache"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newExportTestStore serves a few of user's data
+func newExportTestStore(userId UUID) *backendstest.FakeStore {
+	rawId := UUID(uuid.NewV4())
+	store := backendstest.NewFakeStore()
+	store.Messages = []*Message{
+		{
+			User_id:      userId,
+			Date:         time.Date(2019, 4, 2, 10, 30, 0, 0, time.UTC),
+			Participants: []Participant{{Address: "emma@example.com", Type: ParticipantFrom}},
+			Raw_msg_id:   rawId,
+		},
+		{User_id: userId, Is_draft: true, Subject: "unfinished"},
+	}
+	store.RawMessages[rawId.String()] = "From: emma@example.com\r\nSubject: hello\r\n\r\nFrom here to there\r\n>From quoted\r\n"
+	store.Contacts = []*Contact{
+		{UserId: userId, GivenName: "Jean", FamilyName: "Dupont", Emails: []EmailContact{{Address: "jean@example.com", IsPrimary: true}}},
+		{UserId: userId, Title: "deleted", Deleted: time.Now()},
+	}
+	store.Tags = []Tag{{User_id: userId, Name: "work"}}
+	store.Identities = []*UserIdentity{
+		{UserId: userId, Identifier: "emma@caliopen.local", Type: LocalIdentity},
+		{UserId: userId, Identifier: "emma@example.com", Type: RemoteIdentity, Credentials: &Credentials{"password": "secret"}},
+	}
+	store.Devices = []Device{{UserId: userId, Name: "laptop", Push: &PushSubscription{Auth: "secret"}}}
+	store.Settings[userId.String()] = &Settings{DefaultLocale: "fr-FR"}
+	return store
+}
+
+func TestRESTfacility_RequestUserExport(t *testing.T) {
+	user := UUID(uuid.NewV4())
+	rest := new(RESTfacility)
+	rest.Cache, _, _ = cache.InitializeTestCache()
+	rest.store = newExportTestStore(user)
+	rest.Hostname = "https://caliopen.example"
+	userId := user.String()
+
+	notified := make(chan *Notification, 1)
+	defer func(restore func(Notifications.Notifiers, *Notification) CaliopenError) { notifyByQueue = restore }(notifyByQueue)
+	notifyByQueue = func(notifier Notifications.Notifiers, notif *Notification) CaliopenError {
+		notified <- notif
+		return nil
+	}
+	export, err := rest.RequestUserExport(userId, &Notifications.Notifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Status != ExportPending {
+		t.Errorf("expected pending export, got %s", export.Status)
+	}
+	var notif *Notification
+	select {
+	case notif = <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for export to be notified")
+	}
+	body := map[string]map[string]interface{}{}
+	json.Unmarshal([]byte(notif.Body), &body)
+	ready, ok := body["exportReady"]
+	if !ok {
+		t.Fatalf("expected exportReady notification, got %s", notif.Body)
+	}
+
+	export, err = rest.RetrieveUserExport(userId)
+	if err != nil || export.Status != ExportReady {
+		t.Fatalf("expected ready export, got %+v, err %v", export, err)
+	}
+	if ready["url"] != "https://caliopen.example/api/v2/exports/"+export.Token {
+		t.Errorf("unexpected download url %v", ready["url"])
+	}
+	if !export.ExpiresAt.After(time.Now().Add(47 * time.Hour)) {
+		t.Errorf("expected default link ttl, export expires at %s", export.ExpiresAt)
+	}
+
+	_, archive, err := rest.OpenUserExport(export.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(archive)
+	files := map[string]string{}
+	zipped, e := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, f := range zipped.File {
+		r, _ := f.Open()
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	mbox := "From emma@example.com Tue Apr  2 10:30:00 2019\n" +
+		"From: emma@example.com\nSubject: hello\n\n>From here to there\n>>From quoted\n\n"
+	if files["messages.mbox"] != mbox {
+		t.Errorf("unexpected mbox :\n%q", files["messages.mbox"])
+	}
+	if !strings.Contains(files["drafts.json"], "unfinished") {
+		t.Errorf("expected draft to be exported, got %s", files["drafts.json"])
+	}
+	vcf := files["contacts.vcf"]
+	if strings.Count(vcf, "BEGIN:VCARD") != 1 || !strings.Contains(vcf, "FN:Jean Dupont\r\n") ||
+		!strings.Contains(vcf, "EMAIL;PREF=1:jean@example.com\r\n") {
+		t.Errorf("unexpected vCards :\n%s", vcf)
+	}
+	if strings.Contains(files["identities.json"], "secret") || !strings.Contains(files["identities.json"], "emma@caliopen.local") {
+		t.Errorf("unexpected identities : %s", files["identities.json"])
+	}
+	if strings.Contains(files["devices.json"], "secret") {
+		t.Errorf("expected push subscription not to be exported : %s", files["devices.json"])
+	}
+	for _, name := range []string{"tags.json", "settings.json"} {
+		if files[name] == "" {
+			t.Errorf("expected %s in archive", name)
+		}
+	}
+
+	if _, _, err = rest.OpenUserExport("unknown"); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected unknown token not to be found, got %v", err)
+	}
+}
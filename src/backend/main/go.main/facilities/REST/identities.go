@@ -15,8 +15,12 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/bitly/go-simplejson"
 	"github.com/satori/go.uuid"
+	"time"
 )
 
+// how long to wait between two actions requested by user on the same remote identity
+const remoteActionsThrottle = 2 * time.Minute
+
 func (rest *RESTfacility) RetrieveLocalIdentities(user_id string) ([]UserIdentity, error) {
 	return rest.store.RetrieveLocalsIdentities(user_id)
 }
@@ -115,6 +119,11 @@ func (rest *RESTfacility) CreateUserIdentity(identity *UserIdentity) CaliopenErr
 	// set defaults
 	identity.SetDefaults()
 
+	// check sync schedule, if any
+	if _, e := ParseSyncSchedule(identity.Infos); e != nil {
+		return WrapCaliopenErr(e, UnprocessableCaliopenErr, "[CreateUserIdentity] invalid sync schedule")
+	}
+
 	// ensure identifier+protocol+user_id uniqueness
 	rows, e := rest.store.LookupIdentityByIdentifier(identity.Identifier, identity.Protocol, identity.UserId.String())
 	if e != nil || len(rows) > 0 {
@@ -134,6 +143,7 @@ func (rest *RESTfacility) CreateUserIdentity(identity *UserIdentity) CaliopenErr
 			OrderParam: identity.Infos["pollinterval"],
 			Protocol:   identity.Protocol,
 			UserId:     identity.UserId.String(),
+			Infos:      SyncScheduleInfos(identity.Infos),
 		}
 		jorder, jerr := json.Marshal(order)
 		if jerr == nil {
@@ -211,13 +221,35 @@ func (rest *RESTfacility) PatchUserIdentity(patch []byte, userId, identityId str
 		return WrapCaliopenErrf(err3, FailDependencyCaliopenErr, "[RESTfacility] PatchUserIdentity : call to generic UpdateWithPatch failed : %s", err3)
 	}
 
+	// check sync schedule before saving
+	updatedID := newRemoteID.(*UserIdentity)
+	if _, e := ParseSyncSchedule(updatedID.Infos); e != nil {
+		return WrapCaliopenErr(e, UnprocessableCaliopenErr, "[RESTfacility] PatchUserIdentity : invalid sync schedule")
+	}
+
 	// save updated resource
-	err4 := rest.UpdateUserIdentity(newRemoteID.(*UserIdentity), currentRemoteID, modifiedFields)
+	err4 := rest.UpdateUserIdentity(updatedID, currentRemoteID, modifiedFields)
 	if err4 != nil {
 		return WrapCaliopenErrf(err4, FailDependencyCaliopenErr, "[RESTfacility] PatchUserIdentity failed with UpdateUserIdentity error : %s", err4)
 	}
 
-	//TODO: emit nats message to IDpoller if it's a remote identity
+	// emit nats message to idpoller if remote identity's schedule may have changed
+	if _, infosModified := modifiedFields["Infos"]; infosModified && updatedID.Type == RemoteIdentity {
+		order := RemoteIDNatsMessage{
+			IdentityId: updatedID.Id.String(),
+			Order:      "update_schedule",
+			Protocol:   updatedID.Protocol,
+			UserId:     updatedID.UserId.String(),
+			Infos:      SyncScheduleInfos(updatedID.Infos),
+		}
+		jorder, jerr := json.Marshal(order)
+		if jerr == nil {
+			e := rest.nats_conn.Publish(rest.natsTopics[Nats_IdPoller_topicKey], jorder)
+			if e != nil {
+				log.WithError(e).Warn("[PatchUserIdentity] failed to publish update_schedule order to idpoller")
+			}
+		}
+	}
 
 	return nil
 }
@@ -260,3 +292,81 @@ func (rest *RESTfacility) DeleteUserIdentity(userId, identityId string) Caliopen
 func (rest *RESTfacility) IsRemoteIdentity(userId, identityId string) bool {
 	return rest.store.IsRemoteIdentity(userId, identityId)
 }
+
+// RetrieveRemoteIdentityStatus asks idpoller for the sync status of a remote identity
+func (rest *RESTfacility) RetrieveRemoteIdentityStatus(userId, identityId string) (*RemoteIdentityStatus, CaliopenError) {
+	userIdentity, err := rest.RetrieveUserIdentity(userId, identityId, false)
+	if err != nil {
+		return nil, err
+	}
+	if userIdentity.Type != RemoteIdentity {
+		return nil, NewCaliopenErr(NotFoundCaliopenErr, "remote identity not found")
+	}
+	order := RemoteIDNatsMessage{
+		IdentityId: identityId,
+		Order:      "status",
+		Protocol:   userIdentity.Protocol,
+		UserId:     userId,
+	}
+	jorder, e := json.Marshal(order)
+	if e != nil {
+		return nil, WrapCaliopenErr(e, UnknownCaliopenErr, "[RESTfacility] failed to build status request for idpoller")
+	}
+	rep, e := rest.nats_conn.Request(rest.natsTopics[Nats_IdPoller_topicKey], jorder, 30*time.Second)
+	if e != nil {
+		log.WithError(e).Warn("[RetrieveRemoteIdentityStatus] idpoller status request failed")
+		return nil, WrapCaliopenErr(e, FailDependencyCaliopenErr, "idpoller failed to reply")
+	}
+	status := new(RemoteIdentityStatus)
+	e = json.Unmarshal(rep.Data, status)
+	if e != nil || status.IdentityId == "" {
+		return nil, NewCaliopenErrf(FailDependencyCaliopenErr, "idpoller returned an invalid status : %s", string(rep.Data))
+	}
+	return status, nil
+}
+
+// RemoteIdentityAction asks idpoller to run a prioritised job for a remote identity,
+// unless an action was already requested for this identity within remoteActionsThrottle.
+func (rest *RESTfacility) RemoteIdentityAction(userId, identityId, action string) CaliopenError {
+	switch action {
+	case SyncNowAction, FullFetchAction, ResetSyncStateAction:
+	default:
+		return NewCaliopenErrf(UnprocessableCaliopenErr, "unknown action %s", action)
+	}
+	userIdentity, err := rest.RetrieveUserIdentity(userId, identityId, false)
+	if err != nil {
+		return err
+	}
+	if userIdentity.Type != RemoteIdentity {
+		return NewCaliopenErr(NotFoundCaliopenErr, "remote identity not found")
+	}
+	if action == FullFetchAction && userIdentity.Protocol == "twitter" {
+		return NewCaliopenErrf(UnprocessableCaliopenErr, "action %s not available for %s identities", action, userIdentity.Protocol)
+	}
+
+	throttled, until, e := rest.Cache.ThrottleRemoteAction(userId, identityId, remoteActionsThrottle)
+	if e != nil {
+		return WrapCaliopenErr(e, FailDependencyCaliopenErr, "[RESTfacility] RemoteIdentityAction failed to check rate-limit")
+	}
+	if throttled {
+		return NewCaliopenErrf(TooManyRequestsCaliopenErr, "an action has already been requested for this identity, retry after %s", until.Format(time.RFC3339))
+	}
+
+	order := RemoteIDNatsMessage{
+		IdentityId: identityId,
+		Order:      "sync_now",
+		OrderParam: action,
+		Protocol:   userIdentity.Protocol,
+		UserId:     userId,
+	}
+	jorder, e := json.Marshal(order)
+	if e != nil {
+		return WrapCaliopenErr(e, UnknownCaliopenErr, "[RESTfacility] failed to build order for idpoller")
+	}
+	e = rest.nats_conn.Publish(rest.natsTopics[Nats_IdPoller_topicKey], jorder)
+	if e != nil {
+		log.WithError(e).Warnf("[RemoteIdentityAction] failed to publish %s order to idpoller", action)
+		return WrapCaliopenErr(e, FailDependencyCaliopenErr, "failed to send order to idpoller")
+	}
+	return nil
+}
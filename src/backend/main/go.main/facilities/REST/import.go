@@ -0,0 +1,250 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
+	log "github.com/Sirupsen/logrus"
+	"github.com/nats-io/go-nats"
+	"github.com/satori/go.uuid"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	importWorkersQueue = "mailboxImports" // nats queue group sharing imports' reports between API instances
+	importStaleAfter   = time.Hour        // unfinished import is given up if worker has not reported for this long
+)
+
+// MailboxFile is a file uploaded by user to be imported
+type MailboxFile struct {
+	Name    string
+	Content io.Reader
+}
+
+// ImportMailbox stores uploaded files into object store and orders an IMAP worker
+// to deliver their messages to one of user's email identities.
+// files could be a single mbox, a zipped Maildir, or one or more .eml messages.
+// Only one import could be in progress at a time, unless it is stale.
+func (rest *RESTfacility) ImportMailbox(userId, identityId string, files []MailboxFile) (*MailboxImport, CaliopenError) {
+	if len(files) == 0 {
+		return nil, NewCaliopenErr(UnprocessableCaliopenErr, "[RESTfacility] no file to import")
+	}
+	if previous, err := rest.Cache.GetMailboxImport(userId); err == nil && !previous.Finished() && !importIsStale(previous) {
+		return nil, NewCaliopenErrf(ForbiddenCaliopenErr, "[RESTfacility] import %s is already in progress", previous.ImportId)
+	}
+	if err := rest.checkImportIdentity(userId, identityId); err != nil {
+		return nil, err
+	}
+	format, mailbox, err := mailboxFormat(files)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mbImport := &MailboxImport{
+		DateInsert: now,
+		DateUpdate: now,
+		Format:     format,
+		IdentityId: identityId,
+		ImportId:   uuid.NewV4().String(),
+		Status:     ImportPending,
+		UserId:     userId,
+	}
+	// another import could have been requested since previous one has been checked
+	claimed, e := rest.Cache.ClaimMailboxImport(userId, mbImport.ImportId, importStaleAfter)
+	if e != nil {
+		return nil, WrapCaliopenErr(e, FailDependencyCaliopenErr, "[RESTfacility] ImportMailbox failed to claim import")
+	}
+	if !claimed {
+		return nil, NewCaliopenErr(ForbiddenCaliopenErr, "[RESTfacility] another import is already in progress")
+	}
+	uri, _, e := rest.store.PutMailboxImport(fmt.Sprintf("%s/%s", userId, mbImport.ImportId), mailbox)
+	if closer, ok := mailbox.(io.Closer); ok {
+		// unblock files' zipper if store gave up reading
+		closer.Close()
+	}
+	if e != nil {
+		rest.Cache.ReleaseMailboxImport(userId, mbImport.ImportId)
+		return nil, WrapCaliopenErr(e, DbCaliopenErr, "[RESTfacility] ImportMailbox failed to store uploaded files")
+	}
+	mbImport.Uri = uri
+	if e = rest.Cache.SetMailboxImport(mbImport); e != nil {
+		rest.Cache.ReleaseMailboxImport(userId, mbImport.ImportId)
+		rest.store.RemoveMailboxImport(uri)
+		return nil, WrapCaliopenErr(e, FailDependencyCaliopenErr, "[RESTfacility] ImportMailbox failed to cache import")
+	}
+
+	order, e := json.Marshal(IMAPorder{
+		Order:      "import_mailbox",
+		UserId:     userId,
+		IdentityId: identityId,
+		Import:     mbImport,
+	})
+	if e == nil {
+		e = rest.nats_conn.Publish(rest.natsTopics[Nats_outIMAP_topicKey], order)
+	}
+	if e != nil {
+		mbImport.Status = ImportFailed
+		rest.Cache.SetMailboxImport(mbImport)
+		rest.Cache.ReleaseMailboxImport(userId, mbImport.ImportId)
+		rest.store.RemoveMailboxImport(uri)
+		return nil, WrapCaliopenErr(e, FailDependencyCaliopenErr, "[RESTfacility] ImportMailbox failed to publish import order")
+	}
+	return mbImport, nil
+}
+
+// RetrieveMailboxImport returns user's last import, as reported by IMAP worker
+func (rest *RESTfacility) RetrieveMailboxImport(userId string) (*MailboxImport, CaliopenError) {
+	mbImport, err := rest.Cache.GetMailboxImport(userId)
+	if err != nil || mbImport == nil {
+		return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RESTfacility] no import found for user %s", userId)
+	}
+	return mbImport, nil
+}
+
+// StartImportsListener listens for imports' reports published by IMAP workers
+// to keep imports' state up to date in cache and to notify users of their progress.
+func (rest *RESTfacility) StartImportsListener(notifier Notifications.Notifiers) {
+	topic := rest.natsTopics[Nats_Imports_topicKey]
+	if rest.nats_conn == nil || topic == "" {
+		return
+	}
+	_, err := rest.nats_conn.QueueSubscribe(topic, importWorkersQueue, func(msg *nats.Msg) {
+		rest.handleImportReport(msg, notifier)
+	})
+	if err != nil {
+		log.WithError(err).Errorf("[ImportsListener] failed to subscribe to %s topic on NATS", topic)
+	}
+}
+
+func (rest *RESTfacility) handleImportReport(msg *nats.Msg, notifier Notifications.Notifiers) {
+	report := new(MailboxImport)
+	err := json.Unmarshal(msg.Data, report)
+	if err != nil || report.UserId == "" {
+		log.WithError(err).Warnf("[ImportsListener] invalid import report : %s", msg.Data)
+		return
+	}
+	// late reports of a previous import must not overwrite current one, nor a finished import be reopened
+	current, err := rest.Cache.GetMailboxImport(report.UserId)
+	if err != nil || current == nil || current.ImportId != report.ImportId || current.Finished() {
+		log.Warnf("[ImportsListener] dropping report of import %s, it is not user's running import", report.ImportId)
+		return
+	}
+	if err = rest.Cache.SetMailboxImport(report); err != nil {
+		log.WithError(err).Warnf("[ImportsListener] failed to cache report of import %s", report.ImportId)
+	}
+	if report.Finished() {
+		rest.Cache.ReleaseMailboxImport(report.UserId, report.ImportId)
+	}
+	if notifier == nil {
+		return
+	}
+	userId, err := uuid.FromString(report.UserId)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{"mailboxImport": map[string]interface{}{
+		"duplicates":  report.Duplicates,
+		"failed":      report.Failed,
+		"identity_id": report.IdentityId,
+		"import_id":   report.ImportId,
+		"imported":    report.Imported,
+		"status":      report.Status,
+	}})
+	if err != nil {
+		return
+	}
+	notif := &Notification{
+		Body:    string(body),
+		Emitter: "api",
+		NotifId: UUID(uuid.NewV1()),
+		TTLcode: ShortLived,
+		Type:    EventNotif,
+		User:    &User{UserId: UUID(userId)},
+	}
+	if report.Finished() {
+		notif.TTLcode = LongLived
+	}
+	notifyByQueue(notifier, notif)
+}
+
+// importIsStale returns true if worker has not reported import's progress for too long,
+// ie. import has been lost by worker or its reports have been lost by api.
+func importIsStale(mbImport *MailboxImport) bool {
+	return time.Since(mbImport.DateUpdate) > importStaleAfter
+}
+
+// checkImportIdentity checks that identity is one of user's email identities
+func (rest *RESTfacility) checkImportIdentity(userId, identityId string) CaliopenError {
+	if locals, err := rest.RetrieveLocalIdentities(userId); err == nil {
+		for _, local := range locals {
+			if local.Id.String() == identityId {
+				return nil
+			}
+		}
+	}
+	remote, err := rest.RetrieveUserIdentity(userId, identityId, false)
+	if err != nil {
+		return WrapCaliopenErrf(err, NotFoundCaliopenErr, "[RESTfacility] identity %s not found for user", identityId)
+	}
+	if remote.Protocol != EmailProtocol && remote.Protocol != ImapProtocol {
+		return NewCaliopenErrf(UnprocessableCaliopenErr, "[RESTfacility] can't import emails for a %s identity", remote.Protocol)
+	}
+	return nil
+}
+
+// mailboxFormat guesses uploaded mailbox's format from files' names and content.
+// Several files are zipped on the fly into a single archive.
+func mailboxFormat(files []MailboxFile) (format string, mailbox io.Reader, err CaliopenError) {
+	if len(files) > 1 {
+		for _, file := range files {
+			if !strings.EqualFold(path.Ext(file.Name), ".eml") {
+				return "", nil, NewCaliopenErrf(UnprocessableCaliopenErr, "[RESTfacility] only .eml files could be uploaded together, got %s", file.Name)
+			}
+		}
+		return MailboxFormatZip, zipMailboxFiles(files), nil
+	}
+	file := files[0]
+	switch strings.ToLower(path.Ext(file.Name)) {
+	case ".zip":
+		return MailboxFormatZip, file.Content, nil
+	case ".eml":
+		return MailboxFormatEml, file.Content, nil
+	}
+	content := bufio.NewReader(file.Content)
+	head, _ := content.Peek(5)
+	if string(head) == "From " {
+		return MailboxFormatMbox, content, nil
+	}
+	return MailboxFormatEml, content, nil
+}
+
+// zipMailboxFiles streams files into a zip archive
+func zipMailboxFiles(files []MailboxFile) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		archive := zip.NewWriter(writer)
+		for i, file := range files {
+			f, err := archive.Create(fmt.Sprintf("%d-%s", i, path.Base(file.Name)))
+			if err == nil {
+				_, err = io.Copy(f, file.Content)
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.CloseWithError(archive.Close())
+	}()
+	return reader
+}
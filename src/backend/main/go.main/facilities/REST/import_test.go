@@ -0,0 +1,155 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/cache"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
+	"github.com/nats-io/go-nats"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newImportTestStore knows a local and a twitter identity of user
+func newImportTestStore(userId UUID) (store *backendstest.FakeStore, localId, twitterId string) {
+	local := &UserIdentity{Id: UUID(uuid.NewV4()), Identifier: "emma@caliopen.local", Type: LocalIdentity, UserId: userId}
+	twitter := &UserIdentity{Id: UUID(uuid.NewV4()), Protocol: TwitterProtocol, Type: RemoteIdentity, UserId: userId}
+	store = backendstest.NewFakeStore()
+	store.Identities = []*UserIdentity{local, twitter}
+	// storing files fails in this test
+	store.Fail = func(call backendstest.FakeCall) error {
+		if call.Method == "PutMailboxImport" {
+			return errors.New("object store unavailable")
+		}
+		return nil
+	}
+	return store, local.Id.String(), twitter.Id.String()
+}
+
+func TestRESTfacility_ImportMailbox(t *testing.T) {
+	user := UUID(uuid.NewV4())
+	store, localId, twitterId := newImportTestStore(user)
+	rest := new(RESTfacility)
+	rest.Cache, _, _ = cache.InitializeTestCache()
+	rest.store = store
+	userId := user.String()
+	eml := []MailboxFile{{Name: "hello.eml", Content: strings.NewReader("Subject: hello\r\n\r\nhello\r\n")}}
+
+	for _, identityId := range []string{twitterId, uuid.NewV4().String()} {
+		if _, err := rest.ImportMailbox(userId, identityId, eml); err == nil {
+			t.Errorf("expected import for identity %s to be rejected", identityId)
+		}
+	}
+	if err := rest.checkImportIdentity(userId, localId); err != nil {
+		t.Errorf("expected import for local identity to be accepted, got %s", err)
+	}
+	if _, err := rest.ImportMailbox(userId, localId, nil); err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected import without file to be unprocessable, got %v", err)
+	}
+
+	rest.Cache.SetMailboxImport(&MailboxImport{DateUpdate: time.Now(), ImportId: "running", Status: ImportRunning, UserId: userId})
+	if _, err := rest.ImportMailbox(userId, localId, eml); err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected a second import to be forbidden, got %v", err)
+	}
+
+	// stale import does not block new ones
+	rest.Cache.SetMailboxImport(&MailboxImport{DateUpdate: time.Now().Add(-2 * importStaleAfter), ImportId: "stale", Status: ImportRunning, UserId: userId})
+	if _, err := rest.ImportMailbox(userId, localId, eml); err == nil || err.Code() != DbCaliopenErr {
+		t.Errorf("expected import to be started over a stale one, got %v", err)
+	}
+
+	// import slot is claimed by a concurrent request
+	if claimed, _ := rest.Cache.ClaimMailboxImport(userId, "concurrent", importStaleAfter); !claimed {
+		t.Fatal("expected import slot to be released after failure")
+	}
+	if _, err := rest.ImportMailbox(userId, localId, eml); err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected import to be forbidden while slot is claimed, got %v", err)
+	}
+}
+
+func TestMailboxFormat(t *testing.T) {
+	cases := []struct {
+		files  []MailboxFile
+		format string
+	}{
+		{[]MailboxFile{{Name: "Inbox", Content: strings.NewReader("From a@example.com Tue Apr  2 10:30:00 2019\n")}}, MailboxFormatMbox},
+		{[]MailboxFile{{Name: "message", Content: strings.NewReader("Subject: hello\r\n")}}, MailboxFormatEml},
+		{[]MailboxFile{{Name: "Maildir.ZIP", Content: strings.NewReader("PK")}}, MailboxFormatZip},
+	}
+	for _, c := range cases {
+		format, _, err := mailboxFormat(c.files)
+		if err != nil || format != c.format {
+			t.Errorf("expected %s to be detected as %s, got %s (%v)", c.files[0].Name, c.format, format, err)
+		}
+	}
+
+	if _, _, err := mailboxFormat([]MailboxFile{{Name: "a.eml"}, {Name: "Inbox.mbox"}}); err == nil {
+		t.Error("expected only .eml files to be accepted together")
+	}
+	format, mailbox, err := mailboxFormat([]MailboxFile{
+		{Name: "a.eml", Content: strings.NewReader("Subject: a\r\n")},
+		{Name: "dir/a.eml", Content: strings.NewReader("Subject: b\r\n")},
+	})
+	if err != nil || format != MailboxFormatZip {
+		t.Fatalf("expected .eml files to be zipped, got %s (%v)", format, err)
+	}
+	content, _ := ioutil.ReadAll(mailbox)
+	archive, e := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if e != nil || len(archive.File) != 2 || archive.File[0].Name == archive.File[1].Name {
+		t.Errorf("expected an archive with 2 distinct files, got %v (%v)", archive, e)
+	}
+}
+
+func TestRESTfacility_handleImportReport(t *testing.T) {
+	rest := new(RESTfacility)
+	rest.Cache, _, _ = cache.InitializeTestCache()
+	userId := uuid.NewV4().String()
+
+	notified := make(chan *Notification, 1)
+	defer func(restore func(Notifications.Notifiers, *Notification) CaliopenError) { notifyByQueue = restore }(notifyByQueue)
+	notifyByQueue = func(notifier Notifications.Notifiers, notif *Notification) CaliopenError {
+		notified <- notif
+		return nil
+	}
+	rest.Cache.SetMailboxImport(&MailboxImport{ImportId: "import", Status: ImportRunning, UserId: userId})
+	// report of a previous import
+	report, _ := json.Marshal(MailboxImport{ImportId: "previous", Imported: 7, Status: ImportRunning, UserId: userId})
+	rest.handleImportReport(&nats.Msg{Data: report}, &Notifications.Notifier{})
+	if mbImport, _ := rest.RetrieveMailboxImport(userId); mbImport.ImportId != "import" || len(notified) != 0 {
+		t.Errorf("expected report of another import to be dropped, got %+v", mbImport)
+	}
+
+	report, _ = json.Marshal(MailboxImport{ImportId: "import", Imported: 42, Status: ImportDone, Uri: "s3://bucket/file", UserId: userId})
+	rest.handleImportReport(&nats.Msg{Data: report}, &Notifications.Notifier{})
+
+	mbImport, err := rest.RetrieveMailboxImport(userId)
+	if err != nil || mbImport.Imported != 42 || !mbImport.Finished() {
+		t.Errorf("expected report to be cached, got %+v (%v)", mbImport, err)
+	}
+	select {
+	case notif := <-notified:
+		if notif.TTLcode != LongLived || !strings.Contains(notif.Body, `"mailboxImport"`) || strings.Contains(notif.Body, "s3://") {
+			t.Errorf("unexpected notification %+v", notif)
+		}
+	default:
+		t.Error("expected user to be notified of import's progress")
+	}
+
+	// late report once import is done
+	report, _ = json.Marshal(MailboxImport{ImportId: "import", Imported: 40, Status: ImportRunning, UserId: userId})
+	rest.handleImportReport(&nats.Msg{Data: report}, &Notifications.Notifier{})
+	if mbImport, _ = rest.RetrieveMailboxImport(userId); !mbImport.Finished() {
+		t.Errorf("expected finished import not to be reopened, got %+v", mbImport)
+	}
+}
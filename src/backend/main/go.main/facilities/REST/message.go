@@ -5,8 +5,10 @@
 package REST
 
 import (
+	"encoding/json"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	m "github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
+	log "github.com/Sirupsen/logrus"
 )
 
 func (rest *RESTfacility) SetMessageUnread(user *UserInfo, message_id string, status bool) (err error) {
@@ -17,7 +19,39 @@ func (rest *RESTfacility) SetMessageUnread(user *UserInfo, message_id string, st
 	}
 
 	err = rest.index.SetMessageUnread(user, message_id, status)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if msg, e := rest.store.RetrieveMessage(user.User_id, message_id); e == nil {
+		go rest.pushFlagsToRemotes(user.User_id, msg)
+	}
+	return nil
+}
+
+// pushFlagsToRemotes orders imap worker to reflect message's flags onto remote IMAP account(s) the message belongs to, if any.
+func (rest *RESTfacility) pushFlagsToRemotes(userId string, msg *Message) {
+	for _, identityId := range msg.UserIdentities {
+		identity, err := rest.store.RetrieveUserIdentity(userId, identityId.String(), false)
+		if err != nil || identity.Type != RemoteIdentity {
+			continue
+		}
+		if identity.Protocol != EmailProtocol && identity.Protocol != ImapProtocol {
+			continue
+		}
+		order := IMAPorder{
+			Order:      "flags",
+			IdentityId: identityId.String(),
+			UserId:     userId,
+			MessageId:  msg.Message_id.String(),
+		}
+		jorder, err := json.Marshal(order)
+		if err != nil {
+			log.WithError(err).Warn("[RESTfacility] pushFlagsToRemotes failed to build nats message")
+			continue
+		}
+		rest.PublishOnNats(string(jorder), rest.natsTopics[Nats_outIMAP_topicKey])
+	}
 }
 
 func (rest *RESTfacility) GetRawMessage(raw_message_id string) (raw_message []byte, err error) {
@@ -0,0 +1,265 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/nats-io/go-nats"
+	"time"
+)
+
+const (
+	purgeLease          = 10 * time.Minute // time given to a worker to process a purge step before another one could take it over
+	purgeResumeInterval = 5 * time.Minute  // delay between scans for interrupted purges
+	purgeWorkersQueue   = "userPurge"      // nats queue group sharing purge orders between API instances
+)
+
+// UserActionMessage is the payload published on users topic about users' lifecycle events
+type UserActionMessage struct {
+	Message  string `json:"message"`
+	UserId   string `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+// StartPurgeWorker listens for deleted users on users topic to purge their data,
+// and periodically resumes purges that have been interrupted.
+// Several API instances may run a worker : each deletion is handled by one of them,
+// and each purge is leased in store to a single worker at a time.
+func (rest *RESTfacility) StartPurgeWorker() {
+	topic := rest.natsTopics[Nats_Users_topicKey]
+	if rest.nats_conn != nil && topic != "" {
+		_, err := rest.nats_conn.QueueSubscribe(topic, purgeWorkersQueue, rest.handleUserDeleted)
+		if err != nil {
+			log.WithError(err).Errorf("[PurgeWorker] failed to subscribe to %s topic on NATS", topic)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(purgeResumeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rest.resumeUnfinishedPurges()
+		}
+	}()
+}
+
+func (rest *RESTfacility) handleUserDeleted(msg *nats.Msg) {
+	payload := new(UserActionMessage)
+	err := json.Unmarshal(msg.Data, payload)
+	if err != nil {
+		log.WithError(err).Warnf("[PurgeWorker] failed to unmarshal nats' payload : %s", msg.Data)
+		return
+	}
+	if payload.Message != "deleted" {
+		return
+	}
+	go rest.PurgeUser(payload.UserId)
+}
+
+func (rest *RESTfacility) resumeUnfinishedPurges() {
+	purges, err := rest.store.RetrieveUnfinishedPurges()
+	if err != nil {
+		log.WithError(err).Warn("[PurgeWorker] failed to retrieve unfinished purges")
+		return
+	}
+	now := time.Now()
+	for _, purge := range purges {
+		if purge.LeaseUntil.After(now) {
+			// purge is in progress
+			continue
+		}
+		rest.PurgeUser(purge.UserId.String())
+	}
+}
+
+// PurgeUser removes all data of a deleted user, step by step.
+// Purge is resumed from the last completed step if it has been interrupted.
+// Progress is saved in store after each step ; the returned purge holds the state reached.
+func (rest *RESTfacility) PurgeUser(userId string) (*UserPurge, CaliopenError) {
+	user, err := rest.store.RetrieveUser(userId)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, WrapCaliopenErr(err, NotFoundCaliopenErr, "[RESTfacility] PurgeUser user not found")
+		}
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PurgeUser failed to retrieve user")
+	}
+	if user.DateDelete.IsZero() {
+		return nil, NewCaliopenErrf(ForbiddenCaliopenErr, "[RESTfacility] PurgeUser user %s has not been deleted", userId)
+	}
+	purge, err := rest.store.RetrieveUserPurge(userId)
+	if err != nil {
+		if err.Error() != "not found" {
+			return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PurgeUser failed to retrieve purge")
+		}
+		purge = NewUserPurge(user.UserId, time.Now())
+		if err = rest.store.SaveUserPurge(purge); err != nil {
+			return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PurgeUser failed to save purge")
+		}
+	}
+	if purge.Completed() {
+		return purge, nil
+	}
+	if purge.LeaseUntil.After(time.Now()) {
+		return purge, NewCaliopenErrf(ForbiddenCaliopenErr, "[RESTfacility] PurgeUser purge of user %s is being processed until %s", userId, purge.LeaseUntil)
+	}
+
+	log.Infof("[RESTfacility] purging data of user %s from step %s", userId, purge.Step)
+	for _, step := range purge.RemainingSteps() {
+		until := time.Now().Add(purgeLease)
+		claimed, err := rest.store.ClaimUserPurge(userId, purge.LeaseUntil, until)
+		if err != nil {
+			return purge, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PurgeUser failed to lease purge")
+		}
+		if !claimed {
+			return purge, NewCaliopenErrf(ForbiddenCaliopenErr, "[RESTfacility] PurgeUser purge of user %s has been taken over by another worker", userId)
+		}
+		purge.LeaseUntil = until
+
+		count, err := rest.purgeStep(user, step)
+		if err != nil {
+			log.WithError(err).Warnf("[RESTfacility] purge of user %s failed at step %s", userId, step)
+			purge.LastError = err.Error()
+			purge.DateUpdate = time.Now()
+			if e := rest.store.SaveUserPurge(purge); e != nil {
+				log.WithError(e).Warnf("[RESTfacility] failed to save purge of user %s", userId)
+			}
+			return purge, WrapCaliopenErrf(err, FailDependencyCaliopenErr, "[RESTfacility] PurgeUser failed at step %s", step)
+		}
+		purge.StepDone(step, count, time.Now())
+		if err = rest.store.SaveUserPurge(purge); err != nil {
+			return purge, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PurgeUser failed to save purge")
+		}
+		log.Infof("[RESTfacility] purge of user %s : step %s done, %d resources removed", userId, step, count)
+	}
+	log.Infof("[RESTfacility] purge of user %s completed", userId)
+	return purge, nil
+}
+
+// purgeStep removes user's data related to step and returns the count of removed resources.
+// Each step must be safe to run again if it has been interrupted.
+func (rest *RESTfacility) purgeStep(user *User, step string) (count int, err error) {
+	userId := user.UserId.String()
+	switch step {
+	case PurgeStepSessions:
+		deviceIds := []string{}
+		devices, e := rest.store.RetrieveDevices(userId)
+		if e != nil && e.Error() != "devices not found" {
+			return 0, e
+		}
+		for _, device := range devices {
+			deviceIds = append(deviceIds, device.DeviceId.String())
+		}
+		return rest.Cache.PurgeUserSessions(userId, deviceIds)
+	case PurgeStepIdentities:
+		return rest.purgeIdentities(userId)
+	case PurgeStepIndex:
+		deleted, e := rest.index.DeleteUserDocuments(userId, user.ShardId)
+		return int(deleted), e
+	case PurgeStepMessages:
+		return rest.store.PurgeUserMessages(userId)
+	case PurgeStepAccount:
+		count, err = rest.store.PurgeUserTables(userId, step)
+		if err != nil {
+			return
+		}
+		objects, e := rest.store.PurgeUserObjects(userId)
+		if e != nil {
+			return count, e
+		}
+		return count + objects, rest.store.AnonymizeUser(user)
+	default:
+		return rest.store.PurgeUserTables(userId, step)
+	}
+}
+
+// purgeIdentities stops remote identities' polling and deletes user's identities with their credentials and lookups
+func (rest *RESTfacility) purgeIdentities(userId string) (count int, err error) {
+	identities := []*UserIdentity{}
+	locals, err := rest.store.RetrieveLocalsIdentities(userId)
+	if err != nil && err.Error() != "not found" {
+		return
+	}
+	for i := range locals {
+		identities = append(identities, &locals[i])
+	}
+	remotes, err := rest.store.RetrieveRemoteIdentities(userId, false)
+	if err != nil && err.Error() != "not found" {
+		return
+	}
+	identities = append(identities, remotes...)
+
+	for _, identity := range identities {
+		if identity.Type == RemoteIdentity {
+			order := RemoteIDNatsMessage{
+				IdentityId: identity.Id.String(),
+				Order:      "delete",
+				Protocol:   identity.Protocol,
+				UserId:     userId,
+			}
+			jorder, jerr := json.Marshal(order)
+			if jerr == nil {
+				e := rest.nats_conn.Publish(rest.natsTopics[Nats_IdPoller_topicKey], jorder)
+				if e != nil {
+					log.WithError(e).Warn("[RESTfacility] purgeIdentities failed to publish delete order to idpoller")
+				}
+			}
+		}
+		if err = rest.store.DeleteUserIdentity(identity); err != nil {
+			return
+		}
+		count++
+	}
+	// rows left without lookups
+	rows, err := rest.store.PurgeUserTables(userId, PurgeStepIdentities)
+	return count + rows, err
+}
+
+// RetrieveUserPurge returns progress of deleted user's purge
+func (rest *RESTfacility) RetrieveUserPurge(userId string) (*UserPurge, CaliopenError) {
+	purge, err := rest.store.RetrieveUserPurge(userId)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, WrapCaliopenErr(err, NotFoundCaliopenErr, "[RESTfacility] purge not found")
+		}
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] RetrieveUserPurge failed to retrieve purge")
+	}
+	return purge, nil
+}
+
+// VerifyUserPurge returns the count of user's data left in store, by table, in vault and object store, in cache and in index.
+// An empty map means nothing is left.
+func (rest *RESTfacility) VerifyUserPurge(userId string) (map[string]int, CaliopenError) {
+	user, err := rest.store.RetrieveUser(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] VerifyUserPurge failed to retrieve user")
+	}
+	counts, err := rest.store.CountUserRows(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] VerifyUserPurge failed to count rows")
+	}
+	objects, err := rest.store.CountUserObjects(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] VerifyUserPurge failed to count credentials and objects")
+	}
+	for backend, count := range objects {
+		counts[backend] = count
+	}
+	sessions, err := rest.Cache.CountUserSessions(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] VerifyUserPurge failed to count cache entries")
+	}
+	if sessions > 0 {
+		counts["cache"] = sessions
+	}
+	documents, err := rest.index.CountUserDocuments(userId, user.ShardId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, IndexCaliopenErr, "[RESTfacility] VerifyUserPurge failed to count documents")
+	}
+	if documents > 0 {
+		counts["index"] = int(documents)
+	}
+	return counts, nil
+}
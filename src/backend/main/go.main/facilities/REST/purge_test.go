@@ -0,0 +1,149 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/cache"
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// purgeTestStore records purge steps processed, and fails at failAt step
+type purgeTestStore struct {
+	*backendstest.FakeStore
+	processed *[]string
+	failAt    string
+}
+
+func (ps *purgeTestStore) PurgeUserMessages(userId string) (int, error) {
+	return ps.PurgeUserTables(userId, PurgeStepMessages)
+}
+func (ps *purgeTestStore) PurgeUserTables(userId, step string) (int, error) {
+	*ps.processed = append(*ps.processed, step)
+	if step == ps.failAt {
+		return 0, errors.New("store unavailable")
+	}
+	return 2, nil
+}
+func (ps *purgeTestStore) PurgeUserObjects(userId string) (int, error) {
+	return 1, nil
+}
+func (ps *purgeTestStore) CountUserRows(userId string) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+func (ps *purgeTestStore) CountUserObjects(userId string) (map[string]int, error) {
+	return map[string]int{"vault": 1}, nil
+}
+
+type purgeTestIndex struct {
+	backends.APIIndex
+	processed *[]string
+}
+
+func (pi purgeTestIndex) DeleteUserDocuments(userId, shardId string) (int64, error) {
+	*pi.processed = append(*pi.processed, PurgeStepIndex)
+	return 3, nil
+}
+
+func (pi purgeTestIndex) CountUserDocuments(userId, shardId string) (int64, error) {
+	return 0, nil
+}
+
+func initPurgeRest(user *User, failAt string) (*RESTfacility, *purgeTestStore) {
+	processed := []string{}
+	store := &purgeTestStore{FakeStore: backendstest.NewFakeStore(), processed: &processed, failAt: failAt}
+	store.Users = []*User{user}
+	rest := new(RESTfacility)
+	rest.Cache, _, _ = cache.InitializeTestCache()
+	rest.store = store
+	rest.index = purgeTestIndex{processed: &processed}
+	return rest, store
+}
+
+func TestRESTfacility_PurgeUser(t *testing.T) {
+	user := &User{UserId: UUID(uuid.NewV4()), ShardId: "shard", DateDelete: time.Now()}
+	rest, store := initPurgeRest(user, PurgeStepMessages)
+	userId := user.UserId.String()
+
+	purge, err := rest.PurgeUser(userId)
+	if err == nil || err.Code() != FailDependencyCaliopenErr {
+		t.Fatalf("expected purge to fail at messages step, got %v", err)
+	}
+	if purge.Step != PurgeStepMessages || purge.LastError == "" || purge.Completed() {
+		t.Errorf("expected purge to stop at messages step with an error, got %+v", purge)
+	}
+	saved := store.Purges[userId]
+	if saved.Step != PurgeStepMessages || saved.Counts[PurgeStepIndex] != 3 {
+		t.Errorf("expected progress to be saved, got %+v", saved)
+	}
+
+	// lease is still held by the interrupted worker
+	if _, err = rest.PurgeUser(userId); err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected purge to be forbidden while leased, got %v", err)
+	}
+
+	// lease expired : purge resumes from the failed step
+	store.Purges[userId].LeaseUntil = time.Now().Add(-time.Second)
+	*store.processed = []string{}
+	store.failAt = ""
+	purge, err = rest.PurgeUser(userId)
+	if err != nil {
+		t.Fatalf("expected purge to complete, got %v", err)
+	}
+	expected := []string{PurgeStepMessages, PurgeStepContacts, PurgeStepDiscussions, PurgeStepDevices, PurgeStepAccount}
+	if !reflect.DeepEqual(*store.processed, expected) {
+		t.Errorf("expected resumed steps %v, got %v", expected, *store.processed)
+	}
+	if !purge.Completed() || purge.DateEnd.IsZero() || purge.LastError != "" || !store.Purges[userId].Completed() {
+		t.Errorf("expected purge to be completed, got %+v", purge)
+	}
+	if len(store.CallsTo("AnonymizeUser")) != 1 {
+		t.Error("expected user to be anonymized")
+	}
+	if purge.Counts[PurgeStepMessages] != 2 || purge.Counts[PurgeStepIdentities] != 2 || purge.Counts[PurgeStepAccount] != 3 {
+		t.Errorf("unexpected counts %v", purge.Counts)
+	}
+
+	// completed purge is not run again
+	*store.processed = []string{}
+	if _, err = rest.PurgeUser(userId); err != nil || len(*store.processed) != 0 {
+		t.Errorf("expected completed purge to be left as is, got %v and steps %v", err, *store.processed)
+	}
+}
+
+func TestRESTfacility_PurgeUser_notDeleted(t *testing.T) {
+	user := &User{UserId: UUID(uuid.NewV4())}
+	rest, store := initPurgeRest(user, "")
+	_, err := rest.PurgeUser(user.UserId.String())
+	if err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected purge of an active user to be forbidden, got %v", err)
+	}
+	if len(*store.processed) != 0 {
+		t.Errorf("expected no step to be processed, got %v", *store.processed)
+	}
+}
+
+func TestRESTfacility_VerifyUserPurge(t *testing.T) {
+	user := &User{UserId: UUID(uuid.NewV4()), DateDelete: time.Now()}
+	rest, _ := initPurgeRest(user, "")
+	userId := user.UserId.String()
+	// token of a device that was unknown at purge time
+	rest.Cache.Backend.Set("tokens::"+userId+"-device", []byte(`{"access_token":"token"}`), time.Hour)
+
+	counts, err := rest.VerifyUserPurge(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"vault": 1, "cache": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected leftovers %v, got %v", expected, counts)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/bitly/go-simplejson"
+	"time"
+)
+
+// SavedSearchResults are the messages currently matching a saved search
+type SavedSearchResults struct {
+	Result *IndexResult
+	Search *SavedSearch
+	Unread int64 // count of unread messages matching search
+}
+
+func (rest *RESTfacility) RetrieveSavedSearches(userId string) ([]SavedSearch, CaliopenError) {
+	searches, err := rest.store.RetrieveSavedSearches(userId)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] RetrieveSavedSearches failed")
+	}
+	return searches, nil
+}
+
+func (rest *RESTfacility) RetrieveSavedSearch(userId, searchId string) (*SavedSearch, CaliopenError) {
+	search, err := rest.store.RetrieveSavedSearch(userId, searchId)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, WrapCaliopenErr(err, NotFoundCaliopenErr, "[RESTfacility] saved search not found")
+		}
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] RetrieveSavedSearch failed")
+	}
+	return search, nil
+}
+
+// CreateSavedSearch validates search and its auto tag before storing it.
+// Search is updated in-place with its new properties.
+func (rest *RESTfacility) CreateSavedSearch(search *SavedSearch) CaliopenError {
+	if err := rest.validateSavedSearch(search); err != nil {
+		return err
+	}
+	search.SearchId = EmptyUUID
+	search.DateInsert = time.Time{}
+	search.MarshallNew()
+	if err := rest.store.CreateSavedSearch(search); err != nil {
+		return WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] CreateSavedSearch failed to create search in store")
+	}
+	return nil
+}
+
+// PatchSavedSearch applies patch to a saved search and returns the updated search
+func (rest *RESTfacility) PatchSavedSearch(patch []byte, userId, searchId string) (*SavedSearch, CaliopenError) {
+	current, e := rest.RetrieveSavedSearch(userId, searchId)
+	if e != nil {
+		return nil, e
+	}
+
+	patchReader, err := simplejson.NewJson(patch)
+	if err != nil {
+		return nil, WrapCaliopenErrf(err, FailDependencyCaliopenErr, "[RESTfacility] PatchSavedSearch failed with simplejson error : %s", err)
+	}
+	if _, hasCurrentState := patchReader.CheckGet("current_state"); !hasCurrentState {
+		return nil, NewCaliopenErr(ForbiddenCaliopenErr, "[RESTfacility] PatchSavedSearch : current_state property must be in patch")
+	}
+
+	newSearch, _, err := helpers.UpdateWithPatch(patch, current, UserActor)
+	if err != nil {
+		return nil, WrapCaliopenErrf(err, UnprocessableCaliopenErr, "[RESTfacility] PatchSavedSearch failed with UpdateWithPatch error : %s", err)
+	}
+	search := newSearch.(*SavedSearch)
+	if e := rest.validateSavedSearch(search); e != nil {
+		return nil, e
+	}
+	if err = rest.store.UpdateSavedSearch(search); err != nil {
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] PatchSavedSearch failed to update search in store")
+	}
+	return search, nil
+}
+
+func (rest *RESTfacility) DeleteSavedSearch(userId, searchId string) CaliopenError {
+	if _, e := rest.RetrieveSavedSearch(userId, searchId); e != nil {
+		return e
+	}
+	if err := rest.store.DeleteSavedSearch(userId, searchId); err != nil {
+		return WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] DeleteSavedSearch failed to delete search in store")
+	}
+	return nil
+}
+
+// RetrieveSavedSearchResults runs a saved search over user's messages within ilRange, and counts the unread ones
+func (rest *RESTfacility) RetrieveSavedSearchResults(user *UserInfo, searchId string, limit, offset int, ilRange [2]int8) (*SavedSearchResults, CaliopenError) {
+	saved, e := rest.RetrieveSavedSearch(user.User_id, searchId)
+	if e != nil {
+		return nil, e
+	}
+	search, err := saved.IndexSearch(user)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, UnprocessableCaliopenErr, "[RESTfacility] saved search is invalid")
+	}
+	search.Limit, search.Offset = limit, offset
+	search.ILrange = ilRange
+	result, err := rest.Search(search)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, IndexCaliopenErr, "[RESTfacility] RetrieveSavedSearchResults failed to search messages")
+	}
+
+	unread := search
+	unread.Query = append(SearchQuery{{Field: SearchFieldIs, Operator: ":", Value: "unread"}}, search.Query...)
+	count, err := rest.index.Count(unread)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, IndexCaliopenErr, "[RESTfacility] RetrieveSavedSearchResults failed to count unread messages")
+	}
+	return &SavedSearchResults{Result: result, Search: saved, Unread: count}, nil
+}
+
+// validateSavedSearch checks search's clauses, and that its auto tag is one of user's tags
+func (rest *RESTfacility) validateSavedSearch(search *SavedSearch) CaliopenError {
+	if err := search.Validate(); err != nil {
+		return WrapCaliopenErr(err, UnprocessableCaliopenErr, "[RESTfacility] invalid saved search")
+	}
+	if search.AutoTag != "" {
+		if _, err := rest.store.RetrieveTag(search.UserId.String(), search.AutoTag); err != nil {
+			return WrapCaliopenErrf(err, UnprocessableCaliopenErr, "[RESTfacility] unknown tag <%s> for saved search", search.AutoTag)
+		}
+	}
+	return nil
+}
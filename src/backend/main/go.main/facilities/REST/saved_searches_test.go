@@ -0,0 +1,94 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+// searchesTestIndex returns no message and counts 3 unread ones
+type searchesTestIndex struct {
+	backends.APIIndex
+	searches *[]IndexSearch
+}
+
+func (si searchesTestIndex) Search(search IndexSearch) (*IndexResult, error) {
+	*si.searches = append(*si.searches, search)
+	return &IndexResult{}, nil
+}
+func (si searchesTestIndex) Count(search IndexSearch) (int64, error) {
+	*si.searches = append(*si.searches, search)
+	return 3, nil
+}
+
+func TestRESTfacility_SavedSearches(t *testing.T) {
+	user := &UserInfo{User_id: uuid.NewV4().String(), Shard_id: "shard"}
+	var userId UUID
+	userId.UnmarshalBinary(uuid.FromStringOrNil(user.User_id).Bytes())
+	// user has a single "work" tag
+	store := backendstest.NewFakeStore()
+	store.Tags = []Tag{{User_id: userId, Name: "work"}}
+	searches := []IndexSearch{}
+	rest := new(RESTfacility)
+	rest.store = store
+	rest.index = searchesTestIndex{searches: &searches}
+
+	for _, invalid := range []*SavedSearch{
+		{UserId: userId, Query: "from:alice"},
+		{UserId: userId, Name: "nothing"},
+		{UserId: userId, Name: "invalid", Query: "is:starred"},
+		{UserId: userId, Name: "invalid filter", Filters: SearchQuery{{Field: "pi", Value: "50"}}},
+		{UserId: userId, Name: "unknown tag", Query: "from:alice", AutoTag: "personal"},
+	} {
+		if err := rest.CreateSavedSearch(invalid); err == nil || err.Code() != UnprocessableCaliopenErr {
+			t.Errorf("expected search %+v to be rejected, got %v", invalid, err)
+		}
+	}
+
+	search := &SavedSearch{UserId: userId, Name: "from boss", Query: "from:boss", Filters: SearchQuery{{Field: "Tag", Value: "spam", Negated: true}}, AutoTag: "work"}
+	if err := rest.CreateSavedSearch(search); err != nil {
+		t.Fatal(err)
+	}
+	if search.SearchId == EmptyUUID || search.DateInsert.IsZero() {
+		t.Errorf("expected search to be marshalled as new, got %+v", search)
+	}
+
+	patched, err := rest.PatchSavedSearch([]byte(`{"name":"boss","current_state":{"name":"from boss"}}`), user.User_id, search.SearchId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Name != "boss" || patched.Query != "from:boss" || store.SavedSearches[0].Name != "boss" {
+		t.Errorf("expected search to be renamed, got %+v", patched)
+	}
+	if _, err = rest.PatchSavedSearch([]byte(`{"query":"is:starred","current_state":{"query":"from:boss"}}`), user.User_id, search.SearchId.String()); err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected invalid patch to be rejected, got %v", err)
+	}
+
+	results, err := rest.RetrieveSavedSearchResults(user, search.SearchId.String(), 10, 0, [2]int8{0, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Unread != 3 || results.Search.Name != "boss" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if len(searches) != 2 || searches[0].DocType != MessageIndexType || searches[0].Limit != 10 || searches[0].Shard_id != "shard" || searches[0].ILrange != [2]int8{0, 10} {
+		t.Fatalf("unexpected index searches %+v", searches)
+	}
+	expected := SearchQuery{{Field: SearchFieldFrom, Operator: ":", Value: "boss"}, {Field: SearchFieldTag, Operator: ":", Value: "spam", Negated: true}}
+	if len(searches[0].Query) != 2 || searches[0].Query[0] != expected[0] || searches[0].Query[1] != expected[1] {
+		t.Errorf("expected search clauses %+v, got %+v", expected, searches[0].Query)
+	}
+	if len(searches[1].Query) != 3 || searches[1].Query[0].Value != "unread" {
+		t.Errorf("expected unread messages to be counted, got %+v", searches[1].Query)
+	}
+
+	if _, err = rest.RetrieveSavedSearchResults(user, uuid.NewV4().String(), 0, 0, [2]int8{-10, 10}); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected unknown search not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
+	log "github.com/Sirupsen/logrus"
+	"github.com/satori/go.uuid"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScanInterval      = 5 * time.Second
+	scheduledSendsBatch      = 100             // max drafts sent by scheduler at each scan
+	scheduledSendRetryDelay  = time.Minute     // delay before scheduler tries again to send a draft that failed to be sent
+	scheduledSendLease       = 5 * time.Minute // delay before a draft claimed by a sender that did not complete is sent again
+	maxScheduledSendAttempts = 5               // failed attempts after which scheduler gives up sending a draft
+)
+
+// ScheduleDraft holds draft in a scheduled state until sendAt, when scheduler will send it.
+// If sendAt is zero, draft is held during the configured undo delay, or sent right now if there is no undo delay.
+func (rest *RESTfacility) ScheduleDraft(user_info *UserInfo, msg_id string, sendAt time.Time) (*Message, CaliopenError) {
+	if sendAt.IsZero() {
+		if rest.scheduledSend.UndoDelay <= 0 {
+			msg, err := rest.SendDraft(user_info, msg_id)
+			if err != nil {
+				return nil, WrapCaliopenErr(err, UnprocessableCaliopenErr, err.Error())
+			}
+			return msg, nil
+		}
+		sendAt = time.Now().Add(time.Duration(rest.scheduledSend.UndoDelay) * time.Second)
+	} else if sendAt.Before(time.Now()) {
+		return nil, NewCaliopenErr(UnprocessableCaliopenErr, "send_at must be in the future")
+	}
+
+	draft, err := rest.retrieveDraft(user_info.User_id, msg_id)
+	if err != nil {
+		return nil, err
+	}
+	if outgoings, statuses := rest.splitDraft(user_info, draft); len(outgoings) == 0 {
+		if len(statuses) > 0 {
+			return nil, NewCaliopenErr(UnprocessableCaliopenErr, statuses[0].Error)
+		}
+		return nil, NewCaliopenErr(UnprocessableCaliopenErr, "draft has no recipient to send to")
+	}
+	if !draft.Send_at.IsZero() {
+		// draft is rescheduled
+		unscheduled, e := rest.Cache.UnscheduleSend(user_info.User_id, msg_id)
+		if e != nil {
+			return nil, WrapCaliopenErr(e, UnknownCaliopenErr, "failed to reschedule draft")
+		}
+		if !unscheduled {
+			return nil, NewCaliopenErr(ForbiddenCaliopenErr, "draft is already being sent")
+		}
+	}
+
+	// cache is the scheduler's source of truth, scheduled_send table keeps it for cache to be rebuilt,
+	// message's send time in store and index make the scheduled state visible to user
+	send := ScheduledSend{
+		MessageId: msg_id,
+		SendAt:    sendAt,
+		UserId:    user_info.User_id,
+	}
+	if e := rest.store.SaveScheduledSend(&send); e != nil {
+		return nil, WrapCaliopenErr(e, DbCaliopenErr, "failed to schedule draft")
+	}
+	if e := rest.Cache.ScheduleSend(send); e != nil {
+		rest.store.DeleteScheduledSend(user_info.User_id, msg_id)
+		return nil, WrapCaliopenErr(e, UnknownCaliopenErr, "failed to schedule draft")
+	}
+	draft.Send_at = sendAt
+	if err = rest.updateSendAt(user_info, draft, sendAt); err != nil {
+		rest.Cache.UnscheduleSend(user_info.User_id, msg_id)
+		rest.store.DeleteScheduledSend(user_info.User_id, msg_id)
+		return nil, err
+	}
+	messages.SanitizeMessageBodies(draft)
+	(*draft).Body_excerpt = messages.ExcerptMessage(*draft, 200, true, true)
+	return draft, nil
+}
+
+// CancelScheduledSend takes draft back from scheduler, as long as it has not been handed over to a sender yet.
+func (rest *RESTfacility) CancelScheduledSend(user_info *UserInfo, msg_id string) (*Message, CaliopenError) {
+	draft, err := rest.retrieveDraft(user_info.User_id, msg_id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Send_at.IsZero() {
+		return nil, NewCaliopenErrf(UnprocessableCaliopenErr, "draft %s is not scheduled for sending", msg_id)
+	}
+	unscheduled, e := rest.Cache.UnscheduleSend(user_info.User_id, msg_id)
+	if e != nil {
+		return nil, WrapCaliopenErr(e, UnknownCaliopenErr, "failed to cancel scheduled send")
+	}
+	if !unscheduled {
+		return nil, NewCaliopenErr(ForbiddenCaliopenErr, "too late, draft is already being sent")
+	}
+	if e = rest.store.DeleteScheduledSend(user_info.User_id, msg_id); e != nil {
+		// scheduler drops drafts without send time if they are restored into cache
+		log.WithError(e).Warnf("[ScheduledSend] failed to remove scheduled send of draft %s from store", msg_id)
+	}
+	draft.Send_at = time.Time{}
+	if err = rest.updateSendAt(user_info, draft, nil); err != nil {
+		return nil, err
+	}
+	messages.SanitizeMessageBodies(draft)
+	(*draft).Body_excerpt = messages.ExcerptMessage(*draft, 200, true, true)
+	return draft, nil
+}
+
+// StartSendScheduler launches the loop that sends drafts when they are due, until returned stop func is called.
+// Scheduled drafts are kept in store, and put back into cache when scheduler starts,
+// thus pending drafts are not lost if cache has been flushed.
+func (rest *RESTfacility) StartSendScheduler(notifier Notifications.Notifiers) (stop func()) {
+	interval := time.Duration(rest.scheduledSend.ScanInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultScanInterval
+	}
+	halt := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rest.restoreScheduledSends()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-halt:
+				return
+			case <-ticker.C:
+				rest.sendDueDrafts(notifier)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(halt) })
+		// wait for drafts being sent
+		<-done
+	}
+}
+
+// restoreScheduledSends puts drafts saved in store back into scheduler's cache
+func (rest *RESTfacility) restoreScheduledSends() {
+	sends, err := rest.store.RetrieveScheduledSends()
+	if err != nil {
+		log.WithError(err).Warn("[SendScheduler] failed to retrieve scheduled drafts from store")
+		return
+	}
+	for _, send := range sends {
+		if e := rest.Cache.ScheduleSend(send); e != nil {
+			log.WithError(e).Warnf("[SendScheduler] failed to restore scheduled draft %s", send.MessageId)
+		}
+	}
+	log.Infof("[SendScheduler] %d scheduled draft(s) restored", len(sends))
+}
+
+func (rest *RESTfacility) sendDueDrafts(notifier Notifications.Notifiers) {
+	sends, err := rest.Cache.DueScheduledSends(time.Now(), scheduledSendsBatch)
+	if err != nil {
+		log.WithError(err).Warn("[SendScheduler] failed to retrieve due drafts")
+		return
+	}
+	for _, send := range sends {
+		rest.sendScheduledDraft(send, notifier)
+	}
+}
+
+// sendScheduledDraft sends a due draft if this API instance succeeds to claim it from scheduler.
+// Draft leaves scheduler only once it has been sent, failures reschedule it.
+func (rest *RESTfacility) sendScheduledDraft(send ScheduledSend, notifier Notifications.Notifiers) {
+	claimed, err := rest.Cache.ClaimScheduledSend(send.UserId, send.MessageId, scheduledSendLease)
+	if err != nil || !claimed {
+		// cancelled by user or taken by another API instance
+		return
+	}
+	draft, err := rest.store.RetrieveMessage(send.UserId, send.MessageId)
+	if err != nil {
+		if err.Error() == "not found" {
+			log.WithError(err).Warnf("[SendScheduler] draft %s not found, dropping it", send.MessageId)
+			rest.completeScheduledSend(send)
+			return
+		}
+		log.WithError(err).Warnf("[SendScheduler] failed to retrieve draft %s, retrying in %s", send.MessageId, scheduledSendRetryDelay)
+		rest.rescheduleDraft(send, nil, err, notifier)
+		return
+	}
+	if !draft.Is_draft || draft.Send_at.IsZero() {
+		// draft has been sent or cancelled in the meantime
+		rest.completeScheduledSend(send)
+		return
+	}
+	user_info := &UserInfo{User_id: send.UserId, Shard_id: rest.store.GetShardForUser(send.UserId)}
+	if _, err = rest.sendDraft(user_info, draft); err != nil {
+		log.WithError(err).Warnf("[SendScheduler] failed to send draft %s", send.MessageId)
+		rest.rescheduleDraft(send, draft, err, notifier)
+		return
+	}
+	rest.completeScheduledSend(send)
+}
+
+// completeScheduledSend takes a claimed draft out of scheduler, from store first for it not to be restored afterwards
+func (rest *RESTfacility) completeScheduledSend(send ScheduledSend) {
+	if err := rest.store.DeleteScheduledSend(send.UserId, send.MessageId); err != nil {
+		log.WithError(err).Warnf("[SendScheduler] failed to remove scheduled send of draft %s from store", send.MessageId)
+	}
+	rest.Cache.CompleteScheduledSend(send.UserId, send.MessageId)
+}
+
+// rescheduleDraft gives a claimed draft back to scheduler, to be sent again after scheduledSendRetryDelay.
+// After maxScheduledSendAttempts failures, scheduler gives up : draft loses its send time and user is notified.
+// Drafts that could not be retrieved are retried until store is back.
+// If rescheduling fails, lease expiry will make scheduler send it again anyway.
+func (rest *RESTfacility) rescheduleDraft(send ScheduledSend, draft *Message, cause error, notifier Notifications.Notifiers) {
+	if saved, err := rest.store.RetrieveScheduledSend(send.UserId, send.MessageId); err == nil {
+		send.Attempts = saved.Attempts
+	}
+	send.Attempts++
+	user_info := &UserInfo{User_id: send.UserId, Shard_id: rest.store.GetShardForUser(send.UserId)}
+	if draft != nil && send.Attempts >= maxScheduledSendAttempts {
+		log.WithError(cause).Errorf("[SendScheduler] giving up sending draft %s after %d attempts", send.MessageId, send.Attempts)
+		draft.Send_at = time.Time{}
+		if err := rest.updateSendAt(user_info, draft, nil); err != nil {
+			// lease expiry will make scheduler try again
+			return
+		}
+		rest.completeScheduledSend(send)
+		rest.notifyScheduledSendFailure(send, cause, notifier)
+		return
+	}
+	send.SendAt = time.Now().Add(scheduledSendRetryDelay)
+	if e := rest.store.SaveScheduledSend(&send); e != nil {
+		log.WithError(e).Warnf("[SendScheduler] failed to save attempts of draft %s", send.MessageId)
+	}
+	if e := rest.Cache.ScheduleSend(send); e != nil {
+		log.WithError(e).Errorf("[SendScheduler] failed to reschedule draft %s", send.MessageId)
+		return
+	}
+	if draft != nil {
+		// sendDraft may have removed send time from draft
+		rest.updateSendAt(user_info, draft, send.SendAt)
+	}
+	rest.Cache.ReleaseScheduledSend(send.UserId, send.MessageId)
+}
+
+// notifyScheduledSendFailure lets user know that a scheduled draft has been given back as a draft because it could not be sent
+func (rest *RESTfacility) notifyScheduledSendFailure(send ScheduledSend, cause error, notifier Notifications.Notifiers) {
+	if notifier == nil {
+		return
+	}
+	content := map[string]interface{}{
+		"message_id": send.MessageId,
+		"attempts":   send.Attempts,
+	}
+	if cause != nil {
+		content["error"] = cause.Error()
+	}
+	body, err := json.Marshal(map[string]interface{}{"scheduledSendFailed": content})
+	if err != nil {
+		log.WithError(err).Warn("[SendScheduler] failed to marshal scheduledSendFailed notification")
+		return
+	}
+	notif := &Notification{
+		Body:    string(body),
+		Emitter: "api",
+		NotifId: UUID(uuid.NewV1()),
+		TTLcode: LongLived,
+		Type:    EventNotif,
+		User:    &User{UserId: UUID(uuid.FromStringOrNil(send.UserId))},
+	}
+	notifyByQueue(notifier, notif)
+}
+
+// retrieveDraft returns message if it belongs to user and is a draft
+func (rest *RESTfacility) retrieveDraft(userId, msg_id string) (*Message, CaliopenError) {
+	draft, err := rest.store.RetrieveMessage(userId, msg_id)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, WrapCaliopenErr(err, NotFoundCaliopenErr, "draft not found")
+		}
+		return nil, WrapCaliopenErr(err, DbCaliopenErr, "failed to retrieve draft")
+	}
+	if !draft.Is_draft {
+		return nil, NewCaliopenErrf(ForbiddenCaliopenErr, "message %s is not a draft", msg_id)
+	}
+	return draft, nil
+}
+
+// updateSendAt saves draft's send time into store and index. A nil sendAt removes send time.
+func (rest *RESTfacility) updateSendAt(user_info *UserInfo, draft *Message, sendAt interface{}) CaliopenError {
+	fields := map[string]interface{}{
+		"Send_at": sendAt,
+	}
+	if err := rest.store.UpdateMessage(draft, fields); err != nil {
+		log.WithError(err).Warn("[ScheduledSend] Store.UpdateMessage operation failed")
+		return WrapCaliopenErr(err, DbCaliopenErr, "failed to update draft")
+	}
+	if err := rest.index.UpdateMessage(user_info, draft, fields); err != nil {
+		log.WithError(err).Warn("[ScheduledSend] Index.UpdateMessage operation failed")
+		return WrapCaliopenErr(err, IndexCaliopenErr, "failed to update draft")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/cache"
+	"testing"
+	"time"
+)
+
+const sentMessageId = "b26e5ba4-34cc-42bb-9b70-5279648134f8"
+
+func initSchedulerRest() *RESTfacility {
+	rest := new(RESTfacility)
+	rest.Cache, _, _ = cache.InitializeTestCache()
+	rest.store = backendstest.APIStore{
+		MessagesBackend:    backendstest.GetMessagesBackend(),
+		ScheduledSendStore: backendstest.GetScheduledSendStore(),
+	}
+	rest.scheduledSend = ScheduledSendConfig{UndoDelay: 10}
+	return rest
+}
+
+func TestRESTfacility_ScheduleDraft(t *testing.T) {
+	rest := initSchedulerRest()
+	user := &UserInfo{User_id: backendstest.EmmaTommeUserId}
+
+	_, err := rest.ScheduleDraft(user, sentMessageId, time.Now().Add(-time.Hour))
+	if err == nil || err.Code() != UnprocessableCaliopenErr {
+		t.Errorf("expected send_at in the past to be unprocessable, got %v", err)
+	}
+	_, err = rest.ScheduleDraft(user, "unknown", time.Time{})
+	if err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected scheduling an unknown draft to return not found, got %v", err)
+	}
+	_, err = rest.ScheduleDraft(user, sentMessageId, time.Now().Add(time.Hour))
+	if err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected scheduling a sent message to be forbidden, got %v", err)
+	}
+	if due, _ := rest.Cache.DueScheduledSends(time.Now().Add(2*time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected no draft to be scheduled, got %+v", due)
+	}
+}
+
+func TestRESTfacility_CancelScheduledSend(t *testing.T) {
+	rest := initSchedulerRest()
+	user := &UserInfo{User_id: backendstest.EmmaTommeUserId}
+
+	_, err := rest.CancelScheduledSend(user, "unknown")
+	if err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected cancelling an unknown draft to return not found, got %v", err)
+	}
+	_, err = rest.CancelScheduledSend(user, sentMessageId)
+	if err == nil || err.Code() != ForbiddenCaliopenErr {
+		t.Errorf("expected cancelling a sent message to be forbidden, got %v", err)
+	}
+}
+
+func TestRESTfacility_sendScheduledDraft(t *testing.T) {
+	rest := initSchedulerRest()
+	send := ScheduledSend{
+		MessageId: sentMessageId,
+		SendAt:    time.Now().Add(-time.Second),
+		UserId:    backendstest.EmmaTommeUserId,
+	}
+	rest.store.SaveScheduledSend(&send)
+	rest.Cache.ScheduleSend(send)
+
+	// message is not a draft anymore : scheduler must drop it without trying to send it
+	rest.sendDueDrafts(nil)
+	if due, _ := rest.Cache.DueScheduledSends(time.Now().Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected scheduler to drop sent message, got %+v", due)
+	}
+	if sends, _ := rest.store.RetrieveScheduledSends(); len(sends) != 0 {
+		t.Errorf("expected scheduler to remove sent message from store, got %+v", sends)
+	}
+}
+
+func TestRESTfacility_rescheduleDraft(t *testing.T) {
+	rest := initSchedulerRest()
+	send := ScheduledSend{
+		MessageId: "unknown",
+		SendAt:    time.Now().Add(-time.Second),
+		UserId:    backendstest.EmmaTommeUserId,
+	}
+	rest.store.SaveScheduledSend(&send)
+	for i := 1; i <= maxScheduledSendAttempts; i++ {
+		rest.rescheduleDraft(send, nil, nil, nil)
+		saved, err := rest.store.RetrieveScheduledSend(send.UserId, send.MessageId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Attempts != i {
+			t.Errorf("expected %d attempt(s) to be saved, got %d", i, saved.Attempts)
+		}
+		if !saved.SendAt.After(time.Now()) {
+			t.Error("expected draft to be rescheduled in the future")
+		}
+	}
+}
+
+func TestRESTfacility_StartSendScheduler(t *testing.T) {
+	rest := initSchedulerRest()
+	rest.scheduledSend.ScanInterval = 3600
+	send := ScheduledSend{
+		MessageId: sentMessageId,
+		SendAt:    time.Now().Add(time.Hour),
+		UserId:    backendstest.EmmaTommeUserId,
+	}
+	rest.store.SaveScheduledSend(&send)
+
+	stop := rest.StartSendScheduler(nil)
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for scheduler to stop")
+	}
+	// cache must have been rebuilt from store
+	due, _ := rest.Cache.DueScheduledSends(time.Now().Add(2*time.Hour), 10)
+	if len(due) != 1 || due[0].MessageId != sentMessageId {
+		t.Errorf("expected scheduled draft to be restored from store, got %+v", due)
+	}
+	stop()
+}
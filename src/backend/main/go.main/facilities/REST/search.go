@@ -20,6 +20,9 @@ func (rest *RESTfacility) Search(search IndexSearch) (response *IndexResult, err
 			return nil, errors.New("[RESTfacility] invalid search request: params 'offset', 'limit' are only accepted if param 'doc_type' is also provided")
 		}
 	}
+	if err := search.Query.Validate(); err != nil {
+		return nil, err
+	}
 
 	// trigger the search
 	result, err := rest.index.Search(search)
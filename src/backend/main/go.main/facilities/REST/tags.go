@@ -221,6 +221,7 @@ func (rest *RESTfacility) UpdateResourceTags(user *UserInfo, resourceID, resourc
 		if err != nil {
 			return WrapCaliopenErr(err, IndexCaliopenErr, "[RESTfacility] UpdateResourceTags")
 		}
+		go rest.pushFlagsToRemotes(user.User_id, newObj.(*Message))
 	case ContactType:
 		update := map[string]interface{}{
 			"Tags": newObj.(*Contact).Tags,
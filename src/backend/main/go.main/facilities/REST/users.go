@@ -5,6 +5,7 @@
 package REST
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -246,6 +247,18 @@ func (rest *RESTfacility) DeleteUser(payload ActionsPayload) CaliopenError {
 			return WrapCaliopenErr(err, DbCaliopenErr, "[RESTfacility] DeleteUser failed to delete user in store")
 		}
 
+		// user's data are purged asynchronously by purge workers.
+		// Purge is recorded first for workers to resume it if users topic message is lost.
+		err = rest.store.SaveUserPurge(NewUserPurge(user.UserId, time.Now()))
+		if err != nil {
+			logrus.WithError(err).Warnf("[RESTfacility] DeleteUser failed to record purge of user %s", payload.UserId)
+		}
+		order, _ := json.Marshal(UserActionMessage{Message: "deleted", UserId: payload.UserId, UserName: user.Name})
+		err = rest.nats_conn.Publish(rest.natsTopics[Nats_Users_topicKey], order)
+		if err != nil {
+			logrus.WithError(err).Warnf("[RESTfacility] DeleteUser failed to publish deletion of user %s", payload.UserId)
+		}
+
 		// Logout
 		err = rest.Cache.LogoutUser(params.AccessToken)
 
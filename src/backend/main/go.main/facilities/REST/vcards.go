@@ -0,0 +1,108 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"bytes"
+	"encoding/hex"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	log "github.com/Sirupsen/logrus"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/satori/go.uuid"
+	"strings"
+)
+
+const vCardKeyLabel = "vcard" // label given to PGP keys imported from vCards
+
+// ImportVCards creates a new contact for each vCard found in data,
+// with the PGP keys embedded in cards.
+// A key that can't be imported (bad format, no matching email…) doesn't prevent its contact creation.
+func (rest *RESTfacility) ImportVCards(user *UserInfo, data []byte) ([]*Contact, CaliopenError) {
+	cards, err := helpers.UnmarshalVCards(data)
+	if err != nil {
+		return nil, WrapCaliopenErr(err, UnprocessableCaliopenErr, "[RESTfacility] ImportVCards failed to parse vCards")
+	}
+	contacts := make([]*Contact, 0, len(cards))
+	for _, card := range cards {
+		keys := card.PublicKeys
+		card.PublicKeys = nil
+		card.UserId.UnmarshalBinary(uuid.FromStringOrNil(user.User_id).Bytes())
+		if err := rest.CreateContact(card); err != nil {
+			return contacts, WrapCaliopenErrf(err, DbCaliopenErr, "[RESTfacility] ImportVCards failed to create contact %d of %d", len(contacts)+1, len(cards))
+		}
+		rest.addContactKeys(card, keys, vCardKeyLabel)
+		contacts = append(contacts, card)
+	}
+	return contacts, nil
+}
+
+// ExportVCards returns contacts as vCards of given version, with their PGP keys.
+// All user's contacts are exported if contactIds is empty.
+func (rest *RESTfacility) ExportVCards(userId string, contactIds []string, version string) ([]byte, CaliopenError) {
+	vcards := new(bytes.Buffer)
+	if len(contactIds) == 0 {
+		contacts, err := rest.retrieveAddressBookContacts(userId)
+		if err != nil {
+			return nil, err
+		}
+		for _, contact := range contacts {
+			vcards.Write(helpers.MarshalVCardVersion(contact, version))
+		}
+		return vcards.Bytes(), nil
+	}
+	for _, contactId := range contactIds {
+		contact, err := rest.RetrieveContact(userId, contactId)
+		if err != nil || !contact.Deleted.IsZero() {
+			return nil, WrapCaliopenErrf(err, NotFoundCaliopenErr, "[RESTfacility] ExportVCards contact %s not found", contactId)
+		}
+		rest.loadContactKeys(contact)
+		vcards.Write(helpers.MarshalVCardVersion(contact, version))
+	}
+	return vcards.Bytes(), nil
+}
+
+// loadContactKeys embeds contact's PGP keys, which are stored in their own table
+func (rest *RESTfacility) loadContactKeys(contact *Contact) {
+	keys, err := rest.RetrieveContactPubKeys(contact.UserId.String(), contact.ContactId.String())
+	if err != nil {
+		log.WithError(err).Warnf("[RESTfacility] failed to retrieve keys of contact %s", contact.ContactId.String())
+		return
+	}
+	contact.PublicKeys = keys
+}
+
+// addContactKeys creates contact's keys given by a vCard or another contact, unless a key with the same fingerprint already exists.
+// Keys without a label are labelled with defaultLabel.
+func (rest *RESTfacility) addContactKeys(contact *Contact, keys []PublicKey, defaultLabel string) {
+	for _, key := range keys {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.Key))
+		if err != nil || len(entities) == 0 {
+			log.WithError(err).Warnf("[RESTfacility] invalid PGP key for contact %s", contact.ContactId.String())
+			continue
+		}
+		fingerprint := strings.ToUpper(hex.EncodeToString(entities[0].PrimaryKey.Fingerprint[:]))
+		known := false
+		for _, existing := range contact.PublicKeys {
+			if existing.Fingerprint == fingerprint {
+				known = true
+				break
+			}
+		}
+		if known {
+			continue
+		}
+		label := key.Label
+		if label == "" {
+			label = defaultLabel
+		}
+		pubKey, e := rest.CreatePGPPubKey(label, []byte(key.Key), contact)
+		if e != nil {
+			log.WithError(e).Warnf("[RESTfacility] failed to import PGP key %s for contact %s", fingerprint, contact.ContactId.String())
+			continue
+		}
+		contact.PublicKeys = append(contact.PublicKeys, *pubKey)
+	}
+}
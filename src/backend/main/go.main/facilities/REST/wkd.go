@@ -0,0 +1,128 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// WKDEnabled tells if users' keys are published within Web Key Directory
+func (rest *RESTfacility) WKDEnabled() bool {
+	return rest.wkd.Enable
+}
+
+// RetrieveWKDKeys returns the binary keyring published in Web Key Directory for the local identity whose hashed local-part is hash.
+// localPart (the optional `l` query parameter) is checked against hash when WKD client gives it.
+// Hash is resolved through the lookup written along with local identities,
+// keys are the ones of the identity's owner own contact which hold the address and have been uploaded or confirmed by user.
+// Submission address' key is served when Web Key Service is enabled.
+func (rest *RESTfacility) RetrieveWKDKeys(domain, hash, localPart string) ([]byte, CaliopenError) {
+	if localPart != "" && WKDHash(localPart) != hash {
+		return nil, NewCaliopenErr(NotFoundCaliopenErr, "[RetrieveWKDKeys] local-part does not match hash")
+	}
+	if rest.wksKey != nil && hash == WKDHash(rest.wkd.SubmissionLocalPart) {
+		return rest.wksKey, nil
+	}
+	lookup, err := rest.store.LookupWKDIdentity(domain, hash)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RetrieveWKDKeys] no local identity of %s for hash %s", domain, hash)
+		}
+		return nil, WrapCaliopenErrf(err, DbCaliopenErr, "[RetrieveWKDKeys] lookup failed for %s", hash)
+	}
+	userId := lookup.UserId.String()
+	contactId := rest.store.RetrieveUserContactId(userId)
+	if contactId == "" {
+		return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RetrieveWKDKeys] no contact for user %s", userId)
+	}
+	keys, e := rest.store.RetrieveContactPubKeys(userId, contactId)
+	if e != nil {
+		return nil, WrapCaliopenErrf(e, DbCaliopenErr, "[RetrieveWKDKeys] failed to retrieve keys of user %s", userId)
+	}
+	keyring := new(bytes.Buffer)
+	for _, key := range keys {
+		if !publishableKey(key, lookup.Address) {
+			continue
+		}
+		if e := dearmorKey(keyring, key.Key); e != nil {
+			return nil, WrapCaliopenErrf(e, UnknownCaliopenErr, "[RetrieveWKDKeys] invalid key %s", key.Fingerprint)
+		}
+	}
+	if keyring.Len() == 0 {
+		return nil, NewCaliopenErrf(NotFoundCaliopenErr, "[RetrieveWKDKeys] no key published for %s", lookup.Address)
+	}
+	return keyring.Bytes(), nil
+}
+
+// WKDPolicy returns the content of the policy file of domain's Web Key Directory.
+// Web Key Service's protocol version is advertised when it is enabled.
+func (rest *RESTfacility) WKDPolicy(domain string) []byte {
+	policy := fmt.Sprintf("# OpenPGP Web Key Directory policy of %s\n", domain)
+	if rest.wksKey != nil {
+		policy += fmt.Sprintf("protocol-version: %d\n", WKSProtocolVersion)
+	}
+	return []byte(policy)
+}
+
+// WKDSubmissionAddress returns the content of the submission-address file of domain's Web Key Directory,
+// or a NotFoundCaliopenErr if Web Key Service is disabled.
+func (rest *RESTfacility) WKDSubmissionAddress(domain string) ([]byte, CaliopenError) {
+	if rest.wksKey == nil {
+		return nil, NewCaliopenErr(NotFoundCaliopenErr, "[WKDSubmissionAddress] Web Key Service is disabled")
+	}
+	return []byte(strings.ToLower(rest.wkd.SubmissionLocalPart+"@"+domain) + "\n"), nil
+}
+
+// wksPublicKey reads the armored key of submission address from file and returns its public part in binary format
+func wksPublicKey(file string) ([]byte, error) {
+	armored, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer armored.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(armored)
+	if err != nil {
+		return nil, err
+	}
+	key := new(bytes.Buffer)
+	for _, entity := range entities {
+		if err = entity.Serialize(key); err != nil {
+			return nil, err
+		}
+	}
+	return key.Bytes(), nil
+}
+
+// publishableKey tells if key has been uploaded (or confirmed through Web Key Service) by user, has a user id for address and has not expired.
+// Keys discovered elsewhere are left to their own publishers.
+func publishableKey(key PublicKey, address string) bool {
+	if !key.UploadedByUser() || key.KeyType != PGP_KEY_TYPE || (!key.ExpireDate.IsZero() && key.ExpireDate.Before(time.Now())) {
+		return false
+	}
+	for _, email := range key.Emails {
+		if strings.EqualFold(email, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// dearmorKey writes the binary packets of an ASCII armored key to w
+func dearmorKey(w io.Writer, armored string) error {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, block.Body)
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package REST
+
+import (
+	"bytes"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRESTfacility_RetrieveWKDKeys(t *testing.T) {
+	contact := &Contact{
+		ContactId: UUID(uuid.NewV4()),
+		UserId:    UUID(uuid.NewV4()),
+		Emails:    []EmailContact{{Address: "emma@caliopen.local"}, {Address: "emma@example.com"}},
+	}
+	newKey := func(email string) (PublicKey, *openpgp.Entity) {
+		key, entity, err := backendstest.NewPublicKey(contact, "Emma", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, entity
+	}
+	published, publishedEntity := newKey("emma@caliopen.local")
+	confirmed, confirmedEntity := newKey("emma@caliopen.local")
+	confirmed.Label = WKSKeyLabel
+	expired, _ := newKey("emma@caliopen.local")
+	expired.ExpireDate = time.Now().Add(-time.Hour)
+	other, _ := newKey("emma@example.com")
+	// keys that have not been uploaded by emma
+	autocrypt, _ := newKey("emma@caliopen.local")
+	autocrypt.Label = AutocryptKeyLabel
+	discovered, _ := newKey("emma@caliopen.local")
+	discovered.Source, discovered.Label = WKDAdvancedMethod, WKDAdvancedMethod
+
+	store := backendstest.NewFakeStore()
+	store.Identities = []*UserIdentity{
+		{Id: UUID(uuid.NewV4()), UserId: contact.UserId, Identifier: "Emma@caliopen.local", Type: LocalIdentity},
+		{Id: UUID(uuid.NewV4()), UserId: contact.UserId, Identifier: "emma@example.com", Type: RemoteIdentity},
+	}
+	store.Keys = []PublicKey{published, confirmed, expired, other, autocrypt, discovered}
+	store.UserContacts[contact.UserId.String()] = contact.ContactId.String()
+	rest := &RESTfacility{store: store}
+
+	// `l` parameter is optional
+	for _, localPart := range []string{"Emma", ""} {
+		keys, err := rest.RetrieveWKDKeys("caliopen.local", WKDHash("emma"), localPart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entities, e := openpgp.ReadKeyRing(bytes.NewReader(keys))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(entities) != 2 || entities[0].PrimaryKey.KeyId != publishedEntity.PrimaryKey.KeyId ||
+			entities[1].PrimaryKey.KeyId != confirmedEntity.PrimaryKey.KeyId {
+			t.Errorf("expected only emma's uploaded and confirmed keys for caliopen.local to be published, got %d keys with local-part %q", len(entities), localPart)
+		}
+	}
+	// hashes are only resolved through lookups, local identities are never scanned
+	if calls := store.CallsTo("LookupIdentityByType"); len(calls) != 0 {
+		t.Errorf("expected no scan of local identities, got %d", len(calls))
+	}
+
+	for _, args := range [][3]string{
+		{"caliopen.local", WKDHash("emma"), "alice"},  // local-part must match hash
+		{"caliopen.local", WKDHash("alice"), ""},      // no local identity for hash
+		{"example.com", WKDHash("emma"), ""},          // no local identity within domain
+		{"caliopen.local", WKDHash("alice"), "alice"}, // unknown identity
+		{"example.com", WKDHash("emma"), "emma"},      // not a local identity
+	} {
+		if _, err := rest.RetrieveWKDKeys(args[0], args[1], args[2]); err == nil || err.Code() != NotFoundCaliopenErr {
+			t.Errorf("expected not found for %v, got %v", args, err)
+		}
+	}
+}
+
+func TestRESTfacility_WKS(t *testing.T) {
+	submission, err := backendstest.NewPGPEntity("Key submission", "key-submission@caliopen.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := &RESTfacility{store: backendstest.NewFakeStore()}
+
+	// Web Key Service is disabled
+	if policy := string(rest.WKDPolicy("caliopen.local")); strings.Contains(policy, "protocol-version") {
+		t.Errorf("expected no Web Key Service to be advertised, got policy %q", policy)
+	}
+	if _, err := rest.WKDSubmissionAddress("caliopen.local"); err == nil || err.Code() != NotFoundCaliopenErr {
+		t.Errorf("expected no submission address, got %v", err)
+	}
+
+	rest.wkd = WKDConfig{Enable: true, SubmissionLocalPart: "key-submission"}
+	rest.wksKey = backendstest.BinaryPublicKey(submission)
+	if policy := string(rest.WKDPolicy("caliopen.local")); !strings.Contains(policy, "protocol-version") {
+		t.Errorf("expected Web Key Service to be advertised, got policy %q", policy)
+	}
+	address, e := rest.WKDSubmissionAddress("Caliopen.local")
+	if e != nil || string(address) != "key-submission@caliopen.local\n" {
+		t.Errorf("expected submission address of caliopen.local, got %q (%v)", address, e)
+	}
+	keys, e := rest.RetrieveWKDKeys("caliopen.local", WKDHash("key-submission"), "")
+	if e != nil || !bytes.Equal(keys, rest.wksKey) {
+		t.Errorf("expected submission address' key to be published, got %v", e)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DuplicateNameThreshold is the minimal NameSimilarity for two contacts to be suggested as duplicates
+const DuplicateNameThreshold = 0.85
+
+// ContactNameWords returns contact's given, additional and family names split into sorted lower-case words,
+// so that "Dupont Jean" and "jean dupont" give the same words.
+// Contacts without names get no words : their title comes from a contact point, which is not a name.
+func ContactNameWords(c *Contact) []string {
+	words := strings.FieldsFunc(strings.ToLower(c.GivenName+" "+c.AdditionalName+" "+c.FamilyName), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return words
+}
+
+// NameSimilarity returns a score between 0 (nothing in common) and 1 (same names),
+// computed from the edit distance between sorted name words
+func NameSimilarity(a, b []string) float64 {
+	ra, rb := []rune(strings.Join(a, " ")), []rune(strings.Join(b, " "))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the count of runes insertions, deletions or substitutions to turn a into b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
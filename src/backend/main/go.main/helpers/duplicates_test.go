@@ -0,0 +1,44 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"reflect"
+	"testing"
+)
+
+func TestContactNameWords(t *testing.T) {
+	words := ContactNameWords(&Contact{GivenName: "Jean-Pierre", FamilyName: "DUPONT"})
+	if !reflect.DeepEqual(words, []string{"dupont", "jean", "pierre"}) {
+		t.Errorf("unexpected name words %v", words)
+	}
+	if words := ContactNameWords(&Contact{Title: "jean@example.com"}); len(words) != 0 {
+		t.Errorf("expected contact without names to have no words, got %v", words)
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	jean := ContactNameWords(&Contact{GivenName: "Jean", FamilyName: "Dupont"})
+	for _, test := range []struct {
+		contact *Contact
+		similar bool
+	}{
+		{&Contact{GivenName: "Dupont", FamilyName: "Jean"}, true},
+		{&Contact{GivenName: "Jean", FamilyName: "Dupond"}, true},
+		{&Contact{GivenName: "Jéan", FamilyName: "dupont"}, true},
+		{&Contact{GivenName: "Jean", FamilyName: "Durand"}, false},
+		{&Contact{GivenName: "Paul", FamilyName: "Dupont"}, false},
+		{&Contact{Title: "Jean Dupont"}, false},
+	} {
+		score := NameSimilarity(jean, ContactNameWords(test.contact))
+		if (score >= DuplicateNameThreshold) != test.similar {
+			t.Errorf("unexpected similarity %f for %+v", score, test.contact)
+		}
+	}
+	if NameSimilarity(jean, jean) != 1 {
+		t.Error("expected same names to be fully similar")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// helpers to request urls given by users or by remote parties (push services, keys directories…)
+// without letting them reach our own internal services.
+
+var nonPublicNets []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "this" network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local
+		"172.16.0.0/12",  // private
+		"192.168.0.0/16", // private
+		"fc00::/7",       // unique local
+	} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nonPublicNets = append(nonPublicNets, ipNet)
+	}
+}
+
+// IsPublicIP tells if ip is a global unicast address, out of private, loopback and link-local ranges
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, ipNet := range nonPublicNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPublicHost rejects hosts that obviously target a non-public address : ip literals and localhost names.
+// Names that resolve to non-public addresses are rejected when dialing, see PublicHTTPClient.
+func CheckPublicHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("host <%s> is not a public host", host)
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("address <%s> is not a public address", host)
+	}
+	return nil
+}
+
+// PublicHTTPClient returns an http client that refuses to connect to non-public addresses,
+// whatever the names given in urls (or in redirections) resolve to.
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicIP(net.ParseIP(host)) {
+				return errors.New("connection to non-public address " + host + " refused")
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
@@ -0,0 +1,56 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::248": true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.20.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.100.0.1":          false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"::ffff:127.0.0.1":     false,
+	} {
+		if got := IsPublicIP(net.ParseIP(addr)); got != public {
+			t.Errorf("expected IsPublicIP(%s) to be %v, got %v", addr, public, got)
+		}
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	for _, host := range []string{"push.example.com", "93.184.216.34"} {
+		if err := CheckPublicHost(host); err != nil {
+			t.Errorf("expected %s to be accepted, got %s", host, err)
+		}
+	}
+	for _, host := range []string{"", "localhost", "LOCALHOST.", "api.localhost", "127.0.0.1", "[::1]", "169.254.169.254"} {
+		if CheckPublicHost(host) == nil {
+			t.Errorf("expected %s to be rejected", host)
+		}
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	if _, err := PublicHTTPClient(time.Second).Get(server.URL); err == nil {
+		t.Error("expected request to loopback address to be refused")
+	}
+}
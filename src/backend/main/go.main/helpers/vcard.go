@@ -0,0 +1,519 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	VCardVersion3 = "3.0" // RFC 2426, the version every CardDAV client understands
+	VCardVersion4 = "4.0" // RFC 6350
+
+	VCardUidInfo = "vcard_uid" // contact's Infos key keeping UID given by a vCard, if not contact's own
+
+	vCardLineLength = 75 // octets, CRLF excluded (RFC 6350 §3.2)
+	vCardTimestamp  = "20060102T150405Z"
+)
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `;`, `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// MarshalVCard outputs contact as a vCard 4.0 (RFC 6350)
+func MarshalVCard(contact *Contact) []byte {
+	return MarshalVCardVersion(contact, VCardVersion4)
+}
+
+// MarshalVCardVersion outputs contact as a vCard 3.0 (RFC 2426) or 4.0 (RFC 6350)
+func MarshalVCardVersion(contact *Contact, version string) []byte {
+	if version != VCardVersion3 {
+		version = VCardVersion4
+	}
+	card := new(bytes.Buffer)
+	writeVCardLine(card, "BEGIN:VCARD")
+	writeVCardLine(card, "VERSION:"+version)
+	if uid := contact.Infos[VCardUidInfo]; uid != "" {
+		writeVCardLine(card, "UID:"+vCardEscaper.Replace(uid))
+	} else if (contact.ContactId != UUID{}) {
+		writeVCardLine(card, "UID:urn:uuid:"+contact.ContactId.String())
+	}
+	writeVCardLine(card, "FN:"+vCardEscaper.Replace(vCardFormattedName(contact)))
+	writeVCardLine(card, "N:"+vCardStructured(contact.FamilyName, contact.GivenName, contact.AdditionalName, contact.NamePrefix, contact.NameSuffix))
+	for _, email := range contact.Emails {
+		writeVCardLine(card, "EMAIL"+vCardParams(version, email.Type, email.IsPrimary)+":"+vCardEscaper.Replace(email.Address))
+	}
+	for _, phone := range contact.Phones {
+		switch {
+		case version == VCardVersion3:
+			number := phone.Number
+			if number == "" {
+				number = strings.TrimPrefix(phone.Uri, "tel:")
+			}
+			writeVCardLine(card, "TEL"+vCardParams(version, phone.Type, phone.IsPrimary)+":"+vCardEscaper.Replace(number))
+		case phone.Uri != "":
+			writeVCardLine(card, "TEL;VALUE=uri"+vCardParams(version, phone.Type, phone.IsPrimary)+":"+phone.Uri)
+		default:
+			writeVCardLine(card, "TEL;VALUE=text"+vCardParams(version, phone.Type, phone.IsPrimary)+":"+vCardEscaper.Replace(phone.Number))
+		}
+	}
+	for _, address := range contact.Addresses {
+		writeVCardLine(card, "ADR"+vCardParams(version, address.Type, address.IsPrimary)+":"+
+			vCardStructured("", "", address.Street, address.City, address.Region, address.PostalCode, address.Country))
+	}
+	for _, org := range contact.Organizations {
+		if org.Deleted {
+			continue
+		}
+		writeVCardLine(card, "ORG"+vCardParams(version, org.Type, org.IsPrimary)+":"+vCardStructured(org.Name, org.Department))
+		if org.Title != "" {
+			writeVCardLine(card, "TITLE:"+vCardEscaper.Replace(org.Title))
+		}
+	}
+	for _, im := range contact.Ims {
+		uri := im.Address
+		if im.Protocol != "" && !strings.Contains(uri, ":") {
+			uri = strings.ToLower(im.Protocol) + ":" + uri
+		}
+		writeVCardLine(card, "IMPP"+vCardParams(version, im.Type, im.IsPrimary)+":"+uri)
+	}
+	categories := []string{}
+	for _, category := range append(append([]string{}, contact.Groups...), contact.Tags...) {
+		if category != "" {
+			categories = append(categories, vCardEscaper.Replace(category))
+		}
+	}
+	if len(categories) > 0 {
+		writeVCardLine(card, "CATEGORIES:"+strings.Join(categories, ","))
+	}
+	for _, key := range contact.PublicKeys {
+		if key.Key == "" {
+			continue
+		}
+		if version == VCardVersion3 {
+			// 3.0 has no data URI, key is inlined as base64 of its binary form
+			if block, err := armor.Decode(strings.NewReader(key.Key)); err == nil {
+				if raw, err := ioutil.ReadAll(block.Body); err == nil {
+					writeVCardLine(card, "KEY;TYPE=PGP;ENCODING=b:"+base64.StdEncoding.EncodeToString(raw))
+				}
+			}
+			continue
+		}
+		writeVCardLine(card, "KEY;MEDIATYPE=application/pgp-keys:data:application/pgp-keys,"+vCardEscaper.Replace(key.Key))
+	}
+	if !contact.DateUpdate.IsZero() {
+		writeVCardLine(card, "REV:"+contact.DateUpdate.UTC().Format(vCardTimestamp))
+	} else if !contact.DateInsert.IsZero() {
+		writeVCardLine(card, "REV:"+contact.DateInsert.UTC().Format(vCardTimestamp))
+	}
+	writeVCardLine(card, "END:VCARD")
+	return card.Bytes()
+}
+
+// vCardFormattedName returns the mandatory FN property's value
+func vCardFormattedName(contact *Contact) string {
+	if contact.Title != "" {
+		return contact.Title
+	}
+	if name := strings.TrimSpace(contact.GivenName + " " + contact.FamilyName); name != "" {
+		return name
+	}
+	if len(contact.Emails) > 0 {
+		return contact.Emails[0].Address
+	}
+	return ""
+}
+
+func vCardStructured(components ...string) string {
+	for i, component := range components {
+		components[i] = vCardEscaper.Replace(component)
+	}
+	return strings.Join(components, ";")
+}
+
+func vCardParams(version, kind string, isPrimary bool) (params string) {
+	types := []string{}
+	if kind != "" && !strings.ContainsAny(kind, ":;,\"") {
+		types = append(types, strings.ToLower(kind))
+	}
+	if isPrimary && version == VCardVersion3 {
+		types = append(types, "pref")
+	}
+	if len(types) > 0 {
+		params += ";TYPE=" + strings.Join(types, ",")
+	}
+	if isPrimary && version != VCardVersion3 {
+		params += ";PREF=1"
+	}
+	return
+}
+
+// writeVCardLine folds line into chunks of at most vCardLineLength octets,
+// without splitting multi-octet characters.
+func writeVCardLine(card *bytes.Buffer, line string) {
+	max := vCardLineLength
+	for len(line) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		card.WriteString(line[:cut])
+		card.WriteString("\r\n ")
+		line = line[cut:]
+		max = vCardLineLength - 1 // continuation lines begin with a space
+	}
+	card.WriteString(line)
+	card.WriteString("\r\n")
+}
+
+// VCardETag returns an entity tag that changes whenever contact's vCard representation changes
+func VCardETag(contact *Contact) string {
+	sum := sha1.Sum(MarshalVCard(contact))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// VCardPropertyValues returns unescaped values of vcard's properties named name, like "EMAIL" or "FN"
+func VCardPropertyValues(vcard []byte, name string) (values []string) {
+	name = strings.ToUpper(name)
+	for _, prop := range parseVCardLines(vcard) {
+		if prop.name == name {
+			values = append(values, vCardUnescape(prop.value))
+		}
+	}
+	return
+}
+
+// vCardProperty is a content line of a vCard, once unfolded
+type vCardProperty struct {
+	name   string              // upper case, without group
+	params map[string][]string // upper case names, values unquoted
+	value  string              // raw value, still escaped
+}
+
+func (p vCardProperty) param(name string) string {
+	if values := p.params[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// UnmarshalVCards parses one or more vCards 3.0 or 4.0 (and most of 2.1) into contacts.
+// Contacts are returned without identifiers nor dates, it is up to caller to create or update them.
+// PGP keys are returned armored within contacts' PublicKeys.
+func UnmarshalVCards(data []byte) ([]*Contact, error) {
+	contacts := []*Contact{}
+	var contact *Contact
+	var titles []string
+	depth := 0
+	for _, prop := range parseVCardLines(data) {
+		switch prop.name {
+		case "BEGIN":
+			if strings.EqualFold(prop.value, "VCARD") {
+				depth++
+				if depth == 1 {
+					contact = &Contact{Infos: map[string]string{}}
+					titles = nil
+				}
+			}
+			continue
+		case "END":
+			if strings.EqualFold(prop.value, "VCARD") {
+				depth--
+				if depth == 0 && contact != nil {
+					for i, title := range titles {
+						if i < len(contact.Organizations) {
+							contact.Organizations[i].Title = title
+						} else {
+							contact.Organizations = append(contact.Organizations, Organization{Title: title})
+						}
+					}
+					contacts = append(contacts, contact)
+					contact = nil
+				}
+			}
+			continue
+		}
+		// properties of nested vCards (2.1 AGENT) are ignored
+		if contact == nil || depth != 1 {
+			continue
+		}
+		kind, isPrimary := vCardTypes(prop)
+		switch prop.name {
+		case "FN":
+			contact.Title = vCardUnescape(prop.value)
+		case "N":
+			n := vCardComponents(prop.value, 5)
+			contact.FamilyName, contact.GivenName, contact.AdditionalName, contact.NamePrefix, contact.NameSuffix = n[0], n[1], n[2], n[3], n[4]
+		case "EMAIL":
+			if address := strings.TrimSpace(vCardUnescape(prop.value)); address != "" {
+				contact.Emails = append(contact.Emails, EmailContact{Address: address, IsPrimary: isPrimary, Type: kind})
+			}
+		case "TEL":
+			phone := Phone{IsPrimary: isPrimary, Type: kind}
+			value := vCardUnescape(prop.value)
+			if strings.EqualFold(prop.param("VALUE"), "uri") || strings.HasPrefix(strings.ToLower(value), "tel:") {
+				phone.Uri = value
+				phone.Number = value[strings.Index(value, ":")+1:]
+			} else {
+				phone.Number = value
+			}
+			if phone.Number != "" {
+				contact.Phones = append(contact.Phones, phone)
+			}
+		case "ADR":
+			adr := vCardComponents(prop.value, 7)
+			contact.Addresses = append(contact.Addresses, PostalAddress{
+				City:       adr[3],
+				Country:    adr[6],
+				IsPrimary:  isPrimary,
+				PostalCode: adr[5],
+				Region:     adr[4],
+				Street:     strings.TrimSpace(strings.Join([]string{adr[0], adr[1], adr[2]}, " ")),
+				Type:       kind,
+			})
+		case "ORG":
+			org := vCardComponents(prop.value, 2)
+			contact.Organizations = append(contact.Organizations, Organization{
+				Department: org[1],
+				IsPrimary:  isPrimary,
+				Name:       org[0],
+				Type:       kind,
+			})
+		case "TITLE":
+			titles = append(titles, vCardUnescape(prop.value))
+		case "IMPP":
+			uri := vCardUnescape(prop.value)
+			im := IM{Address: uri, IsPrimary: isPrimary, Type: kind}
+			if i := strings.Index(uri, ":"); i > 0 {
+				im.Protocol, im.Address = strings.ToLower(uri[:i]), uri[i+1:]
+			}
+			contact.Ims = append(contact.Ims, im)
+		case "X-AIM", "X-ICQ", "X-JABBER", "X-MSN", "X-SKYPE", "X-YAHOO":
+			contact.Ims = append(contact.Ims, IM{
+				Address:  vCardUnescape(prop.value),
+				Protocol: strings.ToLower(strings.TrimPrefix(prop.name, "X-")),
+				Type:     kind,
+			})
+		case "CATEGORIES":
+			for _, category := range vCardList(prop.value) {
+				if category != "" {
+					contact.Groups = append(contact.Groups, category)
+				}
+			}
+		case "KEY":
+			if key, err := vCardPGPKey(prop); err == nil {
+				contact.PublicKeys = append(contact.PublicKeys, PublicKey{Key: key})
+			}
+		case "UID":
+			contact.Infos[VCardUidInfo] = vCardUnescape(prop.value)
+		}
+	}
+	if len(contacts) == 0 {
+		return nil, errors.New("no vCard found")
+	}
+	return contacts, nil
+}
+
+// parseVCardLines unfolds content lines and splits them into properties
+func parseVCardLines(data []byte) (props []vCardProperty) {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		colon := vCardIndex(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		parts := vCardSplit(line[:colon], ';')
+		prop := vCardProperty{
+			name:   strings.ToUpper(parts[0][strings.LastIndex(parts[0], ".")+1:]),
+			params: map[string][]string{},
+			value:  line[colon+1:],
+		}
+		for _, param := range parts[1:] {
+			name, value := "TYPE", param // 2.1 bare types, like "HOME"
+			if eq := strings.Index(param, "="); eq >= 0 {
+				name, value = strings.ToUpper(param[:eq]), param[eq+1:]
+			}
+			for _, v := range vCardSplit(value, ',') {
+				v = strings.Trim(v, `"`)
+				if name == "TYPE" {
+					// some clients quote a list of types
+					prop.params[name] = append(prop.params[name], strings.Split(v, ",")...)
+				} else {
+					prop.params[name] = append(prop.params[name], v)
+				}
+			}
+		}
+		props = append(props, prop)
+	}
+	return
+}
+
+// vCardIndex returns index of first sep found out of double quotes
+func vCardIndex(s string, sep byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// vCardSplit splits parameters on sep, out of double quotes
+func vCardSplit(s string, sep byte) (parts []string) {
+	for {
+		i := vCardIndex(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// vCardTypes returns first meaningful TYPE and whether property is the preferred one
+func vCardTypes(prop vCardProperty) (kind string, isPrimary bool) {
+	for _, t := range prop.params["TYPE"] {
+		switch t = strings.ToLower(t); t {
+		case "pref":
+			isPrimary = true
+		case "internet", "voice", "x400", "":
+		default:
+			if kind == "" {
+				kind = t
+			}
+		}
+	}
+	if pref := prop.param("PREF"); pref == "1" {
+		isPrimary = true
+	}
+	return
+}
+
+// vCardValues splits value on unescaped sep, then unescapes each part
+func vCardValues(value string, sep byte) (values []string) {
+	current := new(bytes.Buffer)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteByte(value[i])
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == sep:
+			values = append(values, vCardUnescape(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(values, vCardUnescape(current.String()))
+}
+
+// vCardComponents returns exactly n components of a structured value
+func vCardComponents(value string, n int) []string {
+	components := vCardValues(value, ';')
+	for len(components) < n {
+		components = append(components, "")
+	}
+	return components[:n]
+}
+
+func vCardList(value string) []string {
+	return vCardValues(value, ',')
+}
+
+func vCardUnescape(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	unescaped := new(bytes.Buffer)
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			if value[i] == 'n' || value[i] == 'N' {
+				unescaped.WriteByte('\n')
+			} else {
+				unescaped.WriteByte(value[i])
+			}
+			continue
+		}
+		unescaped.WriteByte(value[i])
+	}
+	return unescaped.String()
+}
+
+// vCardPGPKey returns the armored PGP key held by a KEY property,
+// whether it is a 4.0 data URI or a 3.0 base64 binary value.
+func vCardPGPKey(prop vCardProperty) (string, error) {
+	var raw []byte
+	var err error
+	isPGP := strings.Contains(strings.ToLower(prop.param("MEDIATYPE")+prop.param("TYPE")), "pgp")
+	value := prop.value
+	switch {
+	case strings.HasPrefix(value, "data:"):
+		comma := strings.Index(value, ",")
+		if comma < 0 {
+			return "", errors.New("invalid data uri")
+		}
+		mediaType, payload := value[len("data:"):comma], value[comma+1:]
+		isPGP = isPGP || strings.Contains(mediaType, "pgp")
+		if strings.HasSuffix(mediaType, ";base64") {
+			raw, err = base64.StdEncoding.DecodeString(vCardUnescape(payload))
+		} else {
+			payload = vCardUnescape(payload)
+			if unescaped, e := url.PathUnescape(payload); e == nil {
+				payload = unescaped
+			}
+			raw = []byte(payload)
+		}
+	case strings.EqualFold(prop.param("ENCODING"), "b") || strings.EqualFold(prop.param("ENCODING"), "base64"):
+		raw, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	default:
+		raw = []byte(vCardUnescape(value))
+	}
+	if err != nil {
+		return "", err
+	}
+	if bytes.Contains(raw, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		return string(raw), nil
+	}
+	if !isPGP {
+		return "", errors.New("not a PGP key")
+	}
+	armored := new(bytes.Buffer)
+	w, err := armor.Encode(armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", err
+	}
+	w.Write(raw)
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	return armored.String(), nil
+}
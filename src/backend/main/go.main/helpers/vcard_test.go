@@ -0,0 +1,158 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package helpers
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestMarshalVCard(t *testing.T) {
+	contact := &Contact{
+		Addresses:  []PostalAddress{{Street: "1, rue de la Paix", City: "Paris", PostalCode: "75002", Country: "France", Type: "home"}},
+		DateUpdate: time.Date(2019, 4, 2, 10, 30, 0, 0, time.UTC),
+		Emails:     []EmailContact{{Address: "jean@example.com", IsPrimary: true, Type: "work"}},
+		FamilyName: "Dupont",
+		GivenName:  "Jean",
+		Ims:        []IM{{Address: "jean@jabber.example", Protocol: "xmpp"}},
+		Organizations: []Organization{
+			{Name: "Caliopen; inc", Department: "R&D", Title: "développeur"},
+			{Name: "former", Deleted: true},
+		},
+		Phones: []Phone{{Number: "+33 1 23 45 67 89"}, {Uri: "tel:+33-6-12-34-56-78", Type: "cell"}},
+		Tags:   []string{"friends"},
+		Title:  strings.Repeat("é", 60),
+	}
+	card := string(MarshalVCard(contact))
+
+	for _, expected := range []string{
+		"BEGIN:VCARD\r\nVERSION:4.0\r\n",
+		"N:Dupont;Jean;;;\r\n",
+		"EMAIL;TYPE=work;PREF=1:jean@example.com\r\n",
+		"TEL;VALUE=text:+33 1 23 45 67 89\r\n",
+		"TEL;VALUE=uri;TYPE=cell:tel:+33-6-12-34-56-78\r\n",
+		"ADR;TYPE=home:;;1\\, rue de la Paix;Paris;;75002;France\r\n",
+		"ORG:Caliopen\\; inc;R&D\r\n",
+		"TITLE:développeur\r\n",
+		"IMPP:xmpp:jean@jabber.example\r\n",
+		"CATEGORIES:friends\r\n",
+		"REV:20190402T103000Z\r\n",
+	} {
+		if !strings.Contains(card, expected) {
+			t.Errorf("expected %q in vCard :\n%s", expected, card)
+		}
+	}
+	if strings.Contains(card, "former") {
+		t.Error("expected deleted organization not to be exported")
+	}
+	if !strings.HasSuffix(card, "END:VCARD\r\n") {
+		t.Errorf("expected vCard to be terminated, got :\n%s", card)
+	}
+
+	// long FN is folded without breaking multi-octet chars
+	unfolded := strings.Replace(card, "\r\n ", "", -1)
+	if !strings.Contains(unfolded, "FN:"+contact.Title+"\r\n") {
+		t.Errorf("expected FN to unfold to title, got :\n%s", unfolded)
+	}
+	for _, line := range strings.Split(card, "\r\n") {
+		if len(line) > 75 || !utf8.ValidString(line) {
+			t.Errorf("invalid folded line %q", line)
+		}
+	}
+}
+
+func TestMarshalVCardVersion3(t *testing.T) {
+	contact := &Contact{
+		Emails: []EmailContact{{Address: "jean@example.com", IsPrimary: true, Type: "work"}},
+		Phones: []Phone{{Uri: "tel:+33-6-12-34-56-78", Type: "cell"}},
+		Title:  "Jean",
+	}
+	card := string(MarshalVCardVersion(contact, VCardVersion3))
+	for _, expected := range []string{
+		"VERSION:3.0\r\n",
+		"EMAIL;TYPE=work,pref:jean@example.com\r\n",
+		"TEL;TYPE=cell:+33-6-12-34-56-78\r\n",
+	} {
+		if !strings.Contains(card, expected) {
+			t.Errorf("expected %q in vCard :\n%s", expected, card)
+		}
+	}
+}
+
+func TestUnmarshalVCards(t *testing.T) {
+	cards := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"PRODID:-//Apple Inc.//iOS 12.2//EN\r\n" +
+		"N:Dupont;Jean;;Dr;\r\n" +
+		"FN:Jean Dupont\r\n" +
+		"ORG:Caliopen\\; inc;R&D\r\n" +
+		"TITLE:développeur\r\n" +
+		"item1.EMAIL;type=INTERNET;type=HOME;type=pref:jean@example.com\r\n" +
+		"EMAIL;TYPE=\"work,internet\":jean.dupont@caliopen.example\r\n" +
+		"TEL;type=CELL;type=VOICE:06 12 34 56 78\r\n" +
+		"item2.ADR;type=HOME:;;1\\, rue de la Paix;Paris;;75002;Fr\r\n" +
+		" ance\r\n" +
+		"X-JABBER:jean@jabber.example\r\n" +
+		"CATEGORIES:friends,work\r\n" +
+		"KEY;TYPE=PGP;ENCODING=b:AQIDBA==\r\n" +
+		"UID:4D4B2A1C-06A4-4C4B-9F3C-1D3E0F3F7B1A\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Emma\nIMPP;PREF=1:xmpp:emma@jabber.example\nEND:VCARD\n"
+
+	contacts, err := UnmarshalVCards([]byte(cards))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("expected 2 contacts, got %d", len(contacts))
+	}
+	jean := contacts[0]
+	if jean.Title != "Jean Dupont" || jean.FamilyName != "Dupont" || jean.GivenName != "Jean" || jean.NamePrefix != "Dr" {
+		t.Errorf("unexpected names %+v", jean)
+	}
+	if len(jean.Emails) != 2 || !jean.Emails[0].IsPrimary || jean.Emails[0].Type != "home" || jean.Emails[1].Type != "work" {
+		t.Errorf("unexpected emails %+v", jean.Emails)
+	}
+	if len(jean.Phones) != 1 || jean.Phones[0].Number != "06 12 34 56 78" || jean.Phones[0].Type != "cell" {
+		t.Errorf("unexpected phones %+v", jean.Phones)
+	}
+	if len(jean.Addresses) != 1 || jean.Addresses[0].Street != "1, rue de la Paix" || jean.Addresses[0].Country != "France" {
+		t.Errorf("unexpected addresses %+v", jean.Addresses)
+	}
+	if len(jean.Organizations) != 1 || jean.Organizations[0].Name != "Caliopen; inc" || jean.Organizations[0].Title != "développeur" {
+		t.Errorf("unexpected organizations %+v", jean.Organizations)
+	}
+	if len(jean.Ims) != 1 || jean.Ims[0].Protocol != "jabber" {
+		t.Errorf("unexpected ims %+v", jean.Ims)
+	}
+	if len(jean.Groups) != 2 || jean.Infos[VCardUidInfo] != "4D4B2A1C-06A4-4C4B-9F3C-1D3E0F3F7B1A" {
+		t.Errorf("unexpected groups or uid %+v", jean)
+	}
+	if len(jean.PublicKeys) != 1 || !strings.HasPrefix(jean.PublicKeys[0].Key, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		t.Errorf("expected binary key to be armored, got %+v", jean.PublicKeys)
+	}
+	emma := contacts[1]
+	if emma.Title != "Emma" || len(emma.Ims) != 1 || emma.Ims[0].Address != "emma@jabber.example" || !emma.Ims[0].IsPrimary {
+		t.Errorf("unexpected contact %+v", emma)
+	}
+
+	// what we export is imported back, whatever the version
+	for _, version := range []string{VCardVersion3, VCardVersion4} {
+		back, err := UnmarshalVCards(MarshalVCardVersion(jean, version))
+		if err != nil || len(back) != 1 {
+			t.Fatalf("failed to parse exported vCard %s : %v", version, err)
+		}
+		if VCardETag(back[0]) != VCardETag(jean) {
+			t.Errorf("vCard %s round trip changed contact :\n%s\n%s", version, MarshalVCard(back[0]), MarshalVCard(jean))
+		}
+	}
+
+	if _, err = UnmarshalVCards([]byte("not a vcard")); err == nil {
+		t.Error("expected an error without vCard")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package messages
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// MboxReader reads raw messages one after another from a mbox file.
+// It accepts mboxo and mboxrd flavours, with LF or CRLF line endings.
+type MboxReader struct {
+	r        *bufio.Reader
+	next     []byte // "From " line that opened the message to read next
+	midLine  bool   // last chunk read ended before end of line
+	skipLine bool   // rest of current line is to be dropped
+}
+
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r)}
+}
+
+// readChunk returns next line, or next part of a line that doesn't fit in reader's buffer,
+// and whether chunk is at the start of a line.
+func (mr *MboxReader) readChunk() (chunk []byte, lineStart bool, err error) {
+	lineStart = !mr.midLine
+	chunk, err = mr.r.ReadSlice('\n')
+	mr.midLine = err == bufio.ErrBufferFull
+	if mr.midLine {
+		err = nil
+	}
+	// slice is overwritten by next read
+	chunk = append([]byte(nil), chunk...)
+	if mr.skipLine {
+		mr.skipLine = mr.midLine
+		chunk = nil
+	}
+	return
+}
+
+// isSeparator tells if chunk is a "From " line that opens a message, and drops the rest of it
+func (mr *MboxReader) isSeparator(chunk []byte, lineStart bool) bool {
+	if !lineStart || !bytes.HasPrefix(chunk, []byte("From ")) {
+		return false
+	}
+	mr.next = chunk
+	mr.skipLine = mr.midLine
+	return true
+}
+
+// NextMessage returns next raw message with CRLF line endings and "From " lines unquoted,
+// or io.EOF once mbox is exhausted.
+// Messages larger than messageMaxSize are skipped and reported with ErrMessageTooLarge,
+// next call reads the message that follows.
+func (mr *MboxReader) NextMessage() ([]byte, error) {
+	// skip anything before first separator
+	for mr.next == nil {
+		chunk, lineStart, err := mr.readChunk()
+		if mr.isSeparator(chunk, lineStart) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	mr.next = nil
+	msg := new(bytes.Buffer)
+	line := []byte{}
+	tooLarge := false
+	for {
+		chunk, lineStart, err := mr.readChunk()
+		if mr.isSeparator(chunk, lineStart) {
+			break
+		}
+		if !tooLarge {
+			line = append(line, chunk...)
+			if int64(msg.Len()+len(line)) > messageMaxSize {
+				// keep on reading up to next message
+				tooLarge = true
+				msg.Reset()
+			}
+		}
+		if !tooLarge && !mr.midLine && len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			// unquote mboxrd ">From " lines
+			if len(line) > 0 && line[0] == '>' && mboxFromLine.Match(line) {
+				line = line[1:]
+			}
+			msg.Write(line)
+			msg.WriteString("\r\n")
+			line = line[:0]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tooLarge {
+		return nil, ErrMessageTooLarge
+	}
+	if msg.Len() == 0 && mr.next == nil {
+		return nil, io.EOF
+	}
+	// drop blank line that separates messages
+	raw := bytes.TrimSuffix(msg.Bytes(), []byte("\r\n"))
+	if !bytes.HasSuffix(raw, []byte("\r\n")) {
+		raw = append(raw, '\r', '\n')
+	}
+	return raw, nil
+}
+
+// uncompressed sizes allowed for zip mailboxes, whatever sizes declared in archive's headers
+var (
+	zipMaxEntrySize int64 = 1 << 30  // a single file
+	zipMaxTotalSize int64 = 10 << 30 // all files
+)
+
+var errZipTooLarge = errors.New("zip archive is too large once uncompressed")
+
+// messageMaxSize is the size allowed for a single message found in a mailbox
+var messageMaxSize int64 = 25 << 20
+
+// ErrMessageTooLarge is given to WalkMailbox's walkFn for messages larger than messageMaxSize
+var ErrMessageTooLarge = errors.New("message is too large")
+
+// WalkMailbox calls walkFn for each message found in an uploaded mailbox :
+//   - MailboxFormatMbox : a single mbox file
+//   - MailboxFormatZip : a zipped Maildir or a zip of .eml/.mbox files
+//   - MailboxFormatEml : a single message
+//
+// name is message's location within mailbox, for error reporting.
+// walkFn is given a nil raw message along with an error for messages that could not be read, like ErrMessageTooLarge.
+// Walk stops at first error returned by walkFn.
+func WalkMailbox(format string, file io.ReaderAt, size int64, walkFn func(name string, raw []byte, err error) error) error {
+	switch format {
+	case MailboxFormatMbox:
+		return walkMbox("mbox", io.NewSectionReader(file, 0, size), walkFn)
+	case MailboxFormatEml:
+		return walkMessage("eml", io.NewSectionReader(file, 0, size), walkFn)
+	case MailboxFormatZip:
+		archive, err := zip.NewReader(file, size)
+		if err != nil {
+			return err
+		}
+		remaining := zipMaxTotalSize
+		for _, entry := range archive.File {
+			if entry.FileInfo().IsDir() || isMaildirMetaFile(entry.Name) {
+				continue
+			}
+			if entry.UncompressedSize64 > uint64(zipMaxEntrySize) || entry.UncompressedSize64 > uint64(remaining) {
+				return errZipTooLarge
+			}
+			err = walkZipEntry(entry, &remaining, walkFn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown mailbox format %s", format)
+	}
+}
+
+// walkZipEntry inflates entry up to zipMaxEntrySize and remaining bytes, and decrements remaining with bytes read
+func walkZipEntry(entry *zip.File, remaining *int64, walkFn func(name string, raw []byte, err error) error) error {
+	f, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	capped := &cappedReader{r: f, max: zipMaxEntrySize}
+	if *remaining < capped.max {
+		capped.max = *remaining
+	}
+	defer func() { *remaining -= capped.read }()
+	r := bufio.NewReader(capped)
+	head, _ := r.Peek(5)
+	if strings.HasSuffix(strings.ToLower(entry.Name), ".mbox") || string(head) == "From " {
+		return walkMbox(entry.Name, r, walkFn)
+	}
+	return walkMessage(entry.Name, r, walkFn)
+}
+
+// walkMessage reads a single message up to messageMaxSize
+func walkMessage(name string, r io.Reader, walkFn func(name string, raw []byte, err error) error) error {
+	raw, err := ioutil.ReadAll(io.LimitReader(r, messageMaxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(raw)) > messageMaxSize {
+		return walkFn(name, nil, ErrMessageTooLarge)
+	}
+	return walkFn(name, raw, nil)
+}
+
+func walkMbox(name string, r io.Reader, walkFn func(name string, raw []byte, err error) error) error {
+	mbox := NewMboxReader(r)
+	for i := 1; ; i++ {
+		raw, err := mbox.NextMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != ErrMessageTooLarge {
+			return err
+		}
+		if err = walkFn(fmt.Sprintf("%s#%d", name, i), raw, err); err != nil {
+			return err
+		}
+	}
+}
+
+// cappedReader fails once more than max bytes have been read
+type cappedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (cr *cappedReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.read += int64(n)
+	if cr.read > cr.max {
+		return n, errZipTooLarge
+	}
+	return n, err
+}
+
+// isMaildirMetaFile tells if a file found in a Maildir is not a message
+func isMaildirMetaFile(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(base, ".") ||
+		strings.HasPrefix(base, "dovecot") ||
+		strings.HasPrefix(base, "courier") ||
+		base == "maildirfolder" ||
+		base == "subscriptions"
+}
@@ -0,0 +1,149 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package messages
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMboxReader(t *testing.T) {
+	msgs := []string{
+		"From: emma@example.com\r\nSubject: first\r\n\r\nFrom here to there\r\n>From quoted\r\n",
+		"From: jean@example.com\r\nSubject: second\r\n\r\nbye\r\n",
+	}
+	mbox := new(bytes.Buffer)
+	writer := NewMboxWriter(mbox)
+	for _, msg := range msgs {
+		if err := writer.WriteMessage("emma@example.com", time.Now(), []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err := WalkMailbox(MailboxFormatMbox, bytes.NewReader(mbox.Bytes()), int64(mbox.Len()), func(name string, raw []byte, err error) error {
+		got = append(got, string(raw))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(msgs) {
+		t.Fatalf("expected %d messages, got %d : %q", len(msgs), len(got), got)
+	}
+	for i := range msgs {
+		if got[i] != msgs[i] {
+			t.Errorf("mbox round trip failed, expected %q, got %q", msgs[i], got[i])
+		}
+	}
+}
+
+func TestWalkMailbox_Maildir(t *testing.T) {
+	archive := new(bytes.Buffer)
+	zipped := zip.NewWriter(archive)
+	for name, content := range map[string]string{
+		"Maildir/cur/1556.M1P2.host:2,S":  "Subject: read\r\n\r\nhello\r\n",
+		"Maildir/new/1557.M2P2.host":      "Subject: unread\r\n\r\nhello\r\n",
+		"Maildir/dovecot-uidlist":         "3 V1556 N3\n",
+		"Maildir/.Archives/maildirfolder": "",
+		"Archives.mbox":                   "From a@example.com Tue Apr  2 10:30:00 2019\nSubject: archived\n\nold\n\n",
+	} {
+		f, _ := zipped.Create(name)
+		f.Write([]byte(content))
+	}
+	zipped.Close()
+
+	found := map[string]bool{}
+	err := WalkMailbox(MailboxFormatZip, bytes.NewReader(archive.Bytes()), int64(archive.Len()), func(name string, raw []byte, err error) error {
+		found[name] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Maildir/cur/1556.M1P2.host:2,S", "Maildir/new/1557.M2P2.host", "Archives.mbox#1"} {
+		if !found[name] {
+			t.Errorf("expected %s to be walked, got %v", name, found)
+		}
+	}
+	if len(found) != 3 {
+		t.Errorf("expected Maildir meta files to be skipped, got %v", found)
+	}
+}
+
+func TestWalkMailbox_ZipTooLarge(t *testing.T) {
+	defer func(entry, total int64) { zipMaxEntrySize, zipMaxTotalSize = entry, total }(zipMaxEntrySize, zipMaxTotalSize)
+	zipMaxEntrySize, zipMaxTotalSize = 100, 200
+	message := "Subject: hello\r\n\r\n" + strings.Repeat("a", 60) + "\r\n" // 80 bytes
+
+	cases := []struct {
+		entries []string
+		err     bool
+	}{
+		{[]string{message, message}, false},
+		{[]string{message, message, message}, true}, // total size exceeded
+		{[]string{message + strings.Repeat("a", 50)}, true},
+	}
+	for i, c := range cases {
+		archive := new(bytes.Buffer)
+		zipped := zip.NewWriter(archive)
+		for j, content := range c.entries {
+			f, _ := zipped.Create(fmt.Sprintf("%d.eml", j))
+			f.Write([]byte(content))
+		}
+		zipped.Close()
+		err := WalkMailbox(MailboxFormatZip, bytes.NewReader(archive.Bytes()), int64(archive.Len()), func(name string, raw []byte, err error) error {
+			return nil
+		})
+		if (err != nil) != c.err {
+			t.Errorf("case %d : expected error %v, got %v", i, c.err, err)
+		}
+	}
+}
+
+func TestWalkMailbox_MessageTooLarge(t *testing.T) {
+	defer func(max int64) { messageMaxSize = max }(messageMaxSize)
+	messageMaxSize = 100
+	small := "Subject: small\r\n\r\nhello\r\n"
+	// a single line larger than reader's buffer
+	large := "Subject: large\r\n\r\n" + strings.Repeat("a", 5000) + "\r\n"
+	mbox := new(bytes.Buffer)
+	writer := NewMboxWriter(mbox)
+	for _, msg := range []string{small, large, small} {
+		writer.WriteMessage("emma@example.com", time.Now(), []byte(msg))
+	}
+
+	walked := map[string]error{}
+	err := WalkMailbox(MailboxFormatMbox, bytes.NewReader(mbox.Bytes()), int64(mbox.Len()), func(name string, raw []byte, err error) error {
+		if err == nil && string(raw) != small {
+			t.Errorf("unexpected message %s : %q", name, raw)
+		}
+		walked[name] = err
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 3 || walked["mbox#1"] != nil || walked["mbox#2"] != ErrMessageTooLarge || walked["mbox#3"] != nil {
+		t.Errorf("expected only second message to be too large, got %v", walked)
+	}
+
+	for content, expected := range map[string]error{small: nil, large: ErrMessageTooLarge} {
+		err = WalkMailbox(MailboxFormatEml, strings.NewReader(content), int64(len(content)), func(name string, raw []byte, err error) error {
+			if err != expected {
+				t.Errorf("expected %v for eml of %d bytes, got %v", expected, len(content), err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
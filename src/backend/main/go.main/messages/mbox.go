@@ -0,0 +1,62 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package messages
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mboxFromLine matches body lines that must be quoted in a mboxrd file
+var mboxFromLine = regexp.MustCompile(`^>*From `)
+
+// MboxWriter writes raw messages one after another in mboxrd format
+type MboxWriter struct {
+	w *bufio.Writer
+}
+
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage appends a raw RFC 5322 message to the mbox.
+// sender and date are used for the "From " separator line,
+// line endings are normalized to LF and "From " lines are quoted.
+func (mw *MboxWriter) WriteMessage(sender string, date time.Time, raw []byte) error {
+	sender = strings.Join(strings.Fields(sender), "")
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	if _, err := mw.w.WriteString("From " + sender + " " + date.UTC().Format(time.ANSIC) + "\n"); err != nil {
+		return err
+	}
+	raw = bytes.Replace(raw, []byte("\r\n"), []byte("\n"), -1)
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		if mboxFromLine.Match(line) {
+			if err := mw.w.WriteByte('>'); err != nil {
+				return err
+			}
+		}
+		if _, err := mw.w.Write(line); err != nil {
+			return err
+		}
+		if err := mw.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	// blank line separates messages
+	if err := mw.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return mw.w.Flush()
+}
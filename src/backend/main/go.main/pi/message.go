@@ -46,6 +46,10 @@ func ComputePIMessage(message *Message) *PIMessage {
 	if ok && len(trSigned) > 0 && strings.ToLower(string(trSigned[0])) == "t" {
 		piMessage.Transport += 20
 	}
+	// sender's domain authenticated the email, with SPF or DKIM aligned on From domain
+	if features[FeatureTransportDMARC] == AuthPass {
+		piMessage.Transport += 10
+	}
 	nbHops, ok := features["nb_external_hops"]
 	if ok {
 		value, err := strconv.Atoi(nbHops)
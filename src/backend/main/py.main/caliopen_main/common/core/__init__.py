@@ -3,7 +3,7 @@
 from __future__ import absolute_import, print_function, unicode_literals
 
 from .base import BaseUserCore
-from .pubkey import PublicKey
+from .pubkey import PublicKey, AutocryptPeer
 from .related import BaseUserRelatedCore
 
-__all__ = ['BaseUserCore', 'PublicKey', 'BaseUserRelatedCore']
+__all__ = ['BaseUserCore', 'PublicKey', 'AutocryptPeer', 'BaseUserRelatedCore']
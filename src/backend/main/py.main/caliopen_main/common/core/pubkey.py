@@ -5,6 +5,8 @@ from __future__ import absolute_import, print_function, unicode_literals
 import uuid
 
 from caliopen_main.common.store import PublicKey as ModelPublicKey
+from caliopen_main.common.store import AutocryptPeer as ModelAutocryptPeer
+from caliopen_main.common.core.base import BaseUserCore
 from caliopen_main.common.core.related import BaseUserRelatedCore
 
 
@@ -32,3 +34,10 @@ class PublicKey(BaseUserRelatedCore):
                                       resource_type=resource_type,
                                       **kwargs)
         return cls(obj)
+
+
+class AutocryptPeer(BaseUserCore):
+    """Autocrypt state of a correspondent's address, for an user."""
+
+    _model_class = ModelAutocryptPeer
+    _pkey_name = 'address'
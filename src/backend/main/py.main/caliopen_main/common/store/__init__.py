@@ -3,6 +3,6 @@
 from __future__ import absolute_import, print_function, unicode_literals
 
 
-from .pubkey import PublicKey
+from .pubkey import PublicKey, AutocryptPeer
 
-__all__ = ['PublicKey']
+__all__ = ['PublicKey', 'AutocryptPeer']
@@ -28,6 +28,8 @@ class PublicKey(BaseModel):
     key = columns.Text()
     fingerprint = columns.Text()
     size = columns.VarInt()
+    source = columns.Text()     # wkd / hkp / autocrypt, empty if uploaded
+    source_url = columns.Text()
 
     # JWT parameters
     kty = columns.Text()    # rsa / ec
@@ -37,3 +39,16 @@ class PublicKey(BaseModel):
     crv = columns.Text()
     x = columns.VarInt()
     y = columns.VarInt()
+
+
+class AutocryptPeer(BaseModel):
+    """Autocrypt state of a correspondent's address, for an user."""
+
+    user_id = columns.UUID(primary_key=True)
+    address = columns.Text(primary_key=True)        # clustering key
+
+    autocrypt_timestamp = columns.DateTime()
+    fingerprint = columns.Text()
+    keydata = columns.Text()                        # base64, as in header
+    last_seen = columns.DateTime()
+    prefer_encrypt = columns.Text()                 # mutual / nopreference
@@ -10,6 +10,7 @@ import phonenumbers
 
 from .store import (Contact as ModelContact,
                     ContactLookup as ModelContactLookup,
+                    ContactCarddavLookup as ModelContactCarddavLookup,
                     Organization, Email, IM, PostalAddress,
                     Phone, SocialIdentity)
 from .store.contact_index import IndexedContact
@@ -30,6 +31,13 @@ class ContactLookup(BaseUserCore):
     _pkey_name = 'value'
 
 
+class ContactCarddavLookup(BaseUserCore):
+    """Lookup of contacts by their CardDAV resource name."""
+
+    _model_class = ModelContactCarddavLookup
+    _pkey_name = 'name'
+
+
 class BaseContactSubCore(BaseCore):
     """
     Base core object for contact related objects
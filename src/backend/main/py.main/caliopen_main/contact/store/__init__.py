@@ -2,10 +2,12 @@
 from __future__ import absolute_import, print_function, unicode_literals
 
 from .contact import Contact, IndexedContact, ContactLookup
+from .contact import ContactCarddavLookup
 from .contact import Organization, PostalAddress
 from .contact import Email, IM, Phone, SocialIdentity
 
 
-__all__ = ['Contact', 'ContactLookup', 'IndexedContact',
+__all__ = ['Contact', 'ContactLookup', 'ContactCarddavLookup',
+           'IndexedContact',
            'Organization', 'PostalAddress',
            'Email', 'IM', 'Phone', 'SocialIdentity']
@@ -136,3 +136,11 @@ class ContactLookup(BaseModel):
         primary_key=True)  # address or 'identifier' in identity
     type = columns.Text(primary_key=True)  # email, IM, etc.
     contact_ids = columns.List(columns.UUID())  # many contacts is allowed
+
+
+class ContactCarddavLookup(BaseModel):
+    """Lookup of contacts by the resource name a CardDAV client gave them."""
+
+    user_id = columns.UUID(primary_key=True)
+    name = columns.Text(primary_key=True)
+    contact_id = columns.UUID()
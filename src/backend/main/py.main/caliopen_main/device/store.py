@@ -12,6 +12,7 @@ import pytz
 from cassandra.cqlengine import columns
 
 from caliopen_storage.store.model import BaseModel
+from caliopen_storage.store import BaseUserType
 from caliopen_main.pi.objects import PIModel
 
 
@@ -28,6 +29,15 @@ class DeviceLocation(BaseModel):
     country = columns.Text()
 
 
+class PushSubscription(BaseUserType):
+    """Web Push subscription of device's user agent."""
+
+    auth = columns.Text()
+    date_insert = columns.DateTime()
+    endpoint = columns.Text()
+    p256dh = columns.Text()
+
+
 class Device(BaseModel):
     """User device."""
 
@@ -44,6 +54,7 @@ class Device(BaseModel):
     ip_creation = columns.Text()
     privacy_features = columns.Map(columns.Text, columns.Text)
     pi = columns.UserDefinedType(PIModel)
+    push_subscription = columns.UserDefinedType(PushSubscription)
 
 
 class DeviceConnectionLog(BaseModel):
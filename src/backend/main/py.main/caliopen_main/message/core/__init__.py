@@ -1,6 +1,8 @@
 from .raw import RawMessage, UserRawLookup
-from .external_references import MessageExternalRefLookup
+from .external_references import MessageExternalRefLookup, MessageDeletedLookup
+from .scheduled_send import ScheduledSend
 
 __all__ = [
-    'RawMessage', 'UserRawLookup', 'MessageExternalRefLookup'
+    'RawMessage', 'UserRawLookup', 'MessageExternalRefLookup',
+    'MessageDeletedLookup', 'ScheduledSend'
 ]
@@ -4,10 +4,18 @@ from __future__ import absolute_import, print_function, unicode_literals
 
 from caliopen_main.common.core import BaseUserCore
 from ..store import MessageExternalRefLookup as ModelMessageExternalRefLookup
+from ..store import MessageDeletedLookup as ModelMessageDeletedLookup
 
 
 class MessageExternalRefLookup(BaseUserCore):
     """Lookup message by external message-id"""
 
     _model_class = ModelMessageExternalRefLookup
-    _pkey_name = 'external_msg_id'
\ No newline at end of file
+    _pkey_name = 'external_msg_id'
+
+
+class MessageDeletedLookup(BaseUserCore):
+    """Messages deleted by user, by external message-id"""
+
+    _model_class = ModelMessageDeletedLookup
+    _pkey_name = 'external_msg_id'
@@ -0,0 +1,13 @@
+# -*- coding: utf-8 -*-
+"""Caliopen core scheduled send class."""
+from __future__ import absolute_import, print_function, unicode_literals
+
+from caliopen_main.common.core import BaseUserCore
+from ..store import ScheduledSend as ModelScheduledSend
+
+
+class ScheduledSend(BaseUserCore):
+    """Draft waiting to be sent, processed by API's send scheduler."""
+
+    _model_class = ModelScheduledSend
+    _pkey_name = 'message_id'
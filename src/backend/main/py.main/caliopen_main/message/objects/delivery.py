@@ -0,0 +1,28 @@
+# -*- coding: utf-8 -*-
+"""Caliopen message object classes."""
+from __future__ import absolute_import, print_function, unicode_literals
+
+import datetime
+import types
+
+from uuid import UUID
+from caliopen_main.common.objects.base import ObjectJsonDictifiable
+from ..store.delivery import DeliveryStatus as ModelDeliveryStatus
+from ..store.delivery_index import IndexedDeliveryStatus
+
+
+class DeliveryStatus(ObjectJsonDictifiable):
+    """recipient's delivery status, nested within message object"""
+
+    _attrs = {
+        'address': types.StringType,
+        'date': datetime.datetime,
+        'error': types.StringType,
+        'identity_id': UUID,
+        'message_id': UUID,
+        'protocol': types.StringType,
+        'status': types.StringType
+    }
+
+    _model_class = ModelDeliveryStatus
+    _index_class = IndexedDeliveryStatus
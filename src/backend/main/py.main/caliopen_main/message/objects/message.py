@@ -22,6 +22,7 @@ from ..parameters.message import Message as ParamMessage
 from ..parameters.draft import Draft
 from ..core import RawMessage
 from .attachment import MessageAttachment
+from .delivery import DeliveryStatus
 from .external_references import ExternalReferences
 from .participant import Participant
 from schematics.types import UUIDType
@@ -46,6 +47,7 @@ class Message(ObjectIndexable):
         'date_delete': datetime.datetime,
         'date_insert': datetime.datetime,
         'date_sort': datetime.datetime,
+        'delivery_status': [DeliveryStatus],
         'discussion_id': UUID,
         'external_references': ExternalReferences,
         'importance_level': types.IntType,
@@ -59,6 +61,7 @@ class Message(ObjectIndexable):
         'privacy_features': types.DictType,
         'pi': PIObject,
         'raw_msg_id': UUID,
+        'send_at': datetime.datetime,
         'subject': types.StringType,
         'tags': [types.StringType],
         'protocol': types.StringType,
@@ -0,0 +1,22 @@
+# -*- coding: utf-8 -*-
+from __future__ import absolute_import, print_function, unicode_literals
+
+from schematics.models import Model
+from schematics.types import DateTimeType, StringType, UUIDType
+
+import caliopen_storage.helpers.json as helpers
+
+DELIVERY_STATUSES = ['bounced', 'delayed', 'delivered', 'failed', 'sent']
+
+
+class DeliveryStatus(Model):
+    address = StringType()
+    date = DateTimeType(serialized_format=helpers.RFC3339Milli, tzd=u'utc')
+    error = StringType()
+    identity_id = UUIDType()
+    message_id = UUIDType()
+    protocol = StringType()
+    status = StringType(choices=DELIVERY_STATUSES)
+
+    class Options:
+        serialize_when_none = False
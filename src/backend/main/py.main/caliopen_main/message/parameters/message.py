@@ -12,6 +12,7 @@ from schematics.transforms import blacklist
 
 from .participant import Participant
 from .attachment import Attachment
+from .delivery import DeliveryStatus
 from .external_references import ExternalReferences
 from caliopen_main.pi.parameters import PIParameter
 import caliopen_storage.helpers.json as helpers
@@ -84,6 +85,9 @@ class Message(NewInboundMessage):
                                tzd=u'utc')
     date_sort = DateTimeType(serialized_format=helpers.RFC3339Milli,
                              tzd=u'utc')
+    delivery_status = ListType(ModelType(DeliveryStatus), default=lambda: [])
+    send_at = DateTimeType(serialized_format=helpers.RFC3339Milli,
+                           tzd=u'utc')
 
     class Options:
         roles = {'default': blacklist('user_id', 'date_delete')}
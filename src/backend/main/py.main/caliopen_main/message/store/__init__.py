@@ -3,17 +3,24 @@ from __future__ import absolute_import, print_function, unicode_literals
 
 from .attachment import MessageAttachment
 from .attachment_index import IndexedMessageAttachment
-from .external_references import ExternalReferences, MessageExternalRefLookup
+from .delivery import DeliveryStatus
+from .delivery_index import IndexedDeliveryStatus
+from .external_references import (ExternalReferences,
+                                  MessageExternalRefLookup,
+                                  MessageDeletedLookup)
 from .external_references_index import IndexedExternalReferences
 from .message import Message
 from .message_index import IndexedMessage
 from .participant import Participant
 from .participant_index import IndexedParticipant
 from .raw import RawMessage, UserRawLookup
+from .scheduled_send import ScheduledSend
 
 __all__ = ['MessageAttachment', 'IndexedMessageAttachment',
            'RawMessage', 'UserRawLookup',
            'Message', 'IndexedMessage',
+           'DeliveryStatus', 'IndexedDeliveryStatus',
            'ExternalReferences', 'IndexedExternalReferences',
-           'Participant', 'IndexedParticipant', 'MessageExternalRefLookup'
+           'Participant', 'IndexedParticipant', 'MessageExternalRefLookup',
+           'MessageDeletedLookup', 'ScheduledSend'
            ]
@@ -0,0 +1,19 @@
+# -*- coding: utf-8 -*-
+from __future__ import absolute_import, print_function, unicode_literals
+
+from cassandra.cqlengine import columns
+
+from caliopen_storage.store import BaseUserType
+
+
+class DeliveryStatus(BaseUserType):
+
+    """delivery status of a recipient, nested in message."""
+
+    address = columns.Text()
+    date = columns.DateTime()
+    error = columns.Text()
+    identity_id = columns.UUID()
+    message_id = columns.UUID()
+    protocol = columns.Text()
+    status = columns.Text()
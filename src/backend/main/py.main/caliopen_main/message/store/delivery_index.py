@@ -0,0 +1,21 @@
+# -*- coding: utf-8 -*-
+from __future__ import absolute_import, print_function, unicode_literals
+
+import logging
+
+from elasticsearch_dsl import InnerObjectWrapper, Date, Keyword, Text
+
+log = logging.getLogger(__name__)
+
+
+class IndexedDeliveryStatus(InnerObjectWrapper):
+
+    """Nest delivery status indexed model."""
+
+    address = Keyword()
+    date = Date()
+    error = Text()
+    identity_id = Keyword()
+    message_id = Keyword()
+    protocol = Keyword()
+    status = Keyword()
@@ -22,3 +22,13 @@ class MessageExternalRefLookup(BaseModel):
     external_msg_id = columns.Text(primary_key=True)
     identity_id = columns.UUID(primary_key=True)
     message_id = columns.UUID()
+
+
+class MessageDeletedLookup(BaseModel):
+    """Messages explicitly deleted by user, to reflect deletion onto remote accounts"""
+
+    user_id = columns.UUID(primary_key=True)
+    identity_id = columns.UUID(primary_key=True)
+    external_msg_id = columns.Text(primary_key=True)
+    message_id = columns.UUID()
+    date_delete = columns.DateTime()
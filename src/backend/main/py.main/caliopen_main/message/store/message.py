@@ -10,6 +10,7 @@ from caliopen_main.pi.objects import PIModel
 from caliopen_main.common.core import BaseUserCore
 
 from .attachment import MessageAttachment
+from .delivery import DeliveryStatus
 from .external_references import ExternalReferences, \
     MessageExternalRefLookup as ModelMessageExternalRefLookup
 from .participant import Participant
@@ -33,6 +34,7 @@ class Message(BaseModel, IndexedModelMixin):
     date_delete = columns.DateTime()
     date_insert = columns.DateTime()
     date_sort = columns.DateTime()
+    delivery_status = columns.List(columns.UserDefinedType(DeliveryStatus))
     discussion_id = columns.UUID()
     external_references = columns.UserDefinedType(ExternalReferences)
     importance_level = columns.Integer()
@@ -45,6 +47,7 @@ class Message(BaseModel, IndexedModelMixin):
     privacy_features = columns.Map(columns.Text(), columns.Text())
     pi = columns.UserDefinedType(PIModel)
     raw_msg_id = columns.UUID()
+    send_at = columns.DateTime()
     subject = columns.Text()  # Subject of email, the message for short
     tags = columns.List(columns.Text(), db_field="tagnames")
     protocol = columns.Text()
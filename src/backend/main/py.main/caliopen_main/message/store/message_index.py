@@ -7,6 +7,7 @@ from elasticsearch_dsl import Mapping, Nested, Text, Keyword, Date, Boolean, \
 from caliopen_storage.store.model import BaseIndexDocument
 
 from .attachment_index import IndexedMessageAttachment
+from .delivery_index import IndexedDeliveryStatus
 from .external_references_index import IndexedExternalReferences
 from caliopen_main.pi.objects import PIIndexModel
 from .participant_index import IndexedParticipant
@@ -27,6 +28,7 @@ class IndexedMessage(BaseIndexDocument):
     date_delete = Date()
     date_insert = Date()
     date_sort = Date()
+    delivery_status = Nested(doc_class=IndexedDeliveryStatus)
     discussion_id = Keyword()
     external_references = Nested(doc_class=IndexedExternalReferences)
     importance_level = Integer()
@@ -39,6 +41,7 @@ class IndexedMessage(BaseIndexDocument):
     privacy_features = Object()
     pi = Object(doc_class=PIIndexModel)
     raw_msg_id = Keyword()
+    send_at = Date()
     subject = Text()
     tags = Keyword(multi=True)
     protocol = Keyword()
@@ -78,6 +81,19 @@ class IndexedMessage(BaseIndexDocument):
         m.field('date_delete', 'date')
         m.field('date_insert', 'date')
         m.field('date_sort', 'date')
+        # delivery status
+        m.field('delivery_status',
+                Nested(doc_class=IndexedDeliveryStatus,
+                       properties={
+                           "address": Keyword(),
+                           "date": Date(),
+                           "error": Text(),
+                           "identity_id": Keyword(),
+                           "message_id": Keyword(),
+                           "protocol": Keyword(),
+                           "status": Keyword()
+                       })
+                )
         m.field('discussion_id', 'keyword')
         # external references
         m.field('external_references',
@@ -122,6 +138,7 @@ class IndexedMessage(BaseIndexDocument):
         m.field("pi", pi)
         m.field('privacy_features', Object(include_in_all=True))
         m.field('raw_msg_id', "keyword")
+        m.field('send_at', 'date')
         m.field('subject', 'text', fields={
             "normalized": {"type": "text", "analyzer": "text_analyzer"}
         })
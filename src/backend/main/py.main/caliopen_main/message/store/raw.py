@@ -23,4 +23,4 @@ class UserRawLookup(BaseModel):
     """User's raw message pointer."""
 
     user_id = columns.UUID(primary_key=True)
-    raw_msg_id = columns.UUID(primary_key=True)
+    raw_msg_id = columns.UUID(primary_key=True, index=True)
@@ -0,0 +1,19 @@
+# -*- coding: utf-8 -*-
+from __future__ import absolute_import, print_function, unicode_literals
+
+from cassandra.cqlengine import columns
+
+from caliopen_storage.store.model import BaseModel
+
+
+class ScheduledSend(BaseModel):
+    """
+    Drafts waiting to be sent by API's send scheduler.
+
+    attempts: failed attempts to send draft, scheduler gives up after a few.
+    """
+
+    user_id = columns.UUID(primary_key=True)
+    message_id = columns.UUID(primary_key=True)
+    attempts = columns.Integer()
+    send_at = columns.DateTime()
@@ -6,7 +6,7 @@ from caliopen_storage.core import BaseCore
 from caliopen_main.common.core import BaseUserCore
 
 from .store import Notification as ModelNotification, \
-    NotificationTtl as ModelTTLs
+    NotificationTtl as ModelTTLs, NotificationDigest as ModelDigest
 
 
 class Notification(BaseUserCore):
@@ -21,3 +21,10 @@ class NotificationTtl(BaseCore):
 
     _model_class = ModelTTLs
     _pkey_name = "notif_code"
+
+
+class NotificationDigest(BaseUserCore):
+    """core class to record email digests sent to users"""
+
+    _model_class = ModelDigest
+    _pkey_name = "user_id"
@@ -41,3 +41,18 @@ class NotificationTtl(BaseModel):
     ttl_code = columns.Ascii(primary_key=True)
     ttl_duration = columns.Integer()
     description = columns.Text()
+
+
+class NotificationDigest(BaseModel):
+    """
+    Table to record when last email digest has been sent to an user
+
+    user_id: user's id to which digest has been sent.
+    date_sent: date of last digest, set once digest has been sent.
+    lease_until: digest is being sent by a single API instance until this date,
+        when several API instances run the digest scheduler.
+    """
+
+    user_id = columns.UUID(primary_key=True)
+    date_sent = columns.DateTime()
+    lease_until = columns.DateTime()
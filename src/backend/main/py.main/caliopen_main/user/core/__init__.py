@@ -3,9 +3,11 @@ from __future__ import absolute_import, print_function, unicode_literals
 
 from .user import User, Tag, FilterRule, UserIdentity, ReservedName
 from .user import allocate_user_shard
-from .identity import IdentityLookup, IdentityTypeLookup
+from .identity import IdentityLookup, IdentityTypeLookup, WkdLookup
+from .identity import WksRequest
 
 __all__ = [
     'User', 'Tag', 'FilterRule', 'UserIdentity', 'ReservedName',
-    'allocate_user_shard', 'IdentityLookup', 'IdentityTypeLookup'
+    'allocate_user_shard', 'IdentityLookup', 'IdentityTypeLookup',
+    'WkdLookup', 'WksRequest'
 ]
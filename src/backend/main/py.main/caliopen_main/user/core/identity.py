@@ -3,12 +3,27 @@
 
 from __future__ import absolute_import, print_function, unicode_literals
 
+import hashlib
+
 from caliopen_storage.core import BaseCore
 from caliopen_main.common.core import BaseUserCore
 
 from ..store import (UserIdentity as ModelUserIdentity,
                      IdentityLookup as ModelIdentityLookup,
-                     IdentityTypeLookup as ModelIdentityTypeLookup)
+                     IdentityTypeLookup as ModelIdentityTypeLookup,
+                     WkdLookup as ModelWkdLookup,
+                     WksRequest as ModelWksRequest)
+
+ZBASE32_ALPHABET = 'ybndrfg8ejkmcpqxot1uwisza345h769'
+
+
+def wkd_hash(local_part):
+    """Web Key Directory hash : z-base-32 encoded sha1 of local-part."""
+    digest = hashlib.sha1(local_part.lower().encode('utf-8')).digest()
+    bits = ''.join('{:08b}'.format(c) for c in bytearray(digest))
+    bits += '0' * (-len(bits) % 5)
+    return ''.join(ZBASE32_ALPHABET[int(bits[i:i + 5], 2)]
+                   for i in range(0, len(bits), 5))
 
 
 class UserIdentity(BaseUserCore):
@@ -48,3 +63,27 @@ class IdentityTypeLookup(BaseCore):
 
     _model_class = ModelIdentityTypeLookup
     _pkey_name = 'type'
+
+
+class WkdLookup(BaseCore):
+    """Lookup table core class, to resolve Web Key Directory hashes."""
+
+    _model_class = ModelWkdLookup
+    _pkey_name = 'domain'
+
+    @classmethod
+    def create_for(cls, identity):
+        """Create lookup of a local identity."""
+        local_part, _, domain = identity.identifier.rpartition('@')
+        return cls.create(domain=domain.lower(),
+                          hash=wkd_hash(local_part),
+                          address=identity.identifier.lower(),
+                          identity_id=identity.identity_id,
+                          user_id=identity.user_id)
+
+
+class WksRequest(BaseCore):
+    """Web Key Service submission, confirmed by its nonce."""
+
+    _model_class = ModelWksRequest
+    _pkey_name = 'nonce'
@@ -129,6 +129,11 @@ def setup_settings(user, settings):
             settings.notification_sound_enabled,
         'notification_delay_disappear':
             settings.notification_delay_disappear,
+        'notification_channels': settings.notification_channels,
+        'notification_digest': settings.notification_digest,
+        'notification_quiet_start': settings.notification_quiet_start,
+        'notification_quiet_end': settings.notification_quiet_end,
+        'notification_timezone': settings.notification_timezone,
     }
 
     obj = ObjectSettings(user)
@@ -21,9 +21,14 @@ from ..store import (User as ModelUser,
                      IndexUser,
                      UserTag as ModelUserTag,
                      Settings as ModelSettings,
+                     SettingsDigestLookup as ModelSettingsDigestLookup,
                      FilterRule as ModelFilterRule,
-                     ReservedName as ModelReservedName)
+                     ReservedName as ModelReservedName,
+                     UserPurge as ModelUserPurge,
+                     SavedSearch as ModelSavedSearch,
+                     AppPassword as ModelAppPassword)
 from ..core.identity import UserIdentity, IdentityLookup, IdentityTypeLookup
+from ..core.identity import WkdLookup
 
 from caliopen_storage.core import BaseCore
 from caliopen_main.common.core import BaseUserCore
@@ -125,6 +130,27 @@ class UserRecoveryEmail(BaseCore):
     _pkey_name = 'recovery_email'
 
 
+class UserPurge(BaseUserCore):
+    """Purge of a deleted user's data, processed by API's purge workers."""
+
+    _model_class = ModelUserPurge
+    _pkey_name = 'user_id'
+
+
+class AppPassword(BaseUserCore):
+    """Password of a client that can't go through login process."""
+
+    _model_class = ModelAppPassword
+    _pkey_name = 'app_password_id'
+
+
+class SavedSearch(BaseUserCore):
+    """User's saved search, possibly tagging inbound messages it matches."""
+
+    _model_class = ModelSavedSearch
+    _pkey_name = 'search_id'
+
+
 class Settings(BaseUserCore):
     """User settings core object."""
 
@@ -135,6 +161,13 @@ class Settings(BaseUserCore):
     _pkey_name = None
 
 
+class SettingsDigestLookup(BaseCore):
+    """Lookup of users who subscribed to an email digest."""
+
+    _model_class = ModelSettingsDigestLookup
+    _pkey_name = 'user_id'
+
+
 class User(BaseCore):
     """User core object."""
 
@@ -435,6 +468,7 @@ class User(BaseCore):
                 IdentityTypeLookup.create(type=identity.type,
                                           user_id=identity.user_id,
                                           identity_id=identity.identity_id)
+                WkdLookup.create_for(identity)
                 return True
             except Exception as exc:
                 log.error('Unexpected exception {}'.format(exc))
@@ -6,9 +6,11 @@ import logging
 import types
 import uuid
 
-from caliopen_main.user.parameters.settings import Settings as SettingsParam
+from caliopen_main.user.parameters.settings import Settings as SettingsParam, \
+    DIGEST_CHOICES
 
-from caliopen_main.user.store import Settings as ModelSettings
+from caliopen_main.user.store import Settings as ModelSettings, \
+    SettingsDigestLookup as ModelDigestLookup
 from caliopen_main.common.objects.base import ObjectUser
 
 log = logging.getLogger(__name__)
@@ -27,8 +29,36 @@ class Settings(ObjectUser):
         'notification_message_preview': types.StringType,
         'notification_sound_enabled': types.BooleanType,
         'notification_delay_disappear': types.IntType,
+        'notification_channels': types.DictType,
+        'notification_digest': types.StringType,
+        'notification_quiet_start': types.StringType,
+        'notification_quiet_end': types.StringType,
+        'notification_timezone': types.StringType,
     }
 
     _model_class = ModelSettings
     _pkey_name = None
     _json_model = SettingsParam
+
+    def save_db(self, **options):
+        error = super(Settings, self).save_db(**options)
+        if error is None:
+            self._update_digest_lookup()
+        return error
+
+    def update_db(self, **options):
+        error = super(Settings, self).update_db(**options)
+        if error is None:
+            self._update_digest_lookup()
+        return error
+
+    def _update_digest_lookup(self):
+        """Keep lookup of users to send email digest to in sync."""
+        digest = self._db.notification_digest
+        for choice in DIGEST_CHOICES:
+            if choice == digest and choice != 'off':
+                ModelDigestLookup.create(notification_digest=choice,
+                                         user_id=self._db.user_id)
+            else:
+                ModelDigestLookup.filter(notification_digest=choice,
+                                         user_id=self._db.user_id).delete()
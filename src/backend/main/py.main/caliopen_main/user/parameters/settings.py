@@ -4,6 +4,7 @@ from __future__ import absolute_import, print_function, unicode_literals
 
 from schematics.models import Model
 from schematics.types import StringType, IntType, BooleanType
+from schematics.types.compound import DictType, ListType
 
 MESSAGE_FORMAT_CHOICES = ['rich_text', 'plain_text']
 CONTACT_FORMAT_CHOICES = ['given_name, family_name',
@@ -11,6 +12,9 @@ CONTACT_FORMAT_CHOICES = ['given_name, family_name',
 CONTACT_ORDER_CHOICES = ['family_name', 'given_name']
 PREVIEW_CHOICES = ['off', 'always']
 DELAY_CHOICES = [0, 5, 10, 30]
+CHANNEL_CHOICES = ['queue', 'email', 'push']
+DIGEST_CHOICES = ['off', 'daily', 'weekly']
+CLOCK_REGEX = r'^([01][0-9]|2[0-3]):[0-5][0-9]$'
 
 
 class Settings(Model):
@@ -29,3 +33,9 @@ class Settings(Model):
     notification_sound_enabled = BooleanType(default=False)
     notification_delay_disappear = IntType(default=10,
                                            choices=DELAY_CHOICES)
+    notification_channels = DictType(ListType(StringType(
+        choices=CHANNEL_CHOICES)), default=lambda: {})
+    notification_digest = StringType(default='off', choices=DIGEST_CHOICES)
+    notification_quiet_start = StringType(regex=CLOCK_REGEX)
+    notification_quiet_end = StringType(regex=CLOCK_REGEX)
+    notification_timezone = StringType(default='UTC')
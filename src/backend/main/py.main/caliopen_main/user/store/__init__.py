@@ -2,13 +2,16 @@
 from __future__ import absolute_import, print_function, unicode_literals
 
 from .user import User, UserName, ReservedName, FilterRule, UserRecoveryEmail
-from .user import IndexUser, Settings
+from .user import IndexUser, Settings, UserPurge, SavedSearch
+from .user import SettingsDigestLookup, AppPassword
 from .identity import UserIdentity, IdentityLookup, IdentityTypeLookup
+from .identity import WkdLookup, WksRequest
 from .tag import UserTag
 
 
 __all__ = [
     'User', 'UserName', 'UserRecoveryEmail', 'UserTag', 'FilterRule',
     'ReservedName', 'UserIdentity', 'IdentityLookup', 'IdentityTypeLookup',
-    'IndexUser', 'UserTag', 'Settings',
+    'IndexUser', 'UserTag', 'Settings', 'UserPurge', 'SavedSearch',
+    'SettingsDigestLookup', 'AppPassword', 'WkdLookup', 'WksRequest',
 ]
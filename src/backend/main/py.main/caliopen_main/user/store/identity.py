@@ -43,3 +43,24 @@ class IdentityTypeLookup(BaseModel):
     user_id = columns.UUID(primary_key=True)
     identity_id = columns.UUID(primary_key=True)
 
+
+class WkdLookup(BaseModel):
+    """Model for wkd_lookup table to retrieve local identity by WKD hash"""
+
+    domain = columns.Text(partition_key=True)
+    hash = columns.Text(partition_key=True)     # zbase32(sha1(local-part))
+    address = columns.Text()
+    identity_id = columns.UUID()
+    user_id = columns.UUID()
+
+
+class WksRequest(BaseModel):
+    """Key submitted to Web Key Service, pending owner's confirmation"""
+
+    nonce = columns.Text(primary_key=True)
+    address = columns.Text()
+    date_insert = columns.DateTime()
+    fingerprint = columns.Text()
+    identity_id = columns.UUID()
+    key = columns.Text()                        # armored submitted key
+    user_id = columns.UUID()
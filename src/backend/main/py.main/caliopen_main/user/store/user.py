@@ -69,6 +69,38 @@ class FilterRule(BaseModel):
     stop_condition = columns.Boolean()
 
 
+class AppPassword(BaseModel):
+    """
+    Passwords generated for clients that can't go through login process.
+
+    password_hash: bcrypt hash, clear password is only shown once to user.
+    """
+
+    user_id = columns.UUID(primary_key=True)
+    app_password_id = columns.UUID(primary_key=True)
+    date_insert = columns.DateTime()
+    label = columns.Text()
+    password_hash = columns.Blob()
+
+
+class SavedSearch(BaseModel):
+    """
+    User's saved searches, displayed as smart folders.
+
+    filters: JSON list of structured search clauses.
+    auto_tag: tag applied to inbound messages matching search.
+    """
+
+    user_id = columns.UUID(primary_key=True)
+    search_id = columns.UUID(primary_key=True)
+    auto_tag = columns.Text()
+    date_insert = columns.DateTime()
+    date_update = columns.DateTime()
+    filters = columns.Text()
+    name = columns.Text()
+    query = columns.Text()
+
+
 class Settings(BaseModel):
     """All settings related to an user."""
 
@@ -81,6 +113,38 @@ class Settings(BaseModel):
     notification_message_preview = columns.Text()
     notification_sound_enabled = columns.Boolean()
     notification_delay_disappear = columns.Integer()
+    notification_channels = columns.Map(columns.Text(),
+                                        columns.List(columns.Text()))
+    notification_digest = columns.Text()
+    notification_quiet_start = columns.Text()
+    notification_quiet_end = columns.Text()
+    notification_timezone = columns.Text()
+
+
+class SettingsDigestLookup(BaseModel):
+    """Permit lookup of users who subscribed to an email digest."""
+
+    notification_digest = columns.Text(primary_key=True)
+    user_id = columns.UUID(primary_key=True)
+
+
+class UserPurge(BaseModel):
+    """
+    Progress of the purge of a deleted user's data, run by API's purge workers.
+
+    step: next purge step to process, 'done' once purge is completed.
+    counts: resources removed by each step.
+    lease_until: purge is processed by a single worker until this date.
+    """
+
+    user_id = columns.UUID(primary_key=True)
+    counts = columns.Map(columns.Text(), columns.Integer())
+    date_end = columns.DateTime()
+    date_start = columns.DateTime()
+    date_update = columns.DateTime()
+    last_error = columns.Text()
+    lease_until = columns.DateTime()
+    step = columns.Text()
 
 
 class IndexUser(object):
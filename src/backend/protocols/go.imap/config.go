@@ -13,10 +13,14 @@ import (
 type (
 	WorkerConfig struct {
 		Hostname             string      `mapstructure:"hostname"`
+		IdleMode             bool        `mapstructure:"idle_mode"`
+		MaxIdleConns         int         `mapstructure:"max_idle_connections"`
 		NatsQueue            string      `mapstructure:"nats_queue"`
 		NatsTopicPoller      string      `mapstructure:"nats_topic_poller"`
 		NatsTopicPollerCache string      `mapstructure:"nats_topic_poller_cache"`
 		NatsTopicSender      string      `mapstructure:"nats_topic_sender"`
+		NatsTopicStatus      string      `mapstructure:"nats_topic_status"`
+		NatsTopicImports     string      `mapstructure:"nats_topic_imports"`
 		NatsUrl              string      `mapstructure:"nats_url"`
 		StoreName            string      `mapstructure:"store_name"`
 		Workers              uint8       `mapstructure:"workers"`
@@ -7,6 +7,7 @@
 package imap_worker
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
@@ -15,7 +16,10 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/emersion/go-imap"
 	"github.com/satori/go.uuid"
+	"net/mail"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,13 +27,70 @@ type Fetcher struct {
 	Hostname string
 	Store    backends.LDAStore
 	Lda      *Lda
+	progress func(syncProgress) // optional callback to report sync progress to worker
+}
+
+// syncProgress is reported by fetcher while syncing a remote identity
+type syncProgress struct {
+	errors  []string
+	fetched int
 }
 
 type imapBox struct {
-	lastSeenUid uint32
-	lastSync    time.Time
-	name        string
-	uidValidity uint32
+	deleted       map[uint32]string // uids flagged \Deleted on remote, with their Message-ID, until they are expunged
+	highestModSeq uint64            // highest MODSEQ seen during last flags sync (see RFC7162)
+	ignore        bool
+	keywords      bool // true if remote mailbox accepts keywords, not persisted
+	lastSeenUid   uint32
+	lastSync      time.Time
+	name          string
+	resync        bool // true if mailbox is fetched again from scratch, not persisted
+	tag           string
+	uidValidity   uint32
+	mu            sync.Mutex // guards lastSeenUid and resync, shared by syncMails and lda's loop
+}
+
+// markDeleted records that remote message uid, with Message-ID externalId, is flagged \Deleted
+func (box *imapBox) markDeleted(uid uint32, externalId string) {
+	if box.deleted == nil {
+		box.deleted = map[uint32]string{}
+	}
+	box.deleted[uid] = externalId
+}
+
+// seenUid returns the uid of the last message delivered from mailbox
+func (box *imapBox) seenUid() uint32 {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+	return box.lastSeenUid
+}
+
+// markSeen records uid as the last message delivered from mailbox
+func (box *imapBox) markSeen(uid uint32) {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+	box.lastSeenUid = uid
+}
+
+// restart resets mailbox's position so that all its messages are fetched again
+func (box *imapBox) restart() {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+	box.lastSeenUid = 0
+	box.resync = true
+}
+
+// resyncing tells if mailbox is being fetched again from scratch
+func (box *imapBox) resyncing() bool {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+	return box.resync
+}
+
+// fetchedMail is an Email fetched from a remote mailbox, ready for lda
+type fetchedMail struct {
+	box  *imapBox
+	mail *Email
 }
 
 const (
@@ -37,8 +98,34 @@ const (
 	dateFirstErrorKey = "firstErrorDate"
 	dateLastErrorKey  = "lastErrorDate"
 	errorsCountKey    = "errorsCount"
+
+	progressStep = 50 // how many delivered mails between two progress reports
+)
+
+var (
+	syncingIdentities = make(map[string]bool)
+	syncingMutex      sync.Mutex
 )
 
+// lockIdentitySync prevents concurrent syncs of a remote identity within worker's process,
+// whether they are ordered by idpoller or triggered by an idler.
+// Syncs running in other workers are prevented by identity's `syncing` info (see SyncRemoteWithLocal).
+func lockIdentitySync(identityId string) bool {
+	syncingMutex.Lock()
+	defer syncingMutex.Unlock()
+	if syncingIdentities[identityId] {
+		return false
+	}
+	syncingIdentities[identityId] = true
+	return true
+}
+
+func unlockIdentitySync(identityId string) {
+	syncingMutex.Lock()
+	defer syncingMutex.Unlock()
+	delete(syncingIdentities, identityId)
+}
+
 // unexported vars to help override funcs in tests
 var syncRemoteWithLocal = func(f *Fetcher, order IMAPorder) error {
 	return f.SyncRemoteWithLocal(order)
@@ -46,6 +133,9 @@ var syncRemoteWithLocal = func(f *Fetcher, order IMAPorder) error {
 var fetchRemoteToLocal = func(f *Fetcher, order IMAPorder) error {
 	return f.FetchRemoteToLocal(order)
 }
+var resetSyncState = func(f *Fetcher, order IMAPorder) error {
+	return f.ResetSyncState(order)
+}
 
 // FetchSyncRemote retrieves remote identity credentials and last sync data,
 // connects to remote IMAP server to fetch new mails,
@@ -84,51 +174,50 @@ func (f *Fetcher) SyncRemoteWithLocal(order IMAPorder) error {
 	}
 
 	// 2. sync/fetch with remote IMAP
-	mails := make(chan *Email)
-	lastsync := time.Time{}
-	if ls, ok := userIdentity.Infos["lastsync"]; ok && ls != "" {
-		lastsync, err = time.Parse(time.RFC3339, userIdentity.Infos["lastsync"])
-		if err != nil {
-			log.WithError(err).Warnf("[syncMails] failed to parse lastsync string <%s>", userIdentity.Infos["lastsync"])
-			lastsync = time.Time{}
+	// mailboxes list is reconciled with remote by syncMails,
+	// it must not be read before mails chan is closed.
+	mailboxes := readMailboxes(userIdentity.Infos)
+	if order.Order == "full_sync" {
+		// fetch again all messages, messages already imported are skipped below
+		for _, box := range mailboxes {
+			box.restart()
 		}
-	} else {
-		lastsync = time.Time{}
-	}
-	// Sync INBOX (only INBOX for now)
-	// TODO : sync other mailbox(es) from userIdentity.Infos params or from order
-	lastseenuid, err := strconv.Atoi(userIdentity.Infos["lastseenuid"])
-	if err != nil {
-		log.WithError(err).Warn("[SyncRemoteWithLocal] failed to get lastseenuid")
-	}
-	uidvalidity, err := strconv.Atoi(userIdentity.Infos["uidvalidity"])
-	if err != nil {
-		log.WithError(err).Warn("[SyncRemoteWithLocal] failed to get uidvalidity")
 	}
-	box := imapBox{
-		lastSeenUid: uint32(lastseenuid),
-		lastSync:    lastsync,
-		name:        "INBOX",
-		uidValidity: uint32(uidvalidity),
-	}
-	go f.syncMails(userIdentity, &box, mails)
+	mails := make(chan *fetchedMail)
+	go f.syncMails(userIdentity, &mailboxes, mails)
 
 	// 3. forward mails to lda as they come on mails chan
 	errs := []error{}
+	progress := syncProgress{}
 	syncTimeout := time.Now()
-	for mail := range mails {
-		if mail.ImapUid <= box.lastSeenUid {
+	for fetched := range mails {
+		if fetched.mail.ImapUid <= fetched.box.seenUid() {
 			// do not forward seen message, we already have it
 			continue
 		}
-		err := f.Lda.deliverMail(mail, order.UserId, userIdentity.Id.String())
+		if fetched.box.resyncing() && f.alreadyImported(fetched.mail, order.UserId, userIdentity.Id.String()) {
+			// mailbox is fetched from scratch (full sync, UIDVALIDITY change) : don't duplicate messages we have
+			fetched.box.markSeen(fetched.mail.ImapUid)
+			continue
+		}
+		err := f.Lda.deliverMail(fetched.mail, order.UserId, userIdentity.Id.String(), fetched.box.tag)
 		errs = append(errs, err)
 		if err == nil {
-			box.lastSeenUid = mail.ImapUid
+			fetched.box.markSeen(fetched.mail.ImapUid)
+			progress.fetched++
+		} else {
+			progress.errors = append(progress.errors, err.Error())
+		}
+		if len(errs)%progressStep == 0 {
+			f.reportProgress(progress)
 		}
 		if time.Since(syncTimeout)/time.Hour > syncingTimeout {
 			errs = append(errs, errors.New("[Fetcher] sync timeout, aborting for "+order.IdentityId))
-			close(mails)
+			// drain chan to let syncMails terminate
+			go func() {
+				for range mails {
+				}
+			}()
 			break
 		}
 
@@ -148,14 +237,20 @@ func (f *Fetcher) SyncRemoteWithLocal(order IMAPorder) error {
 	if _, ok := userIdentity.Infos[errorsCountKey]; !ok {
 		// if errorsCountKey IS NOT in Infos then sync succeeded
 		// update infos accordingly
-		userIdentity.Infos["uidvalidity"] = strconv.Itoa(int(box.uidValidity))
 		userIdentity.Infos["lastsync"] = userIdentity.LastCheck.Format(time.RFC3339)
-		userIdentity.Infos["lastseenuid"] = strconv.Itoa(int(box.lastSeenUid))
+		err = writeMailboxes(userIdentity.Infos, mailboxes)
+		if err != nil {
+			log.WithError(err).Warnf("[SyncRemoteWithLocal] failed to marshal mailboxes state for %s", order.IdentityId)
+		}
 	}
 	fields = map[string]interface{}{
 		"LastCheck": userIdentity.LastCheck,
 		"Infos":     userIdentity.Infos,
 	}
+	if _, ok := userIdentity.Infos[errorsCountKey]; ok {
+		progress.errors = append(progress.errors, userIdentity.Infos[lastErrorKey])
+	}
+	f.reportProgress(progress)
 	err = f.Store.UpdateUserIdentity(userIdentity, fields)
 	if err != nil {
 		log.WithError(err).Warnf("[syncMails] failed to backup sync state")
@@ -166,6 +261,45 @@ func (f *Fetcher) SyncRemoteWithLocal(order IMAPorder) error {
 	return nil
 }
 
+// alreadyImported tells if a message with the same Message-ID has already been delivered for user's identity
+func (f *Fetcher) alreadyImported(email *Email, userId, identityId string) bool {
+	msg, err := mail.ReadMessage(bytes.NewReader(email.Raw.Bytes()))
+	if err != nil {
+		return false
+	}
+	externalId := externalMessageId(msg.Header.Get("Message-Id"))
+	if externalId == "" {
+		return false
+	}
+	msgId, err := f.Store.SeekMessageByExternalRef(userId, externalId, identityId)
+	return err == nil && msgId.String() != EmptyUUID.String()
+}
+
+// externalMessageId returns Message-ID the way it is saved in external refs lookup table, ie without angle brackets
+func externalMessageId(header string) string {
+	return strings.Trim(header, "<> \t\r\n")
+}
+
+// ResetSyncState removes sync state and errors from remote identity, so that next sync will start from scratch.
+// Legacy INBOX only sync state is removed too, otherwise readMailboxes would resume from it.
+func (f *Fetcher) ResetSyncState(order IMAPorder) error {
+	userIdentity, err := f.Store.RetrieveUserIdentity(order.UserId, order.IdentityId, false)
+	if err != nil {
+		log.WithError(err).Infof("[ResetSyncState] failed to retrieve remote identity <%s> : <%s>", order.UserId, order.IdentityId)
+		return err
+	}
+	for _, key := range []string{"lastsync", "lastseenuid", "uidvalidity", "syncing", mailboxesKey, lastErrorKey, dateFirstErrorKey, dateLastErrorKey, errorsCountKey} {
+		delete((*userIdentity).Infos, key)
+	}
+	err = f.Store.UpdateUserIdentity(userIdentity, map[string]interface{}{
+		"Infos": userIdentity.Infos,
+	})
+	if err != nil {
+		log.WithError(err).Warnf("[ResetSyncState] failed to update remote identity <%s> : <%s>", order.UserId, order.IdentityId)
+	}
+	return err
+}
+
 // FetchRemoteToLocal blindly fetches all mails from remote without retrieving/saving any state in UserIdentity
 func (f *Fetcher) FetchRemoteToLocal(order IMAPorder) error {
 	userIdentity := UserIdentity{
@@ -237,9 +371,10 @@ func (f *Fetcher) fetchMails(userIdentity *UserIdentity, box *imapBox, ch chan *
 	return
 }
 
-// fetchSyncMails reads last sync state for remote identity,
+// syncMails reads last sync state of each remote mailbox,
 // fetches new messages accordingly, and returns well-formed Emails for lda.
-func (f *Fetcher) syncMails(userIdentity *UserIdentity, box *imapBox, ch chan *Email) (err error) {
+// boxes list is updated in-place with mailboxes found on remote.
+func (f *Fetcher) syncMails(userIdentity *UserIdentity, boxes *[]*imapBox, ch chan *fetchedMail) (err error) {
 	// Don't forget to close chan before leaving
 	defer close(ch)
 	if userIdentity.Infos["authtype"] == Oauth2 {
@@ -263,22 +398,50 @@ func (f *Fetcher) syncMails(userIdentity *UserIdentity, box *imapBox, ch chan *E
 		log.Println("Logged out")
 	}()
 
-	newMessages := make(chan *imap.Message, 10)
-	//TODO : manage closing
-	go syncMailbox(box, imapClient, provider, newMessages) //TODO : errors handling
+	// reconcile mailboxes list with remote ones
+	remoteBoxes, err := listMailboxes(imapClient)
+	if err != nil {
+		log.WithError(err).Warnf("[syncMails] failed to list remote mailboxes for identity %s, syncing known mailboxes only", userIdentity.Id.String())
+	} else {
+		*boxes = mergeMailboxes(*boxes, remoteBoxes)
+	}
+	f.ensureMailboxesTags(userIdentity.UserId, *boxes)
+	boxesTags := mailboxesTags(*boxes)
 
-	// read new messages coming from imap chan and write to lda chan with added custom headers
-	for msg := range newMessages {
-		xHeaders := buildXheaders(tlsConn, userIdentity, box, msg, provider)
-		mail, err := MarshalImap(msg, xHeaders)
-		if err != nil {
-			//todo
+	for _, box := range *boxes {
+		if box.ignore {
 			continue
-		} else {
-			ch <- mail
+		}
+		newMessages := make(chan *imap.Message, 10)
+		syncErr := make(chan error, 1)
+		go func(box *imapBox) {
+			syncErr <- syncMailbox(box, imapClient, provider, newMessages)
+		}(box)
+
+		// read new messages coming from imap chan and write to lda chan with added custom headers
+		for msg := range newMessages {
+			xHeaders := buildXheaders(tlsConn, userIdentity, box, msg, provider)
+			mail, err := MarshalImap(msg, xHeaders)
+			if err != nil {
+				//todo
+				continue
+			} else {
+				ch <- &fetchedMail{box: box, mail: mail}
+			}
+		}
+		if e := <-syncErr; e != nil {
+			log.WithError(e).Warnf("[syncMails] failed to sync mailbox <%s> for identity %s", box.name, userIdentity.Id.String())
+			continue
+		}
+		box.lastSync = time.Now()
+
+		// reflect remote flags changes onto messages already fetched
+		err = f.syncFlagsFromRemote(userIdentity, box, boxesTags, imapClient, provider)
+		if err != nil {
+			log.WithError(err).Warnf("[syncMails] failed to sync flags of mailbox <%s> for identity %s", box.name, userIdentity.Id.String())
 		}
 	}
-	return
+	return nil
 }
 
 // handleFetchFailure logs a warn and save failure log in db.
@@ -357,6 +520,13 @@ func (f *Fetcher) disableRemoteIdentity(userIdentity *UserIdentity) {
 	}
 }
 
+// reportProgress forwards sync progress to worker, if it asked for it
+func (f *Fetcher) reportProgress(progress syncProgress) {
+	if f.progress != nil {
+		f.progress(progress)
+	}
+}
+
 func (f Fetcher) emitNotification() {
 	//TODO
 }
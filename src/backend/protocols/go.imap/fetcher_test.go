@@ -0,0 +1,78 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"bytes"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"testing"
+)
+
+// resetTestStore holds one remote identity in memory
+type resetTestStore struct {
+	backendstest.LDAStoreBackend
+	identity *UserIdentity
+}
+
+func (s *resetTestStore) RetrieveUserIdentity(userId, identityId string, withCredentials bool) (*UserIdentity, error) {
+	return s.identity, nil
+}
+func (s *resetTestStore) UpdateUserIdentity(userIdentity *UserIdentity, fields map[string]interface{}) error {
+	s.identity.Infos = fields["Infos"].(map[string]string)
+	return nil
+}
+
+func TestFetcher_alreadyImported(t *testing.T) {
+	f := &Fetcher{Store: &importTestStore{}}
+	for raw, expected := range map[string]bool{
+		"Message-Id: <already@example.com>\r\nSubject: one\r\n\r\nhello\r\n": true,
+		"Message-Id:  <new@example.com>\r\nSubject: two\r\n\r\nhello\r\n":    false,
+		"Subject: no id\r\n\r\nhello\r\n":                                    false,
+	} {
+		email := &Email{Raw: *bytes.NewBufferString(raw)}
+		if imported := f.alreadyImported(email, "user", "identity"); imported != expected {
+			t.Errorf("expected alreadyImported to be %t for %q", expected, raw)
+		}
+	}
+}
+
+func Test_imapBox_restart(t *testing.T) {
+	box := &imapBox{lastSeenUid: 42, name: inboxName}
+	if box.resyncing() || box.seenUid() != 42 {
+		t.Fatal("unexpected initial state")
+	}
+	box.restart()
+	if !box.resyncing() || box.seenUid() != 0 {
+		t.Error("expected restarted mailbox to be resyncing from uid 0")
+	}
+	box.markSeen(7)
+	if box.seenUid() != 7 {
+		t.Errorf("expected last seen uid to be 7, got %d", box.seenUid())
+	}
+}
+
+func TestFetcher_ResetSyncState(t *testing.T) {
+	store := &resetTestStore{identity: &UserIdentity{Infos: map[string]string{
+		"inserver":    "imap.example.com:993",
+		"lastsync":    "2019-04-02T10:30:00Z",
+		"lastseenuid": "42",
+		"uidvalidity": "1234",
+		mailboxesKey:  `[{"name":"INBOX","lastseenuid":7,"uidvalidity":1}]`,
+		lastErrorKey:  "failed",
+	}}}
+	f := &Fetcher{Store: store}
+	if err := f.ResetSyncState(IMAPorder{UserId: "user", IdentityId: "identity"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.identity.Infos) != 1 || store.identity.Infos["inserver"] == "" {
+		t.Errorf("expected only inserver to be left in infos, got %+v", store.identity.Infos)
+	}
+	for _, box := range readMailboxes(store.identity.Infos) {
+		if box.lastSeenUid != 0 || box.uidValidity != 0 {
+			t.Errorf("expected mailbox %s to be synced from scratch, got %+v", box.name, box)
+		}
+	}
+}
@@ -0,0 +1,570 @@
+/*
+ * // Copyleft (ɔ) 2019 The Caliopen contributors.
+ * // Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+ * // license (AGPL) that can be found in the LICENSE file.
+ */
+
+package imap_worker
+
+/* flags synchronization between Caliopen messages and remote IMAP messages :
+	\Seen     <-> Message.Is_unread
+	\Answered <-> Message.Is_answered
+	\Flagged  <-> flaggedTag
+	\Deleted   -> deletedTag, message is deleted once expunged from remote
+	keywords  <-> user's tags, if remote mailbox accepts keywords
+Tags mapped to remote mailboxes are never pushed as keywords.
+\Deleted is only a mark that remote clients can undo : messages are deleted locally when their uid vanishes from mailbox.
+*/
+
+import (
+	"encoding/base64"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/users"
+	log "github.com/Sirupsen/logrus"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+	"github.com/gocql/gocql"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	flaggedTag          = "flagged" // Caliopen tag mirroring IMAP \Flagged flag
+	deletedTag          = "deleted" // Caliopen tag mirroring IMAP \Deleted flag, until message is expunged
+	condstoreCapability = "CONDSTORE"
+	modSeqItem          = imap.FetchItem("MODSEQ")
+)
+
+// unexported var to help override func in tests
+var pushFlagsToRemote = func(f *Fetcher, order IMAPorder) error {
+	return f.PushFlagsToRemote(order)
+}
+
+// PushFlagsToRemote reflects message's state (unread, answered, tags) to the remote IMAP message(s)
+// found with the same Message-ID within the mailbox the message has been fetched from.
+func (f *Fetcher) PushFlagsToRemote(order IMAPorder) error {
+	userIdentity, err := f.Store.RetrieveUserIdentity(order.UserId, order.IdentityId, true)
+	if err != nil {
+		log.WithError(err).Infof("[PushFlagsToRemote] failed to retrieve remote identity <%s> : <%s>", order.UserId, order.IdentityId)
+		return err
+	}
+	msg, err := f.Store.RetrieveMessage(order.UserId, order.MessageId)
+	if err != nil {
+		log.WithError(err).Infof("[PushFlagsToRemote] failed to retrieve message <%s> for user <%s>", order.MessageId, order.UserId)
+		return err
+	}
+	if msg.External_references.Message_id == "" {
+		return errors.New("[PushFlagsToRemote] message " + order.MessageId + " has no Message-ID, unable to find it on remote")
+	}
+	boxName := inboxName
+	if rawMsg, e := f.Store.GetRawMessage(msg.Raw_msg_id.String()); e == nil {
+		if name := fetchedBoxName(rawMsg.Raw_data); name != "" {
+			boxName = name
+		}
+	}
+	userTags := f.userTagsSet(order.UserId)
+
+	if userIdentity.Infos["authtype"] == Oauth2 {
+		err = users.ValidateOauth2Credentials(userIdentity, f, true)
+		if err != nil {
+			return err
+		}
+	}
+	_, imapClient, _, err := imapLogin(userIdentity)
+	if err != nil {
+		return err
+	}
+	defer imapClient.Logout()
+
+	mbox, err := imapClient.Select(boxName, false)
+	if err != nil {
+		log.WithError(err).Warnf("[PushFlagsToRemote] failed to select mailbox <%s>", boxName)
+		return err
+	}
+	withKeywords := false
+	for _, flag := range mbox.PermanentFlags {
+		if flag == imap.TryCreateFlag {
+			withKeywords = true
+		}
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("Message-Id", msg.External_references.Message_id)
+	uids, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return err
+	}
+	if len(uids) == 0 {
+		log.Infof("[PushFlagsToRemote] message <%s> not found in remote mailbox <%s>", msg.External_references.Message_id, boxName)
+		return nil
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	remoteMessages := make(chan *imap.Message, len(uids))
+	err = imapClient.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, remoteMessages)
+	if err != nil {
+		return err
+	}
+
+	boxesTags := mailboxesTags(readMailboxes(userIdentity.Infos))
+	desired := imapFlagsFromMessage(msg, boxesTags, withKeywords)
+	managedKeywords := map[string]string{}
+	if withKeywords {
+		for keyword, tag := range tagsKeywords(userTags) {
+			if !boxesTags[tag] {
+				managedKeywords[keyword] = tag
+			}
+		}
+	}
+	for remote := range remoteMessages {
+		add, remove := flagsDiff(remote.Flags, desired, managedKeywords)
+		err = storeFlags(imapClient, remote.Uid, add, remove)
+		if err != nil {
+			log.WithError(err).Warnf("[PushFlagsToRemote] failed to store flags for uid %d in mailbox <%s>", remote.Uid, boxName)
+		}
+	}
+	return err
+}
+
+// syncFlagsFromRemote reflects remote flags changes of the currently selected mailbox onto local messages.
+// If server has CONDSTORE capability, only messages changed since box.highestModSeq are fetched,
+// otherwise flags of all messages are fetched.
+// Messages explicitly deleted by user (see message_deleted_lookup) are flagged \Deleted on remote.
+// Messages flagged \Deleted on remote are tagged with deletedTag, and deleted once expunged (see expungeVanished).
+func (f *Fetcher) syncFlagsFromRemote(userIdentity *UserIdentity, box *imapBox, boxesTags map[string]bool, imapClient *client.Client, provider Provider) error {
+	userId := userIdentity.UserId.String()
+	user, err := f.Store.RetrieveUser(userId)
+	if err != nil {
+		return err
+	}
+	userInfo := &UserInfo{User_id: userId, Shard_id: user.ShardId}
+	userTags := f.userTagsSet(userId)
+
+	condstore := provider.Capabilities[condstoreCapability]
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchEnvelope}
+	if condstore {
+		items = append(items, modSeqItem)
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(1, 0)
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		if condstore && box.highestModSeq > 0 {
+			done <- uidFetchChangedSince(imapClient, seqset, items, box.highestModSeq, messages)
+		} else {
+			done <- imapClient.UidFetch(seqset, items, messages)
+		}
+	}()
+
+	highestModSeq := box.highestModSeq
+	locallyDeleted := new(imap.SeqSet)
+	deletedRefs := []string{}
+	identityId := userIdentity.Id.String()
+	for msg := range messages {
+		if ms := messageModSeq(msg); ms > highestModSeq {
+			highestModSeq = ms
+		}
+		if msg.Envelope == nil || msg.Envelope.MessageId == "" {
+			continue
+		}
+		externalId := externalMessageId(msg.Envelope.MessageId)
+		msgId, err := f.Store.SeekMessageByExternalRef(userId, externalId, identityId)
+		if err != nil || msgId.String() == EmptyUUID.String() {
+			// message not imported (yet)
+			continue
+		}
+		local, err := f.Store.RetrieveMessage(userId, msgId.String())
+		if err != nil {
+			// only deletions explicitly recorded when user deleted the message are reflected onto remote,
+			// a lookup failure must never destroy remote mail.
+			if err == gocql.ErrNotFound {
+				if deleted, e := f.Store.IsMessageDeleted(userId, identityId, externalId); e == nil && deleted {
+					locallyDeleted.AddNum(msg.Uid)
+					deletedRefs = append(deletedRefs, externalId)
+				}
+			}
+			continue
+		}
+		if hasFlag(msg.Flags, imap.DeletedFlag) {
+			box.markDeleted(msg.Uid, externalId)
+		} else {
+			delete(box.deleted, msg.Uid)
+		}
+		fields := messageChangesFromFlags(local, msg.Flags, userTags, boxesTags, box.keywords)
+		if len(fields) == 0 {
+			continue
+		}
+		if tags, ok := fields["Tags"]; ok {
+			for tag, label := range map[string]string{flaggedTag: "Flagged", deletedTag: "Deleted"} {
+				if !userTags[tag] && hasFlag(tags.([]string), tag) {
+					f.createFlagTag(userIdentity.UserId, tag, label)
+					userTags[tag] = true
+				}
+			}
+		}
+		err = f.Store.UpdateMessage(local, fields)
+		if err != nil {
+			log.WithError(err).Warnf("[syncFlagsFromRemote] failed to update message %s", local.Message_id.String())
+			continue
+		}
+		err = f.Lda.broker.Index.UpdateMessage(userInfo, local, fields)
+		if err != nil {
+			log.WithError(err).Warnf("[syncFlagsFromRemote] failed to update indexed message %s", local.Message_id.String())
+		}
+	}
+	err = <-done
+	if err != nil {
+		return err
+	}
+	box.highestModSeq = highestModSeq
+	f.expungeVanished(userInfo, identityId, box, imapClient)
+
+	if !locallyDeleted.Empty() {
+		err = imapClient.UidStore(locallyDeleted, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil)
+		if err != nil {
+			log.WithError(err).Warnf("[syncFlagsFromRemote] failed to flag locally deleted messages in mailbox <%s>", box.name)
+			return nil
+		}
+		for _, externalId := range deletedRefs {
+			err = f.Store.RemoveMessageDeletedLookup(userId, identityId, externalId)
+			if err != nil {
+				log.WithError(err).Warnf("[syncFlagsFromRemote] failed to remove deletion record of message <%s>", externalId)
+			}
+		}
+	}
+	return nil
+}
+
+// expungeVanished deletes local messages that were flagged \Deleted on remote and have been expunged since :
+// their uids are not found anymore in mailbox. Messages still there are kept, tagged with deletedTag.
+func (f *Fetcher) expungeVanished(userInfo *UserInfo, identityId string, box *imapBox, imapClient *client.Client) {
+	if len(box.deleted) == 0 {
+		return
+	}
+	pending := new(imap.SeqSet)
+	for uid := range box.deleted {
+		pending.AddNum(uid)
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = pending
+	present, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		log.WithError(err).Warnf("[expungeVanished] failed to search deleted messages in mailbox <%s>", box.name)
+		return
+	}
+	for _, uid := range vanishedUids(box.deleted, present) {
+		externalId := box.deleted[uid]
+		delete(box.deleted, uid)
+		msgId, err := f.Store.SeekMessageByExternalRef(userInfo.User_id, externalId, identityId)
+		if err != nil || msgId.String() == EmptyUUID.String() {
+			continue
+		}
+		local, err := f.Store.RetrieveMessage(userInfo.User_id, msgId.String())
+		if err != nil {
+			continue
+		}
+		if err = f.Store.DeleteMessage(local); err != nil {
+			log.WithError(err).Warnf("[expungeVanished] failed to delete message %s", local.Message_id.String())
+			continue
+		}
+		if err = f.Lda.broker.Index.DeleteMessage(userInfo, local); err != nil {
+			log.WithError(err).Warnf("[expungeVanished] failed to unindex message %s", local.Message_id.String())
+		}
+	}
+}
+
+// vanishedUids returns the uids of deleted that are not present anymore, in ascending order
+func vanishedUids(deleted map[uint32]string, present []uint32) (vanished []uint32) {
+	found := map[uint32]bool{}
+	for _, uid := range present {
+		found[uid] = true
+	}
+	for uid := range deleted {
+		if !found[uid] {
+			vanished = append(vanished, uid)
+		}
+	}
+	sort.Slice(vanished, func(i, j int) bool { return vanished[i] < vanished[j] })
+	return
+}
+
+// imapFlagsFromMessage returns the IMAP flags reflecting message's state.
+// Tags are converted to keywords if withKeywords is true, except tags mapped to mailboxes.
+func imapFlagsFromMessage(msg *Message, boxesTags map[string]bool, withKeywords bool) (flags []string) {
+	flags = []string{}
+	if !msg.Is_unread {
+		flags = append(flags, imap.SeenFlag)
+	}
+	if msg.Is_answered {
+		flags = append(flags, imap.AnsweredFlag)
+	}
+	for _, tag := range msg.Tags {
+		switch {
+		case tag == flaggedTag:
+			flags = append(flags, imap.FlaggedFlag)
+		case tag == deletedTag:
+			// \Deleted is only set on remote by user's deletions, see syncFlagsFromRemote
+		case withKeywords && !boxesTags[tag]:
+			flags = append(flags, tagToKeyword(tag))
+		}
+	}
+	return
+}
+
+// messageChangesFromFlags returns message's fields that must be updated to reflect remote IMAP flags.
+// Only keywords matching one of user's tags are taken into account.
+func messageChangesFromFlags(msg *Message, flags []string, userTags, boxesTags map[string]bool, withKeywords bool) (fields map[string]interface{}) {
+	fields = map[string]interface{}{}
+	keywords := tagsKeywords(userTags)
+	var seen, answered, flagged, deleted bool
+	remoteTags := map[string]bool{}
+	for _, flag := range flags {
+		switch {
+		case strings.EqualFold(flag, imap.SeenFlag):
+			seen = true
+		case strings.EqualFold(flag, imap.AnsweredFlag):
+			answered = true
+		case strings.EqualFold(flag, imap.FlaggedFlag):
+			flagged = true
+		case strings.EqualFold(flag, imap.DeletedFlag):
+			deleted = true
+		case withKeywords:
+			if tag, ok := keywords[strings.ToLower(flag)]; ok {
+				remoteTags[tag] = true
+			}
+		}
+	}
+	if msg.Is_unread == seen {
+		fields["Is_unread"] = !seen
+	}
+	if msg.Is_answered != answered {
+		fields["Is_answered"] = answered
+	}
+
+	tags := []string{}
+	tagsChanged := false
+	hasFlaggedTag, hasDeletedTag := false, false
+	for _, tag := range msg.Tags {
+		switch {
+		case tag == flaggedTag:
+			if !flagged {
+				tagsChanged = true
+				continue
+			}
+			hasFlaggedTag = true
+		case tag == deletedTag:
+			if !deleted {
+				tagsChanged = true
+				continue
+			}
+			hasDeletedTag = true
+		case boxesTags[tag]:
+			// mailbox's tag is not mirrored by a keyword
+		case withKeywords && userTags[tag]:
+			if !remoteTags[tag] {
+				tagsChanged = true
+				continue
+			}
+			delete(remoteTags, tag)
+		}
+		tags = append(tags, tag)
+	}
+	if flagged && !hasFlaggedTag {
+		tags = append(tags, flaggedTag)
+		tagsChanged = true
+	}
+	if deleted && !hasDeletedTag {
+		tags = append(tags, deletedTag)
+		tagsChanged = true
+	}
+	newTags := []string{}
+	for tag := range remoteTags {
+		if !boxesTags[tag] && tag != flaggedTag && tag != deletedTag {
+			newTags = append(newTags, tag)
+		}
+	}
+	if len(newTags) > 0 {
+		sort.Strings(newTags)
+		tags = append(tags, newTags...)
+		tagsChanged = true
+	}
+	if tagsChanged {
+		fields["Tags"] = tags
+	}
+	return
+}
+
+// flagsDiff returns flags to add and to remove to turn current flags into desired flags.
+// Flags not managed by Caliopen are left untouched.
+func flagsDiff(current, desired []string, managedKeywords map[string]string) (add, remove []string) {
+	add, remove = []string{}, []string{}
+	isManaged := func(flag string) bool {
+		switch {
+		case strings.EqualFold(flag, imap.SeenFlag),
+			strings.EqualFold(flag, imap.AnsweredFlag),
+			strings.EqualFold(flag, imap.FlaggedFlag):
+			return true
+		}
+		_, ok := managedKeywords[strings.ToLower(flag)]
+		return ok
+	}
+	for _, flag := range desired {
+		if !hasFlag(current, flag) {
+			add = append(add, flag)
+		}
+	}
+	for _, flag := range current {
+		if isManaged(flag) && !hasFlag(desired, flag) {
+			remove = append(remove, flag)
+		}
+	}
+	return
+}
+
+// tagToKeyword converts a tag's name to a valid IMAP keyword (see RFC3501#section-9 atom)
+func tagToKeyword(tag string) string {
+	keyword := []rune{}
+	for _, r := range tag {
+		if r <= 0x20 || r >= 0x7f || strings.ContainsRune(`(){%*"\]`, r) {
+			r = '_'
+		}
+		keyword = append(keyword, r)
+	}
+	return string(keyword)
+}
+
+// tagsKeywords returns a map of lowercased keywords to their tag's name
+func tagsKeywords(tags map[string]bool) map[string]string {
+	keywords := make(map[string]string)
+	for tag := range tags {
+		if tag != flaggedTag && tag != deletedTag {
+			keywords[strings.ToLower(tagToKeyword(tag))] = tag
+		}
+	}
+	return keywords
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeFlags sends UID STORE commands to add and remove flags for message
+func storeFlags(imapClient *client.Client, uid uint32, add, remove []string) (err error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	toInterfaces := func(flags []string) []interface{} {
+		values := make([]interface{}, len(flags))
+		for i, flag := range flags {
+			values[i] = flag
+		}
+		return values
+	}
+	if len(add) > 0 {
+		err = imapClient.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), toInterfaces(add), nil)
+		if err != nil {
+			return
+		}
+	}
+	if len(remove) > 0 {
+		err = imapClient.UidStore(seqset, imap.FormatFlagsOp(imap.RemoveFlags, true), toInterfaces(remove), nil)
+	}
+	return
+}
+
+// uidFetchChangedSince sends an UID FETCH command with CHANGEDSINCE modifier (see RFC7162#section-3.1.4).
+// ch is closed when done, as for client.UidFetch.
+func uidFetchChangedSince(imapClient *client.Client, seqset *imap.SeqSet, items []imap.FetchItem, modSeq uint64, ch chan *imap.Message) error {
+	defer close(ch)
+	cmd := &changedSinceCmd{
+		fetch:  &commands.Uid{Cmd: &commands.Fetch{SeqSet: seqset, Items: items}},
+		modSeq: modSeq,
+	}
+	status, err := imapClient.Execute(cmd, &responses.Fetch{Messages: ch})
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// changedSinceCmd appends CHANGEDSINCE modifier to a fetch command
+type changedSinceCmd struct {
+	fetch  imap.Commander
+	modSeq uint64
+}
+
+func (cmd *changedSinceCmd) Command() *imap.Command {
+	c := cmd.fetch.Command()
+	c.Arguments = append(c.Arguments, []interface{}{
+		imap.RawString("CHANGEDSINCE"),
+		imap.RawString(strconv.FormatUint(cmd.modSeq, 10)),
+	})
+	return c
+}
+
+// messageModSeq returns MODSEQ value found in fetched message, if any
+func messageModSeq(msg *imap.Message) uint64 {
+	value, ok := msg.Items[modSeqItem]
+	if !ok {
+		return 0
+	}
+	if list, ok := value.([]interface{}); ok && len(list) == 1 {
+		value = list[0]
+	}
+	switch v := value.(type) {
+	case uint32:
+		return uint64(v)
+	case string:
+		modSeq, _ := strconv.ParseUint(v, 10, 64)
+		return modSeq
+	}
+	return 0
+}
+
+// fetchedBoxName returns the mailbox name embedded by fetcher into raw email's X-Fetched-Imap-Box header
+func fetchedBoxName(raw string) string {
+	email, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+	name, err := base64.StdEncoding.DecodeString(email.Header.Get("X-Fetched-Imap-Box"))
+	if err != nil {
+		return ""
+	}
+	return string(name)
+}
+
+// userTagsSet returns the set of user's tags names
+func (f *Fetcher) userTagsSet(userId string) map[string]bool {
+	set := make(map[string]bool)
+	tags, err := f.Store.RetrieveUserTags(userId)
+	if err != nil {
+		log.WithError(err).Warnf("[userTagsSet] failed to retrieve tags for user %s", userId)
+	}
+	for _, tag := range tags {
+		set[tag.Name] = true
+	}
+	return set
+}
+
+// createFlagTag creates the tag mirroring an IMAP flag for user
+func (f *Fetcher) createFlagTag(userId UUID, name, label string) {
+	tag := Tag{
+		User_id: userId,
+		Name:    name,
+		Label:   label,
+	}
+	err := f.Store.CreateTag(&tag)
+	if err != nil {
+		log.WithError(err).Warnf("[createFlagTag] failed to create tag %s for user %s", name, userId.String())
+	}
+}
@@ -0,0 +1,180 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/emersion/go-imap"
+	"reflect"
+	"testing"
+)
+
+func Test_imapFlagsFromMessage(t *testing.T) {
+	boxesTags := map[string]bool{"archives": true}
+	data := []struct {
+		msg          *Message
+		withKeywords bool
+		out          []string
+	}{
+		{
+			msg: &Message{Is_unread: true},
+			out: []string{},
+		},
+		{
+			msg: &Message{Is_unread: false, Is_answered: true},
+			out: []string{imap.SeenFlag, imap.AnsweredFlag},
+		},
+		{
+			msg: &Message{Is_unread: true, Tags: []string{flaggedTag, "archives", "work"}},
+			out: []string{imap.FlaggedFlag},
+		},
+		{
+			msg:          &Message{Is_unread: true, Tags: []string{flaggedTag, "archives", "my work"}},
+			withKeywords: true,
+			out:          []string{imap.FlaggedFlag, "my_work"},
+		},
+		{
+			msg:          &Message{Is_unread: true, Tags: []string{deletedTag}},
+			withKeywords: true,
+			out:          []string{},
+		},
+	}
+	for i, set := range data {
+		result := imapFlagsFromMessage(set.msg, boxesTags, set.withKeywords)
+		if !reflect.DeepEqual(result, set.out) {
+			t.Errorf("invalid flags for set %d.\nExpected : %+v\nGot : %+v", i, set.out, result)
+		}
+	}
+}
+
+func Test_messageChangesFromFlags(t *testing.T) {
+	userTags := map[string]bool{"archives": true, "work": true, "perso": true, flaggedTag: true}
+	boxesTags := map[string]bool{"archives": true}
+	data := []struct {
+		msg          *Message
+		flags        []string
+		withKeywords bool
+		out          map[string]interface{}
+	}{
+		{
+			msg:   &Message{Is_unread: false},
+			flags: []string{imap.SeenFlag},
+			out:   map[string]interface{}{},
+		},
+		{
+			msg:   &Message{Is_unread: true, Is_answered: true},
+			flags: []string{`\seen`},
+			out:   map[string]interface{}{"Is_unread": false, "Is_answered": false},
+		},
+		{
+			msg:   &Message{Is_unread: false, Tags: []string{"archives", "work"}},
+			flags: []string{imap.FlaggedFlag},
+			out:   map[string]interface{}{"Is_unread": true, "Tags": []string{"archives", "work", flaggedTag}},
+		},
+		{
+			msg:   &Message{Is_unread: true, Tags: []string{flaggedTag}},
+			flags: []string{},
+			out:   map[string]interface{}{"Tags": []string{}},
+		},
+		{
+			msg:          &Message{Is_unread: true, Tags: []string{"archives", "work"}},
+			flags:        []string{"Perso", "unknown", "$Junk"},
+			withKeywords: true,
+			out:          map[string]interface{}{"Tags": []string{"archives", "perso"}},
+		},
+		{
+			msg:          &Message{Is_unread: true, Tags: []string{"archives", "work"}},
+			flags:        []string{"work", "archives"},
+			withKeywords: true,
+			out:          map[string]interface{}{},
+		},
+		{
+			msg:   &Message{Is_unread: true, Tags: []string{"work"}},
+			flags: []string{imap.DeletedFlag},
+			out:   map[string]interface{}{"Tags": []string{"work", deletedTag}},
+		},
+		{
+			msg:          &Message{Is_unread: true, Tags: []string{deletedTag, "work"}},
+			flags:        []string{"work"},
+			withKeywords: true,
+			out:          map[string]interface{}{"Tags": []string{"work"}},
+		},
+	}
+	for i, set := range data {
+		result := messageChangesFromFlags(set.msg, set.flags, userTags, boxesTags, set.withKeywords)
+		if !reflect.DeepEqual(result, set.out) {
+			t.Errorf("invalid changes for set %d.\nExpected : %+v\nGot : %+v", i, set.out, result)
+		}
+	}
+}
+
+func Test_flagsDiff(t *testing.T) {
+	managed := map[string]string{"work": "work", "perso": "perso"}
+	data := []struct {
+		current, desired []string
+		add, remove      []string
+	}{
+		{
+			current: []string{},
+			desired: []string{imap.SeenFlag},
+			add:     []string{imap.SeenFlag},
+			remove:  []string{},
+		},
+		{
+			current: []string{imap.SeenFlag, imap.DraftFlag, "$Forwarded", "Perso"},
+			desired: []string{imap.FlaggedFlag, "work"},
+			add:     []string{imap.FlaggedFlag, "work"},
+			remove:  []string{imap.SeenFlag, "Perso"},
+		},
+		{
+			current: []string{`\seen`, "work"},
+			desired: []string{imap.SeenFlag, "work"},
+			add:     []string{},
+			remove:  []string{},
+		},
+	}
+	for i, set := range data {
+		add, remove := flagsDiff(set.current, set.desired, managed)
+		if !reflect.DeepEqual(add, set.add) || !reflect.DeepEqual(remove, set.remove) {
+			t.Errorf("invalid diff for set %d.\nExpected : %+v %+v\nGot : %+v %+v", i, set.add, set.remove, add, remove)
+		}
+	}
+}
+
+func Test_vanishedUids(t *testing.T) {
+	deleted := map[uint32]string{3: "<a@example.com>", 7: "<b@example.com>", 12: "<c@example.com>"}
+	if vanished := vanishedUids(deleted, []uint32{7}); !reflect.DeepEqual(vanished, []uint32{3, 12}) {
+		t.Errorf("expected uids 3 and 12 to have vanished, got %v", vanished)
+	}
+	if vanished := vanishedUids(deleted, []uint32{3, 7, 12}); len(vanished) != 0 {
+		t.Errorf("expected no vanished uid, got %v", vanished)
+	}
+}
+
+func Test_fetchedBoxName(t *testing.T) {
+	raw := "X-Fetched-Imap-Box: QXJjaGl2ZXM=\r\nSubject: test\r\n\r\nbody"
+	if name := fetchedBoxName(raw); name != "Archives" {
+		t.Errorf("expected box name 'Archives', got '%s'", name)
+	}
+	if name := fetchedBoxName("Subject: test\r\n\r\nbody"); name != "" {
+		t.Errorf("expected empty box name, got '%s'", name)
+	}
+}
+
+func Test_messageModSeq(t *testing.T) {
+	data := []struct {
+		items map[imap.FetchItem]interface{}
+		out   uint64
+	}{
+		{map[imap.FetchItem]interface{}{}, 0},
+		{map[imap.FetchItem]interface{}{modSeqItem: []interface{}{"12345678901"}}, 12345678901},
+		{map[imap.FetchItem]interface{}{modSeqItem: []interface{}{uint32(42)}}, 42},
+	}
+	for i, set := range data {
+		if result := messageModSeq(&imap.Message{Items: set.items}); result != set.out {
+			t.Errorf("invalid modseq for set %d. Expected %d, got %d", i, set.out, result)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ * // Copyleft (ɔ) 2019 The Caliopen contributors.
+ * // Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+ * // license (AGPL) that can be found in the LICENSE file.
+ */
+
+package imap_worker
+
+/* push mode for remote identities :
+a long-lived connection is kept open on remote INBOX, using IDLE command (RFC2177) if server has the capability
+or polling with NOOP command otherwise.
+An incremental sync is triggered as soon as server announces new message(s) with EXISTS response.
+*/
+
+import (
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/users"
+	log "github.com/Sirupsen/logrus"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+	"sync"
+	"time"
+)
+
+const (
+	idleCapability = "IDLE"
+	idleRenewal    = 25 * time.Minute // RFC2177 : clients should re-issue IDLE at least every 29 minutes
+	noopInterval   = time.Minute      // NOOP polling interval for servers lacking IDLE capability
+	idleRetryDelay = 30 * time.Second
+	idleMaxRetries = 5 // how many consecutive connection failures before giving up watching an identity
+)
+
+var errIdentityInactive = errors.New("remote identity is not active")
+
+// idlers registry is shared by all workers of the process
+// to ensure that only one connection is kept open per remote identity
+var (
+	idlersRegistry = make(map[string]*idler)
+	idlersMutex    sync.Mutex
+)
+
+// idleManager handles long-lived connections opened by a worker
+type idleManager struct {
+	maxConns int
+	count    int
+	stopped  bool
+	wg       sync.WaitGroup // idlers' sessions and the syncs they triggered
+	worker   *Worker
+}
+
+// idler watches INBOX of a remote identity
+type idler struct {
+	identityId string
+	manager    *idleManager
+	stop       chan struct{}
+	userId     string
+}
+
+// unexported var to help override func in tests
+var idleSession = func(idl *idler) error {
+	return idl.session()
+}
+
+func newIdleManager(worker *Worker, maxConns int) *idleManager {
+	return &idleManager{
+		maxConns: maxConns,
+		worker:   worker,
+	}
+}
+
+// watch opens a long-lived connection for remote identity,
+// unless identity is already watched or maximum connections count is reached.
+func (m *idleManager) watch(userId, identityId string) bool {
+	idlersMutex.Lock()
+	defer idlersMutex.Unlock()
+	if m.stopped || m.count >= m.maxConns {
+		return false
+	}
+	if _, ok := idlersRegistry[identityId]; ok {
+		return false
+	}
+	idl := &idler{
+		identityId: identityId,
+		manager:    m,
+		stop:       make(chan struct{}),
+		userId:     userId,
+	}
+	idlersRegistry[identityId] = idl
+	m.count++
+	m.wg.Add(1)
+	go idl.run()
+	log.Infof("[idleManager] worker %s is now watching remote identity %s", m.worker.Id, identityId)
+	return true
+}
+
+// unwatch closes connection for remote identity, if any.
+func (m *idleManager) unwatch(identityId string) {
+	idlersMutex.Lock()
+	defer idlersMutex.Unlock()
+	if idl, ok := idlersRegistry[identityId]; ok && idl.manager == m {
+		m.release(idl)
+	}
+}
+
+// stopAll closes all connections opened by manager and waits for pending syncs to finish.
+func (m *idleManager) stopAll() {
+	idlersMutex.Lock()
+	m.stopped = true
+	for _, idl := range idlersRegistry {
+		if idl.manager == m {
+			m.release(idl)
+		}
+	}
+	idlersMutex.Unlock()
+	m.wg.Wait()
+}
+
+// release MUST be called with idlersMutex locked
+func (m *idleManager) release(idl *idler) {
+	if registered, ok := idlersRegistry[idl.identityId]; !ok || registered != idl {
+		return
+	}
+	delete(idlersRegistry, idl.identityId)
+	m.count--
+	close(idl.stop)
+}
+
+// run keeps a session open until idler is stopped,
+// reconnecting on failure up to idleMaxRetries times.
+func (idl *idler) run() {
+	defer idl.manager.wg.Done()
+	retries := 0
+	for {
+		err := idleSession(idl)
+		select {
+		case <-idl.stop:
+			return
+		default:
+		}
+		if err == errIdentityInactive {
+			log.Infof("[idler] stop watching inactive remote identity %s", idl.identityId)
+			idl.manager.unwatch(idl.identityId)
+			return
+		}
+		if err != nil {
+			retries++
+			log.WithError(err).Warnf("[idler] session failed for remote identity %s (%d/%d)", idl.identityId, retries, idleMaxRetries)
+			if retries >= idleMaxRetries {
+				idl.manager.unwatch(idl.identityId)
+				return
+			}
+			select {
+			case <-idl.stop:
+				return
+			case <-time.After(idleRetryDelay):
+			}
+			continue
+		}
+		retries = 0
+	}
+}
+
+// session logs in remote and waits for new messages in INBOX until renewal time or idler is stopped.
+func (idl *idler) session() (err error) {
+	worker := idl.manager.worker
+	fetcher := &Fetcher{
+		Hostname: worker.Config.Hostname,
+		Lda:      worker.Lda,
+		Store:    worker.Store,
+	}
+	userIdentity, err := worker.Store.RetrieveUserIdentity(idl.userId, idl.identityId, true)
+	if err != nil {
+		return err
+	}
+	if userIdentity.Status != "" && userIdentity.Status != "active" {
+		return errIdentityInactive
+	}
+	if userIdentity.Infos["authtype"] == Oauth2 {
+		err = users.ValidateOauth2Credentials(userIdentity, fetcher, true)
+		if err != nil {
+			return err
+		}
+	}
+	_, imapClient, provider, err := imapLogin(userIdentity)
+	if err != nil {
+		return err
+	}
+	updates := make(chan client.Update, 10)
+	imapClient.Updates = updates
+	defer func() {
+		// keep draining updates until logged out to not block imap client
+		loggedOut := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-updates:
+				case <-loggedOut:
+					return
+				}
+			}
+		}()
+		imapClient.Logout()
+		close(loggedOut)
+	}()
+
+	mbox, err := imapClient.Select(inboxName, true)
+	if err != nil {
+		return err
+	}
+	messagesCount := mbox.Messages
+	withIdle := provider.Capabilities[idleCapability]
+	renewal := time.After(idleRenewal)
+	for {
+		stopWaiting := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			if withIdle {
+				done <- idle(imapClient, stopWaiting)
+			} else {
+				select {
+				case <-stopWaiting:
+					done <- nil
+				case <-time.After(noopInterval):
+					done <- imapClient.Noop()
+				}
+			}
+		}()
+	waitLoop:
+		for {
+			select {
+			case update := <-updates:
+				if mboxUpdate, ok := update.(*client.MailboxUpdate); ok && mboxUpdate.Mailbox != nil {
+					if mboxUpdate.Mailbox.Messages > messagesCount {
+						idl.triggerSync()
+					}
+					messagesCount = mboxUpdate.Mailbox.Messages
+				}
+			case err = <-done:
+				close(stopWaiting)
+				if err != nil {
+					return err
+				}
+				break waitLoop
+			case <-renewal:
+				close(stopWaiting)
+				return <-done
+			case <-idl.stop:
+				close(stopWaiting)
+				<-done
+				return nil
+			}
+		}
+	}
+}
+
+// triggerSync launches an incremental sync for idler's identity, unless identity is already being synced
+// (by idler or on idpoller's order, see lockIdentitySync) or worker is halting.
+// Worker's Stop waits for triggered syncs before releasing worker's HaltGroup.
+func (idl *idler) triggerSync() {
+	worker := idl.manager.worker
+	if worker.HaltGroup != nil || !lockIdentitySync(idl.identityId) {
+		return
+	}
+	idl.manager.wg.Add(1)
+	go func() {
+		defer idl.manager.wg.Done()
+		defer unlockIdentitySync(idl.identityId)
+		fetcher := Fetcher{
+			Hostname: worker.Config.Hostname,
+			Lda:      worker.Lda,
+			Store:    worker.Store,
+		}
+		err := syncRemoteWithLocal(&fetcher, IMAPorder{
+			Order:      "sync",
+			IdentityId: idl.identityId,
+			UserId:     idl.userId,
+		})
+		if err != nil {
+			log.WithError(err).Warnf("[idler] sync failed for remote identity %s", idl.identityId)
+		}
+	}()
+}
+
+// idle sends IDLE command and waits until stop is closed to send DONE (see RFC2177)
+func idle(imapClient *client.Client, stop <-chan struct{}) error {
+	res := &idleResponse{
+		replies: make(chan []byte, 1),
+		stop:    stop,
+	}
+	status, err := imapClient.Execute(&idleCommand{}, res)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+type idleCommand struct{}
+
+func (cmd *idleCommand) Command() *imap.Command {
+	return &imap.Command{Name: idleCapability}
+}
+
+// idleResponse implements responses.Replier
+type idleResponse struct {
+	replies chan []byte
+	stop    <-chan struct{}
+}
+
+func (r *idleResponse) Replies() <-chan []byte {
+	return r.replies
+}
+
+func (r *idleResponse) Handle(resp imap.Resp) error {
+	// wait for server's continuation request before being able to send DONE
+	if _, ok := resp.(*imap.ContinuationReq); ok {
+		go func() {
+			<-r.stop
+			r.replies <- []byte("DONE\r\n")
+			close(r.replies)
+		}()
+		return nil
+	}
+	return responses.ErrUnhandled
+}
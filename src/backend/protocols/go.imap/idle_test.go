@@ -0,0 +1,129 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_idleManager(t *testing.T) {
+	sessions := make(chan string, 10)
+	idleSession = func(idl *idler) error {
+		sessions <- idl.identityId
+		<-idl.stop
+		return nil
+	}
+	defer func() {
+		idleSession = func(idl *idler) error {
+			return idl.session()
+		}
+	}()
+
+	worker := &Worker{Id: "testWorker"}
+	manager := newIdleManager(worker, 2)
+	other := newIdleManager(&Worker{Id: "otherWorker"}, 2)
+
+	if !manager.watch("user", "identity1") {
+		t.Error("manager should watch identity1")
+	}
+	if manager.watch("user", "identity1") {
+		t.Error("identity1 is already watched, it should not be watched twice")
+	}
+	if other.watch("user", "identity1") {
+		t.Error("identity1 is already watched by another worker, it should not be watched twice")
+	}
+	if !manager.watch("user", "identity2") {
+		t.Error("manager should watch identity2")
+	}
+	if manager.watch("user", "identity3") {
+		t.Error("max connections reached, identity3 should not be watched")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sessions:
+		case <-time.After(time.Second):
+			t.Fatal("idle session has not been started")
+		}
+	}
+
+	manager.unwatch("identity2")
+	if !manager.watch("user", "identity3") {
+		t.Error("a connection has been released, identity3 should be watched")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		manager.stopAll()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stopAll should return once all sessions are closed")
+	}
+	if len(idlersRegistry) != 0 {
+		t.Errorf("registry should be empty after stopAll, got %d idlers", len(idlersRegistry))
+	}
+	if manager.watch("user", "identity4") {
+		t.Error("stopped manager should not watch new identities")
+	}
+}
+
+func Test_idler_triggerSync(t *testing.T) {
+	synced := make(chan string, 10)
+	release := make(chan struct{})
+	syncRemoteWithLocal = func(f *Fetcher, order IMAPorder) error {
+		synced <- order.IdentityId
+		<-release
+		return nil
+	}
+	defer func() {
+		syncRemoteWithLocal = func(f *Fetcher, order IMAPorder) error {
+			return f.SyncRemoteWithLocal(order)
+		}
+	}()
+	worker := &Worker{Id: "testWorker"}
+	idl := &idler{identityId: "identity1", manager: newIdleManager(worker, 1), userId: "user"}
+
+	// identity is being synced on idpoller's order
+	lockIdentitySync("identity1")
+	idl.triggerSync()
+	unlockIdentitySync("identity1")
+	select {
+	case <-synced:
+		t.Fatal("identity locked by another sync should not be synced by idler")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	idl.triggerSync()
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Fatal("idler should have synced identity")
+	}
+	if lockIdentitySync("identity1") {
+		t.Error("identity should be locked while idler syncs it")
+	}
+	idl.triggerSync()
+	close(release)
+	idl.manager.wg.Wait()
+	if len(synced) != 0 {
+		t.Error("identity should not be synced twice concurrently")
+	}
+	if !lockIdentitySync("identity1") {
+		t.Error("identity should be unlocked once synced")
+	}
+	unlockIdentitySync("identity1")
+
+	// no sync is started once worker is halting
+	worker.HaltGroup = new(sync.WaitGroup)
+	idl.triggerSync()
+	idl.manager.wg.Wait()
+	if len(synced) != 0 {
+		t.Error("halting worker should not start new syncs")
+	}
+}
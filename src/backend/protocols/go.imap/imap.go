@@ -117,6 +117,12 @@ func syncMailbox(ibox *imapBox, imapClient *client.Client, provider Provider, ch
 		close(ch)
 		return
 	}
+	(*ibox).keywords = false
+	for _, flag := range mbox.PermanentFlags {
+		if flag == imap.TryCreateFlag {
+			(*ibox).keywords = true
+		}
+	}
 	var from, to uint32
 	if ibox.lastSync.IsZero() {
 		// first sync, blindly fetch all messages
@@ -125,17 +131,19 @@ func syncMailbox(ibox *imapBox, imapClient *client.Client, provider Provider, ch
 	} else {
 		// check mailbox UIDVALIDITY
 		if ibox.uidValidity != mbox.UidValidity {
-			// TODO
-			// MUST empty the local cache of that mailbox and resync mailbox
-			log.Warnf("[syncMailbox] uidValidity has changed from %d to %d. Local mailbox should resync.", ibox.uidValidity, mbox.UidValidity)
-			// for now, we blindly (re)fetch all messages
+			// uids are not valid anymore : mailbox is fetched again,
+			// messages already imported are recognized by their Message-ID and skipped by fetcher
+			log.Warnf("[syncMailbox] uidValidity has changed from %d to %d, resyncing mailbox <%s>.", ibox.uidValidity, mbox.UidValidity, ibox.name)
 			from, to = 1, 0
 			(*ibox).uidValidity = mbox.UidValidity
+			(*ibox).highestModSeq = 0
+			(*ibox).deleted = nil
+			ibox.restart()
 		} else {
-			if ibox.lastSeenUid == 0 {
+			if lastSeenUid := ibox.seenUid(); lastSeenUid == 0 {
 				from, to = 1, 0
 			} else {
-				from = ibox.lastSeenUid + 1
+				from = lastSeenUid + 1
 				to = 0
 			}
 		}
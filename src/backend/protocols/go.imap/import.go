@@ -0,0 +1,160 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/messages"
+	log "github.com/Sirupsen/logrus"
+	"github.com/nats-io/go-nats"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"time"
+)
+
+// Importer delivers messages of an uploaded mailbox to email broker,
+// the same way fetcher does for messages of a remote IMAP account.
+type Importer struct {
+	Lda         *Lda
+	NatsConn    *nats.Conn
+	Store       backends.LDAStore
+	StatusTopic string // where import's progress is published for api
+}
+
+const importMaxErrors = 10 // how many errors are kept in import's report
+
+// unexported var to help override func in tests
+var importMailbox = func(i *Importer, order IMAPorder) error {
+	return i.ImportMailbox(order)
+}
+
+// ImportMailbox walks uploaded mailbox referenced by order
+// and delivers messages that have not been imported yet to identity.
+// Uploaded file is removed from object store once import is over.
+func (i *Importer) ImportMailbox(order IMAPorder) (err error) {
+	if order.Import == nil || order.Import.Uri == "" {
+		return errors.New("[Importer] missing import in order")
+	}
+	mbImport := order.Import
+	defer func() {
+		if err != nil {
+			mbImport.Status = ImportFailed
+			i.addError(mbImport, err.Error())
+		} else {
+			mbImport.Status = ImportDone
+		}
+		i.reportProgress(mbImport)
+		if e := i.Store.RemoveMailboxImport(mbImport.Uri); e != nil {
+			log.WithError(e).Warnf("[Importer] failed to remove uploaded mailbox %s", mbImport.Uri)
+		}
+	}()
+	mbImport.Status = ImportRunning
+	i.reportProgress(mbImport)
+
+	// mailbox is copied locally because zip archives need random access
+	file, size, err := i.fetchMailbox(mbImport.Uri)
+	if err != nil {
+		return fmt.Errorf("[Importer] failed to get uploaded mailbox : %s", err)
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	walked := 0
+	err = messages.WalkMailbox(mbImport.Format, file, size, func(name string, raw []byte, e error) error {
+		if e == nil {
+			e = i.importMessage(order, raw)
+		}
+		if e != nil {
+			mbImport.Failed++
+			i.addError(mbImport, name+" : "+e.Error())
+		}
+		walked++
+		if walked%progressStep == 0 {
+			i.reportProgress(mbImport)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("[Importer] failed to read mailbox : %s", err)
+	}
+	log.Infof("[Importer] import %s for user %s done : %d imported, %d duplicates, %d failed",
+		mbImport.ImportId, order.UserId, mbImport.Imported, mbImport.Duplicates, mbImport.Failed)
+	return nil
+}
+
+// importMessage delivers raw message to identity, unless it has already been imported
+func (i *Importer) importMessage(order IMAPorder, raw []byte) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("invalid message : %s", err)
+	}
+	if externalId := externalMessageId(msg.Header.Get("Message-Id")); externalId != "" {
+		msgId, err := i.Store.SeekMessageByExternalRef(order.UserId, externalId, order.IdentityId)
+		if err == nil && msgId.String() != EmptyUUID.String() {
+			order.Import.Duplicates++
+			return nil
+		}
+	}
+	email := &Email{}
+	email.Raw.Write(raw)
+	if err = i.Lda.deliverMail(email, order.UserId, order.IdentityId); err != nil {
+		return err
+	}
+	order.Import.Imported++
+	return nil
+}
+
+// fetchMailbox copies uploaded mailbox from object store into a temporary file
+func (i *Importer) fetchMailbox(uri string) (file *os.File, size int64, err error) {
+	mailbox, err := i.Store.GetMailboxImport(uri)
+	if err != nil {
+		return
+	}
+	if closer, ok := mailbox.(io.Closer); ok {
+		defer closer.Close()
+	}
+	file, err = ioutil.TempFile("", "caliopen-import-")
+	if err != nil {
+		return
+	}
+	size, err = io.Copy(file, mailbox)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	return
+}
+
+func (i *Importer) addError(mbImport *MailboxImport, err string) {
+	if len(mbImport.Errors) >= importMaxErrors {
+		mbImport.Errors = mbImport.Errors[1:]
+	}
+	mbImport.Errors = append(mbImport.Errors, err)
+}
+
+// reportProgress publishes import's state for api to cache it and notify user
+func (i *Importer) reportProgress(mbImport *MailboxImport) {
+	if i.StatusTopic == "" {
+		return
+	}
+	mbImport.DateUpdate = time.Now()
+	data, err := json.Marshal(mbImport)
+	if err == nil {
+		err = i.NatsConn.Publish(i.StatusTopic, data)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[Importer] failed to report progress of import %s", mbImport.ImportId)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/CaliOpen/Caliopen/src/backend/brokers/go.emails"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/nats-io/go-nats"
+	"github.com/satori/go.uuid"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importTestStore serves an uploaded mbox and knows one message already imported
+type importTestStore struct {
+	backendstest.LDAStoreBackend
+	mailbox string
+	removed string
+}
+
+func (s *importTestStore) GetMailboxImport(uri string) (io.Reader, error) {
+	return strings.NewReader(s.mailbox), nil
+}
+func (s *importTestStore) RemoveMailboxImport(uri string) error {
+	s.removed = uri
+	return nil
+}
+func (s *importTestStore) SeekMessageByExternalRef(userID, externalMessageID, identityID string) (UUID, error) {
+	if externalMessageID == "already@example.com" {
+		return UUID(uuid.NewV4()), nil
+	}
+	return EmptyUUID, nil
+}
+
+func TestImporter_ImportMailbox(t *testing.T) {
+	w, s, err := newWorkerTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	store := &importTestStore{
+		mailbox: "From a@example.com Tue Apr  2 10:30:00 2019\nMessage-Id: <already@example.com>\nSubject: one\n\nhello\n\n" +
+			"From a@example.com Tue Apr  2 10:31:00 2019\nMessage-Id: <new@example.com>\nSubject: two\n\nhello\n\n" +
+			"From a@example.com Tue Apr  2 10:32:00 2019\nMessage-Id: <rejected@example.com>\nSubject: three\n\nhello\n\n",
+	}
+	reports := make(chan MailboxImport, 10)
+	w.NatsConn.Subscribe("mailboxImports", func(msg *nats.Msg) {
+		var report MailboxImport
+		json.Unmarshal(msg.Data, &report)
+		reports <- report
+	})
+	w.NatsConn.Flush()
+
+	// fake email broker
+	var delivered []string
+	go func() {
+		for in := range w.Lda.brokerConnectors.Ingress {
+			raw := in.EmailMessage.Email.Raw.String()
+			if in.EmailMessage.Message.User_id.String() != "5b1b6ea1-7e8c-4a59-8b8a-43c8a1b0f7a1" {
+				t.Errorf("unexpected user for delivered mail : %s", in.EmailMessage.Message.User_id.String())
+			}
+			ack := &email_broker.EmailDeliveryAck{}
+			if strings.Contains(raw, "rejected@") {
+				ack.Err = true
+				ack.Response = "rejected"
+			} else {
+				delivered = append(delivered, raw)
+			}
+			in.Response <- ack
+		}
+	}()
+	defer close(w.Lda.brokerConnectors.Ingress)
+
+	importer := Importer{
+		Lda:         w.Lda,
+		NatsConn:    w.NatsConn,
+		Store:       store,
+		StatusTopic: "mailboxImports",
+	}
+	order := IMAPorder{
+		Order:      "import_mailbox",
+		UserId:     "5b1b6ea1-7e8c-4a59-8b8a-43c8a1b0f7a1",
+		IdentityId: "0f6f5a3a-1a3b-4b7c-9d0a-2b9f1c3c4d5e",
+		Import: &MailboxImport{
+			Format:   MailboxFormatMbox,
+			ImportId: "import-id",
+			Status:   ImportPending,
+			Uri:      "s3://caliopen-imports/user/import-id",
+		},
+	}
+	if err = importer.ImportMailbox(order); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || !bytes.Contains([]byte(delivered[0]), []byte("Subject: two\r\n")) {
+		t.Errorf("expected only new message to be delivered, got %q", delivered)
+	}
+	if order.Import.Imported != 1 || order.Import.Duplicates != 1 || order.Import.Failed != 1 || len(order.Import.Errors) != 1 {
+		t.Errorf("unexpected import counters %+v", order.Import)
+	}
+	if store.removed != order.Import.Uri {
+		t.Error("expected uploaded mailbox to be removed once imported")
+	}
+
+	var last MailboxImport
+	timeout := time.After(time.Second)
+	for last.Status != ImportDone {
+		select {
+		case last = <-reports:
+		case <-timeout:
+			t.Fatalf("timeout waiting for import to be reported done, last report %+v", last)
+		}
+	}
+	if last.Imported != 1 || last.ImportId != "import-id" {
+		t.Errorf("unexpected final report %+v", last)
+	}
+}
@@ -40,7 +40,9 @@ func (lda *Lda) shutdown() error {
 	return nil
 }
 
-func (lda *Lda) deliverMail(mail *Email, userId, identityID string) (err error) {
+// deliverMail forwards mail to email broker for user's identity.
+// Optional tags are applied to the message once it has been delivered.
+func (lda *Lda) deliverMail(mail *Email, userId, identityID string, tags ...string) (err error) {
 	emailMsg := &EmailMessage{
 		Email: mail,
 		Message: &Message{
@@ -48,6 +50,11 @@ func (lda *Lda) deliverMail(mail *Email, userId, identityID string) (err error)
 			UserIdentities: []UUID{UUID(uuid.FromStringOrNil(identityID))},
 		},
 	}
+	for _, tag := range tags {
+		if tag != "" {
+			emailMsg.Message.Tags = append(emailMsg.Message.Tags, tag)
+		}
+	}
 	incoming := &broker.SmtpEmail{
 		EmailMessage: emailMsg,
 		Response:     make(chan *broker.EmailDeliveryAck),
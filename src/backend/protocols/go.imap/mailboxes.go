@@ -0,0 +1,204 @@
+/*
+ * // Copyleft (ɔ) 2019 The Caliopen contributors.
+ * // Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+ * // license (AGPL) that can be found in the LICENSE file.
+ */
+
+package imap_worker
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mozillazg/go-unidecode"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapMailbox is the sync state of one remote mailbox,
+// as saved in UserIdentity.Infos[mailboxesKey] (json encoded list)
+type imapMailbox struct {
+	Deleted       map[uint32]string `json:"deleted,omitempty"` // uids flagged \Deleted on remote, pending expunge
+	HighestModSeq uint64            `json:"highestmodseq,omitempty"`
+	Ignore        bool              `json:"ignore"` // user could set it to true to exclude mailbox from sync
+	LastSeenUid   uint32            `json:"lastseenuid"`
+	LastSync      time.Time         `json:"lastsync"`
+	Name          string            `json:"name"`
+	Tag           string            `json:"tag"` // name of the Caliopen tag applied to messages fetched from this mailbox
+	UidValidity   uint32            `json:"uidvalidity"`
+}
+
+const (
+	mailboxesKey = "mailboxes"
+	inboxName    = "INBOX"
+
+	// mailbox attributes (see RFC3501#section-7.2.2 and RFC6154#section-2)
+	noSelectAttr    = `\Noselect`
+	nonExistentAttr = `\NonExistent`
+	junkAttr        = `\Junk`
+	trashAttr       = `\Trash`
+)
+
+// readMailboxes unmarshals mailboxes list saved in identity's infos.
+// If no list is found, legacy INBOX only sync state (lastseenuid/uidvalidity/lastsync keys) is used.
+func readMailboxes(infos map[string]string) (boxes []*imapBox) {
+	if jsonBoxes, ok := infos[mailboxesKey]; ok && jsonBoxes != "" {
+		mailboxes := []imapMailbox{}
+		err := json.Unmarshal([]byte(jsonBoxes), &mailboxes)
+		if err == nil {
+			for _, mailbox := range mailboxes {
+				boxes = append(boxes, &imapBox{
+					deleted:       mailbox.Deleted,
+					highestModSeq: mailbox.HighestModSeq,
+					ignore:        mailbox.Ignore,
+					lastSeenUid:   mailbox.LastSeenUid,
+					lastSync:      mailbox.LastSync,
+					name:          mailbox.Name,
+					tag:           mailbox.Tag,
+					uidValidity:   mailbox.UidValidity,
+				})
+			}
+			return
+		}
+		log.WithError(err).Warn("[readMailboxes] failed to unmarshal mailboxes list, falling back to INBOX only")
+	}
+	inbox := &imapBox{name: inboxName}
+	if lastseenuid, err := strconv.Atoi(infos["lastseenuid"]); err == nil {
+		inbox.lastSeenUid = uint32(lastseenuid)
+	}
+	if uidvalidity, err := strconv.Atoi(infos["uidvalidity"]); err == nil {
+		inbox.uidValidity = uint32(uidvalidity)
+	}
+	if ls, ok := infos["lastsync"]; ok && ls != "" {
+		lastsync, err := time.Parse(time.RFC3339, ls)
+		if err != nil {
+			log.WithError(err).Warnf("[readMailboxes] failed to parse lastsync string <%s>", ls)
+		} else {
+			inbox.lastSync = lastsync
+		}
+	}
+	return []*imapBox{inbox}
+}
+
+// writeMailboxes saves mailboxes list into identity's infos, replacing legacy INBOX only keys.
+func writeMailboxes(infos map[string]string, boxes []*imapBox) error {
+	mailboxes := []imapMailbox{}
+	for _, box := range boxes {
+		mailboxes = append(mailboxes, imapMailbox{
+			Deleted:       box.deleted,
+			HighestModSeq: box.highestModSeq,
+			Ignore:        box.ignore,
+			LastSeenUid:   box.lastSeenUid,
+			LastSync:      box.lastSync,
+			Name:          box.name,
+			Tag:           box.tag,
+			UidValidity:   box.uidValidity,
+		})
+	}
+	jsonBoxes, err := json.Marshal(mailboxes)
+	if err != nil {
+		return err
+	}
+	infos[mailboxesKey] = string(jsonBoxes)
+	delete(infos, "lastseenuid")
+	delete(infos, "uidvalidity")
+	return nil
+}
+
+// mergeMailboxes reconciles mailboxes known in db with the ones listed on remote server :
+// known mailboxes keep their sync state, new ones are added with a tag derived from their name,
+// mailboxes that vanished from remote are dropped.
+func mergeMailboxes(known []*imapBox, remote []*imap.MailboxInfo) (merged []*imapBox) {
+	knownMap := make(map[string]*imapBox)
+	for _, box := range known {
+		knownMap[box.name] = box
+	}
+	merged = []*imapBox{}
+remoteLoop:
+	for _, info := range remote {
+		ignore := false
+		for _, attr := range info.Attributes {
+			switch {
+			case strings.EqualFold(attr, noSelectAttr), strings.EqualFold(attr, nonExistentAttr):
+				continue remoteLoop
+			case strings.EqualFold(attr, junkAttr), strings.EqualFold(attr, trashAttr):
+				ignore = true
+			}
+		}
+		if box, ok := knownMap[info.Name]; ok {
+			merged = append(merged, box)
+			continue
+		}
+		merged = append(merged, &imapBox{
+			ignore: ignore,
+			name:   info.Name,
+			tag:    mailboxTagName(info.Name),
+		})
+	}
+	return
+}
+
+// mailboxesTags returns the set of tags mapped to mailboxes
+func mailboxesTags(boxes []*imapBox) map[string]bool {
+	tags := make(map[string]bool)
+	for _, box := range boxes {
+		if box.tag != "" {
+			tags[box.tag] = true
+		}
+	}
+	return tags
+}
+
+// mailboxTagName returns the Caliopen tag name for remote mailbox,
+// INBOX is left untagged.
+func mailboxTagName(mailbox string) string {
+	if strings.EqualFold(mailbox, inboxName) {
+		return ""
+	}
+	return strings.Replace(strings.ToLower(unidecode.Unidecode(mailbox)), " ", "_", -1)
+}
+
+// listMailboxes returns all mailboxes found on remote server
+func listMailboxes(imapClient *client.Client) (mailboxes []*imap.MailboxInfo, err error) {
+	boxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- imapClient.List("", "*", boxes)
+	}()
+	for box := range boxes {
+		mailboxes = append(mailboxes, box)
+	}
+	err = <-done
+	return
+}
+
+// ensureMailboxesTags creates user's tags for mailboxes' tags that are missing
+func (f *Fetcher) ensureMailboxesTags(userId UUID, boxes []*imapBox) {
+	existing := make(map[string]bool)
+	tags, err := f.Store.RetrieveUserTags(userId.String())
+	if err != nil {
+		log.WithError(err).Warnf("[ensureMailboxesTags] failed to retrieve tags for user %s", userId.String())
+	}
+	for _, tag := range tags {
+		existing[tag.Name] = true
+	}
+	for _, box := range boxes {
+		if box.ignore || box.tag == "" || existing[box.tag] {
+			continue
+		}
+		tag := Tag{
+			User_id: userId,
+			Name:    box.tag,
+			Label:   box.name,
+		}
+		err = f.Store.CreateTag(&tag)
+		if err != nil {
+			log.WithError(err).Warnf("[ensureMailboxesTags] failed to create tag <%s> for user %s", box.tag, userId.String())
+			continue
+		}
+		existing[box.tag] = true
+	}
+}
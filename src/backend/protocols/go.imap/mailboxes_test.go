@@ -0,0 +1,110 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"github.com/emersion/go-imap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_readMailboxes(t *testing.T) {
+	lastsync := time.Date(2019, 2, 1, 10, 0, 0, 0, time.UTC)
+	data := []struct {
+		in  map[string]string
+		out []*imapBox
+	}{
+		{
+			in:  map[string]string{},
+			out: []*imapBox{{name: inboxName}},
+		},
+		{
+			in: map[string]string{
+				"lastseenuid": "42",
+				"lastsync":    lastsync.Format(time.RFC3339),
+				"uidvalidity": "1234",
+			},
+			out: []*imapBox{{lastSeenUid: 42, lastSync: lastsync, name: inboxName, uidValidity: 1234}},
+		},
+		{
+			in: map[string]string{
+				"lastseenuid": "42",
+				mailboxesKey:  `[{"name":"INBOX","lastseenuid":7,"uidvalidity":1},{"name":"Archives","tag":"archives","ignore":true}]`,
+			},
+			out: []*imapBox{
+				{lastSeenUid: 7, name: inboxName, uidValidity: 1},
+				{ignore: true, name: "Archives", tag: "archives"},
+			},
+		},
+		{
+			in:  map[string]string{mailboxesKey: "not a json"},
+			out: []*imapBox{{name: inboxName}},
+		},
+	}
+
+	for i, set := range data {
+		result := readMailboxes(set.in)
+		if !reflect.DeepEqual(result, set.out) {
+			t.Errorf("invalid mailboxes for set %d.\nExpected : %+v\nGot : %+v", i, set.out, result)
+		}
+	}
+}
+
+func Test_writeMailboxes(t *testing.T) {
+	lastsync := time.Date(2019, 2, 1, 10, 0, 0, 0, time.UTC)
+	infos := map[string]string{
+		"lastseenuid": "42",
+		"uidvalidity": "1234",
+	}
+	boxes := []*imapBox{
+		{lastSeenUid: 42, lastSync: lastsync, name: inboxName, uidValidity: 1234},
+		{name: "Envoyés", tag: "envoyes", deleted: map[uint32]string{3: "<a@example.com>"}},
+	}
+	err := writeMailboxes(infos, boxes)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := infos["lastseenuid"]; ok {
+		t.Error("legacy lastseenuid key should have been removed from infos")
+	}
+	if _, ok := infos["uidvalidity"]; ok {
+		t.Error("legacy uidvalidity key should have been removed from infos")
+	}
+	// round trip
+	result := readMailboxes(infos)
+	if !reflect.DeepEqual(result, boxes) {
+		t.Errorf("mailboxes round trip failed.\nExpected : %+v\nGot : %+v", boxes, result)
+	}
+}
+
+func Test_mergeMailboxes(t *testing.T) {
+	inbox := &imapBox{lastSeenUid: 42, name: inboxName, uidValidity: 1234}
+	ignored := &imapBox{ignore: true, name: "Old", tag: "old"}
+	vanished := &imapBox{lastSeenUid: 3, name: "Vanished", tag: "vanished"}
+	known := []*imapBox{inbox, ignored, vanished}
+	remote := []*imap.MailboxInfo{
+		{Name: inboxName},
+		{Name: "Old"},
+		{Name: "[Gmail]", Attributes: []string{`\Noselect`, `\HasChildren`}},
+		{Name: "[Gmail]/Sent Mail", Attributes: []string{`\Sent`}},
+		{Name: "[Gmail]/Trash", Attributes: []string{`\HasNoChildren`, `\Trash`}},
+		{Name: "Dossier Réservé"},
+	}
+	expected := []*imapBox{
+		inbox,
+		ignored,
+		{name: "[Gmail]/Sent Mail", tag: "[gmail]/sent_mail"},
+		{ignore: true, name: "[Gmail]/Trash", tag: "[gmail]/trash"},
+		{name: "Dossier Réservé", tag: "dossier_reserve"},
+	}
+	result := mergeMailboxes(known, remote)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("invalid merged mailboxes.\nExpected : %+v\nGot : %+v", expected, result)
+	}
+	if result[0] != inbox {
+		t.Error("known mailbox should be kept with its sync state")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * // Copyleft (ɔ) 2019 The Caliopen contributors.
+ * // Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+ * // license (AGPL) that can be found in the LICENSE file.
+ */
+
+package imap_worker
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	heartbeatInterval = 30 * time.Second
+	maxReportedErrors = 10 // max errors sent along with a job status
+	workerProtocol    = "imap"
+)
+
+// jobTracker publishes job's status to idpoller while a worker runs it
+type jobTracker struct {
+	status JobStatus
+	worker *Worker
+}
+
+// heartbeat periodically notifies idpoller that worker is alive, until stop chan is closed
+func (worker *Worker) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	worker.publishStatus(WorkerStatus{Type: HeartbeatStatus})
+	for {
+		select {
+		case <-ticker.C:
+			worker.publishStatus(WorkerStatus{Type: HeartbeatStatus})
+		case <-stop:
+			return
+		}
+	}
+}
+
+// publishStatus sends status on idpoller's status topic, if one is configured
+func (worker *Worker) publishStatus(status WorkerStatus) {
+	if worker.Config.NatsTopicStatus == "" {
+		return
+	}
+	status.Protocol = workerProtocol
+	status.Time = time.Now()
+	status.Worker = worker.Id
+	data, err := json.Marshal(status)
+	if err == nil {
+		err = worker.NatsConn.Publish(worker.Config.NatsTopicStatus, data)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[worker %s] failed to publish status", worker.Id)
+	}
+}
+
+// trackJob publishes a "started" status for order and returns a tracker to report job's progress
+func (worker *Worker) trackJob(order IMAPorder) *jobTracker {
+	now := time.Now()
+	tracker := &jobTracker{
+		status: JobStatus{
+			IdentityId: order.IdentityId,
+			JobId:      order.JobId,
+			Order:      order.Order,
+			Started:    now,
+			State:      JobStarted,
+			Updated:    now,
+			UserId:     order.UserId,
+			Worker:     worker.Id,
+		},
+		worker: worker,
+	}
+	tracker.publish()
+	return tracker
+}
+
+// progress is given to fetcher to be called as mails are delivered
+func (tracker *jobTracker) progress(progress syncProgress) {
+	tracker.status.State = JobProgress
+	tracker.status.Fetched = progress.fetched
+	tracker.status.Errors = lastErrors(progress.errors)
+	tracker.publish()
+}
+
+// finish publishes final job's status
+func (tracker *jobTracker) finish(jobErr error) {
+	tracker.status.State = JobDone
+	if jobErr != nil {
+		tracker.status.State = JobFailed
+		tracker.status.Errors = lastErrors(append(tracker.status.Errors, jobErr.Error()))
+	} else if len(tracker.status.Errors) > 0 && tracker.status.Fetched == 0 {
+		// fetcher stores connection failures in identity instead of returning them
+		tracker.status.State = JobFailed
+	}
+	tracker.publish()
+}
+
+func (tracker *jobTracker) publish() {
+	tracker.status.Updated = time.Now()
+	tracker.status.Duration = int64(tracker.status.Updated.Sub(tracker.status.Started) / time.Millisecond)
+	status := tracker.status
+	tracker.worker.publishStatus(WorkerStatus{
+		Job:  &status,
+		Type: JobStatusType,
+	})
+}
+
+// lastErrors returns a copy of the last maxReportedErrors errors
+func lastErrors(errs []string) []string {
+	if len(errs) > maxReportedErrors {
+		errs = errs[len(errs)-maxReportedErrors:]
+	}
+	return append([]string{}, errs...)
+}
@@ -0,0 +1,71 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package imap_worker
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/nats-io/go-nats"
+	"testing"
+	"time"
+)
+
+func TestWorker_trackJob(t *testing.T) {
+	w, s, err := newWorkerTest()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer s.Shutdown()
+	w.Config.NatsTopicStatus = "workersStatus"
+
+	statuses := make(chan WorkerStatus, 10)
+	sub, err := w.NatsConn.Subscribe(w.Config.NatsTopicStatus, func(msg *nats.Msg) {
+		status := WorkerStatus{}
+		if err := json.Unmarshal(msg.Data, &status); err != nil {
+			t.Error(err)
+		}
+		statuses <- status
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	tracker := w.trackJob(IMAPorder{Order: "sync", IdentityId: "identity", UserId: "user", JobId: "job"})
+	tracker.progress(syncProgress{fetched: 12, errors: []string{"delivery failed"}})
+	tracker.finish(errors.New("sync failed"))
+
+	expected := []string{JobStarted, JobProgress, JobFailed}
+	for _, state := range expected {
+		select {
+		case status := <-statuses:
+			if status.Type != JobStatusType || status.Job == nil {
+				t.Errorf("expected a job status, got %+v", status)
+				return
+			}
+			if status.Job.State != state || status.Job.JobId != "job" || status.Worker != w.Id {
+				t.Errorf("expected job in state %s, got %+v", state, status.Job)
+			}
+			if state == JobFailed && (status.Job.Fetched != 12 || len(status.Job.Errors) != 2) {
+				t.Errorf("expected failed job with fetched count and errors, got %+v", status.Job)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timeout waiting for %s status", state)
+			return
+		}
+	}
+}
+
+func TestLastErrors(t *testing.T) {
+	errs := make([]string, maxReportedErrors+5)
+	errs[len(errs)-1] = "last"
+	last := lastErrors(errs)
+	if len(last) != maxReportedErrors || last[maxReportedErrors-1] != "last" {
+		t.Errorf("expected the %d last errors, got %v", maxReportedErrors, last)
+	}
+}
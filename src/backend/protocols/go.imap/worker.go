@@ -27,6 +27,7 @@ type Worker struct {
 	NatsSubs  []*nats.Subscription
 	Store     backends.LDAStore
 	HaltGroup *sync.WaitGroup
+	idlers    *idleManager
 }
 
 const (
@@ -94,6 +95,11 @@ func NewWorker(config WorkerConfig, id string) (worker *Worker, err error) {
 		}
 	}
 
+	// push mode
+	if config.IdleMode {
+		w.idlers = newIdleManager(&w, config.MaxIdleConns)
+	}
+
 	return &w, nil
 }
 
@@ -110,6 +116,8 @@ func (worker *Worker) Start(throttling ...time.Duration) error {
 		return err
 	}
 	worker.NatsConn.Flush()
+	stopBeats := make(chan struct{})
+	go worker.heartbeat(stopBeats)
 	log.Infof("IMAP worker %s starting with %d sec throttling", worker.Id, throttle/time.Second)
 
 	// start throttled jobs polling
@@ -125,6 +133,7 @@ func (worker *Worker) Start(throttling ...time.Duration) error {
 		}
 		// check for interrupt after job is finished
 		if worker.HaltGroup != nil {
+			close(stopBeats)
 			worker.Stop()
 			break
 		}
@@ -137,6 +146,10 @@ func (worker *Worker) Start(throttling ...time.Duration) error {
 }
 
 func (worker *Worker) Stop() {
+	// close long-lived connections before closing backends they rely on
+	if worker.idlers != nil {
+		worker.idlers.stopAll()
+	}
 	for _, sub := range worker.NatsSubs {
 		sub.Unsubscribe()
 	}
@@ -148,6 +161,34 @@ func (worker *Worker) Stop() {
 	log.Infof("worker %s stopped", worker.Id)
 }
 
+// reportJob acks job to idpoller if order has been dispatched by idpoller,
+// so that job is not dispatched again to another worker.
+func (worker *Worker) reportJob(order IMAPorder, jobErr error) {
+	if order.JobId == "" {
+		return
+	}
+	report := WorkerRequest{
+		Worker: worker.Id,
+		Order: BrokerOrder{
+			Order:      "job_done",
+			IdentityId: order.IdentityId,
+			UserId:     order.UserId,
+			JobId:      order.JobId,
+		},
+	}
+	if jobErr != nil {
+		report.Order.Order = "job_failed"
+		report.Error = jobErr.Error()
+	}
+	data, err := json.Marshal(report)
+	if err == nil {
+		err = worker.NatsConn.Publish(worker.Config.NatsTopicPoller, data)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[worker %s] failed to report job %s to idpoller", worker.Id, order.JobId)
+	}
+}
+
 // MsgHandler parses message and launches appropriate goroutine to handle requested operations
 func (worker *Worker) natsMsgHandler(msg *nats.Msg) {
 	message := IMAPorder{}
@@ -159,13 +200,33 @@ func (worker *Worker) natsMsgHandler(msg *nats.Msg) {
 	switch message.Order {
 	case noPendingJobErr:
 		return
-	case "sync": // simplest order to initiate a sync op for a stored remote identity
+	case "sync", "full_sync", "reset_sync": // orders to initiate a sync op for a stored remote identity
+		// "full_sync" fetches again all remote messages, "reset_sync" forgets sync state before syncing
 		fetcher := Fetcher{
 			Hostname: worker.Config.Hostname,
 			Lda:      worker.Lda,
 			Store:    worker.Store,
 		}
-		syncRemoteWithLocal(&fetcher, message)
+		if !lockIdentitySync(message.IdentityId) {
+			log.Infof("[worker %s] identity %s is already being synced by this worker", worker.Id, message.IdentityId)
+			worker.reportJob(message, nil)
+			return
+		}
+		tracker := worker.trackJob(message)
+		fetcher.progress = tracker.progress
+		if message.Order == "reset_sync" {
+			err = resetSyncState(&fetcher, message)
+		}
+		if err == nil {
+			err = syncRemoteWithLocal(&fetcher, message)
+		}
+		unlockIdentitySync(message.IdentityId)
+		tracker.finish(err)
+		worker.reportJob(message, err)
+		if err == nil && worker.idlers != nil {
+			// identity is healthy, keep a connection open to be notified of new mails
+			worker.idlers.watch(message.UserId, message.IdentityId)
+		}
 	case "fullfetch": // order sent by imapctl to initiate a fetch op for an user
 		fetcher := Fetcher{
 			Hostname: worker.Config.Hostname,
@@ -173,6 +234,13 @@ func (worker *Worker) natsMsgHandler(msg *nats.Msg) {
 			Store:    worker.Store,
 		}
 		fetchRemoteToLocal(&fetcher, message)
+	case "flags": // order sent by api2 to push message's flags to remote IMAP account
+		fetcher := Fetcher{
+			Hostname: worker.Config.Hostname,
+			Lda:      worker.Lda,
+			Store:    worker.Store,
+		}
+		pushFlagsToRemote(&fetcher, message)
 	case "deliver": // order sent by api2 to send a draft via remote SMTP/IMAP
 		sender := Sender{
 			Hostname:      worker.Config.Hostname,
@@ -183,6 +251,19 @@ func (worker *Worker) natsMsgHandler(msg *nats.Msg) {
 			Store:         worker.Store,
 		}
 		sendDraft(&sender, msg)
+	case "import_mailbox": // order sent by api2 to import an uploaded mailbox for an identity
+		importer := Importer{
+			Lda:         worker.Lda,
+			NatsConn:    worker.NatsConn,
+			Store:       worker.Store,
+			StatusTopic: worker.Config.NatsTopicImports,
+		}
+		// imports could last for hours, they must not hold nats' subscription meanwhile
+		go func() {
+			if err := importMailbox(&importer, message); err != nil {
+				log.WithError(err).Warnf("[worker %s] import of mailbox for user %s failed", worker.Id, message.UserId)
+			}
+		}()
 	case "test":
 		log.Info("Order « test » received")
 	}
@@ -162,6 +162,20 @@ func TestWorker_natsMsgHandler(t *testing.T) {
 		}
 		return nil
 	}
+	pushFlagsToRemote = func(f *Fetcher, order IMAPorder) error {
+		defer close(c)
+		if f == nil {
+			t.Error("expected a Fetcher within pushFlagsToRemote call, got nil")
+			return nil
+		}
+		if f.Store != w.Store {
+			t.Errorf("expected a fetcher set with worker's store, got %+v", f.Store)
+		}
+		if order.MessageId != "message-id" {
+			t.Errorf("expected order with message_id, got %+v", order)
+		}
+		return nil
+	}
 	sendDraft = func(s *Sender, msg *nats.Msg) {
 		defer close(c)
 		if s == nil {
@@ -195,6 +209,29 @@ func TestWorker_natsMsgHandler(t *testing.T) {
 	case <-time.After(10 * time.Millisecond):
 		t.Error("expected 'sync' order to trigger a call to syncRemoteWithLocal func, but func was not called")
 	}
+	// 'reset_sync'
+	c = make(chan struct{})
+	reset := false
+	resetSyncState = func(f *Fetcher, order IMAPorder) error {
+		reset = true
+		return nil
+	}
+	order.Order = "reset_sync"
+	data, _ = json.Marshal(order)
+	natsPayload = nats.Msg{
+		Subject: "test",
+		Reply:   "testMsgReply",
+		Data:    data,
+	}
+	w.natsMsgHandler(&natsPayload)
+	select {
+	case <-c:
+		if !reset {
+			t.Error("expected 'reset_sync' order to reset sync state before syncing")
+		}
+	case <-time.After(10 * time.Millisecond):
+		t.Error("expected 'reset_sync' order to trigger a call to syncRemoteWithLocal func, but func was not called")
+	}
 	// 'fullfetch'
 	c = make(chan struct{})
 	order.Order = "fullfetch"
@@ -225,4 +262,46 @@ func TestWorker_natsMsgHandler(t *testing.T) {
 	case <-time.After(10 * time.Millisecond):
 		t.Error("expected 'deliver' order to trigger a call to sendDraft func, but func was not called")
 	}
+	// 'flags'
+	c = make(chan struct{})
+	order.Order = "flags"
+	order.MessageId = "message-id"
+	data, _ = json.Marshal(order)
+	natsPayload = nats.Msg{
+		Subject: "test",
+		Reply:   "testMsgReply",
+		Data:    data,
+	}
+	w.natsMsgHandler(&natsPayload)
+	select {
+	case <-c:
+	case <-time.After(10 * time.Millisecond):
+		t.Error("expected 'flags' order to trigger a call to pushFlagsToRemote func, but func was not called")
+	}
+	// 'import_mailbox'
+	c = make(chan struct{})
+	importMailbox = func(i *Importer, order IMAPorder) error {
+		defer close(c)
+		if i.Store != w.Store || i.Lda != w.Lda {
+			t.Errorf("expected an importer set with worker's store and lda, got %+v", i)
+		}
+		if order.Import == nil || order.Import.ImportId != "import-id" {
+			t.Errorf("expected order with import, got %+v", order)
+		}
+		return nil
+	}
+	order.Order = "import_mailbox"
+	order.Import = &MailboxImport{ImportId: "import-id"}
+	data, _ = json.Marshal(order)
+	natsPayload = nats.Msg{
+		Subject: "test",
+		Reply:   "testMsgReply",
+		Data:    data,
+	}
+	w.natsMsgHandler(&natsPayload)
+	select {
+	case <-c:
+	case <-time.After(10 * time.Millisecond):
+		t.Error("expected 'import_mailbox' order to trigger a call to importMailbox func, but func was not called")
+	}
 }
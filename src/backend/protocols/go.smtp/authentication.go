@@ -0,0 +1,206 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"net"
+	"strings"
+	"time"
+)
+
+// max time spent checking sender authentication of an email
+const authenticationTimeout = 20 * time.Second
+
+// DNSResolver is the subset of *net.Resolver needed to check SPF, DKIM and DMARC,
+// so that checks could be run against another resolver, or an in-memory zone.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// isTemporaryDNSError tells if a lookup failed for a reason that may not persist,
+// as opposed to a domain or a record that does not exist
+func isTemporaryDNSError(err error) bool {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return true
+	}
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.Timeout() || dnsErr.Temporary()
+	}
+	return false
+}
+
+// AuthenticationResults holds the results of sender authentication checks of an inbound email
+type AuthenticationResults struct {
+	AuthServId string // identifies results we wrote, see authserv_id in lmtp.yaml
+	SPF        *spfResult
+	DKIM       []*dkimResult
+	DMARC      *dmarcResult
+}
+
+// checkAuthentication evaluates SPF of sender against peer's address, verifies DKIM signatures of email
+// and evaluates DMARC alignment of From header's domain.
+// SPF is not evaluated for emails relayed by a trusted MTA which didn't give its client's address with XCLIENT :
+// MTA's address is not the one SPF is about.
+func checkAuthentication(resolver DNSResolver, authServId string, peer Peer, ev SmtpEnvelope, now time.Time) *AuthenticationResults {
+	ctx, cancel := context.WithTimeout(context.Background(), authenticationTimeout)
+	defer cancel()
+
+	headers, body := splitEmail(ev.Data)
+	results := &AuthenticationResults{AuthServId: authServId}
+	if !peer.Relay {
+		results.SPF = checkSPF(ctx, resolver, peerIP(peer), peer.HeloName, ev.Sender)
+	}
+	results.DKIM = verifyDKIM(ctx, resolver, headers, body, now)
+	results.DMARC = checkDMARC(ctx, resolver, headers, results.SPF, results.DKIM)
+	return results
+}
+
+// peerIP returns the IP of peer, which is the one given by XCLIENT command if any
+func peerIP(peer Peer) net.IP {
+	switch addr := peer.Addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(peer.Addr.String())
+	if err != nil {
+		host = peer.Addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// DKIMResult returns the best result of DKIM signatures' verifications
+func (ar *AuthenticationResults) DKIMResult() string {
+	if len(ar.DKIM) == 0 {
+		return AuthNone
+	}
+	rank := map[string]int{AuthPass: 4, AuthFail: 3, AuthTempError: 2, AuthPermError: 1}
+	best := ar.DKIM[0].Result
+	for _, signature := range ar.DKIM[1:] {
+		if rank[signature.Result] > rank[best] {
+			best = signature.Result
+		}
+	}
+	return best
+}
+
+// Header returns the Authentication-Results header field, see https://tools.ietf.org/html/rfc8601
+func (ar *AuthenticationResults) Header() string {
+	results := []string{}
+	if len(ar.DKIM) == 0 {
+		results = append(results, "dkim=none")
+	}
+	for _, signature := range ar.DKIM {
+		result := "dkim=" + signature.Result
+		if signature.Reason != "" {
+			result += " (" + headerComment(signature.Reason) + ")"
+		}
+		if signature.Domain != "" {
+			result += " header.d=" + signature.Domain
+		}
+		if signature.Selector != "" {
+			result += " header.s=" + signature.Selector
+		}
+		if signature.Signature != "" {
+			result += " header.b=" + signature.Signature
+		}
+		results = append(results, result)
+	}
+	if ar.SPF != nil {
+		result := "spf=" + ar.SPF.Result
+		if ar.SPF.Reason != "" {
+			result += " (" + headerComment(ar.SPF.Reason) + ")"
+		}
+		if ar.SPF.Sender != "" {
+			result += " smtp.mailfrom=" + ar.SPF.Sender
+		}
+		results = append(results, result)
+	}
+	if ar.DMARC != nil {
+		result := "dmarc=" + ar.DMARC.Result
+		if ar.DMARC.Policy != "" {
+			result += " (p=" + ar.DMARC.Policy + ")"
+		}
+		if ar.DMARC.From != "" {
+			result += " header.from=" + ar.DMARC.From
+		}
+		results = append(results, result)
+	}
+	return "Authentication-Results: " + ar.AuthServId + ";\r\n\t" + strings.Join(results, ";\r\n\t") + "\r\n"
+}
+
+// AddTo records results into privacy features of message.
+// Transport is considered signed only if a DKIM signature has been verified.
+func (ar *AuthenticationResults) AddTo(features *PrivacyFeatures) {
+	dkim := ar.DKIMResult()
+	signed := "False"
+	if dkim == AuthPass {
+		signed = "True"
+	}
+	(*features)[FeatureTransportSigned] = signed
+	(*features)[FeatureTransportDKIM] = dkim
+	if ar.SPF != nil {
+		(*features)[FeatureTransportSPF] = ar.SPF.Result
+	}
+	if ar.DMARC != nil {
+		(*features)[FeatureTransportDMARC] = ar.DMARC.Result
+	}
+}
+
+// Apply prepends Authentication-Results header to email, after removing the ones pretending to come from us.
+// Only headers carrying our authserv-id are removed as forged (RFC 8601 section 5), the ones of other
+// authserv-ids are left untouched : consumers must only trust the results of the authserv-ids they know.
+func (ar *AuthenticationResults) Apply(data []byte) []byte {
+	headers, _ := splitEmail(data)
+	forged := map[int]bool{}
+	for i, header := range headers {
+		if strings.EqualFold(header.Name, "Authentication-Results") && authServId(header.Value()) == strings.ToLower(ar.AuthServId) {
+			forged[i] = true
+		}
+	}
+	result := bytes.NewBufferString(ar.Header())
+	if len(forged) == 0 {
+		result.Write(data)
+		return result.Bytes()
+	}
+	// header fields are walked the same way as splitEmail does, body is copied as is
+	lines := strings.SplitAfter(string(data), "\n")
+	field := -1
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" || (trimmed[0] != ' ' && trimmed[0] != '\t' && strings.Index(trimmed, ":") <= 0) {
+			result.WriteString(strings.Join(lines[i:], ""))
+			break
+		}
+		if trimmed[0] != ' ' && trimmed[0] != '\t' {
+			field++
+		}
+		if !forged[field] {
+			result.WriteString(line)
+		}
+	}
+	return result.Bytes()
+}
+
+// authServId returns the lowercased authserv-id of an Authentication-Results value
+func authServId(value string) string {
+	id := value
+	if i := strings.IndexAny(id, "; \t("); i >= 0 {
+		id = id[:i]
+	}
+	return strings.ToLower(id)
+}
+
+// headerComment makes text safe to be embedded within a header comment
+func headerComment(text string) string {
+	return strings.NewReplacer("(", "", ")", "", "\\", "", "\r", "", "\n", "").Replace(fmt.Sprint(text))
+}
@@ -0,0 +1,285 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"golang.org/x/crypto/ed25519"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testZone is an in-memory DNS zone, names without records don't exist
+type testZone struct {
+	txt     map[string][]string
+	mx      map[string][]*net.MX
+	ip      map[string][]string
+	failing map[string]bool // names for which lookups time out
+}
+
+func (z testZone) lookup(name string) error {
+	if z.failing[name] {
+		return &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	return &net.DNSError{Err: "no such host", Name: name}
+}
+
+func (z testZone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txts, ok := z.txt[name]; ok {
+		return txts, nil
+	}
+	return nil, z.lookup(name)
+}
+
+func (z testZone) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if mxs, ok := z.mx[name]; ok {
+		return mxs, nil
+	}
+	return nil, z.lookup(name)
+}
+
+func (z testZone) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := z.ip[host]
+	if !ok {
+		return nil, z.lookup(host)
+	}
+	addrs := []net.IPAddr{}
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+// dkimSign prepends a DKIM-Signature header of From and Subject headers to email
+func dkimSign(t *testing.T, email, domain, selector, canon string, key crypto.Signer) string {
+	headers, body := splitEmail([]byte(email))
+	headerCanon, bodyCanon := strings.Split(canon, "/")[0], strings.Split(canon, "/")[1]
+	bodyHash := sha256.Sum256(canonicalizeBody(body, bodyCanon))
+	algorithm := "rsa-sha256"
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+	}
+	sigHeader := "DKIM-Signature: v=1; a=" + algorithm + "; c=" + canon + "; d=" + domain + "; s=" + selector +
+		";\r\n\th=From:Subject; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+
+	h := sha256.New()
+	for _, name := range []string{"From", "Subject"} {
+		for _, header := range headers {
+			if header.Name == name {
+				h.Write([]byte(canonicalizeHeader(header, headerCanon) + "\r\n"))
+			}
+		}
+	}
+	h.Write([]byte(canonicalizeHeader(emailHeader{Name: "DKIM-Signature", Raw: sigHeader}, headerCanon)))
+	var signature []byte
+	var err error
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		signature, err = key.Sign(rand.Reader, h.Sum(nil), crypto.Hash(0))
+	} else {
+		signature, err = key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sigHeader + base64.StdEncoding.EncodeToString(signature) + "\r\n" + email
+}
+
+// authTestZone publishes example.com's SPF, DKIM and DMARC records, and returns keys used to sign its emails
+func authTestZone(t *testing.T) (testZone, crypto.Signer, crypto.Signer) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := testZone{
+		txt: map[string][]string{
+			"example.com":                    {"google-site-verification=abc", "v=spf1 mx include:_spf.example.com ~all"},
+			"_spf.example.com":               {"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 -all"},
+			"mail.example.com":               {"v=spf1 redirect=_spf.example.com"},
+			"relay.example.org":              {"v=spf1 a:relay.example.org/30 -all"},
+			"broken.example.org":             {"v=spf1 include:down.example.org -all"},
+			"loop.example.org":               {"v=spf1 include:loop.example.org -all"},
+			"rsa._domainkey.example.com":     {"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(rsaPub)},
+			"ed._domainkey.example.com":      {"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPub)},
+			"revoked._domainkey.example.com": {"v=DKIM1; p="},
+			"_dmarc.example.com":             {"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"},
+			"_dmarc.example.org":             {"v=DMARC1; p=quarantine; sp=none; adkim=s; aspf=s"},
+		},
+		mx: map[string][]*net.MX{
+			"example.com": {{Host: "mx.example.com", Pref: 10}},
+		},
+		ip: map[string][]string{
+			"mx.example.com":    {"203.0.113.25"},
+			"relay.example.org": {"198.51.100.4"},
+		},
+		failing: map[string]bool{"down.example.org": true},
+	}
+	return zone, rsaKey, edKey
+}
+
+const authTestEmail = "From: Alice <alice@news.example.com>\r\n" +
+	"To: emma@caliopen.local\r\n" +
+	"Subject: Hello\r\n" +
+	"\r\n" +
+	"Hello Emma,\r\n" +
+	"how are you ?  \r\n" +
+	"\r\n"
+
+func TestCheckAuthentication(t *testing.T) {
+	zone, rsaKey, edKey := authTestZone(t)
+	now := time.Now()
+	peer := Peer{HeloName: "mx.example.com", ServerName: "lmtp.caliopen.local", Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 25}}
+
+	cases := []struct {
+		name     string
+		peerIP   string
+		sender   string
+		email    string
+		features PrivacyFeatures
+	}{
+		{"rsa signature, relaxed alignment through subdomains", "192.0.2.10", "bounces@mail.example.com",
+			dkimSign(t, authTestEmail, "example.com", "rsa", "relaxed/relaxed", rsaKey),
+			PrivacyFeatures{FeatureTransportSigned: "True", FeatureTransportDKIM: AuthPass, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthPass}},
+		{"ed25519 signature, spf fail", "198.51.100.7", "bounces@mail.example.com",
+			dkimSign(t, authTestEmail, "example.com", "ed", "simple/simple", edKey),
+			PrivacyFeatures{FeatureTransportSigned: "True", FeatureTransportDKIM: AuthPass, FeatureTransportSPF: AuthFail, FeatureTransportDMARC: AuthPass}},
+		{"tampered body", "192.0.2.10", "bounces@mail.example.com",
+			strings.Replace(dkimSign(t, authTestEmail, "example.com", "rsa", "relaxed/relaxed", rsaKey), "Emma", "Bob", 1),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthFail, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthPass}},
+		{"whitespaces changes are allowed by relaxed canonicalization", "198.51.100.7", "",
+			strings.Replace(dkimSign(t, authTestEmail, "example.com", "rsa", "relaxed/relaxed", rsaKey), "you ?  ", "you \t?", 1),
+			PrivacyFeatures{FeatureTransportSigned: "True", FeatureTransportDKIM: AuthPass, FeatureTransportSPF: AuthNone, FeatureTransportDMARC: AuthPass}},
+		{"revoked key, mx softfail", "198.51.100.7", "alice@example.com",
+			dkimSign(t, authTestEmail, "example.com", "revoked", "relaxed/simple", rsaKey),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthPermError, FeatureTransportSPF: AuthSoftFail, FeatureTransportDMARC: AuthFail}},
+		{"no signature, mx pass", "203.0.113.25", "alice@example.com", authTestEmail,
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthPass}},
+		{"no signature, unaligned spf pass", "203.0.113.25", "alice@example.com",
+			strings.Replace(authTestEmail, "news.example.com", "example.org", 1),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthFail}},
+		{"strict alignment", "198.51.100.5", "relay@relay.example.org",
+			strings.Replace(authTestEmail, "news.example.com", "example.org", 1),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthFail}},
+		{"a mechanism with cidr length", "198.51.100.5", "relay@relay.example.org",
+			strings.Replace(authTestEmail, "news.example.com", "relay.example.org", 1),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthPass}},
+		{"dns failure", "192.0.2.10", "alice@broken.example.org", authTestEmail,
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthTempError, FeatureTransportDMARC: AuthFail}},
+		{"include loop", "192.0.2.10", "alice@loop.example.org", authTestEmail,
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPermError, FeatureTransportDMARC: AuthFail}},
+		{"ipv6 pass, unknown domains", "2001:db8::25", "bounces@mail.example.com",
+			strings.Replace(authTestEmail, "news.example.com", "example.net", 1),
+			PrivacyFeatures{FeatureTransportSigned: "False", FeatureTransportDKIM: AuthNone, FeatureTransportSPF: AuthPass, FeatureTransportDMARC: AuthNone}},
+	}
+	for _, c := range cases {
+		peer.Addr = &net.TCPAddr{IP: net.ParseIP(c.peerIP), Port: 25}
+		results := checkAuthentication(zone, peer.ServerName, peer, SmtpEnvelope{Sender: c.sender, Data: []byte(c.email)}, now)
+		features := PrivacyFeatures{}
+		results.AddTo(&features)
+		for feature, expected := range c.features {
+			if features[feature] != expected {
+				t.Errorf("%s: expected %s=%s, got %s\n%s", c.name, feature, expected, features[feature], results.Header())
+			}
+		}
+	}
+}
+
+func TestAuthenticationResults_Apply(t *testing.T) {
+	zone, rsaKey, _ := authTestZone(t)
+	peer := Peer{HeloName: "mx.example.com", ServerName: "lmtp.caliopen.local", Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 25}}
+	email := "Authentication-Results: lmtp.caliopen.local;\r\n\tdkim=pass header.d=example.com\r\n" +
+		"Authentication-Results: mx.example.com; spf=pass smtp.mailfrom=example.com\r\n" +
+		dkimSign(t, authTestEmail, "example.com", "rsa", "relaxed/relaxed", rsaKey)
+
+	results := checkAuthentication(zone, peer.ServerName, peer, SmtpEnvelope{Sender: "bounces@mail.example.com", Data: []byte(email)}, time.Now())
+	applied := string(results.Apply([]byte(email)))
+	expected := "Authentication-Results: lmtp.caliopen.local;\r\n" +
+		"\tdkim=pass header.d=example.com header.s=rsa header.b="
+	if !strings.HasPrefix(applied, expected) {
+		t.Errorf("expected Authentication-Results header to be prepended, got\n%s", applied)
+	}
+	for _, part := range []string{
+		";\r\n\tspf=pass smtp.mailfrom=bounces@mail.example.com;\r\n\tdmarc=pass (p=reject) header.from=news.example.com\r\n",
+		"Authentication-Results: mx.example.com; spf=pass smtp.mailfrom=example.com\r\n",
+	} {
+		if !strings.Contains(applied, part) {
+			t.Errorf("expected %q within\n%s", part, applied)
+		}
+	}
+	if strings.Count(applied, "lmtp.caliopen.local") != 1 {
+		t.Errorf("expected forged Authentication-Results header to be removed, got\n%s", applied)
+	}
+	if !strings.HasSuffix(applied, authTestEmail) {
+		t.Errorf("expected email to be left untouched, got\n%s", applied)
+	}
+}
+
+func TestCheckAuthentication_relayed(t *testing.T) {
+	zone, rsaKey, _ := authTestZone(t)
+	// MTA relaying without XCLIENT, its address says nothing about sender
+	peer := Peer{HeloName: "mta.caliopen.local", ServerName: "lmtp.caliopen.local", Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2525}, Relay: true}
+	email := dkimSign(t, authTestEmail, "example.com", "rsa", "relaxed/relaxed", rsaKey)
+
+	results := checkAuthentication(zone, "mx.caliopen.local", peer, SmtpEnvelope{Sender: "bounces@mail.example.com", Data: []byte(email)}, time.Now())
+	features := PrivacyFeatures{}
+	results.AddTo(&features)
+	if _, found := features[FeatureTransportSPF]; found || results.SPF != nil {
+		t.Errorf("expected SPF not to be checked for relayed email, got %s", features[FeatureTransportSPF])
+	}
+	if features[FeatureTransportDMARC] != AuthPass {
+		t.Errorf("expected DMARC to pass through DKIM alignment, got %s", features[FeatureTransportDMARC])
+	}
+	header := results.Header()
+	if !strings.HasPrefix(header, "Authentication-Results: mx.caliopen.local;") || strings.Contains(header, "spf=") {
+		t.Errorf("expected configured authserv-id and no spf result, got\n%s", header)
+	}
+}
+
+func TestServer_xclientAllowed(t *testing.T) {
+	srv := &Server{EnableXCLIENT: true}
+	for _, peer := range []string{"10.0.0.0/8", "192.0.2.25", "2001:db8::25"} {
+		network, err := parseNetwork(peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.XCLIENTPeers = append(srv.XCLIENTPeers, network)
+	}
+	if _, err := parseNetwork("mta.caliopen.local"); err == nil {
+		t.Error("expected host names to be refused as xclient peers")
+	}
+
+	for addr, allowed := range map[string]bool{
+		"10.1.2.3":     true,
+		"192.0.2.25":   true,
+		"192.0.2.26":   false,
+		"2001:db8::25": true,
+		"2001:db8::26": false,
+		"203.0.113.25": false,
+	} {
+		if srv.xclientAllowed(&net.TCPAddr{IP: net.ParseIP(addr), Port: 25}) != allowed {
+			t.Errorf("expected xclient allowed to be %t for %s", allowed, addr)
+		}
+	}
+	srv.EnableXCLIENT = false
+	if srv.xclientAllowed(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 25}) {
+		t.Error("expected xclient to be refused when it is not enabled")
+	}
+}
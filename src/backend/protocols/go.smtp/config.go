@@ -24,6 +24,8 @@ type (
 		SubmitUser      string         `mapstructure:"submit_user"`
 		SubmitPassword  string         `mapstructure:"submit_password"`
 		OutWorkers      int            `mapstructure:"submit_workers"`
+		CheckSenderAuth bool           `mapstructure:"check_sender_auth"` // check SPF, DKIM and DMARC of inbound emails
+		AuthServId      string         `mapstructure:"authserv_id"`       // identifies Authentication-Results headers written by lmtpd, inbound server's host_name if empty
 	}
 
 	// ServerConfig specifies config options for a single smtp server
@@ -31,13 +33,15 @@ type (
 		IsEnabled       bool   `mapstructure:"is_enabled"`
 		Hostname        string `mapstructure:"host_name"`
 		AllowedHosts    []string
-		MaxSize         uint64 `mapstructure:"max_size"` //max size for emails
-		PrivateKeyFile  string `mapstructure:"private_key_file"`
-		PublicKeyFile   string `mapstructure:"public_key_file"`
-		Timeout         int    `mapstructure:"timeout"`
-		ListenInterface string `mapstructure:"listen_interface"`
-		StartTLSOn      bool   `mapstructure:"start_tls_on,omitempty"`
-		TLSAlwaysOn     bool   `mapstructure:"tls_always_on,omitempty"`
-		MaxClients      int    `mapstructure:"max_clients"`
+		MaxSize         uint64   `mapstructure:"max_size"` //max size for emails
+		PrivateKeyFile  string   `mapstructure:"private_key_file"`
+		PublicKeyFile   string   `mapstructure:"public_key_file"`
+		Timeout         int      `mapstructure:"timeout"`
+		ListenInterface string   `mapstructure:"listen_interface"`
+		StartTLSOn      bool     `mapstructure:"start_tls_on,omitempty"`
+		TLSAlwaysOn     bool     `mapstructure:"tls_always_on,omitempty"`
+		MaxClients      int      `mapstructure:"max_clients"`
+		EnableXCLIENT   bool     `mapstructure:"enable_xclient"`
+		XCLIENTPeers    []string `mapstructure:"xclient_peers"` // addresses or CIDR networks of the MTAs allowed to use XCLIENT
 	}
 )
@@ -0,0 +1,404 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"golang.org/x/crypto/ed25519"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DomainKeys Identified Mail signatures, see https://tools.ietf.org/html/rfc6376
+// rsa-sha1 is not accepted anymore (RFC 8301), ed25519-sha256 is (RFC 8463)
+const (
+	dkimMaxSignatures = 5    // signatures verified within an email, others are ignored
+	dkimMinRSABits    = 1024 // smallest RSA key accepted
+)
+
+// dkimResult is the outcome of the verification of a DKIM-Signature header
+type dkimResult struct {
+	Result    string // AuthPass, AuthFail, AuthNeutral, AuthTempError or AuthPermError
+	Domain    string // d= tag
+	Selector  string // s= tag
+	Signature string // first characters of b= tag, to tell signatures apart
+	Reason    string
+}
+
+// emailHeader is a raw header field, as found in email
+type emailHeader struct {
+	Name string // as found in email
+	Raw  string // whole field, including name and folding, without trailing CRLF
+}
+
+// splitEmail returns raw header fields and body of email, lines being CRLF terminated within body
+func splitEmail(data []byte) (headers []emailHeader, body []byte) {
+	lines := strings.Split(string(data), "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		if line == "" {
+			i++
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Raw += "\r\n" + line
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			// not a header field, consider it's the beginning of the body
+			break
+		}
+		headers = append(headers, emailHeader{Name: strings.TrimRight(line[:colon], " \t"), Raw: line})
+	}
+	bodyLines := lines[i:]
+	if len(bodyLines) > 0 && bodyLines[len(bodyLines)-1] == "" {
+		// data ended with a line break
+		bodyLines = bodyLines[:len(bodyLines)-1]
+	}
+	buf := new(bytes.Buffer)
+	for _, line := range bodyLines {
+		buf.WriteString(strings.TrimSuffix(line, "\r"))
+		buf.WriteString("\r\n")
+	}
+	return headers, buf.Bytes()
+}
+
+// Value returns the unfolded value of a raw header field
+func (h emailHeader) Value() string {
+	value := h.Raw[strings.Index(h.Raw, ":")+1:]
+	return strings.TrimSpace(strings.NewReplacer("\r\n", "", "\n", "").Replace(value))
+}
+
+// verifyDKIM verifies DKIM-Signature headers of email, from top to bottom
+func verifyDKIM(ctx context.Context, resolver DNSResolver, headers []emailHeader, body []byte, now time.Time) (results []*dkimResult) {
+	for i, header := range headers {
+		if !strings.EqualFold(header.Name, "DKIM-Signature") {
+			continue
+		}
+		if len(results) == dkimMaxSignatures {
+			break
+		}
+		results = append(results, verifyDKIMSignature(ctx, resolver, headers, i, body, now))
+	}
+	return
+}
+
+func verifyDKIMSignature(ctx context.Context, resolver DNSResolver, headers []emailHeader, index int, body []byte, now time.Time) *dkimResult {
+	res := &dkimResult{}
+	fail := func(result, format string, a ...interface{}) *dkimResult {
+		res.Result = result
+		res.Reason = fmt.Sprintf(format, a...)
+		return res
+	}
+	sigHeader := headers[index]
+	tags, err := parseTagList(sigHeader.Value())
+	if err != nil {
+		return fail(AuthPermError, "malformed signature : %s", err)
+	}
+	res.Domain = strings.ToLower(tags["d"])
+	res.Selector = tags["s"]
+	if b := stripWhitespaces(tags["b"]); len(b) > 8 {
+		res.Signature = b[:8]
+	} else {
+		res.Signature = b
+	}
+	for _, tag := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[tag] == "" {
+			return fail(AuthPermError, "missing %s= tag", tag)
+		}
+	}
+	if tags["v"] != "1" {
+		return fail(AuthPermError, "unsupported version %s", tags["v"])
+	}
+
+	var hashAlg crypto.Hash
+	var newHash func() hash.Hash
+	keyType := ""
+	switch strings.ToLower(tags["a"]) {
+	case "rsa-sha256":
+		hashAlg, newHash, keyType = crypto.SHA256, sha256.New, "rsa"
+	case "ed25519-sha256":
+		hashAlg, newHash, keyType = crypto.SHA256, sha256.New, "ed25519"
+	default:
+		return fail(AuthPermError, "unsupported algorithm %s", tags["a"])
+	}
+
+	headerCanon, bodyCanon := "simple", "simple"
+	if c := strings.ToLower(tags["c"]); c != "" {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanon = parts[0]
+		if len(parts) == 2 {
+			bodyCanon = parts[1]
+		}
+	}
+	for _, canon := range []string{headerCanon, bodyCanon} {
+		if canon != "simple" && canon != "relaxed" {
+			return fail(AuthPermError, "unsupported canonicalization %s", tags["c"])
+		}
+	}
+
+	signedHeaders := strings.Split(tags["h"], ":")
+	fromSigned := false
+	for i, name := range signedHeaders {
+		signedHeaders[i] = strings.TrimSpace(name)
+		if strings.EqualFold(signedHeaders[i], "From") {
+			fromSigned = true
+		}
+	}
+	if !fromSigned {
+		return fail(AuthPermError, "From header is not signed")
+	}
+	if auid := tags["i"]; auid != "" {
+		at := strings.LastIndex(auid, "@")
+		domain := strings.ToLower(auid[at+1:])
+		if at < 0 || (domain != res.Domain && !strings.HasSuffix(domain, "."+res.Domain)) {
+			return fail(AuthPermError, "i= tag doesn't match signing domain")
+		}
+	}
+	if x := tags["x"]; x != "" {
+		expiry, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return fail(AuthPermError, "invalid x= tag")
+		}
+		if now.Unix() > expiry {
+			return fail(AuthPermError, "signature expired")
+		}
+	}
+
+	// body hash
+	canonBody := canonicalizeBody(body, bodyCanon)
+	if l := tags["l"]; l != "" {
+		length, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || length < 0 {
+			return fail(AuthPermError, "invalid l= tag")
+		}
+		if length < int64(len(canonBody)) {
+			canonBody = canonBody[:length]
+		}
+	}
+	bodyHash, err := base64.StdEncoding.DecodeString(stripWhitespaces(tags["bh"]))
+	if err != nil {
+		return fail(AuthPermError, "invalid bh= tag")
+	}
+	h := newHash()
+	h.Write(canonBody)
+	if !bytes.Equal(h.Sum(nil), bodyHash) {
+		return fail(AuthFail, "body hash mismatch")
+	}
+
+	// public key
+	key, result, err := lookupDKIMKey(ctx, resolver, res.Selector, res.Domain)
+	if err != nil {
+		return fail(result, "%s", err)
+	}
+	if key.keyType != keyType {
+		return fail(AuthPermError, "key type %s doesn't match algorithm %s", key.keyType, tags["a"])
+	}
+
+	// headers hash, signed headers are taken from bottom to top when repeated
+	h = newHash()
+	used := map[int]bool{}
+	for _, name := range signedHeaders {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if used[i] || i == index || !strings.EqualFold(headers[i].Name, name) {
+				continue
+			}
+			used[i] = true
+			h.Write([]byte(canonicalizeHeader(headers[i], headerCanon) + "\r\n"))
+			break
+		}
+	}
+	h.Write([]byte(canonicalizeHeader(emailHeader{Name: sigHeader.Name, Raw: removeSignatureValue(sigHeader.Raw)}, headerCanon)))
+	digest := h.Sum(nil)
+
+	signature, err := base64.StdEncoding.DecodeString(stripWhitespaces(tags["b"]))
+	if err != nil {
+		return fail(AuthPermError, "invalid b= tag")
+	}
+	switch keyType {
+	case "rsa":
+		err = rsa.VerifyPKCS1v15(key.rsa, hashAlg, digest, signature)
+	case "ed25519":
+		if !ed25519.Verify(key.ed25519, digest, signature) {
+			err = errors.New("verification error")
+		}
+	}
+	if err != nil {
+		return fail(AuthFail, "signature verification failed")
+	}
+	res.Result = AuthPass
+	return res
+}
+
+type dkimKey struct {
+	keyType string
+	rsa     *rsa.PublicKey
+	ed25519 ed25519.PublicKey
+}
+
+// lookupDKIMKey retrieves the public key published at <selector>._domainkey.<domain>
+func lookupDKIMKey(ctx context.Context, resolver DNSResolver, selector, domain string) (*dkimKey, string, error) {
+	txts, err := resolver.LookupTXT(ctx, selector+"._domainkey."+domain)
+	if err != nil {
+		if isTemporaryDNSError(err) {
+			return nil, AuthTempError, err
+		}
+		return nil, AuthPermError, fmt.Errorf("no key for signature")
+	}
+	if len(txts) == 0 {
+		return nil, AuthPermError, fmt.Errorf("no key for signature")
+	}
+	// strings of a record are already concatenated by resolver, only first record is considered
+	tags, err := parseTagList(txts[0])
+	if err != nil {
+		return nil, AuthPermError, fmt.Errorf("malformed key record : %s", err)
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, AuthPermError, fmt.Errorf("unsupported key version %s", v)
+	}
+	p := stripWhitespaces(tags["p"])
+	if p == "" {
+		return nil, AuthPermError, errors.New("key revoked")
+	}
+	data, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, AuthPermError, errors.New("invalid key data")
+	}
+	key := &dkimKey{keyType: strings.ToLower(tags["k"])}
+	if key.keyType == "" {
+		key.keyType = "rsa"
+	}
+	switch key.keyType {
+	case "rsa":
+		pub, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// some signers publish PKCS#1 keys
+			pub, err = x509.ParsePKCS1PublicKey(data)
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if err != nil || !ok {
+			return nil, AuthPermError, errors.New("invalid RSA key")
+		}
+		if rsaKey.N.BitLen() < dkimMinRSABits {
+			return nil, AuthPermError, errors.New("RSA key too short")
+		}
+		key.rsa = rsaKey
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, AuthPermError, errors.New("invalid ed25519 key")
+		}
+		key.ed25519 = ed25519.PublicKey(data)
+	default:
+		return nil, AuthPermError, fmt.Errorf("unsupported key type %s", key.keyType)
+	}
+	return key, "", nil
+}
+
+// canonicalizeBody applies simple or relaxed body canonicalization algorithm to CRLF terminated lines
+func canonicalizeBody(body []byte, canon string) []byte {
+	if canon == "relaxed" {
+		lines := bytes.Split(body, []byte("\r\n"))
+		for i, line := range lines {
+			lines[i] = bytes.TrimRight(collapseWhitespaces(line), " ")
+		}
+		body = bytes.Join(lines, []byte("\r\n"))
+	}
+	// ignore all empty lines at the end of body
+	for bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if canon == "relaxed" && bytes.Equal(body, []byte("\r\n")) {
+		return []byte{}
+	}
+	if len(body) == 0 && canon == "simple" {
+		return []byte("\r\n")
+	}
+	return body
+}
+
+// canonicalizeHeader applies simple or relaxed header canonicalization algorithm, without trailing CRLF
+func canonicalizeHeader(header emailHeader, canon string) string {
+	if canon == "simple" {
+		return header.Raw
+	}
+	colon := strings.Index(header.Raw, ":")
+	name := strings.ToLower(strings.TrimRight(header.Raw[:colon], " \t"))
+	value := strings.NewReplacer("\r\n", "", "\n", "").Replace(header.Raw[colon+1:])
+	value = strings.Trim(string(collapseWhitespaces([]byte(value))), " ")
+	return name + ":" + value
+}
+
+// collapseWhitespaces replaces sequences of spaces and tabs with a single space
+func collapseWhitespaces(line []byte) []byte {
+	collapsed := make([]byte, 0, len(line))
+	inWSP := false
+	for _, c := range line {
+		if c == ' ' || c == '\t' {
+			if !inWSP {
+				collapsed = append(collapsed, ' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		collapsed = append(collapsed, c)
+	}
+	return collapsed
+}
+
+// removeSignatureValue empties the value of b= tag within a raw DKIM-Signature header
+func removeSignatureValue(raw string) string {
+	colon := strings.Index(raw, ":")
+	tags := strings.Split(raw[colon+1:], ";")
+	for i, tag := range tags {
+		eq := strings.Index(tag, "=")
+		if eq > 0 && stripWhitespaces(tag[:eq]) == "b" {
+			tags[i] = tag[:eq+1]
+		}
+	}
+	return raw[:colon+1] + strings.Join(tags, ";")
+}
+
+// parseTagList parses a `tag=value; tag=value` list
+func parseTagList(list string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, spec := range strings.Split(list, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		eq := strings.Index(spec, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid tag %q", strings.TrimSpace(spec))
+		}
+		name := strings.TrimSpace(spec[:eq])
+		if _, found := tags[name]; found {
+			return nil, fmt.Errorf("duplicate tag %s", name)
+		}
+		tags[name] = strings.TrimSpace(spec[eq+1:])
+	}
+	return tags, nil
+}
+
+func stripWhitespaces(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
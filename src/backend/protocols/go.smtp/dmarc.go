@@ -0,0 +1,258 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"net/mail"
+	"strings"
+)
+
+// Domain-based Message Authentication, Reporting and Conformance, see https://tools.ietf.org/html/rfc7489
+// Policy and organizational domains are found by walking up DNS tree, as DMARCbis does,
+// instead of relying on a public suffix list.
+const dmarcMaxLabels = 8 // longest domain queried while walking up DNS tree
+
+// dmarcResult is the outcome of DMARC evaluation of an email
+type dmarcResult struct {
+	Result string // AuthNone, AuthPass, AuthFail, AuthTempError or AuthPermError
+	From   string // domain of From header
+	Policy string // requested policy for failing emails : none, quarantine or reject
+	Reason string
+}
+
+// dmarcRecord is a parsed DMARC policy record
+type dmarcRecord struct {
+	Domain          string // where record was found
+	Policy          string // p= tag
+	SubdomainPolicy string // sp= tag, defaults to p=
+	StrictDKIM      bool   // adkim=s
+	StrictSPF       bool   // aspf=s
+	PSD             string // psd= tag : y, n or empty
+}
+
+type dmarcChecker struct {
+	ctx      context.Context
+	resolver DNSResolver
+	records  map[string]*dmarcRecord // records found at _dmarc.<domain>, nil if none
+}
+
+// checkDMARC evaluates DMARC policy of From header's domain against SPF and DKIM results
+func checkDMARC(ctx context.Context, resolver DNSResolver, headers []emailHeader, spf *spfResult, dkim []*dkimResult) *dmarcResult {
+	res := &dmarcResult{}
+	fromDomain, err := headerFromDomain(headers)
+	if err != nil {
+		res.Result = AuthPermError
+		res.Reason = err.Error()
+		return res
+	}
+	res.From = fromDomain
+
+	checker := &dmarcChecker{ctx: ctx, resolver: resolver, records: map[string]*dmarcRecord{}}
+	record, err := checker.policyRecord(fromDomain)
+	if err != nil {
+		res.Result = AuthTempError
+		res.Reason = err.Error()
+		return res
+	}
+	if record == nil {
+		res.Result = AuthNone
+		return res
+	}
+	res.Policy = record.Policy
+	if record.Domain != fromDomain {
+		res.Policy = record.SubdomainPolicy
+	}
+
+	fromOrg, err := checker.organizationalDomain(fromDomain)
+	if err != nil {
+		res.Result = AuthTempError
+		res.Reason = err.Error()
+		return res
+	}
+	aligned := func(domain string, strict bool) (bool, error) {
+		if strings.EqualFold(domain, fromDomain) {
+			return true, nil
+		}
+		if strict || domain == "" {
+			return false, nil
+		}
+		org, err := checker.organizationalDomain(strings.ToLower(domain))
+		return org == fromOrg, err
+	}
+
+	for _, signature := range dkim {
+		if signature.Result != AuthPass {
+			continue
+		}
+		ok, err := aligned(signature.Domain, record.StrictDKIM)
+		if err != nil {
+			res.Result = AuthTempError
+			res.Reason = err.Error()
+			return res
+		}
+		if ok {
+			res.Result = AuthPass
+			res.Reason = "DKIM signature of " + signature.Domain + " is aligned"
+			return res
+		}
+	}
+	if spf != nil && spf.Result == AuthPass {
+		ok, err := aligned(spf.Domain, record.StrictSPF)
+		if err != nil {
+			res.Result = AuthTempError
+			res.Reason = err.Error()
+			return res
+		}
+		if ok {
+			res.Result = AuthPass
+			res.Reason = "SPF of " + spf.Domain + " is aligned"
+			return res
+		}
+	}
+	res.Result = AuthFail
+	res.Reason = "no aligned SPF or DKIM identifier"
+	return res
+}
+
+// headerFromDomain returns the domain of the single address of From header
+func headerFromDomain(headers []emailHeader) (string, error) {
+	var from *emailHeader
+	for i, header := range headers {
+		if strings.EqualFold(header.Name, "From") {
+			if from != nil {
+				return "", errors.New("several From headers")
+			}
+			from = &headers[i]
+		}
+	}
+	if from == nil {
+		return "", errors.New("no From header")
+	}
+	addresses, err := mail.ParseAddressList(from.Value())
+	if err != nil || len(addresses) != 1 {
+		return "", fmt.Errorf("From header must hold a single valid address")
+	}
+	at := strings.LastIndex(addresses[0].Address, "@")
+	domain := strings.ToLower(addresses[0].Address[at+1:])
+	if at < 0 || !validDomain(domain) {
+		return "", fmt.Errorf("invalid From domain %s", domain)
+	}
+	return domain, nil
+}
+
+// treeWalk returns domain followed by its parents, shortened to dmarcMaxLabels labels, up to top-level domain
+func treeWalk(domain string) []string {
+	labels := strings.Split(domain, ".")
+	walk := []string{domain}
+	start := 1
+	if len(labels) > dmarcMaxLabels {
+		start = len(labels) - dmarcMaxLabels
+	}
+	for i := start; i < len(labels); i++ {
+		walk = append(walk, strings.Join(labels[i:], "."))
+	}
+	return walk
+}
+
+// policyRecord returns the closest DMARC record found walking up from domain, nil if there is none
+func (c *dmarcChecker) policyRecord(domain string) (*dmarcRecord, error) {
+	for _, candidate := range treeWalk(domain) {
+		record, err := c.lookupRecord(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// organizationalDomain finds domain's organizational domain :
+// the domain holding a record with psd=n, the child of the one holding a record with psd=y,
+// or the shortest one with a record. Domain itself if no record is found.
+func (c *dmarcChecker) organizationalDomain(domain string) (string, error) {
+	walk := treeWalk(domain)
+	org := domain
+	for i, candidate := range walk {
+		record, err := c.lookupRecord(candidate)
+		if err != nil {
+			return "", err
+		}
+		if record == nil {
+			continue
+		}
+		switch record.PSD {
+		case "n":
+			return candidate, nil
+		case "y":
+			if i == 0 {
+				return candidate, nil
+			}
+			return walk[i-1], nil
+		}
+		org = candidate
+	}
+	return org, nil
+}
+
+// lookupRecord returns the DMARC record published at _dmarc.<domain>, nil if there is none or if it is invalid
+func (c *dmarcChecker) lookupRecord(domain string) (*dmarcRecord, error) {
+	if record, found := c.records[domain]; found {
+		return record, nil
+	}
+	txts, err := c.resolver.LookupTXT(c.ctx, "_dmarc."+domain)
+	if err != nil && isTemporaryDNSError(err) {
+		return nil, err
+	}
+	var record *dmarcRecord
+	for _, txt := range txts {
+		if !strings.HasPrefix(strings.ToUpper(strings.Replace(txt, " ", "", -1)), "V=DMARC1") {
+			continue
+		}
+		if record != nil {
+			// several records : none applies
+			record = nil
+			break
+		}
+		record = parseDMARCRecord(domain, txt)
+	}
+	c.records[domain] = record
+	return record, nil
+}
+
+// parseDMARCRecord returns nil if txt is not a valid DMARC record
+func parseDMARCRecord(domain, txt string) *dmarcRecord {
+	tags, err := parseTagList(txt)
+	if err != nil || tags["v"] != "DMARC1" {
+		return nil
+	}
+	record := &dmarcRecord{
+		Domain: domain,
+		Policy: strings.ToLower(tags["p"]),
+		PSD:    strings.ToLower(tags["psd"]),
+	}
+	switch record.Policy {
+	case "none", "quarantine", "reject":
+	default:
+		// invalid or missing policy is processed as none when a rua tag exists, record is discarded otherwise
+		if tags["rua"] == "" {
+			return nil
+		}
+		record.Policy = "none"
+	}
+	record.SubdomainPolicy = record.Policy
+	switch sp := strings.ToLower(tags["sp"]); sp {
+	case "none", "quarantine", "reject":
+		record.SubdomainPolicy = sp
+	}
+	record.StrictDKIM = strings.ToLower(tags["adkim"]) == "s"
+	record.StrictSPF = strings.ToLower(tags["aspf"]) == "s"
+	return record
+}
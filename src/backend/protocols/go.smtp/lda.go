@@ -9,6 +9,7 @@ package caliopen_smtp
 import (
 	broker "github.com/CaliOpen/Caliopen/src/backend/brokers/go.emails"
 	log "github.com/Sirupsen/logrus"
+	"net"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -21,10 +22,12 @@ type Lda struct {
 	brokerConnectors broker.EmailBrokerConnectors
 	inboundListener  *Server
 	outboundListener *submitter
+	resolver         DNSResolver // for sender authentication checks
 }
 
 func (lda *Lda) initialize(config SMTPConfig) (err error) {
 	lda.Config = config
+	lda.resolver = net.DefaultResolver
 	lda.broker, lda.brokerConnectors, err = broker.Initialize(config.LDAConfig)
 	return err
 }
@@ -47,7 +47,8 @@ type Server struct {
 	// Can be left empty for no authentication support.
 	Authenticator func(peer Peer, username, password string) error
 
-	EnableXCLIENT bool // Enable XCLIENT support (default: false)
+	EnableXCLIENT bool         // Enable XCLIENT support (default: false)
+	XCLIENTPeers  []*net.IPNet // Networks of the MTAs allowed to use XCLIENT, none if empty
 
 	TLSConfig *tls.Config // Enable STARTTLS support.
 	ForceTLS  bool        // Force STARTTLS usage.
@@ -72,6 +73,7 @@ type Peer struct {
 	ServerName string               // A copy of Server.Hostname
 	Addr       net.Addr             // Network address
 	TLS        *tls.ConnectionState // TLS Connection details, if on TLS
+	Relay      bool                 // Peer is a trusted MTA relaying its client's emails, until it gives client's address with XCLIENT
 }
 
 // Error represents an Error reported in the SMTP session.
@@ -108,6 +110,7 @@ func (srv *Server) newSession(c net.Conn) (s *session) {
 		peer: Peer{
 			Addr:       c.RemoteAddr(),
 			ServerName: srv.Hostname,
+			Relay:      srv.xclientAllowed(c.RemoteAddr()),
 		},
 	}
 
@@ -128,6 +131,14 @@ func (srv *Server) initialize(conf SMTPConfig) error {
 	srv.ForceTLS = conf.AppConfig.Servers[0].TLSAlwaysOn
 	srv.MaxConnections = conf.AppConfig.Servers[0].MaxClients
 	srv.MaxMessageSize = int(conf.AppConfig.Servers[0].MaxSize)
+	srv.EnableXCLIENT = conf.AppConfig.Servers[0].EnableXCLIENT
+	for _, peer := range conf.AppConfig.Servers[0].XCLIENTPeers {
+		network, err := parseNetwork(peer)
+		if err != nil {
+			return fmt.Errorf("unable to init smtpd : invalid xclient peer %s", peer)
+		}
+		srv.XCLIENTPeers = append(srv.XCLIENTPeers, network)
+	}
 	srv.Handler = lda.handler
 
 	return nil
@@ -330,7 +341,7 @@ func (session *session) extensions() []string {
 		"PIPELINING",
 	}
 
-	if session.server.EnableXCLIENT {
+	if session.server.xclientAllowed(session.conn.RemoteAddr()) {
 		extensions = append(extensions, "XCLIENT")
 	}
 
@@ -358,3 +369,39 @@ func (session *session) close() {
 	time.Sleep(200 * time.Millisecond)
 	session.conn.Close()
 }
+
+// xclientAllowed tells if XCLIENT is enabled and addr is the one of a trusted MTA.
+// The MTA's emails are relayed ones : their client is only known if it gives it with XCLIENT.
+func (srv *Server) xclientAllowed(addr net.Addr) bool {
+	if !srv.EnableXCLIENT {
+		return false
+	}
+	ip := peerIP(Peer{Addr: addr})
+	if ip == nil {
+		return false
+	}
+	for _, network := range srv.XCLIENTPeers {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetwork parses an IP address or a CIDR network
+func parseNetwork(value string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %s", value)
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	} else {
+		ip = ip.To4()
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
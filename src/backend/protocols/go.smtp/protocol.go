@@ -495,6 +495,12 @@ func (session *session) handleXCLIENT(cmd command) {
 		return
 	}
 
+	// session's peer may already be the client given by a previous command, the MTA is the connection's one
+	if !session.server.xclientAllowed(session.conn.RemoteAddr()) {
+		session.reply(550, "Insufficient authorization")
+		return
+	}
+
 	var (
 		newHeloName          = ""
 		newAddr     net.IP   = nil
@@ -557,11 +563,14 @@ func (session *session) handleXCLIENT(cmd command) {
 
 	}
 
-	tcpAddr, ok := session.peer.Addr.(*net.TCPAddr)
+	peerAddr, ok := session.peer.Addr.(*net.TCPAddr)
 	if !ok {
 		session.reply(502, "Unsupported network connection")
 		return
 	}
+	// connection's address must be left untouched
+	tcpAddr := *peerAddr
+	session.peer.Addr = &tcpAddr
 
 	if newHeloName != "" {
 		session.peer.HeloName = newHeloName
@@ -583,6 +592,11 @@ func (session *session) handleXCLIENT(cmd command) {
 		session.peer.Protocol = newProto
 	}
 
+	// peer is now the client of MTA, if MTA gave its address
+	if newAddr != nil {
+		session.peer.Relay = false
+	}
+
 	session.welcome()
 
 }
@@ -14,7 +14,20 @@ import (
 // handler is called by smtpd for each incoming email
 func (lda *Lda) handler(peer Peer, ev SmtpEnvelope) error {
 	var raw_email bytes.Buffer
-	raw_email.WriteString(string(ev.Data))
+	message := &Message{}
+	if lda.Config.AppConfig.CheckSenderAuth {
+		authServId := lda.Config.AppConfig.AuthServId
+		if authServId == "" {
+			authServId = peer.ServerName
+		}
+		results := checkAuthentication(lda.resolver, authServId, peer, ev, time.Now())
+		features := PrivacyFeatures{}
+		results.AddTo(&features)
+		message.Privacy_features = &features
+		raw_email.Write(results.Apply(ev.Data))
+	} else {
+		raw_email.WriteString(string(ev.Data))
+	}
 
 	emailMessage := EmailMessage{
 		Email: &Email{
@@ -22,7 +35,7 @@ func (lda *Lda) handler(peer Peer, ev SmtpEnvelope) error {
 			SmtpRcpTo:    ev.Recipients,
 			Raw:          raw_email,
 		},
-		Message: &Message{},
+		Message: message,
 	}
 	incoming := &broker.SmtpEmail{
 		EmailMessage: &emailMessage,
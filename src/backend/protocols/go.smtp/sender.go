@@ -0,0 +1,179 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gopkg.in/gomail.v2"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpSender submits emails to a MTA the way gomail's sender does,
+// but it asks MTA to put message's envelope id into delivery status notifications (RFC 3461).
+type smtpSender struct {
+	*smtp.Client
+	d *gomail.Dialer
+}
+
+// loginAuth implements LOGIN authentication mechanism, for MTAs that do not offer PLAIN
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// dialMTA connects and authenticates to MTA with dialer's parameters, as gomail.Dialer.Dial does
+func dialMTA(d *gomail.Dialer) (*smtpSender, error) {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", d.Host, d.Port), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if d.SSL {
+		conn = tls.Client(conn, dialerTLSConfig(d))
+	}
+	c, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.LocalName != "" {
+		if err = c.Hello(d.LocalName); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if !d.SSL {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(dialerTLSConfig(d)); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+	auth := d.Auth
+	if auth == nil && d.Username != "" {
+		if ok, auths := c.Extension("AUTH"); ok {
+			if strings.Contains(auths, "CRAM-MD5") {
+				auth = smtp.CRAMMD5Auth(d.Username, d.Password)
+			} else if strings.Contains(auths, "LOGIN") && !strings.Contains(auths, "PLAIN") {
+				auth = &loginAuth{username: d.Username, password: d.Password, host: d.Host}
+			} else {
+				auth = smtp.PlainAuth("", d.Username, d.Password, d.Host)
+			}
+		}
+	}
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return &smtpSender{Client: c, d: d}, nil
+}
+
+func dialerTLSConfig(d *gomail.Dialer) *tls.Config {
+	if d.TLSConfig == nil {
+		return &tls.Config{ServerName: d.Host}
+	}
+	return d.TLSConfig
+}
+
+// Send submits email to MTA, with envid as ENVID if MTA supports DSN extension.
+// Connection is dialed again if MTA closed it in the meantime.
+func (s *smtpSender) Send(from string, to []string, envid string, msg io.WriterTo) error {
+	if err := s.mail(from, envid); err != nil {
+		if err == io.EOF {
+			// probably a timeout, reconnect and try again
+			if sender, e := dialMTA(s.d); e == nil {
+				*s = *sender
+				return s.Send(from, to, envid, msg)
+			}
+		}
+		return err
+	}
+	for _, addr := range to {
+		if err := s.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := s.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// mail sends MAIL command. With DSN extension, it asks for reports holding only original message's headers
+// and carrying envid, which is known to be made of xtext safe chars (see email_broker.EnvelopeId).
+func (s *smtpSender) mail(from, envid string) error {
+	if ok, _ := s.Extension("DSN"); !ok || envid == "" {
+		return s.Mail(from)
+	}
+	if strings.ContainsAny(from+envid, "\r\n") {
+		return errors.New("smtp: a line must not contain CR or LF")
+	}
+	// net/smtp's Mail can't take DSN parameters
+	cmd := "MAIL FROM:<%s> RET=HDRS ENVID=%s"
+	if ok, _ := s.Extension("8BITMIME"); ok {
+		cmd += " BODY=8BITMIME"
+	}
+	id, err := s.Text.Cmd(cmd, from, envid)
+	if err != nil {
+		return err
+	}
+	s.Text.StartResponse(id)
+	defer s.Text.EndResponse(id)
+	_, _, err = s.Text.ReadResponse(250)
+	return err
+}
+
+// Close ends session with MTA
+func (s *smtpSender) Close() error {
+	return s.Quit()
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		advertised := false
+		for _, mechanism := range server.Auth {
+			if mechanism == "LOGIN" {
+				advertised = true
+				break
+			}
+		}
+		if !advertised {
+			return "", nil, errors.New("smtp: unencrypted connection")
+		}
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("smtp: wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.Equal(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.Equal(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("smtp: unexpected server challenge: %s", fromServer)
+	}
+}
@@ -0,0 +1,471 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package caliopen_smtp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Sender Policy Framework, see https://tools.ietf.org/html/rfc7208
+const (
+	spfMaxLookups     = 10 // DNS querying mechanisms and modifiers allowed within an evaluation
+	spfMaxVoidLookups = 2  // lookups returning no answer allowed within an evaluation
+)
+
+var errSPFLimit = errors.New("too many DNS lookups")
+
+// spfResult is the outcome of an SPF evaluation
+type spfResult struct {
+	Result string // AuthNone, AuthPass, AuthFail…
+	Domain string // domain of MAIL FROM identity (or HELO identity if MAIL FROM is empty)
+	Sender string // identity checked, ie MAIL FROM address or postmaster@<HELO>
+	Reason string
+}
+
+type spfChecker struct {
+	ctx         context.Context
+	resolver    DNSResolver
+	ip          net.IP
+	helo        string
+	sender      string
+	lookups     int
+	voidLookups int
+}
+
+// checkSPF evaluates SPF policy of sender's domain against client's ip
+func checkSPF(ctx context.Context, resolver DNSResolver, ip net.IP, helo, mailFrom string) *spfResult {
+	sender := mailFrom
+	if sender == "" {
+		sender = "postmaster@" + helo
+	}
+	at := strings.LastIndex(sender, "@")
+	if at < 0 {
+		sender = "postmaster@" + sender
+		at = strings.LastIndex(sender, "@")
+	}
+	domain := strings.ToLower(strings.TrimSuffix(sender[at+1:], "."))
+	res := &spfResult{Domain: domain, Sender: sender}
+	if ip == nil || !validDomain(domain) {
+		res.Result = AuthNone
+		res.Reason = "no valid identity to check"
+		return res
+	}
+
+	checker := &spfChecker{ctx: ctx, resolver: resolver, ip: ip, helo: helo, sender: sender}
+	result, err := checker.checkHost(domain)
+	res.Result = result
+	if err != nil {
+		res.Reason = err.Error()
+	}
+	return res
+}
+
+// checkHost is the check_host() function of RFC 7208
+func (c *spfChecker) checkHost(domain string) (string, error) {
+	record, err := c.lookupRecord(domain)
+	if err != nil || record == "" {
+		return spfRecordError(err)
+	}
+
+	var redirect string
+	for _, term := range strings.Fields(record)[1:] {
+		if eq := strings.Index(term, "="); eq > 0 && !strings.ContainsAny(term[:eq], ":/") {
+			// modifier
+			name, value := strings.ToLower(term[:eq]), term[eq+1:]
+			if name == "redirect" {
+				if redirect != "" {
+					return AuthPermError, errors.New("several redirect modifiers")
+				}
+				redirect = value
+			}
+			continue
+		}
+		qualifier := AuthPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			qualifier, term = AuthFail, term[1:]
+		case '~':
+			qualifier, term = AuthSoftFail, term[1:]
+		case '?':
+			qualifier, term = AuthNeutral, term[1:]
+		}
+		match, result, err := c.matchMechanism(term, domain)
+		if err != nil {
+			return result, err
+		}
+		if match {
+			return qualifier, nil
+		}
+	}
+
+	if redirect != "" {
+		target, err := c.expandDomain(redirect, domain)
+		if err != nil {
+			return AuthPermError, err
+		}
+		if err := c.countLookup(); err != nil {
+			return AuthPermError, err
+		}
+		result, err := c.checkHost(target)
+		if result == AuthNone {
+			return AuthPermError, fmt.Errorf("no SPF record for redirect domain %s", target)
+		}
+		return result, err
+	}
+	return AuthNeutral, nil
+}
+
+// lookupRecord returns the SPF record of domain, or an empty string if there is none
+func (c *spfChecker) lookupRecord(domain string) (string, error) {
+	txts, err := c.resolver.LookupTXT(c.ctx, domain)
+	if err != nil && isTemporaryDNSError(err) {
+		return "", err
+	}
+	record := ""
+	for _, txt := range txts {
+		if strings.EqualFold(txt, "v=spf1") || strings.HasPrefix(strings.ToLower(txt), "v=spf1 ") {
+			if record != "" {
+				return "", errors.New("several SPF records")
+			}
+			record = txt
+		}
+	}
+	return record, nil
+}
+
+func spfRecordError(err error) (string, error) {
+	switch {
+	case err == nil:
+		return AuthNone, nil
+	case isTemporaryDNSError(err):
+		return AuthTempError, err
+	default:
+		return AuthPermError, err
+	}
+}
+
+// matchMechanism tells if client's ip matches mechanism.
+// result is only meaningful when an error is returned.
+func (c *spfChecker) matchMechanism(term, domain string) (match bool, result string, err error) {
+	name, arg := term, ""
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, arg = term[:i], term[i:]
+	}
+	name = strings.ToLower(name)
+	switch name {
+	case "all":
+		return true, "", nil
+	case "include":
+		target, err := c.mechanismDomain(arg, domain, false)
+		if err != nil {
+			return false, AuthPermError, err
+		}
+		if err := c.countLookup(); err != nil {
+			return false, AuthPermError, err
+		}
+		result, err := c.checkHost(target)
+		switch result {
+		case AuthPass:
+			return true, "", nil
+		case AuthTempError:
+			return false, AuthTempError, err
+		case AuthNone:
+			return false, AuthPermError, fmt.Errorf("no SPF record for included domain %s", target)
+		case AuthPermError:
+			return false, AuthPermError, err
+		}
+		return false, "", nil
+	case "a", "mx":
+		spec, cidr4, cidr6, err := splitCIDR(arg)
+		if err != nil {
+			return false, AuthPermError, err
+		}
+		target, err := c.mechanismDomain(spec, domain, true)
+		if err != nil {
+			return false, AuthPermError, err
+		}
+		if err := c.countLookup(); err != nil {
+			return false, AuthPermError, err
+		}
+		hosts := []string{target}
+		if name == "mx" {
+			mxs, err := c.resolver.LookupMX(c.ctx, target)
+			if err != nil && isTemporaryDNSError(err) {
+				return false, AuthTempError, err
+			}
+			if len(mxs) > spfMaxLookups {
+				return false, AuthPermError, errSPFLimit
+			}
+			if len(mxs) == 0 {
+				if err := c.countVoidLookup(); err != nil {
+					return false, AuthPermError, err
+				}
+			}
+			hosts = hosts[:0]
+			for _, mx := range mxs {
+				hosts = append(hosts, mx.Host)
+			}
+		}
+		for _, host := range hosts {
+			addrs, err := c.resolver.LookupIPAddr(c.ctx, host)
+			if err != nil && isTemporaryDNSError(err) {
+				return false, AuthTempError, err
+			}
+			if len(addrs) == 0 && name == "a" {
+				if err := c.countVoidLookup(); err != nil {
+					return false, AuthPermError, err
+				}
+			}
+			for _, addr := range addrs {
+				if ipMatch(c.ip, addr.IP, cidr4, cidr6) {
+					return true, "", nil
+				}
+			}
+		}
+		return false, "", nil
+	case "ip4", "ip6":
+		if !strings.HasPrefix(arg, ":") {
+			return false, AuthPermError, fmt.Errorf("invalid mechanism %s", term)
+		}
+		network := arg[1:]
+		if !strings.Contains(network, "/") {
+			if name == "ip4" {
+				network += "/32"
+			} else {
+				network += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil || (name == "ip4") != (ipNet.IP.To4() != nil) {
+			return false, AuthPermError, fmt.Errorf("invalid mechanism %s", term)
+		}
+		return ipNet.Contains(c.ip), "", nil
+	case "exists":
+		target, err := c.mechanismDomain(arg, domain, false)
+		if err != nil {
+			return false, AuthPermError, err
+		}
+		if err := c.countLookup(); err != nil {
+			return false, AuthPermError, err
+		}
+		addrs, err := c.resolver.LookupIPAddr(c.ctx, target)
+		if err != nil && isTemporaryDNSError(err) {
+			return false, AuthTempError, err
+		}
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				return true, "", nil
+			}
+		}
+		if err := c.countVoidLookup(); err != nil {
+			return false, AuthPermError, err
+		}
+		return false, "", nil
+	case "ptr":
+		// deprecated by RFC 7208, counted but never matched
+		if err := c.countLookup(); err != nil {
+			return false, AuthPermError, err
+		}
+		return false, "", nil
+	}
+	return false, AuthPermError, fmt.Errorf("unknown mechanism %s", term)
+}
+
+// mechanismDomain returns the expanded domain-spec of a mechanism's argument, or current domain if there is none
+func (c *spfChecker) mechanismDomain(arg, domain string, optional bool) (string, error) {
+	if !strings.HasPrefix(arg, ":") {
+		if optional && arg == "" {
+			return domain, nil
+		}
+		return "", fmt.Errorf("missing domain in mechanism argument %q", arg)
+	}
+	return c.expandDomain(arg[1:], domain)
+}
+
+func (c *spfChecker) countLookup() error {
+	c.lookups++
+	if c.lookups > spfMaxLookups {
+		return errSPFLimit
+	}
+	return nil
+}
+
+func (c *spfChecker) countVoidLookup() error {
+	c.voidLookups++
+	if c.voidLookups > spfMaxVoidLookups {
+		return errors.New("too many void DNS lookups")
+	}
+	return nil
+}
+
+// splitCIDR splits `a` and `mx` mechanisms' argument into domain-spec and dual-cidr-length
+func splitCIDR(arg string) (spec string, cidr4, cidr6 int, err error) {
+	cidr4, cidr6 = 32, 128
+	spec = arg
+	if i := strings.Index(arg, "//"); i >= 0 {
+		if cidr6, err = strconv.Atoi(arg[i+2:]); err != nil || cidr6 < 0 || cidr6 > 128 {
+			return "", 0, 0, fmt.Errorf("invalid ip6 cidr length in %s", arg)
+		}
+		spec = arg[:i]
+	}
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		if cidr4, err = strconv.Atoi(spec[i+1:]); err != nil || cidr4 < 0 || cidr4 > 32 {
+			return "", 0, 0, fmt.Errorf("invalid ip4 cidr length in %s", arg)
+		}
+		spec = spec[:i]
+	}
+	return spec, cidr4, cidr6, nil
+}
+
+// ipMatch tells if ip is within the network of addr with the cidr length matching its family
+func ipMatch(ip, addr net.IP, cidr4, cidr6 int) bool {
+	if ip4, addr4 := ip.To4(), addr.To4(); ip4 != nil || addr4 != nil {
+		if ip4 == nil || addr4 == nil {
+			return false
+		}
+		mask := net.CIDRMask(cidr4, 32)
+		return ip4.Mask(mask).Equal(addr4.Mask(mask))
+	}
+	mask := net.CIDRMask(cidr6, 128)
+	return ip.Mask(mask).Equal(addr.Mask(mask))
+}
+
+// expandDomain expands macros of a domain-spec, see RFC 7208 section 7
+func (c *spfChecker) expandDomain(spec, domain string) (string, error) {
+	expanded := new(strings.Builder)
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			expanded.WriteByte(spec[i])
+			continue
+		}
+		if i+1 >= len(spec) {
+			return "", fmt.Errorf("invalid macro in %s", spec)
+		}
+		i++
+		switch spec[i] {
+		case '%':
+			expanded.WriteByte('%')
+			continue
+		case '_':
+			expanded.WriteByte(' ')
+			continue
+		case '-':
+			expanded.WriteString("%20")
+			continue
+		case '{':
+		default:
+			return "", fmt.Errorf("invalid macro in %s", spec)
+		}
+		end := strings.IndexByte(spec[i:], '}')
+		if end < 2 {
+			return "", fmt.Errorf("invalid macro in %s", spec)
+		}
+		value, err := c.macroValue(spec[i+1:i+end], domain)
+		if err != nil {
+			return "", err
+		}
+		expanded.WriteString(value)
+		i += end
+	}
+	target := strings.TrimSuffix(expanded.String(), ".")
+	// domain is truncated from the left to fit into 253 characters
+	for len(target) > 253 {
+		dot := strings.IndexByte(target, '.')
+		if dot < 0 {
+			break
+		}
+		target = target[dot+1:]
+	}
+	if !validDomain(target) {
+		return "", fmt.Errorf("invalid domain %q", target)
+	}
+	return target, nil
+}
+
+// macroValue expands a single macro, ie the content of %{…}
+func (c *spfChecker) macroValue(macro, domain string) (string, error) {
+	at := strings.LastIndex(c.sender, "@")
+	var value string
+	switch strings.ToLower(macro[:1]) {
+	case "s":
+		value = c.sender
+	case "l":
+		value = c.sender[:at]
+	case "o":
+		value = c.sender[at+1:]
+	case "d":
+		value = domain
+	case "i":
+		if ip4 := c.ip.To4(); ip4 != nil {
+			value = ip4.String()
+		} else {
+			nibbles := make([]string, 0, 32)
+			for _, b := range c.ip.To16() {
+				nibbles = append(nibbles, strconv.FormatInt(int64(b>>4), 16), strconv.FormatInt(int64(b&0xf), 16))
+			}
+			value = strings.Join(nibbles, ".")
+		}
+	case "v":
+		value = "in-addr"
+		if c.ip.To4() == nil {
+			value = "ip6"
+		}
+	case "h":
+		value = c.helo
+	default:
+		// p macro (validated domain name of ip) is not supported, as ptr mechanism
+		return "", fmt.Errorf("unsupported macro %%{%s}", macro)
+	}
+
+	transformers := macro[1:]
+	digits := 0
+	for len(transformers) > 0 && transformers[0] >= '0' && transformers[0] <= '9' {
+		digits = digits*10 + int(transformers[0]-'0')
+		transformers = transformers[1:]
+	}
+	reverse := false
+	if len(transformers) > 0 && (transformers[0] == 'r' || transformers[0] == 'R') {
+		reverse, transformers = true, transformers[1:]
+	}
+	delimiters := "."
+	if transformers != "" {
+		if strings.Trim(transformers, ".-+,/_=") != "" {
+			return "", fmt.Errorf("invalid macro %%{%s}", macro)
+		}
+		delimiters = transformers
+	}
+	parts := strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(delimiters, r) })
+	if reverse {
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+	}
+	if digits > 0 && digits < len(parts) {
+		parts = parts[len(parts)-digits:]
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// validDomain checks that domain has at least two labels, none of them being empty or too long
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 || len(domain) > 253 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
@@ -6,15 +6,12 @@ package caliopen_smtp
 
 import (
 	"bytes"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	broker "github.com/CaliOpen/Caliopen/src/backend/brokers/go.emails"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	log "github.com/Sirupsen/logrus"
 	"gopkg.in/gomail.v2"
-	"io"
-	"net/smtp"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,23 +25,6 @@ type submitter struct {
 	submitChan      chan *broker.SmtpEmail
 }
 
-type smtpSender struct {
-	smtpClient
-	d *gomail.Dialer
-}
-
-type smtpClient interface {
-	Hello(string) error
-	Extension(string) (bool, string)
-	StartTLS(*tls.Config) error
-	Auth(smtp.Auth) error
-	Mail(string) error
-	Rcpt(string) error
-	Data() (io.WriteCloser, error)
-	Quit() error
-	Close() error
-}
-
 func (lda *Lda) newSubmitter() (submit *submitter, err error) {
 
 	submit = &submitter{}
@@ -85,8 +65,8 @@ func (lda *Lda) OutboundWorker() {
 		lda.outboundListener.workersCountMux.Unlock()
 	}()
 
-	var smtp_sender gomail.SendCloser
-	var smtp_remote_sender gomail.SendCloser
+	var smtp_sender *smtpSender
+	var smtp_remote_sender *smtpSender
 	var err error
 	open := false
 	for {
@@ -99,6 +79,7 @@ func (lda *Lda) OutboundWorker() {
 
 			from := outcoming.EmailMessage.Email.SmtpMailFrom[0] //TODO: manage multiple senders
 			to := outcoming.EmailMessage.Email.SmtpRcpTo
+			envid := outcoming.EmailMessage.Email.EnvelopeId
 			var raw bytes.Buffer
 			raw.WriteString((&outcoming.EmailMessage.Email.Raw).String())
 
@@ -135,25 +116,26 @@ func (lda *Lda) OutboundWorker() {
 				}
 
 				if dialErr == nil {
-					smtp_remote_sender, dialErr = remoteDialer.Dial()
+					smtp_remote_sender, dialErr = dialMTA(remoteDialer)
 				}
 				if dialErr != nil {
 					err = fmt.Errorf("outbound: unable to connect to remote MTA with error : %s", dialErr)
 				} else {
-					err = smtp_remote_sender.Send(from, to, &raw)
+					err = smtp_remote_sender.Send(from, to, envid, &raw)
+					smtp_remote_sender.Close()
 				}
 			} else {
 				// no MTA params means submitter has to go through the configured local MTA
 				if !open {
 					var dialErr error
-					if smtp_sender, dialErr = d.Dial(); dialErr != nil {
+					if smtp_sender, dialErr = dialMTA(d); dialErr != nil {
 						err = fmt.Errorf("outbound: unable to connect to MTA with error : %s", dialErr)
 					} else {
 						open = true
 					}
 				}
 				if err == nil {
-					err = smtp_sender.Send(from, to, &raw)
+					err = smtp_sender.Send(from, to, envid, &raw)
 				}
 			}
 
@@ -45,6 +45,7 @@ const (
 	PollDM = uint(iota)
 	PollTimeLine
 	Stop
+	ResetSync // forget sync state, then poll DMs
 
 	lastSeenInfosKey = "lastseendm"
 	lastSyncInfosKey = "lastsync"
@@ -146,6 +147,9 @@ func (worker *AccountHandler) Start() {
 		switch command {
 		case PollDM:
 			worker.PollDM()
+		case ResetSync:
+			worker.ResetSyncState()
+			worker.PollDM()
 		case Stop:
 			worker.Stop(true)
 		default:
@@ -167,6 +171,24 @@ func (worker *AccountHandler) Stop(closeDesk bool) {
 	}
 }
 
+// ResetSyncState forgets last DM seen and errors, so that next poll will fetch all available DMs
+func (worker *AccountHandler) ResetSyncState() {
+	worker.lastDMseen = "0"
+	userId, remoteId := worker.userAccount.userID.String(), worker.userAccount.remoteID.String()
+	accountInfos, err := worker.broker.Store.RetrieveRemoteInfosMap(userId, remoteId)
+	if err != nil {
+		log.WithError(err).Warnf("[AccountHandler %s] ResetSyncState failed to retrieve infos map", remoteId)
+		return
+	}
+	for _, key := range []string{lastSeenInfosKey, lastSyncInfosKey, lastErrorKey, dateFirstErrorKey, dateLastErrorKey, errorsCountKey} {
+		delete(accountInfos, key)
+	}
+	err = worker.broker.Store.UpdateRemoteInfosMap(userId, remoteId, accountInfos)
+	if err != nil {
+		log.WithError(err).Warnf("[AccountHandler %s] ResetSyncState failed to update infos map", remoteId)
+	}
+}
+
 // PollDM calls Twitter API endpoint to fetch DMs
 // it passes unseen DM to its embedded broker
 func (worker *AccountHandler) PollDM() {
@@ -26,18 +26,31 @@ func (w *Worker) WorkerMsgHandler(msg *nats.Msg) {
 	switch message.Order {
 	case noPendingJobErr:
 		return
-	case "sync":
-		log.Infof("received sync order for remote twitter ID %s", message.IdentityId)
+	case "sync", "reset_sync":
+		log.Infof("received %s order for remote twitter ID %s", message.Order, message.IdentityId)
+		started := time.Now()
+		command := PollDM
+		if message.Order == "reset_sync" {
+			command = ResetSync
+		}
 		if accountWorker := w.getOrCreateHandler(message.UserId, message.IdentityId); accountWorker != nil {
 			select {
-			case accountWorker.WorkerDesk <- PollDM:
+			case accountWorker.WorkerDesk <- command:
 				log.Infof("[DMmsgHandler] ordering to pollDM for remote %s (user %s)", message.IdentityId, message.UserId)
+				w.publishJobStatus(message, started, nil)
+				w.reportJob(message, nil)
 			case <-time.After(30 * time.Second):
 				log.Warnf("[DMmsgHandler] worker's desk is full for remote %s (user %s)", message.IdentityId, message.UserId)
+				err = errors.New("worker's desk is full")
+				w.publishJobStatus(message, started, err)
+				w.reportJob(message, err)
 			}
 		} else {
 			log.Warnf("[DMmsgHandler] failed to get a worker for remote %s (user %s)", message.IdentityId, message.UserId)
 			w.natsReplyError(msg, errors.New("[DMmsgHandler] failed to get a worker"))
+			err = errors.New("failed to get a worker")
+			w.publishJobStatus(message, started, err)
+			w.reportJob(message, err)
 		}
 	case "reload_worker":
 		log.Infof("received reload_worker order for remote twitter ID %s", message.IdentityId)
@@ -103,6 +116,33 @@ func (w *Worker) DMmsgHandler(msg *nats.Msg) {
 	}
 }
 
+// reportJob acks job to idpoller if order has been dispatched by idpoller
+func (w *Worker) reportJob(order BrokerOrder, jobErr error) {
+	if order.JobId == "" {
+		return
+	}
+	report := WorkerRequest{
+		Worker: w.Id,
+		Order: BrokerOrder{
+			Order:      "job_done",
+			IdentityId: order.IdentityId,
+			UserId:     order.UserId,
+			JobId:      order.JobId,
+		},
+	}
+	if jobErr != nil {
+		report.Order.Order = "job_failed"
+		report.Error = jobErr.Error()
+	}
+	data, err := json.Marshal(report)
+	if err == nil {
+		err = w.NatsConn.Publish(w.Conf.BrokerConfig.NatsTopicPoller, data)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[worker %s] failed to report job %s to idpoller", w.Id, order.JobId)
+	}
+}
+
 func (w *Worker) natsReplyError(msg *nats.Msg, err error) {
 	log.WithError(err).Warnf("twitter broker [outbound] : error when processing incoming nats message : %v", *msg)
 
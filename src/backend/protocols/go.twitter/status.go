@@ -0,0 +1,74 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package twitterworker
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+const (
+	heartbeatInterval = 30 * time.Second
+	workerProtocol    = "twitter"
+)
+
+// heartbeat periodically notifies idpoller that worker is alive, until stop chan is closed
+func (w *Worker) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	w.publishStatus(WorkerStatus{Type: HeartbeatStatus})
+	for {
+		select {
+		case <-ticker.C:
+			w.publishStatus(WorkerStatus{Type: HeartbeatStatus})
+		case <-stop:
+			return
+		}
+	}
+}
+
+// publishJobStatus notifies idpoller about a job dispatched by worker to an account handler.
+// Job is done as soon as it is handed over, because account handlers poll DMs on their own.
+func (w *Worker) publishJobStatus(order BrokerOrder, started time.Time, jobErr error) {
+	now := time.Now()
+	status := JobStatus{
+		Duration:   int64(now.Sub(started) / time.Millisecond),
+		IdentityId: order.IdentityId,
+		JobId:      order.JobId,
+		Order:      order.Order,
+		Started:    started,
+		State:      JobDone,
+		Updated:    now,
+		UserId:     order.UserId,
+		Worker:     w.Id,
+	}
+	if jobErr != nil {
+		status.State = JobFailed
+		status.Errors = []string{jobErr.Error()}
+	}
+	w.publishStatus(WorkerStatus{
+		Job:  &status,
+		Type: JobStatusType,
+	})
+}
+
+// publishStatus sends status on idpoller's status topic, if one is configured
+func (w *Worker) publishStatus(status WorkerStatus) {
+	if w.Conf.BrokerConfig.NatsTopicStatus == "" {
+		return
+	}
+	status.Protocol = workerProtocol
+	status.Time = time.Now()
+	status.Worker = w.Id
+	data, err := json.Marshal(status)
+	if err == nil {
+		err = w.NatsConn.Publish(w.Conf.BrokerConfig.NatsTopicStatus, data)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[worker %s] failed to publish status", w.Id)
+	}
+}
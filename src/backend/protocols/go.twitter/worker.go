@@ -125,7 +125,8 @@ func InitWorker(conf WorkerConfig, verboseLog bool, id string) (worker *Worker,
 	caliopenConfig := CaliopenConfig{
 		NotifierConfig: conf.BrokerConfig.LDAConfig.NotifierConfig,
 		NatsConfig: NatsConfig{
-			Url: conf.BrokerConfig.NatsURL,
+			Url:          conf.BrokerConfig.NatsURL,
+			Notifs_topic: conf.BrokerConfig.LDAConfig.NotifsTopic,
 		},
 		RESTstoreConfig: RESTstoreConfig{
 			BackendName:  conf.BrokerConfig.StoreName,
@@ -169,6 +170,8 @@ func (worker *Worker) Start(throttling ...time.Duration) {
 		throttle = pollThrottling
 	}
 	// start throttled jobs polling
+	stopBeats := make(chan struct{})
+	go worker.heartbeat(stopBeats)
 	log.Infof("Twitter worker %s starting with %d sec throttling", worker.Id, throttle/time.Second)
 	for {
 		start := time.Now()
@@ -182,6 +185,7 @@ func (worker *Worker) Start(throttling ...time.Duration) {
 		}
 		// check for interrupt after job is finished
 		if worker.HaltGroup != nil {
+			close(stopBeats)
 			worker.stop()
 			break
 		}
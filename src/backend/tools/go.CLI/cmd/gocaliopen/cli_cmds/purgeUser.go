@@ -0,0 +1,97 @@
+/*
+ * // Copyleft (ɔ) 2019 The Caliopen contributors.
+ * // Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+ * // license (AGPL) that can be found in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/REST"
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"sort"
+	"time"
+)
+
+var (
+	purgeUserId     string
+	purgeUserResume bool
+
+	purgeUserCmd = &cobra.Command{
+		Use:   "purgeUser",
+		Short: "show and verify purge of a deleted user's data",
+		Long: `command outputs progress of the purge of a deleted user's data,
+	then counts user's data left in store and index.
+	With --resume, command runs the remaining purge steps before verifying.
+	Exits with status 1 if some data are left.`,
+		Run: purgeUser,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(purgeUserCmd)
+
+	purgeUserCmd.Flags().StringVarP(&purgeUserId, "user", "u", "", "user_id of the deleted user")
+	purgeUserCmd.Flags().BoolVar(&purgeUserResume, "resume", false, "process remaining purge steps")
+}
+
+func purgeUser(cmd *cobra.Command, args []string) {
+	if purgeUserId == "" {
+		log.Fatal("--user flag is mandatory")
+	}
+	var err error
+	var Rest *REST.RESTfacility
+	Rest, err = getRESTFacility()
+	if err != nil {
+		log.WithError(err).Fatal("initialization of ReST facility failed")
+	}
+
+	if purgeUserResume {
+		if _, e := Rest.PurgeUser(purgeUserId); e != nil {
+			log.WithError(e).Warnf("purge of user %s did not complete", purgeUserId)
+		}
+	}
+
+	purge, e := Rest.RetrieveUserPurge(purgeUserId)
+	if e != nil {
+		log.WithError(e).Fatalf("failed to retrieve purge of user %s", purgeUserId)
+	}
+	fmt.Printf("purge of user %s started at %s\n", purgeUserId, purge.DateStart.Format(time.RFC3339))
+	if purge.Completed() {
+		fmt.Printf("completed at %s\n", purge.DateEnd.Format(time.RFC3339))
+	} else {
+		fmt.Printf("next step : %s (last update at %s)\n", purge.Step, purge.DateUpdate.Format(time.RFC3339))
+	}
+	if purge.LastError != "" {
+		fmt.Printf("last error : %s\n", purge.LastError)
+	}
+	for _, step := range sortedKeys(purge.Counts) {
+		fmt.Printf("\t%s : %d removed\n", step, purge.Counts[step])
+	}
+
+	left, e := Rest.VerifyUserPurge(purgeUserId)
+	if e != nil {
+		log.WithError(e).Fatalf("failed to verify purge of user %s", purgeUserId)
+	}
+	if len(left) == 0 {
+		fmt.Println("no data left for user")
+		return
+	}
+	fmt.Println("data left for user :")
+	for _, table := range sortedKeys(left) {
+		fmt.Printf("\t%s : %d\n", table, left[table])
+	}
+	os.Exit(1)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := []string{}
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -277,6 +277,8 @@ func getRESTFacility() (API2 *REST.RESTfacility, err error) {
 			Url:            apiConf.APIConfig.NatsConfig.Url,
 			OutSMTP_topic:  apiConf.APIConfig.OutSMTP_topic,
 			Contacts_topic: apiConf.APIConfig.Contacts_topic,
+			IdPoller_topic: apiConf.APIConfig.IdPoller_topic,
+			Users_topic:    apiConf.APIConfig.Users_topic,
 		},
 		CacheConfig: CacheConfig{
 			Host:     apiConf.APIConfig.CacheSettings.Host,
@@ -0,0 +1,247 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+// package go_keys discovers public keys of users' contacts
+// through Web Key Directories and HKP keyservers
+package go_keys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/store/cassandra"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	log "github.com/Sirupsen/logrus"
+	"github.com/gocql/gocql"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/nats-io/go-nats"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	DiscoveryConfig struct {
+		StoreName   string            `mapstructure:"store_name"`
+		StoreConfig StoreConfig       `mapstructure:"store_settings"`
+		NatsUrl     string            `mapstructure:"nats_url"`
+		NatsQueue   string            `mapstructure:"nats_queue"`
+		NatsTopics  map[string]string `mapstructure:"nats_topics"`
+		WKD         WKDConfig         `mapstructure:"wkd"`
+		HKP         HKPConfig         `mapstructure:"hkp"`
+	}
+
+	WKDConfig struct {
+		Enable  bool `mapstructure:"enable"`
+		Timeout int  `mapstructure:"timeout"` // in seconds
+	}
+
+	HKPConfig struct {
+		Enable     bool     `mapstructure:"enable"`
+		Keyservers []string `mapstructure:"keyservers"` // base urls, for example https://keys.openpgp.org
+		Timeout    int      `mapstructure:"timeout"`    // in seconds
+	}
+
+	// KeyDiscovery handles `discover_key` orders published on keys topic when contacts are created or updated
+	KeyDiscovery struct {
+		Config   DiscoveryConfig
+		Store    backends.KeyDiscoveryStore
+		NatsConn *nats.Conn
+		natsSub  *nats.Subscription
+		// HTTP clients used to query WKD and keyservers, could be replaced to reach stand-in servers.
+		// WKD client refuses to connect to non-public addresses, because WKD hosts are given by contacts' addresses.
+		WKDClient *http.Client
+		HKPClient *http.Client
+	}
+
+	// discoveredKey is a key found for an address, with where it comes from
+	discoveredKey struct {
+		Entity    *openpgp.Entity
+		Source    string // WKDAdvancedMethod, WKDDirectMethod or HKPMethod
+		SourceURL string
+	}
+)
+
+const (
+	HKPMethod       = HKPKeySource // anyone can upload keys to keyservers, these keys are never trusted
+	discoverOrder   = "discover_key"
+	defaultTimeout  = 10
+	maxKeyFetchSize = 1 << 20 // 1MB, largest response read from WKD or keyservers
+)
+
+// InitKeyDiscovery connects to store and NATS, according to config
+func InitKeyDiscovery(config DiscoveryConfig) (kd *KeyDiscovery, err error) {
+	kd = NewKeyDiscovery(config, nil)
+	switch config.StoreName {
+	case "cassandra":
+		c := store.CassandraConfig{
+			Hosts:       config.StoreConfig.Hosts,
+			Keyspace:    config.StoreConfig.Keyspace,
+			Consistency: gocql.Consistency(config.StoreConfig.Consistency),
+		}
+		kd.Store, err = store.InitializeCassandraBackend(c)
+		if err != nil {
+			log.WithError(err).Warnf("[KeyDiscovery] initialization of %s backend failed", config.StoreName)
+			return nil, errors.New("[KeyDiscovery] failed to init cassandra backend")
+		}
+	default:
+		return nil, fmt.Errorf("[KeyDiscovery] unhandled store : %s", config.StoreName)
+	}
+
+	kd.NatsConn, err = nats.Connect(config.NatsUrl)
+	if err != nil {
+		log.WithError(err).Warn("[KeyDiscovery] initialization of NATS connexion failed")
+		return nil, errors.New("[KeyDiscovery] failed to init NATS connection")
+	}
+	return kd, nil
+}
+
+// NewKeyDiscovery returns a KeyDiscovery working with store, without NATS connection
+func NewKeyDiscovery(config DiscoveryConfig, store backends.KeyDiscoveryStore) *KeyDiscovery {
+	wkdTimeout, hkpTimeout := config.WKD.Timeout, config.HKP.Timeout
+	if wkdTimeout == 0 {
+		wkdTimeout = defaultTimeout
+	}
+	if hkpTimeout == 0 {
+		hkpTimeout = defaultTimeout
+	}
+	return &KeyDiscovery{
+		Config:    config,
+		Store:     store,
+		WKDClient: helpers.PublicHTTPClient(time.Duration(wkdTimeout) * time.Second),
+		HKPClient: &http.Client{Timeout: time.Duration(hkpTimeout) * time.Second},
+	}
+}
+
+// Start subscribes to keys topic
+func (kd *KeyDiscovery) Start() (err error) {
+	kd.natsSub, err = kd.NatsConn.QueueSubscribe(kd.Config.NatsTopics[Nats_Keys_topicKey], kd.Config.NatsQueue, kd.natsKeysHandler)
+	if err != nil {
+		log.WithError(err).Warn("[KeyDiscovery] initialization of NATS subscription failed for keys topic")
+		return errors.New("[KeyDiscovery] failed to init NATS subscription")
+	}
+	return nil
+}
+
+func (kd *KeyDiscovery) Stop() {
+	if kd.natsSub != nil {
+		kd.natsSub.Unsubscribe()
+	}
+	if kd.NatsConn != nil {
+		kd.NatsConn.Close()
+	}
+	if kd.Store != nil {
+		if closer, ok := kd.Store.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
+
+// natsKeysHandler handles messages received on keys topic, ignoring other orders than `discover_key`
+func (kd *KeyDiscovery) natsKeysHandler(msg *nats.Msg) {
+	var order DiscoverKeyMessage
+	err := json.Unmarshal(msg.Data, &order)
+	if err != nil {
+		log.WithError(err).Warn("[KeyDiscovery] unable to unmarshal nats order")
+		return
+	}
+	if order.Order != discoverOrder {
+		return
+	}
+	added, err := kd.DiscoverKeys(order)
+	if err != nil {
+		log.WithError(err).Warnf("[KeyDiscovery] discovery failed for contact %s", order.ContactId)
+		return
+	}
+	log.Infof("[KeyDiscovery] %d new key(s) found for contact %s", added, order.ContactId)
+}
+
+// DiscoverKeys looks up keys for each email of contact and stores the ones that are not already known.
+// Emails embedded in order are looked up, or all contact's emails if order has none.
+func (kd *KeyDiscovery) DiscoverKeys(order DiscoverKeyMessage) (added int, err error) {
+	contact, err := kd.Store.RetrieveContact(order.UserId, order.ContactId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve contact : %s", err)
+	}
+	emails := order.Emails
+	if len(emails) == 0 {
+		emails = contact.Emails
+	}
+	keys, e := kd.Store.RetrieveContactPubKeys(order.UserId, order.ContactId)
+	if e != nil {
+		return 0, fmt.Errorf("failed to retrieve contact's keys : %s", e)
+	}
+	known := map[string]bool{}
+	for _, key := range keys {
+		known[key.Fingerprint] = true
+	}
+
+	for _, email := range emails {
+		if email.Address == "" {
+			continue
+		}
+		for _, found := range kd.lookupAddress(email.Address) {
+			pubkey := new(PublicKey)
+			if err := pubkey.UnmarshalPGPEntity(found.Source, found.Entity, contact); err != nil {
+				log.WithError(err).Infof("[KeyDiscovery] key found with %s for %s does not fit contact", found.Source, email.Address)
+				continue
+			}
+			if known[pubkey.Fingerprint] {
+				continue
+			}
+			pubkey.Source = found.Source
+			pubkey.SourceURL = found.SourceURL
+			if err := kd.Store.CreatePGPPubKey(pubkey); err != nil {
+				log.WithError(err).Warnf("[KeyDiscovery] failed to store key %s", pubkey.Fingerprint)
+				continue
+			}
+			known[pubkey.Fingerprint] = true
+			added++
+		}
+	}
+	return added, nil
+}
+
+// lookupAddress queries WKD first, then each keyserver, and returns valid keys found for address
+func (kd *KeyDiscovery) lookupAddress(address string) (found []discoveredKey) {
+	if kd.Config.WKD.Enable {
+		keys, err := kd.lookupWKD(address)
+		if err != nil {
+			log.WithError(err).Debugf("[KeyDiscovery] WKD lookup failed for %s", address)
+		}
+		found = append(found, keys...)
+	}
+	if kd.Config.HKP.Enable {
+		for _, keyserver := range kd.Config.HKP.Keyservers {
+			keys, err := kd.lookupHKP(keyserver, address)
+			if err != nil {
+				log.WithError(err).Debugf("[KeyDiscovery] HKP lookup on %s failed for %s", keyserver, address)
+			}
+			found = append(found, keys...)
+		}
+	}
+	return
+}
+
+// validKeys keeps entities that are not revoked nor expired, and have a self-signed identity for address
+func validKeys(entities openpgp.EntityList, address, source, sourceURL string) (keys []discoveredKey) {
+	now := time.Now()
+	for _, entity := range entities {
+		if entity.PrimaryKey == nil || len(entity.Revocations) > 0 {
+			continue
+		}
+		for _, identity := range entity.Identities {
+			if identity.SelfSignature == nil || identity.SelfSignature.KeyExpired(now) {
+				continue
+			}
+			if strings.EqualFold(ExtractEmailAddrFromString(identity.Name), address) {
+				keys = append(keys, discoveredKey{Entity: entity, Source: source, SourceURL: sourceURL})
+				break
+			}
+		}
+	}
+	return
+}
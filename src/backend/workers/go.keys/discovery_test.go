@@ -0,0 +1,142 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_keys
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends/backendstest"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/satori/go.uuid"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// discoveryTestStore holds a single contact and its keys
+type discoveryTestStore struct {
+	backendstest.ContactsBackend
+	backendstest.KeysStore
+	contact *Contact
+	keys    PublicKeys
+}
+
+func (s *discoveryTestStore) RetrieveContact(userID, contactID string) (*Contact, error) {
+	return s.contact, nil
+}
+func (s *discoveryTestStore) RetrieveContactPubKeys(userId, contactId string) (PublicKeys, CaliopenError) {
+	return s.keys, nil
+}
+func (s *discoveryTestStore) CreatePGPPubKey(pubkey *PublicKey) CaliopenError {
+	s.keys = append(s.keys, *pubkey)
+	return nil
+}
+
+func newTestEntity(t *testing.T, name, email string) *openpgp.Entity {
+	entity, err := backendstest.NewPGPEntity(name, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func TestKeyDiscovery_DiscoverKeys(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.org")
+	bob := newTestEntity(t, "Bob", "bob@example.net")
+	carol := newTestEntity(t, "Carol", "carol@example.com")
+	mallory := newTestEntity(t, "Mallory", "mallory@example.com")
+
+	// stand-in for WKD of example.org (advanced method) and example.net (direct method only)
+	var queried []string
+	wkd := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Split(r.Host, ":")[0]
+		queried = append(queried, host)
+		switch {
+		case host == "openpgpkey.example.org" && r.URL.Path == WKDPath+"example.org/hu/"+WKDHash("alice"):
+			w.Write(backendstest.BinaryPublicKey(alice))
+		case host == "example.net" && r.URL.Path == WKDPath+"hu/"+WKDHash("bob"):
+			w.Write(backendstest.BinaryPublicKey(bob))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer wkd.Close()
+	// stand-in for a keyserver knowing carol's key, and a key of mallory pretending to be carol's
+	hkp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pks/lookup" && r.URL.Query().Get("op") == "get" && r.URL.Query().Get("search") == "carol@example.com" {
+			w.Write([]byte(backendstest.ArmoredPublicKey(carol, mallory)))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer hkp.Close()
+
+	contact := &Contact{
+		ContactId: UUID(uuid.NewV4()),
+		UserId:    UUID(uuid.NewV4()),
+		Emails: []EmailContact{
+			{Address: "alice@example.org"},
+			{Address: "bob@example.net"},
+			{Address: "carol@example.com"},
+			{Address: "eve@localhost"},
+			{Address: "eve@127.0.0.1"},
+		},
+	}
+	store := &discoveryTestStore{contact: contact}
+	kd := NewKeyDiscovery(DiscoveryConfig{
+		WKD: WKDConfig{Enable: true},
+		HKP: HKPConfig{Enable: true, Keyservers: []string{hkp.URL}},
+	}, store)
+	kd.WKDClient = &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if strings.HasPrefix(addr, "openpgpkey.example.net:") {
+				return nil, errors.New("no such host")
+			}
+			return net.Dial(network, wkd.Listener.Addr().String())
+		},
+	}}
+
+	order := DiscoverKeyMessage{Order: discoverOrder, UserId: contact.UserId.String(), ContactId: contact.ContactId.String()}
+	added, err := kd.DiscoverKeys(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 3 || len(store.keys) != 3 {
+		t.Fatalf("expected 3 keys to be added, got %d : %+v", added, store.keys)
+	}
+	expected := map[string]string{
+		"alice@example.org": WKDAdvancedMethod,
+		"bob@example.net":   WKDDirectMethod,
+		"carol@example.com": HKPMethod,
+	}
+	for _, key := range store.keys {
+		if len(key.Emails) == 0 || expected[key.Emails[0]] != key.Source || key.SourceURL == "" {
+			t.Errorf("unexpected key %s for %v, found with %s at %s", key.Fingerprint, key.Emails, key.Source, key.SourceURL)
+		}
+		if key.Trusted() != (key.Source != HKPMethod) {
+			t.Errorf("expected only keys found on keyservers to be untrusted, got %s from %s trusted : %t", key.Fingerprint, key.Source, key.Trusted())
+		}
+		if key.ResourceId != contact.ContactId {
+			t.Errorf("expected key to be attached to contact, got resource %s", key.ResourceId.String())
+		}
+	}
+
+	for _, host := range queried {
+		if strings.Contains(host, "localhost") || strings.Contains(host, "127.0.0.1") {
+			t.Errorf("expected WKD of non-public host not to be queried, got a request to %s", host)
+		}
+	}
+
+	// known keys are not added again
+	added, err = kd.DiscoverKeys(order)
+	if err != nil || added != 0 || len(store.keys) != 3 {
+		t.Errorf("expected no new key on second discovery, got %d, %v", added, err)
+	}
+}
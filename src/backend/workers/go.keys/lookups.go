@@ -0,0 +1,82 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_keys
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/helpers"
+	"github.com/keybase/go-crypto/openpgp"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// lookupWKD fetches address's key from its domain Web Key Directory.
+// Direct method is only used if advanced method's openpgpkey subdomain can't be reached.
+// Domains that obviously target a non-public host are not queried.
+func (kd *KeyDiscovery) lookupWKD(address string) ([]discoveredKey, error) {
+	if err := helpers.CheckPublicHost(address[strings.LastIndex(address, "@")+1:]); err != nil {
+		return nil, err
+	}
+	for _, method := range []string{WKDAdvancedMethod, WKDDirectMethod} {
+		keyURL, err := WKDURL(address, method)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := kd.WKDClient.Get(keyURL)
+		if err != nil {
+			if method == WKDAdvancedMethod {
+				continue
+			}
+			return nil, err
+		}
+		body, err := readResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		// WKD serves binary keys, some servers armor them anyway
+		entities, err := openpgp.ReadKeyRing(bytes.NewReader(body))
+		if err != nil {
+			entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(body))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key at %s : %s", keyURL, err)
+		}
+		return validKeys(entities, address, method, keyURL), nil
+	}
+	return nil, nil
+}
+
+// lookupHKP gets keys matching address from an HKP keyserver,
+// see https://tools.ietf.org/html/draft-shaw-openpgp-hkp-00
+func (kd *KeyDiscovery) lookupHKP(keyserver, address string) ([]discoveredKey, error) {
+	lookupURL := strings.TrimSuffix(keyserver, "/") + "/pks/lookup?op=get&options=mr&search=" + url.QueryEscape(address)
+	resp, err := kd.HKPClient.Get(lookupURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key at %s : %s", lookupURL, err)
+	}
+	return validKeys(entities, address, HKPMethod, lookupURL), nil
+}
+
+// readResponse reads body of a successful response, up to maxKeyFetchSize
+func readResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", resp.Request.URL.String(), resp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxKeyFetchSize))
+}
@@ -26,7 +26,10 @@ type DbHandler struct {
 type cacheEntry struct {
 	cronId         cron.EntryID
 	iDkey          string
+	pollCron       string // optional crontab spec, see objects.ParseSyncSchedule
 	pollInterval   string // in minutes
+	pollTimezone   string
+	pollWindows    string // optional json list of sync windows, see objects.ParseSyncSchedule
 	remoteID       UUID
 	remoteProtocol string
 	userID         UUID
@@ -95,10 +98,12 @@ func (dbh *DbHandler) SyncCache() (added, removed, updated map[string]cacheEntry
 					// do not resign, take a default value instead
 					pollInterval = defaultInterval
 				}
-				if entry.pollInterval != pollInterval {
-					entry.pollInterval = pollInterval
-					updated[idkey] = entry
-					dbh.cache[idkey] = entry
+				scheduled := entry
+				scheduled.setSchedule(remote.Infos)
+				if entry.pollInterval != pollInterval || scheduled != entry {
+					scheduled.pollInterval = pollInterval
+					updated[idkey] = scheduled
+					dbh.cache[idkey] = scheduled
 				}
 			} else {
 				var pollInterval string
@@ -114,6 +119,7 @@ func (dbh *DbHandler) SyncCache() (added, removed, updated map[string]cacheEntry
 					remoteProtocol: remote.Protocol,
 					userID:         remote.UserId,
 				}
+				entry.setSchedule(remote.Infos)
 				dbh.cache[idkey] = entry
 				added[idkey] = entry
 			}
@@ -128,6 +134,22 @@ func (dbh *DbHandler) SyncCache() (added, removed, updated map[string]cacheEntry
 	return
 }
 
+// setSchedule copies sync schedule's infos into cache entry
+func (entry *cacheEntry) setSchedule(infos map[string]string) {
+	entry.pollCron = infos[PollCronKey]
+	entry.pollTimezone = infos[PollTimezoneKey]
+	entry.pollWindows = infos[PollWindowsKey]
+}
+
+// syncSchedule returns entry's sync schedule, or nil if entry is only scheduled by its poll interval
+func (entry cacheEntry) syncSchedule() (*SyncSchedule, error) {
+	return ParseSyncSchedule(map[string]string{
+		PollCronKey:     entry.pollCron,
+		PollTimezoneKey: entry.pollTimezone,
+		PollWindowsKey:  entry.pollWindows,
+	})
+}
+
 // statusTypeOK checks if remote identity is 'active' and its type is within poller's scope
 func (dbh *DbHandler) statusTypeOK(remote *UserIdentity) bool {
 	if remote.Status != "active" {
@@ -5,8 +5,12 @@
 package go_remoteIDs
 
 import (
+	"encoding/json"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.backends"
+	"github.com/CaliOpen/Caliopen/src/backend/main/go.main/facilities/Notifications"
 	log "github.com/Sirupsen/logrus"
+	"github.com/satori/go.uuid"
 )
 
 type PollerConfig struct {
@@ -17,6 +21,9 @@ type PollerConfig struct {
 	NatsUrl         string            `mapstructure:"nats_url"`
 	NatsQueue       string            `mapstructure:"nats_queue"`
 	NatsTopics      map[string]string `mapstructure:"nats_topics"`
+	JobsQueue       string            `mapstructure:"jobs_queue"` // memory or redis
+	JobsConfig      JobsConfig        `mapstructure:"jobs_settings"`
+	CacheConfig     CacheConfig       `mapstructure:"cache_settings"`
 }
 
 const (
@@ -26,11 +33,13 @@ const (
 )
 
 type Poller struct {
-	Config PollerConfig
-	dbh    *DbHandler
-	mqh    *MqHandler
-	sched  *Scheduler
-	jobs   *JobsHandler
+	Config   PollerConfig
+	dbh      *DbHandler
+	mqh      *MqHandler
+	notifier Notifications.Notifiers // nil if store can't queue notifications
+	sched    *Scheduler
+	jobs     *JobsHandler
+	status   *StatusHandler
 }
 
 var poller *Poller
@@ -44,6 +53,7 @@ func InitPoller(config PollerConfig, verboseLog bool) (idpoller *Poller, err err
 		log.SetLevel(log.DebugLevel)
 	}
 	poller.Config = config
+	poller.status = newStatusHandler()
 
 	poller.mqh, err = InitMqHandler()
 	if err != nil {
@@ -55,6 +65,10 @@ func InitPoller(config PollerConfig, verboseLog bool) (idpoller *Poller, err err
 		return nil, err
 	}
 
+	if store, ok := poller.dbh.Store.(backends.NotificationsStore); ok {
+		poller.notifier = Notifications.NewQueueNotifier(store, poller.mqh.NatsConn, poller.Config.NatsTopics[Nats_Notifs_topicKey])
+	}
+
 	poller.sched, err = initScheduler()
 	if err != nil {
 		return nil, err
@@ -79,6 +93,7 @@ func (p *Poller) Stop() {
 	p.sched.Stop()
 	p.mqh.Stop()
 	p.dbh.Stop()
+	p.jobs.Stop()
 }
 
 func (p *Poller) fullSync() {
@@ -113,3 +128,31 @@ func (p *Poller) fullSync() {
 	log.Infof("[poller] full sync ended : %d jobs added, %d jobs removed, %d jobs updated.\n           => %d jobs scheduled in cron table.",
 		len(added), len(removed), len(updated), len(p.sched.MainCron.Entries()))
 }
+
+// notifySyncError lets user know that a job failed for one of its remote identities
+func (p *Poller) notifySyncError(job JobStatus) {
+	if p.notifier == nil {
+		return
+	}
+	userId, err := uuid.FromString(job.UserId)
+	if err != nil {
+		log.WithError(err).Warnf("[poller] can't notify sync error for invalid user id <%s>", job.UserId)
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"syncError": map[string]interface{}{
+			"errors":      job.Errors,
+			"identity_id": job.IdentityId,
+			"order":       job.Order,
+		},
+	})
+	notif := Notification{
+		Body:    string(body),
+		Emitter: "idpoller",
+		NotifId: UUID(uuid.NewV1()),
+		TTLcode: MidLived,
+		Type:    ErrorNotif,
+		User:    &User{UserId: UUID(userId)},
+	}
+	p.notifier.ByNotifQueue(&notif)
+}
@@ -5,72 +5,93 @@
 package go_remoteIDs
 
 import (
-	"crypto/sha256"
-	"errors"
 	"fmt"
 	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
 	log "github.com/Sirupsen/logrus"
-	"sync"
 )
 
+// JobsHandler dispatches pending jobs to workers through a pluggable JobsQueue
 type JobsHandler struct {
-	pendingJobs  map[string]map[[32]byte]Job // pattern is [worker][job-hash]job
-	jobsSequence map[string][][32]byte       // pattern is [worker][]job-hash <- FIFO ordered
-	jobsMux      *sync.Mutex
+	queue JobsQueue
 }
 
 type Job struct {
-	Worker string // protocol worker like email, twitter, etc. as defined in idpoller's config
-	Order  BrokerOrder
+	Worker    string      `json:"worker"` // protocol worker like email, twitter, etc. as defined in idpoller's config
+	Order     BrokerOrder `json:"order"`
+	Id        string      `json:"id"`
+	Attempts  int         `json:"attempts"` // how many times job has been dispatched without success
+	LastError string      `json:"last_error,omitempty"`
+	Priority  bool        `json:"priority,omitempty"` // user-requested job, dispatched before scheduled jobs
 }
 
 func initJobsHandler() (*JobsHandler, error) {
-	return &JobsHandler{
-		map[string]map[[32]byte]Job{},
-		map[string][][32]byte{},
-		&sync.Mutex{},
-	}, nil
+	policy := newQueuePolicy(poller.Config.JobsConfig)
+	switch poller.Config.JobsQueue {
+	case "", "memory":
+		return &JobsHandler{newMemoryQueue(policy)}, nil
+	case "redis":
+		queue, err := newRedisQueue(poller.Config.CacheConfig, policy)
+		if err != nil {
+			return nil, fmt.Errorf("[initJobsHandler] failed to init redis jobs queue : %s", err)
+		}
+		return &JobsHandler{queue}, nil
+	default:
+		return nil, fmt.Errorf("[initJobsHandler] unhandled jobs queue : %s", poller.Config.JobsQueue)
+	}
 }
 
-// AddPendingJob adds a job to _pending_ map only if job's hash does not already exists for job's worker.
-// pending jobs are ordered in a FIFO list per each worker.
+// AddPendingJob adds a job to worker's queue only if job's hash does not already exists for job's worker.
+// pending jobs are ordered in a FIFO list per each worker, priority jobs being dispatched first.
+// A priority job promotes an identical job already pending.
 func (jh *JobsHandler) AddPendingJob(job Job) {
-	jh.jobsMux.Lock()
-	key := sha256.Sum256([]byte(job.Order.UserId + job.Order.IdentityId + job.Order.Order))
-	if _, ok := jh.pendingJobs[job.Worker]; !ok {
-		jh.pendingJobs[job.Worker] = make(map[[32]byte]Job)
+	job.Id = jobId(job)
+	added, err := jh.queue.Push(job)
+	if err != nil {
+		log.WithError(err).Warnf("[jobsHandler] failed to add job %+v", job)
+		return
 	}
-	if _, ok := jh.pendingJobs[job.Worker][key]; !ok {
-		jh.pendingJobs[job.Worker][key] = job
-		jh.jobsSequence[job.Worker] = append(jh.jobsSequence[job.Worker], key)
+	if added {
+		count, _ := jh.queue.Pending(job.Worker)
+		log.Infof("[jobsHandler] jobs for workers <%s> updated : %d job(s) pending", job.Worker, count)
 	}
-	log.Debugf("pending jobs list : %+v\n", jh.pendingJobs)
-	log.Debugf("jobs sequence list : %+v\n", jh.jobsSequence)
-	log.Infof("[jobsHandler] jobs for workers <%s> updated : %d job(s) pending", job.Worker, len(jh.jobsSequence[job.Worker]))
-	jh.jobsMux.Unlock()
 }
 
-// ConsumePendingJobFor returns first-in pending job for worker and removes it from lists
+// ConsumePendingJobFor leases first-in ready job for worker.
+// Job's order carries job's id, worker must ack it with AckJob or FailJob before lease expiration,
+// otherwise job will be re-dispatched.
 // returns error if no pending job
 func (jh *JobsHandler) ConsumePendingJobFor(worker string) (Job, error) {
-	jh.jobsMux.Lock()
-	defer jh.jobsMux.Unlock()
-	if len(jh.jobsSequence[worker]) == 0 {
-		return Job{}, errors.New(noPendingJobErr)
+	job, err := jh.queue.Lease(worker)
+	if err != nil {
+		return Job{}, err
 	}
-	// get most ancient job for worker
-	job := jh.pendingJobs[worker][jh.jobsSequence[worker][0]]
-	// remove job from pending queue
-	delete(jh.pendingJobs[worker], jh.jobsSequence[worker][0])
-	// truncate jobsSequence list
-	jh.jobsSequence[worker] = jh.jobsSequence[worker][1:]
-
-	log.Infof("[jobsHandler] 1 <%s> job consumed  : %d job(s) pending", job.Worker, len(jh.jobsSequence[job.Worker]))
-	log.Debugf("pending jobs list : %+v", jh.pendingJobs)
-	log.Debugf("jobs sequence list : %+v", jh.jobsSequence)
+	job.Order.JobId = job.Id
+	log.Infof("[jobsHandler] 1 <%s> job consumed (attempt #%d)", job.Worker, job.Attempts+1)
 	return job, nil
 }
 
+// AckJob removes a job successfully done by worker
+func (jh *JobsHandler) AckJob(worker, jobId string) error {
+	err := jh.queue.Ack(worker, jobId)
+	if err != nil {
+		log.WithError(err).Warnf("[jobsHandler] failed to ack <%s> job %s", worker, jobId)
+	}
+	return err
+}
+
+// FailJob puts a job back into queue for a later retry, or to dead-letter list after too many attempts
+func (jh *JobsHandler) FailJob(worker, jobId, reason string) error {
+	err := jh.queue.Fail(worker, jobId, reason)
+	if err != nil {
+		log.WithError(err).Warnf("[jobsHandler] failed to nack <%s> job %s", worker, jobId)
+	}
+	return err
+}
+
+func (jh *JobsHandler) Stop() {
+	jh.queue.Close()
+}
+
 // Run implements cron.Job interface to add job to relevant worker's list
 func (j Job) Run() {
 	poller.jobs.AddPendingJob(j)
@@ -96,3 +117,32 @@ func buildSyncJob(entry cacheEntry) (Job, error) {
 	log.Debugf("new job built : %+v", job)
 	return job, nil
 }
+
+// buildActionJob builds a priority job for an action requested by user on a remote identity
+func buildActionJob(order RemoteIDNatsMessage) (Job, error) {
+	var job Job
+	switch order.Protocol {
+	case "email", "imap":
+		job.Worker = imapWorker
+	case "twitter":
+		job.Worker = twitterWorker
+	default:
+		return Job{}, fmt.Errorf("unhandled remote protocol : %s", order.Protocol)
+	}
+	job.Order = BrokerOrder{
+		UserId:     order.UserId,
+		IdentityId: order.IdentityId,
+	}
+	switch order.OrderParam {
+	case SyncNowAction:
+		job.Order.Order = "sync"
+	case FullFetchAction:
+		job.Order.Order = "full_sync"
+	case ResetSyncStateAction:
+		job.Order.Order = "reset_sync"
+	default:
+		return Job{}, fmt.Errorf("unknown action : %s", order.OrderParam)
+	}
+	job.Priority = true
+	return job, nil
+}
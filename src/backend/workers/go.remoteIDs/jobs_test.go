@@ -55,19 +55,20 @@ func TestJobsHandler_AddPendingJob(t *testing.T) {
 	case <-time.After(2 * time.Second):
 		t.Error("timeout waiting for concurrent AddPendingJob")
 	}
-	if len(jbh.pendingJobs) != adds {
-		t.Errorf("expected %d pending jobs, got %d", adds, len(jbh.pendingJobs))
+	mq := jbh.queue.(*memoryQueue)
+	if len(mq.pendingJobs) != adds {
+		t.Errorf("expected %d pending jobs, got %d", adds, len(mq.pendingJobs))
 	}
-	if len(jbh.jobsSequence) != adds {
-		t.Errorf("expected %d elems in sequence list, got %d", adds, len(jbh.jobsSequence))
+	if len(mq.jobsSequence) != adds {
+		t.Errorf("expected %d elems in sequence list, got %d", adds, len(mq.jobsSequence))
 	}
 
 	// test that pendingJobs and jobsSequence are synchronized by picking some jobs randomly
 	rand.Seed(time.Now().Unix())
 	for i := 0; i < adds/4; i++ {
 		pick := rand.Intn(adds)
-		jobHash := jbh.jobsSequence["worker"][pick]
-		if _, ok := jbh.pendingJobs["worker"][jobHash]; !ok {
+		jobHash := mq.jobsSequence["worker"][pick]
+		if _, ok := mq.pendingJobs["worker"][jobHash]; !ok {
 			t.Errorf("job %s is in jobsSequence map but not in pendingJobs map", jobHash)
 		}
 	}
@@ -117,18 +118,25 @@ func TestJobsHandler_ConsumePendingJobFor(t *testing.T) {
 		if job.Order.Order != strconv.Itoa(i) {
 			t.Errorf("expected to have job #%d for worker '%s', got %s", i, worker, job.Order.Order)
 		}
+		if job.Order.JobId == "" || job.Order.JobId != job.Id {
+			t.Errorf("expected job's order to carry job id, got '%s'", job.Order.JobId)
+		}
+	}
+	mq := jbh.queue.(*memoryQueue)
+	if len(mq.pendingJobs["even"]) != 0 {
+		t.Errorf("expected an empty pending jobs list for 'even', got %d jobs left", len(mq.pendingJobs))
 	}
-	if len(jbh.pendingJobs["even"]) != 0 {
-		t.Errorf("expected an empty pending jobs list for 'even', got %d jobs left", len(jbh.pendingJobs))
+	if len(mq.pendingJobs["odd"]) != 0 {
+		t.Errorf("expected an empty pending jobs list for 'odd', got %d jobs left", len(mq.pendingJobs))
 	}
-	if len(jbh.pendingJobs["odd"]) != 0 {
-		t.Errorf("expected an empty pending jobs list for 'odd', got %d jobs left", len(jbh.pendingJobs))
+	if len(mq.jobsSequence["even"]) != 0 {
+		t.Errorf("expected an empty jobs sequence list for 'even', got %d elems left", len(mq.jobsSequence))
 	}
-	if len(jbh.jobsSequence["even"]) != 0 {
-		t.Errorf("expected an empty jobs sequence list for 'even', got %d elems left", len(jbh.jobsSequence))
+	if len(mq.jobsSequence["odd"]) != 0 {
+		t.Errorf("expected an empty jobs sequence list for 'odd', got %d elems left", len(mq.jobsSequence))
 	}
-	if len(jbh.jobsSequence["odd"]) != 0 {
-		t.Errorf("expected an empty jobs sequence list for 'odd', got %d elems left", len(jbh.jobsSequence))
+	if _, err := jbh.ConsumePendingJobFor("even"); err == nil || err.Error() != noPendingJobErr {
+		t.Errorf("expected '%s' error, got %v", noPendingJobErr, err)
 	}
 }
 
@@ -158,3 +166,31 @@ func TestBuildSyncJob(t *testing.T) {
 		t.Error("expected buildSyncJob returned error 'unhandled remote protocol', got nil")
 	}
 }
+
+func TestBuildActionJob(t *testing.T) {
+	expected := map[string]string{
+		objects.SyncNowAction:        "sync",
+		objects.FullFetchAction:      "full_sync",
+		objects.ResetSyncStateAction: "reset_sync",
+	}
+	for action, order := range expected {
+		job, err := buildActionJob(objects.RemoteIDNatsMessage{
+			IdentityId: "identity_id",
+			Order:      "sync_now",
+			OrderParam: action,
+			Protocol:   "twitter",
+			UserId:     "user_id",
+		})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if job.Worker != twitterWorker || job.Order.Order != order || !job.Priority {
+			t.Errorf("expected priority '%s' job for twitter worker, got %+v", order, job)
+		}
+	}
+	_, err := buildActionJob(objects.RemoteIDNatsMessage{Protocol: "email", OrderParam: "unknown"})
+	if err == nil {
+		t.Error("expected buildActionJob to return error for unknown action, got nil")
+	}
+}
@@ -18,6 +18,7 @@ type MqHandler struct {
 	NatsConn          *nats.Conn
 	NatsSubIdentities *nats.Subscription
 	NatsSubImap       *nats.Subscription
+	NatsSubStatus     *nats.Subscription
 	NatsSubTwitter    *nats.Subscription
 }
 
@@ -54,6 +55,17 @@ func InitMqHandler() (*MqHandler, error) {
 		return handler, errors.New("[initMqHandler] failed to init NATS subscription")
 	}
 	handler.NatsSubTwitter = sub
+
+	// every idpoller must aggregate all workers' statuses, thus not using a queue subscription
+	if topic := poller.Config.NatsTopics["status"]; topic != "" {
+		sub, err = handler.NatsConn.Subscribe(topic, handler.natsStatusHandler)
+		if err != nil {
+			log.WithError(err).Warnf("[initMqHandler] : initialization of NATS subscription failed for topic status")
+			handler.NatsConn = nil
+			return handler, errors.New("[initMqHandler] failed to init NATS subscription")
+		}
+		handler.NatsSubStatus = sub
+	}
 	return handler, nil
 }
 
@@ -72,10 +84,26 @@ func (mqh *MqHandler) natsIdentitiesHandler(msg *nats.Msg) {
 		if entry, ok := poller.dbh.GetCacheEntry(idKey); ok {
 			entry.pollInterval = order.OrderParam
 			log.Debugf("[natsIdentitiesHandler] updating pollIntervall for entry : %+v", entry)
-			poller.dbh.UpdateCacheEntry(entry)
-			_, err := poller.sched.UpdateSyncJobFor(entry)
+			entry, err := poller.sched.UpdateSyncJobFor(entry)
+			if err != nil {
+				log.WithError(err).Warnf("[natsIdentitiesHandler] failed to updateSyncJobFor %+v", entry)
+			} else {
+				poller.dbh.UpdateCacheEntry(entry)
+			}
+		}
+	case "update_schedule":
+		idKey := order.UserId + order.IdentityId
+		if entry, ok := poller.dbh.GetCacheEntry(idKey); ok {
+			if interval, err := strconv.Atoi(order.Infos["pollinterval"]); err == nil && interval > 0 && interval < 3*24*60 {
+				entry.pollInterval = order.Infos["pollinterval"]
+			}
+			entry.setSchedule(order.Infos)
+			log.Debugf("[natsIdentitiesHandler] updating sync schedule for entry : %+v", entry)
+			entry, err := poller.sched.UpdateSyncJobFor(entry)
 			if err != nil {
-				log.WithError(err).Warnf("[natsIngressHandler] failed to updateSyncJobFor %+v", entry)
+				log.WithError(err).Warnf("[natsIdentitiesHandler] failed to updateSyncJobFor %+v", entry)
+			} else {
+				poller.dbh.UpdateCacheEntry(entry)
 			}
 		}
 	case "delete":
@@ -85,6 +113,7 @@ func (mqh *MqHandler) natsIdentitiesHandler(msg *nats.Msg) {
 			poller.dbh.RemoveCacheEntry(idKey)
 			poller.sched.RemoveJobFor(entry)
 		}
+		poller.status.Remove(order.UserId, order.IdentityId)
 	case "add":
 		idKey := order.UserId + order.IdentityId
 		var pollInterval string
@@ -101,10 +130,29 @@ func (mqh *MqHandler) natsIdentitiesHandler(msg *nats.Msg) {
 			remoteProtocol: order.Protocol,
 			userID:         UUID(uuid.FromStringOrNil(order.UserId)),
 		}
+		entry.setSchedule(order.Infos)
 		entry, err := poller.sched.AddSyncJobFor(entry)
 		if err == nil {
 			poller.dbh.UpdateCacheEntry(entry)
 		}
+	case "sync_now":
+		job, err := buildActionJob(order)
+		if err != nil {
+			log.WithError(err).Warnf("[natsIdentitiesHandler] failed to build job for order %+v", order)
+			return
+		}
+		poller.jobs.AddPendingJob(job)
+	case "status":
+		status := poller.status.IdentityStatus(order.UserId, order.IdentityId)
+		reply, err := json.Marshal(status)
+		if err != nil {
+			log.WithError(err).Warnf("[natsIdentitiesHandler] failed to json Marshal status : %+v", status)
+			reply = []byte(`{"order":"error"}`)
+		}
+		e := mqh.NatsConn.Publish(msg.Reply, reply)
+		if e != nil {
+			log.WithError(e).Warn("[natsIdentitiesHandler] failed to publish reply on nats")
+		}
 	default:
 		log.Warnf("no handler for order '%s' on topic '%s'", order.Order, msg.Subject)
 	}
@@ -153,6 +201,8 @@ func (mqh *MqHandler) natsImapHandler(msg *nats.Msg) {
 				log.WithError(err).Warn("[natsImapHandler] failed to publish reply on nats")
 			}
 		}
+	case "job_done", "job_failed":
+		mqh.handleJobReport(imapWorker, req)
 	default:
 		log.Warnf("[natsImapHandler] received unknown order : %s", req.Order)
 		e := mqh.NatsConn.Publish(msg.Reply, []byte(`{"order":"error : unknown order"}`))
@@ -205,6 +255,8 @@ func (mqh *MqHandler) natsTwitterHandler(msg *nats.Msg) {
 				log.WithError(err).Warn("[natsTwitterHandler] failed to publish reply on nats")
 			}
 		}
+	case "job_done", "job_failed":
+		mqh.handleJobReport(twitterWorker, req)
 	default:
 		log.Warnf("[natsTwitterHandler] received unknown order : %s", req.Order)
 		e := mqh.NatsConn.Publish(msg.Reply, []byte(`{"order":"error : unknown order"}`))
@@ -214,9 +266,39 @@ func (mqh *MqHandler) natsTwitterHandler(msg *nats.Msg) {
 	}
 }
 
+// handleJobReport acks or fails a job according to the report sent by worker once job is finished
+func (mqh *MqHandler) handleJobReport(worker string, req WorkerRequest) {
+	if req.Order.JobId == "" {
+		log.Warnf("[handleJobReport] received '%s' report without job id from worker %s", req.Order.Order, req.Worker)
+		return
+	}
+	if req.Order.Order == "job_done" {
+		poller.jobs.AckJob(worker, req.Order.JobId)
+	} else {
+		poller.jobs.FailJob(worker, req.Order.JobId, req.Error)
+	}
+}
+
+// natsStatusHandler records heartbeats and jobs' statuses published by workers
+func (mqh *MqHandler) natsStatusHandler(msg *nats.Msg) {
+	var status WorkerStatus
+	err := json.Unmarshal(msg.Data, &status)
+	if err != nil {
+		log.WithError(err).Warn("[natsStatusHandler] unable to unmarshal worker status")
+		return
+	}
+	poller.status.Update(status)
+	if status.Type == JobStatusType && status.Job != nil && status.Job.State == JobFailed {
+		go poller.notifySyncError(*status.Job)
+	}
+}
+
 func (mqh *MqHandler) Stop() {
 	mqh.NatsSubIdentities.Unsubscribe()
 	mqh.NatsSubImap.Unsubscribe()
 	mqh.NatsSubTwitter.Unsubscribe()
+	if mqh.NatsSubStatus != nil {
+		mqh.NatsSubStatus.Unsubscribe()
+	}
 	mqh.NatsConn.Close()
 }
@@ -0,0 +1,98 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// JobsQueue is the interface for pending jobs backends.
+// Jobs are leased to workers for a visibility timeout : if a worker does not ack its job before lease expiration,
+// the job is considered failed and will be re-dispatched after a backoff delay.
+// After too many failures, a job is moved to a dead-letter list.
+type JobsQueue interface {
+	Push(job Job) (added bool, err error)    // adds job unless a job with same id is already pending or leased. A priority job promotes a pending one
+	Lease(worker string) (Job, error)        // returns first-in ready job for worker, or errNoPendingJob
+	Ack(worker, jobId string) error          // removes a leased job from queue
+	Fail(worker, jobId, reason string) error // puts a leased job back into queue for a later retry, or to dead-letter
+	DeadJobs(worker string) (jobs []Job, err error)
+	Pending(worker string) (count int, err error) // count of jobs pending or leased for worker
+	Close() error
+}
+
+// JobsConfig holds jobs queue parameters
+type JobsConfig struct {
+	VisibilityTimeout uint16 `mapstructure:"visibility_timeout"` // in minutes
+	MaxAttempts       uint8  `mapstructure:"max_attempts"`
+	RetryDelay        uint16 `mapstructure:"retry_delay"`     // in seconds, base of exponential backoff
+	MaxRetryDelay     uint16 `mapstructure:"max_retry_delay"` // in minutes
+}
+
+// queuePolicy is the lease and retry policy applied by queues
+type queuePolicy struct {
+	visibility  time.Duration
+	maxAttempts int
+	retryDelay  time.Duration
+	maxDelay    time.Duration
+}
+
+const (
+	defaultVisibilityTimeout = 60 * time.Minute
+	defaultMaxAttempts       = 5
+	defaultRetryDelay        = 30 * time.Second
+	defaultMaxRetryDelay     = time.Hour
+)
+
+var errNoPendingJob = errors.New(noPendingJobErr)
+var errUnknownJob = errors.New("unknown or expired job")
+
+// unexported var to help override time in tests
+var timeNow = time.Now
+
+func newQueuePolicy(config JobsConfig) queuePolicy {
+	policy := queuePolicy{
+		visibility:  defaultVisibilityTimeout,
+		maxAttempts: defaultMaxAttempts,
+		retryDelay:  defaultRetryDelay,
+		maxDelay:    defaultMaxRetryDelay,
+	}
+	if config.VisibilityTimeout > 0 {
+		policy.visibility = time.Duration(config.VisibilityTimeout) * time.Minute
+	}
+	if config.MaxAttempts > 0 {
+		policy.maxAttempts = int(config.MaxAttempts)
+	}
+	if config.RetryDelay > 0 {
+		policy.retryDelay = time.Duration(config.RetryDelay) * time.Second
+	}
+	if config.MaxRetryDelay > 0 {
+		policy.maxDelay = time.Duration(config.MaxRetryDelay) * time.Minute
+	}
+	return policy
+}
+
+// backoff returns delay to wait before retrying a job that failed `attempts` times
+func (p queuePolicy) backoff(attempts int) time.Duration {
+	delay := p.retryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= p.maxDelay {
+			return p.maxDelay
+		}
+	}
+	if delay > p.maxDelay {
+		return p.maxDelay
+	}
+	return delay
+}
+
+// jobId returns an unique id for a job order, used to dedupe pending jobs
+func jobId(job Job) string {
+	key := sha256.Sum256([]byte(job.Order.UserId + job.Order.IdentityId + job.Order.Order))
+	return hex.EncodeToString(key[:])
+}
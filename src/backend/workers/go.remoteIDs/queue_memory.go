@@ -0,0 +1,194 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryQueue is an in-memory JobsQueue.
+// It is lost when idpoller restarts and can't be shared between several idpollers.
+type memoryQueue struct {
+	pendingJobs  map[string]map[string]Job       // pattern is [worker][job-id]job
+	jobsSequence map[string][]string             // pattern is [worker][]job-id <- FIFO ordered
+	readyAt      map[string]map[string]time.Time // pattern is [worker][job-id]time for jobs waiting for a retry
+	leasedJobs   map[string]map[string]leasedJob // pattern is [worker][job-id]leasedJob
+	deadJobs     map[string][]Job                // pattern is [worker][]job
+	jobsMux      *sync.Mutex
+	policy       queuePolicy
+}
+
+type leasedJob struct {
+	job      Job
+	deadline time.Time
+}
+
+func newMemoryQueue(policy queuePolicy) *memoryQueue {
+	return &memoryQueue{
+		pendingJobs:  map[string]map[string]Job{},
+		jobsSequence: map[string][]string{},
+		readyAt:      map[string]map[string]time.Time{},
+		leasedJobs:   map[string]map[string]leasedJob{},
+		deadJobs:     map[string][]Job{},
+		jobsMux:      &sync.Mutex{},
+		policy:       policy,
+	}
+}
+
+func (mq *memoryQueue) Push(job Job) (bool, error) {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	if job.Id == "" {
+		job.Id = jobId(job)
+	}
+	if _, ok := mq.leasedJobs[job.Worker][job.Id]; ok {
+		return false, nil
+	}
+	if pending, ok := mq.pendingJobs[job.Worker][job.Id]; ok {
+		if !job.Priority || pending.Priority {
+			return false, nil
+		}
+		// promote pending job ahead of the queue
+		mq.remove(job.Worker, job.Id)
+		pending.Priority = true
+		job = pending
+	}
+	mq.enqueue(job, time.Time{})
+	return true, nil
+}
+
+func (mq *memoryQueue) Lease(worker string) (Job, error) {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	now := timeNow()
+	mq.reclaimExpired(worker, now)
+	sequence := mq.jobsSequence[worker]
+	for i, id := range sequence {
+		if mq.readyAt[worker][id].After(now) {
+			continue // job is waiting for its retry delay
+		}
+		job := mq.pendingJobs[worker][id]
+		delete(mq.pendingJobs[worker], id)
+		delete(mq.readyAt[worker], id)
+		mq.jobsSequence[worker] = append(sequence[:i], sequence[i+1:]...)
+		if _, ok := mq.leasedJobs[worker]; !ok {
+			mq.leasedJobs[worker] = make(map[string]leasedJob)
+		}
+		mq.leasedJobs[worker][id] = leasedJob{
+			job:      job,
+			deadline: now.Add(mq.policy.visibility),
+		}
+		return job, nil
+	}
+	return Job{}, errNoPendingJob
+}
+
+func (mq *memoryQueue) Ack(worker, jobId string) error {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	if _, ok := mq.leasedJobs[worker][jobId]; !ok {
+		return errUnknownJob
+	}
+	delete(mq.leasedJobs[worker], jobId)
+	return nil
+}
+
+func (mq *memoryQueue) Fail(worker, jobId, reason string) error {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	leased, ok := mq.leasedJobs[worker][jobId]
+	if !ok {
+		return errUnknownJob
+	}
+	delete(mq.leasedJobs[worker], jobId)
+	mq.retry(leased.job, reason, timeNow())
+	return nil
+}
+
+func (mq *memoryQueue) DeadJobs(worker string) ([]Job, error) {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	return append([]Job{}, mq.deadJobs[worker]...), nil
+}
+
+func (mq *memoryQueue) Pending(worker string) (int, error) {
+	mq.jobsMux.Lock()
+	defer mq.jobsMux.Unlock()
+	return len(mq.jobsSequence[worker]) + len(mq.leasedJobs[worker]), nil
+}
+
+func (mq *memoryQueue) Close() error {
+	return nil
+}
+
+// enqueue MUST be called with jobsMux locked
+func (mq *memoryQueue) enqueue(job Job, readyAt time.Time) {
+	if _, ok := mq.pendingJobs[job.Worker]; !ok {
+		mq.pendingJobs[job.Worker] = make(map[string]Job)
+		mq.readyAt[job.Worker] = make(map[string]time.Time)
+	}
+	mq.pendingJobs[job.Worker][job.Id] = job
+	sequence := mq.jobsSequence[job.Worker]
+	if job.Priority {
+		// priority jobs are queued after other priority jobs, ahead of scheduled jobs
+		i := 0
+		for i < len(sequence) && mq.pendingJobs[job.Worker][sequence[i]].Priority {
+			i++
+		}
+		sequence = append(sequence, "")
+		copy(sequence[i+1:], sequence[i:])
+		sequence[i] = job.Id
+		mq.jobsSequence[job.Worker] = sequence
+	} else {
+		mq.jobsSequence[job.Worker] = append(sequence, job.Id)
+	}
+	if !readyAt.IsZero() {
+		mq.readyAt[job.Worker][job.Id] = readyAt
+	}
+}
+
+// remove deletes a pending job from queue. MUST be called with jobsMux locked
+func (mq *memoryQueue) remove(worker, jobId string) {
+	delete(mq.pendingJobs[worker], jobId)
+	delete(mq.readyAt[worker], jobId)
+	sequence := mq.jobsSequence[worker]
+	for i, id := range sequence {
+		if id == jobId {
+			mq.jobsSequence[worker] = append(sequence[:i], sequence[i+1:]...)
+			return
+		}
+	}
+}
+
+// retry puts job back into queue after a backoff delay, or moves it to dead-letter list
+// if it reached max attempts. MUST be called with jobsMux locked
+func (mq *memoryQueue) retry(job Job, reason string, now time.Time) {
+	job.Attempts++
+	job.LastError = reason
+	if job.Attempts >= mq.policy.maxAttempts {
+		mq.deadJobs[job.Worker] = append(mq.deadJobs[job.Worker], job)
+		return
+	}
+	mq.enqueue(job, now.Add(mq.policy.backoff(job.Attempts)))
+}
+
+// reclaimExpired re-queues jobs whose lease expired, oldest first. MUST be called with jobsMux locked
+func (mq *memoryQueue) reclaimExpired(worker string, now time.Time) {
+	expired := []leasedJob{}
+	for id, leased := range mq.leasedJobs[worker] {
+		if !leased.deadline.After(now) {
+			expired = append(expired, leased)
+			delete(mq.leasedJobs[worker], id)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+	for _, leased := range expired {
+		mq.retry(leased.job, "lease expired", now)
+	}
+}
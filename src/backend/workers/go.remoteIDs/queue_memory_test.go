@@ -0,0 +1,189 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	"github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+	"time"
+)
+
+func newQueueTest() (*memoryQueue, *time.Time) {
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return now
+	}
+	return newMemoryQueue(queuePolicy{
+		visibility:  10 * time.Minute,
+		maxAttempts: 3,
+		retryDelay:  time.Minute,
+		maxDelay:    90 * time.Second,
+	}), &now
+}
+
+func testJob(identity string) Job {
+	return Job{
+		Worker: "worker",
+		Order: objects.BrokerOrder{
+			Order:      "sync",
+			IdentityId: identity,
+			UserId:     "user_id",
+		},
+	}
+}
+
+func TestMemoryQueue_Push(t *testing.T) {
+	mq, _ := newQueueTest()
+	defer func() { timeNow = time.Now }()
+
+	if added, _ := mq.Push(testJob("id1")); !added {
+		t.Error("expected job to be added")
+	}
+	if added, _ := mq.Push(testJob("id1")); added {
+		t.Error("expected duplicate pending job to be ignored")
+	}
+	if _, err := mq.Lease("worker"); err != nil {
+		t.Error(err)
+	}
+	if added, _ := mq.Push(testJob("id1")); added {
+		t.Error("expected duplicate leased job to be ignored")
+	}
+	if count, _ := mq.Pending("worker"); count != 1 {
+		t.Errorf("expected 1 job pending, got %d", count)
+	}
+}
+
+func TestMemoryQueue_Ack(t *testing.T) {
+	mq, _ := newQueueTest()
+	defer func() { timeNow = time.Now }()
+
+	mq.Push(testJob("id1"))
+	job, err := mq.Lease("worker")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := mq.Ack("worker", job.Id); err != nil {
+		t.Error(err)
+	}
+	if err := mq.Ack("worker", job.Id); err != errUnknownJob {
+		t.Errorf("expected errUnknownJob when acking twice, got %v", err)
+	}
+	if count, _ := mq.Pending("worker"); count != 0 {
+		t.Errorf("expected empty queue, got %d jobs", count)
+	}
+}
+
+func TestMemoryQueue_Fail(t *testing.T) {
+	mq, now := newQueueTest()
+	defer func() { timeNow = time.Now }()
+
+	mq.Push(testJob("id1"))
+	for attempt := 1; attempt < 3; attempt++ {
+		job, err := mq.Lease("worker")
+		if err != nil {
+			t.Errorf("attempt %d : %s", attempt, err)
+			return
+		}
+		if err := mq.Fail("worker", job.Id, "failure"); err != nil {
+			t.Error(err)
+		}
+		// job must wait for its backoff delay
+		if _, err := mq.Lease("worker"); err != errNoPendingJob {
+			t.Errorf("attempt %d : expected job to wait for retry delay, got %v", attempt, err)
+		}
+		*now = now.Add(mq.policy.backoff(attempt))
+	}
+	job, err := mq.Lease("worker")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if job.Attempts != 2 || job.LastError != "failure" {
+		t.Errorf("expected job with 2 attempts and last error, got %+v", job)
+	}
+	// last attempt moves job to dead-letter list
+	mq.Fail("worker", job.Id, "failure")
+	if count, _ := mq.Pending("worker"); count != 0 {
+		t.Errorf("expected empty queue, got %d jobs", count)
+	}
+	dead, _ := mq.DeadJobs("worker")
+	if len(dead) != 1 || dead[0].Id != job.Id {
+		t.Errorf("expected job to be in dead-letter list, got %+v", dead)
+	}
+}
+
+func TestMemoryQueue_LeaseExpiration(t *testing.T) {
+	mq, now := newQueueTest()
+	defer func() { timeNow = time.Now }()
+
+	mq.Push(testJob("id1"))
+	mq.Push(testJob("id2"))
+	first, _ := mq.Lease("worker")
+	if first.Order.IdentityId != "id1" {
+		t.Errorf("expected FIFO lease, got job for %s", first.Order.IdentityId)
+	}
+	// worker crashed, lease expires
+	*now = now.Add(11 * time.Minute)
+	second, _ := mq.Lease("worker")
+	if second.Order.IdentityId != "id2" {
+		t.Errorf("expected job for id2, got job for %s", second.Order.IdentityId)
+	}
+	if err := mq.Ack("worker", first.Id); err != errUnknownJob {
+		t.Errorf("expected errUnknownJob for an expired lease, got %v", err)
+	}
+	*now = now.Add(mq.policy.backoff(1))
+	again, err := mq.Lease("worker")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if again.Id != first.Id || again.Attempts != 1 {
+		t.Errorf("expected expired job to be re-dispatched, got %+v", again)
+	}
+}
+
+func TestQueuePolicy_backoff(t *testing.T) {
+	policy := queuePolicy{retryDelay: time.Second, maxDelay: 10 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, delay := range expected {
+		if result := policy.backoff(i + 1); result != delay {
+			t.Errorf("expected %s delay for attempt %d, got %s", delay, i+1, result)
+		}
+	}
+}
+
+func TestMemoryQueue_Priority(t *testing.T) {
+	mq, _ := newQueueTest()
+	defer func() { timeNow = time.Now }()
+
+	mq.Push(testJob("id1"))
+	mq.Push(testJob("id2"))
+	mq.Push(testJob("id3"))
+	priority := testJob("id3")
+	priority.Priority = true
+	if added, _ := mq.Push(priority); !added {
+		t.Error("expected priority job to promote pending job")
+	}
+	if added, _ := mq.Push(priority); added {
+		t.Error("expected duplicate priority job to be ignored")
+	}
+	priority = testJob("id4")
+	priority.Priority = true
+	mq.Push(priority)
+	if count, _ := mq.Pending("worker"); count != 4 {
+		t.Errorf("expected 4 jobs pending, got %d", count)
+	}
+	for _, expected := range []string{"id3", "id4", "id1", "id2"} {
+		job, err := mq.Lease("worker")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if job.Order.IdentityId != expected {
+			t.Errorf("expected job for %s, got job for %s", expected, job.Order.IdentityId)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	"encoding/json"
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/redis.v5"
+	"time"
+)
+
+// redisQueue is a JobsQueue that could be shared by several idpollers.
+// For each worker, queue is made of :
+//   - a hash of jobs (json encoded) for jobs pending or leased,
+//   - a sorted set of jobs' ids ready to be leased, scored by the time (ms) from which they could be leased,
+//     ids are prefixed by a sequence number to keep FIFO order between jobs with same score,
+//   - a sorted set of leased jobs' ids, scored by their lease deadline (ms),
+//   - a list of dead jobs (json encoded),
+//   - a sequence counter.
+//
+// All operations are run atomically by lua scripts.
+type redisQueue struct {
+	client *redis.Client
+	policy queuePolicy
+}
+
+const redisKeysPrefix = "idpoller:jobs:"
+
+// KEYS for all scripts are jobs, ready, leased, dead and sequence keys (see redisQueue.keys)
+// readyScript and retryScript are lua functions shared by scripts.
+// For retryScript, ARGV[1] = now, ARGV[2] = max attempts, ARGV[3] = retry delay, ARGV[4] = max retry delay
+const readyScript = `
+local function ready(id, at)
+	local seq = redis.call('INCR', KEYS[5])
+	redis.call('ZADD', KEYS[2], at, string.format('%020d', seq) .. ':' .. id)
+end
+`
+
+// retryScript is the lua counterpart of memoryQueue.retry
+const retryScript = readyScript + `
+local function retry(id, reason, now)
+	local raw = redis.call('HGET', KEYS[1], id)
+	if not raw then
+		return
+	end
+	local job = cjson.decode(raw)
+	job['attempts'] = (tonumber(job['attempts']) or 0) + 1
+	job['last_error'] = reason
+	local encoded = cjson.encode(job)
+	if job['attempts'] >= tonumber(ARGV[2]) then
+		redis.call('HDEL', KEYS[1], id)
+		redis.call('RPUSH', KEYS[4], encoded)
+		return
+	end
+	local delay = tonumber(ARGV[3]) * 2 ^ (job['attempts'] - 1)
+	if delay > tonumber(ARGV[4]) then
+		delay = tonumber(ARGV[4])
+	end
+	redis.call('HSET', KEYS[1], id, encoded)
+	ready(id, now + delay)
+end
+`
+
+var (
+	// ARGV[1] = job id, ARGV[2] = json job, ARGV[3] = now, ARGV[4] = 1 for a priority job.
+	// priority jobs are scored 0 to be leased before scheduled jobs.
+	pushScript = redis.NewScript(readyScript + `
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 1 then
+	if ARGV[4] == '1' then
+		ready(ARGV[1], 0)
+	else
+		ready(ARGV[1], ARGV[3])
+	end
+	return 1
+end
+if ARGV[4] ~= '1' or redis.call('ZSCORE', KEYS[3], ARGV[1]) then
+	return 0
+end
+local job = cjson.decode(redis.call('HGET', KEYS[1], ARGV[1]))
+if job['priority'] then
+	return 0
+end
+-- promote pending job ahead of the queue
+local suffix = ':' .. ARGV[1]
+for _, member in ipairs(redis.call('ZRANGE', KEYS[2], 0, -1)) do
+	if string.sub(member, 21) == suffix then
+		redis.call('ZREM', KEYS[2], member)
+		break
+	end
+end
+job['priority'] = true
+redis.call('HSET', KEYS[1], ARGV[1], cjson.encode(job))
+ready(ARGV[1], 0)
+return 1
+`)
+	// ARGV[5] = visibility timeout
+	leaseScript = redis.NewScript(retryScript + `
+local now = tonumber(ARGV[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', now)
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], id)
+	retry(id, 'lease expired', now)
+end
+local members = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, 1)
+if #members == 0 then
+	return false
+end
+redis.call('ZREM', KEYS[2], members[1])
+local id = string.sub(members[1], 22)
+redis.call('ZADD', KEYS[3], now + tonumber(ARGV[5]), id)
+return redis.call('HGET', KEYS[1], id)
+`)
+	// ARGV[1] = job id
+	ackScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[3], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+return 1
+`)
+	// ARGV[5] = job id, ARGV[6] = reason
+	failScript = redis.NewScript(retryScript + `
+if redis.call('ZREM', KEYS[3], ARGV[5]) == 0 then
+	return 0
+end
+retry(ARGV[5], ARGV[6], tonumber(ARGV[1]))
+return 1
+`)
+)
+
+func newRedisQueue(config CacheConfig, policy queuePolicy) (*redisQueue, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Host,
+		Password: config.Password,
+		DB:       config.Db,
+	})
+	_, err := client.Ping().Result()
+	if err != nil {
+		log.WithError(err).Errorf("[newRedisQueue] initialize failed")
+		return nil, err
+	}
+	return &redisQueue{
+		client: client,
+		policy: policy,
+	}, nil
+}
+
+func (rq *redisQueue) Push(job Job) (bool, error) {
+	if job.Id == "" {
+		job.Id = jobId(job)
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return false, err
+	}
+	priority := 0
+	if job.Priority {
+		priority = 1
+	}
+	added, err := scriptResult(pushScript.Run(rq.client, rq.keys(job.Worker), job.Id, string(data), milliseconds(timeNow()), priority))
+	return added == 1, err
+}
+
+func (rq *redisQueue) Lease(worker string) (Job, error) {
+	args := append(rq.policyArgs(), int64(rq.policy.visibility/time.Millisecond))
+	raw, err := leaseScript.Run(rq.client, rq.keys(worker), args...).Result()
+	if err == redis.Nil {
+		return Job{}, errNoPendingJob
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{}
+	str, _ := raw.(string)
+	err = json.Unmarshal([]byte(str), &job)
+	return job, err
+}
+
+func (rq *redisQueue) Ack(worker, jobId string) error {
+	acked, err := scriptResult(ackScript.Run(rq.client, rq.keys(worker), jobId))
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return errUnknownJob
+	}
+	return nil
+}
+
+func (rq *redisQueue) Fail(worker, jobId, reason string) error {
+	args := append(rq.policyArgs(), jobId, reason)
+	failed, err := scriptResult(failScript.Run(rq.client, rq.keys(worker), args...))
+	if err != nil {
+		return err
+	}
+	if failed == 0 {
+		return errUnknownJob
+	}
+	return nil
+}
+
+func (rq *redisQueue) DeadJobs(worker string) (jobs []Job, err error) {
+	raws, err := rq.client.LRange(rq.keys(worker)[3], 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range raws {
+		job := Job{}
+		if e := json.Unmarshal([]byte(raw), &job); e != nil {
+			log.WithError(e).Warnf("[redisQueue] failed to unmarshal dead job : %s", raw)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return
+}
+
+func (rq *redisQueue) Pending(worker string) (int, error) {
+	count, err := rq.client.HLen(rq.keys(worker)[0]).Result()
+	return int(count), err
+}
+
+func (rq *redisQueue) Close() error {
+	return rq.client.Close()
+}
+
+// keys returns redis keys for worker's jobs, ready, leased and dead lists, and sequence counter.
+// worker's name is enclosed in a hash tag to keep all keys in the same slot for redis cluster.
+func (rq *redisQueue) keys(worker string) []string {
+	prefix := redisKeysPrefix + "{" + worker + "}:"
+	return []string{prefix + "jobs", prefix + "ready", prefix + "leased", prefix + "dead", prefix + "seq"}
+}
+
+func (rq *redisQueue) policyArgs() []interface{} {
+	return []interface{}{
+		milliseconds(timeNow()),
+		rq.policy.maxAttempts,
+		int64(rq.policy.retryDelay / time.Millisecond),
+		int64(rq.policy.maxDelay / time.Millisecond),
+	}
+}
+
+// scriptResult returns integer replied by a lua script
+func scriptResult(cmd *redis.Cmd) (int64, error) {
+	res, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.(int64)
+	return n, nil
+}
+
+func milliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -37,7 +37,8 @@ func (s *Scheduler) Start() {
 	s.MainCron.Start()
 }
 
-// AddSyncJobFor builds job from cacheEntry and schedules it in MainCron
+// AddSyncJobFor builds job from cacheEntry and schedules it in MainCron,
+// either with entry's cron spec or sync windows if any, or every pollInterval minutes.
 // returns cacheEntry updated with its cronId
 func (s *Scheduler) AddSyncJobFor(entry cacheEntry) (cacheEntry, error) {
 	var err error
@@ -47,6 +48,15 @@ func (s *Scheduler) AddSyncJobFor(entry cacheEntry) (cacheEntry, error) {
 		log.WithError(err).Warn("[AddSyncJobFor] failed to build job to MainCron")
 		return entry, errors.New("[AddSyncJobFor] failed to build job to MainCron")
 	}
+	schedule, err := entry.syncSchedule()
+	if err != nil {
+		log.WithError(err).Warnf("[AddSyncJobFor] invalid sync schedule for remote %s", entry.remoteID.String())
+		return entry, errors.New("[AddSyncJobFor] invalid sync schedule")
+	}
+	if schedule != nil {
+		entry.cronId = s.MainCron.Schedule(schedule, job)
+		return entry, nil
+	}
 	entry.cronId, err = s.MainCron.AddJob(cronStr, job)
 	if err != nil {
 		log.WithError(err).Warn("[AddSyncJobFor] failed to add job to MainCron")
@@ -60,10 +70,17 @@ func (s *Scheduler) RemoveJobFor(entry cacheEntry) {
 	s.MainCron.Remove(entry.cronId)
 }
 
-// UpdateJobFor removes remote identity's job and re-schedule it with new pollinterval
+// UpdateSyncJobFor re-schedules remote identity's job with new pollinterval or sync schedule.
+// New job is scheduled before previous one is removed, thus identity keeps its previous job if new one can't be added.
 func (s *Scheduler) UpdateSyncJobFor(entry cacheEntry) (cacheEntry, error) {
-	s.RemoveJobFor(entry)
-	return s.AddSyncJobFor(entry)
+	previous := entry.cronId
+	entry, err := s.AddSyncJobFor(entry)
+	if err != nil {
+		entry.cronId = previous
+		return entry, err
+	}
+	s.MainCron.Remove(previous)
+	return entry, nil
 }
 
 func (s *Scheduler) Stop() {
@@ -170,5 +170,78 @@ func TestScheduler_UpdateSyncJobFor(t *testing.T) {
 		if entry.cronId == oldCronId || entry.cronId == 0 {
 			t.Error("expected a new cron id after updating entry")
 		}
+		entries[i] = entry
+	}
+	if len(sch.MainCron.Entries()) != count+1 {
+		t.Errorf("expected %d jobs in MainCron after updates, got %d", count+1, len(sch.MainCron.Entries()))
+	}
+
+	// update with an invalid sync schedule must keep previous job
+	entry := entries[0]
+	entry.pollWindows = `[{"start":"08:00","end":"19:00","interval":0}]`
+	entry, err = sch.UpdateSyncJobFor(entry)
+	if err == nil {
+		t.Error("expected UpdateSyncJobFor returned an error for invalid sync windows")
+	}
+	if entry.cronId != entries[0].cronId {
+		t.Errorf("expected entry to keep its previous cron id %d, got %d", entries[0].cronId, entry.cronId)
+	}
+	found := false
+	for _, job := range sch.MainCron.Entries() {
+		if job.ID == entries[0].cronId {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected previous job to be still scheduled after a failed update")
+	}
+}
+
+func TestScheduler_AddSyncJobFor_withSchedule(t *testing.T) {
+	poller.Config = PollerConfig{
+		ScanInterval: 10,
+	}
+	sch, err := initScheduler()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	id := objects.UUID(uuid.NewV4())
+
+	// test invalid sync windows
+	_, err = sch.AddSyncJobFor(cacheEntry{
+		pollInterval:   "15",
+		pollWindows:    `[{"start":"08:00","end":"19:00","interval":0}]`,
+		remoteID:       id,
+		remoteProtocol: "email",
+		userID:         id,
+	})
+	if err == nil {
+		t.Error("expected AddSyncJobFor returned an error for invalid sync windows")
+	}
+
+	// test a window that includes now
+	now := time.Now().UTC()
+	entry, err := sch.AddSyncJobFor(cacheEntry{
+		pollInterval:   "15",
+		pollTimezone:   "UTC",
+		pollWindows:    `[{"start":"` + now.Add(-time.Hour).Format("15:04") + `","end":"` + now.Add(time.Hour).Format("15:04") + `","interval":2}]`,
+		remoteID:       id,
+		remoteProtocol: "email",
+		userID:         id,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if entry.cronId == 0 {
+		t.Error("expected entry.cronId has been set, got 0")
+	}
+	sch.MainCron.Start()
+	defer sch.MainCron.Stop()
+	syncJob := sch.MainCron.Entries()[0]
+	dur := syncJob.Next.Sub(time.Now())
+	if dur < 0 || dur > 2*time.Minute {
+		t.Errorf("expected job to be run within sync window's interval, got %d seconds", dur/time.Second)
 	}
 }
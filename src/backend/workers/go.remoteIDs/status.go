@@ -0,0 +1,112 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	. "github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"sync"
+	"time"
+)
+
+// StatusHandler aggregates heartbeats and jobs' statuses published by workers
+type StatusHandler struct {
+	heartbeats map[string]time.Time       // pattern is [worker-id]last heartbeat
+	identities map[string]*identityStatus // pattern is [user-id+identity-id]status
+	mux        *sync.Mutex
+}
+
+type identityStatus struct {
+	errors  []JobStatus // most recent first
+	last    *JobStatus
+	running *JobStatus
+}
+
+const (
+	workerTimeout  = 2 * time.Minute // how long to wait for a worker's heartbeat before considering its job lost
+	maxErrorsKept  = 20              // errors history length for each identity
+	jobLostMessage = "worker stopped sending heartbeats"
+)
+
+func newStatusHandler() *StatusHandler {
+	return &StatusHandler{
+		heartbeats: map[string]time.Time{},
+		identities: map[string]*identityStatus{},
+		mux:        &sync.Mutex{},
+	}
+}
+
+// Update records a status published by a worker
+func (sh *StatusHandler) Update(status WorkerStatus) {
+	sh.mux.Lock()
+	defer sh.mux.Unlock()
+	sh.heartbeats[status.Worker] = timeNow()
+	if status.Type != JobStatusType || status.Job == nil {
+		return
+	}
+	job := *status.Job
+	key := job.UserId + job.IdentityId
+	idStatus, ok := sh.identities[key]
+	if !ok {
+		idStatus = new(identityStatus)
+		sh.identities[key] = idStatus
+	}
+	switch job.State {
+	case JobStarted, JobProgress:
+		idStatus.running = &job
+	case JobDone, JobFailed:
+		idStatus.finish(job)
+	}
+}
+
+// IdentityStatus returns aggregated sync status for a remote identity
+func (sh *StatusHandler) IdentityStatus(userId, identityId string) RemoteIdentityStatus {
+	sh.mux.Lock()
+	defer sh.mux.Unlock()
+	status := RemoteIdentityStatus{
+		Errors:     []JobStatus{},
+		IdentityId: identityId,
+	}
+	idStatus, ok := sh.identities[userId+identityId]
+	if !ok {
+		return status
+	}
+	if running := idStatus.running; running != nil {
+		lastSeen := sh.heartbeats[running.Worker]
+		if running.Updated.After(lastSeen) {
+			lastSeen = running.Updated
+		}
+		if timeNow().Sub(lastSeen) > workerTimeout {
+			lost := *running
+			lost.State = JobLost
+			lost.Errors = append(lost.Errors, jobLostMessage)
+			idStatus.finish(lost)
+		}
+	}
+	status.LastSync = idStatus.last
+	status.RunningSync = idStatus.running
+	status.Errors = append(status.Errors, idStatus.errors...)
+	return status
+}
+
+// Remove forgets statuses for a remote identity
+func (sh *StatusHandler) Remove(userId, identityId string) {
+	sh.mux.Lock()
+	defer sh.mux.Unlock()
+	delete(sh.identities, userId+identityId)
+}
+
+// finish moves job to last sync and errors history. MUST be called with StatusHandler's mux locked
+func (ids *identityStatus) finish(job JobStatus) {
+	if ids.running != nil && ids.running.JobId == job.JobId && ids.running.Worker == job.Worker {
+		ids.running = nil
+	}
+	ids.last = &job
+	if job.State != JobDone {
+		ids.errors = append([]JobStatus{job}, ids.errors...)
+		if len(ids.errors) > maxErrorsKept {
+			ids.errors = ids.errors[:maxErrorsKept]
+		}
+	}
+}
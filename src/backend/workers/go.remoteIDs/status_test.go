@@ -0,0 +1,90 @@
+// Copyleft (ɔ) 2019 The Caliopen contributors.
+// Use of this source code is governed by a GNU AFFERO GENERAL PUBLIC
+// license (AGPL) that can be found in the LICENSE file.
+
+package go_remoteIDs
+
+import (
+	"github.com/CaliOpen/Caliopen/src/backend/defs/go-objects"
+	"testing"
+	"time"
+)
+
+func jobStatus(state string, at time.Time) objects.WorkerStatus {
+	return objects.WorkerStatus{
+		Job: &objects.JobStatus{
+			IdentityId: "identity_id",
+			JobId:      "job_id",
+			Order:      "sync",
+			Started:    at,
+			State:      state,
+			Updated:    at,
+			UserId:     "user_id",
+			Worker:     "worker",
+		},
+		Type:   objects.JobStatusType,
+		Worker: "worker",
+	}
+}
+
+func TestStatusHandler_Update(t *testing.T) {
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() { timeNow = time.Now }()
+	sh := newStatusHandler()
+
+	sh.Update(jobStatus(objects.JobStarted, now))
+	status := sh.IdentityStatus("user_id", "identity_id")
+	if status.RunningSync == nil || status.LastSync != nil {
+		t.Errorf("expected a running sync only, got %+v", status)
+	}
+
+	sh.Update(jobStatus(objects.JobFailed, now))
+	sh.Update(jobStatus(objects.JobDone, now))
+	status = sh.IdentityStatus("user_id", "identity_id")
+	if status.RunningSync != nil {
+		t.Errorf("expected no running sync, got %+v", status.RunningSync)
+	}
+	if status.LastSync == nil || status.LastSync.State != objects.JobDone {
+		t.Errorf("expected last sync to be done, got %+v", status.LastSync)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].State != objects.JobFailed {
+		t.Errorf("expected one failed job in errors history, got %+v", status.Errors)
+	}
+
+	sh.Remove("user_id", "identity_id")
+	status = sh.IdentityStatus("user_id", "identity_id")
+	if status.LastSync != nil || len(status.Errors) != 0 {
+		t.Errorf("expected empty status after removal, got %+v", status)
+	}
+}
+
+func TestStatusHandler_lostJob(t *testing.T) {
+	now := time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() { timeNow = time.Now }()
+	sh := newStatusHandler()
+
+	sh.Update(jobStatus(objects.JobStarted, now))
+	now = now.Add(workerTimeout / 2)
+	sh.Update(objects.WorkerStatus{Type: objects.HeartbeatStatus, Worker: "worker"})
+	if status := sh.IdentityStatus("user_id", "identity_id"); status.RunningSync == nil {
+		t.Errorf("expected sync to be running while worker sends heartbeats, got %+v", status)
+	}
+
+	now = now.Add(workerTimeout + time.Second)
+	status := sh.IdentityStatus("user_id", "identity_id")
+	if status.RunningSync != nil {
+		t.Errorf("expected no running sync, got %+v", status.RunningSync)
+	}
+	if status.LastSync == nil || status.LastSync.State != objects.JobLost {
+		t.Errorf("expected last sync to be lost, got %+v", status.LastSync)
+	}
+	if len(status.Errors) != 1 {
+		t.Errorf("expected lost job in errors history, got %+v", status.Errors)
+	}
+}